@@ -0,0 +1,124 @@
+package autolbclean
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+// addressStatusReserved is the status of an address that is reserved,
+// but not used by any resource
+const addressStatusReserved = `RESERVED`
+
+// unownedAddressPurposes are the purposes of addresses that are never
+// reported as used by anything, as they are ranges handed over to a
+// service (e.g. for private service access), not IPs of a resource
+var unownedAddressPurposes = map[string]struct{}{
+	`VPC_PEERING`:             {},
+	`PRIVATE_SERVICE_CONNECT`: {},
+	`IPSEC_INTERCONNECT`:      {},
+}
+
+// ListUnusedAddresses returns the deletions of the static IP addresses
+// created for load balancers that are reserved, but no longer used by
+// any forwarding rule. These are billed for as long as they exist.
+//
+// An address may have been reserved for years before its forwarding rule
+// went away, so the age threshold of addresses is measured from when the
+// address was first seen unused, which is remembered in the store.
+// Addresses that are not seen unused in this run are forgotten. Without
+// a store that can remember them, no address is deleted
+func (app *App) ListUnusedAddresses(ctx context.Context) ([]*Deletion, error) {
+	c := app.Config()
+
+	var addresses []*compute.Address
+	if err := app.checkInventory(ctx, KindAddresses, func() (int, error) {
+		var err error
+		addresses, err = app.listAddresses(ctx)
+		return len(addresses), errors.Wrap(err, `failed to list addresses`)
+	}); err != nil {
+		return nil, err
+	}
+
+	store, _ := app.store.(UnusedAddressStore)
+	known := make(map[string]*Candidate)
+	if store != nil {
+		records, err := store.ListUnusedAddresses(ctx, app.project)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to load unused addresses`)
+		}
+		for _, r := range records {
+			known[r.SelfLink] = r
+		}
+	}
+
+	var clusters []*container.Cluster
+	if c.ClusterCrossCheck {
+		var err error
+		if clusters, err = app.liveClusters(ctx); err != nil {
+			return nil, errors.Wrap(err, `failed to cross-check GKE clusters`)
+		}
+	}
+
+	owned := app.multiClusterOwned(ctx)
+	now := time.Now().UTC()
+	var seen []*Candidate
+	var result []*Deletion
+	for _, address := range addresses {
+		if !hasAnyPrefix(address.Name, c.addressPrefixes()) || c.IsExcluded(address.Name) || c.IsProtected(address.Labels, address.Description) {
+			continue
+		}
+
+		if address.Status != addressStatusReserved || len(address.Users) > 0 {
+			continue
+		}
+		if _, ok := unownedAddressPurposes[address.Purpose]; ok {
+			continue
+		}
+
+		if c.ownedByLiveCluster(address.Name, clusters) || owned(address.Name) {
+			continue
+		}
+
+		r, ok := known[address.SelfLink]
+		if !ok {
+			r = &Candidate{SelfLink: address.SelfLink, FirstSeen: now}
+		}
+		r.LastSeen = now
+		seen = append(seen, r)
+
+		// the controllers reserve the address before they create the
+		// forwarding rule that uses it
+		if c.isYoung(KindAddresses, address.CreationTimestamp) {
+			continue
+		}
+		if store == nil || now.Sub(r.FirstSeen) < c.AgeThresholdOf(KindAddresses) {
+			continue
+		}
+
+		_, region, err := ParseAddresses(address.SelfLink)
+		if err != nil {
+			continue
+		}
+		if sweepPolicyKeeps(ctx, c, sweptResource(KindAddresses, address.Name, region, ``, address.CreationTimestamp), address.Labels) {
+			continue
+		}
+
+		result = append(result, &Deletion{
+			Kind:   KindAddresses,
+			Name:   address.Name,
+			Region: region,
+		})
+	}
+
+	if store != nil {
+		if err := store.SaveUnusedAddresses(ctx, app.project, seen); err != nil {
+			return nil, errors.Wrap(err, `failed to save unused addresses`)
+		}
+	}
+	sortDeletions(result)
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListUnusedAddresses(t *testing.T) {
+	const selfLink = `https://www.googleapis.com/compute/v1/projects/p/global/addresses/k8s-fw-default-web--1`
+	fake := fakeCompute{
+		`aggregated/addresses`: map[string]interface{}{},
+		`global/addresses`: map[string]interface{}{
+			`items`: []interface{}{
+				map[string]interface{}{
+					`name`:              `k8s-fw-default-web--1`,
+					`selfLink`:          selfLink,
+					`status`:            `RESERVED`,
+					`creationTimestamp`: `2020-01-01T00:00:00Z`,
+				},
+			},
+		},
+	}
+
+	ctx := context.Background()
+	store := autolbclean.NewMemoryStore()
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake}, autolbclean.WithStore(store))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	// reserved for years, but only just seen unused
+	list, err := app.ListUnusedAddresses(ctx)
+	if !assert.NoError(t, err, `ListUnusedAddresses should succeed`) || !assert.Empty(t, list, `addresses that were just seen unused should be kept`) {
+		return
+	}
+	records, err := store.(autolbclean.UnusedAddressStore).ListUnusedAddresses(ctx, `p`)
+	if !assert.NoError(t, err, `listing unused addresses should succeed`) || !assert.Len(t, records, 1, `the address should be remembered`) {
+		return
+	}
+
+	records[0].FirstSeen = time.Now().Add(-48 * time.Hour)
+	if !assert.NoError(t, store.(autolbclean.UnusedAddressStore).SaveUnusedAddresses(ctx, `p`, records), `saving unused addresses should succeed`) {
+		return
+	}
+	list, err = app.ListUnusedAddresses(ctx)
+	if !assert.NoError(t, err, `ListUnusedAddresses should succeed`) || !assert.Len(t, list, 1, `addresses unused for long enough should be deleted`) {
+		return
+	}
+	if !assert.Equal(t, `k8s-fw-default-web--1`, list[0].Name, `name should match`) {
+		return
+	}
+}
@@ -0,0 +1,669 @@
+package autolbclean
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/appengine"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// applyAdminState returns a copy of c with the admin state applied
+func applyAdminState(c *Config, st *AdminState) *Config {
+	applied := *c
+	applied.Paused = c.Paused || st.Paused
+	applied.Exclusions = append(append([]string(nil), c.Exclusions...), st.Suppressions...)
+	applied.Snoozes = append(append([]Snooze(nil), c.Snoozes...), st.Snoozes...)
+	return &applied
+}
+
+// adminIdentity returns the verified email address of the caller, taken
+// from the Google-signed identity token in the Authorization header.
+// Without ADMIN_AUDIENCE, tokens issued for anything else would be
+// accepted, so every caller is refused
+func adminIdentity(r *http.Request) (string, error) {
+	if len(adminAudience) == 0 {
+		return ``, errors.New(`ADMIN_AUDIENCE is not set`)
+	}
+
+	token := strings.TrimPrefix(r.Header.Get(`Authorization`), `Bearer `)
+	if len(token) == 0 || token == r.Header.Get(`Authorization`) {
+		return ``, errors.New(`missing identity token`)
+	}
+
+	payload, err := idtoken.Validate(r.Context(), token, adminAudience)
+	if err != nil {
+		return ``, errors.Wrap(err, `failed to validate identity token`)
+	}
+
+	email, _ := payload.Claims[`email`].(string)
+	if verified, _ := payload.Claims[`email_verified`].(bool); !verified || len(email) == 0 {
+		return ``, errors.New(`identity token does not carry a verified email address`)
+	}
+	return email, nil
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// remoteAddr returns the address of the caller. On App Engine the
+// connection comes from the frontend, which passes the real address
+// along in a header
+func remoteAddr(r *http.Request) string {
+	if v := r.Header.Get(`X-Appengine-User-Ip`); len(v) > 0 {
+		return v
+	}
+	return r.RemoteAddr
+}
+
+// requireRole wraps an admin API handler, so that it is only invoked
+// for callers that have been granted at least the given role for the
+// whole project. Every invocation, including the rejected ones, is
+// recorded in the access log
+func requireRole(role string, h func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return authorize(role, RoleFor, h)
+}
+
+// requireTeamRole is requireRole for the handlers that limit what they
+// do to the teams of the caller, with scopeOrphans or teamScope, so
+// that a role limited to a team is enough to call them
+func requireTeamRole(role string, h func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return authorize(role, TeamRoleFor, h)
+}
+
+func authorize(role string, roleFor func([]*RoleBinding, string) string, h func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := appengine.NewContext(r)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		entry := &AccessLogEntry{
+			At:         time.Now().UTC(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RemoteAddr: remoteAddr(r),
+		}
+		defer func() {
+			entry.Status = rec.status
+			if err := (datastoreAuditStore{}).RecordAccess(ctx, entry); err != nil {
+				warningf(ctx, `Failed to record admin API access: %s`, err)
+			}
+		}()
+
+		if err := r.ParseForm(); err == nil {
+			entry.Params = Redact(r.Form.Encode())
+		}
+
+		email, err := adminIdentity(r)
+		if err != nil {
+			debugf(ctx, `Rejected admin API request to %s: %s`, r.URL.Path, err)
+			http.Error(rec, `unauthorized`, http.StatusUnauthorized)
+			return
+		}
+		entry.Email = email
+		entry.Role = roleFor(adminRoles, email)
+
+		if !HasRole(entry.Role, role) {
+			warningf(ctx, `Rejected admin API request to %s by %s: %s role required`, r.URL.Path, email, role)
+			http.Error(rec, `forbidden`, http.StatusForbidden)
+			return
+		}
+		h(rec, r, email)
+	}
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		http.Error(w, `method not allowed`, http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpAdminCandidates(w http.ResponseWriter, r *http.Request, email string) {
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+
+	orphans, err := app.PreviewOrphans(ctx)
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, scopeOrphans(app, r, email, RoleViewer, orphans))
+}
+
+// scopeOrphans drops the orphans that the admin may not act on with the
+// given role, as their role is limited to other teams, and the orphans
+// of other teams than the one given in the team parameter, if any
+func scopeOrphans(app *App, r *http.Request, email, role string, orphans []*Orphan) []*Orphan {
+	c := app.Config()
+	allowed := teamScope(adminRoles, c, email, role)
+	team := r.FormValue(`team`)
+
+	list := []*Orphan{}
+	for _, o := range orphans {
+		if !allowed(o) || (len(team) > 0 && c.TeamOf(o) != team) {
+			continue
+		}
+		list = append(list, o)
+	}
+	return list
+}
+
+// httpAdminHistory lists the runs of the project since the given
+// duration ago (24h by default), or the deletion events of a single run
+func httpAdminHistory(w http.ResponseWriter, r *http.Request, email string) {
+	ctx := appengine.NewContext(r)
+	h := appengineStore.(HistoryStore)
+
+	if runID := r.FormValue(`run`); len(runID) > 0 {
+		events, err := h.ListEvents(ctx, runID)
+		if err != nil {
+			http.Error(w, RedactError(err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, events)
+		return
+	}
+
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+
+	since := 24 * time.Hour
+	if v := r.FormValue(`since`); len(v) > 0 {
+		d, err := ParseSnoozeDuration(v)
+		if err != nil {
+			http.Error(w, `invalid value for since`, http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+
+	runs, err := h.ListRuns(ctx, app.project, time.Now().UTC().Add(-since))
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, runs)
+}
+
+// httpAdminAudit returns a page of the deletion events of the project,
+// filtered by kind, cluster, outcome and time range, and by the teams
+// of the admin if their role is limited to some
+func httpAdminAudit(w http.ResponseWriter, r *http.Request, email string) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	now := time.Now().UTC()
+	q := &EventQuery{
+		Kind:    r.FormValue(`kind`),
+		Cluster: r.FormValue(`cluster`),
+		Outcome: r.FormValue(`outcome`),
+		Cursor:  r.FormValue(`cursor`),
+	}
+	for name, dst := range map[string]*time.Time{`since`: &q.Since, `until`: &q.Until} {
+		v := r.FormValue(name)
+		if len(v) == 0 {
+			continue
+		}
+		t, err := ParseQueryTime(v, now)
+		if err != nil {
+			http.Error(w, `invalid value for `+name, http.StatusBadRequest)
+			return
+		}
+		*dst = t
+	}
+	if v := r.FormValue(`limit`); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, `invalid value for limit`, http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+	if err := q.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+
+	// events only record the cluster of their resource, so team scoped
+	// admins only see the events of the clusters of their teams
+	if _, all := TeamsFor(adminRoles, email, RoleViewer); !all {
+		q.allowed = teamScope(adminRoles, app.Config(), email, RoleViewer)
+	}
+	page, err := app.QueryEvents(ctx, q)
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, page)
+}
+
+func httpAdminReport(w http.ResponseWriter, r *http.Request, email string) {
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+
+	format := ReportFormatText
+	if v := r.FormValue(`format`); len(v) > 0 {
+		if format, err = ParseReportFormat(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	report := &Report{
+		Project:   app.project,
+		StartedAt: time.Now().UTC(),
+	}
+
+	orphans, err := app.PreviewOrphans(ctx)
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	report.Orphans = scopeOrphans(app, r, email, RoleViewer, orphans)
+
+	if quotas, err := app.ListQuotas(ctx); err == nil {
+		report.Quotas = quotas
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, report, format); err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	if format == ReportFormatText {
+		w.Header().Set(`Content-Type`, `text/plain; charset=utf-8`)
+	} else {
+		w.Header().Set(`Content-Type`, `application/json`)
+	}
+	w.Write([]byte(Redact(buf.String())))
+}
+
+// httpAdminApply schedules the deletion of the orphaned load balancer
+// with the given target proxy right away
+func httpAdminApply(w http.ResponseWriter, r *http.Request, email string) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+
+	if held := app.Config().DeletionsHeld(time.Now()); len(held) > 0 {
+		http.Error(w, held, http.StatusServiceUnavailable)
+		return
+	}
+
+	tpname := r.FormValue(`target_proxy`)
+	orphans, err := app.PreviewOrphans(ctx)
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+
+	for _, o := range scopeOrphans(app, r, email, RoleOperator, orphans) {
+		if o.TargetProxy != tpname {
+			continue
+		}
+		infof(ctx, `%s requested the deletion of %s`, email, tpname)
+		if failed := scheduleOrphanDeletion(ctx, app, &Report{Project: app.project}, o, isDryRun(r)); failed > 0 {
+			http.Error(w, fmt.Sprintf(`failed to schedule %d deletions`, failed), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, o)
+		return
+	}
+	http.Error(w, `no such orphan`, http.StatusNotFound)
+}
+
+// httpAdminSuppress excludes the resources matching the given pattern
+// from being cleaned up
+func httpAdminSuppress(w http.ResponseWriter, r *http.Request, email string) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	pattern := r.FormValue(`pattern`)
+	if _, err := path.Match(pattern, ``); err != nil || len(pattern) == 0 {
+		http.Error(w, `invalid pattern`, http.StatusBadRequest)
+		return
+	}
+
+	err := appengineStore.UpdateAdminState(ctx, func(st *AdminState) {
+		st.suppress(pattern, time.Now().UTC())
+	})
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	infof(ctx, `%s suppressed cleanup of %s`, email, pattern)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpAdminExportSuppressions writes the suppressions and the snoozes
+// as a YAML document that the import endpoint and the CLI take
+func httpAdminExportSuppressions(w http.ResponseWriter, r *http.Request, email string) {
+	ctx := appengine.NewContext(r)
+	st, err := appengineStore.LoadAdminState(ctx)
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+
+	buf, err := yaml.Marshal(ExportSuppressions(st))
+	if err != nil {
+		http.Error(w, `failed to encode suppressions`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(`Content-Type`, `application/yaml`)
+	w.Write(buf)
+}
+
+// httpAdminImportSuppressions merges the suppressions and the snoozes
+// in the YAML document of the request body into the admin state, or
+// replaces them with replace=true
+func httpAdminImportSuppressions(w http.ResponseWriter, r *http.Request, email string) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	replace := r.FormValue(`replace`) == `true`
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, `failed to read request`, http.StatusBadRequest)
+		return
+	}
+	l, err := ParseSuppressionList(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = appengineStore.UpdateAdminState(ctx, func(st *AdminState) {
+		l.Apply(st, replace)
+	})
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	infof(ctx, `%s imported %d suppressions and %d snoozes (replace = %t)`, email, len(l.Suppressions), len(l.Snoozes), replace)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpAdminSnooze holds back the orphan with the given target proxy
+// self link for a while. Once the snooze expires, the orphan is
+// evaluated again
+func httpAdminSnooze(w http.ResponseWriter, r *http.Request, email string) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	selfLink := r.FormValue(`self_link`)
+	if len(selfLink) == 0 {
+		http.Error(w, `self_link is required`, http.StatusBadRequest)
+		return
+	}
+	d, err := ParseSnoozeDuration(r.FormValue(`duration`))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = appengineStore.UpdateAdminState(ctx, func(st *AdminState) {
+		st.Snoozes = AddSnooze(st.Snoozes, selfLink, d, email, time.Now().UTC())
+	})
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	infof(ctx, `%s snoozed cleanup of %s for %s`, email, selfLink, d)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func httpAdminPause(w http.ResponseWriter, r *http.Request, email string) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	paused, err := strconv.ParseBool(r.FormValue(`paused`))
+	if err != nil {
+		http.Error(w, `invalid value for paused`, http.StatusBadRequest)
+		return
+	}
+
+	// purging voids the delete jobs that are already in the queue, so
+	// that unpausing does not carry out decisions made before the pause
+	purge := paused && r.FormValue(`purge`) == `true`
+	err = appengineStore.UpdateAdminState(ctx, func(st *AdminState) {
+		st.Paused = paused
+		if purge {
+			st.Epoch++
+		}
+	})
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	infof(ctx, `%s set paused to %t (purge = %t)`, email, paused, purge)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpAdminResetInventory forgets the inventory count of a kind, so
+// that a drop that turned out to be real stops holding back the runs
+func httpAdminResetInventory(w http.ResponseWriter, r *http.Request, email string) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	kind := r.FormValue(`kind`)
+	if len(kind) == 0 {
+		http.Error(w, `kind is required`, http.StatusBadRequest)
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+	if err := app.ResetInventory(ctx, kind); err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	infof(ctx, `%s reset the inventory of %s`, email, kind)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func httpAdminConfig(w http.ResponseWriter, r *http.Request, email string) {
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+
+	buf, err := yaml.Marshal(app.Config())
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(`Content-Type`, `application/yaml`)
+	w.Write(buf)
+}
+
+// httpStatus describes the latest run of the project. It responds with
+// 503 when no check has finished lately, so that scripts can tell that
+// the cron is not running
+func httpStatus(w http.ResponseWriter, r *http.Request, email string) {
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+
+	summary, err := app.RunSummary(ctx)
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(`Content-Type`, `application/json`)
+	if summary.Stale {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(summary)
+}
+
+// httpAPIOrphans runs the detection and lists the orphans that it finds,
+// with the chains of resources that would be deleted, their ages and the
+// reasons they were classified as orphans. Nothing is scheduled for
+// deletion
+func httpAPIOrphans(w http.ResponseWriter, r *http.Request, email string) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+
+	orphans, err := app.PreviewOrphans(ctx)
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, app.DescribeOrphans(scopeOrphans(app, r, email, RoleViewer, orphans)))
+}
+
+// httpAPIExplain tells whether a run would delete the load balancer of
+// the given forwarding rule, walking through the checks that it makes
+func httpAPIExplain(w http.ResponseWriter, r *http.Request, email string) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	name := r.FormValue(`forwarding_rule`)
+	if len(name) == 0 {
+		http.Error(w, `forwarding_rule is required`, http.StatusBadRequest)
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+
+	ex := app.Explain(ctx, name, r.FormValue(`region`))
+	if teams, all := TeamsFor(adminRoles, email, RoleViewer); !all {
+		allowed := teamScope(adminRoles, app.Config(), email, RoleViewer)
+		if ex.owner == nil || !allowed(ex.owner) {
+			infof(ctx, `%s may not explain %s (teams = %s)`, email, name, strings.Join(teams, `, `))
+			http.Error(w, `forbidden`, http.StatusForbidden)
+			return
+		}
+	}
+	writeJSON(w, ex)
+}
+
+// httpAPIGraph returns the resources of the load balancers and the
+// references between them, as JSON or as a Graphviz DOT digraph
+func httpAPIGraph(w http.ResponseWriter, r *http.Request, email string) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	format := r.FormValue(`format`)
+	if len(format) == 0 {
+		format = GraphFormatJSON
+	}
+	if _, err := ParseGraphFormat(format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusInternalServerError)
+		return
+	}
+
+	c := app.Config()
+	inScope := teamScope(adminRoles, c, email, RoleViewer)
+	team := r.FormValue(`team`)
+	allowed := func(o *Orphan) bool {
+		return inScope(o) && (len(team) == 0 || c.TeamOf(o) == team)
+	}
+	g, err := app.ResourceGraph(ctx, allowed)
+	if err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := WriteGraph(&buf, g, format); err != nil {
+		http.Error(w, RedactError(err), http.StatusInternalServerError)
+		return
+	}
+
+	if format == GraphFormatDOT {
+		w.Header().Set(`Content-Type`, `text/vnd.graphviz`)
+	} else {
+		w.Header().Set(`Content-Type`, `application/json`)
+	}
+	buf.WriteTo(w)
+}
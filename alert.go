@@ -0,0 +1,84 @@
+package autolbclean
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// AlertMetricOrphans is the number of orphan candidates found in a run
+	AlertMetricOrphans = `orphans`
+	// AlertMetricNewOrphans is the number of orphan candidates found in
+	// a run that had not been seen in any of the previous runs
+	AlertMetricNewOrphans = `new_orphans`
+	// AlertMetricPendingDays is the number of days the oldest orphan
+	// candidate has been waiting to be cleaned up
+	AlertMetricPendingDays = `pending_days`
+)
+
+// ParseAlertRules parses a comma separated list of alert rules, such as
+// "new_orphans>10,pending_days>3"
+func ParseAlertRules(s string) ([]*AlertRule, error) {
+	var rules []*AlertRule
+	for _, spec := range strings.Split(s, `,`) {
+		spec = strings.TrimSpace(spec)
+		if len(spec) == 0 {
+			continue
+		}
+
+		i := strings.IndexByte(spec, '>')
+		if i <= 0 {
+			return nil, errors.Errorf(`invalid alert rule %s: expected <metric>> <threshold>`, spec)
+		}
+
+		metric := strings.TrimSpace(spec[:i])
+		switch metric {
+		case AlertMetricOrphans, AlertMetricNewOrphans, AlertMetricPendingDays:
+		default:
+			return nil, errors.Errorf(`invalid alert rule %s: unknown metric %s`, spec, metric)
+		}
+
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(spec[i+1:]), 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, `invalid alert rule %s: failed to parse threshold`, spec)
+		}
+
+		rules = append(rules, &AlertRule{
+			Metric:    metric,
+			Threshold: threshold,
+		})
+	}
+	return rules, nil
+}
+
+func (r *AlertRule) String() string {
+	return fmt.Sprintf(`%s > %s`, r.Metric, strconv.FormatFloat(r.Threshold, 'f', -1, 64))
+}
+
+// Value returns the value of the metric that this rule watches
+func (r *AlertRule) Value(stats *RunStats) float64 {
+	switch r.Metric {
+	case AlertMetricOrphans:
+		return float64(stats.Orphans)
+	case AlertMetricNewOrphans:
+		return float64(stats.NewOrphans)
+	case AlertMetricPendingDays:
+		return stats.MaxPendingDays
+	}
+	return 0
+}
+
+// EvaluateAlertRules returns a description for each of the rules
+// that were violated in the given run
+func EvaluateAlertRules(rules []*AlertRule, stats *RunStats) []string {
+	var violations []string
+	for _, rule := range rules {
+		if v := rule.Value(stats); v > rule.Threshold {
+			violations = append(violations, fmt.Sprintf(`%s (actual: %s)`, rule, strconv.FormatFloat(v, 'f', 1, 64)))
+		}
+	}
+	return violations
+}
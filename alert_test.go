@@ -0,0 +1,49 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertRules(t *testing.T) {
+	t.Run("Parse", func(t *testing.T) {
+		rules, err := autolbclean.ParseAlertRules(`new_orphans>10, pending_days > 3`)
+		if !assert.NoError(t, err, `ParseAlertRules should succeed`) {
+			return
+		}
+		if !assert.Len(t, rules, 2, `there should be 2 rules`) {
+			return
+		}
+		if !assert.Equal(t, autolbclean.AlertMetricNewOrphans, rules[0].Metric, `metric should match`) {
+			return
+		}
+		if !assert.Equal(t, float64(3), rules[1].Threshold, `threshold should match`) {
+			return
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		for _, spec := range []string{`foo>1`, `orphans`, `orphans>abc`} {
+			_, err := autolbclean.ParseAlertRules(spec)
+			if !assert.Error(t, err, `ParseAlertRules should fail for %s`, spec) {
+				return
+			}
+		}
+	})
+	t.Run("Evaluate", func(t *testing.T) {
+		rules, err := autolbclean.ParseAlertRules(`new_orphans>10,pending_days>3`)
+		if !assert.NoError(t, err, `ParseAlertRules should succeed`) {
+			return
+		}
+
+		violations := autolbclean.EvaluateAlertRules(rules, &autolbclean.RunStats{
+			Orphans:        12,
+			NewOrphans:     11,
+			MaxPendingDays: 1.5,
+		})
+		if !assert.Len(t, violations, 1, `there should be 1 violation`) {
+			return
+		}
+	})
+}
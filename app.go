@@ -2,512 +2,1796 @@ package autolbclean
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"net/http"
-	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	cloudtasks "cloud.google.com/go/cloudtasks/apiv2"
 	"github.com/pkg/errors"
 	"golang.org/x/oauth2/google"
 	compute "google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
+	"google.golang.org/api/idtoken"
 	"google.golang.org/appengine"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/taskqueue"
+	"google.golang.org/appengine/urlfetch"
 )
 
 var muApp sync.Mutex
 var app *App
 
+// appengineStore persists the run status, the orphan candidates and
+// the admin state of all projects
+var appengineStore Store = datastoreStore{}
+
+var muTasksClient sync.Mutex
+var tasksClient *cloudtasks.Client
+
+var muQueueVerified sync.Mutex
+var queueVerified bool
+
+// AppengineApp returns the app for the default project, which is the
+// first of PROJECTS, or the project that the app is deployed in
 func AppengineApp(ctx context.Context) (*App, error) {
+	return appengineProjectApp(ctx, defaultProject(ctx))
+}
+
+// defaultProject returns the project that jobs without a project
+// parameter are for
+func defaultProject(ctx context.Context) string {
+	if len(projects) > 0 {
+		return projects[0]
+	}
+	id := appengine.AppID(ctx)
+	if i := strings.Index(id, `:`); i > 0 {
+		id = id[i:]
+	}
+	return id
+}
+
+// configuredProjects returns the projects that are cleaned up by this
+// deployment
+func configuredProjects(ctx context.Context) []string {
+	if len(projects) > 0 {
+		return projects
+	}
+	return []string{defaultProject(ctx)}
+}
+
+// requestApp returns the app for the project given in the project
+// parameter of the job or admin request, or for the default project if
+// there is none, along with a context whose log entries carry the id
+// of the run. Projects that are not configured are refused, so that
+// a stray task can not make us operate on some other project
+func requestApp(ctx context.Context, r *http.Request) (context.Context, *App, error) {
+	project := r.FormValue(`project`)
+	if len(project) == 0 {
+		project = defaultProject(ctx)
+	} else if !HasProject(configuredProjects(ctx), project) {
+		warningf(ctx, `Refusing request for project %s, which is not configured`, project)
+		return ctx, nil, errors.Errorf(`project %s is not configured`, project)
+	}
+
+	a, err := appengineProjectApp(ctx, project)
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	// jobs carry the id of the run that scheduled them, anything else
+	// starts a new run
+	if id := r.FormValue(`run`); len(id) > 0 {
+		a.runID = id
+	}
+	return withRunID(ctx, a.runID), a, nil
+}
+
+func appengineProjectApp(ctx context.Context, project string) (*App, error) {
+	logEnvErrors(ctx)
+
 	muApp.Lock()
 	defer muApp.Unlock()
-	if app != nil {
+	if app != nil && app.project == project {
 		return app, nil
 	}
 
-	cl, err := google.DefaultClient(ctx, compute.ComputeScope)
-	if err != nil {
-		return nil, errors.Wrap(err, `failed to create google default client`)
-	}
-	id := appengine.AppID(ctx)
-	if i := strings.Index(id, `:`); i > 0 {
-		id = id[i:]
+	// cloud-platform scope is required to probe IAM permissions
+	cl, err := google.DefaultClient(ctx, compute.ComputeScope, compute.CloudPlatformScope)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create google default client`)
+	}
+	tasks, err := taskEnqueuer(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create task enqueuer`)
+	}
+
+	auditStore := datastoreAuditStore{}
+	if len(projects) > 0 {
+		auditStore.project = project
+	}
+
+	options := []Option{
+		WithTaskEnqueuer(tasks),
+		WithGetTimeout(getTimeout),
+		WithListTimeout(listTimeout),
+		WithDiscoveryTimeout(discoveryTimeout),
+		WithTagIndexStore(memcacheTagIndexStore{project: project}, tagIndexTTL),
+		WithAuditStore(auditStore),
+		WithStore(appengineStore),
+		WithInventoryStore(datastoreInventoryStore{}),
+		WithQuotaProject(quotaProject),
+		WithRequestReason(requestReason),
+		WithTeamNotifier(func(url string) Notifier { return urlfetchSlackNotifier(url) }),
+		WithRunMetrics(runMetrics),
+		WithTransport(&urlfetch.Transport{Context: ctx}),
+	}
+	if len(taskSigningKey) > 0 {
+		options = append(options, WithTaskSigningKey(taskSigningKey))
+	}
+	if len(terraformWebhook) > 0 {
+		options = append(options, WithTerraformHandoff(urlfetchHandoff(terraformWebhook)))
+	}
+	if sa, ok := impersonation[project]; ok {
+		options = append(options, WithImpersonation(sa))
+	}
+	if sa, ok := executorImpersonation[project]; ok {
+		options = append(options, WithExecutorImpersonation(sa))
+	}
+	if len(eventTopic) > 0 {
+		p, err := NewPubSubPublisher(cl, eventTopic)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to create event publisher`)
+		}
+		options = append(options, WithEventPublisher(p))
+	}
+	if len(auditTable) > 0 {
+		p, err := NewBigQueryPublisher(ctx, cl, auditTable)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to create audit table publisher`)
+		}
+		options = append(options, WithEventPublisher(p))
+	}
+
+	a, err := New(project, cl, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create app`)
+	}
+	a.AddNotifier(NotifierFunc(logNotify))
+	if len(slackWebhook) > 0 {
+		a.AddNotifier(urlfetchSlackNotifier(slackWebhook))
+	}
+
+	// The configuration is re-read for every request, so changes take
+	// effect without having to redeploy
+	if len(configURL) > 0 {
+		if err := a.ReloadConfig(ctx, configURL); err != nil {
+			return nil, errors.Wrap(err, `failed to load configuration`)
+		}
+	}
+
+	if ageThreshold > 0 || len(ageThresholds) > 0 {
+		a.SetConfig(a.Config().WithAgeThresholds(ageThreshold, ageThresholds))
+	}
+
+	// changes made through the admin API take precedence
+	if err := a.ApplyAdminState(ctx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// taskEnqueuer creates the enqueuer for the backend selected through
+// TASK_BACKEND
+func taskEnqueuer(ctx context.Context) (TaskEnqueuer, error) {
+	if taskBackend != TaskBackendCloudTasks {
+		return taskqueueEnqueuer{queue: queueName}, nil
+	}
+
+	// the client holds on to a connection pool, so it is shared
+	// between requests, and must not be tied to the request that
+	// happened to create it
+	muTasksClient.Lock()
+	defer muTasksClient.Unlock()
+	if tasksClient == nil {
+		client, err := cloudtasks.NewClient(context.Background())
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to create cloud tasks client`)
+		}
+		tasksClient = client
+	}
+	return NewCloudTasksEnqueuer(tasksClient, cloudTasksQueue, cloudTasksTargetURL, cloudTasksServiceAccount), nil
+}
+
+// urlfetchHandoff posts work items to the webhook at the given URL,
+// using the urlfetch client of the request being handled, as the App
+// outlives the request it was created for
+type urlfetchHandoff string
+
+func (h urlfetchHandoff) HandOff(ctx context.Context, sr *StateRemoval) error {
+	return NewWebhookHandoff(urlfetch.Client(ctx), string(h)).HandOff(ctx, sr)
+}
+
+// urlfetchSlackNotifier posts notifications to the Slack webhook at
+// the given URL, using the urlfetch client of the request being handled
+type urlfetchSlackNotifier string
+
+func (n urlfetchSlackNotifier) Notify(ctx context.Context, msg *Notification) error {
+	return NewSlackNotifier(urlfetch.Client(ctx), string(n)).Notify(ctx, msg)
+}
+
+// requireSignedTask rejects the requests to a job that were not
+// enqueued by the app itself. Jobs that delete resources must not act on
+// a name that anyone could post, so without TASK_SIGNING_KEY only the
+// requests that App Engine delivered from a queue are accepted, and
+// nothing is accepted when tasks go to an HTTP target. Tasks delivered
+// to an HTTP target must also carry the identity token that Cloud Tasks
+// adds for CLOUD_TASKS_SERVICE_ACCOUNT
+func requireSignedTask(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if len(cloudTasksTargetURL) > 0 {
+			err = taskIdentity(r)
+		}
+		switch {
+		case err != nil:
+		case len(taskSigningKey) > 0:
+			err = VerifyTaskRequest(taskSigningKey, r)
+		case len(cloudTasksTargetURL) > 0:
+			// HTTP targets can be reached from anywhere, and nothing
+			// but the signature tells our own tasks apart
+			err = errors.New(`TASK_SIGNING_KEY is required when CLOUD_TASKS_TARGET_URL is set`)
+		case len(r.Header.Get(`X-AppEngine-QueueName`)) == 0:
+			// App Engine strips this header from requests that come
+			// from outside, so only a queue can have set it
+			err = errors.New(`request was not delivered by a task queue`)
+		}
+		if err != nil {
+			warningf(appengine.NewContext(r), `Rejected request to %s: %s`, r.URL.Path, err)
+			http.Error(w, `forbidden`, http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// fanOut makes a check job that was started without a project
+// parameter, as cron does, enqueue itself once for each of the
+// configured projects. With a single project, the job just runs
+func fanOut(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(projects) < 2 || len(r.FormValue(`project`)) > 0 {
+			h(w, r)
+			return
+		}
+
+		ctx := appengine.NewContext(r)
+		app, err := AppengineApp(ctx)
+		if err != nil {
+			http.Error(w, `failed to get app`, http.StatusOK)
+			return
+		}
+
+		var failed int
+		for _, project := range projects {
+			params := r.URL.Query()
+			params.Set(`project`, project)
+			if err := app.Enqueue(ctx, &Task{Path: r.URL.Path, Params: params}); err != nil {
+				warningf(ctx, "Failed to schedule %s for project %s: %s", r.URL.Path, project, err)
+				telemetry.RecordError(err)
+				failed++
+			}
+		}
+		writeScheduleResult(w, failed)
+	}
+}
+
+// logNotify is the default notification sink, which just writes
+// the notification to the application log
+func logNotify(ctx context.Context, n *Notification) error {
+	warningf(ctx, "[%s] %s: %s", n.Project, n.Subject, n.Body)
+	return nil
+}
+
+// how long the operation of a deletion is polled for, and how deletions
+// of resources that were still in use are retried
+const operationPollTimeout = 15 * time.Minute
+const resourceInUseDelay = time.Minute
+const maxResourceInUseRequeues = 5
+
+var queueName = `default`
+var taskBackend = TaskBackendTaskqueue
+var cloudTasksQueue string
+var cloudTasksTargetURL string
+var cloudTasksServiceAccount string
+var configURL string
+var alertRules []*AlertRule
+var probePermissions bool
+var runMetrics bool
+var getTimeout = DefaultGetTimeout
+var listTimeout = DefaultListTimeout
+var discoveryTimeout = DefaultDiscoveryTimeout
+var tagIndexTTL = DefaultTagIndexTTL
+var managedCertificateThreshold = DefaultManagedCertificateThreshold
+var orphanedCertificateThreshold = DefaultOrphanedCertificateThreshold
+var quotaPressureThreshold = DefaultQuotaPressureThreshold
+var deletionBudget int
+var permissionDeniedRetries int
+var telemetryEndpoint string
+var telemetry *Telemetry // nil unless TELEMETRY_ENDPOINT is set
+var firewallDisableGrace time.Duration
+var ageThreshold time.Duration
+var decisionSampling DecisionSampling // nil logs every decision
+var ageThresholds map[string]time.Duration
+var adminRoles []*RoleBinding
+var dryRun bool
+var quotaProject string
+var requestReason string
+var billingExportTable string
+var adminAudience string
+var pushAudience string // cluster notifications are refused unless PUSH_AUDIENCE is set
+var pushServiceAccount string
+var terraformWebhook string
+var slackWebhook string
+var taskSigningKey []byte // delete jobs are not signed unless TASK_SIGNING_KEY is set
+var eventTopic string
+var auditTable string
+var projects []string // empty unless PROJECTS or PROJECTS_FILE is set
+var impersonation map[string]string
+var executorImpersonation map[string]string
+
+// envErrors describes the environment variables that could not be
+// parsed, and were ignored. There is no request to log them with when
+// they are parsed, so they are logged with the first one
+var envErrors []string
+var onceEnvErrors sync.Once
+
+func ignoreEnv(name string, err error) {
+	envErrors = append(envErrors, fmt.Sprintf(`Ignoring invalid %s: %s`, name, err))
+}
+
+func logEnvErrors(ctx context.Context) {
+	onceEnvErrors.Do(func() {
+		for _, msg := range envErrors {
+			warningf(ctx, "%s", msg)
+		}
+	})
+}
+
+func init() {
+	if v := os.Getenv(`QUEUE_NAME`); len(v) > 0 {
+		queueName = v
+	}
+
+	if v, err := ParseTaskBackend(os.Getenv(`TASK_BACKEND`)); err == nil {
+		taskBackend = v
+	} else {
+		ignoreEnv(`TASK_BACKEND`, err)
+	}
+	cloudTasksQueue = os.Getenv(`CLOUD_TASKS_QUEUE`)
+	cloudTasksTargetURL = os.Getenv(`CLOUD_TASKS_TARGET_URL`)
+	cloudTasksServiceAccount = os.Getenv(`CLOUD_TASKS_SERVICE_ACCOUNT`)
+	if taskBackend == TaskBackendCloudTasks && len(cloudTasksQueue) == 0 {
+		ignoreEnv(`TASK_BACKEND`, errors.New(`CLOUD_TASKS_QUEUE is required when TASK_BACKEND is cloudtasks`))
+		taskBackend = TaskBackendTaskqueue
+	}
+
+	configURL = os.Getenv(`CONFIG_URL`)
+
+	if v := os.Getenv(`ALERT_RULES`); len(v) > 0 {
+		if rules, err := ParseAlertRules(v); err == nil {
+			alertRules = rules
+		} else {
+			ignoreEnv(`ALERT_RULES`, err)
+		}
+	}
+
+	if v, err := strconv.ParseBool(os.Getenv(`PROBE_PERMISSIONS`)); err == nil {
+		probePermissions = v
+	}
+
+	if v, err := strconv.ParseBool(os.Getenv(`MONITORING_METRICS`)); err == nil {
+		runMetrics = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv(`GET_TIMEOUT`)); err == nil {
+		getTimeout = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv(`LIST_TIMEOUT`)); err == nil {
+		listTimeout = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv(`DISCOVERY_TIMEOUT`)); err == nil {
+		discoveryTimeout = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv(`TAG_INDEX_TTL`)); err == nil {
+		tagIndexTTL = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv(`MANAGED_CERTIFICATE_THRESHOLD`)); err == nil {
+		managedCertificateThreshold = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv(`ORPHANED_CERTIFICATE_THRESHOLD`)); err == nil {
+		orphanedCertificateThreshold = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv(`AGE_THRESHOLD`)); err == nil {
+		ageThreshold = v
+	}
+
+	if v := os.Getenv(`AGE_THRESHOLDS`); len(v) > 0 {
+		if m, err := ParseAgeThresholds(v); err == nil {
+			ageThresholds = m
+		} else {
+			ignoreEnv(`AGE_THRESHOLDS`, err)
+		}
+	}
+
+	if v := os.Getenv(`DECISION_LOG_SAMPLING`); len(v) > 0 {
+		if sampling, err := ParseDecisionSampling(v); err == nil {
+			decisionSampling = sampling
+		} else {
+			ignoreEnv(`DECISION_LOG_SAMPLING`, err)
+		}
+	}
+
+	if v, err := ParseLogFormat(os.Getenv(`LOG_FORMAT`)); err == nil {
+		if v == LogFormatAppEngine {
+			SetLogger(NewAppEngineLogger())
+		}
+	} else {
+		ignoreEnv(`LOG_FORMAT`, err)
+	}
+
+	if v, err := strconv.ParseFloat(os.Getenv(`QUOTA_PRESSURE_THRESHOLD`), 64); err == nil {
+		quotaPressureThreshold = v
+	}
+
+	if v, err := strconv.Atoi(os.Getenv(`DELETION_BUDGET`)); err == nil {
+		deletionBudget = v
+	}
+
+	if v := os.Getenv(`TELEMETRY_ENDPOINT`); len(v) > 0 {
+		telemetryEndpoint = v
+		telemetry = NewTelemetry(`appengine`)
+	}
+
+	if v, err := strconv.Atoi(os.Getenv(`PERMISSION_DENIED_RETRIES`)); err == nil && v >= 0 {
+		permissionDeniedRetries = v
+	}
+
+	if v, err := ParseSnoozeDuration(os.Getenv(`FIREWALL_DISABLE_GRACE`)); err == nil {
+		firewallDisableGrace = v
+	}
+
+	// without bindings, nobody is granted any role
+	if v := os.Getenv(`ADMIN_ROLES`); len(v) > 0 {
+		if bindings, err := ParseRoleBindings(v); err == nil {
+			adminRoles = bindings
+		} else {
+			ignoreEnv(`ADMIN_ROLES`, err)
+		}
+	}
+
+	adminAudience = os.Getenv(`ADMIN_AUDIENCE`)
+	pushAudience = os.Getenv(`PUSH_AUDIENCE`)
+	pushServiceAccount = os.Getenv(`PUSH_SERVICE_ACCOUNT`)
+
+	terraformWebhook = os.Getenv(`TERRAFORM_WEBHOOK`)
+	slackWebhook = os.Getenv(`SLACK_WEBHOOK_URL`)
+	taskSigningKey = []byte(os.Getenv(`TASK_SIGNING_KEY`))
+	eventTopic = os.Getenv(`EVENT_TOPIC`)
+	auditTable = os.Getenv(`AUDIT_TABLE`)
+
+	quotaProject = os.Getenv(`QUOTA_PROJECT`)
+	requestReason = os.Getenv(`REQUEST_REASON`)
+
+	if v := os.Getenv(`BILLING_EXPORT_TABLE`); len(v) > 0 {
+		if err := ValidateBillingTable(v); err == nil {
+			billingExportTable = v
+		} else {
+			ignoreEnv(`BILLING_EXPORT_TABLE`, err)
+		}
+	}
+
+	if v, err := strconv.ParseBool(os.Getenv(`DRY_RUN`)); err == nil {
+		dryRun = v
+	}
+
+	projects = ParseProjects(os.Getenv(`PROJECTS`))
+	// without the file, only the project of the app is cleaned up
+	if v := os.Getenv(`PROJECTS_FILE`); len(v) > 0 && len(projects) == 0 {
+		buf, err := ioutil.ReadFile(v)
+		if err == nil {
+			projects, err = ParseProjectsFile(buf)
+		}
+		if err != nil {
+			ignoreEnv(`PROJECTS_FILE`, err)
+		}
+	}
+
+	if v := os.Getenv(`IMPERSONATE`); len(v) > 0 {
+		if m, err := ParseImpersonation(v); err == nil {
+			impersonation = m
+		} else {
+			ignoreEnv(`IMPERSONATE`, err)
+		}
+	}
+
+	if v := os.Getenv(`EXECUTOR_IMPERSONATE`); len(v) > 0 {
+		if m, err := ParseImpersonation(v); err == nil {
+			executorImpersonation = m
+		} else {
+			ignoreEnv(`EXECUTOR_IMPERSONATE`, err)
+		}
+	}
+
+	// fails until the task queue is known to be usable
+	http.HandleFunc(`/_ah/warmup`, httpReadiness)
+	http.HandleFunc(`/readyz`, httpReadiness)
+	http.HandleFunc(`/badge.svg`, httpBadge)
+	// the latest run and the configuration in effect, for operators
+	http.HandleFunc(`/status`, requireRole(RoleViewer, httpStatus))
+
+	// list all forwarding rules, and start "check" jobs
+	http.HandleFunc(`/job/forwarding-rules/check`, fanOut(httpForwardingRulesCheck))
+
+	// checks for dangling firewall rules
+	http.HandleFunc(`/job/firewall-rules/check`, fanOut(httpFirewallsCheck))
+
+	http.HandleFunc(`/job/forwarding-rules/delete`, requireSignedTask(httpForwardingRulesDelete))
+	// checks for url maps that are no longer used by any target proxy
+	http.HandleFunc(`/job/url-maps/check`, fanOut(checkJob(KindUrlMaps)))
+	http.HandleFunc(`/job/url-maps/delete`, requireSignedTask(httpUrlMapsDelete))
+	// checks for certificates that are not attached to any target proxy
+	http.HandleFunc(`/job/ssl-certificates/check`, fanOut(checkJob(KindSslCertificates)))
+	// checks for google-managed certificates that never got provisioned
+	http.HandleFunc(`/job/ssl-certificates/managed-check`, fanOut(httpManagedCertificatesCheck))
+
+	http.HandleFunc(`/job/ssl-certificates/delete`, requireSignedTask(httpSslCertificatesDelete))
+	// checks for backend services that are no longer referenced by any
+	// url map
+	http.HandleFunc(`/job/backend-services/check`, fanOut(checkJob(KindBackendServices)))
+	http.HandleFunc(`/job/backend-services/delete`, requireSignedTask(httpBackendServicesDelete))
+	// checks for empty instance groups of GKE ingress that are no longer
+	// used by any backend service
+	http.HandleFunc(`/job/instance-groups/check`, fanOut(checkJob(KindInstanceGroups)))
+	http.HandleFunc(`/job/instance-groups/delete`, requireSignedTask(httpInstanceGroupsDelete))
+	// checks for static IP addresses of load balancers that are
+	// reserved but no longer used
+	http.HandleFunc(`/job/addresses/check`, fanOut(checkJob(KindAddresses)))
+	http.HandleFunc(`/job/addresses/delete`, requireSignedTask(httpAddressesDelete))
+	http.HandleFunc(`/job/target-pools/check`, fanOut(httpTargetPoolCheck))
+	http.HandleFunc(`/job/target-pools/delete`, requireSignedTask(httpTargetPoolsDelete))
+	http.HandleFunc(`/job/target-http-proxies/delete`, requireSignedTask(httpTargetProxiesDelete))
+	// checks for global and regional health checks that are no longer
+	// referenced by any backend service
+	http.HandleFunc(`/job/health-checks/check`, fanOut(checkJob(KindHealthChecks)))
+	http.HandleFunc(`/job/health-checks/delete`, requireSignedTask(httpHealthChecksDelete))
+
+	// polls the operations started by the delete jobs
+	http.HandleFunc(`/job/operations/poll`, requireSignedTask(httpOperationsPoll))
+
+	// generic jobs for any kind of resource that has a registered
+	// Cleaner, selected by the type parameter
+	http.HandleFunc(`/job/resources/check`, fanOut(httpResourcesCheck))
+	http.HandleFunc(`/job/resources/delete`, requireSignedTask(httpResourcesDelete))
+
+	// summarizes the deletions of the previous month
+	http.HandleFunc(`/job/digest/monthly`, fanOut(httpMonthlyDigest))
+	// removes the records that the cleaner keeps about itself once they
+	// are older than their retention
+	http.HandleFunc(`/job/state/gc`, httpStateGC)
+
+	// receives GKE cluster notifications from a Pub/Sub push
+	// subscription
+	http.HandleFunc(`/push/cluster-notifications`, httpClusterNotifications)
+
+	// admin API, for humans
+	http.HandleFunc(`/admin/candidates`, requireTeamRole(RoleViewer, httpAdminCandidates))
+	http.HandleFunc(`/admin/report`, requireTeamRole(RoleViewer, httpAdminReport))
+	http.HandleFunc(`/admin/history`, requireRole(RoleViewer, httpAdminHistory))
+	http.HandleFunc(`/admin/audit`, requireTeamRole(RoleViewer, httpAdminAudit))
+	http.HandleFunc(`/admin/apply`, requireTeamRole(RoleOperator, httpAdminApply))
+	http.HandleFunc(`/admin/suppress`, requireRole(RoleOperator, httpAdminSuppress))
+	http.HandleFunc(`/admin/snooze`, requireRole(RoleOperator, httpAdminSnooze))
+	http.HandleFunc(`/admin/suppressions/export`, requireRole(RoleViewer, httpAdminExportSuppressions))
+	http.HandleFunc(`/admin/suppressions/import`, requireRole(RoleOperator, httpAdminImportSuppressions))
+	http.HandleFunc(`/admin/pause`, requireRole(RoleAdmin, httpAdminPause))
+	http.HandleFunc(`/admin/inventory/reset`, requireRole(RoleAdmin, httpAdminResetInventory))
+	http.HandleFunc(`/admin/config`, requireRole(RoleAdmin, httpAdminConfig))
+
+	// read-only API for dashboards
+	http.HandleFunc(`/api/orphans`, requireTeamRole(RoleViewer, httpAPIOrphans))
+	http.HandleFunc(`/api/explain`, requireTeamRole(RoleViewer, httpAPIExplain))
+	http.HandleFunc(`/api/graph`, requireTeamRole(RoleViewer, httpAPIGraph))
+}
+
+// verifyTaskQueue checks the task queue once per instance. A failed
+// check is repeated on the next call, so that fixing the queue does not
+// require a restart
+func verifyTaskQueue(ctx context.Context, app *App) error {
+	muQueueVerified.Lock()
+	defer muQueueVerified.Unlock()
+	if queueVerified {
+		return nil
+	}
+
+	// jobs are retried on transient errors, and on permission errors
+	// up to PERMISSION_DENIED_RETRIES times
+	minAttempts := permissionDeniedRetries + 1
+	if minAttempts < 2 {
+		minAttempts = 2
+	}
+	if err := app.VerifyTaskQueue(ctx, minAttempts); err != nil {
+		return err
+	}
+	queueVerified = true
+	return nil
+}
+
+func httpReadiness(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	app, err := AppengineApp(ctx)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := verifyTaskQueue(ctx, app); err != nil {
+		warningf(ctx, `Task queue is not usable, check QUEUE_NAME or CLOUD_TASKS_QUEUE: %s`, err)
+		http.Error(w, `task queue is not usable: `+RedactError(err), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpBadge renders a status badge showing how long ago the last check
+// ran, and how many orphans it found. It only exposes these numbers, and
+// is left unauthenticated so that it can be embedded in dashboards
+func httpBadge(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusServiceUnavailable)
+		return
+	}
+
+	status, err := app.store.LoadRunStatus(ctx, app.project)
+	if err != nil {
+		debugf(ctx, "Failed to load run status: %s", err)
+		http.Error(w, `failed to load run status`, http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set(`Content-Type`, `image/svg+xml`)
+	// image proxies in front of dashboards cache aggressively otherwise
+	w.Header().Set(`Cache-Control`, `no-cache, max-age=0`)
+	w.Write(RenderBadge(status, time.Now().UTC()))
+}
+
+func handleJobError(w http.ResponseWriter, r *http.Request, e error) {
+	ge, ok := e.(*googleapi.Error)
+	if !ok || ge.Code != http.StatusNotFound {
+		http.Error(w, RedactError(e), http.StatusInternalServerError)
+		return
+	}
+
+	// if the google api return 404, then there's nothing more we can
+	// do for this job. we should just return a 2XX status and prevent
+	// the taskqueue from retrying
+	ctx := appengine.NewContext(r)
+	debugf(ctx, "Resource was not found, signaling end of this job: %s", e)
+	http.Error(w, `abort job`, http.StatusNoContent)
+}
+
+func httpForwardingRulesCheck(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusOK)
+		return
+	}
+
+	report := &Report{
+		Project:   app.project,
+		StartedAt: time.Now().UTC(),
+	}
+
+	orphans, err := app.FindOrphans(ctx)
+	if err != nil {
+		if IsInventoryDropError(err) {
+			warningf(ctx, "Skipping this run: %s", err)
+			http.Error(w, RedactError(err), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, `failed to list ingress resources`, http.StatusOK)
+		return
+	}
+
+	debugf(ctx, "Found %d orphaned load balancers", len(orphans))
+
+	if quotas, err := app.ListQuotas(ctx); err == nil {
+		report.Quotas = quotas
+	} else {
+		debugf(ctx, "Failed to list quotas: %s", err)
+	}
+
+	// Load balancers that free up resources whose quota is about to run
+	// out go first, and are not subject to the deletion budget
+	pressured := PressuredKinds(report.Quotas, quotaPressureThreshold)
+	eligible, reportOnly := app.Config().splitReportOnly(orphans)
+	scheduled, deferred := PrioritizeOrphans(eligible, pressured, deletionBudget)
+	var failed int
+	if held := app.Config().DeletionsHeld(time.Now()); len(held) > 0 {
+		infof(ctx, "Not scheduling deletion of %d orphaned load balancers: %s", len(scheduled), held)
+		for _, o := range scheduled {
+			report.SkipOrphan(o, held)
+		}
+	} else {
+		for _, o := range scheduled {
+			failed += scheduleOrphanDeletion(ctx, app, report, o, isDryRun(r))
+		}
+	}
+	for _, o := range deferred {
+		decisionf(ctx, DecisionSkipped, ``, o.TargetProxy, "Deletion budget exhausted, deferring %s to the next run", o.TargetProxy)
+		report.SkipOrphan(o, `deletion budget exhausted, deferred to the next run`)
+	}
+	for _, o := range reportOnly {
+		report.SkipOrphan(o, app.Config().reportOnlyReason(o))
+	}
+	report.Orphans = orphans
+	report.Deferred = deferred
+
+	// scheduled resources were published as they were enqueued
+	for _, s := range report.Skipped {
+		decisionf(ctx, DecisionSkipped, s.Kind, s.Name, "Skipping %s %s (region = %s): %s", s.Kind, s.Name, s.Region, s.Reason)
+		if err := app.PublishSkipped(ctx, s); err != nil {
+			debugf(ctx, "Failed to publish skipped event for %s %s: %s", s.Kind, s.Name, err)
+		}
+	}
+
+	checkAlertRules(ctx, app, report)
+
+	// what was recorded during the run is reported along with it, and
+	// not again with the next one
+	report.FinishedAt = time.Now().UTC()
+	if access, err := accessSinceLastReport(ctx, datastoreAuditStore{}, app.project, report.FinishedAt); err == nil {
+		report.Access = access
+	} else {
+		debugf(ctx, "Failed to list admin API access: %s", err)
+	}
+	if retries, err := retriesSinceLastReport(ctx, datastoreAuditStore{}, app.project, report.FinishedAt); err == nil {
+		report.Retries = retries
+	} else {
+		debugf(ctx, "Failed to list deletion attempts: %s", err)
+	}
+
+	infof(ctx, "%s", report)
+
+	// runs that found nothing, or the same orphans as the run before,
+	// are not worth a message every 10 minutes. when teams are
+	// configured, each of them is told about their own load balancers,
+	// while the usual sinks get the whole picture
+	orphanSet := report.OrphanSet()
+	if len(report.Orphans) > 0 && orphanSetChanged(ctx, app, orphanSet) {
+		summary := report.Summary()
+		if c := app.Config(); c.hasTeams() {
+			summary.Body += report.RollupByTeam(c)
+		}
+		if err := app.Notify(ctx, summary); err != nil {
+			debugf(ctx, "Failed to notify run summary: %s", err)
+		}
+		if err := app.NotifyTeams(ctx, report); err != nil {
+			debugf(ctx, "Failed to notify teams: %s", err)
+		}
+	}
+
+	err = app.store.SaveRunStatus(ctx, &RunStatus{
+		Project:    app.project,
+		FinishedAt: report.FinishedAt,
+		Orphans:    len(report.Orphans),
+		OrphanSet:  orphanSet,
+	})
+	if err != nil {
+		debugf(ctx, "Failed to save run status: %s", err)
+	}
+	err = app.SaveRun(ctx, &RunRecord{
+		StartedAt:  report.StartedAt,
+		FinishedAt: report.FinishedAt,
+		Orphans:    len(report.Orphans),
+		Scheduled:  len(report.Scheduled),
+		Skipped:    len(report.Skipped),
+	})
+	if err != nil {
+		debugf(ctx, "Failed to save run record: %s", err)
+	}
+
+	// the check only schedules deletions, so the resources that were
+	// deleted are the ones that the delete jobs recorded since the
+	// previous check
+	if app.runMetrics {
+		if deleted, err := deletionsSinceLastReport(ctx, datastoreAuditStore{}, app.project, report.FinishedAt); err == nil {
+			if err := app.WriteRunMetrics(ctx, DeletionRecordMetrics(len(report.Orphans), deleted)); err != nil {
+				debugf(ctx, "Failed to write run metrics: %s", err)
+			}
+		} else {
+			debugf(ctx, "Failed to list deletions: %s", err)
+		}
+	}
+
+	// counters are kept per instance, and sent along whenever the
+	// instance gets to run this job
+	if err := telemetry.Flush(ctx, urlfetch.Client(ctx), telemetryEndpoint); err != nil {
+		debugf(ctx, "Failed to send telemetry: %s", err)
+	}
+	writeScheduleResult(w, failed)
+}
+
+// checkAlertRules evaluates the configured alert rules against the
+// orphans found in this run, and notifies the sinks of any violations
+func checkAlertRules(ctx context.Context, app *App, report *Report) {
+	if len(alertRules) == 0 {
+		return
+	}
+
+	stats, err := trackOrphans(ctx, app.store, app.project, report.Orphans)
+	if err != nil {
+		debugf(ctx, "Failed to track orphans: %s", err)
+		return
+	}
+	report.Stats = stats
+
+	violations := EvaluateAlertRules(alertRules, stats)
+	if len(violations) == 0 {
+		return
+	}
+
+	err = app.Notify(ctx, &Notification{
+		Subject: `alert rules violated`,
+		Body:    strings.Join(violations, "\n"),
+	})
+	if err != nil {
+		debugf(ctx, "Failed to notify alerts: %s", err)
+	}
+}
+
+func httpTargetPoolCheck(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusOK)
+		return
+	}
+
+	pools, err := app.ListOrphanedTargetPools(ctx)
+	if err != nil {
+		debugf(ctx, `Failed to list orphaned target pools %s`, err)
+		handleJobError(w, r, err)
+		return
+	}
+
+	if held := app.Config().DeletionsHeld(time.Now()); len(held) > 0 {
+		infof(ctx, `Not scheduling deletion of %d orphaned target pools: %s`, len(pools), held)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var failed int
+	for _, tp := range pools {
+		decisionf(ctx, DecisionScheduled, KindTargetPools, tp.Name, `Scheduling deletion of target pool %s (region = %s, service = %s)`, tp.Name, tp.Region, tp.Service)
+		failed += scheduleChain(ctx, app, tp.Deletions())
+	}
+	writeScheduleResult(w, failed)
+}
+
+// orphanSetChanged returns true unless the latest run found the same
+// orphans. If the status of the latest run can not be loaded, the
+// orphans are assumed to have changed, so that nothing goes unnoticed
+func orphanSetChanged(ctx context.Context, app *App, orphanSet string) bool {
+	status, err := app.store.LoadRunStatus(ctx, app.project)
+	if err != nil {
+		debugf(ctx, "Failed to load run status: %s", err)
+		return true
+	}
+	return status == nil || status.OrphanSet != orphanSet
+}
+
+// scheduleOrphanDeletion enqueues the delete jobs for each of the
+// resources that make up the given orphaned load balancer, and returns
+// how many of them could not be enqueued. Load balancers managed by
+// terraform are handed off instead, unless this is a dry run
+func scheduleOrphanDeletion(ctx context.Context, app *App, report *Report, o *Orphan, dryRun bool) int {
+	managed, err := app.isTerraformManaged(ctx, o)
+	if err != nil {
+		warningf(ctx, "Failed to check whether %s is managed by terraform: %s", o.TargetProxy, err)
+		report.SkipOrphan(o, `failed to check whether it is managed by terraform`)
+		return 1
+	}
+	if managed {
+		if dryRun {
+			infof(ctx, "Dry run, not handing off %s to terraform", o.TargetProxy)
+			report.SkipOrphan(o, `managed by terraform, dry run`)
+			return 0
+		}
+		handedOff, err := app.HandOffToTerraform(ctx, o)
+		if err != nil {
+			warningf(ctx, "Failed to hand off %s to terraform: %s", o.TargetProxy, err)
+			report.SkipOrphan(o, `failed to hand off to terraform`)
+			return 1
+		}
+		if !handedOff {
+			debugf(ctx, "%s was already handed off to terraform", o.TargetProxy)
+			report.SkipOrphan(o, `managed by terraform, already handed off`)
+			return 0
+		}
+		infof(ctx, "Handed off %s to terraform", o.TargetProxy)
+		report.SkipOrphan(o, `managed by terraform, handed off`)
+		return 0
+	}
+
+	deletions := o.Deletions()
+	if app.Config().ConnectionDrainingAware {
+		delay, err := app.DrainDelay(ctx, o)
+		if err != nil {
+			// better late than cutting off live connections
+			debugf(ctx, "Failed to compute drain delay, assuming %s: %s", DefaultDrainDelay, err)
+			delay = DefaultDrainDelay
+		}
+		for _, d := range deletions {
+			switch d.Kind {
+			case KindBackendServices, KindHealthChecks, KindHttpHealthChecks, KindHttpsHealthChecks:
+				d.Delay = delay
+			}
+		}
+	}
+	failed := scheduleChain(ctx, app, deletions)
+
+	// the permission probe marks the deletions that were left out, and
+	// the chain is cut at the first of them
+	var denied *Deletion
+	for _, d := range deletions {
+		switch {
+		case d.Denied && denied == nil:
+			denied = d
+			report.Skip(d, `missing permission `+d.Permission())
+		case denied != nil:
+			report.Skip(d, fmt.Sprintf(`comes after %s %s, which may not be deleted`, denied.Kind, denied.Name))
+		case failed > 0:
+			report.Skip(d, `failed to schedule`)
+		default:
+			report.Scheduled = append(report.Scheduled, d)
+		}
+	}
+	return failed
+}
+
+// scheduleDeletions enqueues the delete jobs for the given deletions,
+// and returns how many of them could not be enqueued
+func scheduleDeletions(ctx context.Context, app *App, deletions []*Deletion) int {
+	var failed int
+	c := app.Config()
+	for _, d := range permittedDeletions(ctx, app, deletions) {
+		expires := c.deletionExpires(d.Kind, d.Delay)
+		if err := enqueueDeletion(ctx, app, d, expires); err != nil {
+			failed++
+			continue
+		}
+		decisionf(ctx, DecisionScheduled, d.Kind, d.Name, `Scheduling deletion of %s %s (region = %s, zone = %s)`, d.Kind, d.Name, d.Region, d.Zone)
+		publishEvent(ctx, app, d, DecisionScheduled, nil)
+	}
+	return failed
+}
+
+// scheduleChain enqueues the delete job for the first of the given
+// deletions, which enqueues the job for the next one once it succeeded,
+// and so on. This keeps resources from being deleted while they are
+// still referenced by the resources that come before them. It returns
+// how many deletions could not be enqueued
+func scheduleChain(ctx context.Context, app *App, deletions []*Deletion) int {
+	head := ChainDeletions(permittedChain(ctx, app, deletions))
+	if head == nil {
+		return 0
+	}
+
+	expires := app.Config().deletionExpires(head.Kind, head.Delay)
+	if err := enqueueDeletion(ctx, app, head, expires); err != nil {
+		return 1 + len(head.Next)
+	}
+	for d := head; d != nil; d = d.NextDeletion() {
+		decisionf(ctx, DecisionScheduled, d.Kind, d.Name, `Scheduling deletion of %s %s (region = %s, zone = %s)`, d.Kind, d.Name, d.Region, d.Zone)
+		publishEvent(ctx, app, d, DecisionScheduled, nil)
+	}
+	return 0
+}
+
+// continueChain enqueues the delete job for the deletion that comes
+// after d in its chain, if any. When this fails the rest of the chain
+// is left for the next check to find
+func continueChain(ctx context.Context, app *App, d *Deletion) {
+	next := d.NextDeletion()
+	if next == nil {
+		return
+	}
+
+	debugf(ctx, `Deletion of %s %s done, continuing with %s %s`, d.Kind, d.Name, next.Kind, next.Name)
+	expires := app.Config().deletionExpires(next.Kind, next.Delay)
+	enqueueDeletion(ctx, app, next, expires)
+}
+
+// readChain returns the rest of the deletion chain that the job is
+// part of. A chain that can not be parsed is dropped, leaving its
+// resources for the next check to find
+func readChain(ctx context.Context, r *http.Request) []*Deletion {
+	next, err := ParseDeletionChain(r.FormValue(`next`))
+	if err != nil {
+		warningf(ctx, `Dropping deletion chain: %s`, err)
+		return nil
+	}
+	return next
+}
+
+// permittedDeletions probes the permissions needed for the deletions
+// if PROBE_PERMISSIONS is set, and returns the deletions that are not
+// known to be denied
+func permittedDeletions(ctx context.Context, app *App, deletions []*Deletion) []*Deletion {
+	if probePermissions {
+		if err := app.ProbeDeletions(ctx, deletions); err != nil {
+			debugf(ctx, "Failed to probe permissions, proceeding without: %s", err)
+		}
+	}
+
+	var list []*Deletion
+	for _, d := range deletions {
+		if d.Denied {
+			warningf(ctx, "Not scheduling deletion of %s %s (region = %s): missing permission %s", d.Kind, d.Name, d.Region, d.Permission())
+			continue
+		}
+		list = append(list, d)
+	}
+	return list
+}
+
+// permittedChain probes the permissions needed for the deletions of a
+// chain, like permittedDeletions, and returns the links that come
+// before the first one that is known to be denied. The resources after
+// it are still referenced by the one that can not be deleted, so their
+// jobs would only be retried until they expire
+func permittedChain(ctx context.Context, app *App, deletions []*Deletion) []*Deletion {
+	if probePermissions {
+		if err := app.ProbeDeletions(ctx, deletions); err != nil {
+			debugf(ctx, "Failed to probe permissions, proceeding without: %s", err)
+		}
+	}
+
+	for i, d := range deletions {
+		if !d.Denied {
+			continue
+		}
+		warningf(ctx, "Not scheduling deletion of %s %s (region = %s): missing permission %s", d.Kind, d.Name, d.Region, d.Permission())
+		for _, rest := range deletions[i+1:] {
+			warningf(ctx, "Not scheduling deletion of %s %s (region = %s): it comes after %s %s, which may not be deleted", rest.Kind, rest.Name, rest.Region, d.Kind, d.Name)
+		}
+		return deletions[:i]
+	}
+	return deletions
+}
+
+// enqueueDeletion enqueues the delete job for d. Failures are logged
+// and counted, as the resource would otherwise be silently left behind
+// until the next check finds it again
+func enqueueDeletion(ctx context.Context, app *App, d *Deletion, expires string) error {
+	err := app.Enqueue(ctx, DeletionTask(d, expires))
+	if err != nil {
+		warningf(ctx, "Failed to schedule deletion of %s %s (region = %s): %s", d.Kind, d.Name, d.Region, err)
+		telemetry.RecordError(err)
+	}
+	return err
+}
+
+// writeScheduleResult fails the check job if any of the delete jobs
+// could not be enqueued, so that it shows up as failed in the cron logs
+func writeScheduleResult(w http.ResponseWriter, failed int) {
+	if failed > 0 {
+		http.Error(w, fmt.Sprintf(`failed to schedule %d deletions`, failed), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isDryRun returns true if deletions should only be logged, either
+// because DRY_RUN is set, or because the request asks for it
+func isDryRun(r *http.Request) bool {
+	if dryRun {
+		return true
+	}
+	v, _ := strconv.ParseBool(r.FormValue(`dry_run`))
+	return v
+}
+
+func isExpired(r *http.Request) bool {
+	expires, err := time.Parse(time.RFC3339, r.FormValue(`expires`))
+	return err != nil || time.Now().UTC().After(expires)
+}
+
+// taskEpoch returns the epoch the job was enqueued in. Jobs enqueued
+// before epochs were introduced belong to the first one
+func taskEpoch(r *http.Request) int {
+	n, _ := strconv.Atoi(r.FormValue(`epoch`))
+	return n
+}
+
+// isVoid tells whether the job was enqueued before the queue was purged
+// through the admin API
+func isVoid(app *App, r *http.Request) bool {
+	return taskEpoch(r) < app.epoch
+}
+
+// handleDeletionJob is the common implementation of the delete jobs
+func handleDeletionJob(w http.ResponseWriter, r *http.Request, d *Deletion) {
+	ctx := withResource(appengine.NewContext(r), d.Kind, d.Name)
+	ctx, app, err := requestApp(ctx, r)
+	if isExpired(r) {
+		dropExpired(ctx, app, d)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusOK)
+		return
+	}
+
+	if isVoid(app, r) {
+		infof(ctx, `Dropping deletion of %s %s (region = %s): scheduled before the queue was purged`, d.Kind, d.Name, d.Region)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// resources whose names do not look like anything we clean up, and
+	// that did not opt into the cleanup, are left alone, and the job is
+	// not retried. the rest of the chain is still carried out, as each
+	// of its jobs is checked on its own
+	d.Next = readChain(ctx, r)
+	deletable, err := app.isDeletable(ctx, d)
+	if err != nil {
+		debugf(ctx, `Failed to look up %s %s: %s`, d.Kind, d.Name, err)
+		if isNotFound(err) {
+			continueChain(ctx, app, d)
+		}
+		handleJobError(w, r, err)
+		return
+	}
+	if !deletable {
+		warningf(ctx, `Refusing to delete %s %s (region = %s): name does not match any of the expected patterns, and it did not opt into the cleanup`, d.Kind, d.Name, d.Region)
+		publishEvent(ctx, app, d, DecisionFailed, errors.New(`name does not match any of the expected patterns`))
+		continueChain(ctx, app, d)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// while paused, or outside of the deletion windows, let the task
+	// queue retry the job. it will expire if deletions are not allowed
+	// again in time
+	if held := app.Config().DeletionsHeld(time.Now()); len(held) > 0 {
+		http.Error(w, held, http.StatusServiceUnavailable)
+		return
+	}
+
+	if isDryRun(r) {
+		infof(ctx, `Dry run, not calling %s`, d.APICall(app.project))
+		continueChain(ctx, app, d)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	debugf(ctx, `Request to delete %s %s (region = %s)`, d.Kind, d.Name, d.Region)
+	attempt := taskRetryCount(r) + 1
+	requeues := requeueCount(r)
+	op, err := app.Delete(ctx, d)
+	if err != nil {
+		debugf(ctx, `Failed to delete %s %s: %s`, d.Kind, d.Name, err)
+		telemetry.RecordError(err)
+		recordAttempt(ctx, app, d, attempt, requeues, err)
+		if IsPermissionDenied(err) {
+			handlePermissionDenied(ctx, w, r, app, d, err)
+			return
+		}
+		// the resource is already gone, which is as good as deleted
+		// as far as the rest of the chain is concerned
+		if isNotFound(err) {
+			continueChain(ctx, app, d)
+		}
+		handleJobError(w, r, err)
+		return
+	}
+
+	if op.Done() {
+		finishDeletion(ctx, app, d, op.Err(), attempt, requeues, taskEpoch(r))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// the deletion is only recorded once its operation turns out to
+	// have succeeded
+	expires := time.Now().UTC().Add(operationPollTimeout).Format(time.RFC3339)
+	if err := app.Enqueue(ctx, OperationTask(op.Ref(), d, expires, attempt, requeues)); err != nil {
+		warningf(ctx, `Failed to schedule polling of operation %s, recording deletion of %s %s unverified: %s`, op.Ref().Name, d.Kind, d.Name, err)
+		telemetry.RecordError(err)
+		finishDeletion(ctx, app, d, nil, attempt, requeues, taskEpoch(r))
 	}
-	return New(id, cl)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-var queueName = `default`
-
-func init() {
-	if v := os.Getenv(`QUEUE_NAME`); len(v) > 0 {
-		queueName = v
+// dropExpired records that the delete job for d was dropped, because it
+// waited in the queue for longer than its task expiration. A busy queue
+// shows up as a growing number of these. The app may be nil if it could
+// not be created, in which case no event is published
+func dropExpired(ctx context.Context, app *App, d *Deletion) {
+	warningf(ctx, `Dropping deletion of %s %s (region = %s): the job expired before it ran`, d.Kind, d.Name, d.Region)
+	telemetry.RecordExpired(d.Kind)
+	if app != nil {
+		publishEvent(ctx, app, d, DecisionExpired, nil)
 	}
+}
 
-	// list all forwarding rules, and start "check" jobs
-	http.HandleFunc(`/job/forwarding-rules/check`, httpForwardingRulesCheck)
-
-	// checks for dangling firewall rules
-	http.HandleFunc(`/job/firewall-rules/check`, httpFirewallsCheck)
+// attemptCount returns the attempt of the delete job that started the
+// operation being polled
+func attemptCount(r *http.Request) int {
+	n, _ := strconv.Atoi(r.FormValue(`attempt`))
+	return n
+}
 
-	http.HandleFunc(`/job/forwarding-rules/delete`, httpForwardingRulesDelete)
-	http.HandleFunc(`/job/url-maps/delete`, httpUrlMapsDelete)
-	http.HandleFunc(`/job/ssl-certificates/delete`, httpBackendServicesDelete)
-	http.HandleFunc(`/job/backend-services/delete`, httpBackendServicesDelete)
-	http.HandleFunc(`/job/target-pools/check`, httpTargetPoolCheck)
-	http.HandleFunc(`/job/target-pools/delete`, httpTargetPoolsDelete)
-	http.HandleFunc(`/job/target-http-proxies/delete`, httpTargetProxiesDelete)
-	http.HandleFunc(`/job/health-checks/delete`, httpHealthChecksDelete)
+// requeueCount returns the number of times the deletion of the current
+// job was enqueued again, because the resource was still in use
+func requeueCount(r *http.Request) int {
+	n, _ := strconv.Atoi(r.FormValue(`requeues`))
+	return n
 }
 
-func handleJobError(w http.ResponseWriter, r *http.Request, e error) {
-	ge, ok := e.(*googleapi.Error)
-	if !ok || ge.Code != http.StatusNotFound {
-		http.Error(w, e.Error(), http.StatusInternalServerError)
-		return
+// httpOperationsPoll checks on the operation of a deletion, and enqueues
+// itself again until the operation is done, or the job expires
+func httpOperationsPoll(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	d := &Deletion{
+		Kind:   r.FormValue(`kind`),
+		Name:   r.FormValue(`name`),
+		Region: r.FormValue(`region`),
+		Zone:   r.FormValue(`zone`),
 	}
+	ctx = withResource(ctx, d.Kind, d.Name)
+	ref := &OperationRef{
+		Name:   r.FormValue(`operation`),
+		Region: r.FormValue(`operation_region`),
+		Zone:   r.FormValue(`operation_zone`),
+	}
+	d.Next = readChain(ctx, r)
 
-	// if the google api return 404, then there's nothing more we can
-	// do for this job. we should just return a 2XX status and prevent
-	// the taskqueue from retrying
-	ctx := appengine.NewContext(r)
-	log.Debugf(ctx, "Resource was not found, signaling end of this job: %s", e)
-	http.Error(w, `abort job`, http.StatusNoContent)
-}
+	if isExpired(r) {
+		warningf(ctx, `Gave up on operation %s deleting %s %s (region = %s): not done in time`, ref.Name, d.Kind, d.Name, d.Region)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 
-func httpForwardingRulesCheck(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
-	app, err := AppengineApp(ctx)
+	ctx, app, err := requestApp(ctx, r)
 	if err != nil {
 		http.Error(w, `failed to get app`, http.StatusOK)
 		return
 	}
 
-	fwrs, err := app.ListIngressForwardingRules()
+	op, err := app.GetOperation(ctx, ref)
 	if err != nil {
-		http.Error(w, `failed to list ingress resources`, http.StatusOK)
+		debugf(ctx, `Failed to get operation %s: %s`, ref.Name, err)
+		handleJobError(w, r, err)
 		return
 	}
 
-	log.Debugf(ctx, "Loaded %d forwarding rules", len(fwrs))
-
-	seenHttpProxies := make(map[string]struct{})
-	seenHttpsProxies := make(map[string]struct{})
-	for _, fwr := range fwrs {
-		log.Debugf(ctx, "Checking forwarding rule %s", fwr.Name)
-		tpname, region, isHTTPs, err := ParseTargetProxy(fwr.Target)
-		if err != nil {
-			continue
-		}
-
-		if isHTTPs {
-			seenHttpsProxies[tpname] = struct{}{}
-		} else {
-			seenHttpProxies[tpname] = struct{}{}
-		}
-
-		t := taskqueue.NewPOSTTask("/job/target-pools/check", url.Values{
-			"forwarding_rule": {fwr.Name},
-			"tp_name":         {tpname},
-			"region":          {region},
-			"https":           {strconv.FormatBool(isHTTPs)},
-		})
-		taskqueue.Add(ctx, t, queueName)
+	// the operation can not be taken back once started, but the rest
+	// of a chain that was scheduled before the queue was purged is void
+	epoch := taskEpoch(r)
+	if isVoid(app, r) && len(d.Next) > 0 {
+		infof(ctx, `Dropping the rest of the deletion chain of %s %s: scheduled before the queue was purged`, d.Kind, d.Name)
+		d.Next = nil
 	}
 
-	// We're done checking for load balancers that have a forwarding rule,
-	// but we may have target proxies without load balancers, which were
-	// created by GKE
-	if l, err := app.service.TargetHttpProxies.List(app.project).Do(); err == nil {
-		for _, tp := range l.Items {
-			if !strings.HasPrefix(tp.Name, `k8s-tp`) {
-				continue
-			}
-			if _, ok := seenHttpProxies[tp.Name]; !ok {
-				checkAndDeleteTargetProxiesIfApplicable(ctx, app, "", "", tp.Name, false)
-			}
-		}
-	}
-	if l, err := app.service.TargetHttpsProxies.List(app.project).Do(); err == nil {
-		for _, tp := range l.Items {
-			if !strings.HasPrefix(tp.Name, `k8s-tp`) {
-				continue
-			}
-			if _, ok := seenHttpsProxies[tp.Name]; !ok {
-				checkAndDeleteTargetProxiesIfApplicable(ctx, app, "", "", tp.Name, true)
-			}
+	attempt := attemptCount(r)
+	requeues := requeueCount(r)
+	if !op.Done() {
+		// enqueue a new task instead of failing this one, so that slow
+		// operations do not eat into the retries of the task queue
+		t := OperationTask(ref, d, r.FormValue(`expires`), attempt, requeues)
+		t.Params.Set(`epoch`, strconv.Itoa(epoch))
+		if err := app.Enqueue(ctx, t); err != nil {
+			http.Error(w, RedactError(err), http.StatusInternalServerError)
+			return
 		}
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
+
+	finishDeletion(ctx, app, d, op.Err(), attempt, requeues, epoch)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func httpTargetPoolCheck(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
-	app, err := AppengineApp(ctx)
-	if err != nil {
-		http.Error(w, `failed to get app`, http.StatusOK)
+// finishDeletion records the outcome of the operation of a deletion,
+// and moves on to the next deletion of its chain if it succeeded.
+// Deletions that failed because the resource was still in use, usually
+// by a resource that was being deleted at the same time, are enqueued
+// again after a while, up to maxResourceInUseRequeues times, in the
+// same epoch as the job they were scheduled by
+func finishDeletion(ctx context.Context, app *App, d *Deletion, opErr error, attempt, requeues, epoch int) {
+	recordAttempt(ctx, app, d, attempt, requeues, opErr)
+	if opErr == nil {
+		decisionf(ctx, DecisionDeleted, d.Kind, d.Name, `Deleted %s %s (region = %s)`, d.Kind, d.Name, d.Region)
+		publishEvent(ctx, app, d, DecisionDeleted, nil)
+		telemetry.RecordDeletion(d.Kind)
+		if err := app.RecordDeletion(ctx, d, attempt, requeues); err != nil {
+			debugf(ctx, `Failed to record deletion of %s %s: %s`, d.Kind, d.Name, err)
+		}
+		continueChain(ctx, app, d)
 		return
 	}
 
-	tpname := r.FormValue("tp_name")
-	fwname := r.FormValue("forwarding_rule")
-	region := r.FormValue("region")
-	isHTTPs, _ := strconv.ParseBool(r.FormValue("https"))
-
-	if err := checkAndDeleteTargetProxiesIfApplicable(ctx, app, fwname, region, tpname, isHTTPs); err != nil {
-		http.Error(w, err.Error(), http.StatusNoContent)
+	warningf(ctx, `Failed to delete %s %s (region = %s): %s`, d.Kind, d.Name, d.Region, opErr)
+	publishEvent(ctx, app, d, DecisionFailed, opErr)
+	telemetry.RecordError(opErr)
+	if !IsResourceInUse(opErr) || requeues >= maxResourceInUseRequeues {
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
-}
 
-func checkAndDeleteTargetProxiesIfApplicable(ctx context.Context, app *App, fwname, region, tpname string, isHTTPs bool) error {
-	var urlMapURL string
-	var certificates []string
-	var tpName string
-	var timestamp string
-	if isHTTPs {
-		tp, err := app.GetTargetHttpsProxy(tpname)
-		if err != nil {
-			return errors.Wrap(err, `failed to get target https proxy`)
-		}
-		tpName = tp.Name
-		certificates = tp.SslCertificates
-		urlMapURL = tp.UrlMap
-		timestamp = tp.CreationTimestamp
-	} else {
-		tp, err := app.GetTargetHttpProxy(tpname)
-		if err != nil {
-			return errors.Wrap(err, `failed to get target http proxy`)
-		}
-		tpName = tp.Name
-		urlMapURL = tp.UrlMap
-		timestamp = tp.CreationTimestamp
+	expires := app.Config().deletionExpires(d.Kind, resourceInUseDelay)
+	t := DeletionTask(d, expires)
+	t.Params.Set(`requeues`, strconv.Itoa(requeues+1))
+	t.Params.Set(`epoch`, strconv.Itoa(epoch))
+	t.Delay = resourceInUseDelay
+	if err := app.Enqueue(ctx, t); err != nil {
+		warningf(ctx, `Failed to schedule deletion of %s %s again: %s`, d.Kind, d.Name, err)
+		telemetry.RecordError(err)
 	}
+}
 
-	if t, _ := time.Parse(time.RFC3339, timestamp); t.After(time.Now().Add(-1 * time.Hour)) {
-		// if it's pretty new, that's OK. it may still be initializing,
-		// for all I care
-		return nil
+// publishEvent publishes the decision made about d. Failing to do so
+// does not fail the job
+func publishEvent(ctx context.Context, app *App, d *Deletion, decision string, err error) {
+	if perr := app.PublishEvent(ctx, d, decision, err); perr != nil {
+		debugf(ctx, `Failed to publish %s event for %s %s: %s`, decision, d.Kind, d.Name, perr)
 	}
+}
 
-	umname, _, err := ParseUrlMap(urlMapURL)
-	if err != nil {
-		return errors.Wrap(err, `failed to parse url map selflink`)
+// recordAttempt adds the outcome of an attempt at deleting d to the
+// audit history. Failing to do so does not fail the job
+func recordAttempt(ctx context.Context, app *App, d *Deletion, attempt, requeues int, err error) {
+	if rerr := app.RecordAttempt(ctx, d, attempt, requeues, err); rerr != nil {
+		debugf(ctx, `Failed to record attempt at deleting %s %s: %s`, d.Kind, d.Name, rerr)
 	}
+}
 
-	um, err := app.GetUrlMap(umname)
-	if err != nil {
-		return errors.Wrap(err, `failed to get url map`)
+// handlePermissionDenied lets the task queue retry a delete job that
+// failed with a 403 up to PERMISSION_DENIED_RETRIES times, then gives
+// up on it and alerts about the missing permission
+func handlePermissionDenied(ctx context.Context, w http.ResponseWriter, r *http.Request, app *App, d *Deletion, err error) {
+	if taskRetryCount(r) < permissionDeniedRetries {
+		http.Error(w, RedactError(err), http.StatusForbidden)
+		return
 	}
 
-	services, err := app.FindBackendServices(um)
+	msg := fmt.Sprintf(`failed to delete %s %s (region = %s): missing permission %s`, d.Kind, d.Name, d.Region, d.Permission())
+	warningf(ctx, `Giving up: %s`, msg)
+	err = app.Notify(ctx, &Notification{
+		Subject: `permission denied`,
+		Body:    msg + "\n" + RedactError(err),
+	})
 	if err != nil {
-		return errors.Wrap(err, `failed to find backend services`)
+		debugf(ctx, "Failed to notify permission denied: %s", err)
 	}
+	http.Error(w, `abort job`, http.StatusNoContent)
+}
 
-	var total int
-	for _, service := range services {
-		instances, err := app.ListInstancesForService(service)
-		if err != nil {
-			return errors.Wrap(err, `failed to list instances for service`)
+// taskRetryCount returns the number of times the current task has
+// been retried, as reported by either task queue backend
+func taskRetryCount(r *http.Request) int {
+	for _, h := range []string{`X-AppEngine-TaskRetryCount`, `X-CloudTasks-TaskRetryCount`} {
+		if n, err := strconv.Atoi(r.Header.Get(h)); err == nil {
+			return n
 		}
-		total = total + len(instances)
 	}
+	return 0
+}
 
-	// Cowardly refuse to delete resources if at least 1 instance
-	// exist somewhere
-	if total > 0 {
-		return nil
-	}
+func httpForwardingRulesDelete(w http.ResponseWriter, r *http.Request) {
+	handleDeletionJob(w, r, &Deletion{
+		Kind:   KindForwardingRules,
+		Name:   r.FormValue(`name`),
+		Region: r.FormValue(`region`),
+	})
+}
 
-	expires := time.Now().UTC().Add(15 * time.Minute).Format(time.RFC3339)
+// url maps, ssl certificates and target proxies are regional for internal
+// load balancers. tasks enqueued before that do not carry a region, and
+// are for global resources
+func httpUrlMapsDelete(w http.ResponseWriter, r *http.Request) {
+	handleDeletionJob(w, r, &Deletion{
+		Kind:   KindUrlMaps,
+		Name:   r.FormValue(`name`),
+		Region: r.FormValue(`region`),
+	})
+}
 
-	var tasks []*taskqueue.Task
+func httpBackendServicesDelete(w http.ResponseWriter, r *http.Request) {
+	handleDeletionJob(w, r, &Deletion{
+		Kind:   KindBackendServices,
+		Name:   r.FormValue(`name`),
+		Region: r.FormValue(`region`),
+	})
+}
 
-	tasks = append(tasks, taskqueue.NewPOSTTask(`/job/target-http-proxies/delete`, url.Values{
-		"name":    {tpName},
-		"https":   {strconv.FormatBool(isHTTPs)},
-		"expires": {expires},
-	}))
+func httpSslCertificatesDelete(w http.ResponseWriter, r *http.Request) {
+	handleDeletionJob(w, r, &Deletion{
+		Kind:   KindSslCertificates,
+		Name:   r.FormValue(`name`),
+		Region: r.FormValue(`region`),
+	})
+}
 
-	if isHTTPs {
-		for _, cert := range certificates {
-			certName, _, err := ParseSslCertificates(cert)
-			if err != nil {
-				continue
-			}
+func httpTargetPoolsDelete(w http.ResponseWriter, r *http.Request) {
+	handleDeletionJob(w, r, &Deletion{
+		Kind:   KindTargetPools,
+		Name:   r.FormValue(`name`),
+		Region: r.FormValue(`region`),
+	})
+}
 
-			// delete the certificates
-			tasks = append(tasks, taskqueue.NewPOSTTask(`/job/ssl-certificates/delete`, url.Values{
-				"name":    {certName},
-				"expires": {expires},
-			}))
-		}
-	}
+func httpInstanceGroupsDelete(w http.ResponseWriter, r *http.Request) {
+	handleDeletionJob(w, r, &Deletion{
+		Kind: KindInstanceGroups,
+		Name: r.FormValue(`name`),
+		Zone: r.FormValue(`zone`),
+	})
+}
 
-	// delete backend services
-	for _, service := range services {
-		_, bsRegion, _ := ParseBackendServices(service.SelfLink)
-		tasks = append(tasks, taskqueue.NewPOSTTask(`/job/backend-services/delete`, url.Values{
-			"name":    {service.Name},
-			"region":  {bsRegion},
-			"expires": {expires},
-		}))
+func httpAddressesDelete(w http.ResponseWriter, r *http.Request) {
+	handleDeletionJob(w, r, &Deletion{
+		Kind:   KindAddresses,
+		Name:   r.FormValue(`name`),
+		Region: r.FormValue(`region`),
+	})
+}
 
-		for _, hc := range service.HealthChecks {
-			name, _, _ := ParseHealthChecks(hc)
-			tasks = append(tasks, taskqueue.NewPOSTTask(`/job/health-checks/delete`, url.Values{
-				"name":    {name},
-				"expires": {expires},
-			}))
-		}
+func httpHealthChecksDelete(w http.ResponseWriter, r *http.Request) {
+	// tasks that were enqueued before kinds were introduced do not
+	// carry a kind nor a region. these are global health checks
+	kind := r.FormValue(`kind`)
+	if kind == `` {
+		kind = KindHealthChecks
 	}
+	handleDeletionJob(w, r, &Deletion{
+		Kind:   kind,
+		Name:   r.FormValue(`name`),
+		Region: r.FormValue(`region`),
+	})
+}
 
-	tasks = append(tasks, taskqueue.NewPOSTTask(`/job/url-maps/delete`, url.Values{
-		"name":    {umname},
-		"expires": {expires},
-	}))
-
-	if len(fwname) > 0 {
-
-		tasks = append(tasks, taskqueue.NewPOSTTask("/job/forwarding-rules/delete", url.Values{
-			"name":    {fwname},
-			"region":  {region},
-			"expires": {expires},
-		}))
+func httpTargetProxiesDelete(w http.ResponseWriter, r *http.Request) {
+	kind := KindTargetHttpProxies
+	if isHTTPs, _ := strconv.ParseBool(r.FormValue("https")); isHTTPs {
+		kind = KindTargetHttpsProxies
 	}
+	handleDeletionJob(w, r, &Deletion{
+		Kind:   kind,
+		Name:   r.FormValue(`name`),
+		Region: r.FormValue(`region`),
+	})
+}
 
-	for _, t := range tasks {
-		taskqueue.Add(ctx, t, queueName)
+func httpFirewallsCheck(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+	ctx, app, err := requestApp(ctx, r)
+	if err != nil {
+		http.Error(w, `failed to get app`, http.StatusOK)
+		return
 	}
 
-	return nil
-}
-
-func isExpired(r *http.Request) bool {
-	expires, err := time.Parse(time.RFC3339, r.FormValue(`expires`))
-	return err != nil || time.Now().UTC().After(expires)
-}
+	firewalls, err := app.ListDanglingFirewalls(ctx)
+	if zerr, ok := errors.Cause(err).(*ZoneScanError); ok {
+		// the rules of the tags that can not be in use in the failed
+		// zones are still dangling
+		for zone, err := range zerr.Zones {
+			warningf(ctx, `Failed to list instances in zone %s: %s`, zone, err)
+		}
+		infof(ctx, `Not deleting the firewall rules of tags that may be in use in those zones: %s`, strings.Join(zerr.Unknown, `, `))
+	} else if err != nil {
+		debugf(ctx, `Failed to list dangling firewall rules %s`, err)
+		handleJobError(w, r, err)
+		return
+	}
 
-func httpForwardingRulesDelete(w http.ResponseWriter, r *http.Request) {
-	if isExpired(r) {
+	if held := app.Config().DeletionsHeld(time.Now()); len(held) > 0 {
+		infof(ctx, `Not deleting %d dangling firewall rules: %s`, len(firewalls), held)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	ctx := appengine.NewContext(r)
-	app, err := AppengineApp(ctx)
-	if err != nil {
-		http.Error(w, `failed to get app`, http.StatusOK)
-		return
+	// the policy in the configuration takes precedence over the
+	// environment variable
+	grace := app.Config().DisableGrace(KindFirewalls)
+	if grace == 0 {
+		grace = firewallDisableGrace
 	}
 
-	name := r.FormValue(`name`)
-	region := r.FormValue(`region`)
-	log.Debugf(ctx, `Request to delete forwarding rule %s (region = %s)`, name, region)
-	if region == `global` {
-		if _, err := app.service.GlobalForwardingRules.Delete(app.project, name).Context(ctx).Do(); err != nil {
-			log.Debugf(ctx, `failed to delete global forwarding rule %s`, err)
-			handleJobError(w, r, err)
-			return
+	for _, fw := range firewalls {
+		if isDryRun(r) {
+			if grace > 0 {
+				infof(ctx, `Dry run, not disabling or deleting firewall rule %s (grace period = %s)`, fw.Name, grace)
+			} else {
+				infof(ctx, `Dry run, not calling %s`, (&Deletion{Kind: KindFirewalls, Name: fw.Name, Region: globalRegion}).APICall(app.project))
+			}
+			continue
 		}
-	} else {
-		if _, err := app.service.ForwardingRules.Delete(app.project, region, name).Context(ctx).Do(); err != nil {
-			log.Debugf(ctx, `failed to delete region (%s) forwarding rule %s`, region, err)
+
+		if grace > 0 {
+			deleted, err := app.SoftDeleteFirewall(ctx, fw, grace)
+			if err != nil {
+				debugf(ctx, `Failed to soft delete dangling firewall rule %s: %s`, fw.Name, err)
+				handleJobError(w, r, errors.Cause(err))
+				return
+			}
+			if deleted {
+				debugf(ctx, `Deleted firewall %s after its grace period`, fw.Name)
+			}
+			continue
+		}
+
+		debugf(ctx, `Deleting firewall %s`, fw.Name)
+
+		if _, err := app.Delete(ctx, &Deletion{Kind: KindFirewalls, Name: fw.Name, Region: globalRegion}); err != nil {
+			debugf(ctx, `Failed to delete dangling firewall rule %s: %s`, fw.Name, err)
 			handleJobError(w, r, err)
 			return
 		}
 	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func httpUrlMapsDelete(w http.ResponseWriter, r *http.Request) {
-	if isExpired(r) {
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-
+func httpManagedCertificatesCheck(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
-	app, err := AppengineApp(ctx)
+	ctx, app, err := requestApp(ctx, r)
 	if err != nil {
 		http.Error(w, `failed to get app`, http.StatusOK)
 		return
 	}
 
-	name := r.FormValue(`name`)
-	log.Debugf(ctx, `Request to delete url map %s`, name)
-	if _, err := app.service.UrlMaps.Delete(app.project, name).Context(ctx).Do(); err != nil {
-		log.Debugf(ctx, `Failed to delete url map: %s`, err)
+	certs, err := app.ListStuckManagedCertificates(ctx, managedCertificateThreshold)
+	if err != nil {
+		debugf(ctx, `Failed to list stuck managed certificates %s`, err)
 		handleJobError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
-}
 
-func httpBackendServicesDelete(w http.ResponseWriter, r *http.Request) {
-	if isExpired(r) {
+	if held := app.Config().DeletionsHeld(time.Now()); len(held) > 0 {
+		infof(ctx, `Not scheduling deletion of %d managed certificates: %s`, len(certs), held)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	ctx := appengine.NewContext(r)
-	app, err := AppengineApp(ctx)
-	if err != nil {
-		http.Error(w, `failed to get app`, http.StatusOK)
-		return
+	var failed int
+	expires := app.Config().deletionExpires(KindSslCertificates, 0)
+	for _, cert := range certs {
+		decisionf(ctx, DecisionScheduled, KindSslCertificates, cert.Name, `Scheduling deletion of managed certificate %s (status = %s)`, cert.Name, cert.Managed.Status)
+		err := enqueueDeletion(ctx, app, &Deletion{
+			Kind:   KindSslCertificates,
+			Name:   cert.Name,
+			Region: certificateRegion(cert),
+		}, expires)
+		if err != nil {
+			failed++
+		}
 	}
 
-	name := r.FormValue(`name`)
-	region := r.FormValue(`region`)
-	log.Debugf(ctx, `Request to delete backend service %s (region = %s)`, name, region)
-	if region == `global` {
-		if _, err := app.service.BackendServices.Delete(app.project, name).Context(ctx).Do(); err != nil {
-			log.Debugf(ctx, `failed to delete global backend service %s`, err)
-			handleJobError(w, r, err)
-			return
-		}
-	} else {
-		if _, err := app.service.RegionBackendServices.Delete(app.project, region, name).Context(ctx).Do(); err != nil {
-			log.Debugf(ctx, `failed to delete regional (%s) backend service %s`, region, err)
-			handleJobError(w, r, err)
-			return
-		}
+	writeScheduleResult(w, failed)
+}
+
+// checkJob returns the handler of the check job of the given kind
+func checkJob(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handleCheckJob(w, r, kind)
 	}
-	w.WriteHeader(http.StatusNoContent)
 }
 
-func httpSslCertificatesDelete(w http.ResponseWriter, r *http.Request) {
-	if isExpired(r) {
-		w.WriteHeader(http.StatusNoContent)
+func httpResourcesCheck(w http.ResponseWriter, r *http.Request) {
+	handleCheckJob(w, r, r.FormValue(`type`))
+}
+
+// handleCheckJob is the common implementation of the check jobs that
+// go through a Cleaner
+func handleCheckJob(w http.ResponseWriter, r *http.Request, kind string) {
+	c, ok := LookupCleaner(kind)
+	if !ok {
+		http.Error(w, `unknown resource type`, http.StatusBadRequest)
 		return
 	}
 
 	ctx := appengine.NewContext(r)
-	app, err := AppengineApp(ctx)
+	ctx, app, err := requestApp(ctx, r)
 	if err != nil {
 		http.Error(w, `failed to get app`, http.StatusOK)
 		return
 	}
 
-	name := r.FormValue(`name`)
-	log.Debugf(ctx, `Request to delete ssl certificate %s`, name)
-	if _, err := app.service.SslCertificates.Delete(app.project, name).Context(ctx).Do(); err != nil {
-		log.Debugf(ctx, `Failed to delete ssl certificate %s`, err)
+	deletions, err := c.Check(ctx, app)
+	if err != nil {
+		if IsInventoryDropError(err) {
+			warningf(ctx, "Skipping this check of %s: %s", kind, err)
+			http.Error(w, RedactError(err), http.StatusServiceUnavailable)
+			return
+		}
+		debugf(ctx, `Failed to check %s %s`, kind, err)
 		handleJobError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
-}
 
-func httpTargetPoolsDelete(w http.ResponseWriter, r *http.Request) {
-	if isExpired(r) {
+	if held := app.Config().DeletionsHeld(time.Now()); len(held) > 0 {
+		infof(ctx, `Not scheduling deletion of %d %s: %s`, len(deletions), kind, held)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
+	writeScheduleResult(w, scheduleDeletions(ctx, app, deletions))
+}
+
+func httpResourcesDelete(w http.ResponseWriter, r *http.Request) {
+	kind := r.FormValue(`type`)
+	if _, ok := LookupCleaner(kind); !ok && !isExpired(r) {
+		// the task may have been enqueued by a newer version, so let
+		// the task queue retry it until it expires
+		http.Error(w, `unknown resource type`, http.StatusBadRequest)
+		return
+	}
+	handleDeletionJob(w, r, &Deletion{
+		Kind:   kind,
+		Name:   r.FormValue(`name`),
+		Region: r.FormValue(`region`),
+		Zone:   r.FormValue(`zone`),
+	})
+}
+
+func httpMonthlyDigest(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
-	app, err := AppengineApp(ctx)
+	ctx, app, err := requestApp(ctx, r)
 	if err != nil {
 		http.Error(w, `failed to get app`, http.StatusOK)
 		return
 	}
 
-	name := r.FormValue(`name`)
-	region := r.FormValue(`region`)
-	log.Debugf(ctx, `Request to delete target pool %s (region = %s)`, name, region)
-	if _, err := app.service.TargetPools.Delete(app.project, region, name).Context(ctx).Do(); err != nil {
-		log.Debugf(ctx, `Failed to delete target pool %s`, err)
+	// the job runs at the beginning of the month, and reports on the
+	// month that just ended. the day is stepped back on the calendar of
+	// the configured time zone, as a day is not always 24 hours long
+	now := time.Now().In(app.Config().Location())
+	digest, err := app.MonthlyDigest(ctx, now.AddDate(0, 0, -1), billingExportTable)
+	if err != nil {
+		debugf(ctx, `Failed to create monthly digest: %s`, err)
 		handleJobError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
-}
 
-func httpHealthChecksDelete(w http.ResponseWriter, r *http.Request) {
-	if isExpired(r) {
-		w.WriteHeader(http.StatusNoContent)
-		return
+	err = app.Notify(ctx, &Notification{
+		Subject: `monthly digest`,
+		Body:    digest.String(),
+	})
+	if err != nil {
+		debugf(ctx, "Failed to notify monthly digest: %s", err)
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
+// httpStateGC collects the records that are older than their retention.
+// The projects share the stores, so the job is not fanned out
+func httpStateGC(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
 	app, err := AppengineApp(ctx)
 	if err != nil {
 		http.Error(w, `failed to get app`, http.StatusOK)
 		return
 	}
+	writeJSON(w, app.CollectGarbage(ctx, time.Now().UTC()))
+}
 
-	name := r.FormValue(`name`)
-	log.Debugf(ctx, `Request to delete health check %s`, name)
-	if _, err := app.service.HealthChecks.Delete(app.project, name).Context(ctx).Do(); err != nil {
+// pushIdentity returns an error unless the request carries an identity
+// token of the push subscription, signed by Google for PUSH_AUDIENCE
+// and, if PUSH_SERVICE_ACCOUNT is set, issued to that service account
+func pushIdentity(r *http.Request) error {
+	if len(pushAudience) == 0 {
+		return errors.New(`PUSH_AUDIENCE is not set`)
+	}
+	return verifyIdentityToken(r, pushAudience, pushServiceAccount)
+}
 
-		log.Debugf(ctx, `Failed to delete health check %s`, err)
-		handleJobError(w, r, err)
-		return
+// taskIdentity returns an error unless the request carries the identity
+// token that Cloud Tasks adds to the tasks it delivers to
+// CLOUD_TASKS_TARGET_URL, issued to CLOUD_TASKS_SERVICE_ACCOUNT
+func taskIdentity(r *http.Request) error {
+	if len(cloudTasksServiceAccount) == 0 {
+		return errors.New(`CLOUD_TASKS_SERVICE_ACCOUNT is required when CLOUD_TASKS_TARGET_URL is set`)
 	}
-	w.WriteHeader(http.StatusNoContent)
+	// the audience is the one NewCloudTasksEnqueuer asks for
+	return verifyIdentityToken(r, strings.TrimSuffix(cloudTasksTargetURL, `/`), cloudTasksServiceAccount)
 }
 
-func httpTargetProxiesDelete(w http.ResponseWriter, r *http.Request) {
-	if isExpired(r) {
-		w.WriteHeader(http.StatusNoContent)
-		return
+// verifyIdentityToken returns an error unless the request carries an
+// identity token signed by Google for audience and, if serviceAccount
+// is not empty, issued to that service account
+func verifyIdentityToken(r *http.Request, audience, serviceAccount string) error {
+	token := strings.TrimPrefix(r.Header.Get(`Authorization`), `Bearer `)
+	if len(token) == 0 || token == r.Header.Get(`Authorization`) {
+		return errors.New(`missing identity token`)
 	}
 
-	ctx := appengine.NewContext(r)
-	app, err := AppengineApp(ctx)
+	payload, err := idtoken.Validate(r.Context(), token, audience)
 	if err != nil {
-		http.Error(w, `failed to get app`, http.StatusOK)
-		return
+		return errors.Wrap(err, `failed to validate identity token`)
 	}
 
-	name := r.FormValue(`name`)
-	isHTTPs, _ := strconv.ParseBool(r.FormValue("https"))
-	log.Debugf(ctx, `Request to delete target http proxy %s (HTTPs = %t)`, name, isHTTPs)
-
-	if isHTTPs {
-		if _, err := app.service.TargetHttpsProxies.Delete(app.project, name).Context(ctx).Do(); err != nil {
-			log.Debugf(ctx, `Failed to delete target https proxy %s`, err)
-			handleJobError(w, r, err)
-			return
-		}
-	} else {
-		if _, err := app.service.TargetHttpProxies.Delete(app.project, name).Context(ctx).Do(); err != nil {
-			log.Debugf(ctx, `Failed to delete target http proxy %s`, err)
-			handleJobError(w, r, err)
-			return
+	if len(serviceAccount) > 0 {
+		email, _ := payload.Claims[`email`].(string)
+		if verified, _ := payload.Claims[`email_verified`].(bool); !verified || email != serviceAccount {
+			return errors.Errorf(`identity token was not issued to %s`, serviceAccount)
 		}
 	}
-	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
-func httpFirewallsCheck(w http.ResponseWriter, r *http.Request) {
+// httpClusterNotifications records the clusters that GKE notifies us
+// were deleted. Pub/Sub redelivers messages until they are acknowledged
+// with a 2xx, so only failing to record a deletion is answered with an
+// error. Messages that can never be processed are acknowledged
+func httpClusterNotifications(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
-	app, err := AppengineApp(ctx)
-	if err != nil {
-		http.Error(w, `failed to get app`, http.StatusOK)
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := pushIdentity(r); err != nil {
+		warningf(ctx, `Rejected cluster notification: %s`, err)
+		http.Error(w, `unauthorized`, http.StatusUnauthorized)
 		return
 	}
 
-	firewalls, err := app.ListDanglingFirewalls(ctx)
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Debugf(ctx, `Failed to list dangling firewall rules %s`, err)
-		handleJobError(w, r, err)
+		http.Error(w, `failed to read request`, http.StatusBadRequest)
 		return
 	}
 
-	for _, fw := range firewalls {
-		log.Debugf(ctx, `Deleting firewall %s`, fw.Name)
-
-		if _, err := app.service.Firewalls.Delete(app.project, fw.Name).Do(); err != nil {
-			log.Debugf(ctx, `Failed to delete dangling firewall rule %s: %s`, fw.Name, err)
-			handleJobError(w, r, err)
-			return
-		}
+	dc, err := ParseClusterNotification(body)
+	if err != nil {
+		warningf(ctx, `Dropping cluster notification: %s`, err)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if dc == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !HasProject(configuredProjects(ctx), dc.Project) {
+		warningf(ctx, `Dropping deletion of cluster %s in project %s, which is not configured`, dc.Name, dc.Project)
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
 
+	store, ok := appengineStore.(DeletedClusterStore)
+	if !ok {
+		warningf(ctx, `Dropping deletion of cluster %s: the store can not remember deleted clusters`, dc.Name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := store.SaveDeletedCluster(ctx, dc); err != nil {
+		warningf(ctx, `Failed to record deletion of cluster %s (id = %s): %s`, dc.Name, dc.ID, err)
+		http.Error(w, `failed to record deleted cluster`, http.StatusInternalServerError)
+		return
+	}
+	infof(ctx, `Recorded deletion of cluster %s in %s (id = %s)`, dc.Name, dc.Location, dc.ID)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,87 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+// RecordAttempt adds the outcome of an attempt at deleting d to the
+// audit history. err is nil if the attempt succeeded. It is a no-op
+// when there is no audit store
+func (app *App) RecordAttempt(ctx context.Context, d *Deletion, attempt, requeues int, err error) error {
+	if app.auditStore == nil {
+		return nil
+	}
+
+	a := &DeletionAttempt{
+		Project:  app.project,
+		Kind:     d.Kind,
+		Name:     d.Name,
+		Region:   d.Region,
+		Zone:     d.Zone,
+		At:       time.Now().UTC(),
+		Attempt:  attempt,
+		Requeues: requeues,
+	}
+	if err != nil {
+		a.ErrorClass = ErrorClass(err)
+	}
+	return app.auditStore.RecordAttempt(ctx, a)
+}
+
+// GroupAttempts groups the attempts by resource, and returns the
+// histories of the resources that had at least one failed attempt.
+// Resources that were deleted on the first try are not interesting
+func GroupAttempts(attempts []*DeletionAttempt) []*AttemptHistory {
+	var list []*AttemptHistory
+	byResource := make(map[string]*AttemptHistory)
+	failed := make(map[string]bool)
+	for _, a := range attempts {
+		key := a.Kind + `/` + a.Region + `/` + a.Zone + `/` + a.Name
+		h, ok := byResource[key]
+		if !ok {
+			h = &AttemptHistory{Kind: a.Kind, Name: a.Name, Region: a.Region, Zone: a.Zone}
+			byResource[key] = h
+			list = append(list, h)
+		}
+		h.Attempts = append(h.Attempts, a)
+		if len(a.ErrorClass) > 0 {
+			failed[key] = true
+		}
+	}
+
+	var histories []*AttemptHistory
+	for _, h := range list {
+		if failed[h.Kind+`/`+h.Region+`/`+h.Zone+`/`+h.Name] {
+			histories = append(histories, h)
+		}
+	}
+	return histories
+}
+
+// Succeeded returns true if the last attempt deleted the resource
+func (h *AttemptHistory) Succeeded() bool {
+	return len(h.Attempts) > 0 && len(h.Attempts[len(h.Attempts)-1].ErrorClass) == 0
+}
+
+func (h *AttemptHistory) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `%s %s`, h.Kind, h.Name)
+	if len(h.Region) > 0 {
+		fmt.Fprintf(&buf, ` (region = %s)`, h.Region)
+	}
+	if len(h.Zone) > 0 {
+		fmt.Fprintf(&buf, ` (zone = %s)`, h.Zone)
+	}
+	buf.WriteString(`:`)
+	for _, a := range h.Attempts {
+		outcome := a.ErrorClass
+		if len(outcome) == 0 {
+			outcome = `deleted`
+		}
+		fmt.Fprintf(&buf, ` %s#%d.%d=%s`, a.At.Format(timeFormat), a.Attempt, a.Requeues, outcome)
+	}
+	return buf.String()
+}
@@ -0,0 +1,45 @@
+package autolbclean_test
+
+import (
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupAttempts(t *testing.T) {
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	attempts := []*autolbclean.DeletionAttempt{
+		{Kind: autolbclean.KindBackendServices, Name: `k8s-be-30000`, At: now, Attempt: 1, ErrorClass: autolbclean.ErrorClassResourceInUse},
+		{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-1`, At: now, Attempt: 1},
+		{Kind: autolbclean.KindBackendServices, Name: `k8s-be-30000`, At: now.Add(time.Minute), Attempt: 1, Requeues: 1},
+		{Kind: autolbclean.KindBackendServices, Name: `k8s-be-30000`, Region: `asia-northeast1`, At: now, Attempt: 1, ErrorClass: autolbclean.ErrorClassRateLimited},
+	}
+
+	histories := autolbclean.GroupAttempts(attempts)
+	if !assert.Len(t, histories, 2, `only resources with failed attempts should be listed`) {
+		return
+	}
+
+	h := histories[0]
+	if !assert.Equal(t, `k8s-be-30000`, h.Name, `name should match`) {
+		return
+	}
+	if !assert.Len(t, h.Attempts, 2, `attempts should be grouped by resource`) {
+		return
+	}
+	if !assert.True(t, h.Succeeded(), `last attempt succeeded`) {
+		return
+	}
+	if !assert.Equal(t, `backendServices k8s-be-30000: 2026-10-16T00:00:00Z#1.0=resource_in_use 2026-10-16T00:01:00Z#1.1=deleted`, h.String(), `string should match`) {
+		return
+	}
+
+	if !assert.Equal(t, `asia-northeast1`, histories[1].Region, `regional resource should be kept apart`) {
+		return
+	}
+	if !assert.False(t, histories[1].Succeeded(), `last attempt failed`) {
+		return
+	}
+}
@@ -0,0 +1,229 @@
+package autolbclean
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/appengine/datastore"
+)
+
+const pendingDeletionKind = `PendingDeletion`
+
+// datastoreAuditStore stores the pending deletions in App Engine datastore.
+// When a deployment cleans up several projects, the pending deletions
+// are kept apart by project. Deployments for a single project keep the
+// keys they always used
+type datastoreAuditStore struct {
+	project string
+}
+
+func (s datastoreAuditStore) pendingDeletionKey(ctx context.Context, kind, name string) *datastore.Key {
+	id := kind + `/` + name
+	if len(s.project) > 0 {
+		id = s.project + `/` + id
+	}
+	return datastore.NewKey(ctx, pendingDeletionKind, id, 0, nil)
+}
+
+func (s datastoreAuditStore) LoadPendingDeletion(ctx context.Context, kind, name string) (*PendingDeletion, error) {
+	var pd PendingDeletion
+	if err := datastore.Get(ctx, s.pendingDeletionKey(ctx, kind, name), &pd); err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, `failed to load pending deletion from datastore`)
+	}
+	return &pd, nil
+}
+
+func (s datastoreAuditStore) SavePendingDeletion(ctx context.Context, pd *PendingDeletion) error {
+	if _, err := datastore.Put(ctx, s.pendingDeletionKey(ctx, pd.Kind, pd.Name), pd); err != nil {
+		return errors.Wrap(err, `failed to save pending deletion to datastore`)
+	}
+	return nil
+}
+
+func (s datastoreAuditStore) DeletePendingDeletion(ctx context.Context, kind, name string) error {
+	if err := datastore.Delete(ctx, s.pendingDeletionKey(ctx, kind, name)); err != nil && err != datastore.ErrNoSuchEntity {
+		return errors.Wrap(err, `failed to delete pending deletion from datastore`)
+	}
+	return nil
+}
+
+const accessLogKind = `AccessLog`
+
+func (datastoreAuditStore) RecordAccess(ctx context.Context, e *AccessLogEntry) error {
+	if _, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, accessLogKind, nil), e); err != nil {
+		return errors.Wrap(err, `failed to save access log entry to datastore`)
+	}
+	return nil
+}
+
+func (datastoreAuditStore) ListAccess(ctx context.Context, since, until time.Time) ([]*AccessLogEntry, error) {
+	var entries []*AccessLogEntry
+	_, err := datastore.NewQuery(accessLogKind).
+		Filter(`At >=`, since).
+		Filter(`At <`, until).
+		Order(`At`).
+		GetAll(ctx, &entries)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list access log entries from datastore`)
+	}
+	return entries, nil
+}
+
+const deletionRecordKind = `DeletionRecord`
+
+func (datastoreAuditStore) RecordDeletion(ctx context.Context, r *DeletionRecord) error {
+	if _, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, deletionRecordKind, nil), r); err != nil {
+		return errors.Wrap(err, `failed to save deletion record to datastore`)
+	}
+	return nil
+}
+
+func (datastoreAuditStore) ListDeletions(ctx context.Context, since, until time.Time) ([]*DeletionRecord, error) {
+	var records []*DeletionRecord
+	_, err := datastore.NewQuery(deletionRecordKind).
+		Filter(`DeletedAt >=`, since).
+		Filter(`DeletedAt <`, until).
+		Order(`DeletedAt`).
+		GetAll(ctx, &records)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list deletion records from datastore`)
+	}
+	return records, nil
+}
+
+const deletionAttemptKind = `DeletionAttempt`
+
+func (datastoreAuditStore) RecordAttempt(ctx context.Context, a *DeletionAttempt) error {
+	if _, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, deletionAttemptKind, nil), a); err != nil {
+		return errors.Wrap(err, `failed to save deletion attempt to datastore`)
+	}
+	return nil
+}
+
+func (datastoreAuditStore) ListAttempts(ctx context.Context, since, until time.Time) ([]*DeletionAttempt, error) {
+	var attempts []*DeletionAttempt
+	_, err := datastore.NewQuery(deletionAttemptKind).
+		Filter(`At >=`, since).
+		Filter(`At <`, until).
+		Order(`At`).
+		GetAll(ctx, &attempts)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list deletion attempts from datastore`)
+	}
+	return attempts, nil
+}
+
+func (datastoreAuditStore) PruneRecords(ctx context.Context, record string, cutoff time.Time, archive func([]interface{}) error) (int, error) {
+	switch record {
+	case RecordAccessLog:
+		var list []*AccessLogEntry
+		return pruneEntities(ctx, accessLogKind, `At`, cutoff, &list, archive)
+	case RecordDeletions:
+		var list []*DeletionRecord
+		return pruneEntities(ctx, deletionRecordKind, `DeletedAt`, cutoff, &list, archive)
+	case RecordAttempts:
+		var list []*DeletionAttempt
+		return pruneEntities(ctx, deletionAttemptKind, `At`, cutoff, &list, archive)
+	}
+	return 0, nil
+}
+
+const reportCursorKind = `ReportCursor`
+
+type reportCursor struct {
+	LastReportAt time.Time
+}
+
+// accessSinceLastReport returns the admin API access log entries that
+// were recorded since the previous run report for the given project,
+// up to the end of the current run, and moves the cursor forward to it
+func accessSinceLastReport(ctx context.Context, store AuditStore, project string, until time.Time) ([]*AccessLogEntry, error) {
+	var entries []*AccessLogEntry
+	err := sinceLastReport(ctx, `access/`+project, until, func(since time.Time) error {
+		var err error
+		entries, err = store.ListAccess(ctx, since, until)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// retriesSinceLastReport returns the attempt histories of the deletions
+// in the given project that failed at least once since the previous run
+// report for that project, up to the end of the current run, and moves
+// the cursor forward to it
+func retriesSinceLastReport(ctx context.Context, store AuditStore, project string, until time.Time) ([]*AttemptHistory, error) {
+	var attempts []*DeletionAttempt
+	err := sinceLastReport(ctx, `attempts/`+project, until, func(since time.Time) error {
+		list, err := store.ListAttempts(ctx, since, until)
+		if err != nil {
+			return err
+		}
+		for _, a := range list {
+			if a.Project == project {
+				attempts = append(attempts, a)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GroupAttempts(attempts), nil
+}
+
+// deletionsSinceLastReport returns the deletions in the given project
+// that were recorded since the previous check of that project, and
+// moves the cursor forward to now
+func deletionsSinceLastReport(ctx context.Context, store AuditStore, project string, now time.Time) ([]*DeletionRecord, error) {
+	var records []*DeletionRecord
+	err := sinceLastReport(ctx, `deletions/`+project, now, func(since time.Time) error {
+		list, err := store.ListDeletions(ctx, since, now)
+		if err != nil {
+			return err
+		}
+		for _, r := range list {
+			if r.Project == project {
+				records = append(records, r)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// sinceLastReport calls list with the time of the previous run report
+// recorded in the named cursor, and moves the cursor forward to now if
+// list succeeds. If there is no cursor yet, list is not called, and the
+// cursor starts at now, so that the first report does not carry the
+// whole history. list is expected to only return what was recorded
+// before now, which the next report starts from
+func sinceLastReport(ctx context.Context, name string, now time.Time, list func(time.Time) error) error {
+	key := datastore.NewKey(ctx, reportCursorKind, name, 0, nil)
+
+	var cursor reportCursor
+	switch err := datastore.Get(ctx, key, &cursor); err {
+	case nil:
+		if err := list(cursor.LastReportAt); err != nil {
+			return err
+		}
+	case datastore.ErrNoSuchEntity:
+	default:
+		return errors.Wrap(err, `failed to load report cursor`)
+	}
+
+	cursor.LastReportAt = now
+	if _, err := datastore.Put(ctx, key, &cursor); err != nil {
+		return errors.Wrap(err, `failed to save report cursor`)
+	}
+	return nil
+}
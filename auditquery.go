@@ -0,0 +1,184 @@
+package autolbclean
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Bounds of the number of events in a page of an event query
+const (
+	DefaultEventQueryLimit = 100
+	MaxEventQueryLimit     = 1000
+)
+
+// how many events are read from the store at once while a page is
+// filled. events are filtered after they are read, so a page may take
+// several batches
+const eventQueryBatchSize = 500
+
+// ParseQueryTime parses a bound of the time range of an event query,
+// which is either a point in time in RFC 3339, a date (2006-01-02) in
+// UTC, or a duration before now, as in 7d or 12h
+func ParseQueryTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(`2006-01-02`, s); err == nil {
+		return t, nil
+	}
+	d, err := ParseSnoozeDuration(s)
+	if err != nil {
+		return time.Time{}, errors.Errorf(`invalid time %q (expected RFC 3339, a date, or a duration such as 7d)`, s)
+	}
+	return now.Add(-d), nil
+}
+
+// Validate checks the filters of the query, and fills in the limit if
+// it is not set
+func (q *EventQuery) Validate() error {
+	switch q.Outcome {
+	case ``, DecisionScheduled, DecisionSkipped, DecisionDeleted, DecisionFailed, DecisionExpired:
+	default:
+		return errors.Errorf(`invalid outcome %q (expected one of %s, %s, %s, %s or %s)`, q.Outcome, DecisionScheduled, DecisionSkipped, DecisionDeleted, DecisionFailed, DecisionExpired)
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultEventQueryLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxEventQueryLimit {
+		return errors.Errorf(`limit must be between 1 and %d`, MaxEventQueryLimit)
+	}
+	if !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return errors.New(`since must be before until`)
+	}
+	if _, _, err := decodeEventCursor(q.Cursor); err != nil {
+		return err
+	}
+	return nil
+}
+
+// matches returns true if the event passes the filters of the query
+// other than its time range
+func (q *EventQuery) matches(ev *DeletionEvent) bool {
+	if len(q.Kind) > 0 && ev.Kind != q.Kind {
+		return false
+	}
+	if len(q.Outcome) > 0 && ev.Decision != q.Outcome {
+		return false
+	}
+	if len(q.Cluster) > 0 {
+		// events record the UID, or the prefix of it that the name of
+		// the resource carries, which either the full UID or a prefix
+		// of it may be queried with
+		if !MatchClusterUID(ev.Cluster, q.Cluster) && !MatchClusterUID(q.Cluster, ev.Cluster) {
+			return false
+		}
+	}
+	if q.allowed != nil && !q.allowed(&Orphan{Cluster: ev.Cluster}) {
+		return false
+	}
+	return true
+}
+
+// an event cursor is where the previous page stopped: the time of the
+// event that comes next, and how many of the events of that very time
+// came before it
+func encodeEventCursor(at time.Time, n int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`%s,%d`, at.UTC().Format(time.RFC3339Nano), n)))
+}
+
+func decodeEventCursor(s string) (time.Time, int, error) {
+	if len(s) == 0 {
+		return time.Time{}, 0, nil
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, 0, errors.New(`invalid cursor`)
+	}
+	i := strings.LastIndexByte(string(buf), ',')
+	if i < 0 {
+		return time.Time{}, 0, errors.New(`invalid cursor`)
+	}
+	at, err := time.Parse(time.RFC3339Nano, string(buf[:i]))
+	if err != nil {
+		return time.Time{}, 0, errors.New(`invalid cursor`)
+	}
+	n, err := strconv.Atoi(string(buf[i+1:]))
+	if err != nil || n < 0 {
+		return time.Time{}, 0, errors.New(`invalid cursor`)
+	}
+	return at, n, nil
+}
+
+// QueryEvents returns a page of the deletion events of the project that
+// pass the filters of the query, oldest first. The cursor of the page
+// continues the query where the page ends. It fails unless the store
+// can list events across runs
+func (app *App) QueryEvents(ctx context.Context, q *EventQuery) (*EventPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	lister, ok := app.store.(EventLister)
+	if !ok {
+		return nil, errors.New(`the store can not list deletion events across runs`)
+	}
+
+	until := q.Until
+	if until.IsZero() {
+		until = time.Now().UTC()
+	}
+
+	// pos and n track the time of the latest event that was read, and
+	// how many events of that time were read. skip is how many events of
+	// that time the previous page read already. Events of every project
+	// are counted, as the store lists them all
+	pos, skip, _ := decodeEventCursor(q.Cursor)
+	if pos.Before(q.Since) {
+		pos, skip = q.Since, 0
+	}
+	n := 0
+
+	page := &EventPage{Events: []*DeletionEvent{}}
+	for {
+		batch, err := lister.ListEventsBetween(ctx, pos, until, eventQueryBatchSize)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to list deletion events`)
+		}
+
+		for _, ev := range batch {
+			if ev.At.Equal(pos) {
+				n++
+				if n <= skip {
+					continue
+				}
+			} else {
+				pos, n, skip = ev.At, 1, 0
+			}
+			if ev.Project != app.project || !q.matches(ev) {
+				continue
+			}
+			if len(page.Events) == q.Limit {
+				page.NextCursor = encodeEventCursor(pos, n-1)
+				return page, nil
+			}
+			page.Events = append(page.Events, ev)
+		}
+
+		if len(batch) < eventQueryBatchSize {
+			return page, nil
+		}
+		// the next batch starts over at the time of the latest event,
+		// past the events of that time that were read. a batch full of
+		// events of a single time would be read over and over, so
+		// those are given up on
+		skip, n = n, 0
+		if skip >= eventQueryBatchSize {
+			pos, skip = pos.Add(time.Nanosecond), 0
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryEvents(t *testing.T) {
+	ctx := context.Background()
+	march := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	store := autolbclean.NewMemoryStore()
+	h := store.(autolbclean.HistoryStore)
+	events := []*autolbclean.DeletionEvent{
+		{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-a--c4f34d3824aedd50`, Cluster: `c4f34d3824aedd50`, Project: `p`, Decision: autolbclean.DecisionDeleted, At: march.Add(-time.Hour)},
+		{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-b--c4f34d3824aedd50`, Cluster: `c4f34d3824aedd50`, Project: `p`, Decision: autolbclean.DecisionDeleted, At: march},
+		// events of the same time are paged through one by one
+		{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-b--c4f34d3824aedd50`, Cluster: `c4f34d3824aedd50`, Project: `p`, Decision: autolbclean.DecisionDeleted, At: march},
+		{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-c--c4f34d3824aedd50`, Cluster: `c4f34d3824aedd50`, Project: `p`, Decision: autolbclean.DecisionDeleted, At: march},
+		{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-d--c4f34d3824aedd50`, Cluster: `c4f34d3824aedd50`, Project: `p`, Decision: autolbclean.DecisionFailed, At: march.Add(time.Hour)},
+		{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-e--0123456789abcdef`, Cluster: `0123456789abcdef`, Project: `p`, Decision: autolbclean.DecisionDeleted, At: march.Add(2 * time.Hour)},
+		{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-f--c4f34d3824aedd50`, Cluster: `c4f34d3824aedd50`, Project: `other`, Decision: autolbclean.DecisionDeleted, At: march.Add(3 * time.Hour)},
+		// the cluster is what the event recorded, not what the name says
+		{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-h--c4f34d3824aedd50`, Project: `p`, Decision: autolbclean.DecisionDeleted, At: march.Add(4 * time.Hour)},
+		{Kind: autolbclean.KindBackendServices, Name: `k8s1-c4f34d38-default-web-80-0a1b2c3d`, Cluster: `c4f34d38`, Project: `p`, Decision: autolbclean.DecisionDeleted, At: march.Add(5 * time.Hour)},
+		{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-g--c4f34d3824aedd50`, Cluster: `c4f34d3824aedd50`, Project: `p`, Decision: autolbclean.DecisionDeleted, At: march.AddDate(0, 1, 0)},
+	}
+	for _, ev := range events {
+		if !assert.NoError(t, h.SaveEvent(ctx, ev), `SaveEvent should succeed`) {
+			return
+		}
+	}
+
+	app, err := autolbclean.New(`p`, &http.Client{}, autolbclean.WithStore(store))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	// what was deleted for the cluster in March, two at a time
+	q := &autolbclean.EventQuery{
+		Cluster: `c4f34d3824aedd50a1b2c3d4e5f60718`,
+		Outcome: autolbclean.DecisionDeleted,
+		Since:   march,
+		Until:   march.AddDate(0, 1, 0),
+		Limit:   2,
+	}
+	var names []string
+	for i := 0; i < 3; i++ {
+		page, err := app.QueryEvents(ctx, q)
+		if !assert.NoError(t, err, `QueryEvents should succeed`) {
+			return
+		}
+		for _, ev := range page.Events {
+			names = append(names, ev.Name)
+		}
+		if len(page.NextCursor) == 0 {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if !assert.Equal(t, []string{`k8s-fw-b--c4f34d3824aedd50`, `k8s-um-b--c4f34d3824aedd50`, `k8s-um-c--c4f34d3824aedd50`, `k8s1-c4f34d38-default-web-80-0a1b2c3d`}, names, `events should match`) {
+		return
+	}
+
+	page, err := app.QueryEvents(ctx, &autolbclean.EventQuery{Kind: autolbclean.KindUrlMaps, Cluster: `c4f34d38`, Until: march.AddDate(1, 0, 0)})
+	if !assert.NoError(t, err, `QueryEvents should succeed`) || !assert.Len(t, page.Events, 4, `UID prefix should match`) || !assert.Empty(t, page.NextCursor, `last page should have no cursor`) {
+		return
+	}
+
+	for _, q := range []*autolbclean.EventQuery{
+		{Outcome: `vanished`},
+		{Limit: autolbclean.MaxEventQueryLimit + 1},
+		{Since: march, Until: march},
+		{Cursor: `not a cursor`},
+	} {
+		if _, err := app.QueryEvents(ctx, q); !assert.Error(t, err, `QueryEvents should fail for %#v`, q) {
+			return
+		}
+	}
+}
+
+func TestParseQueryTime(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	list := map[string]time.Time{
+		`2026-03-01T09:00:00+09:00`: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		`2026-03-01`:                time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		`7d`:                        now.Add(-7 * 24 * time.Hour),
+		`90m`:                       now.Add(-90 * time.Minute),
+	}
+	for s, expected := range list {
+		v, err := autolbclean.ParseQueryTime(s, now)
+		if !assert.NoError(t, err, `ParseQueryTime(%q) should succeed`, s) || !assert.True(t, expected.Equal(v), `ParseQueryTime(%q) should match`, s) {
+			return
+		}
+	}
+	if _, err := autolbclean.ParseQueryTime(`last march`, now); !assert.Error(t, err, `ParseQueryTime should fail`) {
+		return
+	}
+}
@@ -2,39 +2,159 @@ package autolbclean
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+	cloudresourcemanager "google.golang.org/api/cloudresourcemanager/v1"
 	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
 )
 
-func New(project string, oauthClient *http.Client) (*App, error) {
-	s, err := compute.New(oauthClient)
+func New(project string, oauthClient *http.Client, options ...Option) (*App, error) {
+	app := &App{
+		config:          DefaultConfig(),
+		getTimeout:      DefaultGetTimeout,
+		listTimeout:     DefaultListTimeout,
+		planMaxAge:      DefaultPlanMaxAge,
+		project:         project,
+		runID:           NewRunID(),
+		zoneConcurrency: DefaultZoneConcurrency,
+	}
+	for _, option := range options {
+		option(app)
+	}
+
+	// stores that can keep the history record every deletion event
+	if h, ok := app.store.(HistoryStore); ok {
+		app.events = append(app.events, historyPublisher{store: h})
+	}
+
+	// When rate limited, all API calls made on behalf of this App share
+	// the same limiter, independent of any other App. Retries go through
+	// the limiter as well
+	var limiter *rate.Limiter
+	if app.rateLimit > 0 {
+		limiter = newRateLimiter(app.rateLimit)
+	}
+
+	client, err := app.apiClient(oauthClient, app.impersonate, limiter)
+	if err != nil {
+		return nil, err
+	}
+	app.client = client
+
+	// mutations go through a client of their own, so that discovery can
+	// run with credentials that are not allowed to delete anything
+	app.executorClient = client
+	if len(app.executorImpersonate) > 0 {
+		ec, err := app.apiClient(oauthClient, app.executorImpersonate, limiter)
+		if err != nil {
+			return nil, err
+		}
+		app.executorClient = ec
+	}
+
+	s, err := compute.New(app.client)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to create compute.Service`)
 	}
+	app.service = s
 
-	return &App{
-		project: project,
-		service: s,
-	}, nil
-}
+	app.executor = s
+	if app.executorClient != app.client {
+		es, err := compute.New(app.executorClient)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to create compute.Service`)
+		}
+		app.executor = es
+	}
 
-// Lists HTTP(s) forwarding rules, whose names match "k8s-fw"
-func (app *App) ListIngressForwardingRules() ([]*compute.ForwardingRule, error) {
-	l, err := app.service.ForwardingRules.AggregatedList(app.project).Do()
+	cc, err := newComputeClient(app)
 	if err != nil {
-		return nil, errors.Wrap(err, `failed to list forwarding rules`)
+		return nil, errors.Wrap(err, `failed to create compute client`)
+	}
+	app.compute = cc
+
+	crm, err := cloudresourcemanager.New(app.client)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create cloudresourcemanager.Service`)
+	}
+	app.crm = crm
+
+	gke, err := container.New(app.client)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create container.Service`)
+	}
+	app.container = gke
+
+	return app, nil
+}
+
+// apiClient wraps the transport of base, calling the APIs as the given
+// service account when it is not empty
+func (app *App) apiClient(base *http.Client, serviceAccount string, limiter *rate.Limiter) (*http.Client, error) {
+	transport := base.Transport
+	if len(serviceAccount) > 0 {
+		rt := app.transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		t, err := impersonatedTransport(base, rt, serviceAccount)
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+	}
+	if h := app.apiHeaders(); len(h) > 0 {
+		transport = newHeaderTransport(transport, h)
+	}
+	if limiter != nil {
+		transport = newRateLimitedTransport(transport, limiter)
 	}
+	return &http.Client{
+		Transport: newRetryTransport(transport, app.Config),
+		Timeout:   base.Timeout,
+	}, nil
+}
+
+// getContext derives a context to be used for a single API call that
+// fetches a single resource
+func (app *App) getContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, app.getTimeout)
+}
+
+// listContext derives a context to be used for a single API call that
+// lists resources. These are given a longer timeout than gets, as
+// aggregated lists in particular can take a while
+func (app *App) listContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, app.listTimeout)
+}
+
+// Lists HTTP(s) forwarding rules, whose names match "k8s-fw", or that
+// opted into the cleanup
+func (app *App) ListIngressForwardingRules(ctx context.Context) ([]*compute.ForwardingRule, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
 
 	var result []*compute.ForwardingRule
-	for _, scopedList := range l.Items {
-		for _, fr := range scopedList.ForwardingRules {
-			if strings.HasPrefix(fr.Name, "k8s-fw") {
-				result = append(result, fr)
+	err := app.service.ForwardingRules.AggregatedList(app.project).Pages(ctx, func(l *compute.ForwardingRuleAggregatedList) error {
+		for _, scopedList := range l.Items {
+			for _, fr := range scopedList.ForwardingRules {
+				if hasAnyPrefix(fr.Name, app.Config().forwardingRulePrefixes()) || app.Config().IsManaged(fr.Labels, fr.Description) {
+					result = append(result, fr)
+				}
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list forwarding rules`)
 	}
 
 	return result, nil
@@ -71,12 +191,32 @@ func ParseTargetProxy(s string) (name string, region string, isHTTPs bool, err e
 	return
 }
 
-func (app *App) GetTargetHttpsProxy(name string) (*compute.TargetHttpsProxy, error) {
-	return app.service.TargetHttpsProxies.Get(app.project, name).Do()
+func (app *App) GetTargetHttpsProxy(ctx context.Context, name string) (*compute.TargetHttpsProxy, error) {
+	return app.getTargetHttpsProxy(ctx, globalRegion, name)
+}
+
+func (app *App) GetTargetHttpProxy(ctx context.Context, name string) (*compute.TargetHttpProxy, error) {
+	return app.getTargetHttpProxy(ctx, globalRegion, name)
+}
+
+// getTargetHttpsProxy fetches a global target https proxy, or a regional
+// one as used by internal HTTP(S) load balancers
+func (app *App) getTargetHttpsProxy(ctx context.Context, region, name string) (*compute.TargetHttpsProxy, error) {
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+	if isGlobal(region) {
+		return app.service.TargetHttpsProxies.Get(app.project, name).Context(ctx).Do()
+	}
+	return app.service.RegionTargetHttpsProxies.Get(app.project, region, name).Context(ctx).Do()
 }
 
-func (app *App) GetTargetHttpProxy(name string) (*compute.TargetHttpProxy, error) {
-	return app.service.TargetHttpProxies.Get(app.project, name).Do()
+func (app *App) getTargetHttpProxy(ctx context.Context, region, name string) (*compute.TargetHttpProxy, error) {
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+	if isGlobal(region) {
+		return app.service.TargetHttpProxies.Get(app.project, name).Context(ctx).Do()
+	}
+	return app.service.RegionTargetHttpProxies.Get(app.project, region, name).Context(ctx).Do()
 }
 
 func ParseUrlMap(s string) (name string, region string, err error) {
@@ -107,8 +247,17 @@ func ParseUrlMap(s string) (name string, region string, err error) {
 	return
 }
 
-func (app *App) GetUrlMap(name string) (*compute.UrlMap, error) {
-	return app.service.UrlMaps.Get(app.project, name).Do()
+func (app *App) GetUrlMap(ctx context.Context, name string) (*compute.UrlMap, error) {
+	return app.getUrlMap(ctx, globalRegion, name)
+}
+
+func (app *App) getUrlMap(ctx context.Context, region, name string) (*compute.UrlMap, error) {
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+	if isGlobal(region) {
+		return app.service.UrlMaps.Get(app.project, name).Context(ctx).Do()
+	}
+	return app.service.RegionUrlMaps.Get(app.project, region, name).Context(ctx).Do()
 }
 
 func parseURL(s, keyword string) (name string, region string, err error) {
@@ -143,26 +292,580 @@ func ParseService(s string) (name string, region string, err error) {
 	return parseURL(s, `backendServices`)
 }
 
-func (app *App) FindBackendServices(um *compute.UrlMap) ([]*compute.BackendService, error) {
-	var list []*compute.BackendService
+// BackendServiceURLs returns the URLs of the backend services that the
+// url map routes to, including its default services and the services of
+// route actions, without duplicates. Backend buckets are not included,
+// see BackendBucketURLs
+func BackendServiceURLs(um *compute.UrlMap) []string {
+	return urlMapBackends(um, false)
+}
+
+// BackendBucketURLs returns the URLs of the backend buckets that the
+// url map routes to, without duplicates
+func BackendBucketURLs(um *compute.UrlMap) []string {
+	return urlMapBackends(um, true)
+}
+
+func isBackendBucket(s string) bool {
+	return strings.Contains(s, `/backendBuckets/`)
+}
+
+// urlMapBackends returns either the backend buckets, or the backend
+// services that the url map routes to
+func urlMapBackends(um *compute.UrlMap, buckets bool) []string {
+	var list []string
+	seen := make(map[string]struct{})
+	add := func(u string) {
+		if len(u) == 0 || isBackendBucket(u) != buckets {
+			return
+		}
+		if _, ok := seen[u]; ok {
+			return
+		}
+		seen[u] = struct{}{}
+		list = append(list, u)
+	}
+
+	addAction := func(a *compute.HttpRouteAction) {
+		if a == nil {
+			return
+		}
+		for _, wbs := range a.WeightedBackendServices {
+			add(wbs.BackendService)
+		}
+		if a.RequestMirrorPolicy != nil {
+			add(a.RequestMirrorPolicy.BackendService)
+		}
+	}
+
+	add(um.DefaultService)
+	addAction(um.DefaultRouteAction)
 	for _, pm := range um.PathMatchers {
+		add(pm.DefaultService)
+		addAction(pm.DefaultRouteAction)
 		for _, pr := range pm.PathRules {
-			sname, region, err := ParseService(pr.Service)
-			if err != nil {
-				return nil, errors.Wrap(err, `failed to parse backend service url`)
-			}
-			_ = region
-			s, err := app.service.BackendServices.Get(app.project, sname).Do()
-			if err != nil {
-				return nil, errors.Wrap(err, `failed to get backend service`)
-			}
+			add(pr.Service)
+			addAction(pr.RouteAction)
+		}
+		for _, rr := range pm.RouteRules {
+			add(rr.Service)
+			addAction(rr.RouteAction)
+		}
+	}
+	return list
+}
 
-			list = append(list, s)
+func (app *App) FindBackendServices(ctx context.Context, um *compute.UrlMap) ([]*compute.BackendService, error) {
+	var list []*compute.BackendService
+	for _, u := range BackendServiceURLs(um) {
+		sname, region, err := ParseService(u)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to parse backend service url`)
 		}
+		s, err := app.getBackendService(ctx, region, sname)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to get backend service`)
+		}
+
+		list = append(list, s)
 	}
 	return list, nil
 }
 
+// FindOrphan walks the load balancer chain starting from the given
+// target proxy, and returns an Orphan describing it if none of its
+// backend services have any instances left. If the load balancer is
+// still in use, or if it is too new to tell, nil is returned.
+//
+// fwname and region describe the forwarding rule pointing to the
+// target proxy, and may be empty if there is none
+func (app *App) FindOrphan(ctx context.Context, fwname, region, tpname string, isHTTPs bool) (*Orphan, error) {
+	return app.findOrphan(ctx, fwname, region, tpname, isHTTPs, nil)
+}
+
+// findOrphan is FindOrphan, recording each of its checks in ex unless
+// it is nil
+func (app *App) findOrphan(ctx context.Context, fwname, region, tpname string, isHTTPs bool, ex *Explanation) (*Orphan, error) {
+	var urlMapURL string
+	var certificates []string
+	var tpName string
+	var selfLink string
+	var timestamp string
+	var description string
+	if isHTTPs {
+		tp, err := app.getTargetHttpsProxy(ctx, region, tpname)
+		if err != nil {
+			ex.fail(CheckTargetProxy, `failed to get target https proxy %s: %s`, tpname, err)
+			return nil, errors.Wrap(err, `failed to get target https proxy`)
+		}
+		tpName = tp.Name
+		selfLink = tp.SelfLink
+		certificates = tp.SslCertificates
+		urlMapURL = tp.UrlMap
+		timestamp = tp.CreationTimestamp
+		description = tp.Description
+	} else {
+		tp, err := app.getTargetHttpProxy(ctx, region, tpname)
+		if err != nil {
+			ex.fail(CheckTargetProxy, `failed to get target http proxy %s: %s`, tpname, err)
+			return nil, errors.Wrap(err, `failed to get target http proxy`)
+		}
+		tpName = tp.Name
+		selfLink = tp.SelfLink
+		urlMapURL = tp.UrlMap
+		timestamp = tp.CreationTimestamp
+		description = tp.Description
+	}
+	ex.pass(CheckTargetProxy, `found %s`, selfLink)
+
+	c := app.Config()
+	tpKind := KindTargetHttpProxies
+	if isHTTPs {
+		tpKind = KindTargetHttpsProxies
+	}
+	createdAt, _ := time.Parse(time.RFC3339, timestamp)
+	if c.isYoung(tpKind, timestamp) {
+		// if it's pretty new, that's OK. it may still be initializing,
+		// for all I care
+		ex.fail(CheckAge, `target proxy %s was created at %s, less than %s ago`, tpName, timestamp, c.AgeThresholdOf(tpKind))
+		return nil, nil
+	}
+
+	umname, umregion, err := ParseUrlMap(urlMapURL)
+	if err != nil {
+		ex.fail(CheckUrlMap, `failed to parse url map %s: %s`, urlMapURL, err)
+		return nil, errors.Wrap(err, `failed to parse url map selflink`)
+	}
+
+	um, err := app.getUrlMap(ctx, umregion, umname)
+	if err != nil {
+		ex.fail(CheckUrlMap, `failed to get url map %s: %s`, umname, err)
+		return nil, errors.Wrap(err, `failed to get url map`)
+	}
+	ex.pass(CheckUrlMap, `found %s`, um.SelfLink)
+	if c.isYoung(KindUrlMaps, um.CreationTimestamp) {
+		ex.fail(CheckAge, `url map %s was created at %s, less than %s ago`, umname, um.CreationTimestamp, c.AgeThresholdOf(KindUrlMaps))
+		return nil, nil
+	}
+
+	// backend buckets serve from storage, and have no instances that
+	// could tell us whether they are still in use
+	if buckets := BackendBucketURLs(um); len(buckets) > 0 {
+		ex.fail(CheckBackendServices, `url map %s routes to %d backend buckets, which are never considered unused`, umname, len(buckets))
+		for _, bucket := range buckets {
+			ex.addResource(bucket)
+		}
+		return nil, nil
+	}
+
+	services, err := app.FindBackendServices(ctx, um)
+	if err != nil {
+		ex.fail(CheckBackendServices, `failed to find backend services: %s`, err)
+		return nil, errors.Wrap(err, `failed to find backend services`)
+	}
+	ex.pass(CheckBackendServices, `found %d backend services`, len(services))
+	for _, service := range services {
+		ex.addResource(service.SelfLink)
+		if c.isYoung(KindBackendServices, service.CreationTimestamp) {
+			ex.fail(CheckAge, `backend service %s was created at %s, less than %s ago`, service.Name, service.CreationTimestamp, c.AgeThresholdOf(KindBackendServices))
+			return nil, nil
+		}
+	}
+	ex.pass(CheckAge, `the target proxy, the url map and the backend services are older than their age thresholds`)
+
+	var total int
+	for _, service := range services {
+		instances, err := app.ListInstancesForService(ctx, service)
+		if err != nil {
+			ex.fail(CheckInstances, `failed to list instances of backend service %s: %s`, service.Name, err)
+			return nil, errors.Wrap(err, `failed to list instances for service`)
+		}
+		total = total + len(instances)
+	}
+
+	// Cowardly refuse to delete resources if at least 1 instance
+	// exist somewhere
+	if total > 0 {
+		ex.fail(CheckInstances, `%d instances are behind the backend services`, total)
+		ex.setCount(total)
+		return nil, nil
+	}
+	ex.pass(CheckInstances, `no instances are behind the backend services`)
+	ex.setCount(0)
+
+	// Listing instances does not see network endpoint groups, and
+	// failures to list are ignored, so optionally double check with
+	// the health of the backends
+	if hc := c.HealthEmptiness; hc.Enabled {
+		switch app.backendsHealth(ctx, services, hc) {
+		case healthEmpty:
+			ex.pass(CheckEndpoints, `the health of the backends reports no endpoints`)
+		case healthInUse:
+			ex.fail(CheckEndpoints, `a backend reports endpoints in its health`)
+			return nil, nil
+		default:
+			ex.fail(CheckEndpoints, `the health of some backends could not be told`)
+			return nil, nil
+		}
+	}
+
+	// a single resource that opted out keeps the whole load balancer
+	if c.IsProtected(nil, description) || c.IsProtected(nil, um.Description) {
+		ex.fail(CheckProtection, `the target proxy or the url map opted out of the cleanup`)
+		return nil, nil
+	}
+	for _, service := range services {
+		if c.IsProtected(nil, service.Description) {
+			ex.fail(CheckProtection, `backend service %s opted out of the cleanup`, service.Name)
+			return nil, nil
+		}
+	}
+	if app.certificatesHeldBack(ctx, certificates) {
+		ex.fail(CheckProtection, `a certificate opted out of the cleanup, is too young, or could not be looked up`)
+		return nil, nil
+	}
+	ex.pass(CheckProtection, `none of the resources opted out of the cleanup`)
+
+	healthChecks, err := app.FindHealthChecks(ctx, services)
+	if err != nil {
+		ex.fail(CheckHealthChecks, `failed to find health checks: %s`, err)
+		return nil, errors.Wrap(err, `failed to find health checks`)
+	}
+	ex.pass(CheckHealthChecks, `found %d health checks`, len(healthChecks))
+
+	return &Orphan{
+		Cluster:         c.ClusterOf(tpName),
+		ForwardingRule:  fwname,
+		Region:          region,
+		TargetProxy:     tpName,
+		IsHTTPs:         isHTTPs,
+		SelfLink:        selfLink,
+		UrlMap:          umname,
+		Certificates:    certificates,
+		BackendServices: services,
+		HealthChecks:    healthChecks,
+		CreatedAt:       createdAt,
+		NoEndpoints:     c.HealthEmptiness.Enabled,
+	}, nil
+}
+
+type readOnlyKey struct{}
+
+// PreviewOrphans is FindOrphans without persisting anything: neither
+// the plan, nor the inventory counts, nor since when network endpoint
+// groups have been empty. It is meant for the endpoints that only show
+// the orphans, so that looking at them does not shift the baselines
+// that the runs that delete them are checked against
+func (app *App) PreviewOrphans(ctx context.Context) ([]*Orphan, error) {
+	return app.FindOrphans(context.WithValue(ctx, readOnlyKey{}, true))
+}
+
+// isReadOnly returns true if the context belongs to PreviewOrphans
+func isReadOnly(ctx context.Context) bool {
+	v, _ := ctx.Value(readOnlyKey{}).(bool)
+	return v
+}
+
+// FindOrphans checks all of the load balancers created by GKE ingresses,
+// and returns the ones that are orphaned. If a PlanStore is configured,
+// the plan is persisted after each load balancer is checked
+func (app *App) FindOrphans(ctx context.Context) ([]*Orphan, error) {
+	orphans, _, err := app.findOrphans(ctx)
+	return orphans, err
+}
+
+// findOrphans is FindOrphans, and also returns how many load balancers
+// could not be checked. The orphans among those are missing from the
+// result, so a run that has any can not be considered clean
+func (app *App) findOrphans(ctx context.Context) ([]*Orphan, int, error) {
+	c := app.Config()
+	plan, err := app.startPlan(ctx)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, `failed to start plan`)
+	}
+
+	// a complete plan means that the previous run died while deleting,
+	// so there is nothing left to discover. A plan with load balancers
+	// that could not be checked is not complete, so that resuming it
+	// checks them again
+	if !plan.Complete {
+		if err := app.discoverOrphans(ctx, c, plan); err != nil {
+			return nil, 0, err
+		}
+		if plan.unchecked == 0 {
+			plan.Complete = true
+			app.savePlan(ctx, plan)
+		}
+	}
+
+	// what a previous run found is checked again, as it may be stale
+	orphans := plan.Orphans
+	if plan.resumed > 0 {
+		orphans = append(app.reverifyOrphans(ctx, orphans[:plan.resumed]), orphans[plan.resumed:]...)
+	}
+
+	orphans, err = app.filterOrphans(ctx, orphans, nil)
+	return orphans, plan.unchecked, err
+}
+
+// orphanFilter is one of the steps that the orphans found by discovery
+// go through before they are deleted. Each step drops the orphans that
+// it keeps from being deleted
+type orphanFilter struct {
+	check string // the check that explanations record the step as
+	pass  string // what explanations say when the orphan is kept
+	fail  string // what explanations say when the orphan is dropped
+	run   func(app *App, ctx context.Context, c *Config, orphans []*Orphan) ([]*Orphan, error)
+}
+
+// orphanFilters returns the steps that apply with the configuration, in
+// the order they are made
+func orphanFilters(c *Config) []*orphanFilter {
+	list := []*orphanFilter{
+		// the groups are tracked before anything else is dropped, so
+		// that the time they have been empty for is not reset by a
+		// snooze
+		{
+			check: CheckNEGEmptiness,
+			pass:  `its network endpoint groups, if any, have been empty for long enough, and their clusters are gone`,
+			fail:  `its network endpoint groups have not been empty for long enough, or their clusters still exist`,
+			run: func(app *App, ctx context.Context, _ *Config, orphans []*Orphan) ([]*Orphan, error) {
+				return app.skipFreshNEGs(ctx, orphans)
+			},
+		},
+		// deleting only part of a load balancer would leave it broken
+		{
+			check: CheckExclusions,
+			pass:  `none of its resources is excluded`,
+			fail:  `one of its resources matches the exclusions or the suppressions`,
+			run: func(_ *App, _ context.Context, c *Config, orphans []*Orphan) ([]*Orphan, error) {
+				var result []*Orphan
+				for _, o := range orphans {
+					if !o.IsExcluded(c) {
+						result = append(result, o)
+					}
+				}
+				return result, nil
+			},
+		},
+		{
+			check: CheckSnooze,
+			pass:  `it is not snoozed`,
+			fail:  `it is snoozed`,
+			run: func(_ *App, _ context.Context, c *Config, orphans []*Orphan) ([]*Orphan, error) {
+				return ApplySnoozes(orphans, c.Snoozes, time.Now()), nil
+			},
+		},
+	}
+	if c.UpgradeAwareness {
+		list = append(list, &orphanFilter{
+			check: CheckUpgrades,
+			pass:  `no GKE upgrade is in progress in its zones`,
+			fail:  `a GKE upgrade is in progress in one of its zones`,
+			run: func(app *App, ctx context.Context, _ *Config, orphans []*Orphan) ([]*Orphan, error) {
+				return app.skipUpgrading(ctx, orphans)
+			},
+		})
+	}
+	if c.ClusterCrossCheck {
+		list = append(list, &orphanFilter{
+			check: CheckLiveClusters,
+			pass:  `its cluster does not exist anymore, or it can not be tied to one`,
+			fail:  `its cluster still exists`,
+			run: func(app *App, ctx context.Context, _ *Config, orphans []*Orphan) ([]*Orphan, error) {
+				result, err := app.skipLiveClusters(ctx, orphans)
+				return result, errors.Wrap(err, `failed to cross-check GKE clusters`)
+			},
+		})
+	}
+	if c.MultiClusterIngress.Enabled {
+		list = append(list, &orphanFilter{
+			check: CheckMultiCluster,
+			pass:  `no multi cluster ingress owns it`,
+			fail:  `a multi cluster ingress still owns it`,
+			run: func(app *App, ctx context.Context, _ *Config, orphans []*Orphan) ([]*Orphan, error) {
+				return app.skipOwnedMultiCluster(ctx, orphans), nil
+			},
+		})
+	}
+	return list
+}
+
+// filterOrphans runs the orphans through the steps of orphanFilters, and
+// then scores them and applies the policies to them. If ex is not nil,
+// each step is recorded in it as well
+func (app *App) filterOrphans(ctx context.Context, orphans []*Orphan, ex *Explanation) ([]*Orphan, error) {
+	c := app.Config()
+	for _, f := range orphanFilters(c) {
+		result, err := f.run(app, ctx, c, orphans)
+		if err != nil {
+			ex.fail(f.check, `%s`, err)
+			return nil, err
+		}
+		if len(result) < len(orphans) {
+			ex.fail(f.check, `%s`, f.fail)
+		} else {
+			ex.pass(f.check, `%s`, f.pass)
+		}
+		orphans = result
+	}
+	sortOrphans(orphans)
+
+	// the heuristics found the orphans already, cluster notifications
+	// only make them more certain
+	_ = app.markDeletedClusters(ctx, orphans)
+	if c.Confidence.Enabled {
+		app.scoreOrphans(ctx, orphans)
+	}
+	// policies see the confidence of the orphans, so they come last
+	app.applyPolicies(orphans)
+	return orphans, nil
+}
+
+// discoverOrphans checks the load balancers that have not been checked
+// yet according to the plan, and records the orphans in it. The load
+// balancers that could not be checked, including the ones it did not
+// get to within the discovery timeout, are counted in the plan
+func (app *App) discoverOrphans(ctx context.Context, c *Config, plan *Plan) error {
+	// the plan is saved with the context of the run, as it must
+	// survive the timeout
+	saveCtx := ctx
+	if app.discoveryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, app.discoveryTimeout)
+		defer cancel()
+	}
+
+	var fwrs []*compute.ForwardingRule
+	err := app.checkInventory(ctx, KindForwardingRules, func() (int, error) {
+		var err error
+		fwrs, err = app.ListIngressForwardingRules(ctx)
+		return len(fwrs), errors.Wrap(err, `failed to list ingress forwarding rules`)
+	})
+	if err != nil {
+		return err
+	}
+
+	check := func(key, fwname, region, tpname string, isHTTPs, managed bool, fwr *compute.ForwardingRule) {
+		if plan.isChecked(key) {
+			return
+		}
+		if ctx.Err() != nil {
+			plan.unchecked++
+			return
+		}
+
+		// a failure to check one load balancer should not prevent us
+		// from checking the rest, but it should be checked again if we
+		// resume this plan
+		o, err := app.FindOrphan(ctx, fwname, region, tpname, isHTTPs)
+		if err != nil {
+			warningf(ctx, "Failed to check load balancer %s (region = %s), leaving it for the next run: %s", key, region, err)
+			plan.unchecked++
+			return
+		}
+		if o != nil {
+			o.Managed = managed
+			if fwr != nil {
+				o.setForwardingRule(fwr, c)
+			}
+		}
+		plan.record(key, o)
+		app.savePlan(saveCtx, plan)
+	}
+
+	seenHttpProxies := make(map[string]struct{})
+	seenHttpsProxies := make(map[string]struct{})
+	for _, fwr := range fwrs {
+		tpname, region, isHTTPs, err := ParseTargetProxy(fwr.Target)
+		if err != nil {
+			continue
+		}
+
+		if isHTTPs {
+			seenHttpsProxies[region+`/`+tpname] = struct{}{}
+		} else {
+			seenHttpProxies[region+`/`+tpname] = struct{}{}
+		}
+
+		// the target proxy is not checked on its own either, as that
+		// would take the rest of the load balancer down
+		if c.IsProtected(fwr.Labels, fwr.Description) {
+			continue
+		}
+
+		check(planKey(KindForwardingRules, region, fwr.Name), fwr.Name, region, tpname, isHTTPs, c.IsManaged(fwr.Labels, fwr.Description), fwr)
+	}
+
+	// We're done checking for load balancers that have a forwarding rule,
+	// but we may have target proxies without load balancers, which were
+	// created by GKE, both global and regional
+	httpProxies, err := app.listAllTargetHttpProxies(ctx)
+	if err != nil {
+		// the proxies without a forwarding rule can not be told apart,
+		// so they count as one load balancer that could not be checked
+		warningf(ctx, "Failed to list target HTTP proxies, leaving the ones without a forwarding rule for the next run: %s", err)
+		plan.unchecked++
+	}
+	for _, tp := range httpProxies {
+		managed := c.IsManaged(nil, tp.Description)
+		if !hasAnyPrefix(tp.Name, c.targetProxyPrefixes()) && !managed {
+			continue
+		}
+		_, region, _, err := ParseTargetProxy(tp.SelfLink)
+		if err != nil {
+			continue
+		}
+		if _, ok := seenHttpProxies[region+`/`+tp.Name]; !ok {
+			check(planKey(KindTargetHttpProxies, region, tp.Name), "", region, tp.Name, false, managed, nil)
+		}
+	}
+	httpsProxies, err := app.listAllTargetHttpsProxies(ctx)
+	if err != nil {
+		warningf(ctx, "Failed to list target HTTPS proxies, leaving the ones without a forwarding rule for the next run: %s", err)
+		plan.unchecked++
+	}
+	for _, tp := range httpsProxies {
+		managed := c.IsManaged(nil, tp.Description)
+		if !hasAnyPrefix(tp.Name, c.targetProxyPrefixes()) && !managed {
+			continue
+		}
+		_, region, _, err := ParseTargetProxy(tp.SelfLink)
+		if err != nil {
+			continue
+		}
+		if _, ok := seenHttpsProxies[region+`/`+tp.Name]; !ok {
+			check(planKey(KindTargetHttpsProxies, region, tp.Name), "", region, tp.Name, true, managed, nil)
+		}
+	}
+
+	if ctx.Err() == context.DeadlineExceeded && saveCtx.Err() == nil {
+		warningf(saveCtx, "Discovery did not finish within %s, %d load balancers are left for the next run", app.discoveryTimeout, plan.unchecked)
+	}
+	return nil
+}
+
+// setForwardingRule records what the orphan inherits from the
+// forwarding rule that points to it
+func (o *Orphan) setForwardingRule(fwr *compute.ForwardingRule, c *Config) {
+	o.Labels = fwr.Labels
+	o.Namespace = KubernetesNamespace(fwr.Description)
+	o.IPAddress = fwr.IPAddress
+	o.Scheme = fwr.LoadBalancingScheme
+	o.Managed = c.IsManaged(fwr.Labels, fwr.Description)
+}
+
+// IsExcluded returns true if any of the resources that make up the
+// orphaned load balancer is excluded by the configuration
+func (o *Orphan) IsExcluded(c *Config) bool {
+	for _, d := range o.Deletions() {
+		if c.IsExcluded(d.Name) {
+			return true
+		}
+	}
+	return false
+}
+
 func ParseInstanceGroup(s string) (name string, zone string, err error) {
 	var pos int
 	if i := strings.Index(s, `/instanceGroups`); i >= 0 {
@@ -191,31 +894,93 @@ func ParseInstanceGroup(s string) (name string, zone string, err error) {
 	return
 }
 
-func (app *App) ListInstancesForService(s *compute.BackendService) ([]string, error) {
+// ParseNetworkEndpointGroup parses the URL of a network endpoint group.
+// For zonal groups, zone is the zone. For regional and global groups
+// it is the region, or "global"
+func ParseNetworkEndpointGroup(s string) (name string, zone string, err error) {
+	return parseURL(s, `networkEndpointGroups`)
+}
+
+func isNetworkEndpointGroup(s string) bool {
+	return strings.Contains(s, `/networkEndpointGroups/`)
+}
+
+// ListInstancesForService lists the instances and network endpoints
+// that the backends of the service send traffic to
+func (app *App) ListInstancesForService(ctx context.Context, s *compute.BackendService) ([]string, error) {
 	var list []string
 	for _, backend := range s.Backends {
+		if isNetworkEndpointGroup(backend.Group) {
+			endpoints, err := app.listNetworkEndpoints(ctx, backend.Group)
+			if err != nil {
+				return nil, errors.Wrap(err, `failed to list network endpoints`)
+			}
+			list = append(list, endpoints...)
+			continue
+		}
+
 		name, zone, err := ParseInstanceGroup(backend.Group)
 		if err != nil {
 			return nil, errors.Wrap(err, `failed to parse instance group url`)
 		}
 
-		instances, err := app.service.InstanceGroups.ListInstances(app.project, zone, name,
-			&compute.InstanceGroupsListInstancesRequest{
-				InstanceState: "ALL",
-			},
-		).Do()
-		// For this operation, we ignore errors
+		// a group that could not be listed is not known to be empty, so
+		// the load balancer is not considered orphaned. Only a group that
+		// is gone has no instances for sure
+		instances, err := app.listInstanceGroupInstances(ctx, zone, name)
 		if err != nil {
-			continue
+			if isNotFound(err) {
+				continue
+			}
+			return nil, errors.Wrapf(err, `failed to list instances of instance group %s`, name)
 		}
 
-		for _, instance := range instances.Items {
+		for _, instance := range instances {
 			list = append(list, instance.Instance)
 		}
 	}
 	return list, nil
 }
 
+// listNetworkEndpoints returns the endpoints of the given network
+// endpoint group, as instance URLs or ip:port. Only zonal groups, which
+// is what container-native load balancing uses, can be listed. Regional
+// and global groups (serverless and internet NEGs) point to resources
+// we know nothing about, so they are reported as having an endpoint
+// to keep their load balancer from being considered empty
+func (app *App) listNetworkEndpoints(ctx context.Context, group string) ([]string, error) {
+	name, zone, err := ParseNetworkEndpointGroup(group)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse network endpoint group url`)
+	}
+
+	if !strings.Contains(group, `/zones/`) {
+		return []string{group}, nil
+	}
+
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []string
+	err = app.service.NetworkEndpointGroups.ListNetworkEndpoints(app.projectOf(group), zone, name,
+		&compute.NetworkEndpointGroupsListEndpointsRequest{},
+	).Pages(ctx, func(l *compute.NetworkEndpointGroupsListNetworkEndpoints) error {
+		for _, item := range l.Items {
+			ep := item.NetworkEndpoint
+			if ep == nil {
+				continue
+			}
+			if len(ep.Instance) > 0 {
+				list = append(list, ep.Instance)
+			} else {
+				list = append(list, fmt.Sprintf(`%s:%d`, ep.IpAddress, ep.Port))
+			}
+		}
+		return nil
+	})
+	return list, err
+}
+
 func ParseSslCertificates(s string) (name string, region string, err error) {
 	return parseURL(s, `sslCertificates`)
 }
@@ -224,21 +989,168 @@ func ParseBackendServices(s string) (name string, region string, err error) {
 	return parseURL(s, `backendServices`)
 }
 
+func ParseAddresses(s string) (name string, region string, err error) {
+	return parseURL(s, `addresses`)
+}
+
 func ParseHealthChecks(s string) (name string, region string, err error) {
 	return parseURL(s, `healthChecks`)
 }
 
-func (app *App) ListDanglingFirewalls(ctx context.Context) ([]*compute.Firewall, error) {
-	firewalls, err := app.service.Firewalls.List(app.project).Do()
+var healthCheckKinds = []string{
+	`healthChecks`,
+	`httpHealthChecks`,
+	`httpsHealthChecks`,
+}
+
+// ParseHealthCheckRef parses a health check reference as found in
+// BackendService.HealthChecks. Health checks generated from BackendConfig
+// CRDs do not follow the k8s-* naming, and the reference may point to
+// any of the healthChecks, httpHealthChecks or httpsHealthChecks
+// collections, so we need to know which kind it is in order to delete it
+func ParseHealthCheckRef(s string) (*HealthCheckRef, error) {
+	for _, kind := range healthCheckKinds {
+		name, region, err := parseURL(s, kind)
+		if err != nil {
+			continue
+		}
+		return &HealthCheckRef{
+			Kind:     kind,
+			Name:     name,
+			Region:   region,
+			SelfLink: s,
+		}, nil
+	}
+	return nil, errors.Errorf(`failed to find health check keyword in %s`, s)
+}
+
+// FindHealthChecks returns the list of health checks referenced by
+// the given backend services that are not also in use by some other
+// backend service, and whose names may be deleted. Custom health checks
+// can be shared, and we only want to delete them once the last service
+// that owns them goes away
+func (app *App) FindHealthChecks(ctx context.Context, services []*compute.BackendService) ([]*HealthCheckRef, error) {
+	owners := make(map[string]struct{})
+	for _, service := range services {
+		owners[service.SelfLink] = struct{}{}
+	}
+
+	candidates := make(map[string]*HealthCheckRef)
+	var list []*HealthCheckRef
+	for _, service := range services {
+		for _, hc := range service.HealthChecks {
+			if _, ok := candidates[hc]; ok {
+				continue
+			}
+
+			ref, err := ParseHealthCheckRef(hc)
+			if err != nil {
+				return nil, errors.Wrap(err, `failed to parse health check url`)
+			}
+			candidates[hc] = ref
+			list = append(list, ref)
+		}
+	}
+
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	services, err := app.listBackendServices(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, `failed to list firewall rules`)
+		return nil, errors.Wrap(err, `failed to list backend services`)
 	}
 
+	inUse := make(map[string]struct{})
+	for _, service := range services {
+		if _, ok := owners[service.SelfLink]; ok {
+			continue
+		}
+		for _, hc := range service.HealthChecks {
+			inUse[hc] = struct{}{}
+		}
+	}
+
+	// custom health checks are only deleted when name_patterns lists
+	// their names, as nothing else may delete them. They are left out
+	// of the chain rather than have their delete jobs refused
+	c := app.Config()
+	var result []*HealthCheckRef
+	for _, ref := range list {
+		if _, ok := inUse[ref.SelfLink]; ok {
+			continue
+		}
+		if !c.IsDeletableName(ref.Kind, ref.Name) {
+			debugf(ctx, `Leaving %s %s alone: name does not match any of the expected patterns`, ref.Kind, ref.Name)
+			continue
+		}
+		result = append(result, ref)
+	}
+	return result, nil
+}
+
+func (e *ZoneScanError) Error() string {
+	zones := make([]string, 0, len(e.Zones))
+	for zone := range e.Zones {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	return fmt.Sprintf(`failed to list instances in %d zones (%s): %d tags may still be in use`, len(zones), strings.Join(zones, `, `), len(e.Unknown))
+}
+
+// IsZoneScanError returns true if err is the error of a scan of
+// instances that failed in some of the zones
+func IsZoneScanError(err error) bool {
+	_, ok := errors.Cause(err).(*ZoneScanError)
+	return ok
+}
+
+// ListDanglingFirewalls returns the firewall rules that target tags
+// that no instance carries. If the instances of some of the zones could
+// not be listed, the rules that are dangling nonetheless are returned
+// along with a *ZoneScanError that lists the tags that may be in use in
+// those zones
+func (app *App) ListDanglingFirewalls(ctx context.Context) ([]*compute.Firewall, error) {
+	var firewalls []*compute.Firewall
+	if err := app.checkInventory(ctx, KindFirewalls, func() (int, error) {
+		var err error
+		firewalls, err = app.listFirewalls(ctx)
+		return len(firewalls), errors.Wrap(err, `failed to list firewall rules`)
+	}); err != nil {
+		return nil, err
+	}
+
+	c := app.Config()
+	var clusters []*container.Cluster
+	if c.ClusterCrossCheck {
+		var err error
+		if clusters, err = app.liveClusters(ctx); err != nil {
+			return nil, errors.Wrap(err, `failed to cross-check GKE clusters`)
+		}
+	}
+
+	tagPrefixes := c.firewallTagPrefixes()
 	tags2fws := make(map[string][]*compute.Firewall)
-	for _, fw := range firewalls.Items {
+	for _, fw := range firewalls {
+		if c.IsExcluded(fw.Name) || c.IsProtected(nil, fw.Description) {
+			continue
+		}
+		// the nodes of a live cluster may all be gone for a while, e.g.
+		// when its node pools are scaled to zero
+		if c.ownedByLiveCluster(fw.Name, clusters) || targetsLiveCluster(fw, clusters) {
+			continue
+		}
+		// the delete job would refuse it anyway
+		if !c.IsDeletableName(KindFirewalls, fw.Name) {
+			continue
+		}
+		if sweepPolicyKeeps(ctx, c, sweptResource(KindFirewalls, fw.Name, globalRegion, ``, fw.CreationTimestamp), nil) {
+			continue
+		}
+
 		// We only care about gke-* tags
 		for _, tag := range fw.TargetTags {
-			if !strings.HasPrefix(tag, `gke-`) {
+			if !hasAnyPrefix(tag, tagPrefixes) {
 				continue
 			}
 
@@ -246,41 +1158,502 @@ func (app *App) ListDanglingFirewalls(ctx context.Context) ([]*compute.Firewall,
 		}
 	}
 
+	if c.AutoprovisioningAwareness {
+		if err := app.keepAutoprovisionedTags(ctx, tags2fws); err != nil {
+			return nil, errors.Wrap(err, `failed to check for auto-provisioned clusters`)
+		}
+	}
+
+	if c.UpgradeAwareness {
+		if err := app.keepUpgradingTags(ctx, tags2fws); err != nil {
+			return nil, errors.Wrap(err, `failed to check for GKE upgrades`)
+		}
+	}
+
+	// If we have a recent index of the tags attached to instances, use it
+	// to avoid scanning all of the instances again
+	if app.applyTagIndex(ctx, tags2fws) {
+		return collectFirewalls(tags2fws), nil
+	}
+
 	// Now we have the list of firewalls that are referenced by a particular tag
 	// next, find the list of gke nodes and their tags
 	// we need to know the zones
-	zones, err := app.service.Zones.List(app.project).Do()
+	zones, err := app.listZones(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, `faild to list zones`)
 	}
 
-	for _, zone := range zones.Items {
-		// if we don't have any more tags to check for, we're done
-		if len(tags2fws) == 0 {
-			break
-		}
+	idx := &InstanceTagIndex{
+		Tags:      make(map[string]int),
+		CreatedAt: time.Now().UTC(),
+	}
+	err = app.resolveInstanceTags(ctx, zones, tags2fws, idx)
+	if err != nil && !IsZoneScanError(err) {
+		return nil, errors.Wrap(err, `failed to resolve instance tags`)
+	}
 
-		instances, err := app.service.Instances.List(app.project, zone.Name).Do()
-		if err != nil {
-			return nil, errors.Wrap(err, `failed to list instances`)
+	// the tags found in the zones that could be scanned are still
+	// worth remembering, but the index is not complete
+	app.saveTagIndex(ctx, idx)
+	if err != nil {
+		// only the tags that may be in use in the zones that failed are
+		// unknown. The rules of the other tags are dangling all the same
+		zerr := errors.Cause(err).(*ZoneScanError)
+		zerr.Unknown = app.holdTagsOfZones(ctx, zerr.Zones, tags2fws)
+		return collectFirewalls(tags2fws), zerr
+	}
+
+	return collectFirewalls(tags2fws), nil
+}
+
+// collectFirewalls returns the firewall rules in tags2fws. A rule that
+// targets several of the tags is only returned once
+func collectFirewalls(tags2fws map[string][]*compute.Firewall) []*compute.Firewall {
+	seen := make(map[string]struct{})
+	var ret []*compute.Firewall
+	for _, fws := range tags2fws {
+		for _, fw := range fws {
+			if _, ok := seen[fw.Name]; ok {
+				continue
+			}
+			seen[fw.Name] = struct{}{}
+			ret = append(ret, fw)
 		}
-		for _, instance := range instances.Items {
-			for _, tag := range instance.Tags.Items {
-				if !strings.HasPrefix(tag, `gke-`) {
+	}
+	sortFirewalls(ret)
+
+	return ret
+}
+
+// resolveInstanceTags scans the instances in each zone concurrently,
+// and removes the tags that are attached to at least one instance from
+// tags2fws. As soon as all of the tags have been accounted for, the
+// remaining zones are no longer scanned, as they can't change the outcome.
+//
+// A zone whose instances can not be listed does not stop the scan of
+// the other zones. If any tags are left unaccounted for after that, a
+// *ZoneScanError is returned, as they may be in use in the failed zones.
+//
+// The tags found along the way are recorded in idx, which is marked as
+// complete only if all of the zones were scanned
+func (app *App) resolveInstanceTags(ctx context.Context, zones []*compute.Zone, tags2fws map[string][]*compute.Firewall, idx *InstanceTagIndex) error {
+	if len(tags2fws) == 0 || len(zones) == 0 {
+		idx.Complete = len(zones) == 0
+		return nil
+	}
+
+	parentCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tagPrefixes := app.Config().firewallTagPrefixes()
+
+	var mu sync.Mutex
+	zoneErrs := make(map[string]error)
+	var scanned int
+	zoneCh := make(chan string)
+	var wg sync.WaitGroup
+
+	concurrency := app.zoneConcurrency
+	if concurrency <= 0 || concurrency > len(zones) {
+		concurrency = len(zones)
+	}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for zone := range zoneCh {
+				instances, err := app.listInstances(ctx, zone)
+				mu.Lock()
+				if err != nil {
+					// errors caused by cancelling the scan are not errors
+					// of the zone
+					if ctx.Err() == nil {
+						zoneErrs[zone] = err
+					}
+					mu.Unlock()
 					continue
 				}
 
-				delete(tags2fws, tag)
+				for _, instance := range instances {
+					if instance.Tags == nil {
+						continue
+					}
+					for _, tag := range instance.Tags.Items {
+						if !hasAnyPrefix(tag, tagPrefixes) {
+							continue
+						}
+
+						idx.Tags[tag]++
+						delete(tags2fws, tag)
+					}
+				}
+				scanned++
+
+				// if we don't have any more tags to check for, we're done
+				if len(tags2fws) == 0 {
+					cancel()
+				}
+				mu.Unlock()
 			}
+		}()
+	}
+
+	for _, zone := range zones {
+		select {
+		case <-ctx.Done():
+		case zoneCh <- zone.Name:
+			continue
 		}
+		break
 	}
+	close(zoneCh)
+	wg.Wait()
 
-	var ret []*compute.Firewall
-	for _, fws := range tags2fws {
-		for _, fw := range fws {
-			ret = append(ret, fw)
+	idx.Complete = scanned == len(zones)
+
+	// if we were cancelled from the outside, we did not get to scan
+	// all of the zones, and the remaining tags can't be trusted
+	if err := parentCtx.Err(); err != nil && len(tags2fws) > 0 {
+		return errors.Wrap(err, `scan of instances was interrupted`)
+	}
+
+	if len(zoneErrs) > 0 && len(tags2fws) > 0 {
+		unknown := make([]string, 0, len(tags2fws))
+		for tag := range tags2fws {
+			unknown = append(unknown, tag)
+		}
+		sort.Strings(unknown)
+		return &ZoneScanError{Zones: zoneErrs, Unknown: unknown}
+	}
+	return nil
+}
+
+// holdTagsOfZones removes the tags that may be in use in the given zones
+// from tags2fws, and returns them. Those are the node tags of the GKE
+// clusters that have nodes in any of the zones, and the tags that are
+// not the node tags of a GKE cluster at all. The node tags of clusters
+// that no longer exist are not held, as their nodes went away with them.
+// If the clusters can not be listed, every tag is held
+func (app *App) holdTagsOfZones(ctx context.Context, zones map[string]error, tags2fws map[string][]*compute.Firewall) []string {
+	clusters, err := app.liveClusters(ctx)
+	if err != nil {
+		warningf(ctx, `Failed to list GKE clusters, keeping the firewall rules of all the remaining tags: %s`, err)
+	}
+
+	held := []string{}
+	for tag := range tags2fws {
+		if err == nil && strings.HasPrefix(tag, `gke-`) {
+			cluster := nodeTagCluster(tag, clusters)
+			if cluster == nil || !clusterInZones(cluster, zones) {
+				continue
+			}
 		}
+		held = append(held, tag)
+		delete(tags2fws, tag)
 	}
+	sort.Strings(held)
+	return held
+}
+
+func (app *App) getBackendService(ctx context.Context, region, name string) (*compute.BackendService, error) {
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+	if isGlobal(region) {
+		return app.service.BackendServices.Get(app.project, name).Context(ctx).Do()
+	}
+	return app.service.RegionBackendServices.Get(app.project, region, name).Context(ctx).Do()
+}
+
+func (app *App) listInstanceGroupInstances(ctx context.Context, zone, name string) ([]*compute.InstanceWithNamedPorts, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.InstanceWithNamedPorts
+	err := app.service.InstanceGroups.ListInstances(app.project, zone, name,
+		&compute.InstanceGroupsListInstancesRequest{
+			InstanceState: "ALL",
+		},
+	).Pages(ctx, func(l *compute.InstanceGroupsListInstances) error {
+		list = append(list, l.Items...)
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listZones(ctx context.Context) ([]*compute.Zone, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.Zone
+	err := app.service.Zones.List(app.project).Pages(ctx, func(l *compute.ZoneList) error {
+		list = append(list, l.Items...)
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listInstances(ctx context.Context, zone string) ([]*compute.Instance, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.Instance
+	err := app.service.Instances.List(app.project, zone).Pages(ctx, func(l *compute.InstanceList) error {
+		list = append(list, l.Items...)
+		return nil
+	})
+	return list, err
+}
+
+// listAllTargetHttpProxies lists both the global and the regional target
+// http proxies
+func (app *App) listAllTargetHttpProxies(ctx context.Context) ([]*compute.TargetHttpProxy, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.TargetHttpProxy
+	err := app.service.TargetHttpProxies.AggregatedList(app.project).Pages(ctx, func(l *compute.TargetHttpProxyAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.TargetHttpProxies...)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// listAllTargetHttpsProxies lists both the global and the regional
+// target https proxies
+func (app *App) listAllTargetHttpsProxies(ctx context.Context) ([]*compute.TargetHttpsProxy, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.TargetHttpsProxy
+	err := app.service.TargetHttpsProxies.AggregatedList(app.project).Pages(ctx, func(l *compute.TargetHttpsProxyAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.TargetHttpsProxies...)
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listTargetGrpcProxies(ctx context.Context) ([]*compute.TargetGrpcProxy, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.TargetGrpcProxy
+	err := app.service.TargetGrpcProxies.List(app.project).Pages(ctx, func(l *compute.TargetGrpcProxyList) error {
+		list = append(list, l.Items...)
+		return nil
+	})
+	return list, err
+}
+
+// listBackendServices lists both the global and the regional backend services
+func (app *App) listBackendServices(ctx context.Context) ([]*compute.BackendService, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
 
-	return ret, nil
+	var list []*compute.BackendService
+	err := app.service.BackendServices.AggregatedList(app.project).Pages(ctx, func(l *compute.BackendServiceAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.BackendServices...)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// listHealthChecks lists both the global and the regional health checks
+func (app *App) listHealthChecks(ctx context.Context) ([]*compute.HealthCheck, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.HealthCheck
+	err := app.service.HealthChecks.AggregatedList(app.project).Pages(ctx, func(l *compute.HealthChecksAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.HealthChecks...)
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listHttpHealthChecks(ctx context.Context) ([]*compute.HttpHealthCheck, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.HttpHealthCheck
+	err := app.service.HttpHealthChecks.List(app.project).Pages(ctx, func(l *compute.HttpHealthCheckList) error {
+		list = append(list, l.Items...)
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listHttpsHealthChecks(ctx context.Context) ([]*compute.HttpsHealthCheck, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.HttpsHealthCheck
+	err := app.service.HttpsHealthChecks.List(app.project).Pages(ctx, func(l *compute.HttpsHealthCheckList) error {
+		list = append(list, l.Items...)
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listInstanceGroups(ctx context.Context) ([]*compute.InstanceGroup, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.InstanceGroup
+	err := app.service.InstanceGroups.AggregatedList(app.project).Pages(ctx, func(l *compute.InstanceGroupAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.InstanceGroups...)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// listAddresses lists both the global and the regional addresses. The
+// global ones are listed on their own, as they are not guaranteed to be
+// part of the aggregated list
+func (app *App) listAddresses(ctx context.Context) ([]*compute.Address, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.Address
+	err := app.service.Addresses.AggregatedList(app.project).Pages(ctx, func(l *compute.AddressAggregatedList) error {
+		for scope, scopedList := range l.Items {
+			if scope == `global` {
+				continue
+			}
+			list = append(list, scopedList.Addresses...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.service.GlobalAddresses.List(app.project).Pages(ctx, func(l *compute.AddressList) error {
+		list = append(list, l.Items...)
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listFirewalls(ctx context.Context) ([]*compute.Firewall, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.Firewall
+	err := app.service.Firewalls.List(app.project).Pages(ctx, func(l *compute.FirewallList) error {
+		list = append(list, l.Items...)
+		return nil
+	})
+	return list, err
+}
+
+// listSslCertificates lists both the global and the regional certificates
+func (app *App) listSslCertificates(ctx context.Context) ([]*compute.SslCertificate, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.SslCertificate
+	err := app.service.SslCertificates.AggregatedList(app.project).Pages(ctx, func(l *compute.SslCertificateAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.SslCertificates...)
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listTargetSslProxies(ctx context.Context) ([]*compute.TargetSslProxy, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.TargetSslProxy
+	err := app.service.TargetSslProxies.List(app.project).Pages(ctx, func(l *compute.TargetSslProxyList) error {
+		list = append(list, l.Items...)
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listTargetPools(ctx context.Context) ([]*compute.TargetPool, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.TargetPool
+	err := app.service.TargetPools.AggregatedList(app.project).Pages(ctx, func(l *compute.TargetPoolAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.TargetPools...)
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listAllInstances(ctx context.Context) ([]*compute.Instance, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.Instance
+	err := app.service.Instances.AggregatedList(app.project).Pages(ctx, func(l *compute.InstanceAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.Instances...)
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listRegionalForwardingRules(ctx context.Context) ([]*compute.ForwardingRule, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.ForwardingRule
+	err := app.service.ForwardingRules.AggregatedList(app.project).Pages(ctx, func(l *compute.ForwardingRuleAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.ForwardingRules...)
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (app *App) listUrlMaps(ctx context.Context) ([]*compute.UrlMap, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.UrlMap
+	err := app.service.UrlMaps.AggregatedList(app.project).Pages(ctx, func(l *compute.UrlMapsAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.UrlMaps...)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// listTargetTcpProxies lists both the global and the regional target
+// tcp proxies
+func (app *App) listTargetTcpProxies(ctx context.Context) ([]*compute.TargetTcpProxy, error) {
+	ctx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	var list []*compute.TargetTcpProxy
+	err := app.service.TargetTcpProxies.AggregatedList(app.project).Pages(ctx, func(l *compute.TargetTcpProxyAggregatedList) error {
+		for _, scopedList := range l.Items {
+			list = append(list, scopedList.TargetTcpProxies...)
+		}
+		return nil
+	})
+	return list, err
 }
@@ -130,6 +130,144 @@ func TestParseUrlMap(t *testing.T) {
 	}
 }
 
+func TestParseNetworkEndpointGroup(t *testing.T) {
+	name, zone, err := autolbclean.ParseNetworkEndpointGroup(`https://www.googleapis.com/compute/v1/projects/p/zones/asia-northeast1-a/networkEndpointGroups/k8s1-c4f34d38-default-web-80-5d8b4f1c`)
+	if !assert.NoError(t, err, `ParseNetworkEndpointGroup should succeed`) {
+		return
+	}
+	if !assert.Equal(t, `k8s1-c4f34d38-default-web-80-5d8b4f1c`, name, `name should match`) {
+		return
+	}
+	if !assert.Equal(t, `asia-northeast1-a`, zone, `zone should match`) {
+		return
+	}
+
+	_, _, err = autolbclean.ParseNetworkEndpointGroup(`https://www.googleapis.com/compute/v1/projects/p/zones/asia-northeast1-a/instanceGroups/k8s-ig--1`)
+	if !assert.Error(t, err, `ParseNetworkEndpointGroup should fail for instance groups`) {
+		return
+	}
+}
+
+func TestBackendServiceURLs(t *testing.T) {
+	const prefix = `https://www.googleapis.com/compute/v1/projects/p/global/`
+	um := &compute.UrlMap{
+		DefaultService: prefix + `backendServices/k8s-be-30000--1`,
+		PathMatchers: []*compute.PathMatcher{
+			{
+				DefaultService: prefix + `backendServices/k8s-be-30001--1`,
+				PathRules: []*compute.PathRule{
+					{Service: prefix + `backendServices/k8s-be-30002--1`},
+					{Service: prefix + `backendServices/k8s-be-30000--1`},
+					{Service: prefix + `backendBuckets/static`},
+				},
+			},
+		},
+	}
+
+	expected := []string{
+		prefix + `backendServices/k8s-be-30000--1`,
+		prefix + `backendServices/k8s-be-30001--1`,
+		prefix + `backendServices/k8s-be-30002--1`,
+	}
+	if !assert.Equal(t, expected, autolbclean.BackendServiceURLs(um), `urls should match`) {
+		return
+	}
+	if !assert.Equal(t, []string{prefix + `backendBuckets/static`}, autolbclean.BackendBucketURLs(um), `bucket urls should match`) {
+		return
+	}
+}
+
+func TestBackendServicesInUse(t *testing.T) {
+	const api = `https://www.googleapis.com/compute/v1/projects/p/`
+	urlMaps := []*compute.UrlMap{
+		{DefaultService: api + `global/backendServices/k8s-be-30000--1`},
+		{
+			DefaultService: api + `regions/asia-northeast1/backendServices/k8s1-internal`,
+			PathMatchers: []*compute.PathMatcher{
+				{
+					RouteRules: []*compute.HttpRouteRule{
+						{
+							RouteAction: &compute.HttpRouteAction{
+								WeightedBackendServices: []*compute.WeightedBackendService{
+									{BackendService: api + `regions/asia-northeast1/backendServices/k8s1-canary`},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	expected := map[string]struct{}{
+		`global/k8s-be-30000--1`:        {},
+		`asia-northeast1/k8s1-internal`: {},
+		`asia-northeast1/k8s1-canary`:   {},
+	}
+	if !assert.Equal(t, expected, autolbclean.BackendServicesInUse(urlMaps), `backend services in use should match`) {
+		return
+	}
+}
+
+func TestParseHealthCheckRef(t *testing.T) {
+	type parseHealthCheckRefResult struct {
+		Input  string
+		Kind   string
+		Name   string
+		Region string
+		Error  bool
+	}
+
+	list := []parseHealthCheckRefResult{
+		{
+			Input:  `https://www.googleapis.com/compute/v1/projects/builderscon-1248/global/healthChecks/k8s-be-30001--c4f34d3824aedd50`,
+			Kind:   `healthChecks`,
+			Name:   `k8s-be-30001--c4f34d3824aedd50`,
+			Region: `global`,
+		},
+		{
+			Input:  `https://www.googleapis.com/compute/v1/projects/builderscon-1248/global/httpHealthChecks/custom-backendconfig-check`,
+			Kind:   `httpHealthChecks`,
+			Name:   `custom-backendconfig-check`,
+			Region: `global`,
+		},
+		{
+			Input:  `https://www.googleapis.com/compute/v1/projects/builderscon-1248/regions/asia-northeast1/healthChecks/k8s1-c4f34d38-default-apiserver-80-4a8f5d2e`,
+			Kind:   `healthChecks`,
+			Name:   `k8s1-c4f34d38-default-apiserver-80-4a8f5d2e`,
+			Region: `asia-northeast1`,
+		},
+		{
+			Input: `https://www.googleapis.com/compute/v1/projects/builderscon-1248/global/backendServices/k8s-be-30001--c4f34d3824aedd50`,
+			Error: true,
+		},
+	}
+
+	for _, data := range list {
+		t.Run(fmt.Sprintf("Parse %s", data.Input), func(t *testing.T) {
+			ref, err := autolbclean.ParseHealthCheckRef(data.Input)
+			if data.Error {
+				if !assert.Error(t, err, `ParseHealthCheckRef should fail`) {
+					return
+				}
+			} else {
+				if !assert.NoError(t, err, `ParseHealthCheckRef should succeed`) {
+					return
+				}
+				if !assert.Equal(t, data.Kind, ref.Kind, `kind should match`) {
+					return
+				}
+				if !assert.Equal(t, data.Name, ref.Name, `name should match`) {
+					return
+				}
+				if !assert.Equal(t, data.Region, ref.Region, `region should match`) {
+					return
+				}
+			}
+		})
+	}
+}
+
 func TestIngress(t *testing.T) {
 	t.Run("TestListIngressForwardingRules", func(t *testing.T) {
 		if !testReady() {
@@ -149,7 +287,7 @@ func TestIngress(t *testing.T) {
 			return
 		}
 
-		fwrs, err := app.ListIngressForwardingRules()
+		fwrs, err := app.ListIngressForwardingRules(ctx)
 		if !assert.NoError(t, err, `ListIngressForwardingRules should succeed`) {
 			return
 		}
@@ -165,14 +303,14 @@ func TestIngress(t *testing.T) {
 				_ = region
 				var urlMapURL string
 				if isHTTPs {
-					tp, err := app.GetTargetHttpsProxy(tpname)
+					tp, err := app.GetTargetHttpsProxy(ctx, tpname)
 					if !assert.NoError(t, err, `GetTargetHttpsProxy should succeed`) {
 						return
 					}
 					urlMapURL = tp.UrlMap
 					dump(t, tp)
 				} else {
-					tp, err := app.GetTargetHttpProxy(tpname)
+					tp, err := app.GetTargetHttpProxy(ctx, tpname)
 					if !assert.NoError(t, err, `GetTargetHttpProxy should succeed`) {
 						return
 					}
@@ -187,19 +325,19 @@ func TestIngress(t *testing.T) {
 					}
 
 					_ = region
-					um, err := app.GetUrlMap(umname)
+					um, err := app.GetUrlMap(ctx, umname)
 					if !assert.NoError(t, err, `GetUrlMap should succeed`) {
 						return
 					}
 
 					t.Run("FindBackendServices", func(t *testing.T) {
-						services, err := app.FindBackendServices(um)
+						services, err := app.FindBackendServices(ctx, um)
 						if !assert.NoError(t, err, `FindBackendServices should succeed`) {
 							return
 						}
 
 						for _, service := range services {
-							instances, err := app.ListInstancesForService(service)
+							instances, err := app.ListInstancesForService(ctx, service)
 							if !assert.NoError(t, err, `ListInstancesForService should succeed`) {
 								return
 							}
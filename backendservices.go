@@ -0,0 +1,151 @@
+package autolbclean
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+// backendServiceKey identifies a backend service by its region and
+// name, so that references made through different API endpoints match
+func backendServiceKey(link string) (string, bool) {
+	name, region, err := ParseBackendServices(link)
+	if err != nil {
+		return ``, false
+	}
+	return region + `/` + name, true
+}
+
+// BackendServicesInUse returns the keys (REGION/NAME) of the backend
+// services that the url maps route to
+func BackendServicesInUse(urlMaps []*compute.UrlMap) map[string]struct{} {
+	inUse := make(map[string]struct{})
+	for _, um := range urlMaps {
+		for _, link := range BackendServiceURLs(um) {
+			if key, ok := backendServiceKey(link); ok {
+				inUse[key] = struct{}{}
+			}
+		}
+	}
+	return inUse
+}
+
+// ListDanglingBackendServices returns the deletions of the backend
+// services, both global and regional, that were created by GKE and are
+// no longer referenced by any url map. These accumulate when a url map
+// stops routing to them, as they are otherwise only deleted along with
+// the rest of the load balancer.
+//
+// Backend services may also be used by a forwarding rule (internal
+// TCP/UDP load balancers) or a target TCP/SSL proxy, in which case they
+// are left alone
+func (app *App) ListDanglingBackendServices(ctx context.Context) ([]*Deletion, error) {
+	c := app.Config()
+
+	var urlMaps []*compute.UrlMap
+	if err := app.checkInventory(ctx, KindUrlMaps, func() (int, error) {
+		var err error
+		urlMaps, err = app.listUrlMaps(ctx)
+		return len(urlMaps), errors.Wrap(err, `failed to list url maps`)
+	}); err != nil {
+		return nil, err
+	}
+	inUse := BackendServicesInUse(urlMaps)
+
+	use := func(link string) {
+		if key, ok := backendServiceKey(link); ok {
+			inUse[key] = struct{}{}
+		}
+	}
+
+	var forwardingRules []*compute.ForwardingRule
+	if err := app.checkInventory(ctx, inventoryRegionalForwardingRules, func() (int, error) {
+		var err error
+		forwardingRules, err = app.listRegionalForwardingRules(ctx)
+		return len(forwardingRules), errors.Wrap(err, `failed to list forwarding rules`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, fr := range forwardingRules {
+		use(fr.BackendService)
+	}
+
+	var sslProxies []*compute.TargetSslProxy
+	if err := app.checkInventory(ctx, inventoryTargetSslProxies, func() (int, error) {
+		var err error
+		sslProxies, err = app.listTargetSslProxies(ctx)
+		return len(sslProxies), errors.Wrap(err, `failed to list target ssl proxies`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, tp := range sslProxies {
+		use(tp.Service)
+	}
+
+	var tcpProxies []*compute.TargetTcpProxy
+	if err := app.checkInventory(ctx, inventoryTargetTcpProxies, func() (int, error) {
+		var err error
+		tcpProxies, err = app.listTargetTcpProxies(ctx)
+		return len(tcpProxies), errors.Wrap(err, `failed to list target tcp proxies`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, tp := range tcpProxies {
+		use(tp.Service)
+	}
+
+	var services []*compute.BackendService
+	if err := app.checkInventory(ctx, KindBackendServices, func() (int, error) {
+		var err error
+		services, err = app.listBackendServices(ctx)
+		return len(services), errors.Wrap(err, `failed to list backend services`)
+	}); err != nil {
+		return nil, err
+	}
+
+	var clusters []*container.Cluster
+	if c.ClusterCrossCheck {
+		var err error
+		if clusters, err = app.liveClusters(ctx); err != nil {
+			return nil, errors.Wrap(err, `failed to cross-check GKE clusters`)
+		}
+	}
+
+	owned := app.multiClusterOwned(ctx)
+	var result []*Deletion
+	for _, service := range services {
+		if !hasAnyPrefix(service.Name, c.backendServicePrefixes()) || c.IsExcluded(service.Name) || c.IsProtected(nil, service.Description) {
+			continue
+		}
+
+		if c.ownedByLiveCluster(service.Name, clusters) || owned(service.Name) {
+			continue
+		}
+
+		// give the ingress controller a chance to attach it to a url map
+		if c.isYoung(KindBackendServices, service.CreationTimestamp) {
+			continue
+		}
+
+		_, region, err := ParseBackendServices(service.SelfLink)
+		if err != nil {
+			continue
+		}
+		if _, ok := inUse[region+`/`+service.Name]; ok {
+			continue
+		}
+		if sweepPolicyKeeps(ctx, c, sweptResource(KindBackendServices, service.Name, region, ``, service.CreationTimestamp), nil) {
+			continue
+		}
+
+		result = append(result, &Deletion{
+			Kind:   KindBackendServices,
+			Name:   service.Name,
+			Region: region,
+		})
+	}
+	sortDeletions(result)
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package autolbclean
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"time"
+)
+
+// BadgeStaleAfter is how old the last run can get before the badge
+// turns red. The check runs every 10 minutes
+const BadgeStaleAfter = 30 * time.Minute
+
+const badgeLabel = `auto-lb-clean`
+
+// badge colors, as used by shields.io
+const (
+	badgeGreen  = `#4c1`
+	badgeYellow = `#dfb317`
+	badgeRed    = `#e05d44`
+	badgeGrey   = `#9f9f9f`
+)
+
+// BadgeMessage returns the text and the color of the status badge for
+// the given run status. status is nil if no run has been recorded yet
+func BadgeMessage(status *RunStatus, now time.Time) (string, string) {
+	if status == nil {
+		return `no runs`, badgeGrey
+	}
+
+	age := now.Sub(status.FinishedAt)
+	msg := fmt.Sprintf(`%d pending, %s ago`, status.Orphans, formatAge(age))
+	switch {
+	case age > BadgeStaleAfter:
+		return msg, badgeRed
+	case status.Orphans > 0:
+		return msg, badgeYellow
+	}
+	return msg, badgeGreen
+}
+
+// formatAge rounds d to the largest unit that fits
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return `<1m`
+	case d < time.Hour:
+		return fmt.Sprintf(`%dm`, int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf(`%dh`, int(d/time.Hour))
+	}
+	return fmt.Sprintf(`%dd`, int(d/(24*time.Hour)))
+}
+
+// badgeTextWidth approximates the width of s in 11px Verdana, which is
+// close enough for the short strings that go in a badge
+func badgeTextWidth(s string) int {
+	return len(s)*7 + 10
+}
+
+// RenderBadge renders the status badge for the given run status as SVG
+func RenderBadge(status *RunStatus, now time.Time) []byte {
+	msg, color := BadgeMessage(status, now)
+	lw := badgeTextWidth(badgeLabel)
+	mw := badgeTextWidth(msg)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, lw+mw, badgeLabel, html.EscapeString(msg))
+	fmt.Fprintf(&buf, `<rect width="%d" height="20" fill="#555"/>`, lw)
+	fmt.Fprintf(&buf, `<rect x="%d" width="%d" height="20" fill="%s"/>`, lw, mw, color)
+	buf.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	fmt.Fprintf(&buf, `<text x="%d" y="14">%s</text>`, lw/2, badgeLabel)
+	fmt.Fprintf(&buf, `<text x="%d" y="14">%s</text>`, lw+mw/2, html.EscapeString(msg))
+	buf.WriteString(`</g></svg>`)
+	return buf.Bytes()
+}
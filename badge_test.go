@@ -0,0 +1,40 @@
+package autolbclean_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBadgeMessage(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		status *autolbclean.RunStatus
+		msg    string
+		color  string
+	}{
+		{nil, `no runs`, `#9f9f9f`},
+		{&autolbclean.RunStatus{FinishedAt: now.Add(-5 * time.Minute)}, `0 pending, 5m ago`, `#4c1`},
+		{&autolbclean.RunStatus{FinishedAt: now.Add(-30 * time.Second), Orphans: 3}, `3 pending, <1m ago`, `#dfb317`},
+		{&autolbclean.RunStatus{FinishedAt: now.Add(-26 * time.Hour), Orphans: 3}, `3 pending, 1d ago`, `#e05d44`},
+	} {
+		msg, color := autolbclean.BadgeMessage(c.status, now)
+		if !assert.Equal(t, c.msg, msg, `message should match`) {
+			return
+		}
+		if !assert.Equal(t, c.color, color, `color of %q should match`, msg) {
+			return
+		}
+	}
+
+	svg := string(autolbclean.RenderBadge(&autolbclean.RunStatus{FinishedAt: now.Add(-2 * time.Hour)}, now))
+	if !assert.True(t, strings.HasPrefix(svg, `<svg `), `badge should be an svg`) {
+		return
+	}
+	if !assert.Contains(t, svg, `>0 pending, 2h ago</text>`, `badge should contain the message`) {
+		return
+	}
+}
@@ -0,0 +1,40 @@
+package autolbclean
+
+import "time"
+
+// NewCircuitBreaker creates a circuit breaker that opens after threshold
+// consecutive failures, and stays open for cooldown
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow returns true if an attempt may be made. Once the cool down
+// period has passed, a single attempt is allowed to go through to find
+// out if things got better
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !time.Now().Before(b.openUntil)
+}
+
+// Success records a successful attempt, closing the breaker
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// Failure records a failed attempt, and opens the breaker if there
+// have been too many of them in a row
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,204 @@
+package autolbclean
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+// Statuses of a canary
+const (
+	CanaryPending = `pending` // the canary is waiting to be cleaned up
+	CanaryHealthy = `healthy` // the canary was cleaned up before its deadline
+	CanaryFailed  = `failed`  // the canary was not cleaned up before its deadline
+)
+
+// Metrics reported for each canary that is done
+const (
+	canaryHealthyMetric = `custom.googleapis.com/autolbclean/canary_healthy`
+	canaryLatencyMetric = `custom.googleapis.com/autolbclean/canary_cleanup_seconds`
+)
+
+func canaryName(prefix, id string) string {
+	return prefix + `-autolbclean-canary-` + id
+}
+
+// orphan describes the canary the same way the cleaner would
+func (c *Canary) orphan() *Orphan {
+	return &Orphan{
+		ForwardingRule:  c.ForwardingRule,
+		Region:          globalRegion,
+		TargetProxy:     c.TargetProxy,
+		UrlMap:          c.UrlMap,
+		BackendServices: []*compute.BackendService{{Name: c.BackendService}},
+		HealthChecks:    []*HealthCheckRef{{Kind: KindHealthChecks, Name: c.HealthCheck, Region: globalRegion}},
+	}
+}
+
+// CreateCanary creates a minimal load balancer (a forwarding rule, a
+// target proxy, a url map, a backend service without any backends, and
+// a health check), named after the configured prefixes so that the
+// cleaner considers it orphaned. It is expected to be cleaned up once
+// it is older than the age threshold, and before deadline
+func (app *App) CreateCanary(ctx context.Context, deadline time.Duration) (*Canary, error) {
+	c := app.Config()
+	if len(c.ForwardingRulePrefixes) == 0 || len(c.TargetProxyPrefixes) == 0 {
+		return nil, errors.New(`forwarding rule and target proxy prefixes are required to create a canary`)
+	}
+
+	now := time.Now().UTC()
+	id := strconv.FormatInt(now.Unix(), 36)
+	canary := &Canary{
+		ID:             id,
+		CreatedAt:      now,
+		Deadline:       now.Add(deadline),
+		ForwardingRule: canaryName(c.ForwardingRulePrefixes[0], id),
+		TargetProxy:    canaryName(c.TargetProxyPrefixes[0], id),
+		UrlMap:         canaryName(`k8s-um`, id),
+		BackendService: canaryName(`k8s-be`, id),
+		HealthCheck:    canaryName(`k8s-be`, id),
+	}
+
+	link := func(collection, name string) string {
+		return `https://www.googleapis.com/compute/v1/projects/` + app.project + `/global/` + collection + `/` + name
+	}
+
+	steps := []func() (*compute.Operation, error){
+		func() (*compute.Operation, error) {
+			return app.executor.HealthChecks.Insert(app.project, &compute.HealthCheck{
+				Name:             canary.HealthCheck,
+				Type:             `TCP`,
+				TcpHealthCheck:   &compute.TCPHealthCheck{Port: 80},
+				CheckIntervalSec: 300,
+			}).Context(ctx).Do()
+		},
+		func() (*compute.Operation, error) {
+			return app.executor.BackendServices.Insert(app.project, &compute.BackendService{
+				Name:         canary.BackendService,
+				HealthChecks: []string{link(`healthChecks`, canary.HealthCheck)},
+			}).Context(ctx).Do()
+		},
+		func() (*compute.Operation, error) {
+			return app.executor.UrlMaps.Insert(app.project, &compute.UrlMap{
+				Name:           canary.UrlMap,
+				DefaultService: link(`backendServices`, canary.BackendService),
+			}).Context(ctx).Do()
+		},
+		func() (*compute.Operation, error) {
+			return app.executor.TargetHttpProxies.Insert(app.project, &compute.TargetHttpProxy{
+				Name:   canary.TargetProxy,
+				UrlMap: link(`urlMaps`, canary.UrlMap),
+			}).Context(ctx).Do()
+		},
+		func() (*compute.Operation, error) {
+			return app.executor.GlobalForwardingRules.Insert(app.project, &compute.ForwardingRule{
+				Name:       canary.ForwardingRule,
+				Target:     link(`targetHttpProxies`, canary.TargetProxy),
+				PortRange:  `80`,
+				IPProtocol: `TCP`,
+			}).Context(ctx).Do()
+		},
+	}
+
+	for _, step := range steps {
+		op, err := step()
+		if err == nil {
+			err = app.WaitOperation(ctx, newRestOperation(app.executor, app.project, op))
+		}
+		if err != nil {
+			// don't leave half a canary behind
+			app.DeleteCanary(ctx, canary)
+			return nil, errors.Wrap(err, `failed to create canary`)
+		}
+	}
+	return canary, nil
+}
+
+// CheckCanary returns the status of the canary. It is healthy once
+// its target proxy is gone, which is the resource the cleaner finds
+// orphans by
+func (app *App) CheckCanary(ctx context.Context, canary *Canary) (string, error) {
+	_, err := app.GetTargetHttpProxy(ctx, canary.TargetProxy)
+	switch {
+	case err == nil:
+	case isNotFound(err):
+		if canary.CleanedAt.IsZero() {
+			canary.CleanedAt = time.Now().UTC()
+		}
+		if canary.CleanedAt.After(canary.Deadline) {
+			return CanaryFailed, nil
+		}
+		return CanaryHealthy, nil
+	default:
+		return ``, errors.Wrap(err, `failed to check canary`)
+	}
+
+	if time.Now().After(canary.Deadline) {
+		return CanaryFailed, nil
+	}
+	return CanaryPending, nil
+}
+
+// DeleteCanary deletes whatever is left of the canary. This is used
+// when the cleaner failed to do so in time, so that canaries don't pile up
+func (app *App) DeleteCanary(ctx context.Context, canary *Canary) error {
+	var firstErr error
+	for _, d := range canary.orphan().Deletions() {
+		op, err := app.Delete(ctx, d)
+		if err == nil {
+			err = app.WaitOperation(ctx, op)
+		}
+		if err != nil && !isNotFound(err) && firstErr == nil {
+			firstErr = errors.Wrapf(err, `failed to delete canary %s %s`, d.Kind, d.Name)
+		}
+	}
+	return firstErr
+}
+
+// ReportCanary writes the health of a canary that is done (and how
+// long it took to be cleaned up, if it was) to Cloud Monitoring
+func (app *App) ReportCanary(ctx context.Context, canary *Canary, status string) error {
+	svc, err := monitoring.New(app.client)
+	if err != nil {
+		return errors.Wrap(err, `failed to create monitoring.Service`)
+	}
+
+	now := &monitoring.TimeInterval{EndTime: time.Now().UTC().Format(time.RFC3339)}
+	resource := &monitoring.MonitoredResource{
+		Type:   `global`,
+		Labels: map[string]string{`project_id`: app.project},
+	}
+
+	var healthy int64
+	if status == CanaryHealthy {
+		healthy = 1
+	}
+	series := []*monitoring.TimeSeries{
+		{
+			Metric:   &monitoring.Metric{Type: canaryHealthyMetric},
+			Resource: resource,
+			Points:   []*monitoring.Point{{Interval: now, Value: &monitoring.TypedValue{Int64Value: &healthy}}},
+		},
+	}
+
+	if !canary.CleanedAt.IsZero() {
+		latency := canary.CleanedAt.Sub(canary.CreatedAt).Seconds()
+		series = append(series, &monitoring.TimeSeries{
+			Metric:   &monitoring.Metric{Type: canaryLatencyMetric},
+			Resource: resource,
+			Points:   []*monitoring.Point{{Interval: now, Value: &monitoring.TypedValue{DoubleValue: &latency}}},
+		})
+	}
+
+	_, err = svc.Projects.TimeSeries.Create(`projects/`+app.project, &monitoring.CreateTimeSeriesRequest{
+		TimeSeries: series,
+	}).Context(ctx).Do()
+	if err != nil {
+		return errors.Wrap(err, `failed to write canary metrics`)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package autolbclean
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+// DefaultManagedCertificateThreshold is the default amount of time a
+// Google-managed certificate may be stuck without being provisioned
+// before we consider it for deletion
+const DefaultManagedCertificateThreshold = 72 * time.Hour
+
+// DefaultOrphanedCertificateThreshold is the default amount of time a
+// certificate must have existed before we consider it for deletion when
+// it is not attached to any target proxy
+const DefaultOrphanedCertificateThreshold = 24 * time.Hour
+
+// orphanedCertificatePrefixes are the prefixes of the certificates
+// created by the ingress controller (k8s-ssl-*) and by ManagedCertificate
+// resources (mcrt-*)
+var orphanedCertificatePrefixes = []string{`k8s-ssl-`, `mcrt-`}
+
+// isStuckManagedCertificate returns true if the certificate is a
+// Google-managed certificate that has not (yet) been provisioned
+func isStuckManagedCertificate(cert *compute.SslCertificate) bool {
+	if cert.Type != `MANAGED` || cert.Managed == nil {
+		return false
+	}
+
+	switch cert.Managed.Status {
+	case `PROVISIONING`, `PROVISIONING_FAILED`, `PROVISIONING_FAILED_PERMANENTLY`, `RENEWAL_FAILED`:
+		return true
+	}
+
+	for _, status := range cert.Managed.DomainStatus {
+		if strings.HasPrefix(status, `FAILED_`) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListStuckManagedCertificates lists the Google-managed certificates
+// that have been stuck in a non-active state (e.g. FAILED_NOT_VISIBLE
+// or PROVISIONING) for longer than threshold, and that are not attached
+// to any target proxy. These are not reachable through the load balancer
+// chain once the ingress that requested them is gone, yet they still
+// count against the certificate quota. Only the certificates whose names
+// look like those of GKE (such as mcrt-*, or name_patterns) are listed, so that
+// certificates that someone else requested are left alone
+func (app *App) ListStuckManagedCertificates(ctx context.Context, threshold time.Duration) ([]*compute.SslCertificate, error) {
+	var certs []*compute.SslCertificate
+	if err := app.checkInventory(ctx, KindSslCertificates, func() (int, error) {
+		var err error
+		certs, err = app.listSslCertificates(ctx)
+		return len(certs), errors.Wrap(err, `failed to list ssl certificates`)
+	}); err != nil {
+		return nil, err
+	}
+
+	inUse, err := app.certificatesInUse(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to find certificates in use`)
+	}
+
+	c := app.Config()
+	var clusters []*container.Cluster
+	if c.ClusterCrossCheck {
+		if clusters, err = app.liveClusters(ctx); err != nil {
+			return nil, errors.Wrap(err, `failed to cross-check GKE clusters`)
+		}
+	}
+
+	cutoff := time.Now().Add(-1 * threshold)
+	var list []*compute.SslCertificate
+	for _, cert := range certs {
+		if !isStuckManagedCertificate(cert) || c.IsExcluded(cert.Name) || c.IsProtected(nil, cert.Description) {
+			continue
+		}
+		if !c.IsDeletableName(KindSslCertificates, cert.Name) {
+			continue
+		}
+
+		if _, ok := inUse[cert.SelfLink]; ok || c.ownedByLiveCluster(cert.Name, clusters) {
+			continue
+		}
+
+		createdAt, err := time.Parse(time.RFC3339, cert.CreationTimestamp)
+		if err != nil || createdAt.After(cutoff) {
+			continue
+		}
+		if sweepPolicyKeeps(ctx, c, sweptResource(KindSslCertificates, cert.Name, certificateRegion(cert), ``, cert.CreationTimestamp), nil) {
+			continue
+		}
+
+		list = append(list, cert)
+	}
+	return list, nil
+}
+
+// ListOrphanedCertificates lists the certificates created by GKE that
+// are not attached to any target proxy, and that are older than
+// threshold. These are left behind when the ingress rotates its
+// certificates, or when a cleanup fails half way through, and are
+// never reached through the load balancer chain again
+func (app *App) ListOrphanedCertificates(ctx context.Context, threshold time.Duration) ([]*compute.SslCertificate, error) {
+	var certs []*compute.SslCertificate
+	if err := app.checkInventory(ctx, KindSslCertificates, func() (int, error) {
+		var err error
+		certs, err = app.listSslCertificates(ctx)
+		return len(certs), errors.Wrap(err, `failed to list ssl certificates`)
+	}); err != nil {
+		return nil, err
+	}
+
+	inUse, err := app.certificatesInUse(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to find certificates in use`)
+	}
+
+	c := app.Config()
+	var clusters []*container.Cluster
+	if c.ClusterCrossCheck {
+		if clusters, err = app.liveClusters(ctx); err != nil {
+			return nil, errors.Wrap(err, `failed to cross-check GKE clusters`)
+		}
+	}
+
+	cutoff := time.Now().Add(-1 * threshold)
+	var list []*compute.SslCertificate
+	for _, cert := range certs {
+		if !hasAnyPrefix(cert.Name, orphanedCertificatePrefixes) || c.IsExcluded(cert.Name) || c.IsProtected(nil, cert.Description) {
+			continue
+		}
+
+		if _, ok := inUse[cert.SelfLink]; ok || c.ownedByLiveCluster(cert.Name, clusters) {
+			continue
+		}
+
+		createdAt, err := time.Parse(time.RFC3339, cert.CreationTimestamp)
+		if err != nil || createdAt.After(cutoff) {
+			continue
+		}
+		if sweepPolicyKeeps(ctx, c, sweptResource(KindSslCertificates, cert.Name, certificateRegion(cert), ``, cert.CreationTimestamp), nil) {
+			continue
+		}
+
+		list = append(list, cert)
+	}
+	return list, nil
+}
+
+// certificateRegion returns the region of the certificate, or global
+func certificateRegion(cert *compute.SslCertificate) string {
+	if len(cert.Region) == 0 {
+		return globalRegion
+	}
+	return path.Base(cert.Region)
+}
+
+// certificatesInUse returns the self links of all certificates attached
+// to a target https proxy, global or regional, or a target ssl proxy
+func (app *App) certificatesInUse(ctx context.Context) (map[string]struct{}, error) {
+	inUse := make(map[string]struct{})
+
+	var httpsProxies []*compute.TargetHttpsProxy
+	if err := app.checkInventory(ctx, KindTargetHttpsProxies, func() (int, error) {
+		var err error
+		httpsProxies, err = app.listAllTargetHttpsProxies(ctx)
+		return len(httpsProxies), errors.Wrap(err, `failed to list target https proxies`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, tp := range httpsProxies {
+		for _, cert := range tp.SslCertificates {
+			inUse[cert] = struct{}{}
+		}
+	}
+
+	var sslProxies []*compute.TargetSslProxy
+	if err := app.checkInventory(ctx, inventoryTargetSslProxies, func() (int, error) {
+		var err error
+		sslProxies, err = app.listTargetSslProxies(ctx)
+		return len(sslProxies), errors.Wrap(err, `failed to list target ssl proxies`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, tp := range sslProxies {
+		for _, cert := range tp.SslCertificates {
+			inUse[cert] = struct{}{}
+		}
+	}
+
+	return inUse, nil
+}
@@ -0,0 +1,70 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListOrphanedCertificates(t *testing.T) {
+	const prefix = `https://www.googleapis.com/compute/v1/projects/p/`
+	cert := func(name, scope string) map[string]interface{} {
+		return map[string]interface{}{
+			`name`:              name,
+			`selfLink`:          prefix + scope + `/sslCertificates/` + name,
+			`creationTimestamp`: `2020-01-01T00:00:00Z`,
+		}
+	}
+	regional := cert(`k8s-ssl-regional`, `regions/us-central1`)
+	regional[`region`] = prefix + `regions/us-central1`
+
+	fake := fakeCompute{
+		`aggregated/sslCertificates`: map[string]interface{}{
+			`items`: map[string]interface{}{
+				`global`: map[string]interface{}{
+					`sslCertificates`: []interface{}{cert(`k8s-ssl-global`, `global`)},
+				},
+				`regions/us-central1`: map[string]interface{}{
+					`sslCertificates`: []interface{}{regional, cert(`k8s-ssl-used`, `regions/us-central1`)},
+				},
+			},
+		},
+		`aggregated/targetHttpsProxies`: map[string]interface{}{
+			`items`: map[string]interface{}{
+				`regions/us-central1`: map[string]interface{}{
+					`targetHttpsProxies`: []interface{}{
+						map[string]interface{}{
+							`name`:            `k8s-tps-a`,
+							`sslCertificates`: []string{prefix + `regions/us-central1/sslCertificates/k8s-ssl-used`},
+						},
+					},
+				},
+			},
+		},
+		`global/targetSslProxies`: map[string]interface{}{},
+		`locations/-/clusters`:    map[string]interface{}{},
+	}
+
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake})
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	certs, err := app.ListOrphanedCertificates(context.Background(), time.Hour)
+	if !assert.NoError(t, err, `ListOrphanedCertificates should succeed`) {
+		return
+	}
+	var names []string
+	for _, c := range certs {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	if !assert.Equal(t, []string{`k8s-ssl-global`, `k8s-ssl-regional`}, names, `regional certificates should be swept too, unless a regional proxy uses them`) {
+		return
+	}
+}
@@ -0,0 +1,86 @@
+package autolbclean
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// chainLink is how a deletion that is waiting for its turn in a chain
+// is carried along in the parameters of a task
+type chainLink struct {
+	Kind   string        `json:"kind"`
+	Name   string        `json:"name"`
+	Region string        `json:"region,omitempty"`
+	Zone   string        `json:"zone,omitempty"`
+	Delay  time.Duration `json:"delay,omitempty"`
+}
+
+// ChainDeletions links the deletions so that they are carried out one
+// after the other, in the given order, and returns the first one. The
+// deletions must be ordered so that a resource comes before the
+// resources it references, as Orphan.Deletions does
+func ChainDeletions(deletions []*Deletion) *Deletion {
+	if len(deletions) == 0 {
+		return nil
+	}
+	head := deletions[0]
+	head.Next = deletions[1:]
+	return head
+}
+
+// NextDeletion returns the deletion that comes after d in its chain,
+// carrying the rest of the chain, or nil if d is the last one
+func (d *Deletion) NextDeletion() *Deletion {
+	if len(d.Next) == 0 {
+		return nil
+	}
+	next := *d.Next[0]
+	next.Next = d.Next[1:]
+	return &next
+}
+
+func encodeDeletionChain(deletions []*Deletion) string {
+	links := make([]chainLink, len(deletions))
+	for i, d := range deletions {
+		links[i] = chainLink{
+			Kind:   d.Kind,
+			Name:   d.Name,
+			Region: d.Region,
+			Zone:   d.Zone,
+			Delay:  d.Delay,
+		}
+	}
+	// a list of plain structs can not fail to marshal
+	buf, _ := json.Marshal(links)
+	return string(buf)
+}
+
+// ParseDeletionChain parses the rest of a deletion chain, as carried
+// in the `next` parameter of a task
+func ParseDeletionChain(s string) ([]*Deletion, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var links []chainLink
+	if err := json.Unmarshal([]byte(s), &links); err != nil {
+		return nil, errors.Wrap(err, `failed to parse deletion chain`)
+	}
+
+	list := make([]*Deletion, len(links))
+	for i, l := range links {
+		if len(l.Kind) == 0 || len(l.Name) == 0 {
+			return nil, errors.Errorf(`invalid deletion chain: entry %d lacks a kind or a name`, i)
+		}
+		list[i] = &Deletion{
+			Kind:   l.Kind,
+			Name:   l.Name,
+			Region: l.Region,
+			Zone:   l.Zone,
+			Delay:  l.Delay,
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,210 @@
+package autolbclean
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CleanerRegistry maps the kinds of resources to their cleaners. The
+// cleaners that App.Delete and the jobs use are those of the default
+// registry, which RegisterCleaner adds to
+type CleanerRegistry struct {
+	mu       sync.RWMutex
+	cleaners map[string]Cleaner
+}
+
+// NewCleanerRegistry creates an empty registry
+func NewCleanerRegistry() *CleanerRegistry {
+	return &CleanerRegistry{
+		cleaners: make(map[string]Cleaner),
+	}
+}
+
+var defaultCleaners = NewCleanerRegistry()
+
+// Register makes the cleaner available under its kind. It panics if a
+// cleaner is already registered for the same kind
+func (r *CleanerRegistry) Register(c Cleaner) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.cleaners[c.Kind()]; ok {
+		panic(`cleaner already registered for ` + c.Kind())
+	}
+	r.cleaners[c.Kind()] = c
+}
+
+// Lookup returns the cleaner registered for the given kind
+func (r *CleanerRegistry) Lookup(kind string) (Cleaner, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.cleaners[kind]
+	return c, ok
+}
+
+// Cleaners returns the registered cleaners, ordered by kind
+func (r *CleanerRegistry) Cleaners() []Cleaner {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Cleaner, 0, len(r.cleaners))
+	for _, c := range r.cleaners {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Kind() < list[j].Kind()
+	})
+	return list
+}
+
+// ForSelfLink returns the cleaner that handles the resource identified
+// by selfLink
+func (r *CleanerRegistry) ForSelfLink(selfLink string) (Cleaner, bool) {
+	for _, c := range r.Cleaners() {
+		if c.Match(selfLink) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// RegisterCleaner makes the cleaner available under its kind, both to
+// App.Delete and to the generic /job/resources/* jobs. It panics if a
+// cleaner is already registered for the same kind
+func RegisterCleaner(c Cleaner) {
+	defaultCleaners.Register(c)
+}
+
+// LookupCleaner returns the cleaner registered for the given kind
+func LookupCleaner(kind string) (Cleaner, bool) {
+	return defaultCleaners.Lookup(kind)
+}
+
+// Cleaners returns the registered cleaners, ordered by kind
+func Cleaners() []Cleaner {
+	return defaultCleaners.Cleaners()
+}
+
+// CleanerForSelfLink returns the cleaner that handles the resource
+// identified by selfLink
+func CleanerForSelfLink(selfLink string) (Cleaner, bool) {
+	return defaultCleaners.ForSelfLink(selfLink)
+}
+
+// computeCleaner is the cleaner of the compute resources that the
+// ComputeClient knows how to delete. check is nil for the kinds that
+// are only ever deleted as part of something else, such as the
+// resources of an orphaned load balancer
+type computeCleaner struct {
+	kind  string
+	check func(*App, context.Context) ([]*Deletion, error)
+}
+
+func (c *computeCleaner) Kind() string {
+	return c.kind
+}
+
+// Match reports whether selfLink points into the collection of the
+// cleaner. Global and regional resources live in collections of the
+// same name
+func (c *computeCleaner) Match(selfLink string) bool {
+	return strings.Contains(selfLink, `/`+c.kind+`/`)
+}
+
+func (c *computeCleaner) Check(ctx context.Context, app *App) ([]*Deletion, error) {
+	if c.check == nil {
+		return nil, nil
+	}
+	return c.check(app, ctx)
+}
+
+func (c *computeCleaner) Delete(ctx context.Context, app *App, d *Deletion) (Operation, error) {
+	if app.compute == nil {
+		return nil, errors.New(`no compute client configured`)
+	}
+	return app.compute.Delete(ctx, app.project, d)
+}
+
+// danglingHealthCheckDeletions is ListDanglingHealthChecks, for the
+// cleaner of health checks
+func (app *App) danglingHealthCheckDeletions(ctx context.Context) ([]*Deletion, error) {
+	refs, err := app.ListDanglingHealthChecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Deletion, 0, len(refs))
+	for _, ref := range refs {
+		list = append(list, &Deletion{
+			Kind:   ref.Kind,
+			Name:   ref.Name,
+			Region: ref.Region,
+		})
+	}
+	return list, nil
+}
+
+// orphanedCertificateDeletions is ListOrphanedCertificates, for the
+// cleaner of certificates
+func (app *App) orphanedCertificateDeletions(ctx context.Context) ([]*Deletion, error) {
+	threshold := orphanedCertificateThreshold
+	if d, ok := app.Config().AgeThresholds[KindSslCertificates]; ok {
+		threshold = d
+	}
+
+	certs, err := app.ListOrphanedCertificates(ctx, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Deletion, 0, len(certs))
+	for _, cert := range certs {
+		list = append(list, &Deletion{
+			Kind:   KindSslCertificates,
+			Name:   cert.Name,
+			Region: certificateRegion(cert),
+		})
+	}
+	return list, nil
+}
+
+// orphanedTargetPoolDeletions is ListOrphanedTargetPools, for the
+// cleaner of target pools
+func (app *App) orphanedTargetPoolDeletions(ctx context.Context) ([]*Deletion, error) {
+	pools, err := app.ListOrphanedTargetPools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*Deletion
+	for _, tp := range pools {
+		list = append(list, tp.Deletions()...)
+	}
+	return list, nil
+}
+
+func init() {
+	builtin := []*computeCleaner{
+		{kind: KindAddresses, check: (*App).ListUnusedAddresses},
+		{kind: KindBackendServices, check: (*App).ListDanglingBackendServices},
+		{kind: KindFirewalls},
+		{kind: KindForwardingRules},
+		{kind: KindHealthChecks, check: (*App).danglingHealthCheckDeletions},
+		{kind: KindHttpHealthChecks},
+		{kind: KindHttpsHealthChecks},
+		{kind: KindInstanceGroups, check: (*App).ListDanglingInstanceGroups},
+		{kind: KindSslCertificates, check: (*App).orphanedCertificateDeletions},
+		{kind: KindTargetHttpProxies},
+		{kind: KindTargetHttpsProxies},
+		{kind: KindTargetPools, check: (*App).orphanedTargetPoolDeletions},
+		{kind: KindUrlMaps, check: (*App).ListDanglingUrlMaps},
+	}
+	for _, c := range builtin {
+		RegisterCleaner(c)
+	}
+}
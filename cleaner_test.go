@@ -0,0 +1,76 @@
+package autolbclean_test
+
+import (
+	"context"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+type backendBucketCleaner struct{}
+
+func (backendBucketCleaner) Kind() string               { return `backendBuckets` }
+func (backendBucketCleaner) Match(selfLink string) bool { return false }
+func (backendBucketCleaner) Check(context.Context, *autolbclean.App) ([]*autolbclean.Deletion, error) {
+	return nil, nil
+}
+func (backendBucketCleaner) Delete(context.Context, *autolbclean.App, *autolbclean.Deletion) (autolbclean.Operation, error) {
+	return nil, nil
+}
+
+func TestCleaners(t *testing.T) {
+	c, ok := autolbclean.CleanerForSelfLink(`https://www.googleapis.com/compute/v1/projects/p/regions/asia-northeast1/healthChecks/k8s-be-30000`)
+	if !assert.True(t, ok, `regional health checks should have a cleaner`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.KindHealthChecks, c.Kind(), `kind should match`) {
+		return
+	}
+
+	c, ok = autolbclean.CleanerForSelfLink(`https://www.googleapis.com/compute/v1/projects/p/global/httpHealthChecks/k8s-be-30000`)
+	if !assert.True(t, ok, `legacy health checks should have a cleaner`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.KindHttpHealthChecks, c.Kind(), `kind should match`) {
+		return
+	}
+
+	c, ok = autolbclean.CleanerForSelfLink(`https://www.googleapis.com/compute/v1/projects/p/global/sslCertificates/k8s-ssl-1`)
+	if !assert.True(t, ok, `certificates should have a cleaner`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.KindSslCertificates, c.Kind(), `kind should match`) {
+		return
+	}
+
+	task := autolbclean.DeletionTask(&autolbclean.Deletion{
+		Kind: `backendBuckets`,
+		Name: `k8s-bb-1`,
+	}, `2026-10-16T00:00:00Z`)
+	if !assert.Equal(t, `/job/resources/delete`, task.Path, `kinds without a route should go through the dispatcher`) {
+		return
+	}
+	if !assert.Equal(t, `backendBuckets`, task.Params.Get(`type`), `type should match`) {
+		return
+	}
+}
+
+func TestCleanerRegistry(t *testing.T) {
+	r := autolbclean.NewCleanerRegistry()
+	r.Register(backendBucketCleaner{})
+	if !assert.Panics(t, func() { r.Register(backendBucketCleaner{}) }, `registering a kind twice should panic`) {
+		return
+	}
+
+	c, ok := r.Lookup(`backendBuckets`)
+	if !assert.True(t, ok, `registered kinds should be found`) || !assert.Equal(t, `backendBuckets`, c.Kind(), `kind should match`) {
+		return
+	}
+	if !assert.Len(t, r.Cleaners(), 1, `only the registered cleaner should be listed`) {
+		return
+	}
+	if _, ok := autolbclean.LookupCleaner(`backendBuckets`); !assert.False(t, ok, `the default registry should be left alone`) {
+		return
+	}
+}
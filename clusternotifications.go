@@ -0,0 +1,117 @@
+package autolbclean
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clusterDeletedEvent is the name of the cluster notification event
+// that confirms that a cluster was deleted
+const clusterDeletedEvent = `ClusterDeleted`
+
+// pushEnvelope is the body of the requests that Pub/Sub push
+// subscriptions make
+type pushEnvelope struct {
+	Message struct {
+		Attributes  map[string]string `json:"attributes"`
+		Data        []byte            `json:"data"`
+		MessageID   string            `json:"messageId"`
+		PublishTime time.Time         `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// clusterDeletedPayload holds the fields of the event that identify
+// the cluster beyond what the attributes of the message tell
+type clusterDeletedPayload struct {
+	ClusterID string `json:"clusterId"`
+}
+
+// ParseClusterNotification extracts the deleted cluster from the body
+// of a Pub/Sub push request carrying a GKE cluster notification. The
+// attributes of the message name the project, the location and the
+// cluster, and the type_url attribute the event, while the data holds
+// the event itself as JSON. Notifications of any event other than
+// ClusterDeleted yield nil
+func ParseClusterNotification(body []byte) (*DeletedCluster, error) {
+	var envelope pushEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, errors.Wrap(err, `failed to decode push request`)
+	}
+
+	msg := envelope.Message
+	typeURL := msg.Attributes[`type_url`]
+	if typeURL[strings.LastIndexAny(typeURL, `./`)+1:] != clusterDeletedEvent {
+		return nil, nil
+	}
+
+	var payload clusterDeletedPayload
+	if err := json.Unmarshal(msg.Data, &payload); err != nil {
+		return nil, errors.Wrapf(err, `failed to decode %s event`, clusterDeletedEvent)
+	}
+
+	dc := &DeletedCluster{
+		Project:   msg.Attributes[`project_id`],
+		ID:        payload.ClusterID,
+		Name:      msg.Attributes[`cluster_name`],
+		Location:  msg.Attributes[`cluster_location`],
+		DeletedAt: msg.PublishTime.UTC(),
+	}
+	if len(dc.Project) == 0 || len(dc.ID) == 0 {
+		return nil, errors.Errorf(`%s event of message %s does not identify the project and the cluster`, clusterDeletedEvent, msg.MessageID)
+	}
+	if dc.DeletedAt.IsZero() {
+		dc.DeletedAt = time.Now().UTC()
+	}
+	return dc, nil
+}
+
+// replaceDeletedCluster returns list with dc in place of any earlier
+// record of the same cluster
+func replaceDeletedCluster(list []*DeletedCluster, dc *DeletedCluster) []*DeletedCluster {
+	for i, known := range list {
+		if known.ID == dc.ID {
+			list[i] = dc
+			return list
+		}
+	}
+	return append(list, dc)
+}
+
+// markDeletedClusters flags the orphans whose cluster was confirmed
+// deleted. Unlike the heuristics that found them, the notification
+// leaves no doubt that nothing is going to use them again. Without a
+// store that can remember deleted clusters, nothing is flagged
+func (app *App) markDeletedClusters(ctx context.Context, orphans []*Orphan) error {
+	store, ok := app.store.(DeletedClusterStore)
+	if !ok {
+		return nil
+	}
+
+	clusters, err := store.ListDeletedClusters(ctx, app.project)
+	if err != nil {
+		return errors.Wrap(err, `failed to load deleted clusters`)
+	}
+	if len(clusters) == 0 {
+		return nil
+	}
+
+	c := app.Config()
+	for _, o := range orphans {
+		uid := o.Cluster
+		if len(uid) == 0 {
+			uid = c.ClusterOf(o.TargetProxy)
+		}
+		for _, dc := range clusters {
+			if MatchClusterUID(uid, dc.ID) {
+				o.ClusterDeleted = true
+				break
+			}
+		}
+	}
+	return nil
+}
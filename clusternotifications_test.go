@@ -0,0 +1,80 @@
+package autolbclean_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func clusterNotification(typeURL, data string) []byte {
+	return []byte(`{
+  "message": {
+    "attributes": {
+      "cluster_location": "asia-northeast1",
+      "cluster_name": "prod-1",
+      "project_id": "my-project",
+      "type_url": "` + typeURL + `"
+    },
+    "data": "` + base64.StdEncoding.EncodeToString([]byte(data)) + `",
+    "messageId": "1",
+    "publishTime": "2026-10-16T09:00:00Z"
+  },
+  "subscription": "projects/my-project/subscriptions/cluster-notifications"
+}`)
+}
+
+func TestParseClusterNotification(t *testing.T) {
+	dc, err := autolbclean.ParseClusterNotification(clusterNotification(`type.googleapis.com/google.container.v1beta1.ClusterDeleted`, `{"clusterId":"0123456789abcdef0123"}`))
+	if !assert.NoError(t, err, `ParseClusterNotification should succeed`) {
+		return
+	}
+	expected := &autolbclean.DeletedCluster{
+		Project:   `my-project`,
+		ID:        `0123456789abcdef0123`,
+		Name:      `prod-1`,
+		Location:  `asia-northeast1`,
+		DeletedAt: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC),
+	}
+	if !assert.Equal(t, expected, dc, `the deleted cluster should be described by the notification`) {
+		return
+	}
+
+	dc, err = autolbclean.ParseClusterNotification(clusterNotification(`type.googleapis.com/google.container.v1beta1.UpgradeEvent`, `{}`))
+	if !assert.NoError(t, err, `other events should not be errors`) || !assert.Nil(t, dc, `other events should be ignored`) {
+		return
+	}
+
+	if _, err := autolbclean.ParseClusterNotification(clusterNotification(`type.googleapis.com/google.container.v1beta1.ClusterDeleted`, `{}`)); !assert.Error(t, err, `deletions without a cluster id should be rejected`) {
+		return
+	}
+	if _, err := autolbclean.ParseClusterNotification([]byte(`not json`)); !assert.Error(t, err, `malformed requests should be rejected`) {
+		return
+	}
+}
+
+func TestDeletedClusterStore(t *testing.T) {
+	ctx := context.Background()
+	store := autolbclean.NewMemoryStore().(autolbclean.DeletedClusterStore)
+
+	for _, dc := range []*autolbclean.DeletedCluster{
+		{Project: `my-project`, ID: `0123456789abcdef`, Name: `prod-1`},
+		{Project: `my-project`, ID: `0123456789abcdef`, Name: `prod-1`, Location: `asia-northeast1`},
+		{Project: `other-project`, ID: `fedcba9876543210`, Name: `prod-2`},
+	} {
+		if !assert.NoError(t, store.SaveDeletedCluster(ctx, dc), `SaveDeletedCluster should succeed`) {
+			return
+		}
+	}
+
+	list, err := store.ListDeletedClusters(ctx, `my-project`)
+	if !assert.NoError(t, err, `ListDeletedClusters should succeed`) {
+		return
+	}
+	if !assert.Len(t, list, 1, `a cluster should be recorded once`) || !assert.Equal(t, `asia-northeast1`, list[0].Location, `the latest record should win`) {
+		return
+	}
+}
@@ -0,0 +1,129 @@
+package autolbclean
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ClusterUID returns the cluster UID that GKE appends to the names of
+// the resources it creates (k8s-fw-NAMESPACE-NAME--UID), or an empty
+// string if the name does not carry one
+func ClusterUID(name string) string {
+	i := strings.LastIndex(name, `--`)
+	if i < 0 {
+		return ``
+	}
+	return name[i+2:]
+}
+
+// shortClusterUIDLength is how many characters of the cluster UID the
+// ingress controller puts in the names of the k8s1- and k8s2- resources
+// (k8s1-UID8-NAMESPACE-NAME-PORT-HASH, k8s2-KIND-UID8-NAMESPACE-NAME-HASH)
+const shortClusterUIDLength = 8
+
+// clusterPrefixOf returns the UID of the cluster that the named resource
+// belongs to, or the prefix of it that its name carries
+func (c *Config) clusterPrefixOf(name string) string {
+	if uid := c.ClusterOf(name); len(uid) > 0 {
+		return uid
+	}
+
+	var rest string
+	switch {
+	case strings.HasPrefix(name, `k8s1-`):
+		rest = name[len(`k8s1-`):]
+	case strings.HasPrefix(name, `k8s2-`):
+		// skip the two letters of the kind of resource (um, tp, fr...)
+		rest = name[len(`k8s2-`):]
+		if strings.IndexByte(rest, '-') != 2 {
+			return ``
+		}
+		rest = rest[3:]
+	default:
+		return ``
+	}
+	if strings.IndexByte(rest, '-') != shortClusterUIDLength {
+		return ``
+	}
+	return rest[:shortClusterUIDLength]
+}
+
+func (cc *ClusterConvention) prefixes() [][]string {
+	return [][]string{cc.ForwardingRulePrefixes, cc.TargetProxyPrefixes, cc.FirewallTagPrefixes, cc.HealthCheckPrefixes, cc.BackendServicePrefixes, cc.AddressPrefixes}
+}
+
+// ClusterOf returns the UID of the cluster that the named resource
+// belongs to. Custom conventions take precedence over the GKE naming
+// scheme
+func (c *Config) ClusterOf(name string) string {
+	for _, cc := range c.Clusters {
+		for _, prefixes := range cc.prefixes() {
+			if hasAnyPrefix(name, prefixes) {
+				return cc.UID
+			}
+		}
+	}
+	return ClusterUID(name)
+}
+
+func validateClusterConventions(list []*ClusterConvention) error {
+	seen := make(map[string]struct{})
+	for _, cc := range list {
+		if len(cc.UID) == 0 {
+			return errors.New(`uid is required`)
+		}
+		if _, ok := seen[cc.UID]; ok {
+			return errors.Errorf(`duplicate uid %s`, cc.UID)
+		}
+		seen[cc.UID] = struct{}{}
+
+		var n int
+		for _, prefixes := range cc.prefixes() {
+			n += len(prefixes)
+		}
+		if n == 0 {
+			return errors.Errorf(`no prefixes for uid %s`, cc.UID)
+		}
+	}
+	return nil
+}
+
+// clusterPrefixes returns base along with the prefixes that field
+// picks from each of the cluster conventions
+func (c *Config) clusterPrefixes(base []string, field func(*ClusterConvention) []string) []string {
+	conventions := c.conventions()
+	if len(conventions) == 0 {
+		return base
+	}
+
+	list := append([]string(nil), base...)
+	for _, cc := range conventions {
+		list = append(list, field(cc)...)
+	}
+	return list
+}
+
+func (c *Config) forwardingRulePrefixes() []string {
+	return c.clusterPrefixes(c.ForwardingRulePrefixes, func(cc *ClusterConvention) []string { return cc.ForwardingRulePrefixes })
+}
+
+func (c *Config) targetProxyPrefixes() []string {
+	return c.clusterPrefixes(c.TargetProxyPrefixes, func(cc *ClusterConvention) []string { return cc.TargetProxyPrefixes })
+}
+
+func (c *Config) firewallTagPrefixes() []string {
+	return c.clusterPrefixes(c.FirewallTagPrefixes, func(cc *ClusterConvention) []string { return cc.FirewallTagPrefixes })
+}
+
+func (c *Config) healthCheckPrefixes() []string {
+	return c.clusterPrefixes(c.HealthCheckPrefixes, func(cc *ClusterConvention) []string { return cc.HealthCheckPrefixes })
+}
+
+func (c *Config) backendServicePrefixes() []string {
+	return c.clusterPrefixes(c.BackendServicePrefixes, func(cc *ClusterConvention) []string { return cc.BackendServicePrefixes })
+}
+
+func (c *Config) addressPrefixes() []string {
+	return c.clusterPrefixes(c.AddressPrefixes, func(cc *ClusterConvention) []string { return cc.AddressPrefixes })
+}
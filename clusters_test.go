@@ -0,0 +1,88 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterOf(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+clusters:
+  - uid: legacy-cluster
+    forwarding_rule_prefixes: [ "acme-fw-" ]
+    target_proxy_prefixes: [ "acme-tp-" ]
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+
+	list := map[string]string{
+		`acme-fw-web`: `legacy-cluster`,
+		`acme-tp-web`: `legacy-cluster`,
+		`k8s-tp-default-builderscon--c4f34d3824aedd50`: `c4f34d3824aedd50`,
+		`handcrafted-lb`: ``,
+	}
+	for name, expected := range list {
+		if !assert.Equal(t, expected, c.ClusterOf(name), `cluster of %s should match`, name) {
+			return
+		}
+	}
+
+	_, err = autolbclean.ParseConfig([]byte("clusters:\n  - uid: no-prefixes\n"))
+	if !assert.Error(t, err, `ParseConfig should fail without prefixes`) {
+		return
+	}
+}
+
+func TestMatchClusterUID(t *testing.T) {
+	const id = `c4f34d3824aedd50a1b2c3d4e5f60718293a4b5c6d7e8f90`
+	if !assert.True(t, autolbclean.MatchClusterUID(`c4f34d3824aedd50`, id), `uid should match the beginning of the id`) {
+		return
+	}
+	if !assert.False(t, autolbclean.MatchClusterUID(`d4f34d3824aedd50`, id), `uid should not match another id`) {
+		return
+	}
+	if !assert.True(t, autolbclean.MatchClusterUID(`c4f34d38`, id), `the uids of k8s1- and k8s2- names should match the beginning of the id`) {
+		return
+	}
+	if !assert.False(t, autolbclean.MatchClusterUID(`c4f3`, id), `short uids should never match`) {
+		return
+	}
+	if !assert.False(t, autolbclean.MatchClusterUID(``, id), `empty uids should never match`) {
+		return
+	}
+}
+
+func TestMultiClusterIngressConfig(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+multi_cluster_ingress:
+  enabled: true
+  config_clusters: [ "projects/fleet-host/locations/us-central1/clusters/config" ]
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{`projects/fleet-host/locations/us-central1/clusters/config`}, c.MultiClusterIngress.ConfigClusters) {
+		return
+	}
+
+	for _, name := range []string{`mci-y5cdgb-fw-default-web`, `mcs-y5cdgb-80-default-web`} {
+		if !assert.True(t, autolbclean.IsMultiClusterResource(name), `%s should be a multi-cluster resource`, name) {
+			return
+		}
+	}
+	if !assert.False(t, autolbclean.IsMultiClusterResource(`k8s-fw-default-web--c4f34d3824aedd50`)) {
+		return
+	}
+
+	for _, doc := range []string{
+		"multi_cluster_ingress:\n  enabled: true\n",
+		"multi_cluster_ingress:\n  enabled: true\n  config_clusters: [ config ]\n",
+	} {
+		if _, err := autolbclean.ParseConfig([]byte(doc)); !assert.Error(t, err, `ParseConfig should fail without valid config clusters`) {
+			return
+		}
+	}
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// cliFlags are the flags shared by the scan, clean and report commands
+type cliFlags struct {
+	project       string
+	configURL     string
+	ageThreshold  time.Duration
+	ageThresholds string
+}
+
+func (f *cliFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.project, "project", os.Getenv("GCP_PROJECT_ID"), "GCP project ID to clean up")
+	fs.StringVar(&f.configURL, "config", "", "location of the cleanup configuration (file, gs://, or sm://)")
+	fs.DurationVar(&f.ageThreshold, "age-threshold", 0, "load balancers younger than this are never deleted (overrides the configuration)")
+	fs.StringVar(&f.ageThresholds, "age-thresholds", "", "comma separated KIND=DURATION, overriding the age threshold of the given resource kinds")
+}
+
+// app creates the App described by the flags. Problems are reported to
+// stderr, and the returned exit code is non-zero
+func (f *cliFlags) app(ctx context.Context) (*autolbclean.App, int) {
+	if len(f.project) == 0 {
+		fmt.Fprintf(stderr, "--project (or GCP_PROJECT_ID) is required\n")
+		return nil, autolbclean.ExitUsage
+	}
+
+	thresholds, err := autolbclean.ParseAgeThresholds(f.ageThresholds)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid --age-thresholds: %s\n", err)
+		return nil, autolbclean.ExitUsage
+	}
+
+	app, err := newApp(ctx, f.project, f.configURL)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return nil, autolbclean.ExitError
+	}
+
+	if f.ageThreshold > 0 || len(thresholds) > 0 {
+		app.SetConfig(app.Config().WithAgeThresholds(f.ageThreshold, thresholds))
+	}
+	return app, autolbclean.ExitClean
+}
+
+func writeResult(result *autolbclean.WorkerResult) int {
+	if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
+		fmt.Fprintf(stderr, "failed to encode result: %s\n", err)
+		return autolbclean.ExitError
+	}
+	return result.ExitCode
+}
+
+// cmdScan lists the orphaned load balancers and what would be deleted,
+// without deleting anything
+func cmdScan(args []string) int {
+	var f cliFlags
+	fs := flag.NewFlagSet(`scan`, flag.ContinueOnError)
+	f.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+
+	ctx := context.Background()
+	app, code := f.app(ctx)
+	if app == nil {
+		return code
+	}
+	return writeResult(app.RunWorker(ctx, true))
+}
+
+// cmdClean deletes the orphaned load balancers synchronously, walking
+// their resources in dependency order
+func cmdClean(args []string) int {
+	var f cliFlags
+	var dryRun bool
+	fs := flag.NewFlagSet(`clean`, flag.ContinueOnError)
+	f.register(fs)
+	fs.BoolVar(&dryRun, "dry-run", false, "only report what would be deleted")
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+
+	ctx := context.Background()
+	app, code := f.app(ctx)
+	if app == nil {
+		return code
+	}
+	return writeResult(app.RunWorker(ctx, dryRun))
+}
+
+// cmdReport writes the human readable run report, including quota
+// usage, or its findings as JSON or SARIF
+func cmdReport(args []string) int {
+	var f cliFlags
+	var format string
+	var team string
+	var redact bool
+	fs := flag.NewFlagSet(`report`, flag.ContinueOnError)
+	f.register(fs)
+	fs.StringVar(&format, "format", autolbclean.ReportFormatText, "how to write the report (text, json or sarif)")
+	fs.StringVar(&team, "team", "", "only report the load balancers of this team (see teams in the configuration)")
+	fs.BoolVar(&redact, "redact", false, "redact the findings as set by export_redaction in the configuration (json and sarif only)")
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+
+	if _, err := autolbclean.ParseReportFormat(format); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitUsage
+	}
+	if redact && format == autolbclean.ReportFormatText {
+		fmt.Fprintf(stderr, "-redact requires -format=json or -format=sarif\n")
+		return autolbclean.ExitUsage
+	}
+
+	ctx := context.Background()
+	app, code := f.app(ctx)
+	if app == nil {
+		return code
+	}
+
+	report := &autolbclean.Report{
+		Project:   f.project,
+		StartedAt: time.Now().UTC(),
+	}
+
+	orphans, err := app.PreviewOrphans(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to find orphans: %s\n", err)
+		return autolbclean.ExitError
+	}
+	report.Orphans = orphans
+
+	// the report is still useful without quotas
+	if quotas, err := app.ListQuotas(ctx); err == nil {
+		report.Quotas = quotas
+	} else {
+		fmt.Fprintf(stderr, "failed to list quotas: %s\n", err)
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	if len(team) > 0 {
+		report = report.ForTeam(app.Config(), team)
+	}
+
+	// credentials that made it into the report are removed, just like
+	// in /admin/report
+	var buf bytes.Buffer
+	if redact {
+		err = autolbclean.WriteFindings(&buf, report.Findings().Redact(&app.Config().ExportRedaction), format)
+	} else {
+		err = autolbclean.WriteReport(&buf, report, format)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitError
+	}
+	os.Stdout.WriteString(autolbclean.Redact(buf.String()))
+	return autolbclean.ExitClean
+}
+
+// cmdGraph writes the resources of the load balancers, and the
+// references between them, for Graphviz or as JSON
+func cmdGraph(args []string) int {
+	var f cliFlags
+	var format string
+	var team string
+	fs := flag.NewFlagSet(`graph`, flag.ContinueOnError)
+	f.register(fs)
+	fs.StringVar(&format, "format", autolbclean.GraphFormatDOT, "how to write the graph (dot or json)")
+	fs.StringVar(&team, "team", "", "only include the load balancers of this team (see teams in the configuration)")
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+
+	if _, err := autolbclean.ParseGraphFormat(format); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitUsage
+	}
+
+	ctx := context.Background()
+	app, code := f.app(ctx)
+	if app == nil {
+		return code
+	}
+
+	c := app.Config()
+	g, err := app.ResourceGraph(ctx, func(o *autolbclean.Orphan) bool {
+		return len(team) == 0 || c.TeamOf(o) == team
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to build resource graph: %s\n", err)
+		return autolbclean.ExitError
+	}
+	if err := autolbclean.WriteGraph(os.Stdout, g, format); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitError
+	}
+	return autolbclean.ExitClean
+}
+
+// cmdExplain writes, as JSON, why the load balancer of the named
+// forwarding rule would be deleted, or which check would keep it
+func cmdExplain(args []string) int {
+	var f cliFlags
+	var region string
+	var storeLocation string
+	fs := flag.NewFlagSet(`explain`, flag.ContinueOnError)
+	f.register(fs)
+	fs.StringVar(&region, "region", "", "region of the forwarding rule (empty for global forwarding rules)")
+	fs.StringVar(&storeLocation, "store", "", "where the orphan candidates are persisted, to complete forwarding rule names from (gs://BUCKET/PREFIX or firestore://PROJECT/PREFIX)")
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(stderr, "usage: autolbclean explain -project=... [-region=...] FORWARDING_RULE\n")
+		return autolbclean.ExitUsage
+	}
+
+	ctx := context.Background()
+	app, code := f.app(ctx)
+	if app == nil {
+		return code
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent(``, `  `)
+	if err := enc.Encode(app.Explain(ctx, fs.Arg(0), region)); err != nil {
+		fmt.Fprintf(stderr, "failed to encode explanation: %s\n", err)
+		return autolbclean.ExitError
+	}
+	return autolbclean.ExitClean
+}
+
+// cmdExport translates a plan, as written by scan or a plan only run,
+// into a Cloud Workflows definition or a Cloud Build config
+func cmdExport(args []string) int {
+	var planFile string
+	var format string
+	fs := flag.NewFlagSet(`export`, flag.ContinueOnError)
+	fs.StringVar(&planFile, "plan", "-", "file holding the plan, or - for stdin")
+	fs.StringVar(&format, "format", autolbclean.ExportFormatWorkflows, "what to export the plan to (workflows or cloudbuild)")
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+
+	if _, err := autolbclean.ParseExportFormat(format); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitUsage
+	}
+
+	in := os.Stdin
+	if planFile != `-` {
+		f, err := os.Open(planFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to open plan: %s\n", err)
+			return autolbclean.ExitUsage
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var plan autolbclean.WorkerResult
+	if err := json.NewDecoder(in).Decode(&plan); err != nil {
+		fmt.Fprintf(stderr, "failed to decode plan: %s\n", err)
+		return autolbclean.ExitUsage
+	}
+	if plan.Status == autolbclean.StatusError {
+		fmt.Fprintf(stderr, "plan comes from a run that failed: %s\n", plan.Error)
+		return autolbclean.ExitUsage
+	}
+
+	buf, err := autolbclean.ExportPlan(&plan, format)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitError
+	}
+	os.Stdout.Write(buf)
+	return autolbclean.ExitClean
+}
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, `,`)
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// cmdGenerate creates the Cloud Monitoring dashboard and alert policies
+// for the metrics reported by the canary, or just prints them
+func cmdGenerate(args []string) int {
+	if len(args) == 0 || args[0] != `monitoring` {
+		fmt.Fprintf(stderr, "usage: autolbclean generate monitoring [-project=...] [-print]\n")
+		return autolbclean.ExitUsage
+	}
+
+	var project string
+	var printOnly bool
+	var opts autolbclean.MonitoringOptions
+	var channels stringList
+	fs := flag.NewFlagSet(`generate monitoring`, flag.ContinueOnError)
+	fs.StringVar(&project, "project", os.Getenv("GCP_PROJECT_ID"), "GCP project ID to create the dashboard and alert policies in (the canary project)")
+	fs.BoolVar(&printOnly, "print", false, "print the dashboard and alert policies as JSON instead of creating them")
+	fs.DurationVar(&opts.CanaryInterval, "canary-interval", autolbclean.DefaultCanaryInterval, "how often the canary runs")
+	fs.Var(&channels, "notification-channel", "notification channel (projects/P/notificationChannels/ID) to send alerts to, can be repeated")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return autolbclean.ExitUsage
+	}
+	opts.NotificationChannels = channels
+
+	if printOnly {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent(``, `  `)
+		err := enc.Encode(map[string]interface{}{
+			`dashboard`:      autolbclean.MonitoringDashboard(),
+			`alert_policies`: autolbclean.MonitoringAlertPolicies(&opts),
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to encode monitoring configuration: %s\n", err)
+			return autolbclean.ExitError
+		}
+		return autolbclean.ExitClean
+	}
+
+	if len(project) == 0 {
+		fmt.Fprintf(stderr, "-project (or GCP_PROJECT_ID) is required\n")
+		return autolbclean.ExitUsage
+	}
+
+	ctx := context.Background()
+	app, err := newApp(ctx, project, ``)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitError
+	}
+	if err := app.InstallMonitoring(ctx, &opts); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitError
+	}
+	return autolbclean.ExitClean
+}
+
+// cmdSuppressions exports the suppressions and the snoozes of the admin
+// state in the store as a YAML document, or imports them from one
+func cmdSuppressions(args []string) int {
+	if len(args) == 0 || (args[0] != `export` && args[0] != `import`) {
+		fmt.Fprintf(stderr, "usage: autolbclean suppressions export|import -store=... [-file=...] [-replace]\n")
+		return autolbclean.ExitUsage
+	}
+
+	var storeLocation string
+	var file string
+	var replace bool
+	fs := flag.NewFlagSet(`suppressions `+args[0], flag.ContinueOnError)
+	fs.StringVar(&storeLocation, "store", "", "where the admin state is persisted (gs://BUCKET/PREFIX or firestore://PROJECT/PREFIX)")
+	fs.StringVar(&file, "file", "-", "file to export to or import from, or - for stdout or stdin")
+	fs.BoolVar(&replace, "replace", false, "replace the suppressions and snoozes with the imported ones, instead of merging them")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return autolbclean.ExitUsage
+	}
+	if len(storeLocation) == 0 {
+		fmt.Fprintf(stderr, "-store is required\n")
+		return autolbclean.ExitUsage
+	}
+
+	ctx := context.Background()
+	store, err := openStore(ctx, storeLocation)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitUsage
+	}
+
+	if args[0] == `export` {
+		st, err := store.LoadAdminState(ctx)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to load admin state: %s\n", err)
+			return autolbclean.ExitError
+		}
+		buf, err := yaml.Marshal(autolbclean.ExportSuppressions(st))
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to encode suppressions: %s\n", err)
+			return autolbclean.ExitError
+		}
+		if file == `-` {
+			os.Stdout.Write(buf)
+			return autolbclean.ExitClean
+		}
+		if err := ioutil.WriteFile(file, buf, 0644); err != nil {
+			fmt.Fprintf(stderr, "failed to write suppressions: %s\n", err)
+			return autolbclean.ExitError
+		}
+		return autolbclean.ExitClean
+	}
+
+	var buf []byte
+	if file == `-` {
+		buf, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		buf, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to read suppressions: %s\n", err)
+		return autolbclean.ExitUsage
+	}
+	l, err := autolbclean.ParseSuppressionList(buf)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitUsage
+	}
+
+	err = store.UpdateAdminState(ctx, func(st *autolbclean.AdminState) {
+		l.Apply(st, replace)
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to update admin state: %s\n", err)
+		return autolbclean.ExitError
+	}
+	return autolbclean.ExitClean
+}
+
+// cmdAudit queries the deletion events in the history of the store,
+// and writes a page of them as JSON. The next page is queried by
+// passing the next_cursor of the page to -cursor
+func cmdAudit(args []string) int {
+	var project string
+	var configURL string
+	var storeLocation string
+	var q autolbclean.EventQuery
+	var since string
+	var until string
+	fs := flag.NewFlagSet(`audit`, flag.ContinueOnError)
+	fs.StringVar(&project, "project", os.Getenv("GCP_PROJECT_ID"), "GCP project ID whose deletion events to query")
+	fs.StringVar(&configURL, "config", "", "location of the cleanup configuration (file, gs://, or sm://)")
+	fs.StringVar(&storeLocation, "store", "", "where the history is persisted (firestore://PROJECT/PREFIX)")
+	fs.StringVar(&q.Kind, "kind", "", "only include events of this resource kind (e.g. forwardingRules)")
+	fs.StringVar(&q.Cluster, "cluster", "", "only include events of the cluster with this UID, or UID prefix of at least 8 characters")
+	fs.StringVar(&q.Outcome, "outcome", "", "only include events with this outcome (scheduled, skipped, deleted, failed or expired)")
+	fs.StringVar(&since, "since", "", "only include events at or after this time (RFC 3339, YYYY-MM-DD, or a duration ago such as 7d)")
+	fs.StringVar(&until, "until", "", "only include events before this time (RFC 3339, YYYY-MM-DD, or a duration ago such as 7d)")
+	fs.IntVar(&q.Limit, "limit", autolbclean.DefaultEventQueryLimit, "the most events to write")
+	fs.StringVar(&q.Cursor, "cursor", "", "next_cursor of the previous page")
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+	if len(project) == 0 {
+		fmt.Fprintf(stderr, "--project (or GCP_PROJECT_ID) is required\n")
+		return autolbclean.ExitUsage
+	}
+	if len(storeLocation) == 0 {
+		fmt.Fprintf(stderr, "-store is required\n")
+		return autolbclean.ExitUsage
+	}
+
+	now := time.Now().UTC()
+	for _, v := range []struct {
+		name string
+		s    string
+		dst  *time.Time
+	}{{`since`, since, &q.Since}, {`until`, until, &q.Until}} {
+		if len(v.s) == 0 {
+			continue
+		}
+		t, err := autolbclean.ParseQueryTime(v.s, now)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid -%s: %s\n", v.name, err)
+			return autolbclean.ExitUsage
+		}
+		*v.dst = t
+	}
+	if err := q.Validate(); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitUsage
+	}
+
+	ctx := context.Background()
+	store, err := openStore(ctx, storeLocation)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitUsage
+	}
+	app, err := newApp(ctx, project, configURL, autolbclean.WithStore(store))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitError
+	}
+
+	page, err := app.QueryEvents(ctx, &q)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to query deletion events: %s\n", err)
+		return autolbclean.ExitError
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent(``, `  `)
+	if err := enc.Encode(page); err != nil {
+		fmt.Fprintf(stderr, "failed to encode events: %s\n", err)
+		return autolbclean.ExitError
+	}
+	return autolbclean.ExitClean
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+)
+
+// completedCommands lists the subcommands that are completed, with the
+// positional arguments they expect before their flags. Their flags are
+// taken from their flag sets
+var completedCommands = []struct {
+	name string
+	run  func([]string) int
+	args []string
+}{
+	{name: `once`, run: cmdOnce},
+	{name: `scan`, run: cmdScan},
+	{name: `clean`, run: cmdClean},
+	{name: `report`, run: cmdReport},
+	{name: `graph`, run: cmdGraph},
+	{name: `explain`, run: cmdExplain},
+	{name: `export`, run: cmdExport},
+	{name: `generate`, run: cmdGenerate, args: []string{`monitoring`}},
+	{name: `suppressions`, run: cmdSuppressions, args: []string{`export`, `import`}},
+	{name: `audit`, run: cmdAudit},
+	{name: `run`, run: cmdRun},
+	{name: `install`, run: cmdInstall},
+	{name: `uninstall`, run: cmdUninstall},
+}
+
+// commandFlags returns the flags of each subcommand, by calling it with
+// parseFlags set to record its flag set instead of parsing it
+func commandFlags() map[string][]string {
+	describedFlags = make(map[string]*flag.FlagSet)
+	defer func() { describedFlags = nil }()
+
+	flags := make(map[string][]string)
+	for _, cmd := range completedCommands {
+		var args []string
+		if len(cmd.args) > 0 {
+			args = cmd.args[:1]
+		}
+		cmd.run(args)
+
+		fs, ok := describedFlags[cmd.name]
+		if !ok {
+			continue
+		}
+		names := []string{}
+		fs.VisitAll(func(f *flag.Flag) {
+			names = append(names, f.Name)
+		})
+		flags[cmd.name] = names
+	}
+	return flags
+}
+
+// flagValues lists the values that flags with a fixed set of values
+// take, by subcommand, as the same flag may take different values in
+// different subcommands. Flags that take a file name are completed
+// with file names
+var flagValues = map[string]map[string][]string{
+	`once`: {
+		`partial-plan`: {autolbclean.PartialPlanFail, autolbclean.PartialPlanResume, autolbclean.PartialPlanDiscard},
+	},
+	`export`: {
+		`format`: {autolbclean.ExportFormatWorkflows, autolbclean.ExportFormatCloudBuild},
+	},
+	`report`: {
+		`format`: {autolbclean.ReportFormatText, autolbclean.ReportFormatJSON, autolbclean.ReportFormatSARIF},
+	},
+	`graph`: {
+		`format`: {autolbclean.GraphFormatDOT, autolbclean.GraphFormatJSON},
+	},
+	`audit`: {
+		`outcome`: {autolbclean.DecisionScheduled, autolbclean.DecisionSkipped, autolbclean.DecisionDeleted, autolbclean.DecisionFailed, autolbclean.DecisionExpired},
+	},
+}
+
+var fileFlags = []string{`config`, `plan`, `plan-dir`, `file`}
+
+const bashCompletion = `# bash completion for autolbclean. Load it with
+#   source <(autolbclean completion bash)
+_autolbclean() {
+    local cur prev cmd flags
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=( $(compgen -W "{{ .Commands }}" -- "$cur") )
+        return
+    fi
+    cmd="${COMP_WORDS[1]}"
+    # without a subcommand, autolbclean runs once
+    case "$cmd" in
+        -*) cmd=once ;;
+    esac
+
+    case "$cmd:$prev" in
+{{- range .Values }}
+        {{ .Command }}:-{{ .Flag }}|{{ .Command }}:--{{ .Flag }})
+            COMPREPLY=( $(compgen -W "{{ .Values }}" -- "$cur") )
+            return
+            ;;
+{{- end }}
+    esac
+
+    case "$prev" in
+        {{ .FileFlags }})
+            COMPREPLY=( $(compgen -f -- "$cur") )
+            return
+            ;;
+    esac
+
+    case "$cmd" in
+{{- range .Args }}
+        {{ .Command }})
+            if [ "$COMP_CWORD" -eq 2 ]; then
+                COMPREPLY=( $(compgen -W "{{ .Values }}" -- "$cur") )
+                return
+            fi
+            ;;
+{{- end }}
+    esac
+
+    # complete the names of the orphaned forwarding rules from the
+    # candidates cache, when it is known
+    if [ "$cmd" = explain ] && [ "${cur#-}" = "$cur" ]; then
+        local i word project store
+        for (( i=2; i < COMP_CWORD; i++ )); do
+            word="${COMP_WORDS[i]#-}"
+            word="${word#-}"
+            case "$word" in
+                project=*) project="${word#project=}" ;;
+                store=*) store="${word#store=}" ;;
+                project) project="${COMP_WORDS[i+1]}" ;;
+                store) store="${COMP_WORDS[i+1]}" ;;
+            esac
+        done
+        if [ -n "$store" ]; then
+            COMPREPLY=( $(compgen -W "$(autolbclean completion names -project="${project:-$GCP_PROJECT_ID}" -store="$store" 2>/dev/null)" -- "$cur") )
+            return
+        fi
+    fi
+
+    case "$cmd" in
+{{- range .Flags }}
+        {{ .Command }}) flags="{{ .Values }}" ;;
+{{- end }}
+        *) flags="" ;;
+    esac
+    COMPREPLY=( $(compgen -W "$flags" -- "$cur") )
+}
+complete -o default -F _autolbclean autolbclean
+`
+
+// zsh can use the bash completion through bashcompinit
+const zshPreamble = `# zsh completion for autolbclean. Load it with
+#   source <(autolbclean completion zsh)
+autoload -U +X compinit && compinit
+autoload -U +X bashcompinit && bashcompinit
+`
+
+type completionEntry struct {
+	Command string
+	Flag    string
+	Values  string
+}
+
+type completionData struct {
+	Commands  string
+	FileFlags string
+	Values    []completionEntry
+	Args      []completionEntry
+	Flags     []completionEntry
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedCommands(m map[string]map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeCompletion(w io.Writer, shell string) error {
+	var data completionData
+
+	flags := commandFlags()
+	commands := []string{`completion`}
+	for _, cmd := range completedCommands {
+		commands = append(commands, cmd.name)
+	}
+	sort.Strings(commands)
+	data.Commands = strings.Join(commands, ` `)
+
+	var fileFlagPatterns []string
+	for _, name := range fileFlags {
+		fileFlagPatterns = append(fileFlagPatterns, `-`+name, `--`+name)
+	}
+	data.FileFlags = strings.Join(fileFlagPatterns, `|`)
+
+	for _, cmd := range sortedCommands(flagValues) {
+		values := flagValues[cmd]
+		for _, name := range sortedKeys(values) {
+			data.Values = append(data.Values, completionEntry{Command: cmd, Flag: name, Values: strings.Join(values[name], ` `)})
+		}
+	}
+	data.Args = append(data.Args, completionEntry{Command: `completion`, Values: `bash zsh`})
+	for _, cmd := range completedCommands {
+		if len(cmd.args) > 0 {
+			data.Args = append(data.Args, completionEntry{Command: cmd.name, Values: strings.Join(cmd.args, ` `)})
+		}
+	}
+	for _, cmd := range sortedKeys(flags) {
+		var names []string
+		for _, name := range flags[cmd] {
+			names = append(names, `-`+name)
+		}
+		data.Flags = append(data.Flags, completionEntry{Command: cmd, Values: strings.Join(names, ` `)})
+	}
+
+	switch shell {
+	case `bash`:
+	case `zsh`:
+		if _, err := io.WriteString(w, zshPreamble); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf(`unsupported shell %s (expected bash or zsh)`, shell)
+	}
+	return template.Must(template.New(`completion`).Parse(bashCompletion)).Execute(w, data)
+}
+
+// writeNames writes the names of the orphaned forwarding rules in the
+// candidates cache of the project, one per line
+func writeNames(w io.Writer, args []string) int {
+	var project string
+	var storeLocation string
+	fs := flag.NewFlagSet(`completion names`, flag.ContinueOnError)
+	fs.StringVar(&project, "project", os.Getenv("GCP_PROJECT_ID"), "GCP project ID of the candidates")
+	fs.StringVar(&storeLocation, "store", "", "where the orphan candidates are persisted (gs://BUCKET/PREFIX or firestore://PROJECT/PREFIX)")
+	if err := fs.Parse(args); err != nil {
+		return autolbclean.ExitUsage
+	}
+	if len(project) == 0 || len(storeLocation) == 0 {
+		fmt.Fprintf(stderr, "-project and -store are required\n")
+		return autolbclean.ExitUsage
+	}
+
+	ctx := context.Background()
+	store, err := openStore(ctx, storeLocation)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitUsage
+	}
+	candidates, err := store.ListCandidates(ctx, project)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to list candidates: %s\n", err)
+		return autolbclean.ExitError
+	}
+
+	seen := make(map[string]struct{})
+	var names []string
+	for _, c := range candidates {
+		if len(c.ForwardingRule) == 0 {
+			continue
+		}
+		if _, ok := seen[c.ForwardingRule]; ok {
+			continue
+		}
+		seen[c.ForwardingRule] = struct{}{}
+		names = append(names, c.ForwardingRule)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+	return autolbclean.ExitClean
+}
+
+// cmdCompletion writes the shell completion script for the given shell,
+// or the names that the script completes
+func cmdCompletion(args []string) int {
+	if len(args) > 0 && args[0] == `names` {
+		return writeNames(os.Stdout, args[1:])
+	}
+	if len(args) != 1 {
+		fmt.Fprintf(stderr, "usage: autolbclean completion bash|zsh\n")
+		return autolbclean.ExitUsage
+	}
+
+	if err := writeCompletion(os.Stdout, args[0]); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitUsage
+	}
+	return autolbclean.ExitClean
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2/google"
+	compute "google.golang.org/api/compute/v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const defaultInterval = 10 * time.Minute
+const defaultRollupInterval = 24 * time.Hour
+const defaultCanaryInterval = 6 * time.Hour
+const canaryPollInterval = time.Minute
+const gcInterval = 24 * time.Hour
+
+// daemonConfig is the configuration for the long running standalone mode
+type daemonConfig struct {
+	Project  string        `yaml:"project"`
+	Projects []string      `yaml:"projects"`
+	Interval time.Duration `yaml:"interval"`
+	PlanOnly bool          `yaml:"plan_only"`
+
+	// The following apply to each project separately, so that a project
+	// with broken permissions or a huge inventory can not stall the rest
+	MaxDeletionsPerRun int           `yaml:"max_deletions_per_run"`
+	RateLimit          float64       `yaml:"rate_limit"` // API requests per second
+	BreakerThreshold   int           `yaml:"breaker_threshold"`
+	BreakerCooldown    time.Duration `yaml:"breaker_cooldown"`
+
+	// QuotaProject is the project API quota is billed to, or "scanned"
+	// for each project being cleaned up. RequestReason is attached to
+	// every API call
+	QuotaProject  string `yaml:"quota_project"`
+	RequestReason string `yaml:"request_reason"`
+
+	// TerraformWebhook receives the load balancers that are managed by
+	// Terraform (see terraform in the cleanup configuration) as JSON
+	TerraformWebhook string `yaml:"terraform_webhook"`
+
+	// Config is the cleanup configuration. Alternatively, ConfigURL
+	// may point to a file, GCS object, or Secret Manager secret holding
+	// it, which is then re-read at the start of each run
+	Config    autolbclean.Config `yaml:"config"`
+	ConfigURL string             `yaml:"config_url"`
+
+	// PlanDir is where the plan of each project is persisted while it
+	// is computed. PartialPlan decides what happens to the plan of a
+	// run that was interrupted, e.g. by the machine going down, unless
+	// it is older than PlanMaxAge
+	PlanDir     string        `yaml:"plan_dir"`
+	PartialPlan string        `yaml:"partial_plan"`
+	PlanMaxAge  time.Duration `yaml:"plan_max_age"`
+
+	// Impersonate names the service account to call the APIs as, for
+	// each project. Projects not listed use the default credentials
+	Impersonate map[string]string `yaml:"impersonate"`
+
+	// ExecutorImpersonate names the service account that deletions are
+	// made as, for each project. Discovery keeps using the credentials
+	// above, which then only need to be allowed to read
+	ExecutorImpersonate map[string]string `yaml:"executor_impersonate"`
+
+	// EventTopic is the Pub/Sub topic (projects/P/topics/T) that
+	// deletion events are published to
+	EventTopic string `yaml:"event_topic"`
+
+	// AuditTable is the BigQuery table (project.dataset.table) that
+	// check decisions and deletion results are recorded in
+	AuditTable string `yaml:"audit_table"`
+
+	// Store is where the run status, the orphan candidates and the
+	// admin state are persisted (memory, gs://BUCKET/PREFIX, or
+	// firestore://PROJECT/PREFIX). It is shared by all projects
+	Store string `yaml:"store"`
+
+	// Rollup configures the organization-wide summary of the latest
+	// runs of all projects. It is only produced in multi-project mode
+	Rollup rollupConfig `yaml:"rollup"`
+
+	// Telemetry opts in to sending anonymous usage counters
+	Telemetry telemetryConfig `yaml:"telemetry"`
+
+	// Metrics makes each run write the number of orphans it found and
+	// of resources it deleted to Cloud Monitoring
+	Metrics bool `yaml:"metrics"`
+
+	// Canary configures the periodic creation of a test load balancer
+	// in a sandbox project, which must be one of the projects that are
+	// cleaned up, to verify that the cleaner still works
+	Canary canaryConfig `yaml:"canary"`
+}
+
+type canaryConfig struct {
+	Project  string        `yaml:"project"` // if empty, no canaries are created
+	Interval time.Duration `yaml:"interval"`
+	Deadline time.Duration `yaml:"deadline"` // how long the cleaner may take to delete a canary
+}
+
+type telemetryConfig struct {
+	Endpoint string `yaml:"endpoint"` // if empty, nothing is sent
+}
+
+type rollupConfig struct {
+	Interval   time.Duration `yaml:"interval"`
+	WebhookURL string        `yaml:"webhook_url"` // if empty, the rollup is only logged
+
+	// Redaction applies to the rollup sent to the webhook. The logged
+	// rollup is never redacted
+	Redaction autolbclean.ExportRedaction `yaml:"redaction"`
+}
+
+func loadDaemonConfig(filename string) (*daemonConfig, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to read configuration file %s`, filename)
+	}
+
+	c := daemonConfig{
+		Config:           *autolbclean.DefaultConfig(),
+		BreakerThreshold: 3,
+		BreakerCooldown:  time.Hour,
+	}
+	if err := yaml.Unmarshal(buf, &c); err != nil {
+		return nil, errors.Wrapf(err, `failed to parse configuration file %s`, filename)
+	}
+
+	if len(c.Project) > 0 {
+		c.Projects = append([]string{c.Project}, c.Projects...)
+	}
+	if len(c.Projects) == 0 {
+		return nil, errors.Errorf(`project or projects must be specified in %s`, filename)
+	}
+
+	if err := c.Config.ValidateStandalone(); err != nil {
+		return nil, errors.Wrapf(err, `invalid configuration in %s`, filename)
+	}
+	if len(c.Store) > 0 {
+		if err := autolbclean.ValidateStoreLocation(c.Store); err != nil {
+			return nil, errors.Wrapf(err, `invalid store in %s`, filename)
+		}
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = defaultInterval
+	}
+	if len(c.PartialPlan) == 0 {
+		c.PartialPlan = autolbclean.PartialPlanResume
+	}
+	if _, err := autolbclean.ParsePartialPlanPolicy(c.PartialPlan); err != nil {
+		return nil, errors.Wrapf(err, `invalid partial_plan in %s`, filename)
+	}
+	if c.PlanMaxAge <= 0 {
+		c.PlanMaxAge = autolbclean.DefaultPlanMaxAge
+	}
+
+	for project, sa := range c.Impersonate {
+		if err := autolbclean.ValidateServiceAccount(sa); err != nil {
+			return nil, errors.Wrapf(err, `invalid impersonation for project %s in %s`, project, filename)
+		}
+	}
+	for project, sa := range c.ExecutorImpersonate {
+		if err := autolbclean.ValidateServiceAccount(sa); err != nil {
+			return nil, errors.Wrapf(err, `invalid executor impersonation for project %s in %s`, project, filename)
+		}
+	}
+
+	if len(c.Canary.Project) > 0 {
+		var found bool
+		for _, project := range c.Projects {
+			if project == c.Canary.Project {
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.Errorf(`canary project %s must be one of the projects in %s`, c.Canary.Project, filename)
+		}
+		if c.Canary.Interval <= 0 {
+			c.Canary.Interval = defaultCanaryInterval
+		}
+		// the canary is only considered orphaned once it is older than
+		// the age threshold, give the cleaner a few runs after that
+		if c.Canary.Deadline <= 0 {
+			c.Canary.Deadline = c.Config.AgeThreshold + 3*c.Interval
+		}
+	}
+
+	if c.Rollup.Interval <= 0 {
+		c.Rollup.Interval = defaultRollupInterval
+	}
+	if err := c.Rollup.Redaction.Validate(); err != nil {
+		return nil, errors.Wrap(err, `invalid rollup.redaction`)
+	}
+	return &c, nil
+}
+
+// daemon runs a cleanup pass for each project periodically, until it
+// is stopped. Each project is handled by its own worker goroutine
+type daemon struct {
+	configFile string
+	mu         sync.Mutex
+	config     *daemonConfig
+	breakers   map[string]*autolbclean.CircuitBreaker
+	results    map[string]*autolbclean.WorkerResult // latest result of each project
+	telemetry  *autolbclean.Telemetry
+	reloadCh   chan struct{}
+	stores     map[string]autolbclean.Store // by location, so that they survive reloads
+}
+
+func newDaemon(configFile string) (*daemon, error) {
+	c, err := loadDaemonConfig(configFile)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to load configuration`)
+	}
+
+	return &daemon{
+		configFile: configFile,
+		config:     c,
+		breakers:   make(map[string]*autolbclean.CircuitBreaker),
+		results:    make(map[string]*autolbclean.WorkerResult),
+		stores:     make(map[string]autolbclean.Store),
+		telemetry:  autolbclean.NewTelemetry(`daemon`),
+		reloadCh:   make(chan struct{}, 1),
+	}, nil
+}
+
+// Reload asks the daemon to re-read its configuration file. If the new
+// configuration is invalid, the daemon keeps on using the old one
+func (d *daemon) Reload() {
+	select {
+	case d.reloadCh <- struct{}{}:
+	default:
+	}
+}
+
+func (d *daemon) currentConfig() *daemonConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.config
+}
+
+func (d *daemon) reload() {
+	c, err := loadDaemonConfig(d.configFile)
+	if err != nil {
+		log.Printf("failed to reload configuration, keeping the current one: %s", err)
+		return
+	}
+
+	d.mu.Lock()
+	d.config = c
+	// breakers are rebuilt so that the new thresholds take effect, and
+	// so that projects that were fixed by the new configuration get
+	// another chance right away
+	d.breakers = make(map[string]*autolbclean.CircuitBreaker)
+	d.mu.Unlock()
+	log.Printf("reloaded configuration from %s", d.configFile)
+}
+
+func (d *daemon) breaker(project string) *autolbclean.CircuitBreaker {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b, ok := d.breakers[project]
+	if !ok {
+		b = autolbclean.NewCircuitBreaker(d.config.BreakerThreshold, d.config.BreakerCooldown)
+		d.breakers[project] = b
+	}
+	return b
+}
+
+// Run runs the project workers until ctx is canceled. The canary, the
+// rollup and the garbage collection are not restarted on reloads, so
+// that they keep their schedule, and pick up the configuration that is
+// current each time they are due
+func (d *daemon) Run(ctx context.Context) {
+	var bg sync.WaitGroup
+	defer bg.Wait()
+	for _, f := range []func(context.Context){d.runCanary, d.runRollup, d.runGC} {
+		bg.Add(1)
+		go func(f func(context.Context)) {
+			defer bg.Done()
+			f(ctx)
+		}(f)
+	}
+
+	for {
+		c := d.currentConfig()
+
+		// workers finish the run they are in the middle of before
+		// they stop for a reload
+		stopCh := make(chan struct{})
+		var wg sync.WaitGroup
+		for _, project := range c.Projects {
+			wg.Add(1)
+			go func(project string) {
+				defer wg.Done()
+				d.runProject(ctx, stopCh, c, project)
+			}(project)
+		}
+
+		select {
+		case <-ctx.Done():
+			close(stopCh)
+			wg.Wait()
+			return
+		case <-d.reloadCh:
+			close(stopCh)
+			wg.Wait()
+			d.reload()
+		}
+	}
+}
+
+// sleep waits for d, and tells whether ctx is still alive afterwards
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (d *daemon) runProject(ctx context.Context, stopCh chan struct{}, c *daemonConfig, project string) {
+	b := d.breaker(project)
+	for {
+		if b.Allow() {
+			result := d.runOnce(ctx, c, project)
+			d.setResult(result)
+			d.sendTelemetry(ctx, c, result)
+			switch result.ExitCode {
+			case autolbclean.ExitError, autolbclean.ExitPartialFailure:
+				b.Failure()
+			default:
+				b.Success()
+			}
+		} else {
+			log.Printf("too many consecutive failures for project %s, skipping this run", project)
+		}
+
+		timer := time.NewTimer(c.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (d *daemon) runOnce(ctx context.Context, c *daemonConfig, project string) *autolbclean.WorkerResult {
+	config := c.Config
+	options := []autolbclean.Option{
+		autolbclean.WithConfig(&config),
+		autolbclean.WithDeletionBudget(c.MaxDeletionsPerRun),
+		autolbclean.WithRateLimit(c.RateLimit),
+		autolbclean.WithQuotaProject(c.QuotaProject),
+		autolbclean.WithRequestReason(c.RequestReason),
+		autolbclean.WithRunMetrics(c.Metrics),
+	}
+	if len(c.PlanDir) > 0 {
+		options = append(options,
+			autolbclean.WithPlanStore(autolbclean.NewFilePlanStore(c.PlanDir), c.PartialPlan),
+			autolbclean.WithPlanMaxAge(c.PlanMaxAge),
+			autolbclean.WithInventoryStore(autolbclean.NewFileInventoryStore(c.PlanDir)),
+		)
+	}
+	if len(c.TerraformWebhook) > 0 {
+		options = append(options, autolbclean.WithTerraformHandoff(autolbclean.NewWebhookHandoff(&http.Client{Timeout: autolbclean.DefaultHandoffTimeout}, c.TerraformWebhook)))
+	}
+	if sa, ok := c.Impersonate[project]; ok {
+		options = append(options, autolbclean.WithImpersonation(sa))
+	}
+	if sa, ok := c.ExecutorImpersonate[project]; ok {
+		options = append(options, autolbclean.WithExecutorImpersonation(sa))
+	}
+	if len(c.Store) > 0 {
+		store, err := d.store(ctx, c.Store)
+		if err != nil {
+			return errorResult(project, c.PlanOnly, err)
+		}
+		options = append(options, autolbclean.WithStore(store))
+	}
+	if len(c.EventTopic) > 0 {
+		p, err := openPublisher(ctx, c.EventTopic)
+		if err != nil {
+			return errorResult(project, c.PlanOnly, err)
+		}
+		options = append(options, autolbclean.WithEventPublisher(p))
+	}
+	if len(c.AuditTable) > 0 {
+		p, err := openAuditTable(ctx, c.AuditTable)
+		if err != nil {
+			return errorResult(project, c.PlanOnly, err)
+		}
+		options = append(options, autolbclean.WithEventPublisher(p))
+	}
+
+	result := run(ctx, project, c.PlanOnly, c.ConfigURL, options...)
+	buf, _ := json.Marshal(result)
+	log.Printf("%s", buf)
+	return result
+}
+
+// store returns the store at location, opening it on first use. Stores
+// are kept across reloads of the configuration, so that an in-memory
+// store does not lose its contents
+func (d *daemon) store(ctx context.Context, location string) (autolbclean.Store, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s, ok := d.stores[location]; ok {
+		return s, nil
+	}
+
+	s, err := openStore(ctx, location)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to open store`)
+	}
+	d.stores[location] = s
+	return s, nil
+}
+
+// sendTelemetry reports the outcome of a run, if telemetry is enabled
+func (d *daemon) sendTelemetry(ctx context.Context, c *daemonConfig, result *autolbclean.WorkerResult) {
+	if len(c.Telemetry.Endpoint) == 0 {
+		return
+	}
+
+	d.telemetry.RecordWorkerResult(result)
+	if err := d.telemetry.Flush(ctx, http.DefaultClient, c.Telemetry.Endpoint); err != nil {
+		log.Printf("failed to send telemetry: %s", err)
+	}
+}
+
+func (d *daemon) setResult(result *autolbclean.WorkerResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results[result.Project] = result
+}
+
+// runRollup sends the rollup every interval, as long as more than one
+// project is cleaned up
+func (d *daemon) runRollup(ctx context.Context) {
+	for sleep(ctx, d.currentConfig().Rollup.Interval) {
+		c := d.currentConfig()
+		if len(c.Projects) < 2 {
+			continue
+		}
+		if err := d.sendRollup(ctx, c); err != nil {
+			log.Printf("failed to send rollup: %s", err)
+		}
+	}
+}
+
+// sendRollup summarizes the latest results of all projects that have
+// completed at least one run, and delivers it to the organization-wide
+// notification sink
+func (d *daemon) sendRollup(ctx context.Context, c *daemonConfig) error {
+	cl, err := google.DefaultClient(ctx, compute.CloudPlatformScope)
+	if err != nil {
+		return errors.Wrap(err, `failed to create google default client`)
+	}
+
+	var summaries []*autolbclean.ProjectSummary
+	for _, project := range c.Projects {
+		d.mu.Lock()
+		result, ok := d.results[project]
+		d.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		var folder string
+		if app, err := autolbclean.New(project, cl); err == nil {
+			if folder, err = app.Folder(ctx); err != nil {
+				log.Printf("failed to resolve folder of project %s: %s", project, err)
+			}
+		}
+		summaries = append(summaries, autolbclean.SummarizeWorkerResult(result, folder))
+	}
+
+	if len(summaries) == 0 {
+		return nil
+	}
+
+	rollup := autolbclean.NewRollup(summaries)
+	log.Printf("%s", rollup)
+
+	if len(c.Rollup.WebhookURL) == 0 {
+		return nil
+	}
+
+	notifier := autolbclean.NewWebhookNotifier(http.DefaultClient, c.Rollup.WebhookURL)
+	return notifier.Notify(ctx, &autolbclean.Notification{
+		Subject: `organization rollup`,
+		Body:    rollup.Redact(&c.Rollup.Redaction).String(),
+	})
+}
+
+// runGC collects the garbage of the store daily, if there is one
+func (d *daemon) runGC(ctx context.Context) {
+	for sleep(ctx, gcInterval) {
+		c := d.currentConfig()
+		if len(c.Store) == 0 {
+			continue
+		}
+		if err := d.collectGarbage(ctx, c); err != nil {
+			log.Printf("failed to collect garbage: %s", err)
+		}
+	}
+}
+
+// collectGarbage removes the records of the store that are older than
+// their retention (see retention in the cleanup configuration). The
+// projects share the store, so it is done once for all of them
+func (d *daemon) collectGarbage(ctx context.Context, c *daemonConfig) error {
+	store, err := d.store(ctx, c.Store)
+	if err != nil {
+		return err
+	}
+	cl, err := google.DefaultClient(ctx, compute.CloudPlatformScope)
+	if err != nil {
+		return errors.Wrap(err, `failed to create google default client`)
+	}
+
+	config := c.Config
+	app, err := autolbclean.New(c.Projects[0], cl, autolbclean.WithConfig(&config), autolbclean.WithStore(store))
+	if err != nil {
+		return err
+	}
+	if len(c.ConfigURL) > 0 {
+		if err := app.ReloadConfig(ctx, c.ConfigURL); err != nil {
+			return err
+		}
+	}
+
+	for _, result := range app.CollectGarbage(ctx, time.Now().UTC()) {
+		buf, _ := json.Marshal(result)
+		log.Printf("%s", buf)
+	}
+	return nil
+}
+
+// runCanary creates a canary every interval, if a canary project is
+// configured. Only one canary is in flight at a time
+func (d *daemon) runCanary(ctx context.Context) {
+	for {
+		interval := defaultCanaryInterval
+		if c := d.currentConfig(); len(c.Canary.Project) > 0 {
+			if err := d.canaryOnce(ctx, c); err != nil {
+				log.Printf("canary: %s", err)
+			}
+			interval = c.Canary.Interval
+		}
+		if !sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+// canaryOnce creates a canary, and waits for the cleaner to delete it.
+// If the daemon is stopped in the meantime, the canary is left for the
+// cleaner to delete, without being reported
+func (d *daemon) canaryOnce(ctx context.Context, c *daemonConfig) error {
+	cl, err := google.DefaultClient(ctx, compute.ComputeScope, compute.CloudPlatformScope)
+	if err != nil {
+		return errors.Wrap(err, `failed to create google default client`)
+	}
+
+	config := c.Config
+	app, err := autolbclean.New(c.Canary.Project, cl, autolbclean.WithConfig(&config))
+	if err != nil {
+		return errors.Wrap(err, `failed to create app`)
+	}
+
+	canary, err := app.CreateCanary(ctx, c.Canary.Deadline)
+	if err != nil {
+		return err
+	}
+	log.Printf("canary: created %s in project %s, expecting it to be cleaned up by %s", canary.ID, c.Canary.Project, canary.Deadline.Format(time.RFC3339))
+
+	ticker := time.NewTicker(canaryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		status, err := app.CheckCanary(ctx, canary)
+		if err != nil {
+			log.Printf("canary: %s", err)
+			continue
+		}
+		if status == autolbclean.CanaryPending {
+			continue
+		}
+
+		log.Printf("canary: %s is %s", canary.ID, status)
+		if status == autolbclean.CanaryFailed {
+			if err := app.DeleteCanary(ctx, canary); err != nil {
+				log.Printf("canary: %s", err)
+			}
+		}
+		return app.ReportCanary(ctx, canary, status)
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"golang.org/x/oauth2/google"
+	compute "google.golang.org/api/compute/v1"
+)
+
+const serviceName = `autolbclean`
+
+// everything we write to stderr may contain error messages from the
+// APIs, so make sure they are redacted
+var stderr = autolbclean.NewRedactingWriter(os.Stderr)
+
+func main() {
+	os.Exit(_main())
+}
+
+func _main() int {
+	log.SetOutput(stderr)
+
+	// Without a subcommand, we run a single pass. This keeps
+	// `autolbclean -project=...` working as a one-shot worker
+	args := os.Args[1:]
+	cmd := `once`
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case `once`:
+		return cmdOnce(args)
+	case `scan`:
+		return cmdScan(args)
+	case `clean`:
+		return cmdClean(args)
+	case `report`:
+		return cmdReport(args)
+	case `graph`:
+		return cmdGraph(args)
+	case `explain`:
+		return cmdExplain(args)
+	case `export`:
+		return cmdExport(args)
+	case `generate`:
+		return cmdGenerate(args)
+	case `suppressions`:
+		return cmdSuppressions(args)
+	case `audit`:
+		return cmdAudit(args)
+	case `run`:
+		return cmdRun(args)
+	case `install`:
+		return cmdInstall(args)
+	case `uninstall`:
+		return cmdUninstall(args)
+	case `completion`:
+		return cmdCompletion(args)
+	}
+
+	fmt.Fprintf(stderr, "unknown command %s (expected one of once, scan, clean, report, graph, explain, export, generate, suppressions, audit, run, install, uninstall, completion)\n", cmd)
+	return autolbclean.ExitUsage
+}
+
+func cmdOnce(args []string) int {
+	var project string
+	var planOnly bool
+	var configURL string
+	var planDir string
+	var partialPlan string
+	var planMaxAge time.Duration
+	var quotaProject string
+	var requestReason string
+	var terraformWebhook string
+	var storeLocation string
+	var impersonate string
+	var executorImpersonate string
+	var eventTopic string
+	var auditTable string
+	var metrics bool
+
+	fs := flag.NewFlagSet(`once`, flag.ContinueOnError)
+	fs.StringVar(&project, "project", os.Getenv("GCP_PROJECT_ID"), "GCP project ID to clean up")
+	fs.BoolVar(&planOnly, "plan-only", false, "only report orphans, do not delete anything")
+	fs.StringVar(&configURL, "config", "", "location of the cleanup configuration (file, gs://, or sm://)")
+	fs.StringVar(&planDir, "plan-dir", "", "directory to persist the plan in while it is computed, so that an interrupted run can be detected")
+	fs.StringVar(&partialPlan, "partial-plan", autolbclean.PartialPlanFail, "what to do with the plan of an interrupted run (fail, resume, or discard)")
+	fs.DurationVar(&planMaxAge, "plan-max-age", autolbclean.DefaultPlanMaxAge, "discard the plan of an interrupted run instead if it is older than this")
+	fs.StringVar(&quotaProject, "quota-project", "", "project to bill API quota to (use \"scanned\" for the project being cleaned up)")
+	fs.StringVar(&requestReason, "request-reason", "", "reason attached to every API call")
+	fs.StringVar(&terraformWebhook, "terraform-webhook", "", "URL that load balancers managed by terraform are posted to, instead of being deleted")
+	fs.StringVar(&impersonate, "impersonate", "", "service account to call the APIs as, instead of the default credentials")
+	fs.StringVar(&executorImpersonate, "executor-impersonate", "", "service account to delete resources as, while discovery keeps using the credentials above")
+	fs.StringVar(&eventTopic, "event-topic", "", "Pub/Sub topic (projects/P/topics/T) to publish deletion events to")
+	fs.StringVar(&auditTable, "audit-table", "", "BigQuery table (project.dataset.table) to record decisions and deletions in")
+	fs.StringVar(&storeLocation, "store", "", "where to persist the run status, orphan candidates and admin state (gs://BUCKET/PREFIX or firestore://PROJECT/PREFIX)")
+	fs.BoolVar(&metrics, "metrics", false, "write the number of orphans found and resources deleted to Cloud Monitoring")
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+
+	options := []autolbclean.Option{
+		autolbclean.WithQuotaProject(quotaProject),
+		autolbclean.WithRequestReason(requestReason),
+		autolbclean.WithRunMetrics(metrics),
+	}
+	if len(terraformWebhook) > 0 {
+		options = append(options, autolbclean.WithTerraformHandoff(autolbclean.NewWebhookHandoff(&http.Client{Timeout: autolbclean.DefaultHandoffTimeout}, terraformWebhook)))
+	}
+	if len(impersonate) > 0 {
+		if err := autolbclean.ValidateServiceAccount(impersonate); err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return autolbclean.ExitUsage
+		}
+		options = append(options, autolbclean.WithImpersonation(impersonate))
+	}
+	if len(executorImpersonate) > 0 {
+		if err := autolbclean.ValidateServiceAccount(executorImpersonate); err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return autolbclean.ExitUsage
+		}
+		options = append(options, autolbclean.WithExecutorImpersonation(executorImpersonate))
+	}
+	if len(planDir) > 0 {
+		policy, err := autolbclean.ParsePartialPlanPolicy(partialPlan)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return autolbclean.ExitUsage
+		}
+		options = append(options,
+			autolbclean.WithPlanStore(autolbclean.NewFilePlanStore(planDir), policy),
+			autolbclean.WithPlanMaxAge(planMaxAge),
+			autolbclean.WithInventoryStore(autolbclean.NewFileInventoryStore(planDir)),
+		)
+	}
+
+	if len(project) == 0 {
+		fmt.Fprintf(stderr, "-project (or GCP_PROJECT_ID) is required\n")
+		return autolbclean.ExitUsage
+	}
+
+	ctx := context.Background()
+	if len(storeLocation) > 0 {
+		store, err := openStore(ctx, storeLocation)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return autolbclean.ExitUsage
+		}
+		options = append(options, autolbclean.WithStore(store))
+	}
+	if len(eventTopic) > 0 {
+		p, err := openPublisher(ctx, eventTopic)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return autolbclean.ExitUsage
+		}
+		options = append(options, autolbclean.WithEventPublisher(p))
+	}
+	if len(auditTable) > 0 {
+		p, err := openAuditTable(ctx, auditTable)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return autolbclean.ExitUsage
+		}
+		options = append(options, autolbclean.WithEventPublisher(p))
+	}
+
+	result := run(ctx, project, planOnly, configURL, options...)
+
+	// the result is always written to stdout as a single JSON object,
+	// so that pipelines can consume it regardless of the exit code
+	if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
+		fmt.Fprintf(stderr, "failed to encode result: %s\n", err)
+		return autolbclean.ExitError
+	}
+	return result.ExitCode
+}
+
+func cmdRun(args []string) int {
+	var configFile string
+
+	fs := flag.NewFlagSet(`run`, flag.ContinueOnError)
+	fs.StringVar(&configFile, "config", defaultConfigFile, "path to the configuration file")
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+
+	d, err := newDaemon(configFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to start: %s\n", err)
+		return autolbclean.ExitError
+	}
+
+	if err := runService(d); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitError
+	}
+	return autolbclean.ExitClean
+}
+
+func cmdInstall(args []string) int {
+	var configFile string
+
+	fs := flag.NewFlagSet(`install`, flag.ContinueOnError)
+	fs.StringVar(&configFile, "config", defaultConfigFile, "path to the configuration file the service should use")
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+
+	// make sure the configuration is usable before we install anything
+	if _, err := loadDaemonConfig(configFile); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return autolbclean.ExitUsage
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to find executable: %s\n", err)
+		return autolbclean.ExitError
+	}
+
+	if err := installService(exe, configFile); err != nil {
+		fmt.Fprintf(stderr, "failed to install service: %s\n", err)
+		return autolbclean.ExitError
+	}
+	return autolbclean.ExitClean
+}
+
+func cmdUninstall(args []string) int {
+	fs := flag.NewFlagSet(`uninstall`, flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return autolbclean.ExitUsage
+	}
+
+	if err := uninstallService(); err != nil {
+		fmt.Fprintf(stderr, "failed to uninstall service: %s\n", err)
+		return autolbclean.ExitError
+	}
+	return autolbclean.ExitClean
+}
+
+// describedFlags collects the flag sets of the subcommands while the
+// completion script is written. parseFlags then records the flag set of
+// the subcommand, by the first word of its name, instead of parsing the
+// arguments, so that the subcommand returns before doing anything
+var describedFlags map[string]*flag.FlagSet
+
+// parseFlags parses the arguments of a subcommand with its flag set
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if describedFlags != nil {
+		describedFlags[strings.Fields(fs.Name())[0]] = fs
+		return flag.ErrHelp
+	}
+	return fs.Parse(args)
+}
+
+func run(ctx context.Context, project string, planOnly bool, configURL string, options ...autolbclean.Option) *autolbclean.WorkerResult {
+	app, err := newApp(ctx, project, configURL, options...)
+	if err != nil {
+		return errorResult(project, planOnly, err)
+	}
+	if err := app.Config().ValidateStandalone(); err != nil {
+		return errorResult(project, planOnly, err)
+	}
+	return app.RunWorker(ctx, planOnly)
+}
+
+// openStore opens the store at location using the default credentials
+func openStore(ctx context.Context, location string) (autolbclean.Store, error) {
+	cl, err := google.DefaultClient(ctx, compute.CloudPlatformScope)
+	if err != nil {
+		return nil, err
+	}
+	return autolbclean.OpenStore(ctx, cl, location)
+}
+
+// openPublisher creates a publisher for the Pub/Sub topic using the
+// default credentials
+func openPublisher(ctx context.Context, topic string) (autolbclean.EventPublisher, error) {
+	cl, err := google.DefaultClient(ctx, compute.CloudPlatformScope)
+	if err != nil {
+		return nil, err
+	}
+	return autolbclean.NewPubSubPublisher(cl, topic)
+}
+
+// openAuditTable creates a publisher for the BigQuery table using the
+// default credentials
+func openAuditTable(ctx context.Context, table string) (autolbclean.EventPublisher, error) {
+	cl, err := google.DefaultClient(ctx, compute.CloudPlatformScope)
+	if err != nil {
+		return nil, err
+	}
+	return autolbclean.NewBigQueryPublisher(ctx, cl, table)
+}
+
+// newApp creates an App for project using the default credentials, and
+// loads the configuration from configURL if given
+func newApp(ctx context.Context, project string, configURL string, options ...autolbclean.Option) (*autolbclean.App, error) {
+	cl, err := google.DefaultClient(ctx, compute.ComputeScope, compute.CloudPlatformScope)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := autolbclean.New(project, cl, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(configURL) > 0 {
+		if err := app.ReloadConfig(ctx, configURL); err != nil {
+			return nil, err
+		}
+	}
+	return app, nil
+}
+
+func errorResult(project string, planOnly bool, err error) *autolbclean.WorkerResult {
+	return &autolbclean.WorkerResult{
+		Status:   autolbclean.StatusError,
+		ExitCode: autolbclean.ExitError,
+		Project:  project,
+		PlanOnly: planOnly,
+		Error:    autolbclean.RedactError(err),
+	}
+}
@@ -0,0 +1,96 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const defaultConfigFile = `/etc/autolbclean/config.yaml`
+
+var systemdUnitFile = filepath.Join(`/etc/systemd/system`, serviceName+`.service`)
+
+func installService(exe, configFile string) error {
+	configFile, err := filepath.Abs(configFile)
+	if err != nil {
+		return errors.Wrap(err, `failed to resolve configuration file path`)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[Unit]\n")
+	fmt.Fprintf(&buf, "Description=Clean up dangling GCP load balancers\n")
+	fmt.Fprintf(&buf, "After=network-online.target\n")
+	fmt.Fprintf(&buf, "Wants=network-online.target\n\n")
+	fmt.Fprintf(&buf, "[Service]\n")
+	fmt.Fprintf(&buf, "ExecStart=%s run -config=%s\n", exe, configFile)
+	fmt.Fprintf(&buf, "ExecReload=/bin/kill -HUP $MAINPID\n")
+	fmt.Fprintf(&buf, "Restart=on-failure\n\n")
+	fmt.Fprintf(&buf, "[Install]\n")
+	fmt.Fprintf(&buf, "WantedBy=multi-user.target\n")
+
+	if err := ioutil.WriteFile(systemdUnitFile, buf.Bytes(), 0644); err != nil {
+		return errors.Wrapf(err, `failed to write %s`, systemdUnitFile)
+	}
+
+	if err := systemctl(`daemon-reload`); err != nil {
+		return err
+	}
+	return systemctl(`enable`, `--now`, serviceName)
+}
+
+func uninstallService() error {
+	if err := systemctl(`disable`, `--now`, serviceName); err != nil {
+		return err
+	}
+
+	if err := os.Remove(systemdUnitFile); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, `failed to remove %s`, systemdUnitFile)
+	}
+	return systemctl(`daemon-reload`)
+}
+
+func systemctl(args ...string) error {
+	cmd := exec.Command(`systemctl`, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, `failed to run systemctl %v`, args)
+	}
+	return nil
+}
+
+// runService runs the daemon in the foreground, which is what systemd
+// expects. SIGHUP reloads the configuration, and SIGINT/SIGTERM stop it
+func runService(d *daemon) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	go func() {
+		for sig := range sigCh {
+			if sig == syscall.SIGHUP {
+				d.Reload()
+				continue
+			}
+			cancel()
+			return
+		}
+	}()
+
+	d.Run(ctx)
+	return nil
+}
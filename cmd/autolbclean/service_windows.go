@@ -0,0 +1,126 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+var defaultConfigFile = filepath.Join(os.Getenv(`ProgramData`), `autolbclean`, `config.yaml`)
+
+func installService(exe, configFile string) error {
+	configFile, err := filepath.Abs(configFile)
+	if err != nil {
+		return errors.Wrap(err, `failed to resolve configuration file path`)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Wrap(err, `failed to connect to service manager`)
+	}
+	defer m.Disconnect()
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: `autolbclean`,
+		Description: `Clean up dangling GCP load balancers`,
+		StartType:   mgr.StartAutomatic,
+	}, `run`, `-config=`+configFile)
+	if err != nil {
+		return errors.Wrap(err, `failed to create service`)
+	}
+	defer s.Close()
+
+	if err := s.Start(); err != nil {
+		return errors.Wrap(err, `failed to start service`)
+	}
+	return nil
+}
+
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Wrap(err, `failed to connect to service manager`)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return errors.Wrap(err, `failed to open service`)
+	}
+	defer s.Close()
+
+	// the service may already be stopped, in which case this fails
+	_, _ = s.Control(svc.Stop)
+
+	if err := s.Delete(); err != nil {
+		return errors.Wrap(err, `failed to delete service`)
+	}
+	return nil
+}
+
+type windowsService struct {
+	daemon *daemon
+}
+
+// Execute implements svc.Handler. A ParamChange request is the Windows
+// equivalent of SIGHUP, and reloads the configuration
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.daemon.Run(ctx)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+	for {
+		select {
+		case <-done:
+			status <- svc.Status{State: svc.Stopped}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.ParamChange:
+				s.daemon.Reload()
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				status <- svc.Status{State: svc.Stopped}
+				return false, 0
+			}
+		}
+	}
+}
+
+// runService runs the daemon under the Windows service manager, or in
+// the foreground if we were started from an interactive session
+func runService(d *daemon) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return errors.Wrap(err, `failed to determine if we are running as a service`)
+	}
+
+	if !isService {
+		d.Run(context.Background())
+		return nil
+	}
+
+	if err := svc.Run(serviceName, &windowsService{daemon: d}); err != nil {
+		return errors.Wrap(err, `failed to run service`)
+	}
+	return nil
+}
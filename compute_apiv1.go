@@ -0,0 +1,289 @@
+//go:build computeapiv1
+// +build computeapiv1
+
+package autolbclean
+
+import (
+	"context"
+	"path"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// apiv1ComputeClient issues the compute API calls through the
+// cloud.google.com/go/compute/apiv1 client library. That library has a
+// client per collection, which are all created up front
+type apiv1ComputeClient struct {
+	addresses                *compute.AddressesClient
+	backendServices          *compute.BackendServicesClient
+	firewalls                *compute.FirewallsClient
+	forwardingRules          *compute.ForwardingRulesClient
+	globalAddresses          *compute.GlobalAddressesClient
+	globalForwardingRules    *compute.GlobalForwardingRulesClient
+	globalOperations         *compute.GlobalOperationsClient
+	healthChecks             *compute.HealthChecksClient
+	httpHealthChecks         *compute.HttpHealthChecksClient
+	httpsHealthChecks        *compute.HttpsHealthChecksClient
+	instanceGroups           *compute.InstanceGroupsClient
+	regionBackendServices    *compute.RegionBackendServicesClient
+	regionHealthChecks       *compute.RegionHealthChecksClient
+	regionOperations         *compute.RegionOperationsClient
+	regionSslCertificates    *compute.RegionSslCertificatesClient
+	regionTargetHttpProxies  *compute.RegionTargetHttpProxiesClient
+	regionTargetHttpsProxies *compute.RegionTargetHttpsProxiesClient
+	regionUrlMaps            *compute.RegionUrlMapsClient
+	sslCertificates          *compute.SslCertificatesClient
+	targetHttpProxies        *compute.TargetHttpProxiesClient
+	targetHttpsProxies       *compute.TargetHttpsProxiesClient
+	targetPools              *compute.TargetPoolsClient
+	urlMaps                  *compute.UrlMapsClient
+	zoneOperations           *compute.ZoneOperationsClient
+}
+
+// apiv1Operation is either an operation started by the client, in which
+// case op is set, or one that was looked up by its name. proto is the
+// state of the operation as of the last time it was fetched
+type apiv1Operation struct {
+	client  *apiv1ComputeClient
+	project string
+	op      *compute.Operation
+	proto   *computepb.Operation
+}
+
+func newComputeClient(app *App) (ComputeClient, error) {
+	// the clients outlive any single request, so they are not tied
+	// to a request context. Calls still go through app.executorClient, so
+	// that the rate limits, retries and headers apply to them
+	ctx := context.Background()
+	opts := []option.ClientOption{option.WithHTTPClient(app.executorClient)}
+
+	var c apiv1ComputeClient
+	var err error
+	if c.addresses, err = compute.NewAddressesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create addresses client`)
+	}
+	if c.backendServices, err = compute.NewBackendServicesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create backend services client`)
+	}
+	if c.firewalls, err = compute.NewFirewallsRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create firewalls client`)
+	}
+	if c.forwardingRules, err = compute.NewForwardingRulesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create forwarding rules client`)
+	}
+	if c.globalAddresses, err = compute.NewGlobalAddressesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create global addresses client`)
+	}
+	if c.globalForwardingRules, err = compute.NewGlobalForwardingRulesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create global forwarding rules client`)
+	}
+	if c.globalOperations, err = compute.NewGlobalOperationsRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create global operations client`)
+	}
+	if c.healthChecks, err = compute.NewHealthChecksRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create health checks client`)
+	}
+	if c.httpHealthChecks, err = compute.NewHttpHealthChecksRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create http health checks client`)
+	}
+	if c.httpsHealthChecks, err = compute.NewHttpsHealthChecksRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create https health checks client`)
+	}
+	if c.instanceGroups, err = compute.NewInstanceGroupsRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create instance groups client`)
+	}
+	if c.regionBackendServices, err = compute.NewRegionBackendServicesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create region backend services client`)
+	}
+	if c.regionHealthChecks, err = compute.NewRegionHealthChecksRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create region health checks client`)
+	}
+	if c.regionOperations, err = compute.NewRegionOperationsRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create region operations client`)
+	}
+	if c.regionSslCertificates, err = compute.NewRegionSslCertificatesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create region ssl certificates client`)
+	}
+	if c.regionTargetHttpProxies, err = compute.NewRegionTargetHttpProxiesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create region target http proxies client`)
+	}
+	if c.regionTargetHttpsProxies, err = compute.NewRegionTargetHttpsProxiesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create region target https proxies client`)
+	}
+	if c.regionUrlMaps, err = compute.NewRegionUrlMapsRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create region url maps client`)
+	}
+	if c.sslCertificates, err = compute.NewSslCertificatesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create ssl certificates client`)
+	}
+	if c.targetHttpProxies, err = compute.NewTargetHttpProxiesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create target http proxies client`)
+	}
+	if c.targetHttpsProxies, err = compute.NewTargetHttpsProxiesRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create target https proxies client`)
+	}
+	if c.targetPools, err = compute.NewTargetPoolsRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create target pools client`)
+	}
+	if c.urlMaps, err = compute.NewUrlMapsRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create url maps client`)
+	}
+	if c.zoneOperations, err = compute.NewZoneOperationsRESTClient(ctx, opts...); err != nil {
+		return nil, errors.Wrap(err, `failed to create zone operations client`)
+	}
+	return &c, nil
+}
+
+func (c *apiv1ComputeClient) Delete(ctx context.Context, project string, d *Deletion) (Operation, error) {
+	op, err := c.delete(ctx, project, d)
+	if err != nil {
+		return nil, fromAPIError(err)
+	}
+	return &apiv1Operation{client: c, project: project, op: op, proto: op.Proto()}, nil
+}
+
+func (c *apiv1ComputeClient) Operation(ctx context.Context, project string, ref *OperationRef) (Operation, error) {
+	proto, err := c.getOperation(ctx, project, ref)
+	if err != nil {
+		return nil, fromAPIError(err)
+	}
+	return &apiv1Operation{client: c, project: project, proto: proto}, nil
+}
+
+func (c *apiv1ComputeClient) getOperation(ctx context.Context, project string, ref *OperationRef) (*computepb.Operation, error) {
+	switch {
+	case len(ref.Zone) > 0:
+		return c.zoneOperations.Get(ctx, &computepb.GetZoneOperationRequest{Project: project, Zone: ref.Zone, Operation: ref.Name})
+	case !isGlobal(ref.Region):
+		return c.regionOperations.Get(ctx, &computepb.GetRegionOperationRequest{Project: project, Region: ref.Region, Operation: ref.Name})
+	}
+	return c.globalOperations.Get(ctx, &computepb.GetGlobalOperationRequest{Project: project, Operation: ref.Name})
+}
+
+func (c *apiv1ComputeClient) waitOperation(ctx context.Context, project string, ref *OperationRef) (*computepb.Operation, error) {
+	switch {
+	case len(ref.Zone) > 0:
+		return c.zoneOperations.Wait(ctx, &computepb.WaitZoneOperationRequest{Project: project, Zone: ref.Zone, Operation: ref.Name})
+	case !isGlobal(ref.Region):
+		return c.regionOperations.Wait(ctx, &computepb.WaitRegionOperationRequest{Project: project, Region: ref.Region, Operation: ref.Name})
+	}
+	return c.globalOperations.Wait(ctx, &computepb.WaitGlobalOperationRequest{Project: project, Operation: ref.Name})
+}
+
+func (c *apiv1ComputeClient) delete(ctx context.Context, project string, d *Deletion) (*compute.Operation, error) {
+	switch d.Kind {
+	case KindForwardingRules:
+		if isGlobal(d.Region) {
+			return c.globalForwardingRules.Delete(ctx, &computepb.DeleteGlobalForwardingRuleRequest{Project: project, ForwardingRule: d.Name})
+		}
+		return c.forwardingRules.Delete(ctx, &computepb.DeleteForwardingRuleRequest{Project: project, Region: d.Region, ForwardingRule: d.Name})
+	case KindTargetHttpProxies:
+		if isGlobal(d.Region) {
+			return c.targetHttpProxies.Delete(ctx, &computepb.DeleteTargetHttpProxyRequest{Project: project, TargetHttpProxy: d.Name})
+		}
+		return c.regionTargetHttpProxies.Delete(ctx, &computepb.DeleteRegionTargetHttpProxyRequest{Project: project, Region: d.Region, TargetHttpProxy: d.Name})
+	case KindTargetHttpsProxies:
+		if isGlobal(d.Region) {
+			return c.targetHttpsProxies.Delete(ctx, &computepb.DeleteTargetHttpsProxyRequest{Project: project, TargetHttpsProxy: d.Name})
+		}
+		return c.regionTargetHttpsProxies.Delete(ctx, &computepb.DeleteRegionTargetHttpsProxyRequest{Project: project, Region: d.Region, TargetHttpsProxy: d.Name})
+	case KindSslCertificates:
+		if isGlobal(d.Region) {
+			return c.sslCertificates.Delete(ctx, &computepb.DeleteSslCertificateRequest{Project: project, SslCertificate: d.Name})
+		}
+		return c.regionSslCertificates.Delete(ctx, &computepb.DeleteRegionSslCertificateRequest{Project: project, Region: d.Region, SslCertificate: d.Name})
+	case KindUrlMaps:
+		if isGlobal(d.Region) {
+			return c.urlMaps.Delete(ctx, &computepb.DeleteUrlMapRequest{Project: project, UrlMap: d.Name})
+		}
+		return c.regionUrlMaps.Delete(ctx, &computepb.DeleteRegionUrlMapRequest{Project: project, Region: d.Region, UrlMap: d.Name})
+	case KindBackendServices:
+		if isGlobal(d.Region) {
+			return c.backendServices.Delete(ctx, &computepb.DeleteBackendServiceRequest{Project: project, BackendService: d.Name})
+		}
+		return c.regionBackendServices.Delete(ctx, &computepb.DeleteRegionBackendServiceRequest{Project: project, Region: d.Region, BackendService: d.Name})
+	case KindHealthChecks:
+		if isGlobal(d.Region) {
+			return c.healthChecks.Delete(ctx, &computepb.DeleteHealthCheckRequest{Project: project, HealthCheck: d.Name})
+		}
+		return c.regionHealthChecks.Delete(ctx, &computepb.DeleteRegionHealthCheckRequest{Project: project, Region: d.Region, HealthCheck: d.Name})
+	case KindHttpHealthChecks:
+		return c.httpHealthChecks.Delete(ctx, &computepb.DeleteHttpHealthCheckRequest{Project: project, HttpHealthCheck: d.Name})
+	case KindHttpsHealthChecks:
+		return c.httpsHealthChecks.Delete(ctx, &computepb.DeleteHttpsHealthCheckRequest{Project: project, HttpsHealthCheck: d.Name})
+	case KindTargetPools:
+		return c.targetPools.Delete(ctx, &computepb.DeleteTargetPoolRequest{Project: project, Region: d.Region, TargetPool: d.Name})
+	case KindFirewalls:
+		return c.firewalls.Delete(ctx, &computepb.DeleteFirewallRequest{Project: project, Firewall: d.Name})
+	case KindInstanceGroups:
+		return c.instanceGroups.Delete(ctx, &computepb.DeleteInstanceGroupRequest{Project: project, Zone: d.Zone, InstanceGroup: d.Name})
+	case KindAddresses:
+		if isGlobal(d.Region) {
+			return c.globalAddresses.Delete(ctx, &computepb.DeleteGlobalAddressRequest{Project: project, Address: d.Name})
+		}
+		return c.addresses.Delete(ctx, &computepb.DeleteAddressRequest{Project: project, Region: d.Region, Address: d.Name})
+	}
+	return nil, errors.Errorf(`unknown resource kind %s`, d.Kind)
+}
+
+func (o *apiv1Operation) Ref() *OperationRef {
+	ref := &OperationRef{Name: o.proto.GetName()}
+	if zone := o.proto.GetZone(); len(zone) > 0 {
+		ref.Zone = path.Base(zone)
+	}
+	if region := o.proto.GetRegion(); len(region) > 0 {
+		ref.Region = path.Base(region)
+	}
+	return ref
+}
+
+func (o *apiv1Operation) Done() bool {
+	return o.proto.GetStatus() == computepb.Operation_DONE
+}
+
+func (o *apiv1Operation) Err() error {
+	errs := o.proto.GetError().GetErrors()
+	if len(errs) == 0 {
+		return nil
+	}
+	e := errs[0]
+	return &OperationError{Operation: o.proto.GetName(), Code: e.GetCode(), Message: e.GetMessage()}
+}
+
+func (o *apiv1Operation) Wait(ctx context.Context) error {
+	if o.op != nil {
+		if err := o.op.Wait(ctx); err != nil {
+			return errors.Wrap(fromAPIError(err), `failed to wait for operation`)
+		}
+		o.proto = o.op.Proto()
+		return o.Err()
+	}
+
+	for !o.Done() {
+		proto, err := o.client.waitOperation(ctx, o.project, o.Ref())
+		if err != nil {
+			return errors.Wrap(fromAPIError(err), `failed to wait for operation`)
+		}
+		o.proto = proto
+	}
+	return o.Err()
+}
+
+// fromAPIError unwraps the *googleapi.Error that the REST transport of
+// the apiv1 library wraps its errors around, so that isNotFound and
+// friends see the same errors regardless of the client library
+func fromAPIError(err error) error {
+	ae, ok := err.(*apierror.APIError)
+	if !ok {
+		return err
+	}
+	if ge, ok := ae.Unwrap().(*googleapi.Error); ok {
+		return ge
+	}
+	return err
+}
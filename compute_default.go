@@ -0,0 +1,8 @@
+//go:build !computeapiv1
+// +build !computeapiv1
+
+package autolbclean
+
+func newComputeClient(app *App) (ComputeClient, error) {
+	return &restComputeClient{service: app.executor}, nil
+}
@@ -0,0 +1,163 @@
+package autolbclean
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// restComputeClient issues the compute API calls through the generated
+// REST client (google.golang.org/api/compute/v1)
+type restComputeClient struct {
+	service *compute.Service
+}
+
+// restOperation is an operation started through the generated REST
+// client. Operations started by resources created outside of the
+// ComputeClient (e.g. canaries) are waited for through it as well
+type restOperation struct {
+	service *compute.Service
+	project string
+	op      *compute.Operation
+}
+
+func newRestOperation(service *compute.Service, project string, op *compute.Operation) Operation {
+	return &restOperation{service: service, project: project, op: op}
+}
+
+func (c *restComputeClient) Delete(ctx context.Context, project string, d *Deletion) (Operation, error) {
+	op, err := c.delete(ctx, project, d)
+	if err != nil {
+		return nil, err
+	}
+	return newRestOperation(c.service, project, op), nil
+}
+
+func (c *restComputeClient) Operation(ctx context.Context, project string, ref *OperationRef) (Operation, error) {
+	var op *compute.Operation
+	var err error
+	switch {
+	case len(ref.Zone) > 0:
+		op, err = c.service.ZoneOperations.Get(project, ref.Zone, ref.Name).Context(ctx).Do()
+	case !isGlobal(ref.Region):
+		op, err = c.service.RegionOperations.Get(project, ref.Region, ref.Name).Context(ctx).Do()
+	default:
+		op, err = c.service.GlobalOperations.Get(project, ref.Name).Context(ctx).Do()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newRestOperation(c.service, project, op), nil
+}
+
+func (c *restComputeClient) delete(ctx context.Context, project string, d *Deletion) (*compute.Operation, error) {
+	switch d.Kind {
+	case KindForwardingRules:
+		if isGlobal(d.Region) {
+			return c.service.GlobalForwardingRules.Delete(project, d.Name).Context(ctx).Do()
+		}
+		return c.service.ForwardingRules.Delete(project, d.Region, d.Name).Context(ctx).Do()
+	case KindTargetHttpProxies:
+		if isGlobal(d.Region) {
+			return c.service.TargetHttpProxies.Delete(project, d.Name).Context(ctx).Do()
+		}
+		return c.service.RegionTargetHttpProxies.Delete(project, d.Region, d.Name).Context(ctx).Do()
+	case KindTargetHttpsProxies:
+		if isGlobal(d.Region) {
+			return c.service.TargetHttpsProxies.Delete(project, d.Name).Context(ctx).Do()
+		}
+		return c.service.RegionTargetHttpsProxies.Delete(project, d.Region, d.Name).Context(ctx).Do()
+	case KindSslCertificates:
+		if isGlobal(d.Region) {
+			return c.service.SslCertificates.Delete(project, d.Name).Context(ctx).Do()
+		}
+		return c.service.RegionSslCertificates.Delete(project, d.Region, d.Name).Context(ctx).Do()
+	case KindUrlMaps:
+		if isGlobal(d.Region) {
+			return c.service.UrlMaps.Delete(project, d.Name).Context(ctx).Do()
+		}
+		return c.service.RegionUrlMaps.Delete(project, d.Region, d.Name).Context(ctx).Do()
+	case KindBackendServices:
+		if isGlobal(d.Region) {
+			return c.service.BackendServices.Delete(project, d.Name).Context(ctx).Do()
+		}
+		return c.service.RegionBackendServices.Delete(project, d.Region, d.Name).Context(ctx).Do()
+	case KindHealthChecks:
+		if isGlobal(d.Region) {
+			return c.service.HealthChecks.Delete(project, d.Name).Context(ctx).Do()
+		}
+		return c.service.RegionHealthChecks.Delete(project, d.Region, d.Name).Context(ctx).Do()
+	case KindHttpHealthChecks:
+		return c.service.HttpHealthChecks.Delete(project, d.Name).Context(ctx).Do()
+	case KindHttpsHealthChecks:
+		return c.service.HttpsHealthChecks.Delete(project, d.Name).Context(ctx).Do()
+	case KindTargetPools:
+		return c.service.TargetPools.Delete(project, d.Region, d.Name).Context(ctx).Do()
+	case KindFirewalls:
+		return c.service.Firewalls.Delete(project, d.Name).Context(ctx).Do()
+	case KindInstanceGroups:
+		return c.service.InstanceGroups.Delete(project, d.Zone, d.Name).Context(ctx).Do()
+	case KindAddresses:
+		if isGlobal(d.Region) {
+			return c.service.GlobalAddresses.Delete(project, d.Name).Context(ctx).Do()
+		}
+		return c.service.Addresses.Delete(project, d.Region, d.Name).Context(ctx).Do()
+	}
+	return nil, errors.Errorf(`unknown resource kind %s`, d.Kind)
+}
+
+func (o *restOperation) Ref() *OperationRef {
+	ref := &OperationRef{Name: o.op.Name}
+	if len(o.op.Zone) > 0 {
+		ref.Zone = path.Base(o.op.Zone)
+	}
+	if len(o.op.Region) > 0 {
+		ref.Region = path.Base(o.op.Region)
+	}
+	return ref
+}
+
+func (o *restOperation) Done() bool {
+	return o.op.Status == `DONE`
+}
+
+func (o *restOperation) Err() error {
+	if o.op.Error == nil || len(o.op.Error.Errors) == 0 {
+		return nil
+	}
+	e := o.op.Error.Errors[0]
+	return &OperationError{Operation: o.op.Name, Code: e.Code, Message: e.Message}
+}
+
+func (o *restOperation) Wait(ctx context.Context) error {
+	for !o.Done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		op := o.op
+		var err error
+		switch {
+		case op.Zone != ``:
+			op, err = o.service.ZoneOperations.Wait(o.project, path.Base(op.Zone), op.Name).Context(ctx).Do()
+		case op.Region != ``:
+			op, err = o.service.RegionOperations.Wait(o.project, path.Base(op.Region), op.Name).Context(ctx).Do()
+		default:
+			op, err = o.service.GlobalOperations.Wait(o.project, op.Name).Context(ctx).Do()
+		}
+		if err != nil {
+			return errors.Wrap(err, `failed to wait for operation`)
+		}
+		o.op = op
+
+		if !o.Done() {
+			time.Sleep(time.Second)
+		}
+	}
+	return o.Err()
+}
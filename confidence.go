@@ -0,0 +1,116 @@
+package autolbclean
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Defaults of the confidence scoring
+const (
+	DefaultConfidenceMinScore = 50
+	DefaultConfidenceAge      = 7 * 24 * time.Hour
+)
+
+const maxConfidenceScore = 100
+
+// Signals that an orphan can be deleted
+const (
+	SignalClusterDeleted = `cluster_deleted` // a cluster notification confirmed that its cluster is gone
+	SignalOwnership      = `ownership`       // it can be tied to the cluster, namespace or label that created it
+	SignalAge            = `age`             // it is older than confidence.age
+	SignalZeroTraffic    = `zero_traffic`    // its backend services served no requests lately
+	SignalZeroEndpoints  = `zero_endpoints`  // its backends were confirmed to have no endpoints
+)
+
+// signalWeights is how much each signal adds to the score. They add up
+// to maxConfidenceScore
+var signalWeights = []struct {
+	signal string
+	weight int
+}{
+	{SignalClusterDeleted, 40},
+	{SignalOwnership, 15},
+	{SignalAge, 15},
+	{SignalZeroTraffic, 15},
+	{SignalZeroEndpoints, 15},
+}
+
+// ScoreOrphan returns the confidence of the orphan as of now. Whether
+// its backend services served any traffic is looked up separately, as
+// it takes API calls
+func (c *Config) ScoreOrphan(o *Orphan, now time.Time, noTraffic bool) *Confidence {
+	shown := map[string]bool{
+		SignalClusterDeleted: o.ClusterDeleted,
+		SignalOwnership:      len(o.Cluster) > 0 || len(o.Namespace) > 0 || o.Managed,
+		SignalAge:            !o.CreatedAt.IsZero() && now.Sub(o.CreatedAt) >= c.Confidence.Age,
+		SignalZeroTraffic:    noTraffic,
+		SignalZeroEndpoints:  o.NoEndpoints,
+	}
+
+	confidence := &Confidence{Signals: []string{}}
+	for _, sw := range signalWeights {
+		if shown[sw.signal] {
+			confidence.Score += sw.weight
+			confidence.Signals = append(confidence.Signals, sw.signal)
+		}
+	}
+	return confidence
+}
+
+// IsReportOnly returns true if the confidence of the orphan is too low
+// for it to be deleted, or if the deletion policies keep it. When
+// scoring is enabled, an orphan that was not scored is not deleted
+func (c *Config) IsReportOnly(o *Orphan) bool {
+	if len(o.PolicyHold) > 0 {
+		return true
+	}
+	return c.Confidence.Enabled && (o.Confidence == nil || o.Confidence.Score < c.Confidence.MinScore)
+}
+
+// reportOnlyReason is why an orphan that is only reported is skipped
+func (c *Config) reportOnlyReason(o *Orphan) string {
+	if len(o.PolicyHold) > 0 {
+		return o.PolicyHold
+	}
+	if o.Confidence == nil {
+		return `it has no confidence score`
+	}
+	return fmt.Sprintf(`confidence %d is below %d`, o.Confidence.Score, c.Confidence.MinScore)
+}
+
+// splitReportOnly separates the orphans that may be deleted from the
+// ones that are only reported
+func (c *Config) splitReportOnly(orphans []*Orphan) ([]*Orphan, []*Orphan) {
+	var eligible, reportOnly []*Orphan
+	for _, o := range orphans {
+		if c.IsReportOnly(o) {
+			reportOnly = append(reportOnly, o)
+			continue
+		}
+		eligible = append(eligible, o)
+	}
+	return eligible, reportOnly
+}
+
+// hasNoTraffic returns true if none of the backend services of the
+// orphan served any requests lately. Failing to tell counts as traffic
+func (app *App) hasNoTraffic(ctx context.Context, o *Orphan) bool {
+	for _, s := range o.BackendServices {
+		active, err := app.hasRecentTraffic(ctx, s.Name)
+		if err != nil || active {
+			return false
+		}
+	}
+	return true
+}
+
+// scoreOrphans assigns each orphan its confidence
+func (app *App) scoreOrphans(ctx context.Context, orphans []*Orphan) {
+	c := app.Config()
+	now := time.Now()
+	for _, o := range orphans {
+		noTraffic := c.Confidence.Traffic && app.hasNoTraffic(ctx, o)
+		o.Confidence = c.ScoreOrphan(o, now, noTraffic)
+	}
+}
@@ -0,0 +1,60 @@
+package autolbclean_test
+
+import (
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScoreOrphan(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+confidence:
+  enabled: true
+  min_score: 60
+  age: 24h
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	o := &autolbclean.Orphan{
+		TargetProxy: `k8s-tp-default-web--0123456789abcdef`,
+		Cluster:     `0123456789abcdef`,
+		CreatedAt:   now.Add(-2 * time.Hour),
+	}
+	o.Confidence = c.ScoreOrphan(o, now, false)
+	if !assert.Equal(t, &autolbclean.Confidence{Score: 15, Signals: []string{autolbclean.SignalOwnership}}, o.Confidence, `only ownership should be shown`) {
+		return
+	}
+	if !assert.True(t, c.IsReportOnly(o), `orphans below the minimum score should only be reported`) {
+		return
+	}
+
+	o.ClusterDeleted = true
+	o.NoEndpoints = true
+	o.Confidence = c.ScoreOrphan(o, now.Add(48*time.Hour), true)
+	if !assert.Equal(t, 100, o.Confidence.Score, `every signal should be shown`) {
+		return
+	}
+	if !assert.False(t, c.IsReportOnly(o), `orphans above the minimum score should be deleted`) {
+		return
+	}
+
+	o.Confidence = nil
+	if !assert.True(t, c.IsReportOnly(o), `orphans without a score should only be reported`) {
+		return
+	}
+
+	c.Confidence.Enabled = false
+	o.Confidence = &autolbclean.Confidence{}
+	if !assert.False(t, c.IsReportOnly(o), `nothing should be report only when scoring is disabled`) {
+		return
+	}
+
+	if _, err := autolbclean.ParseConfig([]byte("confidence: { min_score: 101 }\n")); !assert.Error(t, err, `scores above 100 should be rejected`) {
+		return
+	}
+}
@@ -0,0 +1,421 @@
+package autolbclean
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+	storage "google.golang.org/api/storage/v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultConfig returns the configuration that reproduces the
+// built-in behavior
+func DefaultConfig() *Config {
+	return &Config{
+		ForwardingRulePrefixes: []string{`k8s-fw`},
+		TargetProxyPrefixes:    []string{`k8s-tp`},
+		FirewallTagPrefixes:    []string{`gke-`},
+		HealthCheckPrefixes:    []string{`k8s-be-`, `k8s1-`},
+		BackendServicePrefixes: []string{`k8s-be-`, `k8s1-`},
+		AddressPrefixes:        []string{`k8s-fw-`, `k8s2-fr-`},
+		AgeThreshold:           time.Hour,
+		InventoryDropThreshold: DefaultInventoryDropThreshold,
+		TaskExpiration:         DefaultTaskExpiration,
+		Retry:                  DefaultRetryConfig(),
+		HealthEmptiness: HealthEmptinessConfig{
+			Timeout:     DefaultGetHealthTimeout,
+			Concurrency: DefaultGetHealthConcurrency,
+		},
+		Protection: ProtectionConfig{
+			Label: DefaultProtectionLabel,
+			Value: DefaultProtectionValue,
+		},
+		Managed: ManagedConfig{
+			Label: DefaultManagedLabel,
+			Value: DefaultManagedValue,
+		},
+		NEGEmptiness: NEGEmptinessConfig{
+			Threshold: DefaultNEGEmptyThreshold,
+		},
+		Confidence: ConfidenceConfig{
+			MinScore: DefaultConfidenceMinScore,
+			Age:      DefaultConfidenceAge,
+		},
+		Policies: PoliciesConfig{
+			Default: PolicyDelete,
+		},
+	}
+}
+
+// ParseConfig parses a YAML configuration. Fields that are not present
+// in the document are set to their defaults
+func ParseConfig(buf []byte) (*Config, error) {
+	c := DefaultConfig()
+	if err := yaml.Unmarshal(buf, c); err != nil {
+		return nil, errors.Wrap(err, `failed to parse configuration`)
+	}
+
+	for _, pattern := range c.Exclusions {
+		if _, err := path.Match(pattern, ``); err != nil {
+			return nil, errors.Wrapf(err, `invalid exclusion pattern %s`, pattern)
+		}
+	}
+
+	if err := c.Retry.Read.validate(); err != nil {
+		return nil, errors.Wrap(err, `invalid read retry policy`)
+	}
+	if err := c.Retry.Mutation.validate(); err != nil {
+		return nil, errors.Wrap(err, `invalid mutation retry policy`)
+	}
+
+	if err := validateDeletionWindows(c.DeletionWindows); err != nil {
+		return nil, errors.Wrap(err, `invalid deletion_windows`)
+	}
+	if _, err := time.LoadLocation(c.TimeZone); err != nil {
+		return nil, errors.Wrapf(err, `invalid time_zone %s`, c.TimeZone)
+	}
+
+	if err := c.ExportRedaction.Validate(); err != nil {
+		return nil, errors.Wrap(err, `invalid export_redaction`)
+	}
+
+	if c.Managed.Enabled && len(c.Managed.Label) == 0 {
+		return nil, errors.New(`managed.label must be set when managed load balancers are enabled`)
+	}
+
+	if c.HealthEmptiness.Timeout <= 0 {
+		return nil, errors.New(`health_emptiness.timeout must be positive`)
+	}
+	if c.HealthEmptiness.Concurrency <= 0 {
+		return nil, errors.New(`health_emptiness.concurrency must be positive`)
+	}
+	if c.NEGEmptiness.Threshold <= 0 {
+		return nil, errors.New(`neg_emptiness.threshold must be positive`)
+	}
+
+	if c.Confidence.MinScore < 0 || c.Confidence.MinScore > maxConfidenceScore {
+		return nil, errors.Errorf(`confidence.min_score must be between 0 and %d`, maxConfidenceScore)
+	}
+	if err := validatePolicies(c.Policies); err != nil {
+		return nil, errors.Wrap(err, `invalid policies`)
+	}
+	if err := validateRetention(c.Retention); err != nil {
+		return nil, errors.Wrap(err, `invalid retention`)
+	}
+
+	if err := validateClusterConventions(c.Clusters); err != nil {
+		return nil, errors.Wrap(err, `invalid cluster conventions`)
+	}
+	if err := validateMultiClusterIngress(c.MultiClusterIngress); err != nil {
+		return nil, errors.Wrap(err, `invalid multi_cluster_ingress`)
+	}
+
+	if c.InventoryDropThreshold < 0 || c.InventoryDropThreshold > 1 {
+		return nil, errors.New(`inventory_drop_threshold must be between 0 and 1`)
+	}
+
+	for _, name := range c.DisabledBuiltinExclusions {
+		if !isBuiltinExclusion(name) {
+			return nil, errors.Errorf(`unknown built-in exclusion %s`, name)
+		}
+	}
+
+	if err := validateAgeThresholds(c.AgeThresholds); err != nil {
+		return nil, errors.Wrap(err, `invalid age_thresholds`)
+	}
+
+	if err := validateNamePatterns(c.NamePatterns); err != nil {
+		return nil, errors.Wrap(err, `invalid name_patterns`)
+	}
+
+	if c.TaskExpiration <= 0 {
+		return nil, errors.New(`task_expiration must be positive`)
+	}
+	for kind, d := range c.TaskExpirations {
+		if _, ok := LookupCleaner(kind); !ok {
+			return nil, errors.Errorf(`unknown resource kind %s in task_expirations`, kind)
+		}
+		if d <= 0 {
+			return nil, errors.Errorf(`task expiration of %s must be positive`, kind)
+		}
+	}
+
+	for kind := range c.DisableBeforeDelete {
+		if _, ok := disableableKinds[kind]; !ok {
+			return nil, errors.Errorf(`resources of kind %s can not be disabled before deletion`, kind)
+		}
+	}
+	return c, nil
+}
+
+// ValidateStandalone returns an error if the configuration relies on
+// state that only the App Engine deployment keeps. Outside of App
+// Engine, there is no audit store to keep the firewall rules that are
+// pending deletion in, and firewall rules are not swept at all
+func (c *Config) ValidateStandalone() error {
+	if len(c.DisableBeforeDelete) > 0 {
+		return errors.New(`disable_before_delete is only supported on App Engine`)
+	}
+	return nil
+}
+
+// disableableKinds lists the kinds of resources that have a disabled
+// state, and thus support disable_before_delete
+var disableableKinds = map[string]struct{}{
+	KindFirewalls: {},
+}
+
+// AgeThresholdOf returns the age under which resources of the given kind
+// are never deleted, falling back to AgeThreshold
+func (c *Config) AgeThresholdOf(kind string) time.Duration {
+	if d, ok := c.AgeThresholds[kind]; ok {
+		return d
+	}
+	return c.AgeThreshold
+}
+
+// WithAgeThresholds returns a copy of the configuration whose age
+// thresholds are overridden by the given ones. A zero d keeps
+// AgeThreshold as is
+func (c *Config) WithAgeThresholds(d time.Duration, thresholds map[string]time.Duration) *Config {
+	cc := *c
+	if d > 0 {
+		cc.AgeThreshold = d
+	}
+	if len(thresholds) > 0 {
+		cc.AgeThresholds = make(map[string]time.Duration)
+		for kind, d := range c.AgeThresholds {
+			cc.AgeThresholds[kind] = d
+		}
+		for kind, d := range thresholds {
+			cc.AgeThresholds[kind] = d
+		}
+	}
+	return &cc
+}
+
+// isYoung returns true if a resource of the given kind, created at the
+// given RFC3339 timestamp, is younger than its age threshold. Resources
+// whose age can not be told are young
+func (c *Config) isYoung(kind, timestamp string) bool {
+	createdAt, err := time.Parse(time.RFC3339, timestamp)
+	return err != nil || createdAt.After(time.Now().Add(-1*c.AgeThresholdOf(kind)))
+}
+
+// ParseAgeThresholds parses a comma separated list of KIND=DURATION, as
+// in AGE_THRESHOLDS
+func ParseAgeThresholds(s string) (map[string]time.Duration, error) {
+	thresholds := make(map[string]time.Duration)
+	for _, item := range strings.Split(s, `,`) {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		i := strings.Index(item, `=`)
+		if i < 0 {
+			return nil, errors.Errorf(`invalid age threshold %s, expected KIND=DURATION`, item)
+		}
+		d, err := time.ParseDuration(item[i+1:])
+		if err != nil {
+			return nil, errors.Wrapf(err, `invalid age threshold for %s`, item[:i])
+		}
+		thresholds[item[:i]] = d
+	}
+	if err := validateAgeThresholds(thresholds); err != nil {
+		return nil, err
+	}
+	return thresholds, nil
+}
+
+// ageThresholdKinds lists the kinds of resources whose age is checked,
+// and thus support age_thresholds
+var ageThresholdKinds = map[string]struct{}{
+	KindAddresses:          {},
+	KindBackendServices:    {},
+	KindHealthChecks:       {},
+	KindHttpHealthChecks:   {},
+	KindHttpsHealthChecks:  {},
+	KindInstanceGroups:     {},
+	KindSslCertificates:    {},
+	KindTargetHttpProxies:  {},
+	KindTargetHttpsProxies: {},
+	KindTargetPools:        {},
+	KindUrlMaps:            {},
+}
+
+func validateAgeThresholds(thresholds map[string]time.Duration) error {
+	for kind, d := range thresholds {
+		if _, ok := ageThresholdKinds[kind]; !ok {
+			return errors.Errorf(`resources of kind %s have no age threshold`, kind)
+		}
+		if d < 0 {
+			return errors.Errorf(`age threshold of %s must not be negative`, kind)
+		}
+	}
+	return nil
+}
+
+// GracePeriod is how long resources stay disabled before they are
+// deleted. In configuration files, it may be given in days (7d) in
+// addition to the units of time.ParseDuration
+type GracePeriod time.Duration
+
+// UnmarshalYAML parses the grace period with ParseSnoozeDuration
+func (g *GracePeriod) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	d, err := ParseSnoozeDuration(s)
+	if err != nil {
+		return errors.Wrap(err, `invalid grace period`)
+	}
+	*g = GracePeriod(d)
+	return nil
+}
+
+// MarshalYAML writes the grace period as time.Duration does
+func (g GracePeriod) MarshalYAML() (interface{}, error) {
+	return time.Duration(g).String(), nil
+}
+
+// DisableGrace returns how long resources of the given kind should stay
+// disabled before they are deleted. 0 means they are deleted right away
+func (c *Config) DisableGrace(kind string) time.Duration {
+	return time.Duration(c.DisableBeforeDelete[kind])
+}
+
+// Fingerprint identifies the parts of the configuration that decide what
+// gets deleted. Pausing, deletion windows (and their time zone), retries
+// and snoozes are left out, as they only decide when it gets deleted
+func (c *Config) Fingerprint() string {
+	material := *c
+	material.Paused = false
+	material.DeletionWindows = nil
+	material.TimeZone = ``
+	material.Retry = RetryConfig{}
+	material.Snoozes = nil
+
+	buf, err := yaml.Marshal(&material)
+	if err != nil {
+		return ``
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExcluded returns true if the resource name matches any of the
+// exclusion patterns, or any of the built-in exclusions that have not
+// been disabled
+func (c *Config) IsExcluded(name string) bool {
+	for _, pattern := range c.Exclusions {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return c.builtinExclusion(name) != nil
+}
+
+// Config returns the configuration currently in effect
+func (app *App) Config() *Config {
+	app.muConfig.RLock()
+	defer app.muConfig.RUnlock()
+	return app.config
+}
+
+// SetConfig replaces the configuration. It is safe to call this while
+// other goroutines are using the App
+func (app *App) SetConfig(c *Config) {
+	app.muConfig.Lock()
+	defer app.muConfig.Unlock()
+	app.config = c
+}
+
+// LoadConfig reads the configuration from the given location, which may
+// be a local file, a GCS object (gs://bucket/object), or a Secret Manager
+// secret version (sm://projects/PROJECT/secrets/SECRET/versions/VERSION)
+func (app *App) LoadConfig(ctx context.Context, location string) (*Config, error) {
+	var buf []byte
+	var err error
+	switch {
+	case strings.HasPrefix(location, `gs://`):
+		buf, err = app.readGCSObject(ctx, strings.TrimPrefix(location, `gs://`))
+	case strings.HasPrefix(location, `sm://`):
+		buf, err = app.readSecret(ctx, strings.TrimPrefix(location, `sm://`))
+	default:
+		buf, err = ioutil.ReadFile(location)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to read configuration from %s`, location)
+	}
+
+	return ParseConfig(buf)
+}
+
+// ReloadConfig reads the configuration from the given location, and
+// makes it the configuration in effect
+func (app *App) ReloadConfig(ctx context.Context, location string) error {
+	c, err := app.LoadConfig(ctx, location)
+	if err != nil {
+		return err
+	}
+	app.SetConfig(c)
+	return nil
+}
+
+func (app *App) readGCSObject(ctx context.Context, s string) ([]byte, error) {
+	i := strings.IndexByte(s, '/')
+	if i <= 0 {
+		return nil, errors.Errorf(`invalid GCS location gs://%s`, s)
+	}
+
+	svc, err := storage.New(app.client)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create storage.Service`)
+	}
+
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+
+	res, err := svc.Objects.Get(s[:i], s[i+1:]).Context(ctx).Download()
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to download object`)
+	}
+	defer res.Body.Close()
+
+	return ioutil.ReadAll(res.Body)
+}
+
+func (app *App) readSecret(ctx context.Context, name string) ([]byte, error) {
+	svc, err := secretmanager.New(app.client)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create secretmanager.Service`)
+	}
+
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+
+	res, err := svc.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to access secret`)
+	}
+
+	return base64.StdEncoding.DecodeString(res.Payload.Data)
+}
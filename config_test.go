@@ -0,0 +1,167 @@
+package autolbclean_test
+
+import (
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+age_threshold: 3h
+exclusions:
+  - k8s-fw-default-handcrafted-*
+paused: true
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+
+	if !assert.Equal(t, 3*time.Hour, c.AgeThreshold, `age threshold should match`) {
+		return
+	}
+	if !assert.True(t, c.Paused, `paused should be true`) {
+		return
+	}
+	if !assert.Equal(t, []string{`k8s-fw`}, c.ForwardingRulePrefixes, `forwarding rule prefixes should be the default`) {
+		return
+	}
+	if !assert.Equal(t, []string{`k8s-be-`, `k8s1-`}, c.HealthCheckPrefixes, `only the health checks of ingresses should be checked by default`) {
+		return
+	}
+	if !assert.True(t, c.IsExcluded(`k8s-fw-default-handcrafted--c4f34d3824aedd50`), `should be excluded`) {
+		return
+	}
+	if !assert.False(t, c.IsExcluded(`k8s-fw-default-apiserver--c4f34d3824aedd50`), `should not be excluded`) {
+		return
+	}
+
+	_, err = autolbclean.ParseConfig([]byte("exclusions:\n  - \"[\"\n"))
+	if !assert.Error(t, err, `ParseConfig should fail for invalid patterns`) {
+		return
+	}
+
+	c, err = autolbclean.ParseConfig([]byte("disable_before_delete:\n  firewalls: 72h\n"))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 72*time.Hour, c.DisableGrace(autolbclean.KindFirewalls), `firewall grace should match`) {
+		return
+	}
+	if !assert.Equal(t, time.Duration(0), c.DisableGrace(autolbclean.KindUrlMaps), `url maps should not be disabled`) {
+		return
+	}
+
+	c, err = autolbclean.ParseConfig([]byte("disable_before_delete:\n  firewalls: 7d\n"))
+	if !assert.NoError(t, err, `ParseConfig should succeed for grace periods in days`) {
+		return
+	}
+	if !assert.Equal(t, 7*24*time.Hour, c.DisableGrace(autolbclean.KindFirewalls), `firewall grace should match`) {
+		return
+	}
+
+	_, err = autolbclean.ParseConfig([]byte("disable_before_delete:\n  urlMaps: 72h\n"))
+	if !assert.Error(t, err, `ParseConfig should fail for kinds that can not be disabled`) {
+		return
+	}
+
+	c, err = autolbclean.ParseConfig([]byte("retry:\n  mutation:\n    attempts: 1\n"))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 1, c.Retry.Mutation.Attempts, `mutation attempts should match`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.DefaultRetryConfig().Read, c.Retry.Read, `read policy should be the default`) {
+		return
+	}
+
+	_, err = autolbclean.ParseConfig([]byte("retry:\n  read:\n    attempts: 0\n"))
+	if !assert.Error(t, err, `ParseConfig should fail for invalid retry policies`) {
+		return
+	}
+
+	c, err = autolbclean.ParseConfig([]byte("health_emptiness:\n  enabled: true\n"))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.DefaultGetHealthTimeout, c.HealthEmptiness.Timeout, `timeout should be the default`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.DefaultGetHealthConcurrency, c.HealthEmptiness.Concurrency, `concurrency should be the default`) {
+		return
+	}
+
+	_, err = autolbclean.ParseConfig([]byte("health_emptiness:\n  concurrency: 0\n"))
+	if !assert.Error(t, err, `ParseConfig should fail for zero concurrency`) {
+		return
+	}
+	_, err = autolbclean.ParseConfig([]byte("health_emptiness:\n  concurrency: -1\n"))
+	if !assert.Error(t, err, `ParseConfig should fail for negative concurrency`) {
+		return
+	}
+}
+
+func TestAgeThresholds(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+age_threshold: 2h
+age_thresholds:
+  sslCertificates: 24h
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 24*time.Hour, c.AgeThresholdOf(autolbclean.KindSslCertificates), `certificates should use their own threshold`) {
+		return
+	}
+	if !assert.Equal(t, 2*time.Hour, c.AgeThresholdOf(autolbclean.KindTargetHttpProxies), `proxies should fall back to age_threshold`) {
+		return
+	}
+
+	overrides, err := autolbclean.ParseAgeThresholds(`targetHttpProxies=1h, backendServices=6h`)
+	if !assert.NoError(t, err, `ParseAgeThresholds should succeed`) {
+		return
+	}
+	c2 := c.WithAgeThresholds(0, overrides)
+	if !assert.Equal(t, time.Hour, c2.AgeThresholdOf(autolbclean.KindTargetHttpProxies)) {
+		return
+	}
+	if !assert.Equal(t, 24*time.Hour, c2.AgeThresholdOf(autolbclean.KindSslCertificates), `thresholds that are not overridden should be kept`) {
+		return
+	}
+	if !assert.Equal(t, 2*time.Hour, c.AgeThresholdOf(autolbclean.KindTargetHttpProxies), `the original configuration should be left alone`) {
+		return
+	}
+
+	if _, err := autolbclean.ParseAgeThresholds(`firewalls=1h`); !assert.Error(t, err, `firewalls have no age threshold`) {
+		return
+	}
+	if _, err := autolbclean.ParseConfig([]byte("age_thresholds:\n  urlMap: 1h\n")); !assert.Error(t, err, `unknown kinds should be rejected`) {
+		return
+	}
+}
+
+func TestTaskExpirations(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+task_expirations:
+  backendServices: 1h
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+	if !assert.Equal(t, time.Hour, c.TaskExpirationOf(autolbclean.KindBackendServices), `backend services should use their own expiration`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.DefaultTaskExpiration, c.TaskExpirationOf(autolbclean.KindForwardingRules), `forwarding rules should fall back to task_expiration`) {
+		return
+	}
+
+	if _, err := autolbclean.ParseConfig([]byte("task_expiration: 0s\n")); !assert.Error(t, err, `zero expiration should be rejected`) {
+		return
+	}
+	if _, err := autolbclean.ParseConfig([]byte("task_expirations:\n  backendService: 1h\n")); !assert.Error(t, err, `unknown kinds should be rejected`) {
+		return
+	}
+}
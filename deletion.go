@@ -0,0 +1,259 @@
+package autolbclean
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	cloudresourcemanager "google.golang.org/api/cloudresourcemanager/v1"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// Resource kinds, named after their compute API collections
+const (
+	KindForwardingRules       = `forwardingRules`
+	KindTargetHttpProxies     = `targetHttpProxies`
+	KindTargetHttpsProxies    = `targetHttpsProxies`
+	KindSslCertificates       = `sslCertificates`
+	KindBackendServices       = `backendServices`
+	KindBackendBuckets        = `backendBuckets`
+	KindUrlMaps               = `urlMaps`
+	KindHealthChecks          = `healthChecks`
+	KindHttpHealthChecks      = `httpHealthChecks`
+	KindHttpsHealthChecks     = `httpsHealthChecks`
+	KindTargetPools           = `targetPools`
+	KindFirewalls             = `firewalls`
+	KindInstanceGroups        = `instanceGroups`
+	KindNetworkEndpointGroups = `networkEndpointGroups`
+	KindAddresses             = `addresses`
+)
+
+// Deletions returns the list of resources that need to be deleted in
+// order to get rid of the orphaned load balancer. The list is ordered
+// so that a resource comes before the resources it references, which is
+// the order they must be deleted in when done one after the other
+func (o *Orphan) Deletions() []*Deletion {
+	var list []*Deletion
+
+	if len(o.ForwardingRule) > 0 {
+		list = append(list, &Deletion{
+			Kind:   KindForwardingRules,
+			Name:   o.ForwardingRule,
+			Region: o.Region,
+		})
+	}
+
+	// internal load balancers are made of regional resources, all in
+	// the region of their forwarding rule
+	region := o.Region
+	if isGlobal(region) {
+		region = globalRegion
+	}
+
+	tpKind := KindTargetHttpProxies
+	if o.IsHTTPs {
+		tpKind = KindTargetHttpsProxies
+	}
+	list = append(list, &Deletion{
+		Kind:   tpKind,
+		Name:   o.TargetProxy,
+		Region: region,
+	})
+
+	if o.IsHTTPs {
+		for _, cert := range o.Certificates {
+			certName, certRegion, err := ParseSslCertificates(cert)
+			if err != nil {
+				continue
+			}
+			list = append(list, &Deletion{
+				Kind:   KindSslCertificates,
+				Name:   certName,
+				Region: certRegion,
+			})
+		}
+	}
+
+	list = append(list, &Deletion{
+		Kind:   KindUrlMaps,
+		Name:   o.UrlMap,
+		Region: region,
+	})
+
+	for _, service := range o.BackendServices {
+		_, bsRegion, _ := ParseBackendServices(service.SelfLink)
+		list = append(list, &Deletion{
+			Kind:   KindBackendServices,
+			Name:   service.Name,
+			Region: bsRegion,
+		})
+	}
+
+	for _, hc := range o.HealthChecks {
+		list = append(list, &Deletion{
+			Kind:   hc.Kind,
+			Name:   hc.Name,
+			Region: hc.Region,
+		})
+	}
+
+	for _, d := range list {
+		d.Managed = o.Managed
+	}
+	return list
+}
+
+func isGlobal(region string) bool {
+	return region == `` || region == globalRegion
+}
+
+// Permission returns the IAM permission required to perform this deletion
+func (d *Deletion) Permission() string {
+	kind := d.Kind
+	switch kind {
+	case KindForwardingRules:
+		if isGlobal(d.Region) {
+			kind = `globalForwardingRules`
+		}
+	case KindAddresses:
+		if isGlobal(d.Region) {
+			kind = `globalAddresses`
+		}
+	case KindBackendServices:
+		if !isGlobal(d.Region) {
+			kind = `regionBackendServices`
+		}
+	case KindHealthChecks:
+		if !isGlobal(d.Region) {
+			kind = `regionHealthChecks`
+		}
+	case KindTargetHttpProxies:
+		if !isGlobal(d.Region) {
+			kind = `regionTargetHttpProxies`
+		}
+	case KindTargetHttpsProxies:
+		if !isGlobal(d.Region) {
+			kind = `regionTargetHttpsProxies`
+		}
+	case KindUrlMaps:
+		if !isGlobal(d.Region) {
+			kind = `regionUrlMaps`
+		}
+	case KindSslCertificates:
+		if !isGlobal(d.Region) {
+			kind = `regionSslCertificates`
+		}
+	}
+	return `compute.` + kind + `.delete`
+}
+
+// resourcePath returns the path of the resource, relative to the API root
+func (d *Deletion) resourcePath(project string) string {
+	scope := `global`
+	switch {
+	case len(d.Zone) > 0:
+		scope = `zones/` + d.Zone
+	case !isGlobal(d.Region):
+		scope = `regions/` + d.Region
+	}
+	return `projects/` + project + `/` + scope + `/` + d.Kind + `/` + d.Name
+}
+
+// APICall describes the API call that Delete makes for this deletion
+func (d *Deletion) APICall(project string) string {
+	return `DELETE https://compute.googleapis.com/compute/v1/` + d.resourcePath(project)
+}
+
+// GlobalName returns the full resource name of the deleted resource,
+// which is how the resource is identified in the billing export
+func (d *Deletion) GlobalName(project string) string {
+	return `//compute.googleapis.com/` + d.resourcePath(project)
+}
+
+// ProbeDeletions checks if the credentials we are running with are
+// allowed to perform the given deletions, and marks the ones that would
+// fail because of missing permissions as denied. This allows us to avoid
+// enqueuing jobs that would just keep on failing until they expire.
+//
+// Note that the permissions are tested against the project, so IAM
+// conditions that depend on individual resource names are not taken
+// into account
+func (app *App) ProbeDeletions(ctx context.Context, deletions []*Deletion) error {
+	seen := make(map[string]struct{})
+	var permissions []string
+	for _, d := range deletions {
+		perm := d.Permission()
+		if _, ok := seen[perm]; ok {
+			continue
+		}
+		seen[perm] = struct{}{}
+		permissions = append(permissions, perm)
+	}
+
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	res, err := app.crm.Projects.TestIamPermissions(app.project, &cloudresourcemanager.TestIamPermissionsRequest{
+		Permissions: permissions,
+	}).Context(ctx).Do()
+	if err != nil {
+		return errors.Wrap(err, `failed to test iam permissions`)
+	}
+
+	granted := make(map[string]struct{})
+	for _, perm := range res.Permissions {
+		granted[perm] = struct{}{}
+	}
+
+	for _, d := range deletions {
+		if _, ok := granted[d.Permission()]; !ok {
+			d.Denied = true
+		}
+	}
+	return nil
+}
+
+// NotDeletableError is the error of a deletion that was refused, as the
+// name of the resource looks like nothing that this tool cleans up, and
+// the resource did not opt into the cleanup
+type NotDeletableError struct {
+	Kind string
+	Name string
+}
+
+func (e *NotDeletableError) Error() string {
+	return fmt.Sprintf(`refusing to delete %s %s: name does not match any of the expected patterns, and it did not opt into the cleanup`, e.Kind, e.Name)
+}
+
+// IsNotDeletable returns true if err is the error of a refused deletion
+func IsNotDeletable(err error) bool {
+	_, ok := errors.Cause(err).(*NotDeletableError)
+	return ok
+}
+
+// Delete issues the API call to delete the resource described by d.
+// The returned operation may still be running. Every deletion goes
+// through here, so this is where resources whose names look like
+// nothing that we clean up are refused, whatever asked for them
+func (app *App) Delete(ctx context.Context, d *Deletion) (Operation, error) {
+	c, ok := LookupCleaner(d.Kind)
+	if !ok {
+		return nil, errors.Errorf(`unknown resource kind %s`, d.Kind)
+	}
+
+	deletable, err := app.isDeletable(ctx, d)
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to look up %s %s`, d.Kind, d.Name)
+	}
+	if !deletable {
+		return nil, &NotDeletableError{Kind: d.Kind, Name: d.Name}
+	}
+	return c.Delete(ctx, app, d)
+}
+
+// WaitOperation blocks until the given operation is done, and returns
+// an error if the operation failed
+func (app *App) WaitOperation(ctx context.Context, op Operation) error {
+	return op.Wait(ctx)
+}
@@ -0,0 +1,82 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeletionPermission(t *testing.T) {
+	list := map[string]*autolbclean.Deletion{
+		`compute.globalForwardingRules.delete`: {Kind: autolbclean.KindForwardingRules, Region: `global`},
+		`compute.forwardingRules.delete`:       {Kind: autolbclean.KindForwardingRules, Region: `asia-northeast1`},
+		`compute.backendServices.delete`:       {Kind: autolbclean.KindBackendServices, Region: `global`},
+		`compute.regionBackendServices.delete`: {Kind: autolbclean.KindBackendServices, Region: `asia-northeast1`},
+		`compute.regionHealthChecks.delete`:    {Kind: autolbclean.KindHealthChecks, Region: `asia-northeast1`},
+		`compute.httpHealthChecks.delete`:      {Kind: autolbclean.KindHttpHealthChecks, Region: `global`},
+		`compute.urlMaps.delete`:               {Kind: autolbclean.KindUrlMaps, Region: `global`},
+		`compute.regionUrlMaps.delete`:         {Kind: autolbclean.KindUrlMaps, Region: `asia-northeast1`},
+		`compute.instanceGroups.delete`:        {Kind: autolbclean.KindInstanceGroups, Zone: `asia-northeast1-a`},
+		`compute.globalAddresses.delete`:       {Kind: autolbclean.KindAddresses, Region: `global`},
+		`compute.addresses.delete`:             {Kind: autolbclean.KindAddresses, Region: `asia-northeast1`},
+	}
+
+	for expected, d := range list {
+		if !assert.Equal(t, expected, d.Permission(), `permission should match`) {
+			return
+		}
+	}
+}
+
+func TestDeletionAPICall(t *testing.T) {
+	list := map[string]*autolbclean.Deletion{
+		`DELETE https://compute.googleapis.com/compute/v1/projects/p/global/forwardingRules/k8s-fw-1`:                  {Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-1`, Region: `global`},
+		`DELETE https://compute.googleapis.com/compute/v1/projects/p/regions/asia-northeast1/forwardingRules/k8s-fw-2`: {Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-2`, Region: `asia-northeast1`},
+		`DELETE https://compute.googleapis.com/compute/v1/projects/p/global/firewalls/k8s-fw-l7--1`:                    {Kind: autolbclean.KindFirewalls, Name: `k8s-fw-l7--1`},
+		`DELETE https://compute.googleapis.com/compute/v1/projects/p/regions/asia-northeast1/urlMaps/k8s-um-1`:         {Kind: autolbclean.KindUrlMaps, Name: `k8s-um-1`, Region: `asia-northeast1`},
+		`DELETE https://compute.googleapis.com/compute/v1/projects/p/zones/asia-northeast1-a/instanceGroups/k8s-ig--1`: {Kind: autolbclean.KindInstanceGroups, Name: `k8s-ig--1`, Zone: `asia-northeast1-a`},
+	}
+
+	for expected, d := range list {
+		if !assert.Equal(t, expected, d.APICall(`p`), `api call should match`) {
+			return
+		}
+	}
+}
+
+func TestOrphanedTargetPoolDeletions(t *testing.T) {
+	o := &autolbclean.OrphanedTargetPool{
+		Name:            `a1b2c3`,
+		Region:          `asia-northeast1`,
+		ForwardingRules: []string{`a1b2c3`},
+		HealthChecks: []*autolbclean.HealthCheckRef{
+			{Kind: autolbclean.KindHttpHealthChecks, Name: `a1b2c3`, Region: `global`},
+		},
+	}
+
+	expected := []*autolbclean.Deletion{
+		{Kind: autolbclean.KindForwardingRules, Name: `a1b2c3`, Region: `asia-northeast1`},
+		{Kind: autolbclean.KindTargetPools, Name: `a1b2c3`, Region: `asia-northeast1`},
+		{Kind: autolbclean.KindHttpHealthChecks, Name: `a1b2c3`, Region: `global`},
+	}
+	if !assert.Equal(t, expected, o.Deletions(), `forwarding rules should be deleted before the target pool, and the pool before its health checks`) {
+		return
+	}
+}
+
+func TestDeleteRefusesUnexpectedNames(t *testing.T) {
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fakeCompute{}})
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	// the worker and the daemon delete through here, not through the
+	// delete jobs
+	_, err = app.Delete(context.Background(), &autolbclean.Deletion{Kind: autolbclean.KindHealthChecks, Name: `default-http`, Region: `global`})
+	if !assert.Error(t, err, `Delete should fail`) || !assert.True(t, autolbclean.IsNotDeletable(err), `resources with unexpected names should be refused`) {
+		return
+	}
+}
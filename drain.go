@@ -0,0 +1,92 @@
+package autolbclean
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+// DefaultDrainDelay is how long the deletion of a backend service is
+// delayed when it has no connection draining timeout of its own, but
+// still receives traffic or pins clients through session affinity
+const DefaultDrainDelay = 5 * time.Minute
+
+// trafficWindow is how far back the request count of a backend service
+// is looked at
+const trafficWindow = 5 * time.Minute
+
+const backendRequestCountMetric = `loadbalancing.googleapis.com/https/backend_request_count`
+
+// hasSessionAffinity returns true if clients are pinned to backends
+func hasSessionAffinity(s *compute.BackendService) bool {
+	return s.SessionAffinity != `` && s.SessionAffinity != `NONE`
+}
+
+// hasRecentTraffic returns true if the backend service served any
+// requests during the traffic window
+func (app *App) hasRecentTraffic(ctx context.Context, name string) (bool, error) {
+	svc, err := monitoring.New(app.client)
+	if err != nil {
+		return false, errors.Wrap(err, `failed to create monitoring.Service`)
+	}
+
+	listCtx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	now := time.Now().UTC()
+	res, err := svc.Projects.TimeSeries.List(`projects/` + app.project).
+		Filter(fmt.Sprintf(`metric.type = %q AND resource.labels.backend_target_name = %q`, backendRequestCountMetric, name)).
+		IntervalStartTime(now.Add(-1 * trafficWindow).Format(time.RFC3339)).
+		IntervalEndTime(now.Format(time.RFC3339)).
+		Context(listCtx).
+		Do()
+	if err != nil {
+		return false, errors.Wrap(err, `failed to list time series`)
+	}
+
+	for _, ts := range res.TimeSeries {
+		for _, p := range ts.Points {
+			if p.Value != nil && p.Value.Int64Value != nil && *p.Value.Int64Value > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// DrainDelay returns how long the deletion of the backend services of
+// the orphan should be delayed, so that connections to them can drain.
+// This is the longest connection draining timeout among them. Backend
+// services without one that still receive traffic or use session
+// affinity are given DefaultDrainDelay
+func (app *App) DrainDelay(ctx context.Context, o *Orphan) (time.Duration, error) {
+	var delay time.Duration
+	for _, s := range o.BackendServices {
+		var d time.Duration
+		if s.ConnectionDraining != nil {
+			d = time.Duration(s.ConnectionDraining.DrainingTimeoutSec) * time.Second
+		}
+
+		if d == 0 {
+			active := hasSessionAffinity(s)
+			if !active {
+				var err error
+				if active, err = app.hasRecentTraffic(ctx, s.Name); err != nil {
+					return 0, errors.Wrapf(err, `failed to check traffic of backend service %s`, s.Name)
+				}
+			}
+			if active {
+				d = DefaultDrainDelay
+			}
+		}
+
+		if d > delay {
+			delay = d
+		}
+	}
+	return delay, nil
+}
@@ -0,0 +1,39 @@
+package autolbclean_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestDrainDelay(t *testing.T) {
+	// none of these need the monitoring API to be asked
+	o := &autolbclean.Orphan{
+		BackendServices: []*compute.BackendService{
+			{Name: `k8s-be-30000--1`, ConnectionDraining: &compute.ConnectionDraining{DrainingTimeoutSec: 30}},
+			{Name: `k8s-be-30001--1`, ConnectionDraining: &compute.ConnectionDraining{DrainingTimeoutSec: 600}},
+			{Name: `k8s-be-30002--1`, SessionAffinity: `GENERATED_COOKIE`},
+		},
+	}
+
+	delay, err := new(autolbclean.App).DrainDelay(context.Background(), o)
+	if !assert.NoError(t, err, `DrainDelay should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 10*time.Minute, delay, `the longest draining timeout should win`) {
+		return
+	}
+
+	o.BackendServices = o.BackendServices[2:]
+	delay, err = new(autolbclean.App).DrainDelay(context.Background(), o)
+	if !assert.NoError(t, err, `DrainDelay should succeed`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.DefaultDrainDelay, delay, `session affinity should use the default delay`) {
+		return
+	}
+}
@@ -0,0 +1,76 @@
+package autolbclean
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Decisions reported in deletion events
+const (
+	DecisionScheduled = `scheduled`
+	DecisionSkipped   = `skipped`
+	DecisionDeleted   = `deleted`
+	DecisionFailed    = `failed`
+	DecisionExpired   = `expired` // the delete job expired before it ran
+)
+
+// NewRunID creates an identifier for a run, which sorts by the time the
+// run started
+func NewRunID() string {
+	var buf [4]byte
+	rand.Read(buf[:])
+	return fmt.Sprintf(`%s-%x`, time.Now().UTC().Format(`20060102T150405Z`), buf)
+}
+
+// RunID returns the identifier of the run the App is part of
+func (app *App) RunID() string {
+	return app.runID
+}
+
+// PublishEvent publishes the decision made about d to all registered
+// publishers. A publisher failing does not prevent the rest of them
+// from publishing the event
+func (app *App) PublishEvent(ctx context.Context, d *Deletion, decision string, err error) error {
+	ev := &DeletionEvent{
+		Kind:     d.Kind,
+		Name:     d.Name,
+		Region:   d.Region,
+		Zone:     d.Zone,
+		Decision: decision,
+	}
+	if err != nil {
+		ev.Error = RedactError(err)
+	}
+	return app.publish(ctx, ev)
+}
+
+// PublishSkipped publishes that the resource was not scheduled for
+// deletion, along with the reason why
+func (app *App) PublishSkipped(ctx context.Context, s *SkippedResource) error {
+	return app.publish(ctx, &DeletionEvent{
+		Kind:     s.Kind,
+		Name:     s.Name,
+		Region:   s.Region,
+		Decision: DecisionSkipped,
+		Reason:   s.Reason,
+	})
+}
+
+func (app *App) publish(ctx context.Context, ev *DeletionEvent) error {
+	ev.Project = app.project
+	ev.Cluster = app.Config().clusterPrefixOf(ev.Name)
+	ev.RunID = app.runID
+	ev.At = time.Now().UTC()
+
+	var err error
+	for _, p := range app.events {
+		if perr := p.Publish(ctx, ev); perr != nil && err == nil {
+			err = errors.Wrap(perr, `failed to publish event`)
+		}
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package autolbclean
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+)
+
+// Actions recorded in the audit table. Check decisions are recorded
+// when a check run schedules or skips a resource, and delete results
+// once its deletion is done
+const (
+	AuditActionCheck  = `check`
+	AuditActionDelete = `delete`
+)
+
+// auditRow is a row of the audit table. For skipped resources, error
+// holds the reason they were skipped
+type auditRow struct {
+	RunID        string    `bigquery:"run_id"`
+	Project      string    `bigquery:"project"`
+	Timestamp    time.Time `bigquery:"timestamp"`
+	ResourceType string    `bigquery:"resource_type"`
+	Name         string    `bigquery:"name"`
+	Region       string    `bigquery:"region"`
+	Action       string    `bigquery:"action"`
+	Outcome      string    `bigquery:"outcome"`
+	Error        string    `bigquery:"error"`
+}
+
+func newAuditRow(ev *DeletionEvent) *auditRow {
+	row := &auditRow{
+		RunID:        ev.RunID,
+		Project:      ev.Project,
+		Timestamp:    ev.At,
+		ResourceType: ev.Kind,
+		Name:         ev.Name,
+		Region:       ev.Region,
+		Action:       AuditActionCheck,
+		Outcome:      ev.Decision,
+		Error:        ev.Error,
+	}
+	switch ev.Decision {
+	case DecisionDeleted, DecisionFailed, DecisionExpired:
+		row.Action = AuditActionDelete
+	case DecisionSkipped:
+		row.Error = ev.Reason
+	}
+	return row
+}
+
+type bigqueryPublisher struct {
+	inserter *bigquery.Inserter
+}
+
+// NewBigQueryPublisher creates an EventPublisher that streams each event
+// as a row into the given table (project.dataset.table), which must
+// already exist with the audit table schema
+func NewBigQueryPublisher(ctx context.Context, client *http.Client, table string) (EventPublisher, error) {
+	parts := strings.Split(strings.Replace(table, `:`, `.`, 1), `.`)
+	if len(parts) != 3 {
+		return nil, errors.Errorf(`invalid audit table %q, expected project.dataset.table`, table)
+	}
+
+	bq, err := bigquery.NewClient(ctx, parts[0], option.WithHTTPClient(client))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create bigquery client`)
+	}
+	return &bigqueryPublisher{inserter: bq.Dataset(parts[1]).Table(parts[2]).Inserter()}, nil
+}
+
+func (p *bigqueryPublisher) Publish(ctx context.Context, ev *DeletionEvent) error {
+	if err := p.inserter.Put(ctx, newAuditRow(ev)); err != nil {
+		return errors.Wrap(err, `failed to insert audit row`)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package autolbclean
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+type pubsubPublisher struct {
+	service *pubsub.Service
+	topic   string
+}
+
+// NewPubSubPublisher creates an EventPublisher that publishes each event
+// as a JSON message to the given topic (projects/P/topics/T). The
+// decision, kind and project are also set as attributes, so that
+// subscriptions can filter on them
+func NewPubSubPublisher(client *http.Client, topic string) (EventPublisher, error) {
+	svc, err := pubsub.New(client)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create pubsub.Service`)
+	}
+	return &pubsubPublisher{service: svc, topic: topic}, nil
+}
+
+func (p *pubsubPublisher) Publish(ctx context.Context, ev *DeletionEvent) error {
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return errors.Wrap(err, `failed to encode event`)
+	}
+
+	_, err = p.service.Projects.Topics.Publish(p.topic, &pubsub.PublishRequest{
+		Messages: []*pubsub.PubsubMessage{
+			{
+				Data: base64.StdEncoding.EncodeToString(buf),
+				Attributes: map[string]string{
+					`decision`: ev.Decision,
+					`kind`:     ev.Kind,
+					`project`:  ev.Project,
+				},
+			},
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		return errors.Wrapf(err, `failed to publish event to %s`, p.topic)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingPublisher struct {
+	events []*autolbclean.DeletionEvent
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, ev *autolbclean.DeletionEvent) error {
+	p.events = append(p.events, ev)
+	return nil
+}
+
+func TestPublishEvent(t *testing.T) {
+	ctx := context.Background()
+	p := &recordingPublisher{}
+	e := &flakyEnqueuer{}
+	app, err := autolbclean.New(`p`, &http.Client{},
+		autolbclean.WithEventPublisher(p),
+		autolbclean.WithRunID(`run-1`),
+		autolbclean.WithTaskEnqueuer(e),
+	)
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	d := &autolbclean.Deletion{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-foo--c4f34d3824aedd50`}
+	if !assert.NoError(t, app.PublishEvent(ctx, d, autolbclean.DecisionFailed, errors.New(`boom`)), `PublishEvent should succeed`) {
+		return
+	}
+	if !assert.Len(t, p.events, 1, `one event should be published`) {
+		return
+	}
+
+	ev := p.events[0]
+	if !assert.Equal(t, `p`, ev.Project) {
+		return
+	}
+	if !assert.Equal(t, `run-1`, ev.RunID) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.DecisionFailed, ev.Decision) {
+		return
+	}
+	if !assert.Equal(t, `boom`, ev.Error) {
+		return
+	}
+	if !assert.Equal(t, `c4f34d3824aedd50`, ev.Cluster, `the cluster should be recorded`) {
+		return
+	}
+
+	// jobs continue the run that scheduled them
+	if !assert.NoError(t, app.Enqueue(ctx, autolbclean.DeletionTask(d, ``)), `Enqueue should succeed`) {
+		return
+	}
+	if !assert.Equal(t, `run-1`, e.tasks[0].Params.Get(`run`), `task should carry the run id`) {
+		return
+	}
+}
+
+func TestPublishSkipped(t *testing.T) {
+	p1 := &recordingPublisher{}
+	p2 := &recordingPublisher{}
+	app, err := autolbclean.New(`p`, &http.Client{},
+		autolbclean.WithEventPublisher(p1),
+		autolbclean.WithEventPublisher(p2),
+	)
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	report := &autolbclean.Report{}
+	report.SkipOrphan(&autolbclean.Orphan{TargetProxy: `k8s-tps-foo`, IsHTTPs: true}, `paused`)
+	if !assert.NoError(t, app.PublishSkipped(context.Background(), report.Skipped[0]), `PublishSkipped should succeed`) {
+		return
+	}
+
+	for _, p := range []*recordingPublisher{p1, p2} {
+		if !assert.Len(t, p.events, 1, `every publisher should get the event`) {
+			return
+		}
+		ev := p.events[0]
+		if !assert.Equal(t, autolbclean.KindTargetHttpsProxies, ev.Kind) {
+			return
+		}
+		if !assert.Equal(t, autolbclean.DecisionSkipped, ev.Decision) {
+			return
+		}
+		if !assert.Equal(t, `paused`, ev.Reason) {
+			return
+		}
+		if !assert.NotEmpty(t, ev.RunID, `a run id should be assigned`) {
+			return
+		}
+	}
+}
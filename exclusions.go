@@ -0,0 +1,91 @@
+package autolbclean
+
+import (
+	"path"
+)
+
+// builtinExclusions protects resources created by GKE itself, which may
+// look orphaned at times (e.g. while nodes are being recreated during an
+// upgrade) but must never be cleaned up. Each of them can be turned off
+// through Config.DisabledBuiltinExclusions
+var builtinExclusions = []*BuiltinExclusion{
+	{
+		Name:    `cluster-firewalls`,
+		Pattern: `gke-*-[0-9a-f]*-all`,
+		Reason:  `allows traffic between pods, created along with the cluster`,
+	},
+	{
+		Name:    `cluster-firewalls`,
+		Pattern: `gke-*-[0-9a-f]*-master`,
+		Reason:  `allows the control plane to reach the nodes`,
+	},
+	{
+		Name:    `cluster-firewalls`,
+		Pattern: `gke-*-[0-9a-f]*-vms`,
+		Reason:  `allows traffic between nodes, created along with the cluster`,
+	},
+	{
+		Name:    `cluster-firewalls`,
+		Pattern: `gke-*-[0-9a-f]*-ssh`,
+		Reason:  `allows the control plane to open ssh tunnels to the nodes`,
+	},
+	{
+		Name:    `cluster-firewalls`,
+		Pattern: `gke-*-[0-9a-f]*-inkubelet`,
+		Reason:  `allows traffic to the kubelet from within the cluster`,
+	},
+	{
+		Name:    `cluster-firewalls`,
+		Pattern: `gke-*-[0-9a-f]*-exkubelet`,
+		Reason:  `denies traffic to the kubelet from outside the cluster`,
+	},
+	{
+		Name:    `l7-health-check-firewall`,
+		Pattern: `k8s-fw-l7--*`,
+		Reason:  `allows the load balancer health checks to reach the nodes, shared by all ingresses of a cluster`,
+	},
+	{
+		Name:    `default-http-backend`,
+		Pattern: `k8s1-*-kube-system-default-http-backend-*`,
+		Reason:  `serves the default backend of all ingresses of a cluster`,
+	},
+}
+
+// BuiltinExclusions returns the exclusion rules that are applied in
+// addition to the ones in the configuration
+func BuiltinExclusions() []*BuiltinExclusion {
+	list := make([]*BuiltinExclusion, len(builtinExclusions))
+	for i, e := range builtinExclusions {
+		copied := *e
+		list[i] = &copied
+	}
+	return list
+}
+
+func isBuiltinExclusion(name string) bool {
+	for _, e := range builtinExclusions {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinExclusion returns the enabled built-in exclusion rule that
+// matches the resource name, if any
+func (c *Config) builtinExclusion(name string) *BuiltinExclusion {
+	disabled := make(map[string]struct{})
+	for _, n := range c.DisabledBuiltinExclusions {
+		disabled[n] = struct{}{}
+	}
+
+	for _, e := range builtinExclusions {
+		if _, ok := disabled[e.Name]; ok {
+			continue
+		}
+		if ok, _ := path.Match(e.Pattern, name); ok {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package autolbclean_test
+
+import (
+	"path"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinExclusions(t *testing.T) {
+	t.Run("Patterns", func(t *testing.T) {
+		for _, e := range autolbclean.BuiltinExclusions() {
+			_, err := path.Match(e.Pattern, ``)
+			if !assert.NoError(t, err, `pattern %s should be valid`, e.Pattern) {
+				return
+			}
+			if !assert.NotEmpty(t, e.Reason, `exclusion %s should have a reason`, e.Pattern) {
+				return
+			}
+		}
+	})
+	t.Run("Match", func(t *testing.T) {
+		c := autolbclean.DefaultConfig()
+		excluded := []string{
+			`gke-prod-cluster-1a2b3c4d-all`,
+			`gke-prod-cluster-1a2b3c4d-master`,
+			`gke-prod-cluster-1a2b3c4d-vms`,
+			`gke-prod-cluster-1a2b3c4d-ssh`,
+			`gke-prod-cluster-1a2b3c4d-inkubelet`,
+			`gke-prod-cluster-1a2b3c4d-exkubelet`,
+			`k8s-fw-l7--c4f34d3824aedd50`,
+			`k8s1-c4f34d38-kube-system-default-http-backend-80-9f2b1e3a`,
+		}
+		for _, name := range excluded {
+			if !assert.True(t, c.IsExcluded(name), `%s should be excluded`, name) {
+				return
+			}
+		}
+
+		included := []string{
+			`k8s-fw-default-apiserver--c4f34d3824aedd50`,
+			`k8s-fw-a1b2c3d4e5f6-http-hc`,
+			`k8s1-c4f34d38-default-frontend-80-9f2b1e3a`,
+			`gke-prod-cluster-1a2b3c4d-node-allow`,
+		}
+		for _, name := range included {
+			if !assert.False(t, c.IsExcluded(name), `%s should not be excluded`, name) {
+				return
+			}
+		}
+	})
+	t.Run("Disable", func(t *testing.T) {
+		c, err := autolbclean.ParseConfig([]byte("disabled_builtin_exclusions: [ l7-health-check-firewall ]\n"))
+		if !assert.NoError(t, err, `ParseConfig should succeed`) {
+			return
+		}
+		if !assert.False(t, c.IsExcluded(`k8s-fw-l7--c4f34d3824aedd50`), `disabled exclusion should not apply`) {
+			return
+		}
+		if !assert.True(t, c.IsExcluded(`gke-prod-cluster-1a2b3c4d-all`), `other exclusions should still apply`) {
+			return
+		}
+
+		_, err = autolbclean.ParseConfig([]byte("disabled_builtin_exclusions: [ no-such-exclusion ]\n"))
+		if !assert.Error(t, err, `ParseConfig should fail for unknown exclusions`) {
+			return
+		}
+	})
+}
@@ -0,0 +1,215 @@
+package autolbclean
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// Verdicts of an explanation
+const (
+	VerdictWouldDelete = `would-delete`
+	VerdictWouldSkip   = `would-skip`
+)
+
+// Checks that an explanation walks through, in the order a run makes
+// them
+const (
+	CheckInventory       = `inventory`
+	CheckForwardingRule  = `forwarding_rule`
+	CheckTargetProxy     = `target_proxy`
+	CheckUrlMap          = `url_map`
+	CheckBackendServices = `backend_services`
+	CheckAge             = `age`
+	CheckInstances       = `instances`
+	CheckEndpoints       = `endpoints`
+	CheckProtection      = `protection`
+	CheckHealthChecks    = `health_checks`
+	CheckExclusions      = `exclusions`
+	CheckSnooze          = `snooze`
+	CheckNEGEmptiness    = `neg_emptiness`
+	CheckUpgrades        = `upgrades`
+	CheckLiveClusters    = `live_clusters`
+	CheckMultiCluster    = `multi_cluster_ingress`
+	CheckConfidence      = `confidence`
+	CheckPolicies        = `policies`
+	CheckTerraform       = `terraform`
+	CheckDeletionsHeld   = `deletions_held`
+)
+
+// The methods that record steps do nothing on a nil explanation, so
+// that the checks can record them unconditionally
+
+func (ex *Explanation) record(check string, passed bool, format string, args ...interface{}) {
+	if ex == nil {
+		return
+	}
+	ex.Steps = append(ex.Steps, &ExplanationStep{
+		Check:  check,
+		Passed: passed,
+		Detail: Redact(fmt.Sprintf(format, args...)),
+	})
+}
+
+func (ex *Explanation) pass(check string, format string, args ...interface{}) {
+	ex.record(check, true, format, args...)
+}
+
+func (ex *Explanation) fail(check string, format string, args ...interface{}) {
+	ex.record(check, false, format, args...)
+}
+
+// addResource adds a resource that the latest step found
+func (ex *Explanation) addResource(selfLink string) {
+	if ex == nil || len(ex.Steps) == 0 {
+		return
+	}
+	step := ex.Steps[len(ex.Steps)-1]
+	step.Resources = append(step.Resources, selfLink)
+}
+
+// setCount sets what the latest step counted
+func (ex *Explanation) setCount(n int) {
+	if ex == nil || len(ex.Steps) == 0 {
+		return
+	}
+	ex.Steps[len(ex.Steps)-1].Count = &n
+}
+
+func (app *App) getForwardingRule(ctx context.Context, region, name string) (*compute.ForwardingRule, error) {
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+	if isGlobal(region) {
+		return app.service.GlobalForwardingRules.Get(app.project, name).Context(ctx).Do()
+	}
+	return app.service.ForwardingRules.Get(app.project, region, name).Context(ctx).Do()
+}
+
+// Explain walks the load balancer of the forwarding rule through the
+// checks that a run makes, and tells whether the run would delete it,
+// or which check would keep it. Nothing is scheduled for deletion, and
+// nothing that later runs rely on is recorded
+func (app *App) Explain(ctx context.Context, name, region string) *Explanation {
+	if isGlobal(region) {
+		region = globalRegion
+	}
+	ex := &Explanation{
+		Project:        app.project,
+		ForwardingRule: name,
+		Region:         region,
+		Steps:          []*ExplanationStep{},
+	}
+
+	c := app.Config()
+	now := time.Now().UTC()
+	o := app.explainOrphan(ctx, ex, name, region)
+	if o != nil {
+		ex.owner = o
+		if managed, err := app.isTerraformManaged(ctx, o); err != nil {
+			ex.fail(CheckTerraform, `failed to check whether it is managed by terraform: %s`, err)
+		} else if managed {
+			ex.fail(CheckTerraform, `it would be handed off to the terraform pipeline instead`)
+		} else if held := c.DeletionsHeld(now); len(held) > 0 {
+			ex.fail(CheckDeletionsHeld, `deletions are held: %s`, held)
+		} else {
+			ex.pass(CheckDeletionsHeld, `deletions are not held`)
+		}
+		ex.Orphan = c.DescribeOrphan(o, now)
+	}
+
+	ex.Verdict = VerdictWouldDelete
+	for _, step := range ex.Steps {
+		if !step.Passed {
+			ex.Verdict = VerdictWouldSkip
+			ex.Reason = step.Detail
+			break
+		}
+	}
+	return ex
+}
+
+// explainOrphan makes the checks that discovery and FindOrphans make,
+// for a single forwarding rule, and returns the orphan if all of them
+// pass. Nothing that later runs rely on is recorded
+func (app *App) explainOrphan(ctx context.Context, ex *Explanation, name, region string) *Orphan {
+	ctx = context.WithValue(ctx, readOnlyKey{}, true)
+	c := app.Config()
+
+	// a run that sees the inventory drop deletes nothing at all
+	if err := app.checkInventory(ctx, KindForwardingRules, func() (int, error) {
+		fwrs, err := app.ListIngressForwardingRules(ctx)
+		return len(fwrs), errors.Wrap(err, `failed to list ingress forwarding rules`)
+	}); err != nil {
+		ex.fail(CheckInventory, `%s`, err)
+		return nil
+	}
+	ex.pass(CheckInventory, `the inventory of forwarding rules did not drop`)
+
+	fwr, err := app.getForwardingRule(ctx, region, name)
+	if err != nil {
+		ex.fail(CheckForwardingRule, `failed to get forwarding rule %s: %s`, name, err)
+		return nil
+	}
+	ex.pass(CheckForwardingRule, `found %s`, fwr.SelfLink)
+
+	tpname, tpregion, isHTTPs, err := ParseTargetProxy(fwr.Target)
+	if err != nil {
+		ex.fail(CheckTargetProxy, `%s is not a target http(s) proxy`, fwr.Target)
+		return nil
+	}
+
+	// team scoped admins may only look at the load balancers of their
+	// teams, even if they turn out not to be orphaned
+	ex.owner = &Orphan{
+		Cluster:     c.ClusterOf(tpname),
+		Labels:      fwr.Labels,
+		Namespace:   KubernetesNamespace(fwr.Description),
+		TargetProxy: tpname,
+	}
+
+	managed := c.IsManaged(fwr.Labels, fwr.Description)
+	if !hasAnyPrefix(fwr.Name, c.forwardingRulePrefixes()) && !managed {
+		ex.fail(CheckForwardingRule, `its name starts with none of %s, and it does not opt into the cleanup`, strings.Join(c.forwardingRulePrefixes(), `, `))
+		return nil
+	}
+	if c.IsProtected(fwr.Labels, fwr.Description) {
+		ex.fail(CheckProtection, `the forwarding rule opted out of the cleanup`)
+		return nil
+	}
+
+	o, err := app.findOrphan(ctx, fwr.Name, tpregion, tpname, isHTTPs, ex)
+	if err != nil || o == nil {
+		return nil
+	}
+	o.setForwardingRule(fwr, c)
+
+	// the same steps as FindOrphans, in the same order
+	orphans, err := app.filterOrphans(ctx, []*Orphan{o}, ex)
+	if err != nil || len(orphans) == 0 {
+		return nil
+	}
+
+	if c.Confidence.Enabled {
+		if o.Confidence == nil {
+			ex.fail(CheckConfidence, `it has no confidence score`)
+			return nil
+		}
+		if o.Confidence.Score < c.Confidence.MinScore {
+			ex.fail(CheckConfidence, `confidence %d is below %d (signals: %s)`, o.Confidence.Score, c.Confidence.MinScore, strings.Join(o.Confidence.Signals, `, `))
+			return nil
+		}
+		ex.pass(CheckConfidence, `confidence %d is at least %d (signals: %s)`, o.Confidence.Score, c.Confidence.MinScore, strings.Join(o.Confidence.Signals, `, `))
+	}
+	if !c.Policies.isNoop() {
+		if len(o.PolicyHold) > 0 {
+			ex.fail(CheckPolicies, `%s`, o.PolicyHold)
+			return nil
+		}
+		ex.pass(CheckPolicies, `the policies allow deleting all of its resources`)
+	}
+	return o
+}
@@ -0,0 +1,114 @@
+package autolbclean_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCompute answers the GET requests of the compute API with the
+// resources registered under their path below the project
+type fakeCompute map[string]interface{}
+
+func (f fakeCompute) RoundTrip(r *http.Request) (*http.Response, error) {
+	status := http.StatusNotFound
+	var body interface{} = map[string]interface{}{`error`: map[string]interface{}{`code`: 404, `message`: `not found`}}
+	if i := strings.Index(r.URL.Path, `/projects/p/`); i >= 0 {
+		if v, ok := f[r.URL.Path[i+len(`/projects/p/`):]]; ok {
+			status = http.StatusOK
+			body = v
+		}
+	}
+	buf, _ := json.Marshal(body)
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{`Content-Type`: []string{`application/json`}},
+		Body:       ioutil.NopCloser(bytes.NewReader(buf)),
+		Request:    r,
+	}, nil
+}
+
+func TestExplain(t *testing.T) {
+	const prefix = `https://www.googleapis.com/compute/v1/projects/p/global/`
+	fake := fakeCompute{
+		`global/forwardingRules/k8s-fw-a`: map[string]interface{}{
+			`name`:     `k8s-fw-a`,
+			`selfLink`: prefix + `forwardingRules/k8s-fw-a`,
+			`target`:   prefix + `targetHttpProxies/k8s-tp-a`,
+		},
+		`global/targetHttpProxies/k8s-tp-a`: map[string]interface{}{
+			`name`:              `k8s-tp-a`,
+			`selfLink`:          prefix + `targetHttpProxies/k8s-tp-a`,
+			`urlMap`:            prefix + `urlMaps/k8s-um-a`,
+			`creationTimestamp`: `2026-01-01T00:00:00Z`,
+		},
+		`global/urlMaps/k8s-um-a`: map[string]interface{}{
+			`name`:              `k8s-um-a`,
+			`selfLink`:          prefix + `urlMaps/k8s-um-a`,
+			`defaultService`:    prefix + `backendServices/k8s-be-a`,
+			`creationTimestamp`: `2026-01-01T00:00:00Z`,
+		},
+		`global/backendServices/k8s-be-a`: map[string]interface{}{
+			`name`:              `k8s-be-a`,
+			`selfLink`:          prefix + `backendServices/k8s-be-a`,
+			`creationTimestamp`: `2026-01-01T00:00:00Z`,
+		},
+		// listed for the inventory check, as a run does
+		`aggregated/forwardingRules`: map[string]interface{}{},
+		`global/forwardingRules/web`: map[string]interface{}{
+			`name`:     `web`,
+			`selfLink`: prefix + `forwardingRules/web`,
+			`target`:   prefix + `targetHttpProxies/k8s-tp-a`,
+		},
+	}
+
+	ctx := context.Background()
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake})
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	ex := app.Explain(ctx, `k8s-fw-a`, ``)
+	if !assert.Equal(t, autolbclean.VerdictWouldDelete, ex.Verdict, `orphaned load balancer should be deleted (%s)`, ex.Reason) {
+		return
+	}
+	var checks []string
+	for _, step := range ex.Steps {
+		checks = append(checks, step.Check)
+		if step.Check == autolbclean.CheckInstances {
+			if !assert.NotNil(t, step.Count, `instances should be counted`) || !assert.Equal(t, 0, *step.Count) {
+				return
+			}
+		}
+	}
+	if !assert.Equal(t, autolbclean.CheckInventory, checks[0], `the inventory should be checked first`) {
+		return
+	}
+	if !assert.Contains(t, checks, autolbclean.CheckUrlMap) || !assert.Contains(t, checks, autolbclean.CheckInstances) {
+		return
+	}
+	if !assert.NotNil(t, ex.Orphan, `orphan should be described`) || !assert.Len(t, ex.Orphan.Chain, 4) {
+		return
+	}
+
+	ex = app.Explain(ctx, `web`, `global`)
+	if !assert.Equal(t, autolbclean.VerdictWouldSkip, ex.Verdict, `forwarding rules without the prefix should be skipped`) {
+		return
+	}
+	if !assert.Contains(t, ex.Reason, `k8s-fw`, `reason should name the prefixes`) || !assert.Nil(t, ex.Orphan) {
+		return
+	}
+
+	ex = app.Explain(ctx, `k8s-fw-missing`, ``)
+	last := ex.Steps[len(ex.Steps)-1]
+	if !assert.Equal(t, autolbclean.VerdictWouldSkip, ex.Verdict) || !assert.Equal(t, autolbclean.CheckForwardingRule, last.Check) || !assert.False(t, last.Passed) {
+		return
+	}
+}
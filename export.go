@@ -0,0 +1,161 @@
+package autolbclean
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Formats that a plan can be exported to
+const (
+	ExportFormatWorkflows  = `workflows`
+	ExportFormatCloudBuild = `cloudbuild`
+)
+
+// cloudSDKImage is the image that the Cloud Build steps run gcloud in
+const cloudSDKImage = `gcr.io/google.com/cloudsdktool/cloud-sdk:slim`
+
+// exportKind describes how a resource kind is deleted by the platforms
+// that plans are exported to
+type exportKind struct {
+	param    string // name of the resource parameter of the compute API
+	group    string // gcloud compute command group, which may take several words
+	location bool   // whether gcloud takes --global or --region
+	zonal    bool   // whether gcloud takes --zone
+}
+
+var exportKinds = map[string]exportKind{
+	KindForwardingRules:    {param: `forwardingRule`, group: `forwarding-rules`, location: true},
+	KindTargetHttpProxies:  {param: `targetHttpProxy`, group: `target-http-proxies`, location: true},
+	KindTargetHttpsProxies: {param: `targetHttpsProxy`, group: `target-https-proxies`, location: true},
+	KindSslCertificates:    {param: `sslCertificate`, group: `ssl-certificates`, location: true},
+	KindUrlMaps:            {param: `urlMap`, group: `url-maps`, location: true},
+	KindBackendServices:    {param: `backendService`, group: `backend-services`, location: true},
+	KindHealthChecks:       {param: `healthCheck`, group: `health-checks`, location: true},
+	KindHttpHealthChecks:   {param: `httpHealthCheck`, group: `http-health-checks`},
+	KindHttpsHealthChecks:  {param: `httpsHealthCheck`, group: `https-health-checks`},
+	KindTargetPools:        {param: `targetPool`, group: `target-pools`, location: true},
+	KindFirewalls:          {param: `firewall`, group: `firewall-rules`},
+	KindAddresses:          {param: `address`, group: `addresses`, location: true},
+	// GKE only creates unmanaged instance groups
+	KindInstanceGroups:        {param: `instanceGroup`, group: `instance-groups unmanaged`, zonal: true},
+	KindNetworkEndpointGroups: {param: `networkEndpointGroup`, group: `network-endpoint-groups`, zonal: true},
+}
+
+// ParseExportFormat validates the name of an export format
+func ParseExportFormat(s string) (string, error) {
+	switch s {
+	case ExportFormatWorkflows, ExportFormatCloudBuild:
+		return s, nil
+	}
+	return ``, errors.Errorf(`invalid export format %q (expected %s or %s)`, s, ExportFormatWorkflows, ExportFormatCloudBuild)
+}
+
+// ExportPlan translates the deletions of a plan, as written by a plan
+// only run, into a definition that performs them one after the other on
+// the given platform. Deletions that were already carried out are left
+// out
+func ExportPlan(result *WorkerResult, format string) ([]byte, error) {
+	if len(result.Project) == 0 {
+		return nil, errors.New(`plan does not name a project`)
+	}
+
+	var deletions []*DeletionResult
+	for _, dr := range result.Deletions {
+		if dr.Deleted {
+			continue
+		}
+		kind, ok := exportKinds[dr.Kind]
+		if !ok {
+			return nil, errors.Errorf(`can not export the deletion of %s %s: unsupported resource kind`, dr.Kind, dr.Name)
+		}
+		if kind.zonal && len(dr.Zone) == 0 {
+			return nil, errors.Errorf(`can not export the deletion of %s %s: no zone`, dr.Kind, dr.Name)
+		}
+		deletions = append(deletions, dr)
+	}
+	if len(deletions) == 0 {
+		return nil, errors.New(`plan has nothing left to delete`)
+	}
+
+	var doc interface{}
+	switch format {
+	case ExportFormatWorkflows:
+		doc = workflowDefinition(result.Project, deletions)
+	case ExportFormatCloudBuild:
+		doc = cloudBuildConfig(result.Project, deletions)
+	default:
+		return nil, errors.Errorf(`invalid export format %q`, format)
+	}
+
+	buf, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to encode exported plan`)
+	}
+	return buf, nil
+}
+
+// workflowDefinition calls the compute API connector for each deletion.
+// Connector calls wait for the operation to finish, so a resource is
+// only deleted once the resources referencing it are gone
+func workflowDefinition(project string, deletions []*DeletionResult) yaml.MapSlice {
+	var steps []yaml.MapSlice
+	for i, dr := range deletions {
+		d := dr.deletion()
+		// compute.<collection>.delete
+		collection := strings.TrimSuffix(strings.TrimPrefix(d.Permission(), `compute.`), `.delete`)
+
+		args := yaml.MapSlice{{Key: `project`, Value: project}}
+		switch {
+		case exportKinds[dr.Kind].zonal:
+			args = append(args, yaml.MapItem{Key: `zone`, Value: d.Zone})
+		case !isGlobal(d.Region):
+			args = append(args, yaml.MapItem{Key: `region`, Value: d.Region})
+		}
+		args = append(args, yaml.MapItem{Key: exportKinds[dr.Kind].param, Value: dr.Name})
+
+		steps = append(steps, yaml.MapSlice{{
+			Key: fmt.Sprintf(`delete_%03d`, i+1),
+			Value: yaml.MapSlice{
+				{Key: `call`, Value: `googleapis.compute.v1.` + collection + `.delete`},
+				{Key: `args`, Value: args},
+			},
+		}})
+	}
+	return yaml.MapSlice{{Key: `main`, Value: yaml.MapSlice{{Key: `steps`, Value: steps}}}}
+}
+
+// cloudBuildConfig runs gcloud for each deletion. Steps without waitFor
+// run one after the other, and gcloud waits for each operation
+func cloudBuildConfig(project string, deletions []*DeletionResult) yaml.MapSlice {
+	var steps []yaml.MapSlice
+	for i, dr := range deletions {
+		kind := exportKinds[dr.Kind]
+		args := append([]string{`compute`}, strings.Fields(kind.group)...)
+		args = append(args, `delete`, dr.Name)
+		switch {
+		case kind.zonal:
+			args = append(args, `--zone=`+dr.Zone)
+		case kind.location:
+			if isGlobal(dr.Region) {
+				args = append(args, `--global`)
+			} else {
+				args = append(args, `--region=`+dr.Region)
+			}
+		}
+		args = append(args, `--project=`+project, `--quiet`)
+
+		steps = append(steps, yaml.MapSlice{
+			{Key: `id`, Value: fmt.Sprintf(`delete-%03d-%s`, i+1, dr.Name)},
+			{Key: `name`, Value: cloudSDKImage},
+			{Key: `entrypoint`, Value: `gcloud`},
+			{Key: `args`, Value: args},
+		})
+	}
+	return yaml.MapSlice{
+		{Key: `steps`, Value: steps},
+		{Key: `options`, Value: yaml.MapSlice{{Key: `logging`, Value: `CLOUD_LOGGING_ONLY`}}},
+	}
+}
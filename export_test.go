@@ -0,0 +1,93 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportPlan(t *testing.T) {
+	plan := &autolbclean.WorkerResult{
+		Project: `my-project`,
+		Deletions: []*autolbclean.DeletionResult{
+			{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-1`, Region: `global`, Deleted: true},
+			{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-1`, Region: `asia-northeast1`},
+			{Kind: autolbclean.KindBackendServices, Name: `k8s-be-30000`, Region: `global`},
+		},
+	}
+
+	buf, err := autolbclean.ExportPlan(plan, autolbclean.ExportFormatWorkflows)
+	if !assert.NoError(t, err, `exporting to workflows should succeed`) {
+		return
+	}
+	expected := `main:
+  steps:
+  - delete_001:
+      call: googleapis.compute.v1.regionUrlMaps.delete
+      args:
+        project: my-project
+        region: asia-northeast1
+        urlMap: k8s-um-1
+  - delete_002:
+      call: googleapis.compute.v1.backendServices.delete
+      args:
+        project: my-project
+        backendService: k8s-be-30000
+`
+	if !assert.Equal(t, expected, string(buf), `workflow definition should match`) {
+		return
+	}
+
+	buf, err = autolbclean.ExportPlan(plan, autolbclean.ExportFormatCloudBuild)
+	if !assert.NoError(t, err, `exporting to cloud build should succeed`) {
+		return
+	}
+	if !assert.Contains(t, string(buf), `- compute
+  - url-maps
+  - delete
+  - k8s-um-1
+  - --region=asia-northeast1
+  - --project=my-project
+  - --quiet`, `gcloud arguments should match`) {
+		return
+	}
+
+	zonal := &autolbclean.WorkerResult{
+		Project: `my-project`,
+		Deletions: []*autolbclean.DeletionResult{
+			{Kind: autolbclean.KindInstanceGroups, Name: `k8s-ig--1`, Region: `asia-northeast1`, Zone: `asia-northeast1-a`},
+		},
+	}
+	buf, err = autolbclean.ExportPlan(zonal, autolbclean.ExportFormatCloudBuild)
+	if !assert.NoError(t, err, `exporting zonal resources should succeed`) {
+		return
+	}
+	if !assert.Contains(t, string(buf), `- compute
+  - instance-groups
+  - unmanaged
+  - delete
+  - k8s-ig--1
+  - --zone=asia-northeast1-a
+  - --project=my-project`, `gcloud arguments should match`) {
+		return
+	}
+	buf, err = autolbclean.ExportPlan(zonal, autolbclean.ExportFormatWorkflows)
+	if !assert.NoError(t, err, `exporting zonal resources should succeed`) {
+		return
+	}
+	if !assert.Contains(t, string(buf), `        zone: asia-northeast1-a
+        instanceGroup: k8s-ig--1`, `workflow arguments should match`) {
+		return
+	}
+
+	zonal.Deletions[0].Zone = ``
+	if _, err := autolbclean.ExportPlan(zonal, autolbclean.ExportFormatCloudBuild); !assert.Error(t, err, `zonal resources without a zone should be rejected`) {
+		return
+	}
+
+	plan.Deletions = append(plan.Deletions, &autolbclean.DeletionResult{Kind: `backendBuckets`, Name: `k8s-bb-1`})
+	if _, err := autolbclean.ExportPlan(plan, autolbclean.ExportFormatCloudBuild); !assert.Error(t, err, `unsupported kinds should be rejected`) {
+		return
+	}
+}
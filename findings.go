@@ -0,0 +1,263 @@
+package autolbclean
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Formats that a report can be written in
+const (
+	ReportFormatText  = `text`
+	ReportFormatJSON  = `json`
+	ReportFormatSARIF = `sarif`
+)
+
+// FindingsSchemaURL identifies the JSON Schema that findings validate
+// against. The schema itself is in schema/findings.schema.json
+const FindingsSchemaURL = `https://raw.githubusercontent.com/lestrrat/gcp-auto-lb-clean/master/schema/findings.schema.json`
+
+// Rules that findings are reported under
+const (
+	RuleOrphanedLoadBalancer               = `orphaned-load-balancer`
+	RuleOrphanedInternetFacingLoadBalancer = `orphaned-internet-facing-load-balancer`
+)
+
+// Levels of findings, as in SARIF
+const (
+	LevelWarning = `warning`
+	LevelError   = `error`
+)
+
+type findingRule struct {
+	id          string
+	level       string
+	description string
+}
+
+var findingRules = []findingRule{
+	{
+		id:          RuleOrphanedLoadBalancer,
+		level:       LevelWarning,
+		description: `Load balancer resources left behind by a GKE ingress or service that no longer exists`,
+	},
+	{
+		id:          RuleOrphanedInternetFacingLoadBalancer,
+		level:       LevelError,
+		description: `Orphaned load balancer that still accepts traffic from the internet on an external IP address`,
+	},
+}
+
+// ParseReportFormat validates the name of a report format
+func ParseReportFormat(s string) (string, error) {
+	switch s {
+	case ReportFormatText, ReportFormatJSON, ReportFormatSARIF:
+		return s, nil
+	}
+	return ``, errors.Errorf(`invalid report format %q (expected %s, %s or %s)`, s, ReportFormatText, ReportFormatJSON, ReportFormatSARIF)
+}
+
+// IsInternetFacing returns true if the load balancer still has a
+// forwarding rule with an external load balancing scheme
+func (o *Orphan) IsInternetFacing() bool {
+	if len(o.ForwardingRule) == 0 {
+		return false
+	}
+	switch o.Scheme {
+	case `EXTERNAL`, `EXTERNAL_MANAGED`:
+		return true
+	}
+	return false
+}
+
+func (o *Orphan) finding() *Finding {
+	f := &Finding{
+		RuleID:         RuleOrphanedLoadBalancer,
+		Level:          LevelWarning,
+		TargetProxy:    o.TargetProxy,
+		SelfLink:       o.SelfLink,
+		ForwardingRule: o.ForwardingRule,
+		Region:         o.Region,
+		IPAddress:      o.IPAddress,
+		Scheme:         o.Scheme,
+		InternetFacing: o.IsInternetFacing(),
+		Cluster:        o.Cluster,
+		Resources:      []*FindingResource{},
+	}
+	if f.InternetFacing {
+		f.RuleID = RuleOrphanedInternetFacingLoadBalancer
+		f.Level = LevelError
+	}
+	if o.Confidence != nil {
+		score := o.Confidence.Score
+		f.Confidence = &score
+	}
+	if !o.CreatedAt.IsZero() {
+		createdAt := o.CreatedAt
+		f.CreatedAt = &createdAt
+	}
+	for _, d := range o.Deletions() {
+		f.Resources = append(f.Resources, &FindingResource{
+			Kind:   d.Kind,
+			Name:   d.Name,
+			Region: d.Region,
+			Zone:   d.Zone,
+		})
+	}
+	return f
+}
+
+// Findings returns the orphans of the report as findings
+func (r *Report) Findings() *Findings {
+	f := &Findings{
+		Schema:      FindingsSchemaURL,
+		Project:     r.Project,
+		GeneratedAt: r.FinishedAt,
+		Findings:    []*Finding{},
+	}
+	if f.GeneratedAt.IsZero() {
+		f.GeneratedAt = time.Now().UTC()
+	}
+	for _, o := range r.Orphans {
+		f.Findings = append(f.Findings, o.finding())
+	}
+	return f
+}
+
+// WriteReport writes the report in the given format: human readable
+// text, findings as JSON, or findings as a SARIF log
+func WriteReport(w io.Writer, r *Report, format string) error {
+	if format == ReportFormatText {
+		_, err := io.WriteString(w, r.String())
+		return err
+	}
+	return WriteFindings(w, r.Findings(), format)
+}
+
+// WriteFindings writes the findings as JSON, or as a SARIF log
+func WriteFindings(w io.Writer, f *Findings, format string) error {
+	var doc interface{}
+	switch format {
+	case ReportFormatJSON:
+		doc = f
+	case ReportFormatSARIF:
+		doc = newSARIFLog(f)
+	default:
+		return errors.Errorf(`unsupported report format %s`, format)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent(``, `  `)
+	if err := enc.Encode(doc); err != nil {
+		return errors.Wrap(err, `failed to encode report`)
+	}
+	return nil
+}
+
+// The subset of SARIF 2.1.0 that findings are rendered in. Load
+// balancers are not files, so results point at logical locations
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations"`
+	Properties *Finding        `json:"properties"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+	Kind               string `json:"kind"`
+}
+
+func newSARIFLog(findings *Findings) *sarifLog {
+	driver := sarifDriver{
+		Name:           `autolbclean`,
+		InformationURI: `https://github.com/lestrrat/gcp-auto-lb-clean`,
+	}
+	for _, rule := range findingRules {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.id,
+			ShortDescription:     sarifMessage{Text: rule.description},
+			DefaultConfiguration: sarifConfiguration{Level: rule.level},
+		})
+	}
+
+	run := sarifRun{
+		Tool:    sarifTool{Driver: driver},
+		Results: []sarifResult{},
+	}
+	for _, f := range findings.Findings {
+		msg := fmt.Sprintf(`Orphaned load balancer %s`, f.TargetProxy)
+		if len(findings.Project) > 0 {
+			msg += fmt.Sprintf(` in project %s`, findings.Project)
+		}
+		if f.InternetFacing {
+			msg += fmt.Sprintf(` is still internet facing through forwarding rule %s`, f.ForwardingRule)
+			if len(f.IPAddress) > 0 {
+				msg += fmt.Sprintf(` (%s)`, f.IPAddress)
+			}
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:  f.RuleID,
+			Level:   f.Level,
+			Message: sarifMessage{Text: msg},
+			Locations: []sarifLocation{{
+				LogicalLocations: []sarifLogicalLocation{{
+					Name:               f.TargetProxy,
+					FullyQualifiedName: f.SelfLink,
+					Kind:               `resource`,
+				}},
+			}},
+			Properties: f,
+		})
+	}
+
+	return &sarifLog{
+		Schema:  `https://json.schemastore.org/sarif-2.1.0.json`,
+		Version: `2.1.0`,
+		Runs:    []sarifRun{run},
+	}
+}
@@ -0,0 +1,208 @@
+package autolbclean_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestReportFindings(t *testing.T) {
+	report := &autolbclean.Report{
+		Project: `my-project`,
+		Orphans: []*autolbclean.Orphan{
+			{TargetProxy: `k8s-tp-a`, ForwardingRule: `k8s-fw-a`, IPAddress: `203.0.113.1`, Scheme: `EXTERNAL`},
+			{TargetProxy: `k8s-tp-b`, ForwardingRule: `k8s-fw-b`, Region: `us-central1`, Scheme: `INTERNAL_MANAGED`},
+			{TargetProxy: `k8s-tp-c`},
+		},
+	}
+
+	findings := report.Findings().Findings
+	if !assert.Len(t, findings, 3, `there should be a finding for each orphan`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.RuleOrphanedInternetFacingLoadBalancer, findings[0].RuleID, `external load balancers should be internet facing`) {
+		return
+	}
+	for _, f := range findings[1:] {
+		if !assert.Equal(t, autolbclean.RuleOrphanedLoadBalancer, f.RuleID, `%s should not be internet facing`, f.TargetProxy) {
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, autolbclean.WriteReport(&buf, report, autolbclean.ReportFormatSARIF), `WriteReport should succeed`) {
+		return
+	}
+	var sarif struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Results []struct {
+				RuleID string `json:"ruleId"`
+				Level  string `json:"level"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if !assert.NoError(t, json.Unmarshal(buf.Bytes(), &sarif), `SARIF log should be valid JSON`) {
+		return
+	}
+	if !assert.Equal(t, `2.1.0`, sarif.Version) {
+		return
+	}
+	if !assert.Len(t, sarif.Runs[0].Results, 3, `there should be a result for each finding`) {
+		return
+	}
+	if !assert.Equal(t, `error`, sarif.Runs[0].Results[0].Level, `internet facing orphans should be errors`) {
+		return
+	}
+}
+
+// the findings must not drift from the schema shipped in the repository
+func TestFindingsSchema(t *testing.T) {
+	buf, err := ioutil.ReadFile(`schema/findings.schema.json`)
+	if !assert.NoError(t, err, `schema should be readable`) {
+		return
+	}
+	var schema map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(buf, &schema), `schema should be valid JSON`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.FindingsSchemaURL, schema[`$id`], `schema URL should match`) {
+		return
+	}
+
+	report := &autolbclean.Report{
+		Project:    `my-project`,
+		FinishedAt: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+		Orphans: []*autolbclean.Orphan{
+			{
+				TargetProxy:     `k8s-tp-a`,
+				SelfLink:        `https://www.googleapis.com/compute/v1/projects/my-project/global/targetHttpProxies/k8s-tp-a`,
+				ForwardingRule:  `k8s-fw-a`,
+				IPAddress:       `203.0.113.1`,
+				Scheme:          `EXTERNAL`,
+				Cluster:         `0123456789abcdef`,
+				CreatedAt:       time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+				Confidence:      &autolbclean.Confidence{Score: 70, Signals: []string{autolbclean.SignalOwnership}},
+				UrlMap:          `k8s-um-a`,
+				BackendServices: []*compute.BackendService{{Name: `k8s-be-30000--a`}},
+				HealthChecks: []*autolbclean.HealthCheckRef{
+					{Kind: autolbclean.KindHealthChecks, Name: `k8s-be-30000--a`, Region: `global`},
+				},
+			},
+			{TargetProxy: `k8s-tp-b`, ForwardingRule: `k8s-fw-b`, Region: `us-central1`, Scheme: `INTERNAL_MANAGED`},
+			{TargetProxy: `k8s-tp-c`},
+		},
+	}
+
+	var out bytes.Buffer
+	if !assert.NoError(t, autolbclean.WriteReport(&out, report, autolbclean.ReportFormatJSON), `WriteReport should succeed`) {
+		return
+	}
+	var doc interface{}
+	if !assert.NoError(t, json.Unmarshal(out.Bytes(), &doc), `report should be valid JSON`) {
+		return
+	}
+	for _, err := range validateSchema(schema, schema, doc, `#`) {
+		t.Errorf(`report does not validate against the schema: %s`, err)
+	}
+}
+
+// validateSchema checks the document against the keywords of JSON Schema
+// that schema/findings.schema.json uses
+func validateSchema(root, schema map[string]interface{}, doc interface{}, path string) []string {
+	if ref, ok := schema[`$ref`].(string); ok {
+		def, _ := root[`$defs`].(map[string]interface{})[strings.TrimPrefix(ref, `#/$defs/`)].(map[string]interface{})
+		if def == nil {
+			return []string{fmt.Sprintf(`%s: unknown reference %s`, path, ref)}
+		}
+		return validateSchema(root, def, doc, path)
+	}
+
+	var errs []string
+	if enum, ok := schema[`enum`].([]interface{}); ok {
+		var found bool
+		for _, v := range enum {
+			if v == doc {
+				found = true
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf(`%s: %v is not one of %v`, path, doc, enum))
+		}
+	}
+
+	switch schema[`type`] {
+	case `object`:
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return append(errs, fmt.Sprintf(`%s: expected an object`, path))
+		}
+		properties, _ := schema[`properties`].(map[string]interface{})
+		if required, ok := schema[`required`].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := obj[name.(string)]; !ok {
+					errs = append(errs, fmt.Sprintf(`%s: %s is required`, path, name))
+				}
+			}
+		}
+		for name, v := range obj {
+			property, ok := properties[name].(map[string]interface{})
+			if !ok {
+				if schema[`additionalProperties`] == false {
+					errs = append(errs, fmt.Sprintf(`%s: %s is not allowed`, path, name))
+				}
+				continue
+			}
+			errs = append(errs, validateSchema(root, property, v, path+`/`+name)...)
+		}
+	case `array`:
+		list, ok := doc.([]interface{})
+		if !ok {
+			return append(errs, fmt.Sprintf(`%s: expected an array`, path))
+		}
+		items, _ := schema[`items`].(map[string]interface{})
+		for i, v := range list {
+			errs = append(errs, validateSchema(root, items, v, fmt.Sprintf(`%s/%d`, path, i))...)
+		}
+	case `string`:
+		s, ok := doc.(string)
+		if !ok {
+			return append(errs, fmt.Sprintf(`%s: expected a string`, path))
+		}
+		switch schema[`format`] {
+		case `date-time`:
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				errs = append(errs, fmt.Sprintf(`%s: %q is not a date-time`, path, s))
+			}
+		case `uri`:
+			if u, err := url.Parse(s); err != nil || !u.IsAbs() {
+				errs = append(errs, fmt.Sprintf(`%s: %q is not a uri`, path, s))
+			}
+		}
+	case `boolean`:
+		if _, ok := doc.(bool); !ok {
+			errs = append(errs, fmt.Sprintf(`%s: expected a boolean`, path))
+		}
+	case `integer`:
+		n, ok := doc.(float64)
+		if !ok || n != float64(int64(n)) {
+			return append(errs, fmt.Sprintf(`%s: expected an integer`, path))
+		}
+		if min, ok := schema[`minimum`].(float64); ok && n < min {
+			errs = append(errs, fmt.Sprintf(`%s: %v is below %v`, path, n, min))
+		}
+		if max, ok := schema[`maximum`].(float64); ok && n > max {
+			errs = append(errs, fmt.Sprintf(`%s: %v is above %v`, path, n, max))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,126 @@
+package autolbclean
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// Firewall rules that we disable before deleting them are marked by
+// appending this to their description, along with the time they were
+// disabled at. This way the grace period survives across runs without
+// having to store anything
+var softDeleteMarker = regexp.MustCompile(`\[autolbclean: disabled at ([^\]]+)\]`)
+
+// FirewallDisabledAt returns the time the firewall rule was disabled
+// by us, if it was
+func FirewallDisabledAt(fw *compute.Firewall) (time.Time, bool) {
+	m := softDeleteMarker.FindStringSubmatch(fw.Description)
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(timeFormat, m[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// pendingDeletion returns the pending deletion record of the resource.
+// Without an AuditStore, or if the store has no record, it falls back
+// to the marker in the description of the firewall rule
+func (app *App) pendingDeletion(ctx context.Context, fw *compute.Firewall, grace time.Duration) (*PendingDeletion, error) {
+	if app.auditStore != nil {
+		pd, err := app.auditStore.LoadPendingDeletion(ctx, KindFirewalls, fw.Name)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to load pending deletion`)
+		}
+		if pd != nil {
+			return pd, nil
+		}
+	}
+
+	disabledAt, ok := FirewallDisabledAt(fw)
+	if !ok {
+		return nil, nil
+	}
+	return &PendingDeletion{
+		Kind:        KindFirewalls,
+		Name:        fw.Name,
+		DisabledAt:  disabledAt,
+		DeleteAfter: disabledAt.Add(grace),
+	}, nil
+}
+
+// SoftDeleteFirewall gets rid of a dangling firewall rule in two steps:
+// the first time it is called the rule is only disabled, which can be
+// rolled back immediately by enabling it again. Once the rule has been
+// disabled for longer than grace, it is deleted. It returns true if the
+// rule was deleted.
+//
+// The deadline is decided when the rule is disabled, and recorded in the
+// AuditStore, so changing grace afterwards does not affect rules that
+// are already pending deletion.
+//
+// A rule that was enabled again after we disabled it is left alone, as
+// someone has decided that it is needed after all
+func (app *App) SoftDeleteFirewall(ctx context.Context, fw *compute.Firewall, grace time.Duration) (bool, error) {
+	pd, err := app.pendingDeletion(ctx, fw, grace)
+	if err != nil {
+		return false, err
+	}
+
+	if pd != nil && !fw.Disabled {
+		return false, nil
+	}
+
+	if pd == nil {
+		now := time.Now().UTC()
+		description := strings.TrimSpace(fw.Description + ` [autolbclean: disabled at ` + now.Format(timeFormat) + `]`)
+
+		getCtx, cancel := app.getContext(ctx)
+		defer cancel()
+
+		_, err := app.executor.Firewalls.Patch(app.project, fw.Name, &compute.Firewall{
+			Description:     description,
+			Disabled:        true,
+			ForceSendFields: []string{`Disabled`},
+		}).Context(getCtx).Do()
+		if err != nil {
+			return false, errors.Wrapf(err, `failed to disable firewall rule %s`, fw.Name)
+		}
+
+		if app.auditStore != nil {
+			err := app.auditStore.SavePendingDeletion(ctx, &PendingDeletion{
+				Kind:        KindFirewalls,
+				Name:        fw.Name,
+				DisabledAt:  now,
+				DeleteAfter: now.Add(grace),
+			})
+			if err != nil {
+				return false, errors.Wrap(err, `failed to save pending deletion`)
+			}
+		}
+		return false, nil
+	}
+
+	if time.Now().Before(pd.DeleteAfter) {
+		return false, nil
+	}
+
+	if _, err := app.Delete(ctx, &Deletion{Kind: KindFirewalls, Name: fw.Name, Region: globalRegion}); err != nil {
+		return false, errors.Wrapf(err, `failed to delete firewall rule %s`, fw.Name)
+	}
+
+	if app.auditStore != nil {
+		if err := app.auditStore.DeletePendingDeletion(ctx, KindFirewalls, fw.Name); err != nil {
+			return true, errors.Wrap(err, `failed to delete pending deletion`)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,200 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestFirewallDisabledAt(t *testing.T) {
+	_, ok := autolbclean.FirewallDisabledAt(&compute.Firewall{Description: `{"kubernetes.io/service-name":"foo"}`})
+	if !assert.False(t, ok, `rules without the marker should not be reported as disabled`) {
+		return
+	}
+
+	disabledAt, ok := autolbclean.FirewallDisabledAt(&compute.Firewall{
+		Description: `{"kubernetes.io/service-name":"foo"} [autolbclean: disabled at 2018-01-02T03:04:05Z]`,
+	})
+	if !assert.True(t, ok, `rules with the marker should be reported as disabled`) {
+		return
+	}
+	if !assert.Equal(t, time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC), disabledAt, `time should match`) {
+		return
+	}
+}
+
+func TestZoneScanError(t *testing.T) {
+	var err error = &autolbclean.ZoneScanError{
+		Zones: map[string]error{
+			`us-central1-b`:     errors.New(`backend error`),
+			`asia-northeast1-a`: errors.New(`backend error`),
+		},
+		Unknown: []string{`gke-foo-1234-node`},
+	}
+	if !assert.True(t, autolbclean.IsZoneScanError(errors.Wrap(err, `failed`)), `wrapped errors should be detected`) {
+		return
+	}
+	if !assert.Equal(t, `failed to list instances in 2 zones (asia-northeast1-a, us-central1-b): 1 tags may still be in use`, err.Error(), `message should match`) {
+		return
+	}
+}
+
+func TestListDanglingFirewallsZoneFailure(t *testing.T) {
+	firewall := func(name, tag string) map[string]interface{} {
+		return map[string]interface{}{
+			`name`:              name,
+			`targetTags`:        []string{tag},
+			`creationTimestamp`: `2020-01-01T00:00:00Z`,
+		}
+	}
+	fake := fakeCompute{
+		`global/firewalls`: map[string]interface{}{
+			`items`: []interface{}{
+				firewall(`k8s-fw-l7--live`, `gke-live-abcdef01-node`),
+				firewall(`k8s-fw-l7--gone`, `gke-gone-12345678-node`),
+				firewall(`k8s-fw-l7--other`, `gke-other-fedcba98-node`),
+			},
+		},
+		`zones`: map[string]interface{}{
+			`items`: []interface{}{
+				map[string]interface{}{`name`: `us-central1-a`},
+				map[string]interface{}{`name`: `us-east1-b`},
+			},
+		},
+		// the instances of us-east1-b can not be listed
+		`zones/us-central1-a/instances`: map[string]interface{}{},
+		`locations/-/clusters`: map[string]interface{}{
+			`clusters`: []interface{}{
+				map[string]interface{}{`name`: `live`, `id`: `abcdef0123456789`, `location`: `us-east1`, `locations`: []string{`us-east1-b`}},
+				map[string]interface{}{`name`: `other`, `id`: `fedcba9876543210`, `location`: `us-central1-a`, `locations`: []string{`us-central1-a`}},
+			},
+		},
+	}
+
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake}, autolbclean.WithStore(autolbclean.NewMemoryStore()))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	fws, err := app.ListDanglingFirewalls(context.Background())
+	if !assert.True(t, autolbclean.IsZoneScanError(err), `the failed zone should be reported`) {
+		return
+	}
+	if !assert.Equal(t, []string{`gke-live-abcdef01-node`}, errors.Cause(err).(*autolbclean.ZoneScanError).Unknown, `only the tags of the clusters in the failed zone should be unknown`) {
+		return
+	}
+	var names []string
+	for _, fw := range fws {
+		names = append(names, fw.Name)
+	}
+	if !assert.Equal(t, []string{`k8s-fw-l7--gone`, `k8s-fw-l7--other`}, names, `the rules of the other tags should be dangling`) {
+		return
+	}
+}
+
+func TestListDanglingFirewallsClusterCrossCheck(t *testing.T) {
+	firewall := func(name, tag string) map[string]interface{} {
+		return map[string]interface{}{
+			`name`:              name,
+			`targetTags`:        []string{tag},
+			`creationTimestamp`: `2020-01-01T00:00:00Z`,
+		}
+	}
+	fake := fakeCompute{
+		`global/firewalls`: map[string]interface{}{
+			`items`: []interface{}{
+				firewall(`k8s-fw-web--abcdef0123456789`, `gke-other-12345678-node`),
+				firewall(`k8s-fw-live`, `gke-live-abcdef01-node`),
+				firewall(`k8s-fw-gone`, `gke-gone-12345678-node`),
+			},
+		},
+		`zones`: map[string]interface{}{
+			`items`: []interface{}{
+				map[string]interface{}{`name`: `us-central1-a`},
+			},
+		},
+		// the live cluster is scaled to zero
+		`zones/us-central1-a/instances`: map[string]interface{}{},
+		`locations/-/clusters`: map[string]interface{}{
+			`clusters`: []interface{}{
+				map[string]interface{}{`name`: `live`, `id`: `abcdef0123456789`, `location`: `us-central1-a`},
+			},
+		},
+	}
+
+	c := autolbclean.DefaultConfig()
+	c.ClusterCrossCheck = true
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake}, autolbclean.WithStore(autolbclean.NewMemoryStore()), autolbclean.WithConfig(c))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	fws, err := app.ListDanglingFirewalls(context.Background())
+	if !assert.NoError(t, err, `ListDanglingFirewalls should succeed`) {
+		return
+	}
+	var names []string
+	for _, fw := range fws {
+		names = append(names, fw.Name)
+	}
+	if !assert.Equal(t, []string{`k8s-fw-gone`}, names, `the rules of the live cluster should be kept`) {
+		return
+	}
+}
+
+func TestListDanglingFirewallsUpgradeAwareness(t *testing.T) {
+	fake := fakeCompute{
+		`global/firewalls`: map[string]interface{}{
+			`items`: []interface{}{
+				map[string]interface{}{`name`: `k8s-fw-upgrading`, `targetTags`: []string{`gke-upgrading-abcdef01-node`}, `creationTimestamp`: `2020-01-01T00:00:00Z`},
+				map[string]interface{}{`name`: `k8s-fw-gone`, `targetTags`: []string{`gke-gone-12345678-node`}, `creationTimestamp`: `2020-01-01T00:00:00Z`},
+			},
+		},
+		`zones`: map[string]interface{}{
+			`items`: []interface{}{
+				map[string]interface{}{`name`: `us-central1-a`},
+			},
+		},
+		// the nodes of the upgrading cluster are being recreated
+		`zones/us-central1-a/instances`: map[string]interface{}{},
+		`locations/-/operations`: map[string]interface{}{
+			`operations`: []interface{}{
+				map[string]interface{}{
+					`operationType`: `UPGRADE_NODES`,
+					`status`:        `RUNNING`,
+					`targetLink`:    `https://container.googleapis.com/v1/projects/p/locations/us-central1-a/clusters/upgrading`,
+				},
+			},
+		},
+		`locations/-/clusters`: map[string]interface{}{
+			`clusters`: []interface{}{
+				map[string]interface{}{`name`: `upgrading`, `id`: `abcdef0123456789`, `location`: `us-central1-a`, `locations`: []string{`us-central1-a`}},
+			},
+		},
+	}
+
+	c := autolbclean.DefaultConfig()
+	c.UpgradeAwareness = true
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake}, autolbclean.WithStore(autolbclean.NewMemoryStore()), autolbclean.WithConfig(c))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	fws, err := app.ListDanglingFirewalls(context.Background())
+	if !assert.NoError(t, err, `ListDanglingFirewalls should succeed`) {
+		return
+	}
+	var names []string
+	for _, fw := range fws {
+		names = append(names, fw.Name)
+	}
+	if !assert.Equal(t, []string{`k8s-fw-gone`}, names, `the rules of the upgrading cluster should be kept`) {
+		return
+	}
+}
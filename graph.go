@@ -0,0 +1,309 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Formats that the resource graph can be written in
+const (
+	GraphFormatDOT  = `dot`
+	GraphFormatJSON = `json`
+)
+
+// ParseGraphFormat validates the name of a resource graph format
+func ParseGraphFormat(s string) (string, error) {
+	switch s {
+	case GraphFormatDOT, GraphFormatJSON:
+		return s, nil
+	}
+	return ``, errors.Errorf(`invalid graph format %q (expected %s or %s)`, s, GraphFormatDOT, GraphFormatJSON)
+}
+
+// graphBuilder collects the nodes and the edges of a resource graph,
+// each of them once, however many load balancers share them
+type graphBuilder struct {
+	graph *ResourceGraph
+	nodes map[string]*GraphNode
+	edges map[[2]string]struct{}
+}
+
+func newGraphBuilder(project string, now time.Time) *graphBuilder {
+	return &graphBuilder{
+		graph: &ResourceGraph{
+			Project:     project,
+			GeneratedAt: now,
+			Nodes:       []*GraphNode{},
+			Edges:       []*GraphEdge{},
+		},
+		nodes: make(map[string]*GraphNode),
+		edges: make(map[[2]string]struct{}),
+	}
+}
+
+// node adds the resource that the self link points to, unless it has
+// been added already, and returns true if it has
+func (b *graphBuilder) node(selfLink string) bool {
+	if _, ok := b.nodes[selfLink]; ok {
+		return true
+	}
+
+	// .../(global|regions/$region|zones/$zone)/$kind/$name
+	n := &GraphNode{ID: selfLink}
+	parts := strings.Split(selfLink, `/`)
+	if len(parts) >= 2 {
+		n.Kind = parts[len(parts)-2]
+	}
+	n.Name = parts[len(parts)-1]
+	for i := 0; i+1 < len(parts); i++ {
+		switch parts[i] {
+		case `regions`:
+			n.Region = parts[i+1]
+		case `zones`:
+			n.Zone = parts[i+1]
+		}
+	}
+	if len(n.Region) == 0 && len(n.Zone) == 0 {
+		n.Region = globalRegion
+	}
+
+	b.nodes[selfLink] = n
+	b.graph.Nodes = append(b.graph.Nodes, n)
+	return false
+}
+
+// edge adds both resources, and the reference from one to the other.
+// It returns true if the referenced resource had been added already
+func (b *graphBuilder) edge(from, to string) bool {
+	b.node(from)
+	seen := b.node(to)
+	if _, ok := b.edges[[2]string{from, to}]; !ok {
+		b.edges[[2]string{from, to}] = struct{}{}
+		b.graph.Edges = append(b.graph.Edges, &GraphEdge{From: from, To: to})
+	}
+	return seen
+}
+
+// fail records why the resource could not be looked up, which leaves
+// the resources that it references out of the graph
+func (b *graphBuilder) fail(selfLink string, err error) {
+	b.node(selfLink)
+	b.nodes[selfLink].Error = Redact(err.Error())
+}
+
+// ResourceGraph walks the load balancers that a run would check, from
+// their forwarding rules down to their instance groups, network
+// endpoint groups, backend buckets, health checks and certificates, and returns the
+// resources and the references between them. Load balancers for which
+// allowed returns false are left out. A resource that can not be looked
+// up is kept in the graph, along with the error, without the resources
+// that it references
+func (app *App) ResourceGraph(ctx context.Context, allowed func(*Orphan) bool) (*ResourceGraph, error) {
+	c := app.Config()
+	b := newGraphBuilder(app.project, time.Now().UTC())
+
+	fwrs, err := app.ListIngressForwardingRules(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list ingress forwarding rules`)
+	}
+
+	seen := make(map[string]struct{})
+	for _, fwr := range fwrs {
+		tpname, _, _, err := ParseTargetProxy(fwr.Target)
+		if err != nil {
+			continue
+		}
+		owner := &Orphan{
+			Cluster:     c.ClusterOf(tpname),
+			Labels:      fwr.Labels,
+			Namespace:   KubernetesNamespace(fwr.Description),
+			TargetProxy: tpname,
+		}
+		seen[fwr.Target] = struct{}{}
+		if !allowed(owner) {
+			continue
+		}
+		if b.edge(fwr.SelfLink, fwr.Target) {
+			continue
+		}
+		app.graphTargetProxy(ctx, b, fwr.Target)
+	}
+
+	// target proxies that no forwarding rule points to, as discovery
+	// checks them too
+	var proxies []string
+	if l, err := app.listAllTargetHttpProxies(ctx); err == nil {
+		for _, tp := range l {
+			if hasAnyPrefix(tp.Name, c.targetProxyPrefixes()) || c.IsManaged(nil, tp.Description) {
+				proxies = append(proxies, tp.SelfLink)
+			}
+		}
+	}
+	if l, err := app.listAllTargetHttpsProxies(ctx); err == nil {
+		for _, tp := range l {
+			if hasAnyPrefix(tp.Name, c.targetProxyPrefixes()) || c.IsManaged(nil, tp.Description) {
+				proxies = append(proxies, tp.SelfLink)
+			}
+		}
+	}
+	for _, selfLink := range proxies {
+		if _, ok := seen[selfLink]; ok {
+			continue
+		}
+		tpname, _, _, err := ParseTargetProxy(selfLink)
+		if err != nil || !allowed(&Orphan{Cluster: c.ClusterOf(tpname), TargetProxy: tpname}) {
+			continue
+		}
+		if !b.node(selfLink) {
+			app.graphTargetProxy(ctx, b, selfLink)
+		}
+	}
+	return b.graph, nil
+}
+
+// graphTargetProxy adds what the target proxy references to the graph
+func (app *App) graphTargetProxy(ctx context.Context, b *graphBuilder, selfLink string) {
+	tpname, region, isHTTPs, err := ParseTargetProxy(selfLink)
+	if err != nil {
+		b.fail(selfLink, err)
+		return
+	}
+
+	var urlMap string
+	if isHTTPs {
+		tp, err := app.getTargetHttpsProxy(ctx, region, tpname)
+		if err != nil {
+			b.fail(selfLink, err)
+			return
+		}
+		urlMap = tp.UrlMap
+		for _, cert := range tp.SslCertificates {
+			b.edge(selfLink, cert)
+		}
+	} else {
+		tp, err := app.getTargetHttpProxy(ctx, region, tpname)
+		if err != nil {
+			b.fail(selfLink, err)
+			return
+		}
+		urlMap = tp.UrlMap
+	}
+	if len(urlMap) == 0 || b.edge(selfLink, urlMap) {
+		return
+	}
+
+	umname, umregion, err := ParseUrlMap(urlMap)
+	if err != nil {
+		b.fail(urlMap, err)
+		return
+	}
+	um, err := app.getUrlMap(ctx, umregion, umname)
+	if err != nil {
+		b.fail(urlMap, err)
+		return
+	}
+	for _, u := range BackendServiceURLs(um) {
+		if !b.edge(urlMap, u) {
+			app.graphBackendService(ctx, b, u)
+		}
+	}
+	for _, u := range BackendBucketURLs(um) {
+		b.edge(urlMap, u)
+	}
+}
+
+// graphBackendService adds the backends and the health checks of the
+// backend service to the graph
+func (app *App) graphBackendService(ctx context.Context, b *graphBuilder, selfLink string) {
+	sname, region, err := ParseService(selfLink)
+	if err != nil {
+		b.fail(selfLink, err)
+		return
+	}
+	s, err := app.getBackendService(ctx, region, sname)
+	if err != nil {
+		b.fail(selfLink, err)
+		return
+	}
+	for _, backend := range s.Backends {
+		b.edge(selfLink, backend.Group)
+	}
+	for _, hc := range s.HealthChecks {
+		b.edge(selfLink, hc)
+	}
+}
+
+// WriteGraph writes the resource graph as JSON, or as a Graphviz DOT
+// digraph whose nodes are grouped by the load balancer layer they are in
+func WriteGraph(w io.Writer, g *ResourceGraph, format string) error {
+	switch format {
+	case GraphFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent(``, `  `)
+		if err := enc.Encode(g); err != nil {
+			return errors.Wrap(err, `failed to encode graph`)
+		}
+		return nil
+	case GraphFormatDOT:
+		_, err := io.WriteString(w, g.dot())
+		return err
+	}
+	return errors.Errorf(`unsupported graph format %s`, format)
+}
+
+// graphRanks puts the kinds of resources that are in the same layer of
+// a load balancer side by side
+var graphRanks = [][]string{
+	{KindForwardingRules},
+	{KindTargetHttpProxies, KindTargetHttpsProxies},
+	{KindUrlMaps, KindSslCertificates},
+	{KindBackendServices, KindBackendBuckets},
+	{KindInstanceGroups, KindNetworkEndpointGroups, KindHealthChecks, KindHttpHealthChecks, KindHttpsHealthChecks},
+}
+
+func (g *ResourceGraph) dot() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "digraph %q {\n", g.Project)
+	buf.WriteString("  rankdir=LR;\n  node [shape=box];\n")
+
+	byKind := make(map[string][]*GraphNode)
+	for _, n := range g.Nodes {
+		byKind[n.Kind] = append(byKind[n.Kind], n)
+	}
+	for _, n := range g.Nodes {
+		label := n.Kind + `\n` + n.Name
+		if n.Region != globalRegion {
+			label += `\n` + n.Region + n.Zone
+		}
+		attrs := fmt.Sprintf(`label="%s"`, strings.Replace(label, `"`, `\"`, -1))
+		if len(n.Error) > 0 {
+			attrs += fmt.Sprintf(`, color=red, tooltip=%q`, n.Error)
+		}
+		fmt.Fprintf(&buf, "  %q [%s];\n", n.ID, attrs)
+	}
+	for _, kinds := range graphRanks {
+		var ids []string
+		for _, kind := range kinds {
+			for _, n := range byKind[kind] {
+				ids = append(ids, fmt.Sprintf(`%q;`, n.ID))
+			}
+		}
+		if len(ids) > 1 {
+			sort.Strings(ids)
+			fmt.Fprintf(&buf, "  { rank=same; %s }\n", strings.Join(ids, ` `))
+		}
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&buf, "  %q -> %q;\n", e.From, e.To)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
@@ -0,0 +1,115 @@
+package autolbclean_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceGraph(t *testing.T) {
+	const prefix = `https://www.googleapis.com/compute/v1/projects/p/`
+	fake := fakeCompute{
+		`aggregated/forwardingRules`: map[string]interface{}{
+			`items`: map[string]interface{}{
+				`global`: map[string]interface{}{
+					`forwardingRules`: []interface{}{
+						map[string]interface{}{
+							`name`:     `k8s-fw-a`,
+							`selfLink`: prefix + `global/forwardingRules/k8s-fw-a`,
+							`target`:   prefix + `global/targetHttpsProxies/k8s-tps-a`,
+						},
+						map[string]interface{}{
+							`name`:     `k8s-fw-b`,
+							`selfLink`: prefix + `global/forwardingRules/k8s-fw-b`,
+							`target`:   prefix + `global/targetHttpProxies/k8s-tp-b`,
+						},
+					},
+				},
+			},
+		},
+		`global/targetHttpsProxies/k8s-tps-a`: map[string]interface{}{
+			`name`:            `k8s-tps-a`,
+			`selfLink`:        prefix + `global/targetHttpsProxies/k8s-tps-a`,
+			`urlMap`:          prefix + `global/urlMaps/k8s-um-a`,
+			`sslCertificates`: []string{prefix + `global/sslCertificates/k8s-ssl-a`},
+		},
+		`global/urlMaps/k8s-um-a`: map[string]interface{}{
+			`name`:           `k8s-um-a`,
+			`selfLink`:       prefix + `global/urlMaps/k8s-um-a`,
+			`defaultService`: prefix + `global/backendServices/k8s-be-a`,
+			`pathMatchers`: []interface{}{
+				map[string]interface{}{
+					`name`:           `static`,
+					`defaultService`: prefix + `global/backendBuckets/static-a`,
+				},
+			},
+		},
+		`global/backendServices/k8s-be-a`: map[string]interface{}{
+			`name`:     `k8s-be-a`,
+			`selfLink`: prefix + `global/backendServices/k8s-be-a`,
+			`backends`: []interface{}{
+				map[string]interface{}{`group`: prefix + `zones/asia-northeast1-a/networkEndpointGroups/k8s1-neg-a`},
+			},
+			`healthChecks`: []string{prefix + `global/healthChecks/k8s-hc-a`},
+		},
+	}
+
+	ctx := context.Background()
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake})
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	g, err := app.ResourceGraph(ctx, func(*autolbclean.Orphan) bool { return true })
+	if !assert.NoError(t, err, `ResourceGraph should succeed`) {
+		return
+	}
+	// two chains, one of which stops at the proxy that is missing
+	if !assert.Len(t, g.Nodes, 10, `nodes`) || !assert.Len(t, g.Edges, 8, `edges`) {
+		return
+	}
+
+	nodes := make(map[string]*autolbclean.GraphNode)
+	for _, n := range g.Nodes {
+		nodes[n.Kind+`/`+n.Name] = n
+	}
+	neg := nodes[autolbclean.KindNetworkEndpointGroups+`/k8s1-neg-a`]
+	if !assert.NotNil(t, neg, `network endpoint group should be in the graph`) || !assert.Equal(t, `asia-northeast1-a`, neg.Zone) {
+		return
+	}
+	if !assert.NotNil(t, nodes[autolbclean.KindBackendBuckets+`/static-a`], `backend bucket should be in the graph`) {
+		return
+	}
+	missing := nodes[autolbclean.KindTargetHttpProxies+`/k8s-tp-b`]
+	if !assert.NotNil(t, missing, `missing target proxy should be in the graph`) || !assert.NotEmpty(t, missing.Error, `missing target proxy should carry the error`) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, autolbclean.WriteGraph(&buf, g, autolbclean.GraphFormatDOT), `WriteGraph should succeed`) {
+		return
+	}
+	if !assert.Contains(t, buf.String(), `"`+prefix+`global/urlMaps/k8s-um-a" -> "`+prefix+`global/backendServices/k8s-be-a";`) {
+		return
+	}
+
+	g, err = app.ResourceGraph(ctx, func(*autolbclean.Orphan) bool { return false })
+	if !assert.NoError(t, err, `ResourceGraph should succeed`) || !assert.Empty(t, g.Nodes, `load balancers out of scope should be left out`) {
+		return
+	}
+}
+
+func TestParseGraphFormat(t *testing.T) {
+	for _, s := range []string{autolbclean.GraphFormatDOT, autolbclean.GraphFormatJSON} {
+		if _, err := autolbclean.ParseGraphFormat(s); !assert.NoError(t, err, `%s should be valid`, s) {
+			return
+		}
+	}
+	if _, err := autolbclean.ParseGraphFormat(`svg`); !assert.Error(t, err, `svg should be invalid`) {
+		return
+	}
+}
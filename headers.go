@@ -0,0 +1,46 @@
+package autolbclean
+
+import "net/http"
+
+// QuotaProjectScanned can be passed to WithQuotaProject to bill the
+// quota of the API calls to the project being cleaned up
+const QuotaProjectScanned = `scanned`
+
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+// newHeaderTransport creates a transport that adds the given headers
+// to every request
+func newHeaderTransport(base http.RoundTripper, headers http.Header) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &headerTransport{base: base, headers: headers}
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header[k] = v
+	}
+	return t.base.RoundTrip(req)
+}
+
+// apiHeaders returns the headers to be added to every API call
+func (app *App) apiHeaders() http.Header {
+	h := make(http.Header)
+	if len(app.quotaProject) > 0 {
+		project := app.quotaProject
+		if project == QuotaProjectScanned {
+			project = app.project
+		}
+		h.Set(`X-Goog-User-Project`, project)
+	}
+	if len(app.requestReason) > 0 {
+		h.Set(`X-Goog-Request-Reason`, app.requestReason)
+	}
+	return h
+}
@@ -0,0 +1,117 @@
+package autolbclean
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// Defaults for the health-based emptiness check
+const (
+	DefaultGetHealthTimeout     = 5 * time.Second
+	DefaultGetHealthConcurrency = 4
+)
+
+type backendHealth int
+
+const (
+	healthEmpty backendHealth = iota
+	healthInUse
+	healthUnknown
+)
+
+// backendsHealth asks each backend of the given services for the health
+// of its endpoints, with at most hc.Concurrency calls in flight. As soon
+// as one backend reports an endpoint, the remaining calls are cancelled.
+// A call that times out or fails makes the result unknown, unless another
+// backend is known to be in use.
+//
+// The configuration is validated by ParseConfig, but one that was built
+// by hand may leave the timeout or the concurrency unset, in which case
+// the defaults are used
+func (app *App) backendsHealth(ctx context.Context, services []*compute.BackendService, hc HealthEmptinessConfig) backendHealth {
+	if hc.Timeout <= 0 {
+		hc.Timeout = DefaultGetHealthTimeout
+	}
+	if hc.Concurrency <= 0 {
+		hc.Concurrency = DefaultGetHealthConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	result := healthEmpty
+	sem := make(chan struct{}, hc.Concurrency)
+
+loop:
+	for _, service := range services {
+		_, region, err := ParseBackendServices(service.SelfLink)
+		if err != nil {
+			mu.Lock()
+			if result == healthEmpty {
+				result = healthUnknown
+			}
+			mu.Unlock()
+			continue
+		}
+
+		for _, backend := range service.Backends {
+			select {
+			case <-ctx.Done():
+				break loop
+			case sem <- struct{}{}:
+			}
+
+			wg.Add(1)
+			go func(service, region, group string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				n, err := app.getHealth(ctx, service, region, group, hc.Timeout)
+
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil && n > 0:
+					result = healthInUse
+					cancel()
+				case err != nil && result == healthEmpty && ctx.Err() == nil:
+					result = healthUnknown
+				}
+			}(service.Name, region, backend.Group)
+		}
+	}
+	wg.Wait()
+
+	// an interrupted check can't tell whether the backends are empty
+	mu.Lock()
+	defer mu.Unlock()
+	if result == healthEmpty && ctx.Err() != nil {
+		return healthUnknown
+	}
+	return result
+}
+
+// getHealth returns the number of endpoints that GetHealth reports for
+// the given backend group
+func (app *App) getHealth(ctx context.Context, service, region, group string, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ref := &compute.ResourceGroupReference{Group: group}
+	var res *compute.BackendServiceGroupHealth
+	var err error
+	if isGlobal(region) {
+		res, err = app.service.BackendServices.GetHealth(app.project, service, ref).Context(ctx).Do()
+	} else {
+		res, err = app.service.RegionBackendServices.GetHealth(app.project, region, service, ref).Context(ctx).Do()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(res.HealthStatus), nil
+}
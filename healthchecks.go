@@ -0,0 +1,139 @@
+package autolbclean
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+func (ref *HealthCheckRef) key() string {
+	return ref.Kind + `/` + ref.Region + `/` + ref.Name
+}
+
+// ListDanglingHealthChecks returns the health checks that were created
+// by GKE and are no longer referenced by any backend service or target
+// pool. These are left behind when a cleanup deletes the backend
+// services of a load balancer but fails to delete their health checks,
+// after which no orphan ever references them again.
+//
+// Health checks from the healthChecks collection are listed across all
+// regions at once. The legacy httpHealthChecks and httpsHealthChecks
+// collections, which GKE still uses for the target pools of network
+// load balancers, are global
+func (app *App) ListDanglingHealthChecks(ctx context.Context) ([]*HealthCheckRef, error) {
+	c := app.Config()
+
+	inUse := make(map[string]struct{})
+	use := func(links []string) {
+		for _, link := range links {
+			ref, err := ParseHealthCheckRef(link)
+			if err != nil {
+				continue
+			}
+			inUse[ref.key()] = struct{}{}
+		}
+	}
+
+	var services []*compute.BackendService
+	if err := app.checkInventory(ctx, KindBackendServices, func() (int, error) {
+		var err error
+		services, err = app.listBackendServices(ctx)
+		return len(services), errors.Wrap(err, `failed to list backend services`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		use(service.HealthChecks)
+	}
+
+	var pools []*compute.TargetPool
+	if err := app.checkInventory(ctx, KindTargetPools, func() (int, error) {
+		var err error
+		pools, err = app.listTargetPools(ctx)
+		return len(pools), errors.Wrap(err, `failed to list target pools`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, tp := range pools {
+		use(tp.HealthChecks)
+	}
+
+	var clusters []*container.Cluster
+	if c.ClusterCrossCheck {
+		var err error
+		if clusters, err = app.liveClusters(ctx); err != nil {
+			return nil, errors.Wrap(err, `failed to cross-check GKE clusters`)
+		}
+	}
+
+	owned := app.multiClusterOwned(ctx)
+	var result []*HealthCheckRef
+	check := func(name, selfLink, description, timestamp string) {
+		if !hasAnyPrefix(name, c.healthCheckPrefixes()) || c.IsExcluded(name) || c.IsProtected(nil, description) {
+			return
+		}
+
+		if c.ownedByLiveCluster(name, clusters) || owned(name) {
+			return
+		}
+
+		ref, err := ParseHealthCheckRef(selfLink)
+		if err != nil {
+			return
+		}
+
+		// give whoever created the health check a chance to attach
+		// it to a backend service or target pool
+		if c.isYoung(ref.Kind, timestamp) {
+			return
+		}
+		if _, ok := inUse[ref.key()]; ok {
+			return
+		}
+		if sweepPolicyKeeps(ctx, c, sweptResource(ref.Kind, ref.Name, ref.Region, ``, timestamp), nil) {
+			return
+		}
+		result = append(result, ref)
+	}
+
+	var healthChecks []*compute.HealthCheck
+	if err := app.checkInventory(ctx, KindHealthChecks, func() (int, error) {
+		var err error
+		healthChecks, err = app.listHealthChecks(ctx)
+		return len(healthChecks), errors.Wrap(err, `failed to list health checks`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, hc := range healthChecks {
+		check(hc.Name, hc.SelfLink, hc.Description, hc.CreationTimestamp)
+	}
+
+	var httpHealthChecks []*compute.HttpHealthCheck
+	if err := app.checkInventory(ctx, KindHttpHealthChecks, func() (int, error) {
+		var err error
+		httpHealthChecks, err = app.listHttpHealthChecks(ctx)
+		return len(httpHealthChecks), errors.Wrap(err, `failed to list http health checks`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, hc := range httpHealthChecks {
+		check(hc.Name, hc.SelfLink, hc.Description, hc.CreationTimestamp)
+	}
+
+	var httpsHealthChecks []*compute.HttpsHealthCheck
+	if err := app.checkInventory(ctx, KindHttpsHealthChecks, func() (int, error) {
+		var err error
+		httpsHealthChecks, err = app.listHttpsHealthChecks(ctx)
+		return len(httpsHealthChecks), errors.Wrap(err, `failed to list https health checks`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, hc := range httpsHealthChecks {
+		check(hc.Name, hc.SelfLink, hc.Description, hc.CreationTimestamp)
+	}
+
+	sortHealthCheckRefs(result)
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListDanglingHealthChecks(t *testing.T) {
+	const prefix = `https://www.googleapis.com/compute/v1/projects/p/global/healthChecks/`
+	healthCheck := func(name, description string) map[string]interface{} {
+		return map[string]interface{}{
+			`name`:              name,
+			`selfLink`:          prefix + name,
+			`description`:       description,
+			`creationTimestamp`: `2020-01-01T00:00:00Z`,
+		}
+	}
+	fake := fakeCompute{
+		`aggregated/backendServices`: map[string]interface{}{},
+		`aggregated/targetPools`:     map[string]interface{}{},
+		`aggregated/healthChecks`: map[string]interface{}{
+			`items`: map[string]interface{}{
+				`global`: map[string]interface{}{
+					`healthChecks`: []interface{}{
+						healthCheck(`k8s-be-30000--0123456789abcdef`, ``),
+						healthCheck(`k8s-be-30001--0123456789abcdef`, `built by hand, autolbclean=ignore`),
+					},
+				},
+			},
+		},
+		`global/httpHealthChecks`:  map[string]interface{}{},
+		`global/httpsHealthChecks`: map[string]interface{}{},
+	}
+
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake}, autolbclean.WithStore(autolbclean.NewMemoryStore()))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	refs, err := app.ListDanglingHealthChecks(context.Background())
+	if !assert.NoError(t, err, `ListDanglingHealthChecks should succeed`) {
+		return
+	}
+	var names []string
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+	if !assert.Equal(t, []string{`k8s-be-30000--0123456789abcdef`}, names, `protected health checks should be kept`) {
+		return
+	}
+}
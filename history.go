@@ -0,0 +1,122 @@
+package autolbclean
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// trackOrphans records the orphan candidates of the project found in
+// this run, and forgets about the ones that we did not see again (which
+// means they have either been deleted, or came back to life). The
+// returned stats are what the alert rules are evaluated against
+func trackOrphans(ctx context.Context, store Store, project string, orphans []*Orphan) (*RunStats, error) {
+	records, err := store.ListCandidates(ctx, project)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to load orphan candidates`)
+	}
+
+	known := make(map[string]*Candidate)
+	for _, c := range records {
+		known[c.SelfLink] = c
+	}
+
+	now := time.Now().UTC()
+	stats := &RunStats{Orphans: len(orphans)}
+
+	var candidates []*Candidate
+	for _, o := range orphans {
+		c, ok := known[o.SelfLink]
+		if !ok {
+			stats.NewOrphans++
+			c = &Candidate{
+				SelfLink:  o.SelfLink,
+				FirstSeen: now,
+			}
+		}
+		c.ForwardingRule = o.ForwardingRule
+		c.Region = o.Region
+		c.LastSeen = now
+
+		if days := now.Sub(c.FirstSeen).Hours() / 24; days > stats.MaxPendingDays {
+			stats.MaxPendingDays = days
+		}
+		candidates = append(candidates, c)
+	}
+
+	if err := store.SaveCandidates(ctx, project, candidates); err != nil {
+		return nil, errors.Wrap(err, `failed to save orphan candidates`)
+	}
+	return stats, nil
+}
+
+// RecordRun persists the outcome of a check run that found the given
+// orphans: the run status, and the orphan candidates. It returns the
+// stats of the run, or nil if there is no store
+func (app *App) RecordRun(ctx context.Context, orphans []*Orphan) (*RunStats, error) {
+	if app.store == nil {
+		return nil, nil
+	}
+
+	stats, err := trackOrphans(ctx, app.store, app.project, orphans)
+	if err != nil {
+		return nil, err
+	}
+	if h, ok := app.store.(HandoffStore); ok {
+		if err := forgetHandoffs(ctx, h, app.project, orphans); err != nil {
+			return nil, err
+		}
+	}
+
+	err = app.store.SaveRunStatus(ctx, &RunStatus{
+		Project:    app.project,
+		FinishedAt: time.Now().UTC(),
+		Orphans:    len(orphans),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ApplyAdminState applies the changes made through the admin API, as
+// persisted in the store, on top of the configuration. It is a no-op
+// when there is no store.
+//
+// When the configuration changed materially, or the app was unpaused
+// since the state was last applied, a new epoch is started, voiding the
+// delete jobs that were scheduled under the previous rules
+func (app *App) ApplyAdminState(ctx context.Context) error {
+	if app.store == nil {
+		return nil
+	}
+
+	st, err := app.store.LoadAdminState(ctx)
+	if err != nil {
+		return errors.Wrap(err, `failed to load admin state`)
+	}
+
+	c := applyAdminState(app.Config(), st)
+	fingerprint := c.Fingerprint()
+	epoch := st.Epoch
+	if st.Fingerprint != fingerprint || st.WasPaused != c.Paused {
+		err := app.store.UpdateAdminState(ctx, func(st *AdminState) {
+			// the very first fingerprint has nothing to compare with
+			changed := len(st.Fingerprint) > 0 && st.Fingerprint != fingerprint
+			if changed || (st.WasPaused && !c.Paused) {
+				st.Epoch++
+			}
+			st.Fingerprint = fingerprint
+			st.WasPaused = c.Paused
+			epoch = st.Epoch
+		})
+		if err != nil {
+			return errors.Wrap(err, `failed to update admin state`)
+		}
+	}
+
+	app.SetConfig(c)
+	app.epoch = epoch
+	return nil
+}
@@ -0,0 +1,98 @@
+package autolbclean
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// historyPublisher records deletion events in a HistoryStore
+type historyPublisher struct {
+	store HistoryStore
+}
+
+func (p historyPublisher) Publish(ctx context.Context, ev *DeletionEvent) error {
+	return p.store.SaveEvent(ctx, ev)
+}
+
+// SaveRun adds the run to the history. It is a no-op when the store
+// can not keep the history
+func (app *App) SaveRun(ctx context.Context, r *RunRecord) error {
+	h, ok := app.store.(HistoryStore)
+	if !ok {
+		return nil
+	}
+	r.RunID = app.runID
+	r.Project = app.project
+	return h.SaveRun(ctx, r)
+}
+
+func sortEvents(list []*DeletionEvent) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].At.Before(list[j].At)
+	})
+}
+
+func (s *memoryStore) SaveRun(_ context.Context, r *RunRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs = append(s.runs, *r)
+	return nil
+}
+
+func (s *memoryStore) ListRuns(_ context.Context, project string, since time.Time) ([]*RunRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*RunRecord
+	for _, r := range s.runs {
+		if r.Project != project || !r.StartedAt.After(since) {
+			continue
+		}
+		r := r
+		list = append(list, &r)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].StartedAt.Before(list[j].StartedAt)
+	})
+	return list, nil
+}
+
+func (s *memoryStore) SaveEvent(_ context.Context, ev *DeletionEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, *ev)
+	return nil
+}
+
+func (s *memoryStore) ListEvents(_ context.Context, runID string) ([]*DeletionEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*DeletionEvent
+	for _, ev := range s.events {
+		if ev.RunID != runID {
+			continue
+		}
+		ev := ev
+		list = append(list, &ev)
+	}
+	sortEvents(list)
+	return list, nil
+}
+
+func (s *memoryStore) ListEventsBetween(_ context.Context, since, until time.Time, limit int) ([]*DeletionEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*DeletionEvent
+	for _, ev := range s.events {
+		if ev.At.Before(since) || !ev.At.Before(until) {
+			continue
+		}
+		ev := ev
+		list = append(list, &ev)
+	}
+	sortEvents(list)
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
@@ -0,0 +1,67 @@
+package autolbclean
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+)
+
+// ParseImpersonation parses a comma separated list of PROJECT=EMAIL
+// pairs, naming the service account to impersonate for each project
+func ParseImpersonation(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, `,`) {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+		i := strings.IndexByte(pair, '=')
+		if i <= 0 {
+			return nil, errors.Errorf(`invalid impersonation %q (expected PROJECT=SERVICE_ACCOUNT)`, pair)
+		}
+		project, email := pair[:i], pair[i+1:]
+		if err := ValidateServiceAccount(email); err != nil {
+			return nil, err
+		}
+		if _, ok := m[project]; ok {
+			return nil, errors.Errorf(`duplicate impersonation for project %s`, project)
+		}
+		m[project] = email
+	}
+	return m, nil
+}
+
+// ValidateServiceAccount checks that email looks like the email address
+// of a service account
+func ValidateServiceAccount(email string) error {
+	if i := strings.IndexByte(email, '@'); i <= 0 || !strings.HasSuffix(email, `.gserviceaccount.com`) {
+		return errors.Errorf(`invalid service account %q`, email)
+	}
+	return nil
+}
+
+// impersonatedTransport returns a transport that authenticates as the
+// given service account, sending the requests through base. The token is
+// obtained through the IAM credentials API using client, whose
+// credentials need to be granted roles/iam.serviceAccountTokenCreator on
+// the service account. The token source belongs to the App, as the
+// transports of client and base may be bound to the request it serves
+func impersonatedTransport(client *http.Client, base http.RoundTripper, serviceAccount string) (http.RoundTripper, error) {
+	ts, err := impersonate.CredentialsTokenSource(context.Background(), impersonate.CredentialsConfig{
+		TargetPrincipal: serviceAccount,
+		Scopes:          []string{compute.CloudPlatformScope},
+	}, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to impersonate %s`, serviceAccount)
+	}
+
+	// the base must not be the transport of client, which would replace
+	// the token with its own
+	return &oauth2.Transport{Source: ts, Base: base}, nil
+}
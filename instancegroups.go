@@ -0,0 +1,105 @@
+package autolbclean
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+// instanceGroupPrefixes are the prefixes of the unmanaged instance
+// groups that GKE ingress creates in every zone of a cluster
+var instanceGroupPrefixes = []string{`k8s-ig--`}
+
+// instanceGroupKey identifies an instance group by its zone and name,
+// so that references made through different API endpoints match
+func instanceGroupKey(link string) (string, bool) {
+	name, zone, err := ParseInstanceGroup(link)
+	if err != nil {
+		return ``, false
+	}
+	return zone + `/` + name, true
+}
+
+// ListDanglingInstanceGroups returns the deletions of the instance
+// groups created by GKE ingress that have no instances, and that are
+// not used as the backend of any backend service. These linger in every
+// zone of a cluster after the cluster is gone
+func (app *App) ListDanglingInstanceGroups(ctx context.Context) ([]*Deletion, error) {
+	c := app.Config()
+
+	var services []*compute.BackendService
+	if err := app.checkInventory(ctx, KindBackendServices, func() (int, error) {
+		var err error
+		services, err = app.listBackendServices(ctx)
+		return len(services), errors.Wrap(err, `failed to list backend services`)
+	}); err != nil {
+		return nil, err
+	}
+
+	inUse := make(map[string]struct{})
+	for _, service := range services {
+		for _, backend := range service.Backends {
+			if key, ok := instanceGroupKey(backend.Group); ok {
+				inUse[key] = struct{}{}
+			}
+		}
+	}
+
+	var groups []*compute.InstanceGroup
+	if err := app.checkInventory(ctx, KindInstanceGroups, func() (int, error) {
+		var err error
+		groups, err = app.listInstanceGroups(ctx)
+		return len(groups), errors.Wrap(err, `failed to list instance groups`)
+	}); err != nil {
+		return nil, err
+	}
+
+	var clusters []*container.Cluster
+	if c.ClusterCrossCheck {
+		var err error
+		if clusters, err = app.liveClusters(ctx); err != nil {
+			return nil, errors.Wrap(err, `failed to cross-check GKE clusters`)
+		}
+	}
+
+	var result []*Deletion
+	for _, ig := range groups {
+		if !hasAnyPrefix(ig.Name, instanceGroupPrefixes) || c.IsExcluded(ig.Name) || c.IsProtected(nil, ig.Description) {
+			continue
+		}
+
+		if ig.Size > 0 {
+			continue
+		}
+
+		if c.ownedByLiveCluster(ig.Name, clusters) {
+			continue
+		}
+
+		// give the ingress controller a chance to add the nodes
+		if c.isYoung(KindInstanceGroups, ig.CreationTimestamp) {
+			continue
+		}
+
+		_, zone, err := ParseInstanceGroup(ig.SelfLink)
+		if err != nil {
+			continue
+		}
+		if _, ok := inUse[zone+`/`+ig.Name]; ok {
+			continue
+		}
+		if sweepPolicyKeeps(ctx, c, sweptResource(KindInstanceGroups, ig.Name, ``, zone, ig.CreationTimestamp), nil) {
+			continue
+		}
+
+		result = append(result, &Deletion{
+			Kind: KindInstanceGroups,
+			Name: ig.Name,
+			Zone: zone,
+		})
+	}
+	sortDeletions(result)
+	return result, nil
+}
@@ -1,10 +1,1212 @@
 package autolbclean
 
-import compute "google.golang.org/api/compute/v1"
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	cloudresourcemanager "google.golang.org/api/cloudresourcemanager/v1"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
 
 const globalRegion = "global"
 
+const timeFormat = time.RFC3339
+
 type App struct {
-	project string
-	service *compute.Service
+	auditStore          AuditStore
+	client              *http.Client
+	compute             ComputeClient
+	config              *Config
+	container           *container.Service
+	crm                 *cloudresourcemanager.Service
+	deletionBudget      int
+	discoveryTimeout    time.Duration
+	epoch               int
+	events              []EventPublisher
+	executor            *compute.Service
+	executorClient      *http.Client
+	executorImpersonate string
+	getTimeout          time.Duration
+	impersonate         string
+	inventoryStore      InventoryStore
+	listTimeout         time.Duration
+	muConfig            sync.RWMutex
+	notifiers           []Notifier
+	partialPlan         string
+	planMaxAge          time.Duration
+	planStore           PlanStore
+	project             string
+	quotaProject        string
+	rateLimit           float64
+	runMetrics          bool
+	runID               string
+	requestReason       string
+	service             *compute.Service
+	store               Store
+	tagIndexStore       TagIndexStore
+	tagIndexTTL         time.Duration
+	taskSigningKey      []byte
+	tasks               TaskEnqueuer
+	teamNotifier        func(url string) Notifier
+	terraform           TerraformHandoff
+	transport           http.RoundTripper
+	zoneConcurrency     int
+}
+
+// Option configures the App
+type Option func(*App)
+
+// HealthCheckRef describes a health check referenced from a backend
+// service. Kind is the name of the collection the health check belongs
+// to (healthChecks, httpHealthChecks, or httpsHealthChecks)
+type HealthCheckRef struct {
+	Kind     string
+	Name     string
+	Region   string
+	SelfLink string
+}
+
+// OrphanedTargetPool describes a target pool created by GKE for a
+// LoadBalancer service, none of whose instances exist anymore, along
+// with the forwarding rules that point to it and the legacy health
+// checks that only it uses
+type OrphanedTargetPool struct {
+	Name            string
+	Region          string
+	Service         string // namespace/name of the Kubernetes service
+	ForwardingRules []string
+	HealthChecks    []*HealthCheckRef
+	CreatedAt       time.Time
+}
+
+// Orphan describes a load balancer whose backends no longer have any
+// instances. It holds all of the resources that need to be deleted
+// in order to get rid of the load balancer
+type Orphan struct {
+	Cluster         string            // UID of the cluster that created it, if known
+	ForwardingRule  string            // may be empty
+	Labels          map[string]string // labels of the forwarding rule
+	Region          string            // region of the forwarding rule
+	Namespace       string            // Kubernetes namespace of the ingress, if known
+	IPAddress       string            // IP address of the forwarding rule
+	Scheme          string            // load balancing scheme of the forwarding rule
+	TargetProxy     string
+	IsHTTPs         bool
+	SelfLink        string // self link of the target proxy
+	UrlMap          string
+	Certificates    []string
+	BackendServices []*compute.BackendService
+	HealthChecks    []*HealthCheckRef
+	CreatedAt       time.Time
+	Snoozes         int         // how many times it has been snoozed before
+	Managed         bool        // built by hand, and opted into the cleanup
+	ClusterDeleted  bool        // the cluster that created it was confirmed deleted
+	NoEndpoints     bool        // its backends were confirmed to have no endpoints
+	Confidence      *Confidence // nil unless confidence scoring is enabled
+	PolicyHold      string      // why the deletion policies keep it, if they do
+}
+
+// Confidence is how sure we are that an orphan can be deleted, and the
+// signals that it is based on
+type Confidence struct {
+	Score   int
+	Signals []string
+}
+
+// Snooze holds back the orphan with the given target proxy self link
+// from being cleaned up until Until. Unlike exclusions, snoozes expire,
+// after which the orphan is evaluated again
+type Snooze struct {
+	SelfLink string    `yaml:"self_link"`
+	Until    time.Time `yaml:"until"`
+	Count    int       `yaml:"count"` // how many times it has been snoozed
+	By       string    `yaml:"by"`
+}
+
+// SuppressionList is the document that the suppressions and the
+// snoozes of the admin state are exported to and imported from, so that
+// they can be reviewed and shared between deployments
+type SuppressionList struct {
+	Suppressions []string `yaml:"suppressions"` // patterns of resource names
+	Snoozes      []Snooze `yaml:"snoozes"`
+}
+
+// StateRemoval is the work item handed to the Terraform pipeline for a
+// load balancer that it manages, instead of deleting it
+type StateRemoval struct {
+	Project        string                  `json:"project"`
+	ForwardingRule string                  `json:"forwarding_rule"`
+	Region         string                  `json:"region"`
+	Resources      []*StateRemovalResource `json:"resources"`
+}
+
+// StateRemovalResource identifies a resource by the ID that the Terraform
+// google provider imports it by (projects/P/global/urlMaps/NAME)
+type StateRemovalResource struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	ID     string `json:"id"`
+}
+
+// TerraformHandoff hands load balancers managed by Terraform over to
+// the Terraform pipeline
+type TerraformHandoff interface {
+	HandOff(context.Context, *StateRemoval) error
+}
+
+// Notification is a message delivered to the notification sinks
+type Notification struct {
+	Project string `json:"project"`
+	Team    string `json:"team,omitempty"` // set on notifications about a single team's load balancers
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier is a notification sink
+type Notifier interface {
+	Notify(context.Context, *Notification) error
+}
+
+// NotifierFunc is a Notifier represented as a function
+type NotifierFunc func(context.Context, *Notification) error
+
+// Logger is a sink of structured log entries. It must be safe for
+// concurrent use
+type Logger interface {
+	Log(context.Context, *LogEntry)
+}
+
+// LogEntry is a single log entry. Apart from the message, fields that
+// do not apply to the entry are left empty
+type LogEntry struct {
+	Time         time.Time `json:"time"`
+	Severity     string    `json:"severity"`
+	Message      string    `json:"message"`
+	RunID        string    `json:"run_id,omitempty"`
+	ResourceType string    `json:"resource_type,omitempty"`
+	ResourceName string    `json:"resource_name,omitempty"`
+	Decision     string    `json:"decision,omitempty"`
+}
+
+// AlertRule describes a condition that, when the value of Metric exceeds
+// Threshold, should be reported through the notification sinks
+type AlertRule struct {
+	Metric    string
+	Threshold float64
+}
+
+// RunStats holds the numbers collected during a single check run, which
+// alert rules are evaluated against
+type RunStats struct {
+	Orphans        int
+	NewOrphans     int
+	MaxPendingDays float64
+}
+
+// RunStatus is the outcome of the latest check run, as shown on the
+// status badge
+type RunStatus struct {
+	Project    string
+	FinishedAt time.Time
+	Orphans    int    // orphans found, whose deletion may still be pending
+	OrphanSet  string // identifies the orphans found, see Report.OrphanSet
+}
+
+// RunSummary describes the latest run of a project, for operators who
+// want to know whether the checks are running at all
+type RunSummary struct {
+	Project   string                 `json:"project"`
+	LastRunAt *time.Time             `json:"last_run_at,omitempty"` // nil if no run was recorded
+	Stale     bool                   `json:"stale"`                 // no run finished in BadgeStaleAfter
+	RunID     string                 `json:"run_id,omitempty"`
+	Orphans   int                    `json:"orphans"`
+	Deletions RunSummaryDeletions    `json:"deletions"`
+	Config    map[string]interface{} `json:"config"`
+}
+
+// RunSummaryDeletions counts the deletions scheduled by a run by where
+// they are at
+type RunSummaryDeletions struct {
+	Pending   int `json:"pending"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// RunRecord is the history of a single run. Deleted and Failed are only
+// known for runs that delete synchronously, the deletions scheduled by
+// other runs are recorded as events as they complete
+type RunRecord struct {
+	RunID      string    `json:"run_id"`
+	Project    string    `json:"project"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Orphans    int       `json:"orphans"`
+	Scheduled  int       `json:"scheduled"`
+	Skipped    int       `json:"skipped"`
+	Deleted    int       `json:"deleted"`
+	Failed     int       `json:"failed"`
+}
+
+// Deletion describes a single resource that is planned to be deleted
+type Deletion struct {
+	Kind    string
+	Name    string
+	Region  string
+	Zone    string        // only for zonal resources, such as instance groups
+	Denied  bool          // true if a permission probe found that we can't delete it
+	Delay   time.Duration // how long to wait before deleting, e.g. for connections to drain
+	Next    []*Deletion   // deleted one after the other, once this deletion succeeded
+	Managed bool          // part of a load balancer that opted into the cleanup
+}
+
+// Operation is a long running compute API operation
+type Operation interface {
+	// Wait blocks until the operation is done, and returns an error
+	// if the operation failed
+	Wait(context.Context) error
+	// Ref identifies the operation, so that it can be looked up later
+	Ref() *OperationRef
+	// Done reports whether the operation was done when last fetched
+	Done() bool
+	// Err returns an *OperationError if the operation is done, and
+	// failed
+	Err() error
+}
+
+// OperationRef identifies an operation by its name and scope
+type OperationRef struct {
+	Name   string
+	Region string // only for regional operations
+	Zone   string // only for zonal operations
+}
+
+// OperationError is the error that a failed operation reports. Code is
+// the code of the API, such as RESOURCE_IN_USE_BY_ANOTHER_RESOURCE
+type OperationError struct {
+	Operation string
+	Code      string
+	Message   string
+}
+
+// ComputeClient issues the compute API calls that mutate resources.
+// Which client library implements it is chosen at build time
+type ComputeClient interface {
+	Delete(ctx context.Context, project string, d *Deletion) (Operation, error)
+	// Operation fetches the current state of an operation
+	Operation(ctx context.Context, project string, ref *OperationRef) (Operation, error)
+}
+
+// Cleaner finds and deletes one kind of resource. Cleaners are
+// registered with RegisterCleaner, after which resources of their kind
+// can be deleted through App.Delete and the /job/resources/* jobs,
+// without adding any routes of their own
+type Cleaner interface {
+	// Kind is the name of the collection the resources belong to, as
+	// in Deletion.Kind
+	Kind() string
+	// Match reports whether selfLink points to a resource of this kind
+	Match(selfLink string) bool
+	// Check returns the deletions of the resources that are no longer
+	// needed. Kinds that are only deleted as part of something else
+	// return nothing
+	Check(ctx context.Context, app *App) ([]*Deletion, error)
+	Delete(ctx context.Context, app *App, d *Deletion) (Operation, error)
+}
+
+// InstanceTagIndex records the gke-* network tags that are attached to
+// instances, along with the number of instances that carry them
+type InstanceTagIndex struct {
+	Tags      map[string]int
+	Complete  bool // true if the index was built by scanning all zones
+	CreatedAt time.Time
+}
+
+// ZoneScanError is returned when the instances in some of the zones
+// could not be listed. The tags in Unknown were not found in any of the
+// zones that were scanned, but may still be in use in the ones that
+// failed, so the firewall rules that target them are left alone
+type ZoneScanError struct {
+	Zones   map[string]error // by zone name
+	Unknown []string
+}
+
+// InventoryCount is the number of resources of a kind that discovery
+// found in a run
+type InventoryCount struct {
+	Project string
+	Kind    string
+	Count   int
+	TakenAt time.Time
+}
+
+// InventoryStore persists the InventoryCount of the latest run, so that
+// the next run can tell if discovery suddenly finds much less
+type InventoryStore interface {
+	LoadInventoryCount(ctx context.Context, project, kind string) (*InventoryCount, error) // returns nil if there is none
+	SaveInventoryCount(ctx context.Context, ic *InventoryCount) error
+}
+
+// TagIndexStore persists the InstanceTagIndex between runs
+type TagIndexStore interface {
+	LoadTagIndex(context.Context) (*InstanceTagIndex, error)
+	SaveTagIndex(context.Context, *InstanceTagIndex, time.Duration) error
+}
+
+// Task is a job to be run asynchronously, by POSTing Params to Path
+type Task struct {
+	Path   string
+	Params url.Values
+	Delay  time.Duration // how long to wait before running the task
+}
+
+// TaskEnqueuer hands tasks over to a task queue
+type TaskEnqueuer interface {
+	Enqueue(context.Context, *Task) error
+}
+
+// QueueStatus describes the task queue, as reported by its backend
+type QueueStatus struct {
+	Name        string
+	Running     bool
+	MaxAttempts int // 0 if unknown, -1 if unlimited
+}
+
+// QueueVerifier is implemented by TaskEnqueuers that can report the
+// status of their queue
+type QueueVerifier interface {
+	QueueStatus(context.Context) (*QueueStatus, error)
+}
+
+// QuotaUsage describes the usage of a single quota metric
+type QuotaUsage struct {
+	Metric string
+	Region string // "global" for project-wide quotas
+	Usage  float64
+	Limit  float64
+}
+
+// DeletionEvent is published when a resource is scheduled for deletion
+// or skipped, and again once its deletion is done
+type DeletionEvent struct {
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name"`
+	Region   string    `json:"region,omitempty"`
+	Zone     string    `json:"zone,omitempty"`
+	Cluster  string    `json:"cluster,omitempty"` // UID of the cluster, or a prefix of it, when the event was emitted
+	Project  string    `json:"project"`
+	Decision string    `json:"decision"`         // scheduled, skipped, deleted or failed
+	Reason   string    `json:"reason,omitempty"` // why it was skipped
+	Error    string    `json:"error,omitempty"`
+	At       time.Time `json:"timestamp"`
+	RunID    string    `json:"run_id"`
+}
+
+// EventPublisher publishes deletion events for downstream systems, such
+// as a CMDB or an audit pipeline
+type EventPublisher interface {
+	Publish(context.Context, *DeletionEvent) error
+}
+
+// SkippedResource is a load balancer, or one of its resources, that was
+// found in a run but not scheduled for deletion
+type SkippedResource struct {
+	Kind   string
+	Name   string
+	Region string
+	Reason string
+}
+
+// Report summarizes a single check run
+type Report struct {
+	Project    string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Orphans    []*Orphan
+	Deferred   []*Orphan // orphans that did not fit in the deletion budget
+	Scheduled  []*Deletion
+	Skipped    []*SkippedResource
+	Stats      *RunStats // only available when orphans are being tracked
+	Quotas     []*QuotaUsage
+	Access     []*AccessLogEntry // admin API invocations since the previous report
+	Retries    []*AttemptHistory // deletions that failed at least once since the previous report
+}
+
+// Findings is the machine readable form of a report, for policy-as-code
+// tooling and security scanners. It validates against the JSON Schema
+// in schema/findings.schema.json
+type Findings struct {
+	Schema      string     `json:"$schema"`
+	Project     string     `json:"project"`
+	GeneratedAt time.Time  `json:"generated_at"`
+	Findings    []*Finding `json:"findings"`
+}
+
+// Finding describes an orphaned load balancer
+type Finding struct {
+	RuleID         string             `json:"rule_id"`
+	Level          string             `json:"level"`
+	TargetProxy    string             `json:"target_proxy"`
+	SelfLink       string             `json:"self_link,omitempty"`
+	ForwardingRule string             `json:"forwarding_rule,omitempty"`
+	Region         string             `json:"region,omitempty"`
+	IPAddress      string             `json:"ip_address,omitempty"`
+	Scheme         string             `json:"load_balancing_scheme,omitempty"`
+	InternetFacing bool               `json:"internet_facing"`
+	Cluster        string             `json:"cluster,omitempty"`
+	Confidence     *int               `json:"confidence,omitempty"`
+	CreatedAt      *time.Time         `json:"created_at,omitempty"`
+	Resources      []*FindingResource `json:"resources"`
+}
+
+// FindingResource is one of the resources that make up the load
+// balancer of a finding
+type FindingResource struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+	Zone   string `json:"zone,omitempty"`
+}
+
+// OrphanInventory is the response of the orphan inventory API
+type OrphanInventory struct {
+	Project     string             `json:"project"`
+	GeneratedAt time.Time          `json:"generated_at"`
+	Orphans     []*OrphanCandidate `json:"orphans"`
+}
+
+// OrphanCandidate describes an orphaned load balancer for review,
+// before anything is deleted
+type OrphanCandidate struct {
+	TargetProxy    string           `json:"target_proxy"`
+	SelfLink       string           `json:"self_link,omitempty"`
+	ForwardingRule string           `json:"forwarding_rule,omitempty"`
+	Region         string           `json:"region,omitempty"`
+	Cluster        string           `json:"cluster,omitempty"`
+	Namespace      string           `json:"namespace,omitempty"`
+	Team           string           `json:"team,omitempty"`
+	CreatedAt      *time.Time       `json:"created_at,omitempty"`
+	AgeSeconds     int64            `json:"age_seconds,omitempty"`
+	Reasons        []string         `json:"reasons"`              // why it was classified as an orphan
+	Confidence     *int             `json:"confidence,omitempty"` // only when confidence scoring is enabled
+	Signals        []string         `json:"signals,omitempty"`
+	ReportOnly     bool             `json:"report_only"`           // its confidence is too low, or a policy keeps it
+	PolicyHold     string           `json:"policy_hold,omitempty"` // why the deletion policies keep it
+	Chain          []*ChainResource `json:"chain"`                 // in the order of deletion
+}
+
+// ChainResource is one of the resources of an orphaned load balancer.
+// In a chain, resources come before the resources they reference
+type ChainResource struct {
+	Kind      string     `json:"kind"`
+	Name      string     `json:"name"`
+	Region    string     `json:"region,omitempty"`
+	Zone      string     `json:"zone,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"` // only known for some kinds
+}
+
+// Explanation tells whether a run would delete the load balancer of a
+// forwarding rule, and why
+type Explanation struct {
+	Project        string             `json:"project"`
+	ForwardingRule string             `json:"forwarding_rule"`
+	Region         string             `json:"region"`
+	Verdict        string             `json:"verdict"`          // would-delete or would-skip
+	Reason         string             `json:"reason,omitempty"` // the detail of the check that keeps it
+	Steps          []*ExplanationStep `json:"steps"`            // in the order the checks were made
+	Orphan         *OrphanCandidate   `json:"orphan,omitempty"` // only if it is orphaned
+
+	owner *Orphan // what the team of the load balancer is told by
+}
+
+// ExplanationStep is a single check of an explanation
+type ExplanationStep struct {
+	Check     string   `json:"check"`
+	Passed    bool     `json:"passed"` // false if the check keeps the load balancer
+	Detail    string   `json:"detail"`
+	Resources []string `json:"resources,omitempty"` // what the check found
+	Count     *int     `json:"count,omitempty"`     // what the check counted, such as instances
+}
+
+// ResourceGraph holds the resources of the load balancers of a project,
+// and the references between them
+type ResourceGraph struct {
+	Project     string       `json:"project"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	Nodes       []*GraphNode `json:"nodes"`
+	Edges       []*GraphEdge `json:"edges"`
+}
+
+// GraphNode is a resource of the resource graph, identified by its
+// self link
+type GraphNode struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+	Zone   string `json:"zone,omitempty"`
+	Error  string `json:"error,omitempty"` // why it could not be looked up
+}
+
+// GraphEdge is a reference from one resource of the resource graph to
+// another
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// WorkerResult is the machine readable result of a one-shot worker run
+type WorkerResult struct {
+	Status     string            `json:"status"`
+	ExitCode   int               `json:"exit_code"`
+	Project    string            `json:"project"`
+	RunID      string            `json:"run_id"`
+	PlanOnly   bool              `json:"plan_only"`
+	Orphans    int               `json:"orphans"`
+	Deletions  []*DeletionResult `json:"deletions"`
+	Deferred   int               `json:"deferred,omitempty"`    // orphans left for the next run
+	HandedOff  int               `json:"handed_off,omitempty"`  // orphans handed off to terraform
+	ReportOnly int               `json:"report_only,omitempty"` // orphans whose confidence is too low to delete them
+	Unchecked  int               `json:"unchecked,omitempty"`   // load balancers that could not be checked
+	Error      string            `json:"error,omitempty"`
+}
+
+// DeletionResult describes the outcome of a single deletion performed
+// by the one-shot worker
+type DeletionResult struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Region     string `json:"region"`
+	Zone       string `json:"zone,omitempty"` // only for zonal resources, such as instance groups
+	Deleted    bool   `json:"deleted"`
+	Error      string `json:"error,omitempty"`
+	ErrorClass string `json:"error_class,omitempty"` // see ErrorClass
+}
+
+// TelemetryReport is the anonymous usage report sent to the telemetry
+// endpoint
+type TelemetryReport struct {
+	Pipeline string         `json:"pipeline"`
+	Cleaned  map[string]int `json:"cleaned"`           // by resource kind
+	Errors   map[string]int `json:"errors"`            // by error class
+	Expired  map[string]int `json:"expired,omitempty"` // delete jobs dropped unrun, by resource kind
+}
+
+// RunMetrics are the numbers of a single run that are written to Cloud
+// Monitoring
+type RunMetrics struct {
+	Orphans int
+	Deleted map[string]int // by resource kind
+}
+
+// Config holds the settings that control what gets cleaned up. It can
+// be reloaded without restarting
+type Config struct {
+	// Name prefixes of the forwarding rules to check
+	ForwardingRulePrefixes []string `yaml:"forwarding_rule_prefixes"`
+	// Name prefixes of the target proxies to check, when they have no
+	// forwarding rule
+	TargetProxyPrefixes []string `yaml:"target_proxy_prefixes"`
+	// Prefixes of the network tags that firewall rules are checked for
+	FirewallTagPrefixes []string `yaml:"firewall_tag_prefixes"`
+	// Name prefixes of the health checks to check, when they are not
+	// referenced by any backend service
+	HealthCheckPrefixes []string `yaml:"health_check_prefixes"`
+	// Name prefixes of the backend services to check, when they are not
+	// referenced by any url map, forwarding rule, or target proxy
+	BackendServicePrefixes []string `yaml:"backend_service_prefixes"`
+	// Name prefixes of the static IP addresses to check, when they are
+	// reserved but not used by anything
+	AddressPrefixes []string `yaml:"address_prefixes"`
+	// Load balancers younger than this are never deleted
+	AgeThreshold time.Duration `yaml:"age_threshold"`
+	// Overrides AgeThreshold for resources of the given kinds. A load
+	// balancer is too young if any of its resources is
+	AgeThresholds map[string]time.Duration `yaml:"age_thresholds"`
+	// Resources whose names match any of these patterns (as in path.Match)
+	// are never deleted, along with the rest of their load balancer
+	Exclusions []string `yaml:"exclusions"`
+	// Names of the built-in exclusion rules (see BuiltinExclusions) that
+	// should not be applied
+	DisabledBuiltinExclusions []string `yaml:"disabled_builtin_exclusions"`
+	// When true, orphans are still detected but nothing is deleted
+	Paused bool `yaml:"paused"`
+	// Cron expressions of the minutes during which deletions may be
+	// carried out. Outside of them, orphans are still detected but
+	// nothing is deleted. If empty, deletions may happen at any time
+	DeletionWindows []string `yaml:"deletion_windows"`
+	// IANA name of the time zone that deletion windows are evaluated in,
+	// and that months are delimited in for the monthly digest. If empty,
+	// UTC is used
+	TimeZone string `yaml:"time_zone"`
+	// Resources of these kinds are disabled for the given amount of time
+	// before they are deleted. Only firewalls can be disabled
+	DisableBeforeDelete map[string]GracePeriod `yaml:"disable_before_delete"`
+	// Names (as in path.Match) of the resources of each kind that delete
+	// jobs may delete, replacing the defaults of that kind
+	NamePatterns map[string][]string `yaml:"name_patterns"`
+	// How long a delete job may wait in the queue, on top of the delay it
+	// was scheduled with, before it is dropped without being run
+	TaskExpiration time.Duration `yaml:"task_expiration"`
+	// Overrides TaskExpiration for the delete jobs of the given kinds
+	TaskExpirations map[string]time.Duration `yaml:"task_expirations"`
+	// When true, load balancers with backends in the zones of a GKE cluster
+	// that is being upgraded or repaired, and the firewall rules for its
+	// nodes, are not cleaned up
+	UpgradeAwareness bool `yaml:"upgrade_awareness"`
+	// When true, the deletion of backend services (and their health
+	// checks) is delayed until connections to them have drained
+	ConnectionDrainingAware bool `yaml:"connection_draining_aware"`
+	// When true, resources whose names carry the UID of a GKE cluster
+	// that still exists are never deleted
+	ClusterCrossCheck bool `yaml:"cluster_cross_check"`
+	// When true, firewall rules for the nodes of GKE clusters with node
+	// auto-provisioning are only deleted once the cluster is gone
+	AutoprovisioningAwareness bool `yaml:"autoprovisioning_awareness"`
+	// How failed API calls are retried
+	Retry RetryConfig `yaml:"retry"`
+	// Naming conventions of clusters whose resources do not follow the
+	// GKE defaults. Their prefixes are checked in addition to the above
+	Clusters []*ClusterConvention `yaml:"clusters"`
+	// Whether backend services are also asked for the health of their
+	// endpoints before a load balancer is considered empty
+	HealthEmptiness HealthEmptinessConfig `yaml:"health_emptiness"`
+	// Whether load balancers backed by network endpoint groups are only
+	// considered orphaned once their groups have stayed empty for a while,
+	// and the cluster that owns them is gone
+	NEGEmptiness NEGEmptinessConfig `yaml:"neg_emptiness"`
+	// Whether the resources of Multi Cluster Ingress are cleaned up too
+	MultiClusterIngress MultiClusterIngressConfig `yaml:"multi_cluster_ingress"`
+	// The label that opts resources out of the cleanup, along with the
+	// rest of their load balancer
+	Protection ProtectionConfig `yaml:"protection"`
+	// Whether load balancers that were built by hand are cleaned up when
+	// they carry the label that opts them in
+	Managed ManagedConfig `yaml:"managed"`
+	// How orphans are scored by how sure we are that they can be
+	// deleted, and the score below which they are only reported
+	Confidence ConfidenceConfig `yaml:"confidence"`
+	// Custom rules, as CEL expressions, that decide whether the
+	// resources of an orphan may be deleted
+	Policies PoliciesConfig `yaml:"policies"`
+	// Which teams own which load balancers, so that reports and
+	// notifications can be sliced per team
+	Teams TeamsConfig `yaml:"teams"`
+	// Which load balancers are handed off to the Terraform pipeline
+	// instead of being deleted
+	Terraform TerraformConfig `yaml:"terraform"`
+	// The fraction of the resources found by the previous run that may
+	// disappear before discovery is considered suspect. 0 disables the
+	// check
+	InventoryDropThreshold float64 `yaml:"inventory_drop_threshold"`
+	// How reports written with -redact are redacted, so that they can be
+	// shared outside of the project
+	ExportRedaction ExportRedaction `yaml:"export_redaction"`
+	// How long the cleaner keeps the records it makes about itself, and
+	// where they are archived to before they are removed
+	Retention RetentionConfig `yaml:"retention"`
+	// Orphans that are held back for a while, usually set through the
+	// admin API. Expired snoozes are kept as a record of prior snoozes
+	Snoozes []Snooze `yaml:"snoozes,omitempty"`
+}
+
+// RetentionConfig sets how long each type of record that the cleaner
+// keeps about itself is retained. Records of types that are not listed
+// are kept forever
+type RetentionConfig struct {
+	Records    map[string]time.Duration `yaml:"records"`     // by record type, such as runs or access_log
+	ArchiveURL string                   `yaml:"archive_url"` // gs://BUCKET/PREFIX. if empty, nothing is archived
+}
+
+// TerraformConfig selects the load balancers that are managed by
+// Terraform through a label on their forwarding rule. Deleting them
+// would leave the Terraform state out of sync
+type TerraformConfig struct {
+	Label string `yaml:"label"` // if empty, nothing is handed off
+	Value string `yaml:"value"` // if empty, any value of the label matches
+}
+
+// ProtectionConfig names the label that resources carry to opt out of
+// the cleanup. Resources that can not be labeled carry LABEL=VALUE in
+// their description instead
+type ProtectionConfig struct {
+	Label string `yaml:"label"` // if empty, nothing is protected
+	Value string `yaml:"value"`
+}
+
+// ConfidenceConfig configures the scoring of orphans. Each signal that
+// an orphan shows adds to its score, out of 100, and when enabled,
+// orphans that score less than MinScore are reported but not deleted
+type ConfidenceConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	MinScore int           `yaml:"min_score"`
+	Age      time.Duration `yaml:"age"`     // how old an orphan must be for its age to count
+	Traffic  bool          `yaml:"traffic"` // whether request counts are looked up in Cloud Monitoring
+}
+
+// PoliciesConfig holds the deletion policies. Each resource of an orphan
+// is subject to the action of the first rule whose expression matches
+// it, or else to Default. An orphan with a single resource that is kept
+// is only reported
+type PoliciesConfig struct {
+	Default string       `yaml:"default"` // keep or delete
+	Rules   []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule is a single deletion policy
+type PolicyRule struct {
+	Name       string `yaml:"name"`
+	Expression string `yaml:"expression"` // CEL expression over resource and orphan
+	Action     string `yaml:"action"`     // keep or delete
+}
+
+// ManagedConfig names the label that load balancers built by hand carry
+// to opt into the cleanup. Their forwarding rule carries the label, or,
+// for load balancers without one, their target proxy carries
+// LABEL=VALUE in its description
+type ManagedConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Label   string `yaml:"label"`
+	Value   string `yaml:"value"`
+}
+
+// ClusterConvention maps a cluster UID to the name prefixes used by
+// the resources of that cluster, e.g. when they were created by third
+// party tooling
+type ClusterConvention struct {
+	UID                    string   `yaml:"uid"`
+	ForwardingRulePrefixes []string `yaml:"forwarding_rule_prefixes"`
+	TargetProxyPrefixes    []string `yaml:"target_proxy_prefixes"`
+	FirewallTagPrefixes    []string `yaml:"firewall_tag_prefixes"`
+	HealthCheckPrefixes    []string `yaml:"health_check_prefixes"`
+	BackendServicePrefixes []string `yaml:"backend_service_prefixes"`
+	AddressPrefixes        []string `yaml:"address_prefixes"`
+}
+
+// HealthEmptinessConfig configures the health-based emptiness check.
+// A load balancer is only considered empty if GetHealth reports no
+// endpoints for any of its backends. Calls that time out or fail make
+// the outcome unknown, and the load balancer is left alone
+type HealthEmptinessConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Timeout     time.Duration `yaml:"timeout"`     // for each GetHealth call
+	Concurrency int           `yaml:"concurrency"` // GetHealth calls in flight for a load balancer
+}
+
+// TeamsConfig maps load balancers to the teams that own them. The team
+// of a load balancer is given by the label of its forwarding rule, or
+// else by the namespace of its ingress, or else by its cluster
+type TeamsConfig struct {
+	Label      string            `yaml:"label"`      // label of the forwarding rule that names the team
+	Namespaces map[string]string `yaml:"namespaces"` // team of each Kubernetes namespace
+	Clusters   map[string]string `yaml:"clusters"`   // team of each cluster, by UID
+	Webhooks   map[string]string `yaml:"webhooks"`   // Slack webhook that each team is notified through
+}
+
+// NEGEmptinessConfig tunes the check of load balancers whose backends
+// are zonal network endpoint groups, as created for container-native
+// load balancing. Such a load balancer is only considered orphaned if
+// every one of its groups has had no endpoints for longer than
+// Threshold, and the GKE cluster named in the description of the group
+// no longer exists. The check is always made, as a group has no
+// endpoints whenever its service is scaled to zero
+type NEGEmptinessConfig struct {
+	Threshold time.Duration `yaml:"threshold"` // how long the groups must have been empty
+}
+
+// MultiClusterIngressConfig enables the cleanup of the load balancers
+// that Multi Cluster Ingress creates (mci-, mcs-). These are owned by
+// the config cluster of the fleet rather than by the clusters that
+// serve them, so they are only cleaned up once all of ConfigClusters
+// (projects/PROJECT/locations/LOCATION/clusters/CLUSTER) are gone
+type MultiClusterIngressConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	ConfigClusters []string `yaml:"config_clusters"`
+}
+
+// CircuitBreaker keeps track of consecutive failures, and once there
+// have been too many of them, stops further attempts until a cool down
+// period has passed
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+// ProjectSummary is the entry for a single project in a Rollup
+type ProjectSummary struct {
+	Project   string
+	Folder    string
+	Status    string
+	PlanOnly  bool
+	Orphans   int
+	Deletions int // successful deletions, or planned deletions in plan-only mode
+	Failures  int
+	Savings   float64 // estimated monthly savings, in USD
+}
+
+// FolderSummary aggregates the ProjectSummary entries of the projects
+// in the same folder
+type FolderSummary struct {
+	Folder    string
+	Projects  int
+	Orphans   int
+	Deletions int
+	Failures  int
+	Savings   float64
+}
+
+// ExportRedaction controls how much the exports that leave the project,
+// or the organization, reveal about its infrastructure
+type ExportRedaction struct {
+	HashNames    bool   `yaml:"hash_names"`    // replace names with keyed hashes
+	OmitProjects bool   `yaml:"omit_projects"` // leave project IDs out
+	Key          string `yaml:"key"`           // key of the hashes, required to hash names
+}
+
+// Rollup summarizes the results of the latest runs across all of the
+// projects in multi-project mode
+type Rollup struct {
+	GeneratedAt time.Time
+	Projects    []*ProjectSummary
+	Folders     []*FolderSummary
+	Total       FolderSummary
+}
+
+// Plan is the result of the discovery phase of a run, as it is being
+// computed. Checked holds the keys of the load balancers that have
+// already been examined, so that an interrupted discovery can be
+// resumed without examining (or counting) them twice
+type Plan struct {
+	Project   string
+	StartedAt time.Time
+	UpdatedAt time.Time
+	Complete  bool // discovery has finished, the run may be deleting
+	Checked   map[string]bool
+	Orphans   []*Orphan
+
+	resumed   int // how many of the orphans were found by a previous run
+	unchecked int // how many load balancers this run failed to check
+}
+
+// PlanStore persists the plan of an ongoing run, so that it survives
+// the process dying in the middle of the run
+type PlanStore interface {
+	LoadPlan(ctx context.Context, project string) (*Plan, error) // returns nil if there is no plan
+	SavePlan(ctx context.Context, plan *Plan) error
+	DiscardPlan(ctx context.Context, project string) error
+}
+
+// PendingDeletion records a resource that was disabled instead of
+// being deleted, and when it is due to be deleted
+type PendingDeletion struct {
+	Kind        string
+	Name        string
+	DisabledAt  time.Time
+	DeleteAfter time.Time
+}
+
+// AccessLogEntry records a single invocation of the admin API
+type AccessLogEntry struct {
+	At         time.Time
+	Email      string // empty if the caller could not be identified
+	Role       string
+	Method     string
+	Path       string
+	Params     string
+	RemoteAddr string
+	Status     int
+}
+
+// DeletionRecord is the audit history entry of a resource that was deleted
+type DeletionRecord struct {
+	Project   string
+	Kind      string
+	Name      string
+	Region    string
+	Zone      string
+	DeletedAt time.Time
+	Attempt   int // the attempt of the delete job that succeeded
+	Requeues  int // how many times the deletion was enqueued again
+}
+
+// DeletionAttempt records the outcome of a single attempt at deleting
+// a resource
+type DeletionAttempt struct {
+	Project    string
+	Kind       string
+	Name       string
+	Region     string
+	Zone       string
+	At         time.Time
+	Attempt    int    // 1 for the first run of the delete job
+	Requeues   int    // how many times the deletion was enqueued again because the resource was in use
+	ErrorClass string // empty if the attempt succeeded
+}
+
+// AttemptHistory is the history of the attempts at deleting a single
+// resource
+type AttemptHistory struct {
+	Kind     string
+	Name     string
+	Region   string
+	Zone     string
+	Attempts []*DeletionAttempt // oldest first
+}
+
+// BillingCost is the cost of a single resource on a single day, as
+// found in the billing export
+type BillingCost struct {
+	GlobalName string
+	Day        time.Time
+	Cost       float64
+}
+
+// RealizedSaving compares what a deleted resource cost in the 30 days
+// before its deletion against what it still cost afterwards
+type RealizedSaving struct {
+	Deletion *DeletionRecord
+	Before   float64 // cost in the 30 days before the deletion
+	After    float64 // cost since the deletion, scaled to 30 days
+}
+
+// Digest summarizes the deletions made during a month
+type Digest struct {
+	Project          string
+	Month            time.Time
+	Deletions        []*DeletionRecord
+	EstimatedSavings float64           // based on EstimatedMonthlyCost
+	Realized         []*RealizedSaving // only available with a billing export
+}
+
+// Candidate is an orphan that was found by a check run, and is tracked
+// until a run no longer finds it
+type Candidate struct {
+	SelfLink       string
+	ForwardingRule string // only for orphans, so that the CLI can complete their names
+	Region         string // region of the forwarding rule
+	FirstSeen      time.Time
+	LastSeen       time.Time
+}
+
+// AdminState holds the changes made through the admin API. They are
+// applied on top of the configuration, so that they survive the
+// configuration being reloaded
+type AdminState struct {
+	Paused       bool
+	Suppressions []string
+	SuppressedAt []time.Time // when each of the suppressions was added
+	Snoozes      []Snooze
+	Epoch        int // delete jobs enqueued in earlier epochs are void
+
+	// what the configuration looked like as of the latest request, so
+	// that a change can start a new epoch
+	Fingerprint string
+	WasPaused   bool
+}
+
+// Store persists the state that outlives a single run: the outcome of
+// the latest run of each project, the orphan candidates that are being
+// tracked, and the suppressions and other changes made through the
+// admin API
+type Store interface {
+	LoadRunStatus(ctx context.Context, project string) (*RunStatus, error) // returns nil if there is none
+	SaveRunStatus(ctx context.Context, status *RunStatus) error
+	ListCandidates(ctx context.Context, project string) ([]*Candidate, error)
+	// SaveCandidates replaces the candidates of the project
+	SaveCandidates(ctx context.Context, project string, candidates []*Candidate) error
+	LoadAdminState(ctx context.Context) (*AdminState, error) // returns an empty state if there is none
+	// UpdateAdminState applies f to the admin state, atomically where
+	// the backend allows it
+	UpdateAdminState(ctx context.Context, f func(*AdminState)) error
+}
+
+// HistoryStore is implemented by Stores that can keep the history of the
+// runs, and of the deletions they scheduled and carried out, beyond what
+// the logs are retained for
+type HistoryStore interface {
+	SaveRun(ctx context.Context, r *RunRecord) error
+	// ListRuns returns the runs of the project that started after since,
+	// oldest first
+	ListRuns(ctx context.Context, project string, since time.Time) ([]*RunRecord, error)
+	SaveEvent(ctx context.Context, ev *DeletionEvent) error
+	// ListEvents returns the events of the run, in the order they
+	// happened
+	ListEvents(ctx context.Context, runID string) ([]*DeletionEvent, error)
+}
+
+// EventLister is implemented by HistoryStores that can list deletion
+// events across runs, for the audit queries
+type EventLister interface {
+	// ListEventsBetween returns at most limit events of every project
+	// that happened at or after since, and before until, oldest first.
+	// Events are not filtered by project, as that would require a
+	// composite index
+	ListEventsBetween(ctx context.Context, since, until time.Time, limit int) ([]*DeletionEvent, error)
+}
+
+// EventQuery filters the deletion events of the history of a project.
+// Filters that are left empty match every event
+type EventQuery struct {
+	Kind    string    // resource kind, as in forwardingRules
+	Cluster string    // cluster UID, or a prefix of at least 8 characters
+	Outcome string    // scheduled, skipped, deleted, failed or expired
+	Since   time.Time // inclusive
+	Until   time.Time // exclusive. now when zero
+	Cursor  string    // NextCursor of the previous page
+	Limit   int       // events per page
+
+	allowed func(*Orphan) bool // the team scope of the admin, if any
+}
+
+// EventPage is a page of the deletion events that an EventQuery
+// matched. NextCursor is empty on the last page
+type EventPage struct {
+	Events     []*DeletionEvent `json:"events"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// EmptyGroupStore is implemented by Stores that can remember since when
+// the network endpoint groups of a project have been seen without any
+// endpoints. The groups are recorded as Candidates, keyed by self link
+type EmptyGroupStore interface {
+	ListEmptyGroups(ctx context.Context, project string) ([]*Candidate, error)
+	// SaveEmptyGroups replaces the empty groups of the project
+	SaveEmptyGroups(ctx context.Context, project string, groups []*Candidate) error
+}
+
+// UnusedAddressStore is implemented by Stores that can remember since
+// when the static IP addresses of a project have been seen reserved but
+// unused. The addresses are recorded as Candidates, keyed by self link
+type UnusedAddressStore interface {
+	ListUnusedAddresses(ctx context.Context, project string) ([]*Candidate, error)
+	// SaveUnusedAddresses replaces the unused addresses of the project
+	SaveUnusedAddresses(ctx context.Context, project string, addresses []*Candidate) error
+}
+
+// HandoffStore is implemented by Stores that can remember which load
+// balancers were handed off to the Terraform pipeline, so that they are
+// not handed off on every run. The load balancers are recorded as
+// Candidates, keyed by the self link of their target proxy
+type HandoffStore interface {
+	ListHandoffs(ctx context.Context, project string) ([]*Candidate, error)
+	// SaveHandoffs replaces the handoffs of the project
+	SaveHandoffs(ctx context.Context, project string, handoffs []*Candidate) error
+}
+
+// DeletedCluster records a GKE cluster that was confirmed deleted by a
+// cluster notification
+type DeletedCluster struct {
+	Project   string
+	ID        string // the resources of the cluster carry its beginning as their UID
+	Name      string
+	Location  string
+	DeletedAt time.Time
+}
+
+// DeletedClusterStore is implemented by Stores that can remember the
+// GKE clusters that were confirmed deleted
+type DeletedClusterStore interface {
+	ListDeletedClusters(ctx context.Context, project string) ([]*DeletedCluster, error)
+	// SaveDeletedCluster records the cluster, replacing any earlier
+	// record of the same cluster
+	SaveDeletedCluster(ctx context.Context, dc *DeletedCluster) error
+}
+
+// RecordPruner is implemented by Stores and AuditStores that can remove
+// the records that are older than a cutoff. Record types that they do
+// not keep are left alone
+type RecordPruner interface {
+	// PruneRecords passes the records of the type that are older than
+	// cutoff to archive, and removes them unless archive fails. It
+	// returns how many were removed
+	PruneRecords(ctx context.Context, record string, cutoff time.Time, archive func([]interface{}) error) (int, error)
+}
+
+// PruneResult is the outcome of collecting the records of a type that
+// are older than their retention
+type PruneResult struct {
+	Record   string    `json:"record"`
+	Cutoff   time.Time `json:"cutoff"`
+	Pruned   int       `json:"pruned"`
+	Archives []string  `json:"archives,omitempty"` // where the pruned records were archived to
+	Error    string    `json:"error,omitempty"`
+}
+
+// AuditStore keeps track of the resources that are pending deletion,
+// so that their grace period is honored across runs, of the resources
+// that were deleted, and of who did what through the admin API
+type AuditStore interface {
+	LoadPendingDeletion(ctx context.Context, kind, name string) (*PendingDeletion, error) // returns nil if there is none
+	SavePendingDeletion(ctx context.Context, pd *PendingDeletion) error
+	DeletePendingDeletion(ctx context.Context, kind, name string) error
+	RecordAccess(ctx context.Context, e *AccessLogEntry) error
+	ListAccess(ctx context.Context, since, until time.Time) ([]*AccessLogEntry, error)
+	RecordDeletion(ctx context.Context, r *DeletionRecord) error
+	ListDeletions(ctx context.Context, since, until time.Time) ([]*DeletionRecord, error)
+	RecordAttempt(ctx context.Context, a *DeletionAttempt) error
+	ListAttempts(ctx context.Context, since, until time.Time) ([]*DeletionAttempt, error)
+}
+
+// RoleBinding grants Role on the admin API to the identities whose email
+// address matches Member
+type RoleBinding struct {
+	Member string
+	Role   string
+	Team   string // if set, the role only applies to the load balancers of this team
+}
+
+// BuiltinExclusion is an exclusion rule that ships with the package.
+// Several rules may share the same Name, in which case they are turned
+// off together
+type BuiltinExclusion struct {
+	Name    string
+	Pattern string
+	Reason  string
+}
+
+// MonitoringOptions configures the dashboard and the alert policies
+// created for the metrics reported by the canary
+type MonitoringOptions struct {
+	// how often the canary runs. An alert fires when no outcome has
+	// been reported for twice as long
+	CanaryInterval time.Duration
+	// the full names of the notification channels that alerts are sent
+	// to (projects/P/notificationChannels/ID)
+	NotificationChannels []string
+}
+
+// Canary describes a test load balancer that was created for the cleaner
+// to find and delete, as proof that the whole pipeline works
+type Canary struct {
+	ID             string
+	CreatedAt      time.Time
+	Deadline       time.Time // the canary must have been cleaned up by then
+	CleanedAt      time.Time // when the canary was first seen to be gone
+	ForwardingRule string
+	TargetProxy    string
+	UrlMap         string
+	BackendService string
+	HealthCheck    string
+}
+
+// RetryPolicy describes how failed API calls are retried
+type RetryPolicy struct {
+	Attempts       int           `yaml:"attempts"` // including the first one
+	BaseDelay      time.Duration `yaml:"base_delay"`
+	MaxDelay       time.Duration `yaml:"max_delay"`
+	RetryableCodes []int         `yaml:"retryable_codes"` // HTTP status codes
+}
+
+// RetryConfig holds separate retry policies for API calls that only
+// read, and API calls that change something
+type RetryConfig struct {
+	Read     RetryPolicy `yaml:"read"`
+	Mutation RetryPolicy `yaml:"mutation"`
 }
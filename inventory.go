@@ -0,0 +1,142 @@
+package autolbclean
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultInventoryDropThreshold is the fraction of the resources found
+// by the previous run that may disappear before a run is suspect
+const DefaultInventoryDropThreshold = 0.5
+
+// minInventoryForDrop is the smallest previous count that a drop is
+// checked against. Deleting two of three load balancers is normal
+const minInventoryForDrop = 5
+
+// Inventories of the resources that are listed to tell which resources
+// are still in use, but that are not deleted themselves, or that are
+// only partly listed
+const (
+	inventoryInstances               = `instances`
+	inventoryRegionalForwardingRules = `regionalForwardingRules`
+	inventoryTargetSslProxies        = `targetSslProxies`
+	inventoryTargetTcpProxies        = `targetTcpProxies`
+	inventoryTargetGrpcProxies       = `targetGrpcProxies`
+)
+
+// InventoryDropError is returned when discovery found drastically fewer
+// resources than the previous run, which is more likely an API hiccup
+// returning a partial list than a real change
+type InventoryDropError struct {
+	Kind     string
+	Previous int
+	Current  int
+}
+
+func (e *InventoryDropError) Error() string {
+	return fmt.Sprintf(`inventory of %s dropped from %d to %d since the previous run`, e.Kind, e.Previous, e.Current)
+}
+
+// IsInventoryDropError returns true if err is the error of a run whose
+// discovery found drastically fewer resources than the previous run
+func IsInventoryDropError(err error) bool {
+	_, ok := errors.Cause(err).(*InventoryDropError)
+	return ok
+}
+
+// IsInventoryDrop returns true if going from previous to current
+// resources loses more than threshold of them
+func IsInventoryDrop(previous, current int, threshold float64) bool {
+	if threshold <= 0 || previous < minInventoryForDrop || current >= previous {
+		return false
+	}
+	return float64(previous-current)/float64(previous) > threshold
+}
+
+// checkInventory compares the number of resources of the given kind
+// that list finds with the previous run. A drop is usually an API
+// hiccup that does not last, so list is called a second time before
+// giving up on the run with an *InventoryDropError, which is also sent
+// to the notification sinks.
+//
+// The new count is only saved when there was no drop, so that a list
+// that keeps coming back short does not become the baseline. A drop
+// that is real holds back the runs until the count is reset with
+// ResetInventory
+func (app *App) checkInventory(ctx context.Context, kind string, list func() (int, error)) error {
+	count, err := list()
+	if err != nil {
+		return err
+	}
+
+	if app.inventoryStore == nil {
+		return nil
+	}
+
+	prev, err := app.inventoryStore.LoadInventoryCount(ctx, app.project, kind)
+	if err != nil {
+		return errors.Wrap(err, `failed to load previous inventory`)
+	}
+
+	c := app.Config()
+	dropped := func() bool {
+		return prev != nil && IsInventoryDrop(prev.Count, count, c.InventoryDropThreshold)
+	}
+
+	if dropped() {
+		if err := sleepContext(ctx, c.Retry.Read.MaxDelay); err != nil {
+			return err
+		}
+		if count, err = list(); err != nil {
+			return err
+		}
+	}
+
+	if dropped() {
+		derr := &InventoryDropError{Kind: kind, Previous: prev.Count, Current: count}
+		if isReadOnly(ctx) {
+			return derr
+		}
+		// the run is skipped regardless of whether anybody was told
+		_ = app.Notify(ctx, &Notification{
+			Subject: `inventory dropped, skipping deletions`,
+			Body:    derr.Error() + `, nothing is deleted until the inventory of ` + kind + ` is reset`,
+		})
+		return derr
+	}
+	if isReadOnly(ctx) {
+		return nil
+	}
+
+	err = app.inventoryStore.SaveInventoryCount(ctx, &InventoryCount{
+		Project: app.project,
+		Kind:    kind,
+		Count:   count,
+		TakenAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.Wrap(err, `failed to save inventory`)
+	}
+	return nil
+}
+
+// ResetInventory forgets the count of resources of the given kind, for
+// when a drop that holds back the runs turned out to be real. The next
+// run takes whatever it finds as the new baseline
+func (app *App) ResetInventory(ctx context.Context, kind string) error {
+	if app.inventoryStore == nil {
+		return nil
+	}
+	err := app.inventoryStore.SaveInventoryCount(ctx, &InventoryCount{
+		Project: app.project,
+		Kind:    kind,
+		TakenAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.Wrap(err, `failed to reset inventory`)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package autolbclean
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/appengine/datastore"
+)
+
+const inventoryCountKind = `InventoryCount`
+
+// datastoreInventoryStore stores the inventory counts in App Engine datastore
+type datastoreInventoryStore struct{}
+
+func inventoryCountKey(ctx context.Context, project, kind string) *datastore.Key {
+	return datastore.NewKey(ctx, inventoryCountKind, project+`/`+kind, 0, nil)
+}
+
+func (datastoreInventoryStore) LoadInventoryCount(ctx context.Context, project, kind string) (*InventoryCount, error) {
+	var ic InventoryCount
+	if err := datastore.Get(ctx, inventoryCountKey(ctx, project, kind), &ic); err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, `failed to load inventory count from datastore`)
+	}
+	return &ic, nil
+}
+
+func (datastoreInventoryStore) SaveInventoryCount(ctx context.Context, ic *InventoryCount) error {
+	if _, err := datastore.Put(ctx, inventoryCountKey(ctx, ic.Project, ic.Kind), ic); err != nil {
+		return errors.Wrap(err, `failed to save inventory count to datastore`)
+	}
+	return nil
+}
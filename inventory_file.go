@@ -0,0 +1,59 @@
+package autolbclean
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+type fileInventoryStore struct {
+	dir string
+}
+
+// NewFileInventoryStore creates an InventoryStore that keeps one JSON
+// file per project and kind of resource in dir
+func NewFileInventoryStore(dir string) InventoryStore {
+	return fileInventoryStore{dir: dir}
+}
+
+func (s fileInventoryStore) filename(project, kind string) string {
+	return filepath.Join(s.dir, project+`.`+kind+`.inventory.json`)
+}
+
+func (s fileInventoryStore) LoadInventoryCount(ctx context.Context, project, kind string) (*InventoryCount, error) {
+	buf, err := ioutil.ReadFile(s.filename(project, kind))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, `failed to read inventory count`)
+	}
+
+	var ic InventoryCount
+	if err := json.Unmarshal(buf, &ic); err != nil {
+		return nil, errors.Wrap(err, `failed to decode inventory count`)
+	}
+	return &ic, nil
+}
+
+func (s fileInventoryStore) SaveInventoryCount(ctx context.Context, ic *InventoryCount) error {
+	buf, err := json.Marshal(ic)
+	if err != nil {
+		return errors.Wrap(err, `failed to encode inventory count`)
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return errors.Wrap(err, `failed to create inventory directory`)
+	}
+
+	filename := s.filename(ic.Project, ic.Kind)
+	tmp := filename + `.tmp`
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return errors.Wrap(err, `failed to write inventory count`)
+	}
+	return errors.Wrap(os.Rename(tmp, filename), `failed to rename inventory count`)
+}
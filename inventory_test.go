@@ -0,0 +1,158 @@
+package autolbclean_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsInventoryDrop(t *testing.T) {
+	list := []struct {
+		Previous int
+		Current  int
+		Expected bool
+	}{
+		{Previous: 20, Current: 0, Expected: true},
+		{Previous: 20, Current: 9, Expected: true},
+		{Previous: 20, Current: 10, Expected: false},
+		{Previous: 20, Current: 30, Expected: false},
+		{Previous: 3, Current: 0, Expected: false}, // too few to tell
+	}
+	for _, c := range list {
+		if !assert.Equal(t, c.Expected, autolbclean.IsInventoryDrop(c.Previous, c.Current, 0.5), `%d -> %d`, c.Previous, c.Current) {
+			return
+		}
+	}
+
+	if !assert.False(t, autolbclean.IsInventoryDrop(20, 0, 0), `a threshold of 0 should disable the check`) {
+		return
+	}
+}
+
+func TestFileInventoryStore(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `inventory`)
+	if !assert.NoError(t, err, `TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	store := autolbclean.NewFileInventoryStore(dir)
+
+	ic, err := store.LoadInventoryCount(ctx, `p`, autolbclean.KindForwardingRules)
+	if !assert.NoError(t, err, `loading a missing count should succeed`) {
+		return
+	}
+	if !assert.Nil(t, ic, `missing count should be nil`) {
+		return
+	}
+
+	saved := &autolbclean.InventoryCount{
+		Project: `p`,
+		Kind:    autolbclean.KindForwardingRules,
+		Count:   42,
+		TakenAt: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+	}
+	if !assert.NoError(t, store.SaveInventoryCount(ctx, saved), `SaveInventoryCount should succeed`) {
+		return
+	}
+
+	ic, err = store.LoadInventoryCount(ctx, `p`, autolbclean.KindForwardingRules)
+	if !assert.NoError(t, err, `LoadInventoryCount should succeed`) {
+		return
+	}
+	if !assert.Equal(t, saved, ic, `count should round trip`) {
+		return
+	}
+}
+
+func TestInventoryDrop(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `inventory`)
+	if !assert.NoError(t, err, `TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	fake := fakeCompute{
+		`aggregated/targetHttpProxies`:  map[string]interface{}{},
+		`aggregated/targetHttpsProxies`: map[string]interface{}{},
+		`global/targetGrpcProxies`:      map[string]interface{}{},
+		`aggregated/urlMaps`:            map[string]interface{}{},
+	}
+	c, err := autolbclean.ParseConfig([]byte("retry:\n  read:\n    base_delay: 0s\n    max_delay: 1ms\n"))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+
+	ctx := context.Background()
+	store := autolbclean.NewFileInventoryStore(dir)
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake}, autolbclean.WithConfig(c), autolbclean.WithInventoryStore(store))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	saved := &autolbclean.InventoryCount{Project: `p`, Kind: autolbclean.KindUrlMaps, Count: 20}
+	if !assert.NoError(t, store.SaveInventoryCount(ctx, saved), `SaveInventoryCount should succeed`) {
+		return
+	}
+
+	// every url map is gone all of a sudden
+	_, err = app.ListDanglingUrlMaps(ctx)
+	if !assert.True(t, autolbclean.IsInventoryDropError(err), `the drop should hold back the check`) {
+		return
+	}
+	ic, err := store.LoadInventoryCount(ctx, `p`, autolbclean.KindUrlMaps)
+	if !assert.NoError(t, err, `LoadInventoryCount should succeed`) || !assert.Equal(t, 20, ic.Count, `the count of a drop should not become the baseline`) {
+		return
+	}
+
+	if !assert.NoError(t, app.ResetInventory(ctx, autolbclean.KindUrlMaps), `ResetInventory should succeed`) {
+		return
+	}
+	if _, err := app.ListDanglingUrlMaps(ctx); !assert.NoError(t, err, `the check should go ahead once the inventory is reset`) {
+		return
+	}
+}
+
+func TestPreviewOrphans(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `inventory`)
+	if !assert.NoError(t, err, `TempDir should succeed`) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	fake := fakeCompute{
+		`aggregated/forwardingRules`:    map[string]interface{}{},
+		`aggregated/targetHttpProxies`:  map[string]interface{}{},
+		`aggregated/targetHttpsProxies`: map[string]interface{}{},
+	}
+
+	ctx := context.Background()
+	store := autolbclean.NewFileInventoryStore(dir)
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake}, autolbclean.WithInventoryStore(store))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	if _, err := app.PreviewOrphans(ctx); !assert.NoError(t, err, `PreviewOrphans should succeed`) {
+		return
+	}
+	ic, err := store.LoadInventoryCount(ctx, `p`, autolbclean.KindForwardingRules)
+	if !assert.NoError(t, err, `LoadInventoryCount should succeed`) || !assert.Nil(t, ic, `a preview should not save the count`) {
+		return
+	}
+
+	if _, err := app.FindOrphans(ctx); !assert.NoError(t, err, `FindOrphans should succeed`) {
+		return
+	}
+	ic, err = store.LoadInventoryCount(ctx, `p`, autolbclean.KindForwardingRules)
+	if !assert.NoError(t, err, `LoadInventoryCount should succeed`) || !assert.NotNil(t, ic, `a run should save the count`) {
+		return
+	}
+}
@@ -0,0 +1,80 @@
+package autolbclean
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	container "google.golang.org/api/container/v1"
+)
+
+// minClusterUIDLength is the shortest UID that is matched against the
+// beginning of a cluster ID. Anything shorter is too likely to match
+// by chance
+const minClusterUIDLength = 8
+
+// MatchClusterUID returns true if uid, as found in the names of the
+// resources a cluster creates, identifies the cluster with the given ID.
+// The ingress controller names its resources after the uid key of the
+// ingress-uid ConfigMap in kube-system, which GKE sets to the first 16
+// characters of the cluster ID. The k8s1- and k8s2- names only carry the
+// first 8 of those, which still match as a prefix of the ID
+func MatchClusterUID(uid, id string) bool {
+	if len(uid) < minClusterUIDLength {
+		return false
+	}
+	return strings.HasPrefix(id, uid)
+}
+
+// liveClusters lists the GKE clusters that exist in the project
+func (app *App) liveClusters(ctx context.Context) ([]*container.Cluster, error) {
+	listCtx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	clusters, err := app.container.Projects.Locations.Clusters.List(`projects/` + app.project + `/locations/-`).Context(listCtx).Do()
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list GKE clusters`)
+	}
+	return clusters.Clusters, nil
+}
+
+// liveClusterOf returns the name of the cluster in clusters that uid
+// identifies, or an empty string if there is none
+func liveClusterOf(uid string, clusters []*container.Cluster) string {
+	for _, cluster := range clusters {
+		if MatchClusterUID(uid, cluster.Id) {
+			return cluster.Name
+		}
+	}
+	return ``
+}
+
+// ownedByLiveCluster returns true if the name of the resource carries
+// the UID of one of the clusters, or the prefix of it
+func (c *Config) ownedByLiveCluster(name string, clusters []*container.Cluster) bool {
+	return len(liveClusterOf(c.clusterPrefixOf(name), clusters)) > 0
+}
+
+// skipLiveClusters drops the orphans that belong to a GKE cluster that
+// still exists. A healthy cluster can have no instances at all, e.g.
+// when its node pools are scaled to zero
+func (app *App) skipLiveClusters(ctx context.Context, orphans []*Orphan) ([]*Orphan, error) {
+	clusters, err := app.liveClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := app.Config()
+	var result []*Orphan
+	for _, o := range orphans {
+		uid := o.Cluster
+		if len(uid) == 0 {
+			uid = c.ClusterOf(o.TargetProxy)
+		}
+		if len(liveClusterOf(uid, clusters)) > 0 {
+			continue
+		}
+		result = append(result, o)
+	}
+	return result, nil
+}
@@ -0,0 +1,143 @@
+package autolbclean
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/appengine"
+)
+
+// Severities of log entries, as Cloud Logging names them
+const (
+	SeverityDebug   = `DEBUG`
+	SeverityInfo    = `INFO`
+	SeverityWarning = `WARNING`
+)
+
+// Formats that the App Engine app writes its logs in
+const (
+	LogFormatJSON      = `json`
+	LogFormatAppEngine = `appengine`
+)
+
+// ParseLogFormat validates the name of a log format. An empty name
+// selects the App Engine log API when running on App Engine, which is
+// the only one that the first generation runtimes collect, and JSON
+// anywhere else
+func ParseLogFormat(s string) (string, error) {
+	switch s {
+	case ``:
+		if appengine.IsAppEngine() {
+			return LogFormatAppEngine, nil
+		}
+		return LogFormatJSON, nil
+	case LogFormatJSON, LogFormatAppEngine:
+		return s, nil
+	}
+	return ``, errors.Errorf(`invalid log format %q (expected json or appengine)`, s)
+}
+
+var muLogger sync.RWMutex
+var logger Logger = NewJSONLogger(os.Stderr)
+
+// SetLogger replaces the logger that log entries are written to. The
+// default writes them to stderr as JSON, which leaves stdout to the
+// output of the command line tool
+func SetLogger(l Logger) {
+	muLogger.Lock()
+	defer muLogger.Unlock()
+	logger = l
+}
+
+func currentLogger() Logger {
+	muLogger.RLock()
+	defer muLogger.RUnlock()
+	return logger
+}
+
+type jsonLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLogger creates a logger that writes each entry as a line of
+// JSON, which Cloud Logging turns into a structured log entry when it
+// comes from the stdout or the stderr of Cloud Run, GKE or the second
+// generation App Engine runtimes
+func NewJSONLogger(w io.Writer) Logger {
+	return &jsonLogger{enc: json.NewEncoder(w)}
+}
+
+func (l *jsonLogger) Log(_ context.Context, e *LogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(e)
+}
+
+type logFieldsKey struct{}
+
+// logFields returns the fields that the entries logged with the context
+// carry
+func logFields(ctx context.Context) LogEntry {
+	if fields, ok := ctx.Value(logFieldsKey{}).(LogEntry); ok {
+		return fields
+	}
+	return LogEntry{}
+}
+
+// withRunID returns a context whose log entries carry the given run ID
+func withRunID(ctx context.Context, id string) context.Context {
+	fields := logFields(ctx)
+	fields.RunID = id
+	return context.WithValue(ctx, logFieldsKey{}, fields)
+}
+
+// withResource returns a context whose log entries carry the kind and
+// the name of the given resource
+func withResource(ctx context.Context, kind, name string) context.Context {
+	fields := logFields(ctx)
+	fields.ResourceType = kind
+	fields.ResourceName = name
+	return context.WithValue(ctx, logFieldsKey{}, fields)
+}
+
+// logf writes a log entry with the fields of the context, and makes
+// sure that nothing sensitive makes it into the logs
+func logf(ctx context.Context, severity, decision, format string, args ...interface{}) {
+	e := logFields(ctx)
+	e.Time = time.Now().UTC()
+	e.Severity = severity
+	e.Message = Redact(fmt.Sprintf(format, args...))
+	if len(decision) > 0 {
+		e.Decision = decision
+	}
+	currentLogger().Log(ctx, &e)
+}
+
+func debugf(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, SeverityDebug, ``, format, args...)
+}
+
+// decisionf logs a decision about a single resource, subject to the
+// sampling configured through DECISION_LOG_SAMPLING. The report and the
+// deletion events carry every decision regardless
+func decisionf(ctx context.Context, decision, kind, name string, format string, args ...interface{}) {
+	if !decisionSampling.Sampled(decision) {
+		return
+	}
+	logf(withResource(ctx, kind, name), SeverityDebug, decision, format, args...)
+}
+
+func infof(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, SeverityInfo, ``, format, args...)
+}
+
+func warningf(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, SeverityWarning, ``, format, args...)
+}
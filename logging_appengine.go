@@ -0,0 +1,46 @@
+package autolbclean
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/appengine/log"
+)
+
+type appengineLogger struct{}
+
+// NewAppEngineLogger creates a logger that writes entries through the
+// App Engine log API. The API has no room for structured fields, so
+// they are appended to the message
+func NewAppEngineLogger() Logger {
+	return appengineLogger{}
+}
+
+func (appengineLogger) Log(ctx context.Context, e *LogEntry) {
+	var fields []string
+	for _, f := range []struct{ name, value string }{
+		{`run`, e.RunID},
+		{`kind`, e.ResourceType},
+		{`name`, e.ResourceName},
+		{`decision`, e.Decision},
+	} {
+		if len(f.value) > 0 {
+			fields = append(fields, fmt.Sprintf(`%s = %s`, f.name, f.value))
+		}
+	}
+
+	msg := e.Message
+	if len(fields) > 0 {
+		msg += ` [` + strings.Join(fields, `, `) + `]`
+	}
+
+	switch e.Severity {
+	case SeverityWarning:
+		log.Warningf(ctx, "%s", msg)
+	case SeverityInfo:
+		log.Infof(ctx, "%s", msg)
+	default:
+		log.Debugf(ctx, "%s", msg)
+	}
+}
@@ -0,0 +1,73 @@
+package autolbclean_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := autolbclean.NewJSONLogger(&buf)
+	l.Log(context.Background(), &autolbclean.LogEntry{
+		Time:         time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC),
+		Severity:     autolbclean.SeverityDebug,
+		Message:      `Deleted forwardingRules k8s-fw-1 (region = global)`,
+		RunID:        `run-1`,
+		ResourceType: autolbclean.KindForwardingRules,
+		ResourceName: `k8s-fw-1`,
+		Decision:     autolbclean.DecisionDeleted,
+	})
+	l.Log(context.Background(), &autolbclean.LogEntry{
+		Time:     time.Date(2026, 10, 16, 9, 0, 1, 0, time.UTC),
+		Severity: autolbclean.SeverityWarning,
+		Message:  `Refusing request`,
+	})
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if !assert.Len(t, lines, 2, `each entry should be written on a line of its own`) {
+		return
+	}
+
+	var entry map[string]string
+	if !assert.NoError(t, json.Unmarshal(lines[0], &entry), `entries should be JSON`) {
+		return
+	}
+	expected := map[string]string{
+		`time`:          `2026-10-16T09:00:00Z`,
+		`severity`:      `DEBUG`,
+		`message`:       `Deleted forwardingRules k8s-fw-1 (region = global)`,
+		`run_id`:        `run-1`,
+		`resource_type`: autolbclean.KindForwardingRules,
+		`resource_name`: `k8s-fw-1`,
+		`decision`:      autolbclean.DecisionDeleted,
+	}
+	if !assert.Equal(t, expected, entry, `entries should carry their fields`) {
+		return
+	}
+
+	entry = nil
+	if !assert.NoError(t, json.Unmarshal(lines[1], &entry), `entries should be JSON`) {
+		return
+	}
+	if !assert.Len(t, entry, 3, `empty fields should be left out`) {
+		return
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	if v, err := autolbclean.ParseLogFormat(``); !assert.NoError(t, err) || !assert.Equal(t, autolbclean.LogFormatJSON, v, `JSON should be the default outside App Engine`) {
+		return
+	}
+	if v, err := autolbclean.ParseLogFormat(`json`); !assert.NoError(t, err) || !assert.Equal(t, autolbclean.LogFormatJSON, v) {
+		return
+	}
+	if _, err := autolbclean.ParseLogFormat(`xml`); !assert.Error(t, err, `unknown formats should be rejected`) {
+		return
+	}
+}
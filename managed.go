@@ -0,0 +1,105 @@
+package autolbclean
+
+import (
+	"context"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// Defaults of the label that opts load balancers that were built by
+// hand into the cleanup
+const (
+	DefaultManagedLabel = `auto-lb-clean`
+	DefaultManagedValue = `managed`
+)
+
+// IsManaged returns true if the resource opted into the cleanup, either
+// through its labels, or, for the resources that can not be labeled,
+// through LABEL=VALUE in its description. Nothing opts in unless
+// managed load balancers are enabled
+func (c *Config) IsManaged(labels map[string]string, description string) bool {
+	m := c.Managed
+	if !m.Enabled {
+		return false
+	}
+	return hasMarker(m.Label, m.Value, labels, description)
+}
+
+// isDeletable returns true if the resource of d may be deleted.
+// Resources that opted into the cleanup are known by their markers, and
+// are not held to the names that GKE uses. The marker is looked up on
+// the resource itself, as nothing in the job can be trusted to tell
+func (app *App) isDeletable(ctx context.Context, d *Deletion) (bool, error) {
+	c := app.Config()
+	if c.IsDeletableName(d.Kind, d.Name) {
+		return true, nil
+	}
+	if !c.Managed.Enabled {
+		return false, nil
+	}
+
+	labels, description, err := app.resourceMarkers(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	return c.IsManaged(labels, description), nil
+}
+
+// resourceMarkers fetches the resource that d deletes, and returns the
+// labels and the description that markers are looked for in. Kinds
+// that can not opt into the cleanup have neither
+func (app *App) resourceMarkers(ctx context.Context, d *Deletion) (map[string]string, string, error) {
+	switch d.Kind {
+	case KindForwardingRules:
+		fwr, err := app.getForwardingRule(ctx, d.Region, d.Name)
+		if err != nil {
+			return nil, ``, err
+		}
+		return fwr.Labels, fwr.Description, nil
+	case KindTargetHttpProxies:
+		tp, err := app.getTargetHttpProxy(ctx, d.Region, d.Name)
+		if err != nil {
+			return nil, ``, err
+		}
+		return nil, tp.Description, nil
+	case KindTargetHttpsProxies:
+		tp, err := app.getTargetHttpsProxy(ctx, d.Region, d.Name)
+		if err != nil {
+			return nil, ``, err
+		}
+		return nil, tp.Description, nil
+	case KindUrlMaps:
+		um, err := app.getUrlMap(ctx, d.Region, d.Name)
+		if err != nil {
+			return nil, ``, err
+		}
+		return nil, um.Description, nil
+	case KindBackendServices:
+		s, err := app.getBackendService(ctx, d.Region, d.Name)
+		if err != nil {
+			return nil, ``, err
+		}
+		return nil, s.Description, nil
+	case KindSslCertificates:
+		cert, err := app.getSslCertificate(ctx, d.Region, d.Name)
+		if err != nil {
+			return nil, ``, err
+		}
+		return nil, cert.Description, nil
+	case KindHealthChecks:
+		ctx, cancel := app.getContext(ctx)
+		defer cancel()
+		var hc *compute.HealthCheck
+		var err error
+		if isGlobal(d.Region) {
+			hc, err = app.service.HealthChecks.Get(app.project, d.Name).Context(ctx).Do()
+		} else {
+			hc, err = app.service.RegionHealthChecks.Get(app.project, d.Region, d.Name).Context(ctx).Do()
+		}
+		if err != nil {
+			return nil, ``, err
+		}
+		return nil, hc.Description, nil
+	}
+	return nil, ``, nil
+}
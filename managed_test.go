@@ -0,0 +1,62 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsManaged(t *testing.T) {
+	c := autolbclean.DefaultConfig()
+	if !assert.False(t, c.IsManaged(map[string]string{`auto-lb-clean`: `managed`}, ``), `nothing should opt in unless enabled`) {
+		return
+	}
+
+	c, err := autolbclean.ParseConfig([]byte("managed:\n  enabled: true\n"))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+	if !assert.True(t, c.IsManaged(map[string]string{`auto-lb-clean`: `managed`}, ``), `label should opt in`) {
+		return
+	}
+	if !assert.True(t, c.IsManaged(nil, `staging lb, auto-lb-clean=managed`), `description should opt in`) {
+		return
+	}
+	if !assert.False(t, c.IsManaged(map[string]string{`auto-lb-clean`: `manual`}, ``), `other values should not opt in`) {
+		return
+	}
+
+	if _, err := autolbclean.ParseConfig([]byte("managed:\n  enabled: true\n  label: \"\"\n")); !assert.Error(t, err, `an empty label should be rejected`) {
+		return
+	}
+}
+
+func TestManagedDeletions(t *testing.T) {
+	o := &autolbclean.Orphan{
+		ForwardingRule: `staging-lb-fr`,
+		TargetProxy:    `staging-lb-proxy`,
+		UrlMap:         `staging-lb`,
+		Managed:        true,
+	}
+	head := autolbclean.ChainDeletions(o.Deletions())
+	if !assert.True(t, head.Managed, `deletions should be marked as managed`) {
+		return
+	}
+
+	// delete jobs look for the marker on the resource itself, so that
+	// it can not be forged through the parameters of the job
+	task := autolbclean.DeletionTask(head, `2026-10-16T00:00:00Z`)
+	if !assert.Empty(t, task.Params.Get(`managed`), `the job should not carry the marker`) {
+		return
+	}
+	next, err := autolbclean.ParseDeletionChain(task.Params.Get(`next`))
+	if !assert.NoError(t, err, `parsing the chain should succeed`) {
+		return
+	}
+	for _, d := range next {
+		if !assert.False(t, d.Managed, `the rest of the chain should not carry the marker`) {
+			return
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package autolbclean
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// multiClusterIngressConvention names the resources that Multi Cluster
+// Ingress creates for MultiClusterIngress (mci-) and MultiClusterService
+// (mcs-) objects. It is added to the cluster conventions when the
+// multi-cluster profile is enabled
+var multiClusterIngressConvention = &ClusterConvention{
+	UID:                    `multi-cluster-ingress`,
+	ForwardingRulePrefixes: []string{`mci-`},
+	TargetProxyPrefixes:    []string{`mci-`},
+	HealthCheckPrefixes:    []string{`mci-`, `mcs-`},
+	BackendServicePrefixes: []string{`mci-`, `mcs-`},
+	AddressPrefixes:        []string{`mci-`},
+}
+
+var clusterNamePattern = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/clusters/[^/]+$`)
+
+func validateMultiClusterIngress(mc MultiClusterIngressConfig) error {
+	if !mc.Enabled {
+		return nil
+	}
+	if len(mc.ConfigClusters) == 0 {
+		return errors.New(`config_clusters is required`)
+	}
+	for _, name := range mc.ConfigClusters {
+		if !clusterNamePattern.MatchString(name) {
+			return errors.Errorf(`invalid config cluster %s, expected projects/PROJECT/locations/LOCATION/clusters/CLUSTER`, name)
+		}
+	}
+	return nil
+}
+
+// conventions returns the cluster conventions of the configuration,
+// including the one of the multi-cluster profile when it is enabled
+func (c *Config) conventions() []*ClusterConvention {
+	if !c.MultiClusterIngress.Enabled {
+		return c.Clusters
+	}
+	return append(append([]*ClusterConvention(nil), c.Clusters...), multiClusterIngressConvention)
+}
+
+// IsMultiClusterResource returns true if the name is one given by Multi
+// Cluster Ingress
+func IsMultiClusterResource(name string) bool {
+	for _, prefixes := range multiClusterIngressConvention.prefixes() {
+		if hasAnyPrefix(name, prefixes) {
+			return true
+		}
+	}
+	return false
+}
+
+// projectOf returns the project in the URL of a resource, or the
+// project of the app if the URL does not name one. Multi Cluster
+// Ingress may send traffic to network endpoint groups in the projects
+// of the member clusters
+func (app *App) projectOf(s string) string {
+	i := strings.Index(s, `/projects/`)
+	if i < 0 {
+		return app.project
+	}
+	s = s[i+len(`/projects/`):]
+	if i := strings.Index(s, `/`); i >= 0 {
+		s = s[:i]
+	}
+	if len(s) == 0 {
+		return app.project
+	}
+	return s
+}
+
+// multiClusterIngressOwned returns true unless every config cluster of
+// Multi Cluster Ingress is known to be gone. The config clusters usually
+// live in another project than the load balancers, so they are looked
+// up by name. A cluster that can not be looked up is assumed to exist
+func (app *App) multiClusterIngressOwned(ctx context.Context) bool {
+	for _, name := range app.Config().MultiClusterIngress.ConfigClusters {
+		getCtx, cancel := app.getContext(ctx)
+		_, err := app.container.Projects.Locations.Clusters.Get(name).Context(getCtx).Do()
+		cancel()
+
+		if isNotFound(err) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// multiClusterOwned returns a function that reports whether the named
+// resource was created by Multi Cluster Ingress, and is still owned by
+// one of its config clusters. The config clusters are looked up once,
+// and only if there is such a resource
+func (app *App) multiClusterOwned(ctx context.Context) func(name string) bool {
+	enabled := app.Config().MultiClusterIngress.Enabled
+	var owned, checked bool
+	return func(name string) bool {
+		if !enabled || !IsMultiClusterResource(name) {
+			return false
+		}
+		if !checked {
+			owned = app.multiClusterIngressOwned(ctx)
+			checked = true
+		}
+		return owned
+	}
+}
+
+// skipOwnedMultiCluster drops the orphans created by Multi Cluster
+// Ingress while any of its config clusters still exists, as these may
+// well be in use by clusters in other projects
+func (app *App) skipOwnedMultiCluster(ctx context.Context, orphans []*Orphan) []*Orphan {
+	owned := app.multiClusterOwned(ctx)
+	var result []*Orphan
+	for _, o := range orphans {
+		if owned(o.TargetProxy) {
+			continue
+		}
+		result = append(result, o)
+	}
+	return result
+}
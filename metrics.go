@@ -0,0 +1,100 @@
+package autolbclean
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+// Metrics that are written to Cloud Monitoring at the end of each run,
+// when enabled
+const (
+	OrphansDetectedMetric  = `custom.googleapis.com/autolbclean/orphans_detected`
+	DeletedResourcesMetric = `custom.googleapis.com/autolbclean/deleted_resources`
+)
+
+// RunMetrics returns the metrics of the one-shot worker run. In plan
+// only mode, nothing was deleted
+func (r *WorkerResult) RunMetrics() *RunMetrics {
+	m := &RunMetrics{
+		Orphans: r.Orphans,
+		Deleted: make(map[string]int),
+	}
+	for _, dr := range r.Deletions {
+		if dr.Deleted {
+			m.Deleted[dr.Kind]++
+		}
+	}
+	return m
+}
+
+// DeletionRecordMetrics returns the metrics of a run that found the
+// given number of orphans, counting the deletions in the records
+func DeletionRecordMetrics(orphans int, records []*DeletionRecord) *RunMetrics {
+	m := &RunMetrics{
+		Orphans: orphans,
+		Deleted: make(map[string]int),
+	}
+	for _, r := range records {
+		m.Deleted[r.Kind]++
+	}
+	return m
+}
+
+func sortedKinds(counts map[string]int) []string {
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// WriteRunMetrics writes the number of orphans detected, and the number
+// of resources of each kind that were deleted, to Cloud Monitoring in
+// the project being cleaned up. Kinds that nothing was deleted of are
+// left out, while the number of orphans is always written, so that an
+// alert can fire when runs stop reporting
+func (app *App) WriteRunMetrics(ctx context.Context, m *RunMetrics) error {
+	svc, err := monitoring.New(app.client)
+	if err != nil {
+		return errors.Wrap(err, `failed to create monitoring.Service`)
+	}
+
+	now := &monitoring.TimeInterval{EndTime: time.Now().UTC().Format(time.RFC3339)}
+	resource := &monitoring.MonitoredResource{
+		Type:   `global`,
+		Labels: map[string]string{`project_id`: app.project},
+	}
+
+	orphans := int64(m.Orphans)
+	series := []*monitoring.TimeSeries{
+		{
+			Metric:   &monitoring.Metric{Type: OrphansDetectedMetric},
+			Resource: resource,
+			Points:   []*monitoring.Point{{Interval: now, Value: &monitoring.TypedValue{Int64Value: &orphans}}},
+		},
+	}
+	for _, kind := range sortedKinds(m.Deleted) {
+		deleted := int64(m.Deleted[kind])
+		series = append(series, &monitoring.TimeSeries{
+			Metric: &monitoring.Metric{
+				Type:   DeletedResourcesMetric,
+				Labels: map[string]string{`kind`: kind},
+			},
+			Resource: resource,
+			Points:   []*monitoring.Point{{Interval: now, Value: &monitoring.TypedValue{Int64Value: &deleted}}},
+		})
+	}
+
+	_, err = svc.Projects.TimeSeries.Create(`projects/`+app.project, &monitoring.CreateTimeSeriesRequest{
+		TimeSeries: series,
+	}).Context(ctx).Do()
+	if err != nil {
+		return errors.Wrap(err, `failed to write run metrics`)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunMetrics(t *testing.T) {
+	result := &autolbclean.WorkerResult{
+		Orphans: 2,
+		Deletions: []*autolbclean.DeletionResult{
+			{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-1`, Deleted: true},
+			{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-2`, Deleted: true},
+			{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-1`, Error: `denied`},
+			{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-2`},
+		},
+	}
+	m := result.RunMetrics()
+	if !assert.Equal(t, 2, m.Orphans, `orphans should match`) {
+		return
+	}
+	if !assert.Equal(t, map[string]int{autolbclean.KindForwardingRules: 2}, m.Deleted, `only deleted resources should be counted`) {
+		return
+	}
+
+	m = autolbclean.DeletionRecordMetrics(1, []*autolbclean.DeletionRecord{
+		{Kind: autolbclean.KindBackendServices, Name: `k8s-be-30000`},
+		{Kind: autolbclean.KindHealthChecks, Name: `k8s-be-30000`},
+	})
+	if !assert.Equal(t, map[string]int{autolbclean.KindBackendServices: 1, autolbclean.KindHealthChecks: 1}, m.Deleted, `recorded deletions should be counted`) {
+		return
+	}
+}
@@ -0,0 +1,189 @@
+package autolbclean
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	dashboards "google.golang.org/api/monitoring/v1"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+// DefaultCanaryInterval is how often the canary is assumed to run when
+// the monitoring options do not say
+const DefaultCanaryInterval = 6 * time.Hour
+
+// absence conditions can not look back further than a day
+const maxAbsenceDuration = 24 * time.Hour
+
+const (
+	dashboardName        = `autolbclean`
+	canaryUnhealthyAlert = `autolbclean: canary not cleaned up in time`
+	canaryMissingAlert   = `autolbclean: canary not reporting`
+)
+
+func metricFilter(metric string) string {
+	return fmt.Sprintf(`metric.type="%s" AND resource.type="global"`, metric)
+}
+
+func durationString(d time.Duration) string {
+	return fmt.Sprintf(`%ds`, int64(d.Seconds()))
+}
+
+func chartWidget(title, metric, aligner, label string) *dashboards.Widget {
+	return &dashboards.Widget{
+		Title: title,
+		XyChart: &dashboards.XyChart{
+			DataSets: []*dashboards.DataSet{
+				{
+					PlotType: `LINE`,
+					TimeSeriesQuery: &dashboards.TimeSeriesQuery{
+						TimeSeriesFilter: &dashboards.TimeSeriesFilter{
+							Filter: metricFilter(metric),
+							Aggregation: &dashboards.Aggregation{
+								AlignmentPeriod:  `3600s`,
+								PerSeriesAligner: aligner,
+							},
+						},
+					},
+				},
+			},
+			YAxis: &dashboards.Axis{Label: label, Scale: `LINEAR`},
+		},
+	}
+}
+
+// MonitoringDashboard returns the Cloud Monitoring dashboard that charts
+// the metrics reported by the canary and by each run
+func MonitoringDashboard() *dashboards.Dashboard {
+	return &dashboards.Dashboard{
+		DisplayName: dashboardName,
+		GridLayout: &dashboards.GridLayout{
+			Columns: 2,
+			Widgets: []*dashboards.Widget{
+				chartWidget(`Canary health`, canaryHealthyMetric, `ALIGN_MIN`, `healthy`),
+				chartWidget(`Canary cleanup time`, canaryLatencyMetric, `ALIGN_MAX`, `seconds`),
+				chartWidget(`Orphans detected`, OrphansDetectedMetric, `ALIGN_MAX`, `load balancers`),
+				chartWidget(`Deleted resources`, DeletedResourcesMetric, `ALIGN_SUM`, `resources`),
+			},
+		},
+	}
+}
+
+// MonitoringAlertPolicies returns the alert policies that fire when the
+// canary was not cleaned up in time, or has stopped reporting
+func MonitoringAlertPolicies(opts *MonitoringOptions) []*monitoring.AlertPolicy {
+	interval := opts.CanaryInterval
+	if interval <= 0 {
+		interval = DefaultCanaryInterval
+	}
+	absence := 2 * interval
+	if absence > maxAbsenceDuration {
+		absence = maxAbsenceDuration
+	}
+
+	return []*monitoring.AlertPolicy{
+		{
+			DisplayName: canaryUnhealthyAlert,
+			Combiner:    `OR`,
+			Documentation: &monitoring.Documentation{
+				MimeType: `text/markdown`,
+				Content:  `The canary load balancer was not deleted before its deadline. Orphaned load balancers are probably piling up: check the logs of the cleaner, and whether it is paused.`,
+			},
+			Conditions: []*monitoring.Condition{
+				{
+					DisplayName: `canary_healthy < 1`,
+					ConditionThreshold: &monitoring.MetricThreshold{
+						Filter:         metricFilter(canaryHealthyMetric),
+						Comparison:     `COMPARISON_LT`,
+						ThresholdValue: 1,
+						Duration:       `0s`,
+						Aggregations: []*monitoring.Aggregation{
+							{AlignmentPeriod: `300s`, PerSeriesAligner: `ALIGN_MIN`},
+						},
+					},
+				},
+			},
+			NotificationChannels: opts.NotificationChannels,
+		},
+		{
+			DisplayName: canaryMissingAlert,
+			Combiner:    `OR`,
+			Documentation: &monitoring.Documentation{
+				MimeType: `text/markdown`,
+				Content:  `The canary has not reported an outcome for ` + absence.String() + `. The standalone daemon that runs it may be down.`,
+			},
+			Conditions: []*monitoring.Condition{
+				{
+					DisplayName: `canary_healthy absent`,
+					ConditionAbsent: &monitoring.MetricAbsence{
+						Filter:   metricFilter(canaryHealthyMetric),
+						Duration: durationString(absence),
+						Aggregations: []*monitoring.Aggregation{
+							{AlignmentPeriod: `300s`, PerSeriesAligner: `ALIGN_COUNT`},
+						},
+					},
+				},
+			},
+			NotificationChannels: opts.NotificationChannels,
+		},
+	}
+}
+
+// InstallMonitoring creates the dashboard and the alert policies in the
+// project, or updates them if they already exist. They are identified by
+// their display names, so running it again does not create duplicates
+func (app *App) InstallMonitoring(ctx context.Context, opts *MonitoringOptions) error {
+	parent := `projects/` + app.project
+
+	dsvc, err := dashboards.New(app.client)
+	if err != nil {
+		return errors.Wrap(err, `failed to create dashboards service`)
+	}
+
+	dashboard := MonitoringDashboard()
+	var existing *dashboards.Dashboard
+	err = dsvc.Projects.Dashboards.List(parent).Pages(ctx, func(l *dashboards.ListDashboardsResponse) error {
+		for _, d := range l.Dashboards {
+			if d.DisplayName == dashboard.DisplayName {
+				existing = d
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, `failed to list dashboards`)
+	}
+	if existing != nil {
+		dashboard.Name = existing.Name
+		dashboard.Etag = existing.Etag
+		_, err = dsvc.Projects.Dashboards.Patch(existing.Name, dashboard).Context(ctx).Do()
+	} else {
+		_, err = dsvc.Projects.Dashboards.Create(parent, dashboard).Context(ctx).Do()
+	}
+	if err != nil {
+		return errors.Wrap(err, `failed to save dashboard`)
+	}
+
+	msvc, err := monitoring.New(app.client)
+	if err != nil {
+		return errors.Wrap(err, `failed to create monitoring.Service`)
+	}
+
+	for _, policy := range MonitoringAlertPolicies(opts) {
+		l, err := msvc.Projects.AlertPolicies.List(parent).Filter(fmt.Sprintf(`display_name=%q`, policy.DisplayName)).Context(ctx).Do()
+		if err != nil {
+			return errors.Wrap(err, `failed to list alert policies`)
+		}
+		if len(l.AlertPolicies) > 0 {
+			_, err = msvc.Projects.AlertPolicies.Patch(l.AlertPolicies[0].Name, policy).Context(ctx).Do()
+		} else {
+			_, err = msvc.Projects.AlertPolicies.Create(parent, policy).Context(ctx).Do()
+		}
+		if err != nil {
+			return errors.Wrapf(err, `failed to save alert policy %q`, policy.DisplayName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package autolbclean_test
+
+import (
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitoringAlertPolicies(t *testing.T) {
+	channels := []string{`projects/p/notificationChannels/123`}
+	policies := autolbclean.MonitoringAlertPolicies(&autolbclean.MonitoringOptions{
+		CanaryInterval:       time.Hour,
+		NotificationChannels: channels,
+	})
+	if !assert.Len(t, policies, 2) {
+		return
+	}
+	for _, p := range policies {
+		if !assert.Equal(t, channels, p.NotificationChannels, `alerts should go to the channels`) {
+			return
+		}
+	}
+	if !assert.Equal(t, `7200s`, policies[1].Conditions[0].ConditionAbsent.Duration, `absence should be twice the interval`) {
+		return
+	}
+
+	policies = autolbclean.MonitoringAlertPolicies(&autolbclean.MonitoringOptions{CanaryInterval: 24 * time.Hour})
+	if !assert.Equal(t, `86400s`, policies[1].Conditions[0].ConditionAbsent.Duration, `absence should be capped at a day`) {
+		return
+	}
+}
@@ -0,0 +1,92 @@
+package autolbclean
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// serviceLoadBalancerPattern matches the names that GKE gives the target
+// pools, forwarding rules and health checks of LoadBalancer services:
+// an "a" followed by the UID of the service, truncated to 32 characters
+var serviceLoadBalancerPattern = `a` + strings.Repeat(`[0-9a-f]`, 31)
+
+// defaultNamePatterns are the names (as in path.Match) that GKE, Multi
+// Cluster Ingress and ManagedCertificate give the resources of each
+// kind. Delete jobs refuse to delete resources whose names match none
+// of them, nor any of the prefixes in the configuration. The firewall
+// rules that GKE creates for the nodes of a cluster
+// (gke-$cluster-$hash-all, -ssh, -vms) are not those of load balancers,
+// and are left out
+var defaultNamePatterns = map[string][]string{
+	KindForwardingRules:       {`k8s-fw-*`, `k8s2-fr-*`, `mci-*`, serviceLoadBalancerPattern},
+	KindTargetHttpProxies:     {`k8s-tp*`, `k8s2-tp-*`, `mci-*`},
+	KindTargetHttpsProxies:    {`k8s-tp*`, `k8s2-ts-*`, `mci-*`},
+	KindUrlMaps:               {`k8s-um-*`, `k8s2-um-*`, `mci-*`},
+	KindBackendServices:       {`k8s-be-*`, `k8s1-*`, `k8s2-*`, `mci-*`, `mcs-*`},
+	KindHealthChecks:          {`k8s-*`, `k8s1-*`, `k8s2-*`, `mci-*`, `mcs-*`, serviceLoadBalancerPattern},
+	KindHttpHealthChecks:      {`k8s-*`, `k8s1-*`, serviceLoadBalancerPattern},
+	KindHttpsHealthChecks:     {`k8s-*`, `k8s1-*`},
+	KindSslCertificates:       {`k8s-ssl-*`, `k8s2-cr-*`, `mcrt-*`},
+	KindTargetPools:           {serviceLoadBalancerPattern},
+	KindInstanceGroups:        {`k8s-ig--*`},
+	KindNetworkEndpointGroups: {`k8s1-*`},
+	KindAddresses:             {`k8s-fw-*`, `k8s2-fr-*`, `mci-*`},
+	KindFirewalls:             {`k8s-*`, `k8s2-*`},
+}
+
+// configuredPrefixes returns the name prefixes that the configuration
+// looks for in resources of the given kind
+func (c *Config) configuredPrefixes(kind string) []string {
+	switch kind {
+	case KindForwardingRules:
+		return c.forwardingRulePrefixes()
+	case KindTargetHttpProxies, KindTargetHttpsProxies:
+		return c.targetProxyPrefixes()
+	case KindBackendServices:
+		return c.backendServicePrefixes()
+	case KindHealthChecks, KindHttpHealthChecks, KindHttpsHealthChecks:
+		return c.healthCheckPrefixes()
+	case KindAddresses:
+		return c.addressPrefixes()
+	}
+	return nil
+}
+
+// IsDeletableName returns true if a resource of the given kind with the
+// given name looks like one that this tool cleans up. The patterns in
+// name_patterns replace the defaults of their kind. Otherwise, the
+// names given by GKE and those with the prefixes in the configuration
+// are deletable. Nothing of a kind without any pattern, such as those
+// of custom cleaners, is deletable until name_patterns lists some
+func (c *Config) IsDeletableName(kind, name string) bool {
+	patterns, ok := c.NamePatterns[kind]
+	if !ok {
+		patterns = defaultNamePatterns[kind]
+		if hasAnyPrefix(name, c.configuredPrefixes(kind)) {
+			return true
+		}
+	}
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func validateNamePatterns(patterns map[string][]string) error {
+	for kind, list := range patterns {
+		if _, ok := LookupCleaner(kind); !ok {
+			return errors.Errorf(`unknown resource kind %s`, kind)
+		}
+		for _, pattern := range list {
+			if _, err := path.Match(pattern, ``); err != nil {
+				return errors.Wrapf(err, `invalid pattern %s for %s`, pattern, kind)
+			}
+		}
+	}
+	return nil
+}
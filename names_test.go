@@ -0,0 +1,60 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDeletableName(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+clusters:
+  - uid: "c4f34d3824aedd50"
+    backend_service_prefixes: [ "acme-be-" ]
+name_patterns:
+  sslCertificates: [ "acme-cert-*" ]
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+
+	if !assert.True(t, c.IsDeletableName(autolbclean.KindUrlMaps, `k8s-um-default-apiserver--c4f34d3824aedd50`), `GKE url maps should be deletable`) {
+		return
+	}
+	if !assert.True(t, c.IsDeletableName(autolbclean.KindTargetPools, `a0123456789abcdef0123456789abcde`), `target pools of services should be deletable`) {
+		return
+	}
+	if !assert.False(t, c.IsDeletableName(autolbclean.KindUrlMaps, `prod-lb`), `hand made url maps should not be deletable`) {
+		return
+	}
+	if !assert.True(t, c.IsDeletableName(autolbclean.KindBackendServices, `acme-be-default-apiserver`), `prefixes of clusters should be deletable`) {
+		return
+	}
+	if !assert.True(t, c.IsDeletableName(autolbclean.KindSslCertificates, `acme-cert-1`), `name_patterns should be deletable`) {
+		return
+	}
+	if !assert.False(t, c.IsDeletableName(autolbclean.KindSslCertificates, `k8s-ssl-default-apiserver`), `name_patterns should replace the defaults`) {
+		return
+	}
+
+	if !assert.True(t, c.IsDeletableName(autolbclean.KindNetworkEndpointGroups, `k8s1-c4f34d38-default-web-80-0123abcd`), `NEGs of GKE should be deletable`) {
+		return
+	}
+	if !assert.True(t, c.IsDeletableName(autolbclean.KindFirewalls, `k8s-fw-l7--c4f34d3824aedd50`), `firewall rules of ingresses should be deletable`) {
+		return
+	}
+	if !assert.False(t, c.IsDeletableName(autolbclean.KindFirewalls, `gke-prod-0123abcd-all`), `firewall rules of cluster nodes should not be deletable`) {
+		return
+	}
+	if !assert.False(t, c.IsDeletableName(`backendBuckets`, `k8s-bb-1`), `kinds without patterns should not be deletable`) {
+		return
+	}
+
+	if _, err := autolbclean.ParseConfig([]byte("name_patterns:\n  urlMaps: [ \"[\" ]\n")); !assert.Error(t, err, `invalid patterns should be rejected`) {
+		return
+	}
+	if _, err := autolbclean.ParseConfig([]byte("name_patterns:\n  urlMap: [ \"k8s-*\" ]\n")); !assert.Error(t, err, `unknown kinds should be rejected`) {
+		return
+	}
+}
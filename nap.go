@@ -0,0 +1,119 @@
+package autolbclean
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+// nodeTagHash returns the part of the network tags of a cluster's nodes
+// that identifies the cluster. GKE tags the nodes as gke-NAME-HASH-node,
+// where NAME may be truncated, and HASH is the beginning of the cluster ID
+func nodeTagHash(cluster *container.Cluster) string {
+	if len(cluster.Id) < 8 {
+		return ``
+	}
+	return `-` + cluster.Id[:8] + `-`
+}
+
+// nodeTagCluster returns the cluster in clusters whose nodes carry the
+// given network tag, or nil if there is none
+func nodeTagCluster(tag string, clusters []*container.Cluster) *container.Cluster {
+	for _, cluster := range clusters {
+		if hash := nodeTagHash(cluster); len(hash) > 0 && strings.HasPrefix(tag, `gke-`) && strings.Contains(tag, hash) {
+			return cluster
+		}
+	}
+	return nil
+}
+
+// targetsLiveCluster returns true if the firewall rule targets the nodes
+// of any of the clusters
+func targetsLiveCluster(fw *compute.Firewall, clusters []*container.Cluster) bool {
+	for _, tag := range fw.TargetTags {
+		if nodeTagCluster(tag, clusters) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterInZones returns true if the cluster has nodes in any of the
+// zones, or in the region of any of them
+func clusterInZones(cluster *container.Cluster, zones map[string]error) bool {
+	locations := append([]string{cluster.Location}, cluster.Locations...)
+	for zone := range zones {
+		region := zone
+		if i := strings.LastIndexByte(zone, '-'); i > 0 {
+			region = zone[:i]
+		}
+		for _, loc := range locations {
+			if loc == zone || loc == region {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isAutoprovisioned(cluster *container.Cluster) bool {
+	return cluster.Autoscaling != nil && cluster.Autoscaling.EnableNodeAutoprovisioning
+}
+
+// AutoprovisionedClusterTags returns the tags in tags that belong to
+// GKE clusters with node auto-provisioning enabled, mapped to the name
+// of the cluster.
+//
+// Such clusters can legitimately have no nodes at all for long stretches,
+// so the absence of instances is not enough to tell that their firewall
+// rules are dangling. Only the cluster being deleted is
+func (app *App) AutoprovisionedClusterTags(ctx context.Context, tags []string) (map[string]string, error) {
+	listCtx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	clusters, err := app.container.Projects.Locations.Clusters.List(`projects/` + app.project + `/locations/-`).Context(listCtx).Do()
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list GKE clusters`)
+	}
+
+	result := make(map[string]string)
+	for _, cluster := range clusters.Clusters {
+		if !isAutoprovisioned(cluster) {
+			continue
+		}
+
+		hash := nodeTagHash(cluster)
+		if len(hash) == 0 {
+			continue
+		}
+		for _, tag := range tags {
+			if strings.HasPrefix(tag, `gke-`) && strings.Contains(tag, hash) {
+				result[tag] = cluster.Name
+			}
+		}
+	}
+	return result, nil
+}
+
+// keepAutoprovisionedTags removes the tags of clusters with node
+// auto-provisioning from tags2fws, so that their firewall rules are
+// never considered dangling while the cluster exists
+func (app *App) keepAutoprovisionedTags(ctx context.Context, tags2fws map[string][]*compute.Firewall) error {
+	tags := make([]string, 0, len(tags2fws))
+	for tag := range tags2fws {
+		tags = append(tags, tag)
+	}
+
+	owned, err := app.AutoprovisionedClusterTags(ctx, tags)
+	if err != nil {
+		return err
+	}
+
+	for tag := range owned {
+		delete(tags2fws, tag)
+	}
+	return nil
+}
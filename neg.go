@@ -0,0 +1,153 @@
+package autolbclean
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+// DefaultNEGEmptyThreshold is how long the network endpoint groups of a
+// load balancer must have been empty before it is considered orphaned
+const DefaultNEGEmptyThreshold = 24 * time.Hour
+
+// negDescription is what the NEG controller of GKE puts in the
+// description of the network endpoint groups that it creates
+type negDescription struct {
+	ClusterUID  string `json:"cluster-uid"`
+	Namespace   string `json:"namespace"`
+	ServiceName string `json:"service-name"`
+	Port        string `json:"port"`
+}
+
+// ParseNEGDescription returns the UID of the cluster that created the
+// network endpoint group, as recorded in its description. An empty
+// string is returned if the group was not created by GKE
+func ParseNEGDescription(s string) string {
+	var desc negDescription
+	if err := json.Unmarshal([]byte(s), &desc); err != nil {
+		return ``
+	}
+	return desc.ClusterUID
+}
+
+// zonalNEGs returns the URLs of the zonal network endpoint groups that
+// the backend services of the orphan send traffic to
+func (o *Orphan) zonalNEGs() []string {
+	var list []string
+	for _, service := range o.BackendServices {
+		for _, backend := range service.Backends {
+			if isNetworkEndpointGroup(backend.Group) && strings.Contains(backend.Group, `/zones/`) {
+				list = append(list, backend.Group)
+			}
+		}
+	}
+	return list
+}
+
+func (app *App) getNetworkEndpointGroup(ctx context.Context, group string) (*compute.NetworkEndpointGroup, error) {
+	name, zone, err := ParseNetworkEndpointGroup(group)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse network endpoint group url`)
+	}
+
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+	return app.service.NetworkEndpointGroups.Get(app.projectOf(group), zone, name).Context(ctx).Do()
+}
+
+// skipFreshNEGs drops the orphans backed by network endpoint groups,
+// unless all of their groups have been seen without endpoints for longer
+// than the threshold, and none of them belongs to a GKE cluster that
+// still exists. An empty group of a live cluster usually means that its
+// service was scaled to zero, not that the ingress is gone.
+//
+// How long the groups have been empty is remembered in the store, and
+// groups that are not seen empty in this run are forgotten. Without a
+// store that can remember them, these orphans are always dropped
+func (app *App) skipFreshNEGs(ctx context.Context, orphans []*Orphan) ([]*Orphan, error) {
+	c := app.Config()
+	store, _ := app.store.(EmptyGroupStore)
+
+	known := make(map[string]*Candidate)
+	if store != nil {
+		records, err := store.ListEmptyGroups(ctx, app.project)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to load empty network endpoint groups`)
+		}
+		for _, r := range records {
+			known[r.SelfLink] = r
+		}
+	}
+
+	now := time.Now().UTC()
+	var clusters []*container.Cluster
+	var listedClusters bool
+	var seen []*Candidate
+	tracked := make(map[string]struct{})
+	var result []*Orphan
+	for _, o := range orphans {
+		groups := o.zonalNEGs()
+		if len(groups) == 0 {
+			result = append(result, o)
+			continue
+		}
+
+		if !listedClusters {
+			var err error
+			if clusters, err = app.liveClusters(ctx); err != nil {
+				return nil, errors.Wrap(err, `failed to look for the owners of network endpoint groups`)
+			}
+			listedClusters = true
+		}
+
+		orphaned := store != nil
+		for _, group := range groups {
+			r, ok := known[group]
+			if !ok {
+				r = &Candidate{SelfLink: group, FirstSeen: now}
+				known[group] = r
+			}
+			if _, ok := tracked[group]; !ok {
+				tracked[group] = struct{}{}
+				r.LastSeen = now
+				seen = append(seen, r)
+			}
+			if now.Sub(r.FirstSeen) < c.NEGEmptiness.Threshold {
+				orphaned = false
+			}
+
+			// groups that can not be tied to a cluster that is gone
+			// are left alone
+			neg, err := app.getNetworkEndpointGroup(ctx, group)
+			if err != nil {
+				orphaned = false
+				continue
+			}
+			uid := ParseNEGDescription(neg.Description)
+			if len(uid) == 0 || len(liveClusterOf(uid, clusters)) > 0 {
+				orphaned = false
+				continue
+			}
+			if len(o.Cluster) == 0 {
+				o.Cluster = uid
+			}
+		}
+
+		if orphaned {
+			o.NoEndpoints = true
+			result = append(result, o)
+		}
+	}
+
+	if store != nil && !isReadOnly(ctx) {
+		if err := store.SaveEmptyGroups(ctx, app.project, seen); err != nil {
+			return nil, errors.Wrap(err, `failed to save empty network endpoint groups`)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,21 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNEGDescription(t *testing.T) {
+	uid := autolbclean.ParseNEGDescription(`{"cluster-uid":"4f2a3b1c9d8e7f60","namespace":"default","service-name":"web","port":"80"}`)
+	if !assert.Equal(t, `4f2a3b1c9d8e7f60`, uid, `cluster uid should be parsed`) {
+		return
+	}
+
+	for _, desc := range []string{``, `created by hand`, `{"namespace":"default"}`} {
+		if !assert.Empty(t, autolbclean.ParseNEGDescription(desc), `groups not created by GKE have no cluster uid`) {
+			return
+		}
+	}
+}
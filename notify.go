@@ -0,0 +1,111 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+func (f NotifierFunc) Notify(ctx context.Context, n *Notification) error {
+	return f(ctx, n)
+}
+
+// AddNotifier registers a notification sink. Every notification sent
+// through the App is delivered to all registered sinks
+func (app *App) AddNotifier(n Notifier) {
+	app.notifiers = append(app.notifiers, redactingNotifier{notifier: n})
+}
+
+// Notify delivers the notification to all registered sinks. A sink
+// failing does not prevent the rest of the sinks from being notified
+func (app *App) Notify(ctx context.Context, n *Notification) error {
+	if len(n.Project) == 0 {
+		n.Project = app.project
+	}
+
+	var err error
+	for _, notifier := range app.notifiers {
+		if nerr := notifier.Notify(ctx, n); nerr != nil && err == nil {
+			err = errors.Wrap(nerr, `failed to deliver notification`)
+		}
+	}
+	return err
+}
+
+type webhookNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// NewWebhookNotifier creates a notification sink that POSTs each
+// notification to url as a JSON document
+func NewWebhookNotifier(client *http.Client, url string) Notifier {
+	return redactingNotifier{notifier: &webhookNotifier{client: client, url: url}}
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, msg *Notification) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, `failed to encode notification`)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(buf))
+	if err != nil {
+		return errors.Wrap(err, `failed to create request`)
+	}
+	req.Header.Set(`Content-Type`, `application/json`)
+
+	res, err := n.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, `failed to post notification`)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf(`webhook responded with status %d`, res.StatusCode)
+	}
+	return nil
+}
+
+type slackNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// NewSlackNotifier creates a notification sink that posts each
+// notification to a Slack incoming webhook
+func NewSlackNotifier(client *http.Client, url string) Notifier {
+	return redactingNotifier{notifier: &slackNotifier{client: client, url: url}}
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, msg *Notification) error {
+	text := `*[` + msg.Project + `] ` + msg.Subject + `*`
+	if len(msg.Body) > 0 {
+		text += "\n```\n" + msg.Body + "\n```"
+	}
+
+	buf, err := json.Marshal(map[string]string{`text`: text})
+	if err != nil {
+		return errors.Wrap(err, `failed to encode notification`)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(buf))
+	if err != nil {
+		return errors.Wrap(err, `failed to create request`)
+	}
+	req.Header.Set(`Content-Type`, `application/json`)
+
+	res, err := n.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, `failed to post notification`)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf(`slack responded with status %d`, res.StatusCode)
+	}
+	return nil
+}
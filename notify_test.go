@@ -0,0 +1,76 @@
+package autolbclean_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportSummary(t *testing.T) {
+	report := &autolbclean.Report{
+		Project: `my-project`,
+		Orphans: []*autolbclean.Orphan{{TargetProxy: `k8s-tp-a`}, {TargetProxy: `k8s-tp-b`}},
+		Scheduled: []*autolbclean.Deletion{
+			{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-a`},
+			{Kind: autolbclean.KindBackendServices, Name: `k8s-be-a`, Region: `us-central1`},
+		},
+	}
+	report.SkipOrphan(report.Orphans[1], `deletion budget exhausted, deferred to the next run`)
+
+	n := report.Summary()
+	if !assert.Equal(t, `my-project`, n.Project) {
+		return
+	}
+	if !assert.Equal(t, `found 2 orphaned load balancers, scheduled 2 resources for deletion, skipped 1`, n.Subject) {
+		return
+	}
+	if !assert.Contains(t, n.Body, `backendServices k8s-be-a (us-central1)`) {
+		return
+	}
+	if !assert.Contains(t, n.Body, `targetHttpProxies k8s-tp-b: deletion budget exhausted`) {
+		return
+	}
+}
+
+func TestReportOrphanSet(t *testing.T) {
+	a := &autolbclean.Report{Orphans: []*autolbclean.Orphan{{ForwardingRule: `k8s-fw-a`, Region: `global`}, {ForwardingRule: `k8s-fw-b`, Region: `us-central1`}}}
+	b := &autolbclean.Report{Orphans: []*autolbclean.Orphan{{ForwardingRule: `k8s-fw-b`, Region: `us-central1`}, {ForwardingRule: `k8s-fw-a`, Region: `global`}}}
+	if !assert.Equal(t, a.OrphanSet(), b.OrphanSet(), `the order of the orphans should not matter`) {
+		return
+	}
+
+	c := &autolbclean.Report{Orphans: []*autolbclean.Orphan{{ForwardingRule: `k8s-fw-a`, Region: `global`}}}
+	if !assert.NotEqual(t, a.OrphanSet(), c.OrphanSet(), `different orphans should make a different set`) {
+		return
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var payload map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer srv.Close()
+
+	n := autolbclean.NewSlackNotifier(srv.Client(), srv.URL)
+	err := n.Notify(context.Background(), &autolbclean.Notification{
+		Project: `my-project`,
+		Subject: `found 1 orphaned load balancers`,
+		Body:    `Scheduled for deletion:`,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.True(t, strings.HasPrefix(payload[`text`], `*[my-project] found 1 orphaned load balancers*`), `subject should come first`) {
+		return
+	}
+	if !assert.Contains(t, payload[`text`], `Scheduled for deletion:`) {
+		return
+	}
+}
@@ -0,0 +1,70 @@
+package autolbclean
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OperationCodeResourceInUse is the code of the operations that failed
+// because the resource is still referenced by another one, which is
+// usually being deleted at the same time
+const OperationCodeResourceInUse = `RESOURCE_IN_USE_BY_ANOTHER_RESOURCE`
+
+// OperationPollInterval is how long to wait between two polls of an
+// operation
+const OperationPollInterval = 10 * time.Second
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf(`operation %s failed: %s (%s)`, e.Operation, e.Message, e.Code)
+}
+
+// IsResourceInUse returns true if err is the error of an operation that
+// failed because another resource still references the resource
+func IsResourceInUse(err error) bool {
+	oe, ok := errors.Cause(err).(*OperationError)
+	return ok && oe.Code == OperationCodeResourceInUse
+}
+
+// GetOperation fetches the current state of the operation
+func (app *App) GetOperation(ctx context.Context, ref *OperationRef) (Operation, error) {
+	if app.compute == nil {
+		return nil, errors.New(`no compute client configured`)
+	}
+
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+	return app.compute.Operation(ctx, app.project, ref)
+}
+
+// OperationTask returns the task that polls the operation of the given
+// deletion until it is done. attempt is the attempt of the delete job
+// that started the operation, and requeues is the number of times that
+// the deletion was already enqueued again after failing because the
+// resource was still in use
+func OperationTask(ref *OperationRef, d *Deletion, expires string, attempt, requeues int) *Task {
+	t := &Task{
+		Path: `/job/operations/poll`,
+		Params: url.Values{
+			"operation":        {ref.Name},
+			"operation_region": {ref.Region},
+			"operation_zone":   {ref.Zone},
+			"kind":             {d.Kind},
+			"name":             {d.Name},
+			"region":           {d.Region},
+			"zone":             {d.Zone},
+			"expires":          {expires},
+			"attempt":          {strconv.Itoa(attempt)},
+			"requeues":         {strconv.Itoa(requeues)},
+		},
+		Delay: OperationPollInterval,
+	}
+	if len(d.Next) > 0 {
+		t.Params.Set("next", encodeDeletionChain(d.Next))
+	}
+	return t
+}
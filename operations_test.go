@@ -0,0 +1,40 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsResourceInUse(t *testing.T) {
+	err := errors.Wrap(&autolbclean.OperationError{
+		Operation: `operation-1`,
+		Code:      autolbclean.OperationCodeResourceInUse,
+		Message:   `The backend_service resource is already being used by url_map`,
+	}, `failed to wait for operation`)
+	if !assert.True(t, autolbclean.IsResourceInUse(err), `wrapped operation errors should be detected`) {
+		return
+	}
+
+	if !assert.False(t, autolbclean.IsResourceInUse(&autolbclean.OperationError{Code: `NOT_FOUND`}), `other codes should not be detected`) {
+		return
+	}
+}
+
+func TestOperationTask(t *testing.T) {
+	task := autolbclean.OperationTask(
+		&autolbclean.OperationRef{Name: `operation-1`, Region: `asia-northeast1`},
+		&autolbclean.Deletion{Kind: autolbclean.KindBackendServices, Name: `k8s-be-30000`, Region: `asia-northeast1`},
+		`2026-10-16T00:00:00Z`,
+		3,
+		2,
+	)
+	if !assert.Equal(t, `/job/operations/poll`, task.Path, `path should match`) {
+		return
+	}
+	if !assert.Equal(t, `attempt=3&expires=2026-10-16T00%3A00%3A00Z&kind=backendServices&name=k8s-be-30000&operation=operation-1&operation_region=asia-northeast1&operation_zone=&region=asia-northeast1&requeues=2&zone=`, task.Params.Encode(), `params should match`) {
+		return
+	}
+}
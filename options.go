@@ -0,0 +1,236 @@
+package autolbclean
+
+import (
+	"net/http"
+	"time"
+)
+
+// Default timeouts for each compute API call
+const (
+	DefaultGetTimeout  = 5 * time.Second
+	DefaultListTimeout = 30 * time.Second
+)
+
+// DefaultDiscoveryTimeout is the default amount of time the check run
+// on App Engine spends looking for orphans. The load balancers that it
+// does not get to are left for the next run
+const DefaultDiscoveryTimeout = 5 * time.Minute
+
+// DefaultZoneConcurrency is the default number of zones that are
+// scanned for instances at the same time
+const DefaultZoneConcurrency = 8
+
+// WithGetTimeout sets the timeout for API calls that fetch a
+// single resource
+func WithGetTimeout(d time.Duration) Option {
+	return func(app *App) {
+		app.getTimeout = d
+	}
+}
+
+// WithListTimeout sets the timeout for API calls that list resources
+func WithListTimeout(d time.Duration) Option {
+	return func(app *App) {
+		app.listTimeout = d
+	}
+}
+
+// WithDiscoveryTimeout limits the time spent looking for orphans. Zero,
+// the default, means no limit
+func WithDiscoveryTimeout(d time.Duration) Option {
+	return func(app *App) {
+		app.discoveryTimeout = d
+	}
+}
+
+// WithZoneConcurrency sets the number of zones that are scanned for
+// instances at the same time
+func WithZoneConcurrency(n int) Option {
+	return func(app *App) {
+		app.zoneConcurrency = n
+	}
+}
+
+// WithTagIndexStore sets the store used to persist the instance tag
+// index between runs, and how long a saved index may be reused for
+func WithTagIndexStore(store TagIndexStore, ttl time.Duration) Option {
+	return func(app *App) {
+		app.tagIndexStore = store
+		app.tagIndexTTL = ttl
+	}
+}
+
+// WithConfig sets the initial configuration
+func WithConfig(c *Config) Option {
+	return func(app *App) {
+		app.config = c
+	}
+}
+
+// WithDeletionBudget limits the number of load balancers the worker
+// deletes in a single run. 0 means there is no limit
+func WithDeletionBudget(n int) Option {
+	return func(app *App) {
+		app.deletionBudget = n
+	}
+}
+
+// WithQuotaProject sets the project that the quota of the API calls is
+// billed to (X-Goog-User-Project), instead of the project that owns the
+// credentials. Pass QuotaProjectScanned to bill the project being
+// cleaned up. The credentials need serviceusage.services.use on it
+func WithQuotaProject(project string) Option {
+	return func(app *App) {
+		app.quotaProject = project
+	}
+}
+
+// WithRequestReason sets the reason (X-Goog-Request-Reason) that is
+// attached to every API call, and shows up in the audit logs
+func WithRequestReason(reason string) Option {
+	return func(app *App) {
+		app.requestReason = reason
+	}
+}
+
+// WithRateLimit limits the number of API requests per second that
+// the App makes. 0 means there is no limit
+func WithRateLimit(qps float64) Option {
+	return func(app *App) {
+		app.rateLimit = qps
+	}
+}
+
+// DefaultPlanMaxAge is how old a plan left behind by a previous run
+// can be for it to be resumed. Older plans are discarded
+const DefaultPlanMaxAge = time.Hour
+
+// WithPlanStore sets the store used to persist the plan while it is
+// being computed, and what to do when a plan left behind by a previous
+// run that did not finish is found. policy is one of PartialPlanFail,
+// PartialPlanResume and PartialPlanDiscard
+func WithPlanStore(store PlanStore, policy string) Option {
+	return func(app *App) {
+		app.planStore = store
+		app.partialPlan = policy
+	}
+}
+
+// WithPlanMaxAge sets how old a plan left behind by a previous run can
+// be for it to be resumed or refused. Older plans are discarded
+func WithPlanMaxAge(d time.Duration) Option {
+	return func(app *App) {
+		app.planMaxAge = d
+	}
+}
+
+// WithRunMetrics makes the one-shot worker write the metrics of each
+// run to Cloud Monitoring when enabled
+func WithRunMetrics(enabled bool) Option {
+	return func(app *App) {
+		app.runMetrics = enabled
+	}
+}
+
+// WithTaskEnqueuer sets the task queue that jobs are enqueued to
+func WithTaskEnqueuer(e TaskEnqueuer) Option {
+	return func(app *App) {
+		app.tasks = e
+	}
+}
+
+// WithTaskSigningKey makes the App sign the jobs it enqueues with the
+// given key, so that the delete jobs can tell them apart from requests
+// made up by anyone else who can reach them
+func WithTaskSigningKey(key []byte) Option {
+	return func(app *App) {
+		app.taskSigningKey = key
+	}
+}
+
+// WithTeamNotifier sets how the notification sinks of teams are
+// created from the Slack webhooks in the configuration. By default,
+// they are posted to with http.DefaultClient
+func WithTeamNotifier(f func(url string) Notifier) Option {
+	return func(app *App) {
+		app.teamNotifier = f
+	}
+}
+
+// WithTerraformHandoff sets where load balancers managed by Terraform
+// are handed off to. By default, they are sent to the notification sinks
+func WithTerraformHandoff(h TerraformHandoff) Option {
+	return func(app *App) {
+		app.terraform = h
+	}
+}
+
+// WithInventoryStore sets the store used to remember how many resources
+// the previous run found, so that a sudden drop can be caught
+func WithInventoryStore(store InventoryStore) Option {
+	return func(app *App) {
+		app.inventoryStore = store
+	}
+}
+
+// WithImpersonation makes the App call the APIs as the given service
+// account, whose access token is obtained with the credentials of the
+// client passed to New. This allows a deployment to clean up several
+// projects with a service account of their own
+func WithImpersonation(serviceAccount string) Option {
+	return func(app *App) {
+		app.impersonate = serviceAccount
+	}
+}
+
+// WithTransport sets the transport that the calls made as an impersonated
+// service account go through, instead of http.DefaultTransport. On App
+// Engine, this needs to be a urlfetch transport
+func WithTransport(rt http.RoundTripper) Option {
+	return func(app *App) {
+		app.transport = rt
+	}
+}
+
+// WithExecutorImpersonation makes the App delete resources as the given
+// service account, while discovery keeps using the credentials set up
+// by WithImpersonation (or the client passed to New). Discovery can
+// then run with a read-only role, and only the deletions are made with
+// a service account that is allowed to delete
+func WithExecutorImpersonation(serviceAccount string) Option {
+	return func(app *App) {
+		app.executorImpersonate = serviceAccount
+	}
+}
+
+// WithEventPublisher adds a publisher that deletion events are sent to.
+// It can be given more than once
+func WithEventPublisher(p EventPublisher) Option {
+	return func(app *App) {
+		app.events = append(app.events, p)
+	}
+}
+
+// WithRunID sets the identifier of the run that the App is part of,
+// instead of a new one. Jobs that continue a run use this
+func WithRunID(id string) Option {
+	return func(app *App) {
+		app.runID = id
+	}
+}
+
+// WithStore sets the store used to persist the run status, the orphan
+// candidates and the admin state
+func WithStore(store Store) Option {
+	return func(app *App) {
+		app.store = store
+	}
+}
+
+// WithAuditStore sets the store used to keep track of the resources
+// that were disabled and are pending deletion
+func WithAuditStore(store AuditStore) Option {
+	return func(app *App) {
+		app.auditStore = store
+	}
+}
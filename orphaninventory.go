@@ -0,0 +1,114 @@
+package autolbclean
+
+import (
+	"fmt"
+	"time"
+)
+
+// DescribeOrphan returns the orphan as the orphan inventory API lists
+// it, with its age as of now and the reasons it was classified as an
+// orphan
+func (c *Config) DescribeOrphan(o *Orphan, now time.Time) *OrphanCandidate {
+	oc := &OrphanCandidate{
+		TargetProxy:    o.TargetProxy,
+		SelfLink:       o.SelfLink,
+		ForwardingRule: o.ForwardingRule,
+		Region:         o.Region,
+		Cluster:        o.Cluster,
+		Namespace:      o.Namespace,
+		Team:           c.TeamOf(o),
+		Reasons:        c.orphanReasons(o),
+		ReportOnly:     c.IsReportOnly(o),
+		PolicyHold:     o.PolicyHold,
+		Chain:          []*ChainResource{},
+	}
+	if len(oc.Cluster) == 0 {
+		oc.Cluster = c.ClusterOf(o.TargetProxy)
+	}
+	if !o.CreatedAt.IsZero() {
+		createdAt := o.CreatedAt
+		oc.CreatedAt = &createdAt
+		oc.AgeSeconds = int64(now.Sub(createdAt) / time.Second)
+	}
+	if o.Confidence != nil {
+		score := o.Confidence.Score
+		oc.Confidence = &score
+		oc.Signals = o.Confidence.Signals
+	}
+
+	// only the target proxy and the backend services carry their
+	// creation time along with the orphan
+	created := map[string]time.Time{
+		o.kind() + `/` + o.TargetProxy: o.CreatedAt,
+	}
+	for _, s := range o.BackendServices {
+		if t, err := time.Parse(time.RFC3339, s.CreationTimestamp); err == nil {
+			created[KindBackendServices+`/`+s.Name] = t
+		}
+	}
+	for _, d := range o.Deletions() {
+		r := &ChainResource{
+			Kind:   d.Kind,
+			Name:   d.Name,
+			Region: d.Region,
+			Zone:   d.Zone,
+		}
+		if t, ok := created[d.Kind+`/`+d.Name]; ok && !t.IsZero() {
+			r.CreatedAt = &t
+		}
+		oc.Chain = append(oc.Chain, r)
+	}
+	return oc
+}
+
+// orphanReasons explains why the load balancer was classified as an
+// orphan, from what the checks that let it through have established
+func (c *Config) orphanReasons(o *Orphan) []string {
+	reasons := []string{
+		fmt.Sprintf(`its target proxy is older than %s`, c.AgeThresholdOf(o.kind())),
+	}
+	if len(o.BackendServices) == 0 {
+		reasons = append(reasons, `its url map has no backend services`)
+	} else {
+		reasons = append(reasons, `no instances are behind its backend services`)
+	}
+	if o.NoEndpoints {
+		reasons = append(reasons, `the health of its backends reports no endpoints`)
+	}
+	if len(o.zonalNEGs()) > 0 {
+		reasons = append(reasons, fmt.Sprintf(`its network endpoint groups have been empty for longer than %s`, c.NEGEmptiness.Threshold))
+	}
+	if len(o.ForwardingRule) == 0 {
+		reasons = append(reasons, `no forwarding rule sends traffic to it`)
+	}
+
+	uid := o.Cluster
+	if len(uid) == 0 {
+		uid = c.ClusterOf(o.TargetProxy)
+	}
+	if o.ClusterDeleted {
+		reasons = append(reasons, `a cluster notification confirmed that its cluster was deleted`)
+	} else if c.ClusterCrossCheck && len(uid) > 0 {
+		reasons = append(reasons, `its cluster does not exist anymore`)
+	}
+	if o.Managed {
+		reasons = append(reasons, `it opted into the cleanup`)
+	}
+	return reasons
+}
+
+// DescribeOrphans lists the orphans that FindOrphans returned as the
+// orphan inventory API does
+func (app *App) DescribeOrphans(orphans []*Orphan) *OrphanInventory {
+	c := app.Config()
+	now := time.Now().UTC()
+	inv := &OrphanInventory{
+		Project:     app.project,
+		GeneratedAt: now,
+		Orphans:     []*OrphanCandidate{},
+	}
+	for _, o := range orphans {
+		inv.Orphans = append(inv.Orphans, c.DescribeOrphan(o, now))
+	}
+	return inv
+}
@@ -0,0 +1,86 @@
+package autolbclean_test
+
+import (
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestDescribeOrphan(t *testing.T) {
+	c := autolbclean.DefaultConfig()
+	c.ClusterCrossCheck = true
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	o := &autolbclean.Orphan{
+		Cluster:        `0123456789abcdef`,
+		ForwardingRule: `k8s-fw-a`,
+		Region:         `global`,
+		TargetProxy:    `k8s-tp-a`,
+		UrlMap:         `k8s-um-a`,
+		BackendServices: []*compute.BackendService{
+			{Name: `k8s-be-a`, CreationTimestamp: `2026-10-01T00:00:00Z`},
+		},
+		CreatedAt:      now.Add(-48 * time.Hour),
+		ClusterDeleted: true,
+	}
+
+	oc := c.DescribeOrphan(o, now)
+	if !assert.Equal(t, int64(48*60*60), oc.AgeSeconds, `age should be relative to now`) {
+		return
+	}
+	if !assert.Nil(t, oc.Confidence, `confidence should be omitted unless scored`) || !assert.False(t, oc.ReportOnly) {
+		return
+	}
+	if !assert.Contains(t, oc.Reasons, `no instances are behind its backend services`) {
+		return
+	}
+	if !assert.Contains(t, oc.Reasons, `a cluster notification confirmed that its cluster was deleted`) {
+		return
+	}
+	if !assert.NotContains(t, oc.Reasons, `its cluster does not exist anymore`, `a confirmed deletion should not be repeated`) {
+		return
+	}
+
+	var kinds []string
+	for _, r := range oc.Chain {
+		kinds = append(kinds, r.Kind)
+	}
+	expected := []string{
+		autolbclean.KindForwardingRules,
+		autolbclean.KindTargetHttpProxies,
+		autolbclean.KindUrlMaps,
+		autolbclean.KindBackendServices,
+	}
+	if !assert.Equal(t, expected, kinds, `chain should be in the order of deletion`) {
+		return
+	}
+	if !assert.NotNil(t, oc.Chain[1].CreatedAt, `target proxy should carry its creation time`) || !assert.Nil(t, oc.Chain[2].CreatedAt, `url map creation time is unknown`) {
+		return
+	}
+	if !assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), oc.Chain[3].CreatedAt.UTC(), `backend service should carry its creation time`) {
+		return
+	}
+}
+
+func TestDescribeOrphanReportOnly(t *testing.T) {
+	c := autolbclean.DefaultConfig()
+	c.Confidence.Enabled = true
+	now := time.Now()
+
+	o := &autolbclean.Orphan{TargetProxy: `k8s-tp-b`, Region: `global`}
+	o.Confidence = c.ScoreOrphan(o, now, false)
+
+	oc := c.DescribeOrphan(o, now)
+	if !assert.NotNil(t, oc.Confidence, `confidence should be included when scored`) || !assert.Equal(t, 0, *oc.Confidence) {
+		return
+	}
+	if !assert.True(t, oc.ReportOnly, `low confidence orphans should be report only`) {
+		return
+	}
+	if !assert.Nil(t, oc.CreatedAt) || !assert.Contains(t, oc.Reasons, `no forwarding rule sends traffic to it`) {
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package autolbclean
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// What to do with a plan left behind by a run that did not finish
+const (
+	PartialPlanFail    = `fail`    // refuse to run until the plan is resumed or discarded
+	PartialPlanResume  = `resume`  // continue where the previous run left off
+	PartialPlanDiscard = `discard` // throw the plan away and start over
+)
+
+// ParsePartialPlanPolicy validates the name of a partial plan policy
+func ParsePartialPlanPolicy(s string) (string, error) {
+	switch s {
+	case PartialPlanFail, PartialPlanResume, PartialPlanDiscard:
+		return s, nil
+	}
+	return ``, errors.Errorf(`invalid partial plan policy %q (expected one of %s, %s, %s)`, s, PartialPlanFail, PartialPlanResume, PartialPlanDiscard)
+}
+
+func planKey(kind, region, name string) string {
+	return kind + `/` + region + `/` + name
+}
+
+func (p *Plan) isChecked(key string) bool {
+	return p.Checked[key]
+}
+
+// record marks the load balancer identified by key as examined, along
+// with the orphan that was found for it, if any
+func (p *Plan) record(key string, o *Orphan) {
+	p.Checked[key] = true
+	if o != nil {
+		p.Orphans = append(p.Orphans, o)
+	}
+}
+
+// startPlan returns the plan that discovery should work on. If a plan
+// left behind by a previous run is found, the partial plan policy
+// decides whether it is resumed, discarded, or whether we give up.
+// Plans older than the maximum age are discarded regardless, as what
+// they found no longer says much about the project
+func (app *App) startPlan(ctx context.Context) (*Plan, error) {
+	fresh := &Plan{
+		Project:   app.project,
+		StartedAt: time.Now().UTC(),
+		Checked:   make(map[string]bool),
+	}
+	if app.planStore == nil || isReadOnly(ctx) {
+		return fresh, nil
+	}
+
+	plan, err := app.planStore.LoadPlan(ctx, app.project)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to load plan`)
+	}
+	if plan == nil {
+		return fresh, nil
+	}
+
+	policy := app.partialPlan
+	if app.planMaxAge > 0 && fresh.StartedAt.Sub(plan.StartedAt) > app.planMaxAge {
+		policy = PartialPlanDiscard
+	}
+
+	switch policy {
+	case PartialPlanResume:
+		if plan.Checked == nil {
+			plan.Checked = make(map[string]bool)
+		}
+		plan.resumed = len(plan.Orphans)
+		return plan, nil
+	case PartialPlanDiscard:
+		if err := app.planStore.DiscardPlan(ctx, app.project); err != nil {
+			return nil, errors.Wrap(err, `failed to discard plan`)
+		}
+		return fresh, nil
+	}
+	return nil, errors.Errorf(`found a partial plan for project %s started at %s by a run that did not finish, it must be resumed or discarded`, app.project, plan.StartedAt.Format(timeFormat))
+}
+
+// savePlan persists the plan. Failing to do so only means that the
+// work done so far will be lost if we die, so it is not fatal
+func (app *App) savePlan(ctx context.Context, plan *Plan) {
+	if app.planStore == nil || isReadOnly(ctx) {
+		return
+	}
+
+	plan.UpdatedAt = time.Now().UTC()
+	_ = app.planStore.SavePlan(ctx, plan)
+}
+
+// FinishPlan discards the persisted plan once the run that it
+// belongs to has finished
+func (app *App) FinishPlan(ctx context.Context) error {
+	if app.planStore == nil {
+		return nil
+	}
+	return errors.Wrap(app.planStore.DiscardPlan(ctx, app.project), `failed to discard plan`)
+}
+
+// reverifyOrphans checks the orphans found by a previous run again, as
+// the load balancers may have been put back to use, or opted out of the
+// cleanup, since. The ones that are no longer orphaned, or that can not
+// be checked, are dropped. The exclusions and snoozes are applied to
+// them afterwards, along with the orphans found by this run
+func (app *App) reverifyOrphans(ctx context.Context, orphans []*Orphan) []*Orphan {
+	c := app.Config()
+	var result []*Orphan
+	for _, o := range orphans {
+		var fwr *compute.ForwardingRule
+		if len(o.ForwardingRule) > 0 {
+			var err error
+			if fwr, err = app.getForwardingRule(ctx, o.Region, o.ForwardingRule); err != nil {
+				continue
+			}
+			if c.IsProtected(fwr.Labels, fwr.Description) {
+				continue
+			}
+		}
+
+		fresh, err := app.FindOrphan(ctx, o.ForwardingRule, o.Region, o.TargetProxy, o.IsHTTPs)
+		if err != nil || fresh == nil {
+			continue
+		}
+		fresh.Managed = o.Managed
+		if fwr != nil {
+			fresh.setForwardingRule(fwr, c)
+		}
+		result = append(result, fresh)
+	}
+	return result
+}
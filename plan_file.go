@@ -0,0 +1,69 @@
+package autolbclean
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+type filePlanStore struct {
+	dir string
+}
+
+// NewFilePlanStore creates a PlanStore that keeps one JSON file per
+// project in dir
+func NewFilePlanStore(dir string) PlanStore {
+	return filePlanStore{dir: dir}
+}
+
+func (s filePlanStore) filename(project string) string {
+	return filepath.Join(s.dir, project+`.plan.json`)
+}
+
+func (s filePlanStore) LoadPlan(ctx context.Context, project string) (*Plan, error) {
+	buf, err := ioutil.ReadFile(s.filename(project))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, `failed to read plan`)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(buf, &plan); err != nil {
+		return nil, errors.Wrap(err, `failed to decode plan`)
+	}
+	return &plan, nil
+}
+
+// SavePlan writes the plan to a temporary file first, and renames it
+// into place, so that dying in the middle of a write never leaves a
+// corrupt plan behind
+func (s filePlanStore) SavePlan(ctx context.Context, plan *Plan) error {
+	buf, err := json.Marshal(plan)
+	if err != nil {
+		return errors.Wrap(err, `failed to encode plan`)
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return errors.Wrap(err, `failed to create plan directory`)
+	}
+
+	filename := s.filename(plan.Project)
+	tmp := filename + `.tmp`
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return errors.Wrap(err, `failed to write plan`)
+	}
+	return errors.Wrap(os.Rename(tmp, filename), `failed to rename plan`)
+}
+
+func (s filePlanStore) DiscardPlan(ctx context.Context, project string) error {
+	if err := os.Remove(s.filename(project)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, `failed to remove plan`)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package autolbclean
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/pkg/errors"
+)
+
+// Actions of deletion policies
+const (
+	PolicyKeep   = `keep`
+	PolicyDelete = `delete`
+)
+
+// policyEnv declares the variables that policy expressions see: the
+// resource being evaluated, and the orphan that it is part of
+var policyEnv = func() *cel.Env {
+	env, err := cel.NewEnv(
+		cel.Variable(`resource`, cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable(`orphan`, cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return env
+}()
+
+// policyPrograms caches the compiled expressions of the policies, as
+// they are evaluated for every resource of every orphan
+var policyPrograms sync.Map
+
+// compilePolicy compiles a policy expression, which must evaluate to a
+// bool
+func compilePolicy(expr string) (cel.Program, error) {
+	if prg, ok := policyPrograms.Load(expr); ok {
+		return prg.(cel.Program), nil
+	}
+
+	ast, iss := policyEnv.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, errors.Errorf(`expression evaluates to %s, not bool`, ast.OutputType())
+	}
+	prg, err := policyEnv.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	policyPrograms.Store(expr, prg)
+	return prg, nil
+}
+
+func validatePolicies(p PoliciesConfig) error {
+	switch p.Default {
+	case PolicyKeep, PolicyDelete:
+	default:
+		return errors.Errorf(`invalid default action %q (expected keep or delete)`, p.Default)
+	}
+
+	seen := make(map[string]struct{})
+	for i, rule := range p.Rules {
+		if len(rule.Name) == 0 {
+			return errors.Errorf(`rule %d has no name`, i)
+		}
+		if _, ok := seen[rule.Name]; ok {
+			return errors.Errorf(`duplicate rule %s`, rule.Name)
+		}
+		seen[rule.Name] = struct{}{}
+
+		switch rule.Action {
+		case PolicyKeep, PolicyDelete:
+		default:
+			return errors.Errorf(`invalid action %q of rule %s (expected keep or delete)`, rule.Action, rule.Name)
+		}
+		if _, err := compilePolicy(rule.Expression); err != nil {
+			return errors.Wrapf(err, `invalid expression of rule %s`, rule.Name)
+		}
+	}
+	return nil
+}
+
+// ageDays is the age of something created at t as of now, in days.
+// Unknown creation times give 0
+func ageDays(t *time.Time, now time.Time) float64 {
+	if t == nil {
+		return 0
+	}
+	return now.Sub(*t).Hours() / 24
+}
+
+// policyInput builds the variables that the expressions are evaluated
+// against, from the orphan as the orphan inventory API describes it
+func policyInput(o *Orphan, oc *OrphanCandidate, now time.Time) map[string]interface{} {
+	labels := make(map[string]string, len(o.Labels))
+	for k, v := range o.Labels {
+		labels[k] = v
+	}
+	confidence := -1
+	if oc.Confidence != nil {
+		confidence = *oc.Confidence
+	}
+	signals := oc.Signals
+	if signals == nil {
+		signals = []string{}
+	}
+
+	return map[string]interface{}{
+		`targetProxy`:    oc.TargetProxy,
+		`forwardingRule`: oc.ForwardingRule,
+		`region`:         oc.Region,
+		`cluster`:        oc.Cluster,
+		`namespace`:      oc.Namespace,
+		`team`:           oc.Team,
+		`labels`:         labels,
+		`ageDays`:        ageDays(oc.CreatedAt, now),
+		`confidence`:     confidence,
+		`signals`:        signals,
+		`reasons`:        oc.Reasons,
+		`internetFacing`: o.IsInternetFacing(),
+		`scheme`:         o.Scheme,
+		`ipAddress`:      o.IPAddress,
+	}
+}
+
+// resourceInput builds the variables for a single resource of the
+// chain. Resources whose creation time is unknown are taken to be as
+// old as the orphan, and only the forwarding rule carries labels
+func resourceInput(o *Orphan, oc *OrphanCandidate, r *ChainResource, now time.Time) map[string]interface{} {
+	createdAt := r.CreatedAt
+	if createdAt == nil {
+		createdAt = oc.CreatedAt
+	}
+	labels := map[string]string{}
+	if r.Kind == KindForwardingRules {
+		for k, v := range o.Labels {
+			labels[k] = v
+		}
+	}
+	return map[string]interface{}{
+		`kind`:    r.Kind,
+		`name`:    r.Name,
+		`region`:  r.Region,
+		`zone`:    r.Zone,
+		`ageDays`: ageDays(createdAt, now),
+		`labels`:  labels,
+	}
+}
+
+// evaluate returns the action that the rules take on the resource, and
+// the name of the rule that took it: that of the first rule that
+// matches, or else the default. A rule that fails to evaluate keeps the
+// resource, as it can not be told whether it was meant to match
+func (p PoliciesConfig) evaluate(vars map[string]interface{}) (string, string, error) {
+	for _, rule := range p.Rules {
+		prg, err := compilePolicy(rule.Expression)
+		if err != nil {
+			return PolicyKeep, rule.Name, err
+		}
+		out, _, err := prg.Eval(vars)
+		if err != nil {
+			return PolicyKeep, rule.Name, err
+		}
+		matched, ok := out.Value().(bool)
+		if !ok {
+			return PolicyKeep, rule.Name, errors.Errorf(`expression evaluated to %v, not bool`, out.Value())
+		}
+		if matched {
+			return rule.Action, rule.Name, nil
+		}
+	}
+	return p.Default, ``, nil
+}
+
+// isNoop returns true if the policies let everything be deleted
+// without evaluating anything
+func (p PoliciesConfig) isNoop() bool {
+	return len(p.Rules) == 0 && p.Default != PolicyKeep
+}
+
+// hold returns why the policies keep the resource, or an empty string
+// if they let it be deleted
+func (p PoliciesConfig) hold(r *ChainResource, vars map[string]interface{}) string {
+	action, rule, err := p.evaluate(vars)
+	if action != PolicyKeep {
+		return ``
+	}
+	if err != nil {
+		return fmt.Sprintf(`policy %s failed on %s %s: %s`, rule, r.Kind, r.Name, err)
+	}
+	if len(rule) == 0 {
+		return fmt.Sprintf(`no policy allows deleting %s %s`, r.Kind, r.Name)
+	}
+	return fmt.Sprintf(`policy %s keeps %s %s`, rule, r.Kind, r.Name)
+}
+
+// PolicyHold returns why the deletion policies keep the orphan, or an
+// empty string if they let all of its resources be deleted. A single
+// resource that is kept keeps the whole load balancer, as deleting only
+// part of it would leave it broken
+func (c *Config) PolicyHold(o *Orphan, now time.Time) string {
+	if c.Policies.isNoop() {
+		return ``
+	}
+
+	oc := c.DescribeOrphan(o, now)
+	vars := map[string]interface{}{
+		`orphan`: policyInput(o, oc, now),
+	}
+	for _, r := range oc.Chain {
+		vars[`resource`] = resourceInput(o, oc, r, now)
+		if hold := c.Policies.hold(r, vars); len(hold) > 0 {
+			return hold
+		}
+	}
+	return ``
+}
+
+// SweepPolicyHold returns why the deletion policies keep a resource
+// that a sweeper found on its own, outside of any load balancer, or an
+// empty string if they let it be deleted. The orphan that expressions
+// see is made up of what the resource tells about itself
+func (c *Config) SweepPolicyHold(r *ChainResource, labels map[string]string, now time.Time) string {
+	if c.Policies.isNoop() {
+		return ``
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	age := ageDays(r.CreatedAt, now)
+	vars := map[string]interface{}{
+		`orphan`: map[string]interface{}{
+			`targetProxy`:    ``,
+			`forwardingRule`: ``,
+			`region`:         r.Region,
+			`cluster`:        c.ClusterOf(r.Name),
+			`namespace`:      ``,
+			`team`:           ``,
+			`labels`:         labels,
+			`ageDays`:        age,
+			`confidence`:     -1,
+			`signals`:        []string{},
+			`reasons`:        []string{},
+			`internetFacing`: false,
+			`scheme`:         ``,
+			`ipAddress`:      ``,
+		},
+		`resource`: map[string]interface{}{
+			`kind`:    r.Kind,
+			`name`:    r.Name,
+			`region`:  r.Region,
+			`zone`:    r.Zone,
+			`ageDays`: age,
+			`labels`:  labels,
+		},
+	}
+	return c.Policies.hold(r, vars)
+}
+
+// sweptResource describes a resource found by a sweeper for
+// SweepPolicyHold. Creation times that can not be parsed are left out
+func sweptResource(kind, name, region, zone, timestamp string) *ChainResource {
+	r := &ChainResource{Kind: kind, Name: name, Region: region, Zone: zone}
+	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		r.CreatedAt = &t
+	}
+	return r
+}
+
+// sweepPolicyKeeps returns true if the deletion policies keep a
+// resource that a sweeper found, and logs why
+func sweepPolicyKeeps(ctx context.Context, c *Config, r *ChainResource, labels map[string]string) bool {
+	hold := c.SweepPolicyHold(r, labels, time.Now().UTC())
+	if len(hold) == 0 {
+		return false
+	}
+	decisionf(ctx, DecisionSkipped, r.Kind, r.Name, "Not deleting %s %s: %s", r.Kind, r.Name, hold)
+	return true
+}
+
+// applyPolicies records on each orphan whether the deletion policies
+// keep it
+func (app *App) applyPolicies(orphans []*Orphan) {
+	c := app.Config()
+	now := time.Now().UTC()
+	for _, o := range orphans {
+		o.PolicyHold = c.PolicyHold(o, now)
+	}
+}
@@ -0,0 +1,133 @@
+package autolbclean_test
+
+import (
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestParseConfigPolicies(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+policies:
+  rules:
+    - name: keep-labeled
+      expression: '"keep" in orphan.labels'
+      action: keep
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.PolicyDelete, c.Policies.Default, `default action should be delete`) {
+		return
+	}
+
+	for _, doc := range []string{
+		"policies:\n  rules:\n    - name: x\n      expression: 'resource.'\n      action: keep\n",
+		"policies:\n  rules:\n    - name: x\n      expression: '1 + 1'\n      action: keep\n",
+		"policies:\n  rules:\n    - name: x\n      expression: 'true'\n      action: drop\n",
+		"policies:\n  default: maybe\n",
+	} {
+		_, err := autolbclean.ParseConfig([]byte(doc))
+		if !assert.Error(t, err, `ParseConfig should fail for %q`, doc) {
+			return
+		}
+	}
+}
+
+func TestPolicyHold(t *testing.T) {
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	orphan := func(labels map[string]string) *autolbclean.Orphan {
+		return &autolbclean.Orphan{
+			ForwardingRule: `k8s-fw-a`,
+			Labels:         labels,
+			Region:         `global`,
+			TargetProxy:    `k8s-tp-a`,
+			UrlMap:         `k8s-um-a`,
+			BackendServices: []*compute.BackendService{
+				{Name: `k8s-be-a`, CreationTimestamp: `2026-10-14T00:00:00Z`},
+			},
+			CreatedAt: now.Add(-40 * 24 * time.Hour),
+		}
+	}
+
+	c := autolbclean.DefaultConfig()
+	if !assert.Empty(t, c.PolicyHold(orphan(nil), now), `no rules should keep nothing`) {
+		return
+	}
+
+	c.Policies.Rules = []autolbclean.PolicyRule{
+		{Name: `keep-labeled`, Expression: `"keep" in orphan.labels`, Action: autolbclean.PolicyKeep},
+		{Name: `young-backends`, Expression: `resource.kind == "backendServices" && resource.ageDays < 7.0`, Action: autolbclean.PolicyKeep},
+	}
+	if !assert.Equal(t, `policy keep-labeled keeps forwardingRules k8s-fw-a`, c.PolicyHold(orphan(map[string]string{`keep`: `true`}), now)) {
+		return
+	}
+	if !assert.Equal(t, `policy young-backends keeps backendServices k8s-be-a`, c.PolicyHold(orphan(nil), now), `the age of the resource should be used`) {
+		return
+	}
+
+	c.Policies.Rules[1].Expression = `resource.kind == "backendServices" && resource.ageDays < 1.0`
+	o := orphan(nil)
+	if !assert.Empty(t, c.PolicyHold(o, now), `nothing should be kept`) {
+		return
+	}
+
+	c.Policies.Default = autolbclean.PolicyKeep
+	c.Policies.Rules = []autolbclean.PolicyRule{
+		{Name: `old`, Expression: `orphan.ageDays > 30.0`, Action: autolbclean.PolicyDelete},
+	}
+	if !assert.Empty(t, c.PolicyHold(o, now), `old orphans should be deleted`) {
+		return
+	}
+	o.CreatedAt = now.Add(-24 * time.Hour)
+	if !assert.Equal(t, `no policy allows deleting forwardingRules k8s-fw-a`, c.PolicyHold(o, now)) {
+		return
+	}
+
+	c.Policies.Default = autolbclean.PolicyDelete
+	c.Policies.Rules = []autolbclean.PolicyRule{
+		{Name: `broken`, Expression: `orphan.nosuch == "x"`, Action: autolbclean.PolicyDelete},
+	}
+	o.PolicyHold = c.PolicyHold(o, now)
+	if !assert.Contains(t, o.PolicyHold, `policy broken failed`, `a failing rule should keep the orphan`) {
+		return
+	}
+	if !assert.True(t, c.IsReportOnly(o), `orphans kept by a policy should be report only`) {
+		return
+	}
+
+	c.Policies.Default = autolbclean.PolicyKeep
+	c.Policies.Rules = nil
+	if !assert.Equal(t, `no policy allows deleting forwardingRules k8s-fw-a`, c.PolicyHold(o, now), `a default of keep should keep everything without rules`) {
+		return
+	}
+}
+
+func TestSweepPolicyHold(t *testing.T) {
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	createdAt := now.Add(-10 * 24 * time.Hour)
+	r := &autolbclean.ChainResource{Kind: autolbclean.KindSslCertificates, Name: `k8s2-cr-a`, Region: `global`, CreatedAt: &createdAt}
+
+	c := autolbclean.DefaultConfig()
+	if !assert.Empty(t, c.SweepPolicyHold(r, nil, now), `no rules should keep nothing`) {
+		return
+	}
+
+	c.Policies.Rules = []autolbclean.PolicyRule{
+		{Name: `young-certificates`, Expression: `resource.kind == "sslCertificates" && resource.ageDays <= 30.0`, Action: autolbclean.PolicyKeep},
+	}
+	if !assert.Equal(t, `policy young-certificates keeps sslCertificates k8s2-cr-a`, c.SweepPolicyHold(r, nil, now)) {
+		return
+	}
+
+	c.Policies.Rules[0].Expression = `"keep" in orphan.labels`
+	if !assert.Equal(t, `policy young-certificates keeps sslCertificates k8s2-cr-a`, c.SweepPolicyHold(r, map[string]string{`keep`: `true`}, now), `the labels of the resource should be those of the orphan`) {
+		return
+	}
+	if !assert.Empty(t, c.SweepPolicyHold(r, nil, now), `unlabeled resources should be deleted`) {
+		return
+	}
+}
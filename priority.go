@@ -0,0 +1,80 @@
+package autolbclean
+
+import "sort"
+
+// DefaultQuotaPressureThreshold is the default fraction of a quota
+// that, once in use, makes deletions of that resource kind a priority
+const DefaultQuotaPressureThreshold = 0.8
+
+var kindQuotaMetrics = map[string]string{
+	KindBackendServices:    `BACKEND_SERVICES`,
+	KindFirewalls:          `FIREWALLS`,
+	KindForwardingRules:    `FORWARDING_RULES`,
+	KindHealthChecks:       `HEALTH_CHECKS`,
+	KindHttpHealthChecks:   `HEALTH_CHECKS`,
+	KindHttpsHealthChecks:  `HEALTH_CHECKS`,
+	KindSslCertificates:    `SSL_CERTIFICATES`,
+	KindTargetHttpProxies:  `TARGET_HTTP_PROXIES`,
+	KindTargetHttpsProxies: `TARGET_HTTPS_PROXIES`,
+	KindUrlMaps:            `URL_MAPS`,
+}
+
+// PressuredKinds returns the resource kinds for which the usage of the
+// corresponding quota (in any region) is at or above threshold
+func PressuredKinds(quotas []*QuotaUsage, threshold float64) map[string]struct{} {
+	metrics := make(map[string]struct{})
+	for _, q := range quotas {
+		if q.Ratio() >= threshold {
+			metrics[q.Metric] = struct{}{}
+		}
+	}
+
+	kinds := make(map[string]struct{})
+	for kind, metric := range kindQuotaMetrics {
+		if _, ok := metrics[metric]; ok {
+			kinds[kind] = struct{}{}
+		}
+	}
+	return kinds
+}
+
+// RelievesPressure returns true if deleting this orphan would free up
+// at least one resource of the given kinds
+func (o *Orphan) RelievesPressure(kinds map[string]struct{}) bool {
+	if len(kinds) == 0 {
+		return false
+	}
+	for _, d := range o.Deletions() {
+		if _, ok := kinds[d.Kind]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PrioritizeOrphans orders the orphans so that the ones that relieve
+// quota pressure on the given kinds are deleted first, and splits them
+// into the ones that should be scheduled for deletion in this run and the
+// ones that should be deferred to a later run because they do not fit in
+// the budget. Orphans that relieve quota pressure are exempt from the
+// budget. A budget of 0 or less means there is no limit
+func PrioritizeOrphans(orphans []*Orphan, pressured map[string]struct{}, budget int) (scheduled []*Orphan, deferred []*Orphan) {
+	list := make([]*Orphan, len(orphans))
+	copy(list, orphans)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].RelievesPressure(pressured) && !list[j].RelievesPressure(pressured)
+	})
+
+	var used int
+	for _, o := range list {
+		if o.RelievesPressure(pressured) || budget <= 0 || used < budget {
+			if !o.RelievesPressure(pressured) {
+				used++
+			}
+			scheduled = append(scheduled, o)
+			continue
+		}
+		deferred = append(deferred, o)
+	}
+	return scheduled, deferred
+}
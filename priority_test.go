@@ -0,0 +1,40 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrioritizeOrphans(t *testing.T) {
+	quotas := []*autolbclean.QuotaUsage{
+		{Metric: `SSL_CERTIFICATES`, Region: `global`, Usage: 9, Limit: 10},
+		{Metric: `URL_MAPS`, Region: `global`, Usage: 1, Limit: 10},
+	}
+
+	pressured := autolbclean.PressuredKinds(quotas, 0.8)
+	if !assert.Contains(t, pressured, autolbclean.KindSslCertificates, `ssl certificates should be under pressure`) {
+		return
+	}
+	if !assert.NotContains(t, pressured, autolbclean.KindUrlMaps, `url maps should not be under pressure`) {
+		return
+	}
+
+	orphans := []*autolbclean.Orphan{
+		{TargetProxy: `k8s-tp-1`, UrlMap: `k8s-um-1`},
+		{TargetProxy: `k8s-tp-2`, UrlMap: `k8s-um-2`},
+		{TargetProxy: `k8s-tps-3`, UrlMap: `k8s-um-3`, IsHTTPs: true, Certificates: []string{`https://www.googleapis.com/compute/v1/projects/p/global/sslCertificates/k8s-ssl-3`}},
+	}
+
+	scheduled, deferred := autolbclean.PrioritizeOrphans(orphans, pressured, 1)
+	if !assert.Len(t, scheduled, 2, `2 orphans should be scheduled`) {
+		return
+	}
+	if !assert.Equal(t, `k8s-tps-3`, scheduled[0].TargetProxy, `orphan relieving pressure should go first`) {
+		return
+	}
+	if !assert.Len(t, deferred, 1, `1 orphan should be deferred`) {
+		return
+	}
+}
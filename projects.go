@@ -0,0 +1,58 @@
+package autolbclean
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ParseProjects parses a comma separated list of project IDs. Blank
+// entries are ignored, as are duplicates
+func ParseProjects(s string) []string {
+	var list []string
+	seen := make(map[string]struct{})
+	for _, p := range strings.Split(s, `,`) {
+		p = strings.TrimSpace(p)
+		if len(p) == 0 {
+			continue
+		}
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+		list = append(list, p)
+	}
+	return list
+}
+
+// ParseProjectsFile parses a YAML file listing project IDs, either as
+// a plain list or under a `projects` key
+func ParseProjectsFile(buf []byte) ([]string, error) {
+	var list []string
+	if err := yaml.Unmarshal(buf, &list); err != nil {
+		var doc struct {
+			Projects []string `yaml:"projects"`
+		}
+		if err := yaml.Unmarshal(buf, &doc); err != nil {
+			return nil, errors.Wrap(err, `failed to parse projects file`)
+		}
+		list = doc.Projects
+	}
+
+	projects := ParseProjects(strings.Join(list, `,`))
+	if len(projects) == 0 {
+		return nil, errors.New(`projects file does not list any project`)
+	}
+	return projects, nil
+}
+
+// HasProject returns true if project is one of the given projects
+func HasProject(projects []string, project string) bool {
+	for _, p := range projects {
+		if p == project {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProjects(t *testing.T) {
+	if !assert.Equal(t, []string{`proj-a`, `proj-b`, `proj-c`}, autolbclean.ParseProjects(` proj-a,proj-b,,proj-a, proj-c `), `projects should match`) {
+		return
+	}
+	if !assert.Empty(t, autolbclean.ParseProjects(``), `empty list should have no projects`) {
+		return
+	}
+}
+
+func TestParseProjectsFile(t *testing.T) {
+	for _, src := range []string{
+		"- proj-a\n- proj-b\n",
+		"projects: [ proj-a, proj-b ]\n",
+	} {
+		projects, err := autolbclean.ParseProjectsFile([]byte(src))
+		if !assert.NoError(t, err, `parsing %q should succeed`, src) {
+			return
+		}
+		if !assert.Equal(t, []string{`proj-a`, `proj-b`}, projects, `projects should match`) {
+			return
+		}
+	}
+
+	if _, err := autolbclean.ParseProjectsFile([]byte("projects: []\n")); !assert.Error(t, err, `empty list should be rejected`) {
+		return
+	}
+}
+
+func TestParseImpersonation(t *testing.T) {
+	m, err := autolbclean.ParseImpersonation(`proj-a=cleaner@proj-a.iam.gserviceaccount.com, proj-b=cleaner@proj-b.iam.gserviceaccount.com`)
+	if !assert.NoError(t, err, `parsing should succeed`) {
+		return
+	}
+	if !assert.Equal(t, map[string]string{
+		`proj-a`: `cleaner@proj-a.iam.gserviceaccount.com`,
+		`proj-b`: `cleaner@proj-b.iam.gserviceaccount.com`,
+	}, m, `service accounts should match`) {
+		return
+	}
+
+	for _, s := range []string{
+		`proj-a`,
+		`proj-a=someone@example.com`,
+		`proj-a=cleaner@proj-a.iam.gserviceaccount.com,proj-a=other@proj-a.iam.gserviceaccount.com`,
+	} {
+		if _, err := autolbclean.ParseImpersonation(s); !assert.Error(t, err, `%q should be rejected`, s) {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package autolbclean
+
+import (
+	"context"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// Defaults of the label that opts resources out of the cleanup
+const (
+	DefaultProtectionLabel = `autolbclean`
+	DefaultProtectionValue = `ignore`
+)
+
+// IsProtected returns true if the resource opted out of the cleanup,
+// either through its labels, or, for the resources that can not be
+// labeled, through LABEL=VALUE in its description
+func (c *Config) IsProtected(labels map[string]string, description string) bool {
+	return hasMarker(c.Protection.Label, c.Protection.Value, labels, description)
+}
+
+// hasMarker returns true if the resource carries the given label with
+// the given value, or LABEL=VALUE in its description
+func hasMarker(label, value string, labels map[string]string, description string) bool {
+	if len(label) == 0 {
+		return false
+	}
+	if v, ok := labels[label]; ok && v == value {
+		return true
+	}
+
+	marker := label + `=` + value
+	for _, field := range strings.FieldsFunc(description, isDescriptionSeparator) {
+		if field == marker {
+			return true
+		}
+	}
+	return false
+}
+
+func isDescriptionSeparator(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', ',', ';', '"':
+		return true
+	}
+	return false
+}
+
+func (app *App) getSslCertificate(ctx context.Context, region, name string) (*compute.SslCertificate, error) {
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+	if isGlobal(region) {
+		return app.service.SslCertificates.Get(app.project, name).Context(ctx).Do()
+	}
+	return app.service.RegionSslCertificates.Get(app.project, region, name).Context(ctx).Do()
+}
+
+// certificatesHeldBack returns true if any of the certificates opted
+// out of the cleanup, or is younger than the age threshold of
+// certificates. A certificate that can not be fetched, other than
+// because it is gone, holds the load balancer back too
+func (app *App) certificatesHeldBack(ctx context.Context, certificates []string) bool {
+	c := app.Config()
+	for _, link := range certificates {
+		name, region, err := ParseSslCertificates(link)
+		if err != nil {
+			return true
+		}
+		cert, err := app.getSslCertificate(ctx, region, name)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return true
+		}
+		if c.IsProtected(nil, cert.Description) || c.isYoung(KindSslCertificates, cert.CreationTimestamp) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsProtected(t *testing.T) {
+	c := autolbclean.DefaultConfig()
+
+	if !assert.True(t, c.IsProtected(map[string]string{`autolbclean`: `ignore`}, ``), `label should protect`) {
+		return
+	}
+	if !assert.True(t, c.IsProtected(nil, `hand-crafted, autolbclean=ignore`), `description should protect`) {
+		return
+	}
+	if !assert.False(t, c.IsProtected(map[string]string{`autolbclean`: `delete`}, `autolbclean=ignored`), `other values should not protect`) {
+		return
+	}
+
+	c.Protection.Label = ``
+	if !assert.False(t, c.IsProtected(map[string]string{`autolbclean`: `ignore`}, ``), `an empty label should disable protection`) {
+		return
+	}
+}
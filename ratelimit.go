@@ -0,0 +1,38 @@
+package autolbclean
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *rate.Limiter
+}
+
+func newRateLimiter(qps float64) *rate.Limiter {
+	burst := int(qps)
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+func newRateLimitedTransport(base http.RoundTripper, limiter *rate.Limiter) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &rateLimitedTransport{
+		base:    base,
+		limiter: limiter,
+	}
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
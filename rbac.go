@@ -0,0 +1,120 @@
+package autolbclean
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Roles of the admin API. Each role includes the permissions of the
+// roles before it
+const (
+	RoleViewer   = `viewer`   // may look at candidates and reports
+	RoleOperator = `operator` // may also apply and suppress cleanups
+	RoleAdmin    = `admin`    // may also pause, and look at the configuration
+)
+
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ParseRoleBindings parses a comma separated list of role bindings, such
+// as "alice@example.com=admin,*@example.com=viewer". Members may contain
+// wildcards (as in path.Match). A role followed by /TEAM, as in
+// "bob@example.com=operator/payments", only applies to the load
+// balancers of that team
+func ParseRoleBindings(s string) ([]*RoleBinding, error) {
+	var bindings []*RoleBinding
+	for _, spec := range strings.Split(s, `,`) {
+		spec = strings.TrimSpace(spec)
+		if len(spec) == 0 {
+			continue
+		}
+
+		i := strings.LastIndexByte(spec, '=')
+		if i <= 0 {
+			return nil, errors.Errorf(`invalid role binding %s: expected <member>=<role>`, spec)
+		}
+
+		member := strings.ToLower(strings.TrimSpace(spec[:i]))
+		if _, err := path.Match(member, ``); err != nil {
+			return nil, errors.Wrapf(err, `invalid role binding %s: invalid member pattern`, spec)
+		}
+
+		role := strings.TrimSpace(spec[i+1:])
+		var team string
+		if j := strings.IndexByte(role, '/'); j >= 0 {
+			role, team = strings.TrimSpace(role[:j]), strings.TrimSpace(role[j+1:])
+			if len(team) == 0 {
+				return nil, errors.Errorf(`invalid role binding %s: empty team`, spec)
+			}
+		}
+		if _, ok := roleLevels[role]; !ok {
+			return nil, errors.Errorf(`invalid role binding %s: unknown role %s`, spec, role)
+		}
+
+		bindings = append(bindings, &RoleBinding{
+			Member: member,
+			Role:   role,
+			Team:   team,
+		})
+	}
+	return bindings, nil
+}
+
+// RoleFor returns the most powerful role bound to the given email
+// address for the whole project, or an empty string if there is none.
+// Bindings limited to a team are left out
+func RoleFor(bindings []*RoleBinding, email string) string {
+	return roleFor(bindings, email, false)
+}
+
+// TeamRoleFor returns the most powerful role bound to the given email
+// address, including the bindings limited to a team. It is only good
+// for endpoints that limit what they do to the teams of the caller
+func TeamRoleFor(bindings []*RoleBinding, email string) string {
+	return roleFor(bindings, email, true)
+}
+
+func roleFor(bindings []*RoleBinding, email string, teams bool) string {
+	email = strings.ToLower(email)
+
+	var role string
+	for _, b := range bindings {
+		if len(b.Team) > 0 && !teams {
+			continue
+		}
+		if ok, _ := path.Match(b.Member, email); !ok {
+			continue
+		}
+		if roleLevels[b.Role] > roleLevels[role] {
+			role = b.Role
+		}
+	}
+	return role
+}
+
+// TeamsFor returns the teams whose load balancers the given email
+// address may act on with the given role. all is true if a binding
+// that is not limited to a team grants the role
+func TeamsFor(bindings []*RoleBinding, email, required string) (teams []string, all bool) {
+	email = strings.ToLower(email)
+	for _, b := range bindings {
+		if ok, _ := path.Match(b.Member, email); !ok || !HasRole(b.Role, required) {
+			continue
+		}
+		if len(b.Team) == 0 {
+			return nil, true
+		}
+		teams = append(teams, b.Team)
+	}
+	return teams, false
+}
+
+// HasRole returns true if role grants at least the permissions of required
+func HasRole(role, required string) bool {
+	return len(role) > 0 && roleLevels[role] >= roleLevels[required]
+}
@@ -0,0 +1,64 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleBindings(t *testing.T) {
+	bindings, err := autolbclean.ParseRoleBindings(`alice@example.com=admin, *@example.com=viewer, bob@example.com=operator`)
+	if !assert.NoError(t, err, `ParseRoleBindings should succeed`) {
+		return
+	}
+
+	if !assert.Equal(t, autolbclean.RoleAdmin, autolbclean.RoleFor(bindings, `Alice@example.com`), `alice should be admin`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.RoleOperator, autolbclean.RoleFor(bindings, `bob@example.com`), `bob should be operator`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.RoleViewer, autolbclean.RoleFor(bindings, `carol@example.com`), `carol should be viewer`) {
+		return
+	}
+	if !assert.Equal(t, ``, autolbclean.RoleFor(bindings, `mallory@example.org`), `mallory should have no role`) {
+		return
+	}
+
+	if !assert.True(t, autolbclean.HasRole(autolbclean.RoleAdmin, autolbclean.RoleOperator), `admin should include operator`) {
+		return
+	}
+	if !assert.False(t, autolbclean.HasRole(autolbclean.RoleViewer, autolbclean.RoleOperator), `viewer should not include operator`) {
+		return
+	}
+	if !assert.False(t, autolbclean.HasRole(``, autolbclean.RoleViewer), `no role should not include viewer`) {
+		return
+	}
+
+	bindings, err = autolbclean.ParseRoleBindings(`*@example.com=viewer, bob@example.com=operator/payments`)
+	if !assert.NoError(t, err, `ParseRoleBindings should succeed with teams`) {
+		return
+	}
+	teams, all := autolbclean.TeamsFor(bindings, `bob@example.com`, autolbclean.RoleOperator)
+	if !assert.False(t, all, `bob should not operate on every team`) {
+		return
+	}
+	if !assert.Equal(t, []string{`payments`}, teams, `bob should operate on payments`) {
+		return
+	}
+	if _, all := autolbclean.TeamsFor(bindings, `bob@example.com`, autolbclean.RoleViewer); !assert.True(t, all, `bob should view every team`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.RoleViewer, autolbclean.RoleFor(bindings, `bob@example.com`), `bob should only be viewer of the whole project`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.RoleOperator, autolbclean.TeamRoleFor(bindings, `bob@example.com`), `bob should be operator of the payments team`) {
+		return
+	}
+
+	_, err = autolbclean.ParseRoleBindings(`alice@example.com=root`)
+	if !assert.Error(t, err, `ParseRoleBindings should fail for unknown roles`) {
+		return
+	}
+}
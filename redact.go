@@ -0,0 +1,80 @@
+package autolbclean
+
+import (
+	"context"
+	"io"
+	"regexp"
+)
+
+const redacted = `[REDACTED]`
+
+// redactRules are applied in order by Redact. Each rule replaces the
+// secret part of a match, keeping enough context around it to be
+// able to tell what was there
+var redactRules = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// PEM encoded private keys, e.g. from service account key files
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), redacted},
+	// Authorization headers
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`), `${1}` + redacted},
+	// Google OAuth2 access tokens and refresh tokens
+	{regexp.MustCompile(`ya29\.[A-Za-z0-9._-]+`), redacted},
+	{regexp.MustCompile(`1//[A-Za-z0-9._-]{20,}`), redacted},
+	// tokens, secrets and signatures in JSON documents and form values
+	{regexp.MustCompile(`(?i)("(?:access_token|refresh_token|id_token|client_secret|private_key|signature)"\s*:\s*")[^"]*`), `${1}` + redacted},
+	{regexp.MustCompile(`(?i)((?:access_token|refresh_token|id_token|client_secret|signature)=)[^&\s]+`), `${1}` + redacted},
+	// googleapi errors without structured details include the whole
+	// response body, which may echo back the request
+	{regexp.MustCompile(`(with body: )[\s\S]*`), `${1}` + redacted},
+}
+
+// Redact removes credentials, signatures and raw API response bodies
+// from s. Everything that ends up in logs, notifications and reports
+// goes through here, so that call sites don't have to be careful about
+// what they pass along
+func Redact(s string) string {
+	for _, rule := range redactRules {
+		s = rule.pattern.ReplaceAllString(s, rule.replacement)
+	}
+	return s
+}
+
+// RedactError returns the redacted error message of err
+func RedactError(err error) string {
+	if err == nil {
+		return ``
+	}
+	return Redact(err.Error())
+}
+
+type redactingWriter struct {
+	dst io.Writer
+}
+
+// NewRedactingWriter creates a writer that redacts everything written
+// to it before passing it on to dst. It assumes that each Write
+// contains whole lines, which is what the log package does
+func NewRedactingWriter(dst io.Writer) io.Writer {
+	return &redactingWriter{dst: dst}
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.dst, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type redactingNotifier struct {
+	notifier Notifier
+}
+
+func (n redactingNotifier) Notify(ctx context.Context, msg *Notification) error {
+	return n.notifier.Notify(ctx, &Notification{
+		Project: msg.Project,
+		Subject: Redact(msg.Subject),
+		Body:    Redact(msg.Body),
+	})
+}
@@ -0,0 +1,107 @@
+package autolbclean
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// hashedNamePrefix marks names that were replaced by their hash
+const hashedNamePrefix = `h-`
+
+// Validate returns an error if names are to be hashed without a key.
+// Names that GKE generates are predictable enough that unkeyed hashes
+// could be reversed by hashing guesses
+func (x *ExportRedaction) Validate() error {
+	if x.HashNames && len(x.Key) == 0 {
+		return errors.New(`a key is required to hash names`)
+	}
+	return nil
+}
+
+func (x *ExportRedaction) enabled() bool {
+	return x != nil && (x.HashNames || x.OmitProjects)
+}
+
+// hashName returns the keyed hash of name, or name itself if names are
+// not hashed. The same name always hashes to the same value, so that
+// redacted exports can still be compared with each other
+func (x *ExportRedaction) hashName(name string) string {
+	if !x.HashNames || len(name) == 0 {
+		return name
+	}
+	mac := hmac.New(sha256.New, []byte(x.Key))
+	mac.Write([]byte(name))
+	return hashedNamePrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// Redact returns a copy of the rollup that can be shared outside of the
+// organization. Without project IDs, only the folders and the total
+// are left
+func (r *Rollup) Redact(x *ExportRedaction) *Rollup {
+	if !x.enabled() {
+		return r
+	}
+
+	redacted := &Rollup{
+		GeneratedAt: r.GeneratedAt,
+		Total:       r.Total,
+	}
+	if !x.OmitProjects {
+		for _, s := range r.Projects {
+			copied := *s
+			copied.Project = x.hashName(s.Project)
+			if s.Folder != noFolder {
+				copied.Folder = x.hashName(s.Folder)
+			}
+			redacted.Projects = append(redacted.Projects, &copied)
+		}
+	}
+	for _, f := range r.Folders {
+		copied := *f
+		if f.Folder != noFolder {
+			copied.Folder = x.hashName(f.Folder)
+		}
+		redacted.Folders = append(redacted.Folders, &copied)
+	}
+	return redacted
+}
+
+// Redact returns a copy of the findings that can be shared outside of
+// the project. Self links and IP addresses identify the resources just
+// as well as their names, so they are left out along with them
+func (f *Findings) Redact(x *ExportRedaction) *Findings {
+	if !x.enabled() {
+		return f
+	}
+
+	redacted := &Findings{
+		Schema:      f.Schema,
+		Project:     f.Project,
+		GeneratedAt: f.GeneratedAt,
+		Findings:    make([]*Finding, 0, len(f.Findings)),
+	}
+	if x.OmitProjects {
+		redacted.Project = ``
+	}
+	for _, finding := range f.Findings {
+		copied := *finding
+		copied.SelfLink = ``
+		copied.TargetProxy = x.hashName(finding.TargetProxy)
+		copied.ForwardingRule = x.hashName(finding.ForwardingRule)
+		copied.Cluster = x.hashName(finding.Cluster)
+		if x.HashNames {
+			copied.IPAddress = ``
+		}
+		copied.Resources = make([]*FindingResource, len(finding.Resources))
+		for i, res := range finding.Resources {
+			copiedResource := *res
+			copiedResource.Name = x.hashName(res.Name)
+			copied.Resources[i] = &copiedResource
+		}
+		redacted.Findings = append(redacted.Findings, &copied)
+	}
+	return redacted
+}
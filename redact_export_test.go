@@ -0,0 +1,74 @@
+package autolbclean_test
+
+import (
+	"strings"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactRollup(t *testing.T) {
+	rollup := autolbclean.NewRollup([]*autolbclean.ProjectSummary{
+		{Project: `proj-a`, Folder: `1234`, Orphans: 2},
+		{Project: `proj-b`, Folder: `1234`, Orphans: 1},
+	})
+
+	hashed := rollup.Redact(&autolbclean.ExportRedaction{HashNames: true, Key: `secret`})
+	if !assert.Len(t, hashed.Projects, 2, `projects should be kept`) {
+		return
+	}
+	if !assert.True(t, strings.HasPrefix(hashed.Projects[0].Project, `h-`), `project IDs should be hashed`) {
+		return
+	}
+	if !assert.Equal(t, hashed.Folders[0].Folder, hashed.Projects[0].Folder, `the same name should hash to the same value`) {
+		return
+	}
+	if !assert.Equal(t, `proj-a`, rollup.Projects[0].Project, `the original rollup should be left alone`) {
+		return
+	}
+
+	omitted := rollup.Redact(&autolbclean.ExportRedaction{OmitProjects: true})
+	if !assert.Empty(t, omitted.Projects, `projects should be left out`) {
+		return
+	}
+	if !assert.Equal(t, 3, omitted.Total.Orphans, `totals should be kept`) {
+		return
+	}
+	if !assert.NotContains(t, omitted.String(), `proj-a`, `project IDs should not be rendered`) {
+		return
+	}
+}
+
+func TestRedactFindings(t *testing.T) {
+	report := &autolbclean.Report{
+		Project: `my-project`,
+		Orphans: []*autolbclean.Orphan{
+			{TargetProxy: `k8s-tp-a`, ForwardingRule: `k8s-fw-a`, UrlMap: `k8s-um-a`, IPAddress: `203.0.113.1`, Scheme: `EXTERNAL`, SelfLink: `https://www.googleapis.com/compute/v1/projects/my-project/global/targetHttpProxies/k8s-tp-a`},
+		},
+	}
+
+	findings := report.Findings().Redact(&autolbclean.ExportRedaction{HashNames: true, OmitProjects: true, Key: `secret`})
+	if !assert.Empty(t, findings.Project, `project should be left out`) {
+		return
+	}
+	f := findings.Findings[0]
+	if !assert.Empty(t, f.SelfLink, `self link should be left out`) {
+		return
+	}
+	if !assert.Empty(t, f.IPAddress, `ip address should be left out`) {
+		return
+	}
+	if !assert.True(t, f.InternetFacing, `the finding itself should be kept`) {
+		return
+	}
+	for _, res := range f.Resources {
+		if !assert.True(t, strings.HasPrefix(res.Name, `h-`), `resource names should be hashed`) {
+			return
+		}
+	}
+
+	if err := (&autolbclean.ExportRedaction{HashNames: true}).Validate(); !assert.Error(t, err, `hashing without a key should be rejected`) {
+		return
+	}
+}
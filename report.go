@@ -0,0 +1,211 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// reportedQuotaMetrics lists the quota metrics that are included in
+// the run report. These are the resources that this tool cleans up,
+// and running out of them is what blocks new load balancers from being
+// created
+var reportedQuotaMetrics = map[string]struct{}{
+	`BACKEND_SERVICES`:     {},
+	`FIREWALLS`:            {},
+	`FORWARDING_RULES`:     {},
+	`HEALTH_CHECKS`:        {},
+	`SSL_CERTIFICATES`:     {},
+	`TARGET_HTTP_PROXIES`:  {},
+	`TARGET_HTTPS_PROXIES`: {},
+	`URL_MAPS`:             {},
+}
+
+// Ratio returns the fraction of the quota that is in use
+func (q *QuotaUsage) Ratio() float64 {
+	if q.Limit <= 0 {
+		return 0
+	}
+	return q.Usage / q.Limit
+}
+
+func (q *QuotaUsage) String() string {
+	return fmt.Sprintf(`%s (%s): %.0f/%.0f (%.1f%%)`, q.Metric, q.Region, q.Usage, q.Limit, q.Ratio()*100)
+}
+
+func makeQuotaUsage(region string, quotas []*compute.Quota) []*QuotaUsage {
+	var list []*QuotaUsage
+	for _, q := range quotas {
+		if _, ok := reportedQuotaMetrics[q.Metric]; !ok {
+			continue
+		}
+		list = append(list, &QuotaUsage{
+			Metric: q.Metric,
+			Region: region,
+			Usage:  q.Usage,
+			Limit:  q.Limit,
+		})
+	}
+	return list
+}
+
+// ListQuotas returns the current usage and limits of the quotas for
+// the resources that we clean up, both for the project as a whole
+// (global) and for each region
+func (app *App) ListQuotas(ctx context.Context) ([]*QuotaUsage, error) {
+	getCtx, cancel := app.getContext(ctx)
+	defer cancel()
+
+	project, err := app.service.Projects.Get(app.project).Context(getCtx).Do()
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to get project`)
+	}
+
+	list := makeQuotaUsage(globalRegion, project.Quotas)
+
+	listCtx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	err = app.service.Regions.List(app.project).Pages(listCtx, func(regions *compute.RegionList) error {
+		for _, region := range regions.Items {
+			list = append(list, makeQuotaUsage(region.Name, region.Quotas)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list regions`)
+	}
+	return list, nil
+}
+
+// String renders the report in a human readable form
+func (r *Report) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Run report for project %s (%s - %s)\n", r.Project, r.StartedAt.Format(timeFormat), r.FinishedAt.Format(timeFormat))
+	fmt.Fprintf(&buf, "Orphaned load balancers: %d\n", len(r.Orphans))
+	for _, o := range r.Orphans {
+		fmt.Fprintf(&buf, "  - %s (forwarding rule = %q, url map = %s", o.TargetProxy, o.ForwardingRule, o.UrlMap)
+		if len(o.Cluster) > 0 {
+			fmt.Fprintf(&buf, ", cluster = %s", o.Cluster)
+		}
+		if o.ClusterDeleted {
+			fmt.Fprintf(&buf, ", cluster confirmed deleted")
+		}
+		if o.Confidence != nil {
+			fmt.Fprintf(&buf, ", confidence = %d", o.Confidence.Score)
+		}
+		if len(o.PolicyHold) > 0 {
+			fmt.Fprintf(&buf, ", %s", o.PolicyHold)
+		}
+		if o.Snoozes > 0 {
+			fmt.Fprintf(&buf, ", snoozed %d times before", o.Snoozes)
+		}
+		fmt.Fprintf(&buf, ")\n")
+	}
+
+	if len(r.Deferred) > 0 {
+		fmt.Fprintf(&buf, "Deferred to the next run: %d\n", len(r.Deferred))
+	}
+
+	if r.Stats != nil {
+		fmt.Fprintf(&buf, "New orphans: %d, oldest pending: %.1f days\n", r.Stats.NewOrphans, r.Stats.MaxPendingDays)
+	}
+
+	if len(r.Quotas) > 0 {
+		fmt.Fprintf(&buf, "Quota usage:\n")
+		for _, q := range r.Quotas {
+			// regional quotas that are not in use at all are just noise
+			if q.Region != globalRegion && q.Usage == 0 {
+				continue
+			}
+			fmt.Fprintf(&buf, "  - %s\n", q)
+		}
+	}
+
+	if len(r.Retries) > 0 {
+		fmt.Fprintf(&buf, "Retried deletions:\n")
+		for _, h := range r.Retries {
+			fmt.Fprintf(&buf, "  - %s\n", h)
+		}
+	}
+
+	if len(r.Access) > 0 {
+		fmt.Fprintf(&buf, "Admin API access:\n")
+		for _, e := range r.Access {
+			fmt.Fprintf(&buf, "  - %s\n", e)
+		}
+	}
+	return buf.String()
+}
+
+// Skip records that the resource was not scheduled for deletion
+func (r *Report) Skip(d *Deletion, reason string) {
+	r.Skipped = append(r.Skipped, &SkippedResource{
+		Kind:   d.Kind,
+		Name:   d.Name,
+		Region: d.Region,
+		Reason: reason,
+	})
+}
+
+// SkipOrphan records that none of the resources of the load balancer
+// were scheduled for deletion. It is identified by its target proxy
+func (r *Report) SkipOrphan(o *Orphan, reason string) {
+	r.Skip(&Deletion{Kind: o.kind(), Name: o.TargetProxy, Region: o.Region}, reason)
+}
+
+// OrphanSet identifies the orphaned load balancers found in the run, so
+// that a run that found the same ones as the run before can tell
+func (r *Report) OrphanSet() string {
+	keys := make([]string, 0, len(r.Orphans))
+	for _, o := range r.Orphans {
+		keys = append(keys, o.Region+`/`+o.ForwardingRule)
+	}
+	sort.Strings(keys)
+
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Summary describes the decisions made in the run, for notification
+// sinks that are read by people, such as a chat channel
+func (r *Report) Summary() *Notification {
+	var buf bytes.Buffer
+	if len(r.Scheduled) > 0 {
+		fmt.Fprintf(&buf, "Scheduled for deletion:\n")
+		for _, d := range r.Scheduled {
+			fmt.Fprintf(&buf, "  - %s %s", d.Kind, d.Name)
+			if len(d.Region) > 0 {
+				fmt.Fprintf(&buf, " (%s)", d.Region)
+			}
+			fmt.Fprintf(&buf, "\n")
+		}
+	}
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(&buf, "Skipped:\n")
+		for _, s := range r.Skipped {
+			fmt.Fprintf(&buf, "  - %s %s: %s\n", s.Kind, s.Name, s.Reason)
+		}
+	}
+
+	return &Notification{
+		Project: r.Project,
+		Subject: fmt.Sprintf(`found %d orphaned load balancers, scheduled %d resources for deletion, skipped %d`, len(r.Orphans), len(r.Scheduled), len(r.Skipped)),
+		Body:    buf.String(),
+	}
+}
+
+func (e *AccessLogEntry) String() string {
+	email := e.Email
+	if len(email) == 0 {
+		email = `(unidentified)`
+	}
+	return fmt.Sprintf(`%s %s (%s) from %s: %s %s %s -> %d`, e.At.Format(timeFormat), email, e.Role, e.RemoteAddr, e.Method, e.Path, e.Params, e.Status)
+}
@@ -0,0 +1,151 @@
+package autolbclean
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRetryConfig returns the default retry policies. Reads are
+// retried freely, while mutations are only retried when the API tells
+// us that it did not even look at the request, as retrying deletes
+// aggressively can mask real problems
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		Read: RetryPolicy{
+			Attempts:       5,
+			BaseDelay:      200 * time.Millisecond,
+			MaxDelay:       10 * time.Second,
+			RetryableCodes: []int{429, 500, 502, 503, 504},
+		},
+		Mutation: RetryPolicy{
+			Attempts:       2,
+			BaseDelay:      time.Second,
+			MaxDelay:       10 * time.Second,
+			RetryableCodes: []int{429, 503},
+		},
+	}
+}
+
+func (p *RetryPolicy) validate() error {
+	if p.Attempts < 1 {
+		return errors.New(`attempts must be at least 1`)
+	}
+	if p.BaseDelay < 0 || p.MaxDelay < p.BaseDelay {
+		return errors.New(`delays must satisfy 0 <= base_delay <= max_delay`)
+	}
+	return nil
+}
+
+func (p *RetryPolicy) isRetryable(code int) bool {
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the given retry (starting at
+// 0), using exponential backoff with full jitter
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 0; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// isRead returns true if the request does not change anything. Waiting
+// for operations and testing permissions are POSTs, but are reads as
+// far as retrying is concerned
+func isRead(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	}
+	return strings.HasSuffix(req.URL.Path, `/wait`) || strings.HasSuffix(req.URL.Path, `:testIamPermissions`)
+}
+
+type retryTransport struct {
+	base   http.RoundTripper
+	config func() *Config
+}
+
+// newRetryTransport creates a transport that retries failed requests
+// according to the retry policies of the configuration in effect at
+// the time of the request
+func newRetryTransport(base http.RoundTripper, config func() *Config) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{base: base, config: config}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	read := isRead(req)
+	policy := t.config().Retry.Mutation
+	if read {
+		policy = t.config().Retry.Read
+	}
+
+	for attempt := 1; ; attempt++ {
+		res, err := t.base.RoundTrip(req)
+
+		var retryable bool
+		switch {
+		case err != nil:
+			// we can't tell whether a mutation made it through or not
+			retryable = read && req.Context().Err() == nil
+		default:
+			retryable = policy.isRetryable(res.StatusCode)
+		}
+
+		if !retryable || attempt >= policy.Attempts {
+			return res, err
+		}
+
+		// requests with a body can only be retried if it can be replayed
+		if req.Body != nil && req.GetBody == nil {
+			return res, err
+		}
+
+		if res != nil {
+			res.Body.Close()
+		}
+
+		if err := sleepContext(req.Context(), policy.delay(attempt-1)); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, `failed to replay request body`)
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// noFolder is the folder name used for projects that live directly
+// under the organization, or whose folder could not be resolved
+const noFolder = `(none)`
+
+// EstimatedMonthlyCost is the rough monthly list price, in USD, of a
+// single resource of each kind. Only forwarding rules and reserved
+// addresses are billed on their own: url maps, proxies, backend
+// services, health checks and certificates are free of charge, but
+// count against quota
+var EstimatedMonthlyCost = map[string]float64{
+	KindForwardingRules: 18.25, // $0.025/hour
+	KindAddresses:       7.30,  // $0.01/hour while not in use
+}
+
+// Folder returns the ID of the folder that the project belongs to, or
+// an empty string if the project's parent is not a folder
+func (app *App) Folder(ctx context.Context) (string, error) {
+	getCtx, cancel := app.getContext(ctx)
+	defer cancel()
+
+	project, err := app.crm.Projects.Get(app.project).Context(getCtx).Do()
+	if err != nil {
+		return ``, errors.Wrap(err, `failed to get project`)
+	}
+
+	if project.Parent == nil || project.Parent.Type != `folder` {
+		return ``, nil
+	}
+	return project.Parent.Id, nil
+}
+
+// SummarizeWorkerResult creates the rollup entry for the given run.
+// In plan-only mode, the deletions and savings are the ones that would
+// have been achieved
+func SummarizeWorkerResult(r *WorkerResult, folder string) *ProjectSummary {
+	if len(folder) == 0 {
+		folder = noFolder
+	}
+
+	s := &ProjectSummary{
+		Project:  r.Project,
+		Folder:   folder,
+		Status:   r.Status,
+		PlanOnly: r.PlanOnly,
+		Orphans:  r.Orphans,
+	}
+	for _, d := range r.Deletions {
+		if len(d.Error) > 0 {
+			s.Failures++
+			continue
+		}
+		if !d.Deleted && !r.PlanOnly {
+			continue
+		}
+		s.Deletions++
+		s.Savings += EstimatedMonthlyCost[d.Kind]
+	}
+	return s
+}
+
+func (f *FolderSummary) add(s *ProjectSummary) {
+	f.Projects++
+	f.Orphans += s.Orphans
+	f.Deletions += s.Deletions
+	f.Failures += s.Failures
+	f.Savings += s.Savings
+}
+
+// NewRollup aggregates the given project summaries per folder, and
+// for the whole organization
+func NewRollup(projects []*ProjectSummary) *Rollup {
+	r := &Rollup{
+		GeneratedAt: time.Now().UTC(),
+		Projects:    projects,
+	}
+
+	folders := make(map[string]*FolderSummary)
+	for _, s := range projects {
+		f, ok := folders[s.Folder]
+		if !ok {
+			f = &FolderSummary{Folder: s.Folder}
+			folders[s.Folder] = f
+			r.Folders = append(r.Folders, f)
+		}
+		f.add(s)
+		r.Total.add(s)
+	}
+
+	sort.Slice(r.Projects, func(i, j int) bool {
+		return r.Projects[i].Project < r.Projects[j].Project
+	})
+	sort.Slice(r.Folders, func(i, j int) bool {
+		return r.Folders[i].Folder < r.Folders[j].Folder
+	})
+	return r
+}
+
+// String renders the rollup in a human readable form
+func (r *Rollup) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Rollup report (%s)\n", r.GeneratedAt.Format(timeFormat))
+	fmt.Fprintf(&buf, "Total: %d projects, %d orphans, %d deletions, %d failures, ~$%.2f/month saved\n",
+		r.Total.Projects, r.Total.Orphans, r.Total.Deletions, r.Total.Failures, r.Total.Savings)
+
+	fmt.Fprintf(&buf, "Folders:\n")
+	for _, f := range r.Folders {
+		fmt.Fprintf(&buf, "  - %s: %d projects, %d orphans, %d deletions, %d failures, ~$%.2f/month\n",
+			f.Folder, f.Projects, f.Orphans, f.Deletions, f.Failures, f.Savings)
+	}
+
+	if len(r.Projects) == 0 {
+		return buf.String()
+	}
+	fmt.Fprintf(&buf, "Projects:\n")
+	for _, s := range r.Projects {
+		var planOnly string
+		if s.PlanOnly {
+			planOnly = ` (plan only)`
+		}
+		fmt.Fprintf(&buf, "  - %s [%s] %s%s: %d orphans, %d deletions, %d failures, ~$%.2f/month\n",
+			s.Project, s.Folder, s.Status, planOnly, s.Orphans, s.Deletions, s.Failures, s.Savings)
+	}
+	return buf.String()
+}
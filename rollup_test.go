@@ -0,0 +1,57 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollup(t *testing.T) {
+	a := autolbclean.SummarizeWorkerResult(&autolbclean.WorkerResult{
+		Project: `proj-a`,
+		Orphans: 1,
+		Deletions: []*autolbclean.DeletionResult{
+			{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-1`, Deleted: true},
+			{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-1`, Error: `denied`},
+		},
+	}, `1234`)
+	b := autolbclean.SummarizeWorkerResult(&autolbclean.WorkerResult{
+		Project:  `proj-b`,
+		PlanOnly: true,
+		Orphans:  1,
+		Deletions: []*autolbclean.DeletionResult{
+			{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-2`},
+		},
+	}, ``)
+	c := autolbclean.SummarizeWorkerResult(&autolbclean.WorkerResult{
+		Project: `proj-c`,
+	}, `1234`)
+
+	if !assert.Equal(t, 1, a.Deletions, `failed deletions should not be counted`) {
+		return
+	}
+	if !assert.Equal(t, 1, a.Failures, `failed deletions should be counted as failures`) {
+		return
+	}
+	if !assert.Equal(t, 1, b.Deletions, `planned deletions should be counted in plan-only mode`) {
+		return
+	}
+
+	r := autolbclean.NewRollup([]*autolbclean.ProjectSummary{c, b, a})
+	if !assert.Len(t, r.Folders, 2, `there should be 2 folders`) {
+		return
+	}
+	if !assert.Equal(t, 2, r.Folders[1].Projects, `folder 1234 should have 2 projects`) {
+		return
+	}
+	if !assert.Equal(t, 3, r.Total.Projects, `total should include all projects`) {
+		return
+	}
+	if !assert.Equal(t, 2*autolbclean.EstimatedMonthlyCost[autolbclean.KindForwardingRules], r.Total.Savings, `savings should match`) {
+		return
+	}
+	if !assert.Equal(t, `proj-a`, r.Projects[0].Project, `projects should be sorted`) {
+		return
+	}
+}
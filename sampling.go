@@ -0,0 +1,60 @@
+package autolbclean
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sampledDecisions lists the decisions whose logs can be sampled.
+// Failures are always logged
+var sampledDecisions = map[string]struct{}{
+	DecisionScheduled: {},
+	DecisionSkipped:   {},
+	DecisionDeleted:   {},
+}
+
+// DecisionSampling holds the fraction of the decisions of each kind
+// whose log lines are written. Decisions that are not listed are all
+// logged
+type DecisionSampling map[string]float64
+
+// ParseDecisionSampling parses a comma separated list of DECISION=RATE,
+// such as "scheduled=1,skipped=0.01". A rate of 0 turns off the logs of
+// that decision
+func ParseDecisionSampling(s string) (DecisionSampling, error) {
+	sampling := make(DecisionSampling)
+	for _, spec := range strings.Split(s, `,`) {
+		spec = strings.TrimSpace(spec)
+		if len(spec) == 0 {
+			continue
+		}
+
+		i := strings.Index(spec, `=`)
+		if i < 0 {
+			return nil, errors.Errorf(`invalid decision sampling %s, expected DECISION=RATE`, spec)
+		}
+		decision := spec[:i]
+		if _, ok := sampledDecisions[decision]; !ok {
+			return nil, errors.Errorf(`logs of %s decisions can not be sampled`, decision)
+		}
+		rate, err := strconv.ParseFloat(spec[i+1:], 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, errors.Errorf(`invalid sampling rate for %s, expected a number between 0 and 1`, decision)
+		}
+		sampling[decision] = rate
+	}
+	return sampling, nil
+}
+
+// Sampled returns true if this occurrence of the decision should be
+// logged
+func (s DecisionSampling) Sampled(decision string) bool {
+	rate, ok := s[decision]
+	if !ok || rate >= 1 {
+		return true
+	}
+	return rand.Float64() < rate
+}
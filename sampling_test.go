@@ -0,0 +1,30 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDecisionSampling(t *testing.T) {
+	sampling, err := autolbclean.ParseDecisionSampling(`skipped=0, deleted=1`)
+	if !assert.NoError(t, err, `ParseDecisionSampling should succeed`) {
+		return
+	}
+	if !assert.False(t, sampling.Sampled(autolbclean.DecisionSkipped), `skips should not be logged`) {
+		return
+	}
+	if !assert.True(t, sampling.Sampled(autolbclean.DecisionDeleted), `deletions should be logged`) {
+		return
+	}
+	if !assert.True(t, sampling.Sampled(autolbclean.DecisionScheduled), `decisions that are not listed should be logged`) {
+		return
+	}
+
+	for _, s := range []string{`failed=0.5`, `skipped=2`, `skipped`, `skipped=often`} {
+		if _, err := autolbclean.ParseDecisionSampling(s); !assert.Error(t, err, `%s should be rejected`, s) {
+			return
+		}
+	}
+}
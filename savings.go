@@ -0,0 +1,231 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// savingsWindow is the period that the cost of a resource before its
+// deletion is measured over, and that the cost after its deletion is
+// scaled to
+const savingsWindow = 30 * 24 * time.Hour
+
+const day = 24 * time.Hour
+
+var billingTableRx = regexp.MustCompile(`^[a-zA-Z0-9_.:-]+$`)
+
+// ValidateBillingTable checks that table looks like a BigQuery table
+// name (project.dataset.table), as it is spliced into the query
+func ValidateBillingTable(table string) error {
+	if !billingTableRx.MatchString(table) {
+		return errors.Errorf(`invalid billing export table %q`, table)
+	}
+	return nil
+}
+
+// GlobalName returns the full resource name of the deleted resource
+func (r *DeletionRecord) GlobalName() string {
+	d := Deletion{Kind: r.Kind, Name: r.Name, Region: r.Region, Zone: r.Zone}
+	return d.GlobalName(r.Project)
+}
+
+// Monthly returns the realized monthly savings
+func (s *RealizedSaving) Monthly() float64 {
+	return s.Before - s.After
+}
+
+// RecordDeletion adds the deletion to the audit history, along with the
+// attempt and the number of requeues it took. It is a no-op when there
+// is no audit store
+func (app *App) RecordDeletion(ctx context.Context, d *Deletion, attempt, requeues int) error {
+	if app.auditStore == nil {
+		return nil
+	}
+	return app.auditStore.RecordDeletion(ctx, &DeletionRecord{
+		Project:   app.project,
+		Kind:      d.Kind,
+		Name:      d.Name,
+		Region:    d.Region,
+		Zone:      d.Zone,
+		DeletedAt: time.Now().UTC(),
+		Attempt:   attempt,
+		Requeues:  requeues,
+	})
+}
+
+// QueryBillingCosts returns the daily cost of the resources identified
+// by names, since the given time. table must be a detailed (resource
+// level) billing export table, as only those carry resource names
+func (app *App) QueryBillingCosts(ctx context.Context, table string, names []string, since time.Time) ([]*BillingCost, error) {
+	if err := ValidateBillingTable(table); err != nil {
+		return nil, err
+	}
+
+	client, err := bigquery.NewClient(ctx, app.project, option.WithHTTPClient(app.client))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create bigquery client`)
+	}
+	defer client.Close()
+
+	q := client.Query("SELECT resource.global_name AS global_name, TIMESTAMP_TRUNC(usage_start_time, DAY) AS day, SUM(cost) AS cost" +
+		" FROM `" + table + "`" +
+		" WHERE resource.global_name IN UNNEST(@names) AND usage_start_time >= @since" +
+		" GROUP BY global_name, day")
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: `names`, Value: names},
+		{Name: `since`, Value: since},
+	}
+
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to query billing export`)
+	}
+
+	var costs []*BillingCost
+	for {
+		var row struct {
+			GlobalName string    `bigquery:"global_name"`
+			Day        time.Time `bigquery:"day"`
+			Cost       float64   `bigquery:"cost"`
+		}
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to read billing export`)
+		}
+		costs = append(costs, &BillingCost{
+			GlobalName: row.GlobalName,
+			Day:        row.Day,
+			Cost:       row.Cost,
+		})
+	}
+	return costs, nil
+}
+
+// ComputeRealizedSavings correlates the deletions with their daily
+// costs. The day of the deletion itself is only partially billed, and
+// is not counted on either side. The cost after the deletion is scaled
+// to the savings window, so that it is comparable with the cost before
+func ComputeRealizedSavings(records []*DeletionRecord, costs []*BillingCost, now time.Time) []*RealizedSaving {
+	byName := make(map[string][]*BillingCost)
+	for _, c := range costs {
+		byName[c.GlobalName] = append(byName[c.GlobalName], c)
+	}
+
+	today := now.UTC().Truncate(day)
+	var list []*RealizedSaving
+	for _, r := range records {
+		deletedOn := r.DeletedAt.UTC().Truncate(day)
+		s := &RealizedSaving{Deletion: r}
+
+		var after float64
+		for _, c := range byName[r.GlobalName()] {
+			d := c.Day.UTC().Truncate(day)
+			switch {
+			case d.Before(deletedOn) && !d.Before(deletedOn.Add(-savingsWindow)):
+				s.Before += c.Cost
+			case d.After(deletedOn) && d.Before(today):
+				after += c.Cost
+			}
+		}
+
+		// full days that have been billed since the deletion
+		if elapsed := today.Sub(deletedOn.Add(day)); elapsed > 0 {
+			s.After = after * float64(savingsWindow) / float64(elapsed)
+		}
+		list = append(list, s)
+	}
+	return list
+}
+
+// MonthlyDigest summarizes the deletions recorded in the audit history
+// during the month that contains the given time, from midnight on its
+// first day to midnight on the first day of the next, in the time zone
+// of the configuration. When billingTable is not empty, the realized
+// savings of the deletions of billed resources are computed from the
+// billing export
+func (app *App) MonthlyDigest(ctx context.Context, month time.Time, billingTable string) (*Digest, error) {
+	if app.auditStore == nil {
+		return nil, errors.New(`monthly digest requires an audit store`)
+	}
+
+	loc := app.Config().Location()
+	month = month.In(loc)
+	since := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, loc)
+	until := time.Date(month.Year(), month.Month()+1, 1, 0, 0, 0, 0, loc)
+
+	all, err := app.auditStore.ListDeletions(ctx, since, until)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list deletions`)
+	}
+
+	// the audit store may be shared between projects
+	var records []*DeletionRecord
+	for _, r := range all {
+		if r.Project == app.project {
+			records = append(records, r)
+		}
+	}
+
+	digest := &Digest{
+		Project:   app.project,
+		Month:     since,
+		Deletions: records,
+	}
+
+	var billed []*DeletionRecord
+	var names []string
+	for _, r := range records {
+		cost, ok := EstimatedMonthlyCost[r.Kind]
+		if !ok {
+			continue
+		}
+		digest.EstimatedSavings += cost
+		billed = append(billed, r)
+		names = append(names, r.GlobalName())
+	}
+
+	if len(billingTable) == 0 || len(billed) == 0 {
+		return digest, nil
+	}
+
+	costs, err := app.QueryBillingCosts(ctx, billingTable, names, since.Add(-savingsWindow))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to query billing costs`)
+	}
+	digest.Realized = ComputeRealizedSavings(billed, costs, time.Now())
+	return digest, nil
+}
+
+// RealizedSavings returns the total realized monthly savings
+func (d *Digest) RealizedSavings() float64 {
+	var total float64
+	for _, s := range d.Realized {
+		total += s.Monthly()
+	}
+	return total
+}
+
+func (d *Digest) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Monthly digest for %s (%s)\n", d.Project, d.Month.Format(`2006-01`))
+	fmt.Fprintf(&buf, "  deleted resources: %d\n", len(d.Deletions))
+	fmt.Fprintf(&buf, "  estimated savings: $%.2f/month\n", d.EstimatedSavings)
+	if len(d.Realized) > 0 {
+		fmt.Fprintf(&buf, "  realized savings:  $%.2f/month\n", d.RealizedSavings())
+		for _, s := range d.Realized {
+			fmt.Fprintf(&buf, "    %s %s: $%.2f before, $%.2f after\n", s.Deletion.Kind, s.Deletion.Name, s.Before, s.After)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,47 @@
+package autolbclean_test
+
+import (
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeRealizedSavings(t *testing.T) {
+	r := &autolbclean.DeletionRecord{
+		Project:   `p`,
+		Kind:      autolbclean.KindForwardingRules,
+		Name:      `k8s-fw-1`,
+		Region:    `asia-northeast1`,
+		DeletedAt: time.Date(2026, 9, 10, 12, 0, 0, 0, time.UTC),
+	}
+	if !assert.Equal(t, `//compute.googleapis.com/projects/p/regions/asia-northeast1/forwardingRules/k8s-fw-1`, r.GlobalName(), `global name should match`) {
+		return
+	}
+
+	var costs []*autolbclean.BillingCost
+	for d := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC); d.Before(time.Date(2026, 9, 21, 0, 0, 0, 0, time.UTC)); d = d.AddDate(0, 0, 1) {
+		cost := 0.6
+		if !d.Before(time.Date(2026, 9, 11, 0, 0, 0, 0, time.UTC)) {
+			cost = 0.1 // the ephemeral IP that went away a bit later
+		}
+		costs = append(costs, &autolbclean.BillingCost{GlobalName: r.GlobalName(), Day: d, Cost: cost})
+	}
+	// costs of other resources must not be counted
+	costs = append(costs, &autolbclean.BillingCost{GlobalName: `//compute.googleapis.com/projects/p/global/forwardingRules/other`, Day: r.DeletedAt, Cost: 100})
+
+	list := autolbclean.ComputeRealizedSavings([]*autolbclean.DeletionRecord{r}, costs, time.Date(2026, 9, 21, 8, 0, 0, 0, time.UTC))
+	if !assert.Len(t, list, 1, `there should be one saving`) {
+		return
+	}
+	if !assert.InDelta(t, 18.0, list[0].Before, 0.001, `cost before should cover 30 days`) {
+		return
+	}
+	if !assert.InDelta(t, 3.0, list[0].After, 0.001, `cost after should be scaled to 30 days`) {
+		return
+	}
+	if !assert.InDelta(t, 15.0, list[0].Monthly(), 0.001, `monthly savings should match`) {
+		return
+	}
+}
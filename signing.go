@@ -0,0 +1,62 @@
+package autolbclean
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// taskSignatureParam is the parameter that carries the signature of a
+// task
+const taskSignatureParam = `signature`
+
+// taskSignature returns the HMAC-SHA256 of the path and the parameters
+// of a task, other than its signature. The parameters include the name
+// and region of the resource, when the job expires, the project, and
+// the rest of the deletion chain, so none of them can be changed
+// without invalidating the signature
+func taskSignature(key []byte, path string, params url.Values) string {
+	v := make(url.Values, len(params))
+	for k, list := range params {
+		if k != taskSignatureParam {
+			v[k] = list
+		}
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(path))
+	mac.Write([]byte{'?'})
+	mac.Write([]byte(v.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignTask signs the task with the given key
+func SignTask(key []byte, t *Task) {
+	if t.Params == nil {
+		t.Params = url.Values{}
+	}
+	t.Params.Set(taskSignatureParam, taskSignature(key, t.Path, t.Params))
+}
+
+// VerifyTaskRequest returns an error unless the request carries the
+// parameters of a task signed with the given key, as they were when
+// the task was signed
+func VerifyTaskRequest(key []byte, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return errors.Wrap(err, `failed to parse request`)
+	}
+
+	sig := r.Form.Get(taskSignatureParam)
+	if len(sig) == 0 {
+		return errors.New(`task is not signed`)
+	}
+	expected := taskSignature(key, r.URL.Path, r.Form)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return errors.New(`invalid task signature`)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package autolbclean_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignTask(t *testing.T) {
+	key := []byte(`s3cr3t`)
+	task := autolbclean.DeletionTask(&autolbclean.Deletion{
+		Kind:   autolbclean.KindUrlMaps,
+		Name:   `k8s-um-default-foo`,
+		Region: `global`,
+	}, `2026-10-16T00:00:00Z`)
+	autolbclean.SignTask(key, task)
+
+	post := func(path, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set(`Content-Type`, `application/x-www-form-urlencoded`)
+		return r
+	}
+
+	body := task.Params.Encode()
+	if !assert.NoError(t, autolbclean.VerifyTaskRequest(key, post(task.Path, body)), `signed task should be accepted`) {
+		return
+	}
+	if !assert.Error(t, autolbclean.VerifyTaskRequest([]byte(`other`), post(task.Path, body)), `task signed with another key should be rejected`) {
+		return
+	}
+	if !assert.Error(t, autolbclean.VerifyTaskRequest(key, post(`/job/backend-services/delete`, body)), `task posted to another job should be rejected`) {
+		return
+	}
+
+	tampered := strings.Replace(body, `k8s-um-default-foo`, `production-lb`, 1)
+	if !assert.Error(t, autolbclean.VerifyTaskRequest(key, post(task.Path, tampered)), `tampered task should be rejected`) {
+		return
+	}
+
+	task.Params.Del(`signature`)
+	if !assert.Error(t, autolbclean.VerifyTaskRequest(key, post(task.Path, task.Params.Encode())), `unsigned task should be rejected`) {
+		return
+	}
+}
@@ -0,0 +1,87 @@
+package autolbclean
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// snoozeHistory is how long expired snoozes are remembered, so that
+// the orphans that come back can be reported along with their snoozes
+const snoozeHistory = 90 * 24 * time.Hour
+
+// ParseSnoozeDuration parses the duration of a snooze, which may be
+// given in days (7d) in addition to the units of time.ParseDuration
+func ParseSnoozeDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	if strings.HasSuffix(s, `d`) {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, `d`))
+		if err != nil {
+			return 0, errors.Errorf(`invalid snooze duration %q`, s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, errors.Errorf(`invalid snooze duration %q`, s)
+		}
+		d = v
+	}
+
+	if d <= 0 {
+		return 0, errors.Errorf(`snooze duration must be positive, got %q`, s)
+	}
+	return d, nil
+}
+
+// AddSnooze snoozes the orphan with the given self link until now + d,
+// and returns the updated list. Snoozing an orphan again extends its
+// snooze, and counts it. Snoozes that expired long ago are forgotten
+func AddSnooze(list []Snooze, selfLink string, d time.Duration, by string, now time.Time) []Snooze {
+	var result []Snooze
+	count := 1
+	for _, s := range list {
+		if s.SelfLink == selfLink {
+			count = s.Count + 1
+			continue
+		}
+		if now.Sub(s.Until) > snoozeHistory {
+			continue
+		}
+		result = append(result, s)
+	}
+	return append(result, Snooze{
+		SelfLink: selfLink,
+		Until:    now.Add(d),
+		Count:    count,
+		By:       by,
+	})
+}
+
+// ApplySnoozes drops the orphans that are currently snoozed, and notes
+// how many times the rest have been snoozed before
+func ApplySnoozes(orphans []*Orphan, snoozes []Snooze, now time.Time) []*Orphan {
+	if len(snoozes) == 0 {
+		return orphans
+	}
+
+	bySelfLink := make(map[string]Snooze)
+	for _, s := range snoozes {
+		bySelfLink[s.SelfLink] = s
+	}
+
+	var result []*Orphan
+	for _, o := range orphans {
+		s, ok := bySelfLink[o.SelfLink]
+		if ok && now.Before(s.Until) {
+			continue
+		}
+		if ok {
+			o.Snoozes = s.Count
+		}
+		result = append(result, o)
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package autolbclean_test
+
+import (
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSnoozeDuration(t *testing.T) {
+	for in, expected := range map[string]time.Duration{
+		`7d`:  7 * 24 * time.Hour,
+		`36h`: 36 * time.Hour,
+	} {
+		d, err := autolbclean.ParseSnoozeDuration(in)
+		if !assert.NoError(t, err, `parsing %q should succeed`, in) {
+			return
+		}
+		if !assert.Equal(t, expected, d, `duration should match`) {
+			return
+		}
+	}
+
+	for _, in := range []string{``, `d`, `-1d`, `0h`, `week`} {
+		_, err := autolbclean.ParseSnoozeDuration(in)
+		if !assert.Error(t, err, `parsing %q should fail`, in) {
+			return
+		}
+	}
+}
+
+func TestSnooze(t *testing.T) {
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	snoozes := autolbclean.AddSnooze(nil, `tp-1`, 7*24*time.Hour, `alice@example.com`, now)
+
+	orphans := []*autolbclean.Orphan{{SelfLink: `tp-1`}, {SelfLink: `tp-2`}}
+	result := autolbclean.ApplySnoozes(orphans, snoozes, now.Add(time.Hour))
+	if !assert.Len(t, result, 1, `snoozed orphan should be dropped`) {
+		return
+	}
+	if !assert.Equal(t, `tp-2`, result[0].SelfLink, `other orphan should remain`) {
+		return
+	}
+
+	// once expired, the orphan comes back along with its snoozes
+	snoozes = autolbclean.AddSnooze(snoozes, `tp-1`, time.Hour, `alice@example.com`, now)
+	if !assert.Len(t, snoozes, 1, `snoozing again should replace the snooze`) {
+		return
+	}
+	result = autolbclean.ApplySnoozes(orphans, snoozes, now.Add(2*time.Hour))
+	if !assert.Len(t, result, 2, `expired snooze should not drop the orphan`) {
+		return
+	}
+	if !assert.Equal(t, 2, result[0].Snoozes, `prior snoozes should be noted`) {
+		return
+	}
+}
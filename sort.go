@@ -0,0 +1,60 @@
+package autolbclean
+
+import (
+	"sort"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// The lists returned by the App are sorted by kind, region and name, so
+// that reports and API responses are stable from one run to the next.
+// Aggregated lists come back as maps keyed by region, which would
+// otherwise shuffle the output every time
+
+func (o *Orphan) kind() string {
+	if o.IsHTTPs {
+		return KindTargetHttpsProxies
+	}
+	return KindTargetHttpProxies
+}
+
+func sortOrphans(list []*Orphan) {
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.kind() != b.kind() {
+			return a.kind() < b.kind()
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.TargetProxy < b.TargetProxy
+	})
+}
+
+func sortHealthCheckRefs(list []*HealthCheckRef) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].key() < list[j].key()
+	})
+}
+
+func sortFirewalls(list []*compute.Firewall) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+}
+
+func sortDeletions(list []*Deletion) {
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		if a.Zone != b.Zone {
+			return a.Zone < b.Zone
+		}
+		return a.Name < b.Name
+	})
+}
@@ -0,0 +1,276 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// Types of the records that the cleaner keeps about itself, and that
+// retention applies to
+const (
+	RecordRuns            = `runs`             // run records of the history
+	RecordEvents          = `events`           // deletion events of the history
+	RecordAccessLog       = `access_log`       // admin API access log
+	RecordDeletions       = `deletions`        // audit records of deleted resources
+	RecordAttempts        = `attempts`         // attempts at deleting resources
+	RecordDeletedClusters = `deleted_clusters` // clusters confirmed deleted by cluster notifications
+	RecordSnoozes         = `snoozes`          // expired snoozes of the admin state
+	RecordSuppressions    = `suppressions`     // suppressions of the admin state
+)
+
+// recordTypes lists the record types in the order they are collected
+var recordTypes = []string{
+	RecordRuns,
+	RecordEvents,
+	RecordAccessLog,
+	RecordDeletions,
+	RecordAttempts,
+	RecordDeletedClusters,
+	RecordSnoozes,
+	RecordSuppressions,
+}
+
+// pruneBatchSize is the most records that a store removes of a type
+// at once. CollectGarbage asks again until nothing is left
+const pruneBatchSize = 500
+
+// gcBudget is how long CollectGarbage keeps removing batches when the
+// context has no deadline of its own
+const gcBudget = 8 * time.Minute
+
+// gcMargin is how much of the deadline CollectGarbage leaves for
+// responding, and for the batch that is under way
+const gcMargin = 30 * time.Second
+
+func validateRetention(r RetentionConfig) error {
+	for record, d := range r.Records {
+		var known bool
+		for _, t := range recordTypes {
+			if t == record {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return errors.Errorf(`unknown record type %s (expected one of %s)`, record, strings.Join(recordTypes, `, `))
+		}
+		if d < 0 {
+			return errors.Errorf(`retention of %s must not be negative`, record)
+		}
+	}
+	if len(r.ArchiveURL) > 0 {
+		if !strings.HasPrefix(r.ArchiveURL, `gs://`) || len(strings.TrimPrefix(r.ArchiveURL, `gs://`)) == 0 {
+			return errors.Errorf(`archive_url must be gs://BUCKET or gs://BUCKET/PREFIX`)
+		}
+	}
+	return nil
+}
+
+// CollectGarbage removes the records that are older than their
+// retention from the stores of the app, archiving them first if an
+// archive is configured. Records of a type that fails to be archived
+// are kept. Record types without a retention are kept forever. Stores
+// remove the records in batches, which are asked for until nothing is
+// left, or until the deadline of the context nears
+func (app *App) CollectGarbage(ctx context.Context, now time.Time) []*PruneResult {
+	c := app.Config()
+	results := []*PruneResult{}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(gcBudget)
+	}
+	deadline = deadline.Add(-gcMargin)
+
+	for _, record := range recordTypes {
+		d := c.Retention.Records[record]
+		if d <= 0 {
+			continue
+		}
+
+		result := &PruneResult{
+			Record: record,
+			Cutoff: now.Add(-d),
+		}
+		archive := func(records []interface{}) error {
+			if len(records) == 0 || len(c.Retention.ArchiveURL) == 0 {
+				return nil
+			}
+			name := fmt.Sprintf(`%s/%s-%d.jsonl`, record, now.UTC().Format(`20060102T150405Z`), len(result.Archives))
+			location, err := app.archiveRecords(ctx, c.Retention.ArchiveURL, name, records)
+			if err != nil {
+				return err
+			}
+			result.Archives = append(result.Archives, location)
+			return nil
+		}
+
+		var err error
+		switch record {
+		case RecordSnoozes:
+			result.Pruned, err = app.pruneSnoozes(ctx, result.Cutoff, archive)
+		case RecordSuppressions:
+			result.Pruned, err = app.pruneSuppressions(ctx, now, result.Cutoff, archive)
+		default:
+			for time.Now().Before(deadline) {
+				var n int
+				n, err = app.pruneRecords(ctx, record, result.Cutoff, archive)
+				result.Pruned += n
+				if err != nil || n == 0 {
+					break
+				}
+			}
+		}
+		if err != nil {
+			result.Error = RedactError(err)
+			warningf(ctx, `Failed to collect %s older than %s: %s`, record, result.Cutoff, err)
+		} else if result.Pruned > 0 {
+			infof(ctx, `Collected %d %s older than %s`, result.Pruned, record, result.Cutoff)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// pruneRecords has the store, and then the audit store, remove the
+// records of the type that they keep
+func (app *App) pruneRecords(ctx context.Context, record string, cutoff time.Time, archive func([]interface{}) error) (int, error) {
+	var total int
+	for _, s := range []interface{}{app.store, app.auditStore} {
+		p, ok := s.(RecordPruner)
+		if !ok {
+			continue
+		}
+		n, err := p.PruneRecords(ctx, record, cutoff, archive)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// pruneSnoozes removes the snoozes of the admin state that expired
+// before cutoff. Snoozes in the configuration are left alone
+func (app *App) pruneSnoozes(ctx context.Context, cutoff time.Time, archive func([]interface{}) error) (int, error) {
+	st, err := app.store.LoadAdminState(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, `failed to load admin state`)
+	}
+	var expired []interface{}
+	for _, s := range st.Snoozes {
+		if s.Until.Before(cutoff) {
+			expired = append(expired, s)
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	if err := archive(expired); err != nil {
+		return 0, err
+	}
+
+	var pruned int
+	err = app.store.UpdateAdminState(ctx, func(st *AdminState) {
+		pruned = 0
+		var kept []Snooze
+		for _, s := range st.Snoozes {
+			if s.Until.Before(cutoff) {
+				pruned++
+				continue
+			}
+			kept = append(kept, s)
+		}
+		st.Snoozes = kept
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, `failed to update admin state`)
+	}
+	return pruned, nil
+}
+
+// pruneSuppressions removes the suppressions of the admin state that
+// were added before cutoff. Suppressions that were added before their
+// time was recorded are taken to be added now
+func (app *App) pruneSuppressions(ctx context.Context, now, cutoff time.Time, archive func([]interface{}) error) (int, error) {
+	st, err := app.store.LoadAdminState(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, `failed to load admin state`)
+	}
+	stamped := st.stampSuppressions(now)
+	var expired []interface{}
+	for i, pattern := range st.Suppressions {
+		if st.SuppressedAt[i].Before(cutoff) {
+			expired = append(expired, &Suppression{Pattern: pattern, SuppressedAt: st.SuppressedAt[i]})
+		}
+	}
+	if len(expired) == 0 && !stamped {
+		return 0, nil
+	}
+	if err := archive(expired); err != nil {
+		return 0, err
+	}
+
+	var pruned int
+	err = app.store.UpdateAdminState(ctx, func(st *AdminState) {
+		pruned = 0
+		st.stampSuppressions(now)
+		var kept []string
+		var keptAt []time.Time
+		for i, pattern := range st.Suppressions {
+			if st.SuppressedAt[i].Before(cutoff) {
+				pruned++
+				continue
+			}
+			kept = append(kept, pattern)
+			keptAt = append(keptAt, st.SuppressedAt[i])
+		}
+		st.Suppressions = kept
+		st.SuppressedAt = keptAt
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, `failed to update admin state`)
+	}
+	return pruned, nil
+}
+
+// archiveRecords writes the records as lines of JSON to an object named
+// name under the archive location, and returns where it went
+func (app *App) archiveRecords(ctx context.Context, archiveURL, name string, records []interface{}) (string, error) {
+	location := strings.TrimSuffix(strings.TrimPrefix(archiveURL, `gs://`), `/`)
+	bucket, prefix := location, ``
+	if i := strings.IndexByte(location, '/'); i >= 0 {
+		bucket, prefix = location[:i], location[i+1:]+`/`
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return ``, errors.Wrapf(err, `failed to encode %s`, name)
+		}
+	}
+
+	svc, err := storage.New(app.client)
+	if err != nil {
+		return ``, errors.Wrap(err, `failed to create storage.Service`)
+	}
+	ctx, cancel := app.getContext(ctx)
+	defer cancel()
+
+	_, err = svc.Objects.Insert(bucket, &storage.Object{
+		Name:        prefix + name,
+		ContentType: `application/x-ndjson`,
+	}).Media(&buf).Context(ctx).Do()
+	if err != nil {
+		return ``, errors.Wrapf(err, `failed to archive %s`, name)
+	}
+	return `gs://` + bucket + `/` + prefix + name, nil
+}
@@ -0,0 +1,98 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-60 * 24 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	store := autolbclean.NewMemoryStore()
+	h := store.(autolbclean.HistoryStore)
+	for i, at := range []time.Time{old, recent} {
+		runID := []string{`old`, `recent`}[i]
+		if !assert.NoError(t, h.SaveRun(ctx, &autolbclean.RunRecord{RunID: runID, Project: `p`, StartedAt: at}), `SaveRun should succeed`) {
+			return
+		}
+		if !assert.NoError(t, h.SaveEvent(ctx, &autolbclean.DeletionEvent{RunID: runID, Project: `p`, At: at}), `SaveEvent should succeed`) {
+			return
+		}
+	}
+	err := store.UpdateAdminState(ctx, func(st *autolbclean.AdminState) {
+		st.Snoozes = []autolbclean.Snooze{
+			{SelfLink: `expired`, Until: old},
+			{SelfLink: `active`, Until: now.Add(time.Hour)},
+		}
+		st.Suppressions = []string{`k8s-fw-old-*`, `k8s-fw-recent-*`}
+		st.SuppressedAt = []time.Time{old, recent}
+	})
+	if !assert.NoError(t, err, `UpdateAdminState should succeed`) {
+		return
+	}
+
+	c, err := autolbclean.ParseConfig([]byte(`
+retention:
+  records:
+    runs: 720h
+    snoozes: 720h
+    suppressions: 720h
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+	app, err := autolbclean.New(`p`, &http.Client{}, autolbclean.WithStore(store), autolbclean.WithConfig(c))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	results := app.CollectGarbage(ctx, now)
+	if !assert.Len(t, results, 3, `only record types with a retention should be collected`) {
+		return
+	}
+	for _, r := range results {
+		if !assert.Empty(t, r.Error, `%s should be collected`, r.Record) || !assert.Equal(t, 1, r.Pruned, `%s should be pruned`, r.Record) {
+			return
+		}
+	}
+
+	runs, err := h.ListRuns(ctx, `p`, time.Time{})
+	if !assert.NoError(t, err, `ListRuns should succeed`) || !assert.Len(t, runs, 1, `old run should be removed`) || !assert.Equal(t, `recent`, runs[0].RunID) {
+		return
+	}
+	events, err := h.ListEvents(ctx, `old`)
+	if !assert.NoError(t, err, `ListEvents should succeed`) || !assert.Empty(t, events, `events should be removed along with their run`) {
+		return
+	}
+	events, err = h.ListEvents(ctx, `recent`)
+	if !assert.NoError(t, err, `ListEvents should succeed`) || !assert.Len(t, events, 1, `events of the runs that are kept should be kept`) {
+		return
+	}
+	st, err := store.LoadAdminState(ctx)
+	if !assert.NoError(t, err, `LoadAdminState should succeed`) || !assert.Len(t, st.Snoozes, 1, `expired snooze should be removed`) || !assert.Equal(t, `active`, st.Snoozes[0].SelfLink) {
+		return
+	}
+	if !assert.Equal(t, []string{`k8s-fw-recent-*`}, st.Suppressions, `old suppression should be removed`) || !assert.Len(t, st.SuppressedAt, 1, `the time of the old suppression should be removed`) {
+		return
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	for _, doc := range []string{
+		"retention:\n  records:\n    orphans: 24h\n",
+		"retention:\n  records:\n    runs: -1h\n",
+		"retention:\n  archive_url: s3://bucket\n",
+	} {
+		if _, err := autolbclean.ParseConfig([]byte(doc)); !assert.Error(t, err, `ParseConfig should fail for %q`, doc) {
+			return
+		}
+	}
+}
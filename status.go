@@ -0,0 +1,145 @@
+package autolbclean
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// how far before the latest run status its run record is looked for
+const runSummaryLookback = 24 * time.Hour
+
+// SummarizeRun describes the latest run from its status and its record,
+// either of which may be nil, and the deletion events of the run. The
+// events tell how the deletions that the run scheduled have fared
+// since. Without them, the counts of the record are used
+func SummarizeRun(project string, status *RunStatus, run *RunRecord, events []*DeletionEvent, now time.Time) *RunSummary {
+	s := &RunSummary{
+		Project: project,
+		Stale:   true,
+	}
+	if status != nil {
+		finishedAt := status.FinishedAt
+		s.LastRunAt = &finishedAt
+		s.Orphans = status.Orphans
+		s.Stale = now.Sub(finishedAt) > BadgeStaleAfter
+	}
+	if run == nil {
+		return s
+	}
+	s.RunID = run.RunID
+
+	if len(events) == 0 {
+		s.Deletions.Succeeded = run.Deleted
+		s.Deletions.Failed = run.Failed
+		if pending := run.Scheduled - run.Deleted - run.Failed; pending > 0 {
+			s.Deletions.Pending = pending
+		}
+		return s
+	}
+
+	// the latest decision about each resource is where its deletion is
+	// at. events are in the order they happened
+	latest := make(map[string]string)
+	var order []string
+	for _, ev := range events {
+		key := fmt.Sprintf(`%s/%s/%s/%s`, ev.Kind, ev.Region, ev.Zone, ev.Name)
+		if _, ok := latest[key]; !ok {
+			order = append(order, key)
+		}
+		latest[key] = ev.Decision
+	}
+	for _, key := range order {
+		switch latest[key] {
+		case DecisionScheduled:
+			s.Deletions.Pending++
+		case DecisionDeleted:
+			s.Deletions.Succeeded++
+		case DecisionFailed:
+			s.Deletions.Failed++
+		}
+	}
+	return s
+}
+
+// RunSummary describes the latest run of the project, along with the
+// configuration that is in effect. Secrets in the configuration are
+// redacted
+func (app *App) RunSummary(ctx context.Context) (*RunSummary, error) {
+	status, err := app.store.LoadRunStatus(ctx, app.project)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to load run status`)
+	}
+
+	var run *RunRecord
+	var events []*DeletionEvent
+	if h, ok := app.store.(HistoryStore); ok && status != nil {
+		runs, err := h.ListRuns(ctx, app.project, status.FinishedAt.Add(-runSummaryLookback))
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to list runs`)
+		}
+		if len(runs) > 0 {
+			run = runs[len(runs)-1]
+			if events, err = h.ListEvents(ctx, run.RunID); err != nil {
+				return nil, errors.Wrap(err, `failed to list deletion events`)
+			}
+		}
+	}
+
+	s := SummarizeRun(app.project, status, run, events, time.Now().UTC())
+	if s.Config, err = app.Config().withoutSecrets().document(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// withoutSecrets returns a copy of c without the secrets it holds: the
+// webhooks of the teams, and the key that names are hashed with
+func (c *Config) withoutSecrets() *Config {
+	copied := *c
+	if len(c.Teams.Webhooks) > 0 {
+		copied.Teams.Webhooks = make(map[string]string, len(c.Teams.Webhooks))
+		for team := range c.Teams.Webhooks {
+			copied.Teams.Webhooks[team] = redacted
+		}
+	}
+	if len(c.ExportRedaction.Key) > 0 {
+		copied.ExportRedaction.Key = redacted
+	}
+	return &copied
+}
+
+// document returns the configuration as it is written in YAML, in a
+// form that can be encoded as JSON too
+func (c *Config) document() (map[string]interface{}, error) {
+	buf, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to encode configuration`)
+	}
+	var v map[interface{}]interface{}
+	if err := yaml.Unmarshal(buf, &v); err != nil {
+		return nil, errors.Wrap(err, `failed to decode configuration`)
+	}
+	return stringKeys(v).(map[string]interface{}), nil
+}
+
+// stringKeys converts the maps that YAML decodes into, whose keys may be
+// anything, into maps keyed by strings
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			m[fmt.Sprint(k)] = stringKeys(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = stringKeys(value)
+		}
+	}
+	return v
+}
@@ -0,0 +1,88 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunSummary(t *testing.T) {
+	ctx := context.Background()
+	store := autolbclean.NewMemoryStore()
+	c := autolbclean.DefaultConfig()
+	c.Teams.Webhooks = map[string]string{`payments`: `https://hooks.slack.com/services/secret`}
+	app, err := autolbclean.New(`p`, &http.Client{}, autolbclean.WithStore(store), autolbclean.WithRunID(`run-1`), autolbclean.WithConfig(c))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	summary, err := app.RunSummary(ctx)
+	if !assert.NoError(t, err, `RunSummary should succeed`) {
+		return
+	}
+	if !assert.Nil(t, summary.LastRunAt, `there should be no last run`) || !assert.True(t, summary.Stale, `no runs at all should be stale`) {
+		return
+	}
+
+	started := time.Now().UTC()
+	if !assert.NoError(t, app.SaveRun(ctx, &autolbclean.RunRecord{StartedAt: started, Orphans: 1, Scheduled: 3}), `SaveRun should succeed`) {
+		return
+	}
+	if !assert.NoError(t, store.SaveRunStatus(ctx, &autolbclean.RunStatus{Project: `p`, FinishedAt: started, Orphans: 1}), `SaveRunStatus should succeed`) {
+		return
+	}
+	for _, ev := range []struct {
+		name     string
+		decision string
+	}{
+		{`k8s-fw-1`, autolbclean.DecisionScheduled},
+		{`k8s-tp-1`, autolbclean.DecisionScheduled},
+		{`k8s-um-1`, autolbclean.DecisionScheduled},
+		{`k8s-fw-1`, autolbclean.DecisionDeleted},
+		{`k8s-tp-1`, autolbclean.DecisionFailed},
+	} {
+		d := &autolbclean.Deletion{Kind: autolbclean.KindForwardingRules, Name: ev.name, Region: `global`}
+		if !assert.NoError(t, app.PublishEvent(ctx, d, ev.decision, nil), `PublishEvent should succeed`) {
+			return
+		}
+	}
+
+	summary, err = app.RunSummary(ctx)
+	if !assert.NoError(t, err, `RunSummary should succeed`) {
+		return
+	}
+	if !assert.False(t, summary.Stale, `a fresh run should not be stale`) || !assert.Equal(t, `run-1`, summary.RunID) || !assert.Equal(t, 1, summary.Orphans) {
+		return
+	}
+	expected := autolbclean.RunSummaryDeletions{Pending: 1, Succeeded: 1, Failed: 1}
+	if !assert.Equal(t, expected, summary.Deletions, `deletions should be counted by their latest decision`) {
+		return
+	}
+
+	teams, ok := summary.Config[`teams`].(map[string]interface{})
+	if !assert.True(t, ok, `the configuration should be included`) {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{`payments`: `[REDACTED]`}, teams[`webhooks`], `webhooks should be redacted`) {
+		return
+	}
+}
+
+func TestSummarizeRunWithoutEvents(t *testing.T) {
+	now := time.Now().UTC()
+	status := &autolbclean.RunStatus{Project: `p`, FinishedAt: now.Add(-time.Hour), Orphans: 2}
+	run := &autolbclean.RunRecord{RunID: `run-1`, Scheduled: 5, Deleted: 3, Failed: 1}
+
+	summary := autolbclean.SummarizeRun(`p`, status, run, nil, now)
+	if !assert.True(t, summary.Stale, `an hour old run should be stale`) {
+		return
+	}
+	expected := autolbclean.RunSummaryDeletions{Pending: 1, Succeeded: 3, Failed: 1}
+	if !assert.Equal(t, expected, summary.Deletions, `the counts of the run record should be used`) {
+		return
+	}
+}
@@ -0,0 +1,80 @@
+package autolbclean
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/appengine"
+)
+
+// OpenStore creates the Store described by location:
+//
+//	memory                      kept in memory, lost when the process exits
+//	datastore                   App Engine datastore, only available on App Engine
+//	gs://BUCKET/PREFIX          JSON objects in a GCS bucket
+//	firestore://PROJECT/PREFIX  documents in the Firestore database of PROJECT
+//
+// The prefix is optional, and allows several deployments to share a
+// bucket or a database
+func OpenStore(ctx context.Context, client *http.Client, location string) (Store, error) {
+	if err := ValidateStoreLocation(location); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case location == `memory`:
+		return NewMemoryStore(), nil
+	case location == `datastore`:
+		return datastoreStore{}, nil
+	case strings.HasPrefix(location, `gs://`):
+		bucket, prefix := splitStoreLocation(strings.TrimPrefix(location, `gs://`))
+		if len(prefix) > 0 {
+			prefix += `/`
+		}
+		return NewGCSStore(client, bucket, prefix)
+	case strings.HasPrefix(location, `firestore://`):
+		project, prefix := splitStoreLocation(strings.TrimPrefix(location, `firestore://`))
+		// collection names can not contain slashes
+		if len(prefix) > 0 {
+			prefix = strings.Replace(prefix, `/`, `-`, -1) + `-`
+		}
+		return NewFirestoreStore(ctx, project, prefix)
+	}
+	return nil, errors.Errorf(`invalid store location %q`, location)
+}
+
+// ValidateStoreLocation checks that location describes a store that
+// OpenStore can open here, without opening it. The datastore store is
+// only available on App Engine
+func ValidateStoreLocation(location string) error {
+	switch {
+	case location == `memory`:
+	case location == `datastore`:
+		if !appengine.IsAppEngine() {
+			return errors.New(`the datastore store is only available on App Engine (use gs://BUCKET/PREFIX or firestore://PROJECT/PREFIX instead)`)
+		}
+	case strings.HasPrefix(location, `gs://`):
+		if bucket, _ := splitStoreLocation(strings.TrimPrefix(location, `gs://`)); len(bucket) == 0 {
+			return errors.Errorf(`invalid store location %s: missing bucket`, location)
+		}
+	case strings.HasPrefix(location, `firestore://`):
+		if project, _ := splitStoreLocation(strings.TrimPrefix(location, `firestore://`)); len(project) == 0 {
+			return errors.Errorf(`invalid store location %s: missing project`, location)
+		}
+	default:
+		return errors.Errorf(`invalid store location %q (expected memory, datastore, gs://BUCKET/PREFIX or firestore://PROJECT/PREFIX)`, location)
+	}
+	return nil
+}
+
+// splitStoreLocation splits s into the bucket or project, and the
+// prefix, without leading or trailing slashes
+func splitStoreLocation(s string) (string, string) {
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return s, ``
+	}
+	return s[:i], strings.Trim(s[i+1:], `/`)
+}
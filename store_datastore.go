@@ -0,0 +1,316 @@
+package autolbclean
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/appengine/datastore"
+)
+
+const runStatusKind = `RunStatus`
+const candidateKind = `Orphan`
+const emptyGroupKind = `EmptyGroup`
+const unusedAddressKind = `UnusedAddress`
+const handoffKind = `Handoff`
+const adminStateKind = `AdminState`
+const runRecordKind = `RunRecord`
+const deletionEventKind = `DeletionEvent`
+const deletedClusterKind = `DeletedCluster`
+
+// datastoreStore is the Store for App Engine datastore
+type datastoreStore struct{}
+
+func runStatusKey(ctx context.Context, project string) *datastore.Key {
+	return datastore.NewKey(ctx, runStatusKind, project, 0, nil)
+}
+
+func (datastoreStore) LoadRunStatus(ctx context.Context, project string) (*RunStatus, error) {
+	var status RunStatus
+	err := datastore.Get(ctx, runStatusKey(ctx, project), &status)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to load run status`)
+	}
+	return &status, nil
+}
+
+func (datastoreStore) SaveRunStatus(ctx context.Context, status *RunStatus) error {
+	if _, err := datastore.Put(ctx, runStatusKey(ctx, status.Project), status); err != nil {
+		return errors.Wrap(err, `failed to save run status`)
+	}
+	return nil
+}
+
+// candidates are keyed by their self link, which includes the project
+func listCandidateEntities(ctx context.Context, kind, project string) ([]*datastore.Key, []*Candidate, error) {
+	var all []*Candidate
+	allKeys, err := datastore.NewQuery(kind).GetAll(ctx, &all)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, `failed to load %s records`, kind)
+	}
+
+	scope := `/projects/` + project + `/`
+	var keys []*datastore.Key
+	var candidates []*Candidate
+	for i, c := range all {
+		if !strings.Contains(c.SelfLink, scope) {
+			continue
+		}
+		keys = append(keys, allKeys[i])
+		candidates = append(candidates, c)
+	}
+	return keys, candidates, nil
+}
+
+// saveCandidateEntities replaces the candidates of the given kind for
+// the project
+func saveCandidateEntities(ctx context.Context, kind, project string, candidates []*Candidate) error {
+	keys, _, err := listCandidateEntities(ctx, kind, project)
+	if err != nil {
+		return err
+	}
+
+	var putKeys []*datastore.Key
+	keep := make(map[string]struct{})
+	for _, c := range candidates {
+		putKeys = append(putKeys, datastore.NewKey(ctx, kind, c.SelfLink, 0, nil))
+		keep[c.SelfLink] = struct{}{}
+	}
+	if len(putKeys) > 0 {
+		if _, err := datastore.PutMulti(ctx, putKeys, candidates); err != nil {
+			return errors.Wrapf(err, `failed to save %s records`, kind)
+		}
+	}
+
+	var staleKeys []*datastore.Key
+	for _, k := range keys {
+		if _, ok := keep[k.StringID()]; !ok {
+			staleKeys = append(staleKeys, k)
+		}
+	}
+	if len(staleKeys) > 0 {
+		if err := datastore.DeleteMulti(ctx, staleKeys); err != nil {
+			return errors.Wrapf(err, `failed to delete stale %s records`, kind)
+		}
+	}
+	return nil
+}
+
+func (datastoreStore) ListCandidates(ctx context.Context, project string) ([]*Candidate, error) {
+	_, candidates, err := listCandidateEntities(ctx, candidateKind, project)
+	return candidates, err
+}
+
+func (datastoreStore) SaveCandidates(ctx context.Context, project string, candidates []*Candidate) error {
+	return saveCandidateEntities(ctx, candidateKind, project, candidates)
+}
+
+func (datastoreStore) ListEmptyGroups(ctx context.Context, project string) ([]*Candidate, error) {
+	_, groups, err := listCandidateEntities(ctx, emptyGroupKind, project)
+	return groups, err
+}
+
+func (datastoreStore) SaveEmptyGroups(ctx context.Context, project string, groups []*Candidate) error {
+	return saveCandidateEntities(ctx, emptyGroupKind, project, groups)
+}
+
+func (datastoreStore) ListUnusedAddresses(ctx context.Context, project string) ([]*Candidate, error) {
+	_, addresses, err := listCandidateEntities(ctx, unusedAddressKind, project)
+	return addresses, err
+}
+
+func (datastoreStore) SaveUnusedAddresses(ctx context.Context, project string, addresses []*Candidate) error {
+	return saveCandidateEntities(ctx, unusedAddressKind, project, addresses)
+}
+
+func (datastoreStore) ListHandoffs(ctx context.Context, project string) ([]*Candidate, error) {
+	_, handoffs, err := listCandidateEntities(ctx, handoffKind, project)
+	return handoffs, err
+}
+
+func (datastoreStore) SaveHandoffs(ctx context.Context, project string, handoffs []*Candidate) error {
+	return saveCandidateEntities(ctx, handoffKind, project, handoffs)
+}
+
+func (datastoreStore) ListDeletedClusters(ctx context.Context, project string) ([]*DeletedCluster, error) {
+	var list []*DeletedCluster
+	if _, err := datastore.NewQuery(deletedClusterKind).Filter(`Project =`, project).GetAll(ctx, &list); err != nil {
+		return nil, errors.Wrap(err, `failed to list deleted clusters`)
+	}
+	return list, nil
+}
+
+func (datastoreStore) SaveDeletedCluster(ctx context.Context, dc *DeletedCluster) error {
+	key := datastore.NewKey(ctx, deletedClusterKind, dc.Project+`/`+dc.ID, 0, nil)
+	if _, err := datastore.Put(ctx, key, dc); err != nil {
+		return errors.Wrap(err, `failed to save deleted cluster`)
+	}
+	return nil
+}
+
+func adminStateKey(ctx context.Context) *datastore.Key {
+	return datastore.NewKey(ctx, adminStateKind, `state`, 0, nil)
+}
+
+func (datastoreStore) LoadAdminState(ctx context.Context) (*AdminState, error) {
+	var st AdminState
+	if err := datastore.Get(ctx, adminStateKey(ctx), &st); err != nil && err != datastore.ErrNoSuchEntity {
+		return nil, errors.Wrap(err, `failed to load admin state`)
+	}
+	return &st, nil
+}
+
+func (s datastoreStore) UpdateAdminState(ctx context.Context, f func(*AdminState)) error {
+	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		st, err := s.LoadAdminState(ctx)
+		if err != nil {
+			return err
+		}
+		f(st)
+		if _, err := datastore.Put(ctx, adminStateKey(ctx), st); err != nil {
+			return errors.Wrap(err, `failed to save admin state`)
+		}
+		return nil
+	}, nil)
+}
+
+func (datastoreStore) SaveRun(ctx context.Context, r *RunRecord) error {
+	key := datastore.NewKey(ctx, runRecordKind, r.RunID, 0, nil)
+	if _, err := datastore.Put(ctx, key, r); err != nil {
+		return errors.Wrap(err, `failed to save run record`)
+	}
+	return nil
+}
+
+// runs are filtered by project after the fact, as filtering in the
+// query would require a composite index
+func (datastoreStore) ListRuns(ctx context.Context, project string, since time.Time) ([]*RunRecord, error) {
+	var all []*RunRecord
+	_, err := datastore.NewQuery(runRecordKind).Filter(`StartedAt >`, since).Order(`StartedAt`).GetAll(ctx, &all)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list run records`)
+	}
+
+	var list []*RunRecord
+	for _, r := range all {
+		if r.Project == project {
+			list = append(list, r)
+		}
+	}
+	return list, nil
+}
+
+func (datastoreStore) SaveEvent(ctx context.Context, ev *DeletionEvent) error {
+	if _, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, deletionEventKind, nil), ev); err != nil {
+		return errors.Wrap(err, `failed to save deletion event`)
+	}
+	return nil
+}
+
+func (datastoreStore) ListEvents(ctx context.Context, runID string) ([]*DeletionEvent, error) {
+	var list []*DeletionEvent
+	if _, err := datastore.NewQuery(deletionEventKind).Filter(`RunID =`, runID).GetAll(ctx, &list); err != nil {
+		return nil, errors.Wrap(err, `failed to list deletion events`)
+	}
+	sortEvents(list)
+	return list, nil
+}
+
+func (datastoreStore) ListEventsBetween(ctx context.Context, since, until time.Time, limit int) ([]*DeletionEvent, error) {
+	var list []*DeletionEvent
+	_, err := datastore.NewQuery(deletionEventKind).Filter(`At >=`, since).Filter(`At <`, until).Order(`At`).Limit(limit).GetAll(ctx, &list)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list deletion events`)
+	}
+	return list, nil
+}
+
+func (datastoreStore) PruneRecords(ctx context.Context, record string, cutoff time.Time, archive func([]interface{}) error) (int, error) {
+	switch record {
+	case RecordRuns:
+		var list []*RunRecord
+		return pruneEntities(ctx, runRecordKind, `StartedAt`, cutoff, &list, func(records []interface{}) error {
+			if err := archive(records); err != nil {
+				return err
+			}
+			// the events of the runs go with them, so that none is
+			// left without its run
+			return pruneRunEvents(ctx, list, archive)
+		})
+	case RecordEvents:
+		var list []*DeletionEvent
+		return pruneEntities(ctx, deletionEventKind, `At`, cutoff, &list, archive)
+	case RecordDeletedClusters:
+		var list []*DeletedCluster
+		return pruneEntities(ctx, deletedClusterKind, `DeletedAt`, cutoff, &list, archive)
+	}
+	return 0, nil
+}
+
+// pruneRunEvents removes the deletion events of the runs, once archive
+// has taken them
+func pruneRunEvents(ctx context.Context, runs []*RunRecord, archive func([]interface{}) error) error {
+	var keys []*datastore.Key
+	var records []interface{}
+	for _, r := range runs {
+		var events []*DeletionEvent
+		k, err := datastore.NewQuery(deletionEventKind).Filter(`RunID =`, r.RunID).GetAll(ctx, &events)
+		if err != nil {
+			return errors.Wrapf(err, `failed to list deletion events of run %s`, r.RunID)
+		}
+		keys = append(keys, k...)
+		for _, ev := range events {
+			records = append(records, ev)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := archive(records); err != nil {
+		return err
+	}
+
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > pruneBatchSize {
+			n = pruneBatchSize
+		}
+		if err := datastore.DeleteMulti(ctx, keys[:n]); err != nil {
+			return errors.Wrap(err, `failed to delete deletion events`)
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// pruneEntities removes up to pruneBatchSize entities of the kind whose
+// property is before cutoff, once archive has taken them. dst points to
+// a slice that the entities are decoded into
+func pruneEntities(ctx context.Context, kind, property string, cutoff time.Time, dst interface{}, archive func([]interface{}) error) (int, error) {
+	keys, err := datastore.NewQuery(kind).Filter(property+` <`, cutoff).Limit(pruneBatchSize).GetAll(ctx, dst)
+	if err != nil {
+		return 0, errors.Wrapf(err, `failed to list expired %s entities`, kind)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	v := reflect.ValueOf(dst).Elem()
+	records := make([]interface{}, v.Len())
+	for i := range records {
+		records[i] = v.Index(i).Interface()
+	}
+	if err := archive(records); err != nil {
+		return 0, err
+	}
+
+	if err := datastore.DeleteMulti(ctx, keys); err != nil {
+		return 0, errors.Wrapf(err, `failed to delete expired %s entities`, kind)
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,410 @@
+package autolbclean
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// firestoreStore keeps the records in Firestore documents, in
+// collections whose names start with prefix
+type firestoreStore struct {
+	client *firestore.Client
+	prefix string
+}
+
+// candidatesDocument holds the candidates of a project
+type candidatesDocument struct {
+	Candidates []*Candidate
+}
+
+// NewFirestoreStore creates a Store that keeps its records in the
+// Firestore database of the given project, using the default
+// credentials
+func NewFirestoreStore(ctx context.Context, project, prefix string) (Store, error) {
+	client, err := firestore.NewClient(ctx, project)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create firestore client`)
+	}
+	return &firestoreStore{client: client, prefix: prefix}, nil
+}
+
+func (s *firestoreStore) doc(collection, id string) *firestore.DocumentRef {
+	return s.client.Collection(s.prefix + collection).Doc(id)
+}
+
+func isFirestoreNotFound(err error) bool {
+	return status.Code(err) == codes.NotFound
+}
+
+func (s *firestoreStore) LoadRunStatus(ctx context.Context, project string) (*RunStatus, error) {
+	snap, err := s.doc(`runs`, project).Get(ctx)
+	if err != nil {
+		if isFirestoreNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, `failed to load run status from firestore`)
+	}
+
+	var st RunStatus
+	if err := snap.DataTo(&st); err != nil {
+		return nil, errors.Wrap(err, `failed to decode run status`)
+	}
+	return &st, nil
+}
+
+func (s *firestoreStore) SaveRunStatus(ctx context.Context, st *RunStatus) error {
+	if _, err := s.doc(`runs`, st.Project).Set(ctx, st); err != nil {
+		return errors.Wrap(err, `failed to save run status to firestore`)
+	}
+	return nil
+}
+
+func (s *firestoreStore) ListCandidates(ctx context.Context, project string) ([]*Candidate, error) {
+	snap, err := s.doc(`candidates`, project).Get(ctx)
+	if err != nil {
+		if isFirestoreNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, `failed to load orphan candidates from firestore`)
+	}
+
+	var doc candidatesDocument
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, `failed to decode orphan candidates`)
+	}
+	return doc.Candidates, nil
+}
+
+func (s *firestoreStore) SaveCandidates(ctx context.Context, project string, candidates []*Candidate) error {
+	if _, err := s.doc(`candidates`, project).Set(ctx, &candidatesDocument{Candidates: candidates}); err != nil {
+		return errors.Wrap(err, `failed to save orphan candidates to firestore`)
+	}
+	return nil
+}
+
+func (s *firestoreStore) ListEmptyGroups(ctx context.Context, project string) ([]*Candidate, error) {
+	snap, err := s.doc(`empty-groups`, project).Get(ctx)
+	if err != nil {
+		if isFirestoreNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, `failed to load empty network endpoint groups from firestore`)
+	}
+
+	var doc candidatesDocument
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, `failed to decode empty network endpoint groups`)
+	}
+	return doc.Candidates, nil
+}
+
+func (s *firestoreStore) SaveEmptyGroups(ctx context.Context, project string, groups []*Candidate) error {
+	if _, err := s.doc(`empty-groups`, project).Set(ctx, &candidatesDocument{Candidates: groups}); err != nil {
+		return errors.Wrap(err, `failed to save empty network endpoint groups to firestore`)
+	}
+	return nil
+}
+
+func (s *firestoreStore) ListUnusedAddresses(ctx context.Context, project string) ([]*Candidate, error) {
+	snap, err := s.doc(`unused-addresses`, project).Get(ctx)
+	if err != nil {
+		if isFirestoreNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, `failed to load unused addresses from firestore`)
+	}
+
+	var doc candidatesDocument
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, `failed to decode unused addresses`)
+	}
+	return doc.Candidates, nil
+}
+
+func (s *firestoreStore) SaveUnusedAddresses(ctx context.Context, project string, addresses []*Candidate) error {
+	if _, err := s.doc(`unused-addresses`, project).Set(ctx, &candidatesDocument{Candidates: addresses}); err != nil {
+		return errors.Wrap(err, `failed to save unused addresses to firestore`)
+	}
+	return nil
+}
+
+func (s *firestoreStore) ListHandoffs(ctx context.Context, project string) ([]*Candidate, error) {
+	snap, err := s.doc(`handoffs`, project).Get(ctx)
+	if err != nil {
+		if isFirestoreNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, `failed to load handoffs from firestore`)
+	}
+
+	var doc candidatesDocument
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, errors.Wrap(err, `failed to decode handoffs`)
+	}
+	return doc.Candidates, nil
+}
+
+func (s *firestoreStore) SaveHandoffs(ctx context.Context, project string, handoffs []*Candidate) error {
+	if _, err := s.doc(`handoffs`, project).Set(ctx, &candidatesDocument{Candidates: handoffs}); err != nil {
+		return errors.Wrap(err, `failed to save handoffs to firestore`)
+	}
+	return nil
+}
+
+func (s *firestoreStore) ListDeletedClusters(ctx context.Context, project string) ([]*DeletedCluster, error) {
+	it := s.client.Collection(s.prefix+`deleted-clusters`).Where(`Project`, `==`, project).Documents(ctx)
+	defer it.Stop()
+
+	var list []*DeletedCluster
+	for {
+		snap, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to list deleted clusters from firestore`)
+		}
+		var dc DeletedCluster
+		if err := snap.DataTo(&dc); err != nil {
+			return nil, errors.Wrap(err, `failed to decode deleted cluster`)
+		}
+		list = append(list, &dc)
+	}
+	return list, nil
+}
+
+func (s *firestoreStore) SaveDeletedCluster(ctx context.Context, dc *DeletedCluster) error {
+	if _, err := s.doc(`deleted-clusters`, dc.Project+`-`+dc.ID).Set(ctx, dc); err != nil {
+		return errors.Wrap(err, `failed to save deleted cluster to firestore`)
+	}
+	return nil
+}
+
+func (s *firestoreStore) LoadAdminState(ctx context.Context) (*AdminState, error) {
+	snap, err := s.doc(`state`, `admin`).Get(ctx)
+	if err != nil {
+		if isFirestoreNotFound(err) {
+			return &AdminState{}, nil
+		}
+		return nil, errors.Wrap(err, `failed to load admin state from firestore`)
+	}
+
+	var st AdminState
+	if err := snap.DataTo(&st); err != nil {
+		return nil, errors.Wrap(err, `failed to decode admin state`)
+	}
+	return &st, nil
+}
+
+func (s *firestoreStore) UpdateAdminState(ctx context.Context, f func(*AdminState)) error {
+	ref := s.doc(`state`, `admin`)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var st AdminState
+		snap, err := tx.Get(ref)
+		switch {
+		case err == nil:
+			if err := snap.DataTo(&st); err != nil {
+				return errors.Wrap(err, `failed to decode admin state`)
+			}
+		case !isFirestoreNotFound(err):
+			return err
+		}
+		f(&st)
+		return tx.Set(ref, &st)
+	})
+	if err != nil {
+		return errors.Wrap(err, `failed to update admin state in firestore`)
+	}
+	return nil
+}
+
+func (s *firestoreStore) SaveRun(ctx context.Context, r *RunRecord) error {
+	if _, err := s.doc(`history`, r.RunID).Set(ctx, r); err != nil {
+		return errors.Wrap(err, `failed to save run record to firestore`)
+	}
+	return nil
+}
+
+// runs are filtered by project after the fact, as filtering in the
+// query would require a composite index
+func (s *firestoreStore) ListRuns(ctx context.Context, project string, since time.Time) ([]*RunRecord, error) {
+	it := s.client.Collection(s.prefix+`history`).Where(`StartedAt`, `>`, since).OrderBy(`StartedAt`, firestore.Asc).Documents(ctx)
+	defer it.Stop()
+
+	var list []*RunRecord
+	for {
+		snap, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to list run records from firestore`)
+		}
+		var r RunRecord
+		if err := snap.DataTo(&r); err != nil {
+			return nil, errors.Wrap(err, `failed to decode run record`)
+		}
+		if r.Project == project {
+			list = append(list, &r)
+		}
+	}
+	return list, nil
+}
+
+func (s *firestoreStore) SaveEvent(ctx context.Context, ev *DeletionEvent) error {
+	if _, _, err := s.client.Collection(s.prefix+`events`).Add(ctx, ev); err != nil {
+		return errors.Wrap(err, `failed to save deletion event to firestore`)
+	}
+	return nil
+}
+
+func (s *firestoreStore) ListEvents(ctx context.Context, runID string) ([]*DeletionEvent, error) {
+	it := s.client.Collection(s.prefix+`events`).Where(`RunID`, `==`, runID).Documents(ctx)
+	defer it.Stop()
+
+	var list []*DeletionEvent
+	for {
+		snap, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to list deletion events from firestore`)
+		}
+		var ev DeletionEvent
+		if err := snap.DataTo(&ev); err != nil {
+			return nil, errors.Wrap(err, `failed to decode deletion event`)
+		}
+		list = append(list, &ev)
+	}
+	sortEvents(list)
+	return list, nil
+}
+
+func (s *firestoreStore) ListEventsBetween(ctx context.Context, since, until time.Time, limit int) ([]*DeletionEvent, error) {
+	it := s.client.Collection(s.prefix+`events`).Where(`At`, `>=`, since).Where(`At`, `<`, until).OrderBy(`At`, firestore.Asc).Limit(limit).Documents(ctx)
+	defer it.Stop()
+
+	var list []*DeletionEvent
+	for {
+		snap, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to list deletion events from firestore`)
+		}
+		var ev DeletionEvent
+		if err := snap.DataTo(&ev); err != nil {
+			return nil, errors.Wrap(err, `failed to decode deletion event`)
+		}
+		list = append(list, &ev)
+	}
+	return list, nil
+}
+
+func (s *firestoreStore) PruneRecords(ctx context.Context, record string, cutoff time.Time, archive func([]interface{}) error) (int, error) {
+	switch record {
+	case RecordRuns:
+		return s.pruneCollection(ctx, `history`, `StartedAt`, cutoff, func() interface{} { return &RunRecord{} }, func(records []interface{}) error {
+			if err := archive(records); err != nil {
+				return err
+			}
+			// the events of the runs go with them, so that none is
+			// left without its run
+			return s.pruneRunEvents(ctx, records, archive)
+		})
+	case RecordEvents:
+		return s.pruneCollection(ctx, `events`, `At`, cutoff, func() interface{} { return &DeletionEvent{} }, archive)
+	case RecordDeletedClusters:
+		return s.pruneCollection(ctx, `deleted-clusters`, `DeletedAt`, cutoff, func() interface{} { return &DeletedCluster{} }, archive)
+	}
+	return 0, nil
+}
+
+// pruneRunEvents removes the deletion events of the runs, once archive
+// has taken them
+func (s *firestoreStore) pruneRunEvents(ctx context.Context, runs []interface{}, archive func([]interface{}) error) error {
+	var refs []*firestore.DocumentRef
+	var records []interface{}
+	for _, r := range runs {
+		runID := r.(*RunRecord).RunID
+		it := s.client.Collection(s.prefix+`events`).Where(`RunID`, `==`, runID).Documents(ctx)
+		for {
+			snap, err := it.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				it.Stop()
+				return errors.Wrapf(err, `failed to list deletion events of run %s from firestore`, runID)
+			}
+			var ev DeletionEvent
+			if err := snap.DataTo(&ev); err != nil {
+				it.Stop()
+				return errors.Wrap(err, `failed to decode deletion event`)
+			}
+			refs = append(refs, snap.Ref)
+			records = append(records, &ev)
+		}
+		it.Stop()
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	if err := archive(records); err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if _, err := ref.Delete(ctx); err != nil {
+			return errors.Wrap(err, `failed to delete deletion event from firestore`)
+		}
+	}
+	return nil
+}
+
+// pruneCollection removes up to pruneBatchSize documents of the
+// collection whose field is before cutoff, once archive has taken them.
+// newRecord returns what a document is decoded into
+func (s *firestoreStore) pruneCollection(ctx context.Context, collection, field string, cutoff time.Time, newRecord func() interface{}, archive func([]interface{}) error) (int, error) {
+	it := s.client.Collection(s.prefix+collection).Where(field, `<`, cutoff).Limit(pruneBatchSize).Documents(ctx)
+	defer it.Stop()
+
+	var refs []*firestore.DocumentRef
+	var records []interface{}
+	for {
+		snap, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return 0, errors.Wrapf(err, `failed to list expired %s from firestore`, collection)
+		}
+		r := newRecord()
+		if err := snap.DataTo(r); err != nil {
+			return 0, errors.Wrapf(err, `failed to decode %s`, collection)
+		}
+		refs = append(refs, snap.Ref)
+		records = append(records, r)
+	}
+	if len(refs) == 0 {
+		return 0, nil
+	}
+	if err := archive(records); err != nil {
+		return 0, err
+	}
+
+	for i, ref := range refs {
+		if _, err := ref.Delete(ctx); err != nil {
+			return i, errors.Wrapf(err, `failed to delete expired %s from firestore`, collection)
+		}
+	}
+	return len(refs), nil
+}
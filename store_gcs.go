@@ -0,0 +1,268 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// how many times a conflicting update of the admin state is retried
+const gcsUpdateAttempts = 5
+
+// gcsStore keeps each record in a JSON object in a GCS bucket. The
+// admin state is updated with generation preconditions, so concurrent
+// updates do not overwrite each other
+type gcsStore struct {
+	service *storage.Service
+	bucket  string
+	prefix  string
+}
+
+// NewGCSStore creates a Store that keeps its records as JSON objects
+// under prefix in the given bucket
+func NewGCSStore(client *http.Client, bucket, prefix string) (Store, error) {
+	svc, err := storage.New(client)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create storage.Service`)
+	}
+	return &gcsStore{service: svc, bucket: bucket, prefix: prefix}, nil
+}
+
+// read decodes the object into v, and returns its generation. The
+// generation is 0 if the object does not exist, in which case v is
+// left untouched
+func (s *gcsStore) read(ctx context.Context, name string, v interface{}) (int64, error) {
+	res, err := s.service.Objects.Get(s.bucket, s.prefix+name).Context(ctx).Download()
+	if err != nil {
+		if isNotFound(err) {
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, `failed to download %s`, name)
+	}
+	defer res.Body.Close()
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, errors.Wrapf(err, `failed to read %s`, name)
+	}
+	if err := json.Unmarshal(buf, v); err != nil {
+		return 0, errors.Wrapf(err, `failed to decode %s`, name)
+	}
+	generation, _ := strconv.ParseInt(res.Header.Get(`X-Goog-Generation`), 10, 64)
+	return generation, nil
+}
+
+// write encodes v into the object. If generation is not negative, the
+// write only succeeds if the object is still at that generation
+func (s *gcsStore) write(ctx context.Context, name string, v interface{}, generation int64) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, `failed to encode %s`, name)
+	}
+
+	call := s.service.Objects.Insert(s.bucket, &storage.Object{
+		Name:        s.prefix + name,
+		ContentType: `application/json`,
+	}).Media(bytes.NewReader(buf)).Context(ctx)
+	if generation >= 0 {
+		call = call.IfGenerationMatch(generation)
+	}
+	if _, err := call.Do(); err != nil {
+		return errors.Wrapf(err, `failed to upload %s`, name)
+	}
+	return nil
+}
+
+func (s *gcsStore) LoadRunStatus(ctx context.Context, project string) (*RunStatus, error) {
+	var status RunStatus
+	generation, err := s.read(ctx, `runs/`+project+`.json`, &status)
+	if err != nil || generation == 0 {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (s *gcsStore) SaveRunStatus(ctx context.Context, status *RunStatus) error {
+	return s.write(ctx, `runs/`+status.Project+`.json`, status, -1)
+}
+
+func (s *gcsStore) ListCandidates(ctx context.Context, project string) ([]*Candidate, error) {
+	var list []*Candidate
+	if _, err := s.read(ctx, `candidates/`+project+`.json`, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *gcsStore) SaveCandidates(ctx context.Context, project string, candidates []*Candidate) error {
+	if candidates == nil {
+		candidates = []*Candidate{}
+	}
+	return s.write(ctx, `candidates/`+project+`.json`, candidates, -1)
+}
+
+func (s *gcsStore) ListEmptyGroups(ctx context.Context, project string) ([]*Candidate, error) {
+	var list []*Candidate
+	if _, err := s.read(ctx, `empty-groups/`+project+`.json`, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *gcsStore) SaveEmptyGroups(ctx context.Context, project string, groups []*Candidate) error {
+	if groups == nil {
+		groups = []*Candidate{}
+	}
+	return s.write(ctx, `empty-groups/`+project+`.json`, groups, -1)
+}
+
+func (s *gcsStore) ListUnusedAddresses(ctx context.Context, project string) ([]*Candidate, error) {
+	var list []*Candidate
+	if _, err := s.read(ctx, `unused-addresses/`+project+`.json`, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *gcsStore) SaveUnusedAddresses(ctx context.Context, project string, addresses []*Candidate) error {
+	if addresses == nil {
+		addresses = []*Candidate{}
+	}
+	return s.write(ctx, `unused-addresses/`+project+`.json`, addresses, -1)
+}
+
+func (s *gcsStore) ListHandoffs(ctx context.Context, project string) ([]*Candidate, error) {
+	var list []*Candidate
+	if _, err := s.read(ctx, `handoffs/`+project+`.json`, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *gcsStore) SaveHandoffs(ctx context.Context, project string, handoffs []*Candidate) error {
+	if handoffs == nil {
+		handoffs = []*Candidate{}
+	}
+	return s.write(ctx, `handoffs/`+project+`.json`, handoffs, -1)
+}
+
+func (s *gcsStore) ListDeletedClusters(ctx context.Context, project string) ([]*DeletedCluster, error) {
+	var list []*DeletedCluster
+	if _, err := s.read(ctx, `deleted-clusters/`+project+`.json`, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// the clusters of a project share an object, which is updated with
+// generation preconditions like the admin state
+func (s *gcsStore) SaveDeletedCluster(ctx context.Context, dc *DeletedCluster) error {
+	name := `deleted-clusters/` + dc.Project + `.json`
+	var err error
+	for attempt := 0; attempt < gcsUpdateAttempts; attempt++ {
+		var list []*DeletedCluster
+		var generation int64
+		generation, err = s.read(ctx, name, &list)
+		if err != nil {
+			return err
+		}
+
+		err = s.write(ctx, name, replaceDeletedCluster(list, dc), generation)
+		if !isPreconditionFailed(err) {
+			return err
+		}
+	}
+	return errors.Wrap(err, `gave up saving deleted cluster after conflicting updates`)
+}
+
+func (s *gcsStore) LoadAdminState(ctx context.Context) (*AdminState, error) {
+	var st AdminState
+	if _, err := s.read(ctx, `admin-state.json`, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (s *gcsStore) UpdateAdminState(ctx context.Context, f func(*AdminState)) error {
+	var err error
+	for attempt := 0; attempt < gcsUpdateAttempts; attempt++ {
+		var st AdminState
+		var generation int64
+		generation, err = s.read(ctx, `admin-state.json`, &st)
+		if err != nil {
+			return err
+		}
+		f(&st)
+
+		err = s.write(ctx, `admin-state.json`, &st, generation)
+		if !isPreconditionFailed(err) {
+			return err
+		}
+	}
+	return errors.Wrap(err, `gave up updating admin state after conflicting updates`)
+}
+
+// only the deleted clusters are pruned, as the store keeps no history.
+// the object of each project is rewritten with a generation
+// precondition, so a cluster saved in the meantime fails the pruning
+// of its project until the next time around
+func (s *gcsStore) PruneRecords(ctx context.Context, record string, cutoff time.Time, archive func([]interface{}) error) (int, error) {
+	if record != RecordDeletedClusters {
+		return 0, nil
+	}
+
+	var names []string
+	err := s.service.Objects.List(s.bucket).Prefix(s.prefix+`deleted-clusters/`).Pages(ctx, func(l *storage.Objects) error {
+		for _, o := range l.Items {
+			names = append(names, strings.TrimPrefix(o.Name, s.prefix))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, `failed to list deleted clusters`)
+	}
+
+	var pruned int
+	for _, name := range names {
+		var list []*DeletedCluster
+		generation, err := s.read(ctx, name, &list)
+		if err != nil {
+			return pruned, err
+		}
+
+		var expired []interface{}
+		kept := []*DeletedCluster{}
+		for _, dc := range list {
+			if dc.DeletedAt.Before(cutoff) {
+				expired = append(expired, dc)
+				continue
+			}
+			kept = append(kept, dc)
+		}
+		if len(expired) == 0 {
+			continue
+		}
+		if err := archive(expired); err != nil {
+			return pruned, err
+		}
+		if err := s.write(ctx, name, kept, generation); err != nil {
+			return pruned, err
+		}
+		pruned += len(expired)
+	}
+	return pruned, nil
+}
+
+func isPreconditionFailed(err error) bool {
+	ge, ok := errors.Cause(err).(*googleapi.Error)
+	return ok && ge.Code == http.StatusPreconditionFailed
+}
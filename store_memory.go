@@ -0,0 +1,259 @@
+package autolbclean
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps everything in memory, for deployments that do not
+// need the state to outlive the process, and for tests
+type memoryStore struct {
+	mu         sync.Mutex
+	statuses   map[string]RunStatus
+	candidates map[string][]Candidate
+	groups     map[string][]Candidate
+	addresses  map[string][]Candidate
+	handoffs   map[string][]Candidate
+	clusters   map[string][]*DeletedCluster
+	state      AdminState
+	runs       []RunRecord
+	events     []DeletionEvent
+}
+
+// NewMemoryStore creates a Store that keeps everything in memory
+func NewMemoryStore() Store {
+	return &memoryStore{
+		statuses:   make(map[string]RunStatus),
+		candidates: make(map[string][]Candidate),
+		groups:     make(map[string][]Candidate),
+		addresses:  make(map[string][]Candidate),
+		handoffs:   make(map[string][]Candidate),
+		clusters:   make(map[string][]*DeletedCluster),
+	}
+}
+
+func (s *memoryStore) LoadRunStatus(_ context.Context, project string) (*RunStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, ok := s.statuses[project]
+	if !ok {
+		return nil, nil
+	}
+	return &status, nil
+}
+
+func (s *memoryStore) SaveRunStatus(_ context.Context, status *RunStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[status.Project] = *status
+	return nil
+}
+
+func (s *memoryStore) ListCandidates(_ context.Context, project string) ([]*Candidate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*Candidate
+	for _, c := range s.candidates[project] {
+		c := c
+		list = append(list, &c)
+	}
+	return list, nil
+}
+
+func (s *memoryStore) SaveCandidates(_ context.Context, project string, candidates []*Candidate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Candidate, len(candidates))
+	for i, c := range candidates {
+		list[i] = *c
+	}
+	s.candidates[project] = list
+	return nil
+}
+
+func (s *memoryStore) ListEmptyGroups(_ context.Context, project string) ([]*Candidate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*Candidate
+	for _, c := range s.groups[project] {
+		c := c
+		list = append(list, &c)
+	}
+	return list, nil
+}
+
+func (s *memoryStore) SaveEmptyGroups(_ context.Context, project string, groups []*Candidate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Candidate, len(groups))
+	for i, c := range groups {
+		list[i] = *c
+	}
+	s.groups[project] = list
+	return nil
+}
+
+func (s *memoryStore) ListUnusedAddresses(_ context.Context, project string) ([]*Candidate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*Candidate
+	for _, c := range s.addresses[project] {
+		c := c
+		list = append(list, &c)
+	}
+	return list, nil
+}
+
+func (s *memoryStore) SaveUnusedAddresses(_ context.Context, project string, addresses []*Candidate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Candidate, len(addresses))
+	for i, c := range addresses {
+		list[i] = *c
+	}
+	s.addresses[project] = list
+	return nil
+}
+
+func (s *memoryStore) ListHandoffs(_ context.Context, project string) ([]*Candidate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*Candidate
+	for _, c := range s.handoffs[project] {
+		c := c
+		list = append(list, &c)
+	}
+	return list, nil
+}
+
+func (s *memoryStore) SaveHandoffs(_ context.Context, project string, handoffs []*Candidate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Candidate, len(handoffs))
+	for i, c := range handoffs {
+		list[i] = *c
+	}
+	s.handoffs[project] = list
+	return nil
+}
+
+func (s *memoryStore) ListDeletedClusters(_ context.Context, project string) ([]*DeletedCluster, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*DeletedCluster
+	for _, dc := range s.clusters[project] {
+		dc := *dc
+		list = append(list, &dc)
+	}
+	return list, nil
+}
+
+func (s *memoryStore) SaveDeletedCluster(_ context.Context, dc *DeletedCluster) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *dc
+	s.clusters[dc.Project] = replaceDeletedCluster(s.clusters[dc.Project], &saved)
+	return nil
+}
+
+func (s *memoryStore) LoadAdminState(_ context.Context) (*AdminState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.clone(), nil
+}
+
+func (s *memoryStore) UpdateAdminState(_ context.Context, f func(*AdminState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.state.clone()
+	f(st)
+	s.state = *st
+	return nil
+}
+
+func (s *memoryStore) PruneRecords(_ context.Context, record string, cutoff time.Time, archive func([]interface{}) error) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []interface{}
+	switch record {
+	case RecordRuns:
+		var kept []RunRecord
+		for _, r := range s.runs {
+			if r.StartedAt.Before(cutoff) {
+				expired = append(expired, r)
+				continue
+			}
+			kept = append(kept, r)
+		}
+		if err := archive(expired); err != nil {
+			return 0, err
+		}
+
+		// the events of the runs go with them, so that none is left
+		// without its run
+		pruned := make(map[string]struct{})
+		for _, r := range expired {
+			pruned[r.(RunRecord).RunID] = struct{}{}
+		}
+		var events []interface{}
+		var keptEvents []DeletionEvent
+		for _, ev := range s.events {
+			if _, ok := pruned[ev.RunID]; ok {
+				events = append(events, ev)
+				continue
+			}
+			keptEvents = append(keptEvents, ev)
+		}
+		if len(events) > 0 {
+			if err := archive(events); err != nil {
+				return 0, err
+			}
+		}
+		s.runs = kept
+		s.events = keptEvents
+	case RecordEvents:
+		var kept []DeletionEvent
+		for _, ev := range s.events {
+			if ev.At.Before(cutoff) {
+				expired = append(expired, ev)
+				continue
+			}
+			kept = append(kept, ev)
+		}
+		if err := archive(expired); err != nil {
+			return 0, err
+		}
+		s.events = kept
+	case RecordDeletedClusters:
+		kept := make(map[string][]*DeletedCluster)
+		for project, list := range s.clusters {
+			for _, dc := range list {
+				if dc.DeletedAt.Before(cutoff) {
+					expired = append(expired, *dc)
+					continue
+				}
+				kept[project] = append(kept[project], dc)
+			}
+		}
+		if err := archive(expired); err != nil {
+			return 0, err
+		}
+		s.clusters = kept
+	}
+	return len(expired), nil
+}
+
+// clone returns a copy of st that does not share its slices
+func (st *AdminState) clone() *AdminState {
+	return &AdminState{
+		Paused:       st.Paused,
+		Suppressions: append([]string(nil), st.Suppressions...),
+		SuppressedAt: append([]time.Time(nil), st.SuppressedAt...),
+		Snoozes:      append([]Snooze(nil), st.Snoozes...),
+		Epoch:        st.Epoch,
+		Fingerprint:  st.Fingerprint,
+		WasPaused:    st.WasPaused,
+	}
+}
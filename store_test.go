@@ -0,0 +1,219 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordRun(t *testing.T) {
+	ctx := context.Background()
+	store := autolbclean.NewMemoryStore()
+	app, err := autolbclean.New(`p`, &http.Client{}, autolbclean.WithStore(store))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	orphans := []*autolbclean.Orphan{
+		{SelfLink: `https://www.googleapis.com/compute/v1/projects/p/global/targetHttpProxies/k8s-tp-1`},
+		{SelfLink: `https://www.googleapis.com/compute/v1/projects/p/global/targetHttpProxies/k8s-tp-2`, ForwardingRule: `k8s-fw-2`, Region: `global`},
+	}
+	stats, err := app.RecordRun(ctx, orphans)
+	if !assert.NoError(t, err, `RecordRun should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 2, stats.NewOrphans, `all orphans should be new`) {
+		return
+	}
+
+	stats, err = app.RecordRun(ctx, orphans[1:])
+	if !assert.NoError(t, err, `RecordRun should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 0, stats.NewOrphans, `known orphans should not be new`) {
+		return
+	}
+
+	candidates, err := store.ListCandidates(ctx, `p`)
+	if !assert.NoError(t, err, `ListCandidates should succeed`) {
+		return
+	}
+	if !assert.Len(t, candidates, 1, `orphans that were not seen again should be forgotten`) {
+		return
+	}
+	if !assert.Equal(t, `k8s-fw-2`, candidates[0].ForwardingRule, `the forwarding rule should be recorded, for completion`) {
+		return
+	}
+
+	status, err := store.LoadRunStatus(ctx, `p`)
+	if !assert.NoError(t, err, `LoadRunStatus should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 1, status.Orphans, `run status should match the latest run`) {
+		return
+	}
+}
+
+func TestApplyAdminState(t *testing.T) {
+	ctx := context.Background()
+	store := autolbclean.NewMemoryStore()
+	err := store.UpdateAdminState(ctx, func(st *autolbclean.AdminState) {
+		st.Paused = true
+		st.Suppressions = append(st.Suppressions, `k8s-fw-keep-*`)
+	})
+	if !assert.NoError(t, err, `UpdateAdminState should succeed`) {
+		return
+	}
+
+	app, err := autolbclean.New(`p`, &http.Client{}, autolbclean.WithStore(store))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+	if !assert.NoError(t, app.ApplyAdminState(ctx), `ApplyAdminState should succeed`) {
+		return
+	}
+	if !assert.True(t, app.Config().Paused, `app should be paused`) {
+		return
+	}
+	if !assert.Contains(t, app.Config().Exclusions, `k8s-fw-keep-*`, `suppressions should be excluded`) {
+		return
+	}
+}
+
+func TestPurgeEpoch(t *testing.T) {
+	ctx := context.Background()
+	store := autolbclean.NewMemoryStore()
+	e := &flakyEnqueuer{}
+	app, err := autolbclean.New(`p`, &http.Client{}, autolbclean.WithStore(store), autolbclean.WithTaskEnqueuer(e))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	err = store.UpdateAdminState(ctx, func(st *autolbclean.AdminState) {
+		st.Paused = true
+		st.Epoch++
+	})
+	if !assert.NoError(t, err, `UpdateAdminState should succeed`) {
+		return
+	}
+	if !assert.NoError(t, app.ApplyAdminState(ctx), `ApplyAdminState should succeed`) {
+		return
+	}
+
+	if !assert.NoError(t, app.Enqueue(ctx, &autolbclean.Task{Path: `/job/url-maps/delete`}), `Enqueue should succeed`) {
+		return
+	}
+	if !assert.Equal(t, `1`, e.tasks[0].Params.Get(`epoch`), `task should carry the current epoch`) {
+		return
+	}
+}
+
+func TestEpochOnConfigChange(t *testing.T) {
+	ctx := context.Background()
+	store := autolbclean.NewMemoryStore()
+	epoch := func(c *autolbclean.Config) int {
+		app, err := autolbclean.New(`p`, &http.Client{}, autolbclean.WithStore(store), autolbclean.WithConfig(c))
+		if !assert.NoError(t, err, `New should succeed`) {
+			return -1
+		}
+		if !assert.NoError(t, app.ApplyAdminState(ctx), `ApplyAdminState should succeed`) {
+			return -1
+		}
+		st, _ := store.LoadAdminState(ctx)
+		return st.Epoch
+	}
+
+	c := autolbclean.DefaultConfig()
+	if !assert.Equal(t, 0, epoch(c), `the first configuration should not start a new epoch`) {
+		return
+	}
+	if !assert.Equal(t, 0, epoch(autolbclean.DefaultConfig()), `the same configuration should not start a new epoch`) {
+		return
+	}
+
+	c.Retry.Mutation.Attempts++
+	if !assert.Equal(t, 0, epoch(c), `changing retries should not start a new epoch`) {
+		return
+	}
+
+	c.ForwardingRulePrefixes = append(c.ForwardingRulePrefixes, `k8s2-fr`)
+	if !assert.Equal(t, 1, epoch(c), `changing prefixes should start a new epoch`) {
+		return
+	}
+
+	c.Paused = true
+	if !assert.Equal(t, 1, epoch(c), `pausing should not start a new epoch`) {
+		return
+	}
+	c.Paused = false
+	if !assert.Equal(t, 2, epoch(c), `unpausing should start a new epoch`) {
+		return
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	store := autolbclean.NewMemoryStore()
+	app, err := autolbclean.New(`p`, &http.Client{}, autolbclean.WithStore(store), autolbclean.WithRunID(`run-1`))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	started := time.Now().UTC()
+	if !assert.NoError(t, app.SaveRun(ctx, &autolbclean.RunRecord{StartedAt: started, Orphans: 2, Scheduled: 5}), `SaveRun should succeed`) {
+		return
+	}
+	d := &autolbclean.Deletion{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-foo`}
+	if !assert.NoError(t, app.PublishEvent(ctx, d, autolbclean.DecisionScheduled, nil), `PublishEvent should succeed`) {
+		return
+	}
+
+	h := store.(autolbclean.HistoryStore)
+	runs, err := h.ListRuns(ctx, `p`, started.Add(-time.Minute))
+	if !assert.NoError(t, err, `ListRuns should succeed`) {
+		return
+	}
+	if !assert.Len(t, runs, 1) || !assert.Equal(t, `run-1`, runs[0].RunID) || !assert.Equal(t, 5, runs[0].Scheduled) {
+		return
+	}
+
+	events, err := h.ListEvents(ctx, `run-1`)
+	if !assert.NoError(t, err, `ListEvents should succeed`) {
+		return
+	}
+	if !assert.Len(t, events, 1, `events should be recorded without a publisher`) {
+		return
+	}
+	if !assert.Equal(t, `k8s-um-foo`, events[0].Name) {
+		return
+	}
+}
+
+func TestValidateStoreLocation(t *testing.T) {
+	for _, location := range []string{`memory`, `gs://bucket/prefix`, `firestore://project`} {
+		if !assert.NoError(t, autolbclean.ValidateStoreLocation(location), `%s should be valid`, location) {
+			return
+		}
+	}
+	// datastore is only available on App Engine
+	for _, location := range []string{`datastore`, `gs://`, `firestore:///prefix`, `s3://bucket`} {
+		if !assert.Error(t, autolbclean.ValidateStoreLocation(location), `%s should be rejected`, location) {
+			return
+		}
+	}
+}
+
+func TestValidateStandalone(t *testing.T) {
+	c := autolbclean.DefaultConfig()
+	if !assert.NoError(t, c.ValidateStandalone(), `the default configuration should be valid`) {
+		return
+	}
+	c.DisableBeforeDelete = map[string]autolbclean.GracePeriod{autolbclean.KindFirewalls: autolbclean.GracePeriod(72 * time.Hour)}
+	if !assert.Error(t, c.ValidateStandalone(), `disable_before_delete should be rejected`) {
+		return
+	}
+}
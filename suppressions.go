@@ -0,0 +1,145 @@
+package autolbclean
+
+import (
+	"path"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Suppression is a suppression of the admin state, as it is archived
+// once its retention expires
+type Suppression struct {
+	Pattern      string    `json:"pattern"`
+	SuppressedAt time.Time `json:"suppressed_at"`
+}
+
+// stampSuppressions records now as the time that the suppressions were
+// added at, for those that have none, as states saved before the times
+// were recorded do. It returns true if there were any
+func (st *AdminState) stampSuppressions(now time.Time) bool {
+	if len(st.SuppressedAt) == len(st.Suppressions) {
+		return false
+	}
+	for len(st.SuppressedAt) < len(st.Suppressions) {
+		st.SuppressedAt = append(st.SuppressedAt, now)
+	}
+	st.SuppressedAt = st.SuppressedAt[:len(st.Suppressions)]
+	return true
+}
+
+// suppress adds the pattern to the suppressions, unless it is there
+// already
+func (st *AdminState) suppress(pattern string, now time.Time) {
+	st.stampSuppressions(now)
+	for _, p := range st.Suppressions {
+		if p == pattern {
+			return
+		}
+	}
+	st.Suppressions = append(st.Suppressions, pattern)
+	st.SuppressedAt = append(st.SuppressedAt, now)
+}
+
+// ExportSuppressions returns the suppressions and the snoozes of the
+// admin state as a document, sorted so that exports of the same state
+// compare equal
+func ExportSuppressions(st *AdminState) *SuppressionList {
+	l := &SuppressionList{
+		Suppressions: append([]string{}, st.Suppressions...),
+		Snoozes:      append([]Snooze{}, st.Snoozes...),
+	}
+	sort.Strings(l.Suppressions)
+	sort.Slice(l.Snoozes, func(i, j int) bool {
+		return l.Snoozes[i].SelfLink < l.Snoozes[j].SelfLink
+	})
+	return l
+}
+
+// ParseSuppressionList parses a document as written by
+// ExportSuppressions. Unknown fields are rejected, as they are most
+// likely typos that would otherwise silently drop an entry
+func ParseSuppressionList(buf []byte) (*SuppressionList, error) {
+	var l SuppressionList
+	if err := yaml.UnmarshalStrict(buf, &l); err != nil {
+		return nil, errors.Wrap(err, `failed to parse suppression list`)
+	}
+
+	for _, pattern := range l.Suppressions {
+		if _, err := path.Match(pattern, ``); err != nil || len(pattern) == 0 {
+			return nil, errors.Errorf(`invalid suppression pattern %q`, pattern)
+		}
+	}
+	seen := make(map[string]struct{})
+	for i, s := range l.Snoozes {
+		if len(s.SelfLink) == 0 || s.Until.IsZero() {
+			return nil, errors.Errorf(`snooze %d needs a self_link and an until`, i)
+		}
+		if _, ok := seen[s.SelfLink]; ok {
+			return nil, errors.Errorf(`duplicate snooze of %s`, s.SelfLink)
+		}
+		seen[s.SelfLink] = struct{}{}
+	}
+	return &l, nil
+}
+
+// Apply imports the list into the admin state. With replace, the list
+// replaces the suppressions and the snoozes of the state. Otherwise
+// they are merged: patterns that are not suppressed yet are added, and
+// a snooze of an orphan that is already snoozed is kept if it lasts
+// longer, carrying the higher of the two counts
+func (l *SuppressionList) Apply(st *AdminState, replace bool) {
+	now := time.Now().UTC()
+	if replace {
+		// patterns that were suppressed already keep their age
+		st.stampSuppressions(now)
+		suppressedAt := make(map[string]time.Time)
+		for i, pattern := range st.Suppressions {
+			suppressedAt[pattern] = st.SuppressedAt[i]
+		}
+		st.Suppressions = nil
+		st.SuppressedAt = nil
+		for _, pattern := range l.Suppressions {
+			at, ok := suppressedAt[pattern]
+			if !ok {
+				at = now
+			}
+			st.Suppressions = append(st.Suppressions, pattern)
+			st.SuppressedAt = append(st.SuppressedAt, at)
+		}
+		st.Snoozes = append([]Snooze(nil), l.Snoozes...)
+		return
+	}
+
+	for _, pattern := range l.Suppressions {
+		st.suppress(pattern, now)
+	}
+
+	for _, s := range l.Snoozes {
+		i := indexOfSnooze(st.Snoozes, s.SelfLink)
+		if i < 0 {
+			st.Snoozes = append(st.Snoozes, s)
+			continue
+		}
+		known := st.Snoozes[i]
+		if s.Until.After(known.Until) {
+			known.Until = s.Until
+			known.By = s.By
+		}
+		if s.Count > known.Count {
+			known.Count = s.Count
+		}
+		st.Snoozes[i] = known
+	}
+}
+
+func indexOfSnooze(list []Snooze, selfLink string) int {
+	for i, s := range list {
+		if s.SelfLink == selfLink {
+			return i
+		}
+	}
+	return -1
+}
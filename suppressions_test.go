@@ -0,0 +1,73 @@
+package autolbclean_test
+
+import (
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestSuppressionList(t *testing.T) {
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	st := &autolbclean.AdminState{
+		Suppressions: []string{`k8s-fw-b-*`, `k8s-fw-a-*`},
+		Snoozes: []autolbclean.Snooze{
+			{SelfLink: `tp-b`, Until: now.Add(time.Hour), Count: 1, By: `alice@example.com`},
+			{SelfLink: `tp-a`, Until: now.Add(2 * time.Hour), Count: 2, By: `alice@example.com`},
+		},
+	}
+
+	buf, err := yaml.Marshal(autolbclean.ExportSuppressions(st))
+	if !assert.NoError(t, err, `yaml.Marshal should succeed`) {
+		return
+	}
+	l, err := autolbclean.ParseSuppressionList(buf)
+	if !assert.NoError(t, err, `ParseSuppressionList should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{`k8s-fw-a-*`, `k8s-fw-b-*`}, l.Suppressions, `suppressions should be sorted`) {
+		return
+	}
+	if !assert.Len(t, l.Snoozes, 2) || !assert.Equal(t, `tp-a`, l.Snoozes[0].SelfLink, `snoozes should be sorted`) || !assert.True(t, now.Add(2*time.Hour).Equal(l.Snoozes[0].Until)) {
+		return
+	}
+
+	other := &autolbclean.AdminState{
+		Suppressions: []string{`k8s-fw-a-*`, `k8s-fw-c-*`},
+		Snoozes: []autolbclean.Snooze{
+			{SelfLink: `tp-a`, Until: now.Add(time.Hour), Count: 3, By: `bob@example.com`},
+		},
+	}
+	l.Apply(other, false)
+	if !assert.Equal(t, []string{`k8s-fw-a-*`, `k8s-fw-c-*`, `k8s-fw-b-*`}, other.Suppressions, `suppressions should be merged`) {
+		return
+	}
+	if !assert.Len(t, other.Snoozes, 2, `snoozes should be merged`) {
+		return
+	}
+	merged := other.Snoozes[0]
+	if !assert.True(t, now.Add(2*time.Hour).Equal(merged.Until), `the longer snooze should win`) || !assert.Equal(t, 3, merged.Count, `the higher count should be kept`) || !assert.Equal(t, `alice@example.com`, merged.By) {
+		return
+	}
+
+	l.Apply(other, true)
+	if !assert.Equal(t, l.Suppressions, other.Suppressions, `suppressions should be replaced`) || !assert.Len(t, other.Snoozes, 2) {
+		return
+	}
+}
+
+func TestParseSuppressionListInvalid(t *testing.T) {
+	for _, doc := range []string{
+		"suppressions:\n  - '['\n",
+		"suppresions:\n  - k8s-fw-*\n",
+		"snoozes:\n  - self_link: tp-a\n",
+		"snoozes:\n  - self_link: tp-a\n    until: 2026-10-16T00:00:00Z\n  - self_link: tp-a\n    until: 2026-10-17T00:00:00Z\n",
+	} {
+		_, err := autolbclean.ParseSuppressionList([]byte(doc))
+		if !assert.Error(t, err, `ParseSuppressionList should fail for %q`, doc) {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package autolbclean
+
+import (
+	"context"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// DefaultTagIndexTTL is the default amount of time an instance tag
+// index is considered fresh enough to be reused. It must be longer than
+// the interval of the firewall rule sweep in cron.yaml (10 minutes), or
+// the next run never finds the index that the previous one saved
+const DefaultTagIndexTTL = 30 * time.Minute
+
+// InstanceTagIndex returns the most recently saved index of gke-* tags
+// attached to instances, if there is one that is still fresh. This allows
+// sweeps to find out about live GKE nodes without scanning every zone
+func (app *App) InstanceTagIndex(ctx context.Context) *InstanceTagIndex {
+	if app.tagIndexStore == nil || app.tagIndexTTL <= 0 {
+		return nil
+	}
+
+	idx, err := app.tagIndexStore.LoadTagIndex(ctx)
+	if err != nil || idx == nil {
+		return nil
+	}
+
+	if time.Since(idx.CreatedAt) > app.tagIndexTTL {
+		return nil
+	}
+	return idx
+}
+
+// applyTagIndex removes the tags that are known to be attached to
+// instances from tags2fws, using the saved index. It returns true if
+// the index was able to account for all of the tags, in which case
+// there is no need to scan the instances
+func (app *App) applyTagIndex(ctx context.Context, tags2fws map[string][]*compute.Firewall) bool {
+	idx := app.InstanceTagIndex(ctx)
+	if idx == nil {
+		return false
+	}
+
+	for tag := range tags2fws {
+		if idx.Tags[tag] > 0 {
+			delete(tags2fws, tag)
+		}
+	}
+
+	if len(tags2fws) == 0 {
+		return true
+	}
+
+	// The index can only tell us that a tag is not in use if it was
+	// built from a full scan, and if the firewall rules were created
+	// before the index was. Otherwise a brand new cluster could lose
+	// its firewall rules
+	if !idx.Complete {
+		return false
+	}
+
+	for _, fws := range tags2fws {
+		for _, fw := range fws {
+			createdAt, err := time.Parse(time.RFC3339, fw.CreationTimestamp)
+			if err != nil || !createdAt.Before(idx.CreatedAt) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (app *App) saveTagIndex(ctx context.Context, idx *InstanceTagIndex) {
+	if app.tagIndexStore == nil || app.tagIndexTTL <= 0 {
+		return
+	}
+
+	// Failing to save the index only means that the next run has
+	// to scan everything again
+	_ = app.tagIndexStore.SaveTagIndex(ctx, idx, app.tagIndexTTL)
+}
@@ -0,0 +1,44 @@
+package autolbclean
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/appengine/memcache"
+)
+
+const tagIndexMemcacheKey = `autolbclean.instance-tag-index`
+
+// memcacheTagIndexStore stores the instance tag index of a project in
+// App Engine memcache
+type memcacheTagIndexStore struct {
+	project string
+}
+
+func (s memcacheTagIndexStore) key() string {
+	return tagIndexMemcacheKey + `.` + s.project
+}
+
+func (s memcacheTagIndexStore) LoadTagIndex(ctx context.Context) (*InstanceTagIndex, error) {
+	var idx InstanceTagIndex
+	if _, err := memcache.Gob.Get(ctx, s.key(), &idx); err != nil {
+		if err == memcache.ErrCacheMiss {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, `failed to load tag index from memcache`)
+	}
+	return &idx, nil
+}
+
+func (s memcacheTagIndexStore) SaveTagIndex(ctx context.Context, idx *InstanceTagIndex, ttl time.Duration) error {
+	err := memcache.Gob.Set(ctx, &memcache.Item{
+		Key:        s.key(),
+		Object:     idx,
+		Expiration: ttl,
+	})
+	if err != nil {
+		return errors.Wrap(err, `failed to save tag index to memcache`)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package autolbclean
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+// serviceNameKey is the key in the JSON description of the resources
+// that GKE creates for LoadBalancer services
+const serviceNameKey = `kubernetes.io/service-name`
+
+// kubernetesServiceName returns the namespace/name of the Kubernetes
+// service that the description of a target pool or forwarding rule
+// refers to, or an empty string if it was not created by GKE
+func kubernetesServiceName(description string) string {
+	var v map[string]string
+	if err := json.Unmarshal([]byte(description), &v); err != nil {
+		return ``
+	}
+	return v[serviceNameKey]
+}
+
+// instanceKey identifies an instance by its zone and name, so that
+// URLs from different API versions or hosts compare equal
+func instanceKey(u string) string {
+	return zoneOf(u) + `/` + path.Base(u)
+}
+
+// ListOrphanedTargetPools returns the target pools created by GKE for
+// LoadBalancer services whose instances have all been deleted, which
+// happens when a cluster goes away without cleaning up its services.
+//
+// A target pool without any instances is not considered orphaned, as
+// it may belong to a cluster that has been scaled to zero
+func (app *App) ListOrphanedTargetPools(ctx context.Context) ([]*OrphanedTargetPool, error) {
+	c := app.Config()
+
+	var pools []*compute.TargetPool
+	if err := app.checkInventory(ctx, KindTargetPools, func() (int, error) {
+		var err error
+		pools, err = app.listTargetPools(ctx)
+		return len(pools), errors.Wrap(err, `failed to list target pools`)
+	}); err != nil {
+		return nil, err
+	}
+
+	var instances []*compute.Instance
+	if err := app.checkInventory(ctx, inventoryInstances, func() (int, error) {
+		var err error
+		instances, err = app.listAllInstances(ctx)
+		return len(instances), errors.Wrap(err, `failed to list instances`)
+	}); err != nil {
+		return nil, err
+	}
+	alive := make(map[string]struct{})
+	for _, instance := range instances {
+		alive[instanceKey(instance.SelfLink)] = struct{}{}
+	}
+
+	var rules []*compute.ForwardingRule
+	if err := app.checkInventory(ctx, inventoryRegionalForwardingRules, func() (int, error) {
+		var err error
+		rules, err = app.listRegionalForwardingRules(ctx)
+		return len(rules), errors.Wrap(err, `failed to list forwarding rules`)
+	}); err != nil {
+		return nil, err
+	}
+	targets := make(map[string][]string)
+	for _, fr := range rules {
+		name, region, err := parseURL(fr.Target, KindTargetPools)
+		if err != nil {
+			continue
+		}
+		key := region + `/` + name
+		targets[key] = append(targets[key], fr.Name)
+	}
+
+	// the node health check of a cluster is shared by all of its
+	// LoadBalancer services, and must outlive all of their pools
+	healthCheckUsers := make(map[string]int)
+	for _, tp := range pools {
+		for _, u := range tp.HealthChecks {
+			healthCheckUsers[u]++
+		}
+	}
+
+	var clusters []*container.Cluster
+	if c.ClusterCrossCheck {
+		var err error
+		if clusters, err = app.liveClusters(ctx); err != nil {
+			return nil, errors.Wrap(err, `failed to cross-check GKE clusters`)
+		}
+	}
+
+	threshold := time.Now().Add(-1 * c.AgeThresholdOf(KindTargetPools))
+
+	var result []*OrphanedTargetPool
+	for _, tp := range pools {
+		service := kubernetesServiceName(tp.Description)
+		if len(service) == 0 || len(tp.Instances) == 0 || c.IsExcluded(tp.Name) || c.IsProtected(nil, tp.Description) {
+			continue
+		}
+
+		createdAt, _ := time.Parse(time.RFC3339, tp.CreationTimestamp)
+		if createdAt.After(threshold) {
+			continue
+		}
+
+		var inUse bool
+		for _, u := range tp.Instances {
+			if _, ok := alive[instanceKey(u)]; ok {
+				inUse = true
+				break
+			}
+		}
+		if inUse {
+			continue
+		}
+
+		region := path.Base(tp.Region)
+		o := &OrphanedTargetPool{
+			Name:            tp.Name,
+			Region:          region,
+			Service:         service,
+			ForwardingRules: targets[region+`/`+tp.Name],
+			CreatedAt:       createdAt,
+		}
+		for _, u := range tp.HealthChecks {
+			if healthCheckUsers[u] > 1 {
+				continue
+			}
+			ref, err := ParseHealthCheckRef(u)
+			if err != nil || c.IsExcluded(ref.Name) {
+				continue
+			}
+			o.HealthChecks = append(o.HealthChecks, ref)
+		}
+
+		// the pool itself is named after the service, but its forwarding
+		// rules and health checks may carry the UID of the cluster
+		var excluded bool
+		for _, d := range o.Deletions() {
+			if c.ownedByLiveCluster(d.Name, clusters) || (d.Kind == KindForwardingRules && c.IsExcluded(d.Name)) {
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			continue
+		}
+
+		// like the resources of a load balancer, a single resource
+		// that is kept keeps all of them
+		var kept bool
+		for _, d := range o.Deletions() {
+			if sweepPolicyKeeps(ctx, c, &ChainResource{Kind: d.Kind, Name: d.Name, Region: d.Region, CreatedAt: &o.CreatedAt}, nil) {
+				kept = true
+				break
+			}
+		}
+		if kept {
+			continue
+		}
+		result = append(result, o)
+	}
+	return result, nil
+}
+
+// Deletions returns the resources that make up the orphaned target
+// pool. The forwarding rules come first, as they reference the pool,
+// which in turn references the health checks
+func (o *OrphanedTargetPool) Deletions() []*Deletion {
+	var list []*Deletion
+	for _, fr := range o.ForwardingRules {
+		list = append(list, &Deletion{
+			Kind:   KindForwardingRules,
+			Name:   fr,
+			Region: o.Region,
+		})
+	}
+	list = append(list, &Deletion{
+		Kind:   KindTargetPools,
+		Name:   o.Name,
+		Region: o.Region,
+	})
+	for _, hc := range o.HealthChecks {
+		list = append(list, &Deletion{
+			Kind:   hc.Kind,
+			Name:   hc.Name,
+			Region: hc.Region,
+		})
+	}
+	return list
+}
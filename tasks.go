@@ -0,0 +1,172 @@
+package autolbclean
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Task queue backends
+const (
+	TaskBackendTaskqueue  = `taskqueue`
+	TaskBackendCloudTasks = `cloudtasks`
+)
+
+// ParseTaskBackend validates the name of a task queue backend. An
+// empty name selects the legacy App Engine task queue
+func ParseTaskBackend(s string) (string, error) {
+	switch s {
+	case ``:
+		return TaskBackendTaskqueue, nil
+	case TaskBackendTaskqueue, TaskBackendCloudTasks:
+		return s, nil
+	}
+	return ``, errors.Errorf(`invalid task backend %q (expected taskqueue or cloudtasks)`, s)
+}
+
+// enqueueError marks the errors of tasks that could not be enqueued, so
+// that they can be told apart from the errors of API calls
+type enqueueError struct {
+	error
+}
+
+// IsEnqueueError returns true if err is the error of a task that could
+// not be enqueued
+func IsEnqueueError(err error) bool {
+	_, ok := errors.Cause(err).(*enqueueError)
+	return ok
+}
+
+// Enqueue hands the task over to the configured task queue. Failures
+// are retried according to the mutation retry policy: a task that ends
+// up being enqueued twice only deletes a resource that is already gone.
+// Tasks that do not name a project are for the project of the app
+func (app *App) Enqueue(ctx context.Context, t *Task) error {
+	if app.tasks == nil {
+		return errors.Wrap(&enqueueError{errors.New(`no task queue configured`)}, `failed to enqueue task`)
+	}
+
+	if t.Params == nil {
+		t.Params = url.Values{}
+	}
+	if len(t.Params.Get(`project`)) == 0 {
+		t.Params.Set(`project`, app.project)
+	}
+	if len(t.Params.Get(`run`)) == 0 {
+		t.Params.Set(`run`, app.runID)
+	}
+	if len(t.Params.Get(`epoch`)) == 0 {
+		t.Params.Set(`epoch`, strconv.Itoa(app.epoch))
+	}
+	if len(app.taskSigningKey) > 0 {
+		SignTask(app.taskSigningKey, t)
+	}
+
+	policy := app.Config().Retry.Mutation
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = app.tasks.Enqueue(ctx, t); err == nil {
+			return nil
+		}
+		if attempt >= policy.Attempts || sleepContext(ctx, policy.delay(attempt-1)) != nil {
+			break
+		}
+	}
+	return errors.Wrapf(&enqueueError{err}, `failed to enqueue task for %s`, t.Path)
+}
+
+// Validate checks that the queue accepts tasks, and that it makes at
+// least minAttempts attempts at running each of them
+func (s *QueueStatus) Validate(minAttempts int) error {
+	if !s.Running {
+		return errors.Errorf(`queue %s is not running`, s.Name)
+	}
+	if s.MaxAttempts > 0 && s.MaxAttempts < minAttempts {
+		return errors.Errorf(`queue %s makes at most %d attempts per task, but at least %d are required`, s.Name, s.MaxAttempts, minAttempts)
+	}
+	return nil
+}
+
+// VerifyTaskQueue checks that the task queue exists, and that it makes
+// at least minAttempts attempts at running each task. Task queues that
+// can not report their status are assumed to be fine
+func (app *App) VerifyTaskQueue(ctx context.Context, minAttempts int) error {
+	if app.tasks == nil {
+		return errors.New(`no task queue configured`)
+	}
+	v, ok := app.tasks.(QueueVerifier)
+	if !ok {
+		return nil
+	}
+	status, err := v.QueueStatus(ctx)
+	if err != nil {
+		return errors.Wrap(err, `failed to get queue status`)
+	}
+	return status.Validate(minAttempts)
+}
+
+// DefaultTaskExpiration is how long delete jobs may wait in the queue
+// before they are dropped
+const DefaultTaskExpiration = 15 * time.Minute
+
+// TaskExpirationOf returns how long the delete job of a resource of the
+// given kind may wait in the queue, falling back to TaskExpiration
+func (c *Config) TaskExpirationOf(kind string) time.Duration {
+	if d, ok := c.TaskExpirations[kind]; ok {
+		return d
+	}
+	return c.TaskExpiration
+}
+
+// deletionExpires returns the expiration of a delete job for a resource
+// of the given kind, enqueued now to be run after delay
+func (c *Config) deletionExpires(kind string, delay time.Duration) string {
+	return time.Now().UTC().Add(delay + c.TaskExpirationOf(kind)).Format(time.RFC3339)
+}
+
+// DeletionTask creates the delete job for the given deletion. The job
+// is ignored if it is run after expires
+func DeletionTask(d *Deletion, expires string) *Task {
+	var path string
+	v := url.Values{
+		"name":    {d.Name},
+		"region":  {d.Region},
+		"expires": {expires},
+	}
+
+	switch d.Kind {
+	case KindTargetHttpProxies, KindTargetHttpsProxies:
+		path = `/job/target-http-proxies/delete`
+		v.Set("https", strconv.FormatBool(d.Kind == KindTargetHttpsProxies))
+	case KindSslCertificates:
+		path = `/job/ssl-certificates/delete`
+	case KindBackendServices:
+		path = `/job/backend-services/delete`
+	case KindHealthChecks, KindHttpHealthChecks, KindHttpsHealthChecks:
+		path = `/job/health-checks/delete`
+		v.Set("kind", d.Kind)
+	case KindUrlMaps:
+		path = `/job/url-maps/delete`
+	case KindForwardingRules:
+		path = `/job/forwarding-rules/delete`
+	case KindTargetPools:
+		path = `/job/target-pools/delete`
+	case KindInstanceGroups:
+		path = `/job/instance-groups/delete`
+		v.Set("zone", d.Zone)
+	case KindAddresses:
+		path = `/job/addresses/delete`
+	default:
+		// kinds without a route of their own go through the dispatcher
+		path = `/job/resources/delete`
+		v.Set("type", d.Kind)
+		v.Set("zone", d.Zone)
+	}
+	if len(d.Next) > 0 {
+		v.Set("next", encodeDeletionChain(d.Next))
+	}
+	return &Task{Path: path, Params: v, Delay: d.Delay}
+}
@@ -0,0 +1,99 @@
+package autolbclean
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	cloudtasks "cloud.google.com/go/cloudtasks/apiv2"
+	taskspb "cloud.google.com/go/cloudtasks/apiv2/cloudtaskspb"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type cloudTasksEnqueuer struct {
+	client         *cloudtasks.Client
+	queue          string
+	targetURL      string
+	serviceAccount string
+}
+
+// NewCloudTasksEnqueuer creates a TaskEnqueuer backed by Cloud Tasks.
+// queue is the full name of the queue
+// (projects/P/locations/L/queues/Q).
+//
+// When targetURL is empty, tasks are delivered to the auto-lb-clean
+// App Engine service. Otherwise they are POSTed to targetURL followed
+// by the task path, with an OIDC token for serviceAccount, which is how
+// Cloud Run and GKE deployments receive them
+func NewCloudTasksEnqueuer(client *cloudtasks.Client, queue, targetURL, serviceAccount string) TaskEnqueuer {
+	return &cloudTasksEnqueuer{
+		client:         client,
+		queue:          queue,
+		targetURL:      strings.TrimSuffix(targetURL, `/`),
+		serviceAccount: serviceAccount,
+	}
+}
+
+func (e *cloudTasksEnqueuer) Enqueue(ctx context.Context, t *Task) error {
+	body := []byte(t.Params.Encode())
+	headers := map[string]string{
+		`Content-Type`: `application/x-www-form-urlencoded`,
+	}
+
+	task := &taskspb.Task{}
+	if len(e.targetURL) == 0 {
+		task.MessageType = &taskspb.Task_AppEngineHttpRequest{
+			AppEngineHttpRequest: &taskspb.AppEngineHttpRequest{
+				HttpMethod:  taskspb.HttpMethod_POST,
+				RelativeUri: t.Path,
+				Headers:     headers,
+				Body:        body,
+				AppEngineRouting: &taskspb.AppEngineRouting{
+					Service: `auto-lb-clean`,
+				},
+			},
+		}
+	} else {
+		req := &taskspb.HttpRequest{
+			HttpMethod: taskspb.HttpMethod_POST,
+			Url:        e.targetURL + t.Path,
+			Headers:    headers,
+			Body:       body,
+		}
+		if len(e.serviceAccount) > 0 {
+			req.AuthorizationHeader = &taskspb.HttpRequest_OidcToken{
+				OidcToken: &taskspb.OidcToken{
+					ServiceAccountEmail: e.serviceAccount,
+					Audience:            e.targetURL,
+				},
+			}
+		}
+		task.MessageType = &taskspb.Task_HttpRequest{HttpRequest: req}
+	}
+
+	if t.Delay > 0 {
+		task.ScheduleTime = timestamppb.New(time.Now().Add(t.Delay))
+	}
+
+	_, err := e.client.CreateTask(ctx, &taskspb.CreateTaskRequest{
+		Parent: e.queue,
+		Task:   task,
+	})
+	if err != nil {
+		return errors.Wrap(err, `failed to create cloud task`)
+	}
+	return nil
+}
+
+func (e *cloudTasksEnqueuer) QueueStatus(ctx context.Context) (*QueueStatus, error) {
+	q, err := e.client.GetQueue(ctx, &taskspb.GetQueueRequest{Name: e.queue})
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to get queue %s`, e.queue)
+	}
+	return &QueueStatus{
+		Name:        q.GetName(),
+		Running:     q.GetState() == taskspb.Queue_RUNNING,
+		MaxAttempts: int(q.GetRetryConfig().GetMaxAttempts()),
+	}, nil
+}
@@ -0,0 +1,30 @@
+package autolbclean
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/appengine/taskqueue"
+)
+
+// taskqueueEnqueuer enqueues tasks to the legacy App Engine task queue,
+// which is only available on the first generation runtimes
+type taskqueueEnqueuer struct {
+	queue string
+}
+
+func (e taskqueueEnqueuer) Enqueue(ctx context.Context, t *Task) error {
+	task := taskqueue.NewPOSTTask(t.Path, t.Params)
+	task.Delay = t.Delay
+	_, err := taskqueue.Add(ctx, task, e.queue)
+	return err
+}
+
+// QueueStatus only tells whether the queue exists, as the retry
+// parameters in queue.yaml can not be read back
+func (e taskqueueEnqueuer) QueueStatus(ctx context.Context) (*QueueStatus, error) {
+	if _, err := taskqueue.QueueStats(ctx, []string{e.queue}); err != nil {
+		return nil, errors.Wrapf(err, `queue %s does not exist`, e.queue)
+	}
+	return &QueueStatus{Name: e.queue, Running: true}, nil
+}
@@ -0,0 +1,151 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeletionTask(t *testing.T) {
+	task := autolbclean.DeletionTask(&autolbclean.Deletion{
+		Kind:   autolbclean.KindHealthChecks,
+		Name:   `k8s-be-30000`,
+		Region: `asia-northeast1`,
+	}, `2026-10-16T00:00:00Z`)
+	if !assert.Equal(t, `/job/health-checks/delete`, task.Path, `path should match`) {
+		return
+	}
+	if !assert.Equal(t, `expires=2026-10-16T00%3A00%3A00Z&kind=healthChecks&name=k8s-be-30000&region=asia-northeast1`, task.Params.Encode(), `params should match`) {
+		return
+	}
+}
+
+func TestParseTaskBackend(t *testing.T) {
+	for in, expected := range map[string]string{
+		``:           autolbclean.TaskBackendTaskqueue,
+		`taskqueue`:  autolbclean.TaskBackendTaskqueue,
+		`cloudtasks`: autolbclean.TaskBackendCloudTasks,
+	} {
+		v, err := autolbclean.ParseTaskBackend(in)
+		if !assert.NoError(t, err, `parsing %q should succeed`, in) {
+			return
+		}
+		if !assert.Equal(t, expected, v, `backend should match`) {
+			return
+		}
+	}
+
+	_, err := autolbclean.ParseTaskBackend(`pubsub`)
+	if !assert.Error(t, err, `unknown backend should fail`) {
+		return
+	}
+}
+
+func TestQueueStatusValidate(t *testing.T) {
+	for _, s := range []*autolbclean.QueueStatus{
+		{Name: `q`, Running: true, MaxAttempts: 5},
+		{Name: `q`, Running: true, MaxAttempts: -1},
+		{Name: `q`, Running: true},
+	} {
+		if !assert.NoError(t, s.Validate(3), `queue %#v should be valid`, s) {
+			return
+		}
+	}
+
+	for _, s := range []*autolbclean.QueueStatus{
+		{Name: `q`, Running: false, MaxAttempts: 5},
+		{Name: `q`, Running: true, MaxAttempts: 2},
+	} {
+		if !assert.Error(t, s.Validate(3), `queue %#v should be invalid`, s) {
+			return
+		}
+	}
+}
+
+type flakyEnqueuer struct {
+	failures int
+	tasks    []*autolbclean.Task
+}
+
+func (e *flakyEnqueuer) Enqueue(_ context.Context, t *autolbclean.Task) error {
+	if e.failures > 0 {
+		e.failures--
+		return errors.New(`transient error`)
+	}
+	e.tasks = append(e.tasks, t)
+	return nil
+}
+
+func TestEnqueue(t *testing.T) {
+	e := &flakyEnqueuer{failures: 1}
+	app, err := autolbclean.New(`p`, &http.Client{}, autolbclean.WithTaskEnqueuer(e))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+	c := autolbclean.DefaultConfig()
+	c.Retry.Mutation.BaseDelay = 0
+	c.Retry.Mutation.MaxDelay = 0
+	app.SetConfig(c)
+
+	task := &autolbclean.Task{Path: `/job/url-maps/delete`}
+	if !assert.NoError(t, app.Enqueue(context.Background(), task), `Enqueue should succeed after a retry`) {
+		return
+	}
+	if !assert.Len(t, e.tasks, 1, `task should be enqueued once`) {
+		return
+	}
+	if !assert.Equal(t, `p`, e.tasks[0].Params.Get(`project`), `task should carry the project`) {
+		return
+	}
+
+	e.failures = c.Retry.Mutation.Attempts
+	err = app.Enqueue(context.Background(), task)
+	if !assert.Error(t, err, `Enqueue should fail once attempts run out`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.ErrorClassEnqueue, autolbclean.ErrorClass(err), `error class should match`) {
+		return
+	}
+}
+
+func TestDeletionChain(t *testing.T) {
+	head := autolbclean.ChainDeletions([]*autolbclean.Deletion{
+		{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-1`},
+		{Kind: autolbclean.KindTargetHttpProxies, Name: `k8s-tp-1`, Region: `global`},
+		{Kind: autolbclean.KindBackendServices, Name: `k8s-be-30000`, Region: `global`, Delay: time.Minute},
+	})
+	task := autolbclean.DeletionTask(head, `2026-10-16T00:00:00Z`)
+	if !assert.Equal(t, `/job/forwarding-rules/delete`, task.Path, `the first deletion should be enqueued`) {
+		return
+	}
+
+	next, err := autolbclean.ParseDeletionChain(task.Params.Get(`next`))
+	if !assert.NoError(t, err, `parsing the chain should succeed`) {
+		return
+	}
+	if !assert.Equal(t, head.Next, next, `the rest of the chain should be carried along`) {
+		return
+	}
+
+	d := &autolbclean.Deletion{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-1`, Next: next}
+	d = d.NextDeletion()
+	if !assert.Equal(t, `k8s-tp-1`, d.Name, `target proxy should come next`) {
+		return
+	}
+	d = d.NextDeletion()
+	if !assert.Equal(t, time.Minute, d.Delay, `delay should be kept`) {
+		return
+	}
+	if !assert.Nil(t, d.NextDeletion(), `chain should end with the backend service`) {
+		return
+	}
+
+	if _, err := autolbclean.ParseDeletionChain(`[{"kind":"urlMaps"}]`); !assert.Error(t, err, `entries without a name should be rejected`) {
+		return
+	}
+}
@@ -0,0 +1,191 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ingressNameKey is the key in the JSON description of the resources
+// that GKE creates for ingresses
+const ingressNameKey = `kubernetes.io/ingress-name`
+
+// noTeam is how load balancers that no team owns are listed in the
+// rollup of the teams
+const noTeam = `(unassigned)`
+
+// KubernetesNamespace returns the namespace of the ingress or service
+// that the description of a forwarding rule refers to, or an empty
+// string if it was not created by GKE
+func KubernetesNamespace(description string) string {
+	var v map[string]string
+	if err := json.Unmarshal([]byte(description), &v); err != nil {
+		return ``
+	}
+	name := v[ingressNameKey]
+	if len(name) == 0 {
+		name = v[serviceNameKey]
+	}
+	if i := strings.IndexByte(name, '/'); i > 0 {
+		return name[:i]
+	}
+	return ``
+}
+
+// hasTeams returns true if load balancers are mapped to teams
+func (c *Config) hasTeams() bool {
+	t := c.Teams
+	return len(t.Label) > 0 || len(t.Namespaces) > 0 || len(t.Clusters) > 0
+}
+
+// TeamOf returns the team that owns the orphaned load balancer, or an
+// empty string if no team does
+func (c *Config) TeamOf(o *Orphan) string {
+	t := c.Teams
+	if len(t.Label) > 0 {
+		if team := o.Labels[t.Label]; len(team) > 0 {
+			return team
+		}
+	}
+	if team, ok := t.Namespaces[o.Namespace]; ok && len(o.Namespace) > 0 {
+		return team
+	}
+	if team, ok := t.Clusters[o.Cluster]; ok && len(o.Cluster) > 0 {
+		return team
+	}
+	return ``
+}
+
+// Teams returns the teams that own any of the orphans of the report
+func (r *Report) Teams(c *Config) []string {
+	seen := make(map[string]struct{})
+	var teams []string
+	for _, o := range r.Orphans {
+		team := c.TeamOf(o)
+		if len(team) == 0 {
+			continue
+		}
+		if _, ok := seen[team]; ok {
+			continue
+		}
+		seen[team] = struct{}{}
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+// ForTeam returns the slice of the report that covers the load
+// balancers of the given team. Project wide information, such as quota
+// usage and admin API access, is left out
+func (r *Report) ForTeam(c *Config, team string) *Report {
+	owned := make(map[string]struct{})
+	sliced := &Report{
+		Project:    r.Project,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.FinishedAt,
+	}
+	for _, o := range r.Orphans {
+		if c.TeamOf(o) != team {
+			continue
+		}
+		sliced.Orphans = append(sliced.Orphans, o)
+		for _, d := range o.Deletions() {
+			owned[d.Kind+`/`+d.Name] = struct{}{}
+		}
+	}
+	for _, o := range r.Deferred {
+		if c.TeamOf(o) == team {
+			sliced.Deferred = append(sliced.Deferred, o)
+		}
+	}
+	for _, d := range r.Scheduled {
+		if _, ok := owned[d.Kind+`/`+d.Name]; ok {
+			sliced.Scheduled = append(sliced.Scheduled, d)
+		}
+	}
+	for _, s := range r.Skipped {
+		if _, ok := owned[s.Kind+`/`+s.Name]; ok {
+			sliced.Skipped = append(sliced.Skipped, s)
+		}
+	}
+	return sliced
+}
+
+// RollupByTeam describes how many of the orphans of the report each
+// team owns, for platform admins who are notified about all of them
+func (r *Report) RollupByTeam(c *Config) string {
+	counts := make(map[string]int)
+	for _, o := range r.Orphans {
+		team := c.TeamOf(o)
+		if len(team) == 0 {
+			team = noTeam
+		}
+		counts[team]++
+	}
+
+	teams := make([]string, 0, len(counts))
+	for team := range counts {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "By team:\n")
+	for _, team := range teams {
+		fmt.Fprintf(&buf, "  - %s: %d orphaned load balancers\n", team, counts[team])
+	}
+	return buf.String()
+}
+
+// NotifyTeams sends the slice of the report that concerns each team to
+// the Slack webhook of the team, if it has one. A team failing to be
+// notified does not prevent the rest of them from being notified
+func (app *App) NotifyTeams(ctx context.Context, r *Report) error {
+	c := app.Config()
+	var err error
+	for _, team := range r.Teams(c) {
+		url, ok := c.Teams.Webhooks[team]
+		if !ok {
+			continue
+		}
+
+		var n Notifier
+		if app.teamNotifier != nil {
+			n = app.teamNotifier(url)
+		} else {
+			n = NewSlackNotifier(http.DefaultClient, url)
+		}
+
+		msg := r.ForTeam(c, team).Summary()
+		msg.Team = team
+		if nerr := (redactingNotifier{notifier: n}).Notify(ctx, msg); nerr != nil && err == nil {
+			err = errors.Wrapf(nerr, `failed to notify team %s`, team)
+		}
+	}
+	return err
+}
+
+// teamScope returns a function that tells whether the given admin may
+// act on an orphan with the given role. Bindings without a team grant
+// access to every orphan
+func teamScope(bindings []*RoleBinding, c *Config, email, role string) func(*Orphan) bool {
+	teams, all := TeamsFor(bindings, email, role)
+	if all {
+		return func(*Orphan) bool { return true }
+	}
+	allowed := make(map[string]struct{})
+	for _, team := range teams {
+		allowed[team] = struct{}{}
+	}
+	return func(o *Orphan) bool {
+		_, ok := allowed[c.TeamOf(o)]
+		return ok
+	}
+}
@@ -0,0 +1,59 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeams(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+teams:
+  label: team
+  namespaces:
+    checkout: payments
+  clusters:
+    0123456789abcdef: search
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+
+	if !assert.Equal(t, `checkout`, autolbclean.KubernetesNamespace(`{"kubernetes.io/ingress-name":"checkout/web"}`), `namespace should be parsed`) {
+		return
+	}
+
+	labeled := &autolbclean.Orphan{TargetProxy: `k8s-tp-a`, Labels: map[string]string{`team`: `growth`}, Namespace: `checkout`}
+	namespaced := &autolbclean.Orphan{TargetProxy: `k8s-tp-b`, Namespace: `checkout`, Cluster: `0123456789abcdef`}
+	clustered := &autolbclean.Orphan{TargetProxy: `k8s-tp-c`, Cluster: `0123456789abcdef`}
+	unowned := &autolbclean.Orphan{TargetProxy: `k8s-tp-d`}
+	for expected, o := range map[string]*autolbclean.Orphan{`growth`: labeled, `payments`: namespaced, `search`: clustered, ``: unowned} {
+		if !assert.Equal(t, expected, c.TeamOf(o), `team of %s should match`, o.TargetProxy) {
+			return
+		}
+	}
+
+	report := &autolbclean.Report{
+		Project: `my-project`,
+		Orphans: []*autolbclean.Orphan{labeled, namespaced, clustered, unowned},
+		Scheduled: []*autolbclean.Deletion{
+			{Kind: autolbclean.KindTargetHttpProxies, Name: `k8s-tp-a`, Region: `global`},
+			{Kind: autolbclean.KindTargetHttpProxies, Name: `k8s-tp-b`, Region: `global`},
+		},
+	}
+	if !assert.Equal(t, []string{`growth`, `payments`, `search`}, report.Teams(c), `teams should match`) {
+		return
+	}
+
+	sliced := report.ForTeam(c, `payments`)
+	if !assert.Equal(t, []*autolbclean.Orphan{namespaced}, sliced.Orphans, `only the orphans of the team should be left`) {
+		return
+	}
+	if !assert.Len(t, sliced.Scheduled, 1, `only the deletions of the team should be left`) {
+		return
+	}
+	if !assert.Contains(t, report.RollupByTeam(c), `(unassigned): 1 orphaned load balancers`) {
+		return
+	}
+}
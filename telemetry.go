@@ -0,0 +1,207 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// Error classes reported through telemetry
+const (
+	ErrorClassNotFound         = `not_found`
+	ErrorClassPermissionDenied = `permission_denied`
+	ErrorClassRateLimited      = `rate_limited`
+	ErrorClassServer           = `server_error`
+	ErrorClassTimeout          = `timeout`
+	ErrorClassEnqueue          = `enqueue`
+	ErrorClassResourceInUse    = `resource_in_use`
+	ErrorClassOther            = `other`
+)
+
+// ErrorClass classifies err coarsely enough that it does not reveal
+// anything about the project it happened in
+func ErrorClass(err error) string {
+	if IsEnqueueError(err) {
+		return ErrorClassEnqueue
+	}
+	if IsResourceInUse(err) {
+		return ErrorClassResourceInUse
+	}
+
+	cause := errors.Cause(err)
+	if cause == context.DeadlineExceeded {
+		return ErrorClassTimeout
+	}
+
+	ge, ok := cause.(*googleapi.Error)
+	if !ok {
+		return ErrorClassOther
+	}
+	switch {
+	case ge.Code == http.StatusNotFound:
+		return ErrorClassNotFound
+	case IsPermissionDenied(ge):
+		return ErrorClassPermissionDenied
+	case isRateLimited(ge):
+		return ErrorClassRateLimited
+	case ge.Code >= 500:
+		return ErrorClassServer
+	}
+	return ErrorClassOther
+}
+
+// Telemetry collects anonymous usage counters: how many resources of
+// each kind were cleaned up, how many errors of each class were
+// encountered, and how many delete jobs expired before they ran. No project IDs, resource names or error messages are
+// collected. A nil *Telemetry is valid, and records nothing
+type Telemetry struct {
+	mu       sync.Mutex
+	pipeline string
+	cleaned  map[string]int
+	failures map[string]int
+	expired  map[string]int
+}
+
+// NewTelemetry creates the counters for the given pipeline (such as
+// appengine or daemon)
+func NewTelemetry(pipeline string) *Telemetry {
+	return &Telemetry{
+		pipeline: pipeline,
+		cleaned:  make(map[string]int),
+		failures: make(map[string]int),
+		expired:  make(map[string]int),
+	}
+}
+
+// RecordDeletion counts a resource of the given kind as cleaned up
+func (t *Telemetry) RecordDeletion(kind string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cleaned[kind]++
+}
+
+// RecordError counts err by its class
+func (t *Telemetry) RecordError(err error) {
+	if t == nil || err == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures[ErrorClass(err)]++
+}
+
+// RecordExpired counts a delete job for a resource of the given kind
+// that was dropped because it expired before it could run
+func (t *Telemetry) RecordExpired(kind string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expired[kind]++
+}
+
+// RecordWorkerResult counts the deletions of a one-shot worker run
+func (t *Telemetry) RecordWorkerResult(r *WorkerResult) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, d := range r.Deletions {
+		switch {
+		case len(d.ErrorClass) > 0:
+			t.failures[d.ErrorClass]++
+		case d.Deleted:
+			t.cleaned[d.Kind]++
+		}
+	}
+}
+
+// snapshot returns the counters collected so far, and resets them
+func (t *Telemetry) snapshot() *TelemetryReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := &TelemetryReport{
+		Pipeline: t.pipeline,
+		Cleaned:  t.cleaned,
+		Errors:   t.failures,
+	}
+	if len(t.expired) > 0 {
+		report.Expired = t.expired
+	}
+	t.cleaned = make(map[string]int)
+	t.failures = make(map[string]int)
+	t.expired = make(map[string]int)
+	return report
+}
+
+// restore adds the counters of a report that could not be sent back,
+// so that they are sent along with the next one
+func (t *Telemetry) restore(report *TelemetryReport) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, n := range report.Cleaned {
+		t.cleaned[k] += n
+	}
+	for k, n := range report.Errors {
+		t.failures[k] += n
+	}
+	for k, n := range report.Expired {
+		t.expired[k] += n
+	}
+}
+
+// Flush POSTs the counters collected since the previous flush to the
+// endpoint as a JSON document. Nothing is sent if there is nothing to
+// report. If the counters can not be sent, they are kept for the next
+// flush
+func (t *Telemetry) Flush(ctx context.Context, client *http.Client, endpoint string) error {
+	if t == nil {
+		return nil
+	}
+
+	report := t.snapshot()
+	if len(report.Cleaned) == 0 && len(report.Errors) == 0 && len(report.Expired) == 0 {
+		return nil
+	}
+
+	if err := postTelemetry(ctx, client, endpoint, report); err != nil {
+		t.restore(report)
+		return err
+	}
+	return nil
+}
+
+func postTelemetry(ctx context.Context, client *http.Client, endpoint string, report *TelemetryReport) error {
+	buf, err := json.Marshal(report)
+	if err != nil {
+		return errors.Wrap(err, `failed to encode telemetry`)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(buf))
+	if err != nil {
+		return errors.Wrap(err, `failed to create request`)
+	}
+	req.Header.Set(`Content-Type`, `application/json`)
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, `failed to post telemetry`)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf(`telemetry endpoint responded with status %d`, res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package autolbclean_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestErrorClass(t *testing.T) {
+	list := map[string]error{
+		autolbclean.ErrorClassNotFound:         &googleapi.Error{Code: http.StatusNotFound},
+		autolbclean.ErrorClassPermissionDenied: errors.Wrap(&googleapi.Error{Code: http.StatusForbidden}, `failed`),
+		autolbclean.ErrorClassRateLimited:      &googleapi.Error{Code: http.StatusTooManyRequests},
+		autolbclean.ErrorClassServer:           &googleapi.Error{Code: http.StatusBadGateway},
+		autolbclean.ErrorClassTimeout:          errors.Wrap(context.DeadlineExceeded, `failed`),
+		autolbclean.ErrorClassResourceInUse:    &autolbclean.OperationError{Code: autolbclean.OperationCodeResourceInUse},
+		autolbclean.ErrorClassOther:            errors.New(`boom`),
+	}
+	for expected, err := range list {
+		if !assert.Equal(t, expected, autolbclean.ErrorClass(err), `class of %s should match`, err) {
+			return
+		}
+	}
+
+	// 403 errors are told apart by their reason
+	list = map[string]error{
+		autolbclean.ErrorClassPermissionDenied: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: `insufficientPermissions`}}},
+		autolbclean.ErrorClassRateLimited:      &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: `rateLimitExceeded`}}},
+		autolbclean.ErrorClassOther:            &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: `accessNotConfigured`}}},
+	}
+	for expected, err := range list {
+		if !assert.Equal(t, expected, autolbclean.ErrorClass(err), `class of %s should match`, err) {
+			return
+		}
+	}
+}
+
+func TestIsPermissionDenied(t *testing.T) {
+	list := map[string]bool{
+		`forbidden`:               true,
+		`insufficientPermissions`: true,
+		`rateLimitExceeded`:       false,
+		`quotaExceeded`:           false,
+	}
+	for reason, expected := range list {
+		err := errors.Wrap(&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: reason}}}, `failed`)
+		if !assert.Equal(t, expected, autolbclean.IsPermissionDenied(err), `%s should be told apart`, reason) {
+			return
+		}
+	}
+}
+
+func TestTelemetryFlush(t *testing.T) {
+	var reports []*autolbclean.TelemetryReport
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report autolbclean.TelemetryReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err == nil {
+			reports = append(reports, &report)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	tel := autolbclean.NewTelemetry(`daemon`)
+	tel.RecordWorkerResult(&autolbclean.WorkerResult{
+		Project: `secret-project`,
+		Deletions: []*autolbclean.DeletionResult{
+			{Kind: autolbclean.KindForwardingRules, Name: `k8s-fw-1`, Deleted: true},
+			{Kind: autolbclean.KindUrlMaps, Name: `k8s-um-1`, Error: `403`, ErrorClass: autolbclean.ErrorClassPermissionDenied},
+		},
+	})
+
+	ctx := context.Background()
+	if !assert.Error(t, tel.Flush(ctx, srv.Client(), srv.URL), `Flush should fail`) {
+		return
+	}
+
+	// the counters of the failed flush are sent again
+	status = http.StatusNoContent
+	tel.RecordDeletion(autolbclean.KindForwardingRules)
+	if !assert.NoError(t, tel.Flush(ctx, srv.Client(), srv.URL), `Flush should succeed`) {
+		return
+	}
+	if !assert.Len(t, reports, 2, `there should be two reports`) {
+		return
+	}
+	expected := &autolbclean.TelemetryReport{
+		Pipeline: `daemon`,
+		Cleaned:  map[string]int{autolbclean.KindForwardingRules: 2},
+		Errors:   map[string]int{autolbclean.ErrorClassPermissionDenied: 1},
+	}
+	if !assert.Equal(t, expected, reports[1], `report should match`) {
+		return
+	}
+
+	// nothing is sent when there is nothing to report
+	if !assert.NoError(t, tel.Flush(ctx, srv.Client(), srv.URL), `Flush should succeed`) {
+		return
+	}
+	if !assert.Len(t, reports, 2, `there should be no more reports`) {
+		return
+	}
+}
@@ -0,0 +1,221 @@
+package autolbclean
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultHandoffTimeout is how long handing a load balancer off to the
+// Terraform pipeline may take
+const DefaultHandoffTimeout = 30 * time.Second
+
+// IsTerraformManaged returns true if the labels of a forwarding rule
+// mark its load balancer as managed by Terraform
+func (c *Config) IsTerraformManaged(labels map[string]string) bool {
+	if len(c.Terraform.Label) == 0 {
+		return false
+	}
+	v, ok := labels[c.Terraform.Label]
+	return ok && (len(c.Terraform.Value) == 0 || v == c.Terraform.Value)
+}
+
+// isTerraformDescription returns true if the description of a resource
+// that can not be labeled carries LABEL=VALUE (or LABEL=anything when
+// no value is configured)
+func (c *Config) isTerraformDescription(description string) bool {
+	if len(c.Terraform.Label) == 0 {
+		return false
+	}
+	prefix := c.Terraform.Label + `=`
+	for _, field := range strings.FieldsFunc(description, isDescriptionSeparator) {
+		if !strings.HasPrefix(field, prefix) {
+			continue
+		}
+		if len(c.Terraform.Value) == 0 || field[len(prefix):] == c.Terraform.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// isTerraformManaged returns true if any resource of the orphaned load
+// balancer is marked as managed by Terraform. Load balancers without a
+// forwarding rule, or whose rule Terraform did not label, are still
+// found through the rest of their chain
+func (app *App) isTerraformManaged(ctx context.Context, o *Orphan) (bool, error) {
+	c := app.Config()
+	if len(c.Terraform.Label) == 0 {
+		return false, nil
+	}
+	if c.IsTerraformManaged(o.Labels) {
+		return true, nil
+	}
+
+	for _, d := range o.Deletions() {
+		labels, description, err := app.resourceMarkers(ctx, d)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return false, errors.Wrapf(err, `failed to get %s %s`, d.Kind, d.Name)
+		}
+		if c.IsTerraformManaged(labels) || c.isTerraformDescription(description) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NewStateRemoval describes the resources of the orphaned load balancer,
+// in the order they would have been deleted
+func NewStateRemoval(project string, o *Orphan) *StateRemoval {
+	sr := &StateRemoval{
+		Project:        project,
+		ForwardingRule: o.ForwardingRule,
+		Region:         o.Region,
+	}
+	for _, d := range o.Deletions() {
+		sr.Resources = append(sr.Resources, &StateRemovalResource{
+			Kind:   d.Kind,
+			Name:   d.Name,
+			Region: d.Region,
+			ID:     d.resourcePath(project),
+		})
+	}
+	return sr
+}
+
+func (sr *StateRemoval) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "The following resources of %s are managed by Terraform, and should be removed by the Terraform pipeline:\n", sr.ForwardingRule)
+	for _, r := range sr.Resources {
+		fmt.Fprintf(&buf, "  %s\n", r.ID)
+	}
+	return buf.String()
+}
+
+// HandOffToTerraform hands the orphaned load balancer over to the
+// Terraform pipeline instead of deleting it. If the store can remember
+// handoffs, a load balancer is handed off once, and again only if it
+// comes back after it stopped being an orphan. It returns false if the
+// load balancer had already been handed off
+func (app *App) HandOffToTerraform(ctx context.Context, o *Orphan) (bool, error) {
+	store, _ := app.store.(HandoffStore)
+	var records []*Candidate
+	if store != nil {
+		var err error
+		records, err = store.ListHandoffs(ctx, app.project)
+		if err != nil {
+			return false, errors.Wrap(err, `failed to load handoffs`)
+		}
+		for _, c := range records {
+			if c.SelfLink == o.SelfLink {
+				return false, nil
+			}
+		}
+	}
+
+	if err := app.handOff(ctx, NewStateRemoval(app.project, o)); err != nil {
+		return false, err
+	}
+
+	if store != nil {
+		now := time.Now().UTC()
+		records = append(records, &Candidate{SelfLink: o.SelfLink, FirstSeen: now, LastSeen: now})
+		if err := store.SaveHandoffs(ctx, app.project, records); err != nil {
+			// the worst that can happen is a second handoff
+			warningf(ctx, "Failed to record the handoff of %s: %s", o.SelfLink, err)
+		}
+	}
+	return true, nil
+}
+
+func (app *App) handOff(ctx context.Context, sr *StateRemoval) error {
+	ctx, cancel := context.WithTimeout(ctx, DefaultHandoffTimeout)
+	defer cancel()
+
+	if app.terraform != nil {
+		if err := app.terraform.HandOff(ctx, sr); err != nil {
+			return errors.Wrap(err, `failed to hand off to terraform`)
+		}
+		return nil
+	}
+
+	if len(app.notifiers) == 0 {
+		return errors.New(`no terraform handoff or notification sink configured`)
+	}
+	return app.Notify(ctx, &Notification{
+		Subject: fmt.Sprintf(`Terraform state removal requested for %s`, sr.ForwardingRule),
+		Body:    sr.String(),
+	})
+}
+
+// forgetHandoffs drops the records of the load balancers that are no
+// longer orphaned, so that they are handed off again should they come
+// back
+func forgetHandoffs(ctx context.Context, store HandoffStore, project string, orphans []*Orphan) error {
+	records, err := store.ListHandoffs(ctx, project)
+	if err != nil {
+		return errors.Wrap(err, `failed to load handoffs`)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	orphaned := make(map[string]struct{})
+	for _, o := range orphans {
+		orphaned[o.SelfLink] = struct{}{}
+	}
+	var kept []*Candidate
+	for _, c := range records {
+		if _, ok := orphaned[c.SelfLink]; ok {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == len(records) {
+		return nil
+	}
+	return errors.Wrap(store.SaveHandoffs(ctx, project, kept), `failed to save handoffs`)
+}
+
+type webhookHandoff struct {
+	client *http.Client
+	url    string
+}
+
+// NewWebhookHandoff creates a TerraformHandoff that POSTs each work item
+// to url as a JSON document
+func NewWebhookHandoff(client *http.Client, url string) TerraformHandoff {
+	return &webhookHandoff{client: client, url: url}
+}
+
+func (h *webhookHandoff) HandOff(ctx context.Context, sr *StateRemoval) error {
+	buf, err := json.Marshal(sr)
+	if err != nil {
+		return errors.Wrap(err, `failed to encode state removal`)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(buf))
+	if err != nil {
+		return errors.Wrap(err, `failed to create request`)
+	}
+	req.Header.Set(`Content-Type`, `application/json`)
+
+	res, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, `failed to post state removal`)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf(`webhook responded with status %d`, res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package autolbclean_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTerraformManaged(t *testing.T) {
+	c := autolbclean.DefaultConfig()
+	labels := map[string]string{`managed-by`: `terraform`}
+	if !assert.False(t, c.IsTerraformManaged(labels), `nothing is managed by default`) {
+		return
+	}
+
+	c.Terraform.Label = `managed-by`
+	if !assert.True(t, c.IsTerraformManaged(labels), `any value should match`) {
+		return
+	}
+	if !assert.False(t, c.IsTerraformManaged(nil), `unlabeled should not match`) {
+		return
+	}
+
+	c.Terraform.Value = `pulumi`
+	if !assert.False(t, c.IsTerraformManaged(labels), `other values should not match`) {
+		return
+	}
+}
+
+func TestWebhookHandoff(t *testing.T) {
+	var received autolbclean.StateRemoval
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	o := &autolbclean.Orphan{
+		ForwardingRule: `k8s-fw-default-web--1`,
+		Region:         `global`,
+		TargetProxy:    `k8s-tp-default-web--1`,
+		UrlMap:         `k8s-um-default-web--1`,
+	}
+	sr := autolbclean.NewStateRemoval(`p`, o)
+	h := autolbclean.NewWebhookHandoff(srv.Client(), srv.URL)
+	if !assert.NoError(t, h.HandOff(context.Background(), sr), `HandOff should succeed`) {
+		return
+	}
+	if !assert.Equal(t, `k8s-fw-default-web--1`, received.ForwardingRule, `forwarding rule should match`) {
+		return
+	}
+	if !assert.NotEmpty(t, received.Resources, `resources should be sent`) {
+		return
+	}
+	if !assert.Equal(t, `projects/p/global/forwardingRules/k8s-fw-default-web--1`, received.Resources[0].ID, `id should match`) {
+		return
+	}
+}
+
+func TestHandOffToTerraform(t *testing.T) {
+	var received int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fakeCompute{}}, autolbclean.WithStore(autolbclean.NewMemoryStore()), autolbclean.WithTerraformHandoff(autolbclean.NewWebhookHandoff(srv.Client(), srv.URL)))
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	o := &autolbclean.Orphan{
+		ForwardingRule: `k8s-fw-default-web--1`,
+		Region:         `global`,
+		TargetProxy:    `k8s-tp-default-web--1`,
+		SelfLink:       `https://www.googleapis.com/compute/v1/projects/p/global/targetHttpProxies/k8s-tp-default-web--1`,
+	}
+	for i, expected := range []bool{true, false} {
+		handedOff, err := app.HandOffToTerraform(ctx, o)
+		if !assert.NoError(t, err, `HandOffToTerraform should succeed`) || !assert.Equal(t, expected, handedOff, `handoff #%d`, i+1) {
+			return
+		}
+	}
+	if !assert.Equal(t, 1, received, `the load balancer should be handed off once`) {
+		return
+	}
+
+	// once it is no longer orphaned, it is forgotten
+	if _, err := app.RecordRun(ctx, nil); !assert.NoError(t, err, `RecordRun should succeed`) {
+		return
+	}
+	if handedOff, err := app.HandOffToTerraform(ctx, o); !assert.NoError(t, err, `HandOffToTerraform should succeed`) || !assert.True(t, handedOff, `the load balancer should be handed off again`) {
+		return
+	}
+}
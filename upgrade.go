@@ -0,0 +1,177 @@
+package autolbclean
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+// upgradeOperationTypes are the GKE operations during which node pools
+// are being recreated or repaired, and instance groups can be
+// transiently empty
+var upgradeOperationTypes = map[string]struct{}{
+	`UPGRADE_MASTER`:     {},
+	`UPGRADE_NODES`:      {},
+	`AUTO_UPGRADE_NODES`: {},
+	`REPAIR_CLUSTER`:     {},
+	`AUTO_REPAIR_NODES`:  {},
+}
+
+// zoneOf returns the zone in a resource URL, such as the URL of an
+// instance group or a network endpoint group
+func zoneOf(s string) string {
+	i := strings.Index(s, `/zones/`)
+	if i < 0 {
+		return ``
+	}
+	s = s[i+len(`/zones/`):]
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// clusterOf returns the location and name of the cluster in the target
+// link of a GKE operation
+func clusterOf(targetLink string) (string, string) {
+	i := strings.Index(targetLink, `/clusters/`)
+	if i < 0 {
+		return ``, ``
+	}
+
+	name := targetLink[i+len(`/clusters/`):]
+	if j := strings.IndexByte(name, '/'); j >= 0 {
+		name = name[:j]
+	}
+
+	location := targetLink[:i]
+	if j := strings.LastIndexByte(location, '/'); j >= 0 {
+		location = location[j+1:]
+	}
+	return location, name
+}
+
+// Zones returns the zones of the backends of the orphaned load balancer
+func (o *Orphan) Zones() []string {
+	seen := make(map[string]struct{})
+	var zones []string
+	for _, s := range o.BackendServices {
+		for _, backend := range s.Backends {
+			zone := zoneOf(backend.Group)
+			if len(zone) == 0 {
+				continue
+			}
+			if _, ok := seen[zone]; ok {
+				continue
+			}
+			seen[zone] = struct{}{}
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// UpgradingZones returns the zones that the nodes of GKE clusters with
+// an upgrade or repair operation in progress live in, mapped to the
+// name of the cluster
+func (app *App) UpgradingZones(ctx context.Context) (map[string]string, error) {
+	clusters, err := app.upgradingClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	zones := make(map[string]string)
+	for _, cluster := range clusters {
+		for _, zone := range cluster.Locations {
+			zones[zone] = cluster.Name
+		}
+	}
+	return zones, nil
+}
+
+// upgradingClusters returns the GKE clusters with an upgrade or repair
+// operation in progress
+func (app *App) upgradingClusters(ctx context.Context) ([]*container.Cluster, error) {
+	parent := `projects/` + app.project + `/locations/-`
+
+	listCtx, cancel := app.listContext(ctx)
+	defer cancel()
+
+	ops, err := app.container.Projects.Locations.Operations.List(parent).Context(listCtx).Do()
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list GKE operations`)
+	}
+
+	upgrading := make(map[string]struct{})
+	for _, op := range ops.Operations {
+		if op.Status != `RUNNING` && op.Status != `PENDING` {
+			continue
+		}
+		if _, ok := upgradeOperationTypes[op.OperationType]; !ok {
+			continue
+		}
+		location, name := clusterOf(op.TargetLink)
+		upgrading[location+`/`+name] = struct{}{}
+	}
+	if len(upgrading) == 0 {
+		return nil, nil
+	}
+
+	clusters, err := app.container.Projects.Locations.Clusters.List(parent).Context(listCtx).Do()
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to list GKE clusters`)
+	}
+
+	var result []*container.Cluster
+	for _, cluster := range clusters.Clusters {
+		if _, ok := upgrading[cluster.Location+`/`+cluster.Name]; ok {
+			result = append(result, cluster)
+		}
+	}
+	return result, nil
+}
+
+// skipUpgrading drops the orphans that have backends in a zone of a
+// GKE cluster that is being upgraded or repaired. Their instance groups
+// may only be empty because the nodes are being recreated
+func (app *App) skipUpgrading(ctx context.Context, orphans []*Orphan) ([]*Orphan, error) {
+	zones, err := app.UpgradingZones(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to check for GKE upgrades`)
+	}
+	if len(zones) == 0 {
+		return orphans, nil
+	}
+
+	var result []*Orphan
+OUTER:
+	for _, o := range orphans {
+		for _, zone := range o.Zones() {
+			if _, ok := zones[zone]; ok {
+				continue OUTER
+			}
+		}
+		result = append(result, o)
+	}
+	return result, nil
+}
+
+// keepUpgradingTags removes the node tags of the GKE clusters that are
+// being upgraded or repaired from tags2fws. Their nodes may only be
+// gone because they are being recreated
+func (app *App) keepUpgradingTags(ctx context.Context, tags2fws map[string][]*compute.Firewall) error {
+	clusters, err := app.upgradingClusters(ctx)
+	if err != nil {
+		return err
+	}
+
+	for tag := range tags2fws {
+		if nodeTagCluster(tag, clusters) != nil {
+			delete(tags2fws, tag)
+		}
+	}
+	return nil
+}
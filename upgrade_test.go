@@ -0,0 +1,31 @@
+package autolbclean_test
+
+import (
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestOrphanZones(t *testing.T) {
+	o := &autolbclean.Orphan{
+		BackendServices: []*compute.BackendService{
+			{
+				Backends: []*compute.Backend{
+					{Group: `https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-a/instanceGroups/k8s-ig--c4f34d3824aedd50`},
+					{Group: `https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-b/instanceGroups/k8s-ig--c4f34d3824aedd50`},
+				},
+			},
+			{
+				Backends: []*compute.Backend{
+					{Group: `https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-a/networkEndpointGroups/k8s1-c4f34d38-default-frontend-80-9f2b1e3a`},
+				},
+			},
+		},
+	}
+
+	if !assert.Equal(t, []string{`us-central1-a`, `us-central1-b`}, o.Zones(), `zones should match`) {
+		return
+	}
+}
@@ -0,0 +1,136 @@
+package autolbclean
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+// urlMapKey identifies a url map by its region and name, so that
+// references made through different API endpoints match
+func urlMapKey(link string) (string, bool) {
+	name, region, err := ParseUrlMap(link)
+	if err != nil {
+		return ``, false
+	}
+	return region + `/` + name, true
+}
+
+// ListDanglingUrlMaps returns the deletions of the url maps, both global
+// and regional, that were created by GKE and that no target proxy uses.
+// These are left behind when the deletion chain of a load balancer
+// fails for good after its target proxy is gone, as nothing reaches
+// them through a forwarding rule or a target proxy anymore. Their
+// backend services are picked up by the check of backend services once
+// the url maps are gone
+func (app *App) ListDanglingUrlMaps(ctx context.Context) ([]*Deletion, error) {
+	c := app.Config()
+
+	inUse, err := app.urlMapsInUse(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to find url maps in use`)
+	}
+
+	var urlMaps []*compute.UrlMap
+	if err := app.checkInventory(ctx, KindUrlMaps, func() (int, error) {
+		var err error
+		urlMaps, err = app.listUrlMaps(ctx)
+		return len(urlMaps), errors.Wrap(err, `failed to list url maps`)
+	}); err != nil {
+		return nil, err
+	}
+
+	var clusters []*container.Cluster
+	if c.ClusterCrossCheck {
+		if clusters, err = app.liveClusters(ctx); err != nil {
+			return nil, errors.Wrap(err, `failed to cross-check GKE clusters`)
+		}
+	}
+
+	owned := app.multiClusterOwned(ctx)
+	var result []*Deletion
+	for _, um := range urlMaps {
+		if !c.IsDeletableName(KindUrlMaps, um.Name) || c.IsExcluded(um.Name) || c.IsProtected(nil, um.Description) {
+			continue
+		}
+
+		if c.ownedByLiveCluster(um.Name, clusters) || owned(um.Name) {
+			continue
+		}
+
+		// give the ingress controller a chance to attach it to a proxy
+		if c.isYoung(KindUrlMaps, um.CreationTimestamp) {
+			continue
+		}
+
+		key, ok := urlMapKey(um.SelfLink)
+		if !ok {
+			continue
+		}
+		if _, ok := inUse[key]; ok {
+			continue
+		}
+
+		_, region, _ := ParseUrlMap(um.SelfLink)
+		if sweepPolicyKeeps(ctx, c, sweptResource(KindUrlMaps, um.Name, region, ``, um.CreationTimestamp), nil) {
+			continue
+		}
+		result = append(result, &Deletion{
+			Kind:   KindUrlMaps,
+			Name:   um.Name,
+			Region: region,
+		})
+	}
+	sortDeletions(result)
+	return result, nil
+}
+
+// urlMapsInUse returns the keys (REGION/NAME) of the url maps that the
+// target HTTP(S) and gRPC proxies use, in every region
+func (app *App) urlMapsInUse(ctx context.Context) (map[string]struct{}, error) {
+	inUse := make(map[string]struct{})
+	use := func(link string) {
+		if key, ok := urlMapKey(link); ok {
+			inUse[key] = struct{}{}
+		}
+	}
+
+	var httpProxies []*compute.TargetHttpProxy
+	if err := app.checkInventory(ctx, KindTargetHttpProxies, func() (int, error) {
+		var err error
+		httpProxies, err = app.listAllTargetHttpProxies(ctx)
+		return len(httpProxies), errors.Wrap(err, `failed to list target http proxies`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, tp := range httpProxies {
+		use(tp.UrlMap)
+	}
+
+	var httpsProxies []*compute.TargetHttpsProxy
+	if err := app.checkInventory(ctx, KindTargetHttpsProxies, func() (int, error) {
+		var err error
+		httpsProxies, err = app.listAllTargetHttpsProxies(ctx)
+		return len(httpsProxies), errors.Wrap(err, `failed to list target https proxies`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, tp := range httpsProxies {
+		use(tp.UrlMap)
+	}
+
+	var grpcProxies []*compute.TargetGrpcProxy
+	if err := app.checkInventory(ctx, inventoryTargetGrpcProxies, func() (int, error) {
+		var err error
+		grpcProxies, err = app.listTargetGrpcProxies(ctx)
+		return len(grpcProxies), errors.Wrap(err, `failed to list target grpc proxies`)
+	}); err != nil {
+		return nil, err
+	}
+	for _, tp := range grpcProxies {
+		use(tp.UrlMap)
+	}
+	return inUse, nil
+}
@@ -0,0 +1,202 @@
+package autolbclean
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Reasons that deletions are held back for
+const (
+	HeldPaused           = `paused`
+	HeldOutsideOfWindows = `outside of the deletion windows`
+)
+
+// cronField describes one of the fields of a cron expression
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string // names of the values, starting at min
+}
+
+var cronFields = []cronField{
+	{name: `minute`, min: 0, max: 59},
+	{name: `hour`, min: 0, max: 23},
+	{name: `day of month`, min: 1, max: 31},
+	{name: `month`, min: 1, max: 12, names: []string{`JAN`, `FEB`, `MAR`, `APR`, `MAY`, `JUN`, `JUL`, `AUG`, `SEP`, `OCT`, `NOV`, `DEC`}},
+	// 7 is Sunday too, as in most crons
+	{name: `day of week`, min: 0, max: 7, names: []string{`SUN`, `MON`, `TUE`, `WED`, `THU`, `FRI`, `SAT`}},
+}
+
+// cronSchedule is a parsed cron expression. Each field is the set of
+// the values it matches, as a bit mask
+type cronSchedule struct {
+	fields [5]uint64
+	// when both the day of month and the day of week are restricted, a
+	// day matching either of them matches, as in cron
+	anyDay bool
+}
+
+// parseCron parses a standard cron expression of five fields (minute,
+// hour, day of month, month and day of week). Each field is a list of
+// values, ranges (a-b) or *, optionally with a step (/n). Months and
+// days of week may be given by their three letter English names
+func parseCron(s string) (*cronSchedule, error) {
+	list := strings.Fields(s)
+	if len(list) != len(cronFields) {
+		return nil, errors.Errorf(`invalid cron expression %q: expected %d fields, got %d`, s, len(cronFields), len(list))
+	}
+
+	var sched cronSchedule
+	for i, field := range cronFields {
+		mask, err := field.parse(list[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, `invalid cron expression %q`, s)
+		}
+		sched.fields[i] = mask
+	}
+	if sched.fields[4]&(1<<7) != 0 {
+		sched.fields[4] |= 1
+	}
+	sched.anyDay = !strings.HasPrefix(list[2], `*`) && !strings.HasPrefix(list[4], `*`)
+	return &sched, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, errors.Errorf(`invalid %s %q (expected %d-%d)`, f.name, s, f.min, f.max)
+	}
+	return n, nil
+}
+
+func (f cronField) parse(s string) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(s, `,`) {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, errors.Errorf(`invalid step %q in %s`, part[i+1:], f.name)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case part == `*`:
+		case strings.IndexByte(part, '-') > 0:
+			i := strings.IndexByte(part, '-')
+			var err error
+			if lo, err = f.value(part[:i]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(part[i+1:]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, errors.Errorf(`invalid %s range %q`, f.name, part)
+			}
+		default:
+			n, err := f.value(part)
+			if err != nil {
+				return 0, err
+			}
+			lo = n
+			// a single value with a step starts a range, as in cron
+			if step == 1 {
+				hi = n
+			}
+		}
+
+		for n := lo; n <= hi; n += step {
+			mask |= 1 << uint(n)
+		}
+	}
+	return mask, nil
+}
+
+// matches returns true if the minute that t is in matches the schedule
+func (s *cronSchedule) matches(t time.Time) bool {
+	has := func(i, n int) bool { return s.fields[i]&(1<<uint(n)) != 0 }
+	if !has(0, t.Minute()) || !has(1, t.Hour()) || !has(3, int(t.Month())) {
+		return false
+	}
+	dom := has(2, t.Day())
+	dow := has(4, int(t.Weekday()))
+	if s.anyDay {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func validateDeletionWindows(windows []string) error {
+	for _, w := range windows {
+		if _, err := parseCron(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Location returns the time zone of the configuration, or UTC if there
+// is none
+func (c *Config) Location() *time.Location {
+	if len(c.TimeZone) == 0 {
+		return time.UTC
+	}
+	// the time zone was validated along with the rest of the
+	// configuration
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// InDeletionWindow returns true if deletions may be carried out at the
+// given time: when no deletion windows are configured, or when the
+// minute that t is in matches any of them. Windows are matched against
+// the wall clock of the configured time zone, so they follow daylight
+// saving time. Minutes that are skipped when clocks go forward never
+// match, and those that repeat when clocks go back match both times
+func (c *Config) InDeletionWindow(t time.Time) bool {
+	if len(c.DeletionWindows) == 0 {
+		return true
+	}
+	t = t.In(c.Location())
+	for _, w := range c.DeletionWindows {
+		// the windows were validated along with the rest of the
+		// configuration
+		sched, err := parseCron(w)
+		if err != nil {
+			continue
+		}
+		if sched.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeletionsHeld returns why deletions may not be carried out at the
+// given time, or an empty string if they may. Orphans are still found
+// and reported while deletions are held
+func (c *Config) DeletionsHeld(t time.Time) string {
+	if c.Paused {
+		return HeldPaused
+	}
+	if !c.InDeletionWindow(t) {
+		return HeldOutsideOfWindows
+	}
+	return ``
+}
@@ -0,0 +1,99 @@
+package autolbclean_test
+
+import (
+	"testing"
+	"time"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeletionWindows(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+deletion_windows:
+  - "* 9-16 * * MON-FRI"
+  - "0-29 3 1 * *"
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+
+	// 2026-10-16 is a Friday
+	if !assert.True(t, c.InDeletionWindow(time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)), `business hours should be in the window`) {
+		return
+	}
+	if !assert.False(t, c.InDeletionWindow(time.Date(2026, 10, 16, 17, 0, 0, 0, time.UTC)), `evenings should not be in the window`) {
+		return
+	}
+	if !assert.False(t, c.InDeletionWindow(time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)), `weekends should not be in the window`) {
+		return
+	}
+	if !assert.True(t, c.InDeletionWindow(time.Date(2026, 11, 1, 3, 15, 0, 0, time.UTC)), `any window should do`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.HeldOutsideOfWindows, c.DeletionsHeld(time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)), `deletions should be held outside of the windows`) {
+		return
+	}
+	if !assert.Empty(t, c.DeletionsHeld(time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)), `deletions should not be held in the windows`) {
+		return
+	}
+
+	c.Paused = true
+	if !assert.Equal(t, autolbclean.HeldPaused, c.DeletionsHeld(time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)), `pausing should hold deletions in the windows too`) {
+		return
+	}
+
+	if !assert.True(t, autolbclean.DefaultConfig().InDeletionWindow(time.Now()), `deletions should be allowed at any time without windows`) {
+		return
+	}
+
+	for _, expr := range []string{`* 9-17 * *`, `60 * * * *`, `* 17-9 * * *`, `* * * * FUN`, `*/0 * * * *`} {
+		if _, err := autolbclean.ParseConfig([]byte("deletion_windows: [ \"" + expr + "\" ]\n")); !assert.Error(t, err, `%q should be rejected`, expr) {
+			return
+		}
+	}
+}
+
+func TestDeletionWindowsTimeZone(t *testing.T) {
+	c, err := autolbclean.ParseConfig([]byte(`
+time_zone: Europe/Berlin
+deletion_windows:
+  - "* 9-16 * * MON-FRI"
+  - "30 2 * * SUN"
+`))
+	if !assert.NoError(t, err, `ParseConfig should succeed`) {
+		return
+	}
+
+	// Berlin is 2 hours ahead of UTC in the summer, and 1 hour in the winter
+	if !assert.True(t, c.InDeletionWindow(time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC)), `9:00 in Berlin should be in the window in the summer`) {
+		return
+	}
+	if !assert.False(t, c.InDeletionWindow(time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC)), `17:00 in Berlin should not be in the window in the summer`) {
+		return
+	}
+	if !assert.True(t, c.InDeletionWindow(time.Date(2026, 12, 1, 8, 0, 0, 0, time.UTC)), `9:00 in Berlin should be in the window in the winter`) {
+		return
+	}
+
+	// 2:30 does not happen in Berlin on 2026-03-29, and happens twice on
+	// 2026-10-25
+	for start := time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC); start.Hour() < 3; start = start.Add(time.Minute) {
+		if !assert.False(t, c.InDeletionWindow(start), `%s should not be in the window`, start) {
+			return
+		}
+	}
+	if !assert.True(t, c.InDeletionWindow(time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC)), `the first 2:30 should be in the window`) {
+		return
+	}
+	if !assert.True(t, c.InDeletionWindow(time.Date(2026, 10, 25, 1, 30, 0, 0, time.UTC)), `the second 2:30 should be in the window`) {
+		return
+	}
+
+	if !assert.Equal(t, time.UTC, autolbclean.DefaultConfig().Location(), `the default time zone should be UTC`) {
+		return
+	}
+	if _, err := autolbclean.ParseConfig([]byte("time_zone: Mars/Olympus_Mons\n")); !assert.Error(t, err, `unknown time zones should be rejected`) {
+		return
+	}
+}
@@ -0,0 +1,280 @@
+package autolbclean
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// Exit codes of the one-shot worker. Pipelines can branch on these
+const (
+	ExitClean          = 0 // no orphans were found, or all of them were deleted
+	ExitError          = 1 // the worker could not run to completion
+	ExitUsage          = 2 // the worker was invoked incorrectly
+	ExitOrphansFound   = 3 // orphans were found, but plan-only mode was requested, or their confidence is too low
+	ExitPartialFailure = 4 // some of the load balancers could not be checked, or some of the deletions failed
+)
+
+// Statuses of the one-shot worker, reported along with the exit code
+const (
+	StatusClean          = `clean`
+	StatusDeleted        = `deleted`
+	StatusError          = `error`
+	StatusOrphansFound   = `orphans_found`
+	StatusPartialFailure = `partial_failure`
+)
+
+func (r *WorkerResult) setStatus(status string, code int) {
+	r.Status = status
+	r.ExitCode = code
+}
+
+// RunWorker runs a single cleanup pass synchronously, without going
+// through any task queue. When planOnly is true, the orphans are only
+// reported and nothing is deleted. Otherwise the resources are deleted
+// one by one, in dependency order, waiting for each deletion to complete.
+//
+// The returned result is never nil, and its ExitCode describes the
+// outcome of the run according to the worker's exit code contract
+func (app *App) RunWorker(ctx context.Context, planOnly bool) *WorkerResult {
+	result := &WorkerResult{
+		Project:  app.project,
+		RunID:    app.runID,
+		PlanOnly: planOnly,
+	}
+
+	// the history is best effort as well
+	startedAt := time.Now().UTC()
+	defer func() { _ = app.SaveRun(ctx, result.runRecord(startedAt)) }()
+
+	// pausing and suppressions made through the admin API apply to
+	// every deployment mode that shares the store
+	if err := app.ApplyAdminState(ctx); err != nil {
+		result.Error = RedactError(err)
+		result.setStatus(StatusError, ExitError)
+		return result
+	}
+
+	// while paused, or outside of the deletion windows, we still report
+	// what we would have deleted
+	if len(app.Config().DeletionsHeld(time.Now())) > 0 {
+		planOnly = true
+		result.PlanOnly = true
+	}
+
+	orphans, unchecked, err := app.findOrphans(ctx)
+	if err != nil {
+		result.Error = RedactError(err)
+		result.setStatus(StatusError, ExitError)
+		return result
+	}
+
+	result.Orphans = len(orphans)
+	result.Unchecked = unchecked
+
+	// the run status, candidates and metrics are best effort, and must
+	// not change the outcome of the run
+	defer app.RecordRun(ctx, orphans)
+	if app.runMetrics {
+		defer func() { _ = app.WriteRunMetrics(ctx, result.RunMetrics()) }()
+	}
+
+	// from here on, the run is going to finish one way or another, so
+	// the next run should start from scratch. If the plan can not be
+	// discarded, the next run will find it and apply its policy
+	defer app.FinishPlan(ctx)
+
+	// orphans that we are not sure enough about, or that the policies
+	// keep, are only reported
+	c := app.Config()
+	eligible, reportOnly := c.splitReportOnly(orphans)
+	result.ReportOnly = len(reportOnly)
+
+	scheduled, deferred := PrioritizeOrphans(eligible, nil, app.deletionBudget)
+	result.Deferred = len(deferred)
+
+	// load balancers managed by terraform are handed off instead
+	var handoffs, unsure []*Orphan
+	for _, o := range scheduled {
+		managed, err := app.isTerraformManaged(ctx, o)
+		if err != nil {
+			// deleting what might be managed by terraform is worse
+			// than leaving it for the next run
+			unsure = append(unsure, o)
+			continue
+		}
+		if managed {
+			handoffs = append(handoffs, o)
+			continue
+		}
+		for _, d := range o.Deletions() {
+			result.Deletions = append(result.Deletions, &DeletionResult{
+				Kind:   d.Kind,
+				Name:   d.Name,
+				Region: d.Region,
+				Zone:   d.Zone,
+			})
+		}
+	}
+
+	// the orphans among the load balancers that could not be checked
+	// are missing from the plan, so the run can not be clean
+	if len(result.Deletions) == 0 && len(handoffs) == 0 && len(unsure) == 0 {
+		if unchecked > 0 {
+			result.setStatus(StatusPartialFailure, ExitPartialFailure)
+			return result
+		}
+		if len(reportOnly) > 0 {
+			result.setStatus(StatusOrphansFound, ExitOrphansFound)
+			return result
+		}
+		result.setStatus(StatusClean, ExitClean)
+		return result
+	}
+
+	if planOnly {
+		if unchecked > 0 {
+			result.setStatus(StatusPartialFailure, ExitPartialFailure)
+			return result
+		}
+		result.setStatus(StatusOrphansFound, ExitOrphansFound)
+		return result
+	}
+
+	skipped := &Report{}
+	for _, o := range deferred {
+		skipped.SkipOrphan(o, `deletion budget exhausted, deferred to the next run`)
+	}
+	for _, o := range reportOnly {
+		skipped.SkipOrphan(o, c.reportOnlyReason(o))
+	}
+
+	failed := len(unsure) + unchecked
+	for _, o := range unsure {
+		skipped.SkipOrphan(o, `failed to check whether it is managed by terraform`)
+	}
+	for _, o := range handoffs {
+		handedOff, err := app.HandOffToTerraform(ctx, o)
+		if err != nil {
+			skipped.SkipOrphan(o, `failed to hand off to terraform`)
+			failed++
+			continue
+		}
+		if !handedOff {
+			skipped.SkipOrphan(o, `managed by terraform, already handed off`)
+			continue
+		}
+		skipped.SkipOrphan(o, `managed by terraform, handed off`)
+		result.HandedOff++
+	}
+	for _, s := range skipped.Skipped {
+		_ = app.PublishSkipped(ctx, s)
+	}
+
+	// events are best effort, like notifications
+	for _, dr := range result.Deletions {
+		_ = app.PublishEvent(ctx, dr.deletion(), DecisionScheduled, nil)
+	}
+
+	for _, dr := range result.Deletions {
+		d := dr.deletion()
+		op, err := app.Delete(ctx, d)
+		if err == nil {
+			err = app.WaitOperation(ctx, op)
+		}
+		// a resumed plan may include resources that were deleted
+		// right before the previous run died
+		if err != nil && !isNotFound(err) {
+			dr.Error = RedactError(err)
+			dr.ErrorClass = ErrorClass(err)
+			_ = app.PublishEvent(ctx, d, DecisionFailed, err)
+			failed++
+			continue
+		}
+		dr.Deleted = true
+		_ = app.PublishEvent(ctx, d, DecisionDeleted, nil)
+	}
+
+	if failed > 0 {
+		result.setStatus(StatusPartialFailure, ExitPartialFailure)
+		return result
+	}
+
+	result.setStatus(StatusDeleted, ExitClean)
+	return result
+}
+
+func (r *WorkerResult) runRecord(startedAt time.Time) *RunRecord {
+	rec := &RunRecord{
+		StartedAt:  startedAt,
+		FinishedAt: time.Now().UTC(),
+		Orphans:    r.Orphans,
+		Skipped:    r.Deferred + r.HandedOff + r.ReportOnly,
+	}
+	if !r.PlanOnly {
+		rec.Scheduled = len(r.Deletions)
+	}
+	for _, dr := range r.Deletions {
+		switch {
+		case dr.Deleted:
+			rec.Deleted++
+		case len(dr.Error) > 0:
+			rec.Failed++
+		}
+	}
+	return rec
+}
+
+func (dr *DeletionResult) deletion() *Deletion {
+	return &Deletion{
+		Kind:   dr.Kind,
+		Name:   dr.Name,
+		Region: dr.Region,
+		Zone:   dr.Zone,
+	}
+}
+
+func isNotFound(err error) bool {
+	ge, ok := errors.Cause(err).(*googleapi.Error)
+	return ok && ge.Code == http.StatusNotFound
+}
+
+// IsPermissionDenied returns true if the API call failed because the
+// credentials lack a permission. Retrying these does not help until
+// someone grants the permission. The API also responds with 403 when a
+// rate limit or a quota is exceeded, which is not a permission error
+func IsPermissionDenied(err error) bool {
+	ge, ok := errors.Cause(err).(*googleapi.Error)
+	if !ok || ge.Code != http.StatusForbidden {
+		return false
+	}
+	// errors without details can only be told apart by their code
+	if len(ge.Errors) == 0 {
+		return true
+	}
+	for _, item := range ge.Errors {
+		switch item.Reason {
+		case `forbidden`, `insufficientPermissions`:
+			return true
+		}
+	}
+	return false
+}
+
+// isRateLimited returns true if the API call failed because a rate
+// limit or a quota was exceeded
+func isRateLimited(ge *googleapi.Error) bool {
+	if ge.Code == http.StatusTooManyRequests {
+		return true
+	}
+	for _, item := range ge.Errors {
+		switch item.Reason {
+		case `rateLimitExceeded`, `userRateLimitExceeded`, `quotaExceeded`:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package autolbclean_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	autolbclean "github.com/lestrrat/gcp-auto-lb-clean"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunWorkerUncheckedLoadBalancers(t *testing.T) {
+	const prefix = `https://www.googleapis.com/compute/v1/projects/p/global/`
+	fake := fakeCompute{
+		// the target proxy of the forwarding rule can not be fetched
+		`aggregated/forwardingRules`: map[string]interface{}{
+			`items`: map[string]interface{}{
+				`global`: map[string]interface{}{
+					`forwardingRules`: []interface{}{
+						map[string]interface{}{
+							`name`:     `k8s-fw-a`,
+							`selfLink`: prefix + `forwardingRules/k8s-fw-a`,
+							`target`:   prefix + `targetHttpProxies/k8s-tp-a`,
+						},
+					},
+				},
+			},
+		},
+		`aggregated/targetHttpProxies`:  map[string]interface{}{},
+		`aggregated/targetHttpsProxies`: map[string]interface{}{},
+	}
+
+	app, err := autolbclean.New(`p`, &http.Client{Transport: fake})
+	if !assert.NoError(t, err, `New should succeed`) {
+		return
+	}
+
+	result := app.RunWorker(context.Background(), true)
+	if !assert.Equal(t, 1, result.Unchecked, `the load balancer that could not be checked should be counted`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.StatusPartialFailure, result.Status, `a run with unchecked load balancers is not clean`) {
+		return
+	}
+	if !assert.Equal(t, autolbclean.ExitPartialFailure, result.ExitCode, `a run with unchecked load balancers is not clean`) {
+		return
+	}
+}